@@ -0,0 +1,461 @@
+package ipfscluster
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/allocator/filters"
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// allocate finds peers to allocate a hash using the informer and the monitor.
+// It returns between rplMin and rplMax allocations, trying to reach rplMax
+// when enough candidates are available. It should only be used with
+// positive replication factors. The size of the hash is 0 when unknown.
+// The returned AllocationRecord holds the allocations along with the
+// metrics and the reason for the decision.
+func (c *Cluster) allocate(hash *cid.Cid, size uint64, rplMin, rplMax int, blacklist []peer.ID) (api.AllocationRecord, error) {
+	rec := api.AllocationRecord{
+		Cid:        hash,
+		Size:       size,
+		Peer:       c.id,
+		MetricName: c.getInformer().Name(),
+		Metrics:    make(map[peer.ID]string),
+		Vetoes:     make(map[peer.ID]string),
+		TS:         time.Now(),
+	}
+	fail := func(err error) (api.AllocationRecord, error) {
+		rec.Error = err.Error()
+		return rec, err
+	}
+
+	if rplMin <= 0 || rplMax <= 0 {
+		return fail(errors.New("cannot decide allocation for replication factor <= 0"))
+	}
+	if rplMin > rplMax {
+		return fail(errors.New("minimum replication factor is larger than maximum"))
+	}
+
+	// Figure out who is currently holding this
+	var pinAllocations []peer.ID
+	var maintenance []peer.ID
+	st, err := c.consensus.State()
+	if err != nil {
+		// no state we assume it is empty. If there was other
+		// problem, we would fail to commit anyway.
+		pinAllocations = []peer.ID{}
+	} else {
+		pin := st.Get(hash)
+		pinAllocations = pin.Allocations
+		maintenance = st.MaintenancePeers()
+	}
+
+	metrics, err := c.getLeaderMetrics(c.getInformer().Name())
+	if err != nil {
+		return fail(err)
+	}
+
+	return c.decideAllocation(rec, rplMin, rplMax, blacklist, pinAllocations, maintenance, metrics)
+}
+
+// decideAllocation completes the given AllocationRecord with the
+// allocations for its Cid and Size, given the peers currently allocated to it, the
+// peers in maintenance and the last informer metrics. It does not fetch
+// the shared state, so it can be used to simulate allocations. The peers
+// reporting metrics are recorded as considered, and the ones excluded
+// from the decision are recorded along with the reason.
+func (c *Cluster) decideAllocation(rec api.AllocationRecord, rplMin, rplMax int, blacklist, pinAllocations, maintenance []peer.ID, metrics []api.Metric) (api.AllocationRecord, error) {
+	hash := rec.Cid
+	fail := func(err error) (api.AllocationRecord, error) {
+		rec.Error = err.Error()
+		return rec, err
+	}
+
+	// We must divide the metrics between current and candidates
+	current := make(map[peer.ID]api.Metric)
+	candidates := make(map[peer.ID]api.Metric)
+	validAllocations := make([]peer.ID, 0, len(pinAllocations))
+	for _, m := range metrics {
+		rec.Considered = append(rec.Considered, m.Peer)
+		if m.Discard() {
+			rec.Vetoes[m.Peer] = "invalid or expired metric"
+			continue
+		} else if containsPeer(blacklist, m.Peer) {
+			// blacklisted peers do not exist for us
+			rec.Vetoes[m.Peer] = "blacklisted"
+			continue
+		} else if containsPeer(pinAllocations, m.Peer) {
+			current[m.Peer] = m
+			validAllocations = append(validAllocations, m.Peer)
+		} else if containsPeer(maintenance, m.Peer) {
+			// peers in maintenance do not get new allocations
+			rec.Vetoes[m.Peer] = "in maintenance"
+			continue
+		} else {
+			candidates[m.Peer] = m
+		}
+	}
+
+	// peers in maintenance keep their allocations even if they
+	// are down and not reporting metrics.
+	for _, p := range pinAllocations {
+		if containsPeer(maintenance, p) &&
+			!containsPeer(validAllocations, p) &&
+			!containsPeer(blacklist, p) {
+			validAllocations = append(validAllocations, p)
+		}
+	}
+
+	size := rec.Size
+	candidates, err := c.filterCandidates(hash, size, candidates, rec.Vetoes)
+	if err != nil {
+		return fail(err)
+	}
+
+	for p, m := range current {
+		rec.Metrics[p] = m.Value
+	}
+	for p, m := range candidates {
+		rec.Metrics[p] = m.Value
+	}
+
+	// Move allocations away from current peers only when a candidate
+	// improves their metric beyond the configured threshold.
+	moved := 0
+	if t := c.reallocationThreshold(); t > 0 && len(current) > 0 && len(candidates) > 0 {
+		validAllocations, moved, err = c.stickyAllocations(hash, size, validAllocations, current, candidates, t)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	currentValid := len(validAllocations)
+	candidatesValid := len(candidates)
+	needed := rplMin - currentValid
+	wanted := rplMax - currentValid
+
+	logger.Debugf("allocate: Valid allocations: %d", currentValid)
+	logger.Debugf("allocate: Valid candidates: %d", candidatesValid)
+	logger.Debugf("allocate: Needed: %d. Wanted: %d", needed, wanted)
+
+	// If wanted == 0, we don't need anything. If wanted < 0, we are
+	// reducing the replication factor
+	switch {
+	case wanted == 0 && moved > 0:
+		rec.Reason = fmt.Sprintf("moved %d allocations to candidates improving the metric beyond the threshold", moved)
+		rec.Allocations = validAllocations
+		return rec, nil
+	case wanted == 0:
+		rec.Reason = "current allocations match the replication factor"
+		rec.Allocations = validAllocations
+		return rec, nil
+	case wanted < 0: // keep the best current allocations
+		allocs, err := c.pruneAllocations(hash, validAllocations, current, len(validAllocations)+wanted)
+		if err != nil {
+			return fail(err)
+		}
+		rec.Reason = "over-replicated: dropped the allocations with the worst metrics"
+		rec.Allocations = allocs
+		return rec, nil
+	case candidatesValid < needed:
+		candidatesIds := []peer.ID{}
+		for k := range candidates {
+			candidatesIds = append(candidatesIds, k)
+		}
+		err = &api.AllocationError{
+			Cid: hash,
+			Reason: fmt.Sprintf("not enough candidates. Needed: %d. Got: %d (%s)",
+				needed, candidatesValid, candidatesIds),
+			Vetoes: rec.Vetoes,
+		}
+		logger.Error(err)
+		return fail(err)
+	default:
+		// this will return candidate peers in order of
+		// preference according to the allocator.
+		candidateAllocs, err := c.getAllocator().Allocate(hash, size, current, candidates)
+		if err != nil {
+			return fail(logError(err.Error()))
+		}
+
+		logger.Debugf("allocate: candidate allocations: %s", candidateAllocs)
+
+		// we don't have enough peers to pin
+		got := len(candidateAllocs)
+		if got < needed {
+			err = &api.AllocationError{
+				Cid: hash,
+				Reason: fmt.Sprintf("cannot find enough allocations. Needed: %d. Got: %d (%s)",
+					needed, got, candidateAllocs),
+				Vetoes: rec.Vetoes,
+			}
+			logger.Error(err)
+			return fail(err)
+		}
+
+		if got > wanted {
+			got = wanted
+		}
+
+		if len(blacklist) > 0 {
+			rec.Reason = fmt.Sprintf("re-allocated excluding %s: added the best candidates", blacklist)
+		} else {
+			rec.Reason = "under-replicated: added the best candidates"
+		}
+		// the new allocations = the valid ones we had + the needed ones
+		rec.Allocations = append(validAllocations, candidateAllocs[0:got]...)
+		return rec, nil
+	}
+}
+
+// pruneAllocations returns the keep most preferred peers among the current
+// allocations, as sorted by the allocator. Thus, the peers with the worst
+// metrics are the ones dropped. Allocations without metrics are the least
+// preferred.
+func (c *Cluster) pruneAllocations(hash *cid.Cid, allocs []peer.ID, current map[peer.ID]api.Metric, keep int) ([]peer.ID, error) {
+	sorted, err := c.getAllocator().Allocate(hash, 0, map[peer.ID]api.Metric{}, current)
+	if err != nil {
+		return nil, logError(err.Error())
+	}
+
+	// the allocator may not return all the peers we gave it. Those are
+	// the least preferred ones.
+	for _, p := range allocs {
+		if !containsPeer(sorted, p) {
+			sorted = append(sorted, p)
+		}
+	}
+
+	if keep > len(sorted) {
+		keep = len(sorted)
+	}
+
+	removed := sorted[keep:]
+	logger.Infof("over-replicated %s: dropping allocations on %s", hash, removed)
+	return sorted[0:keep], nil
+}
+
+// stickyAllocations replaces the current allocations with the worst
+// metrics by the best candidates, but only when the candidate metric
+// improves the current one by more than threshold (relative to the
+// current value). This avoids moving pins around when metrics fluctuate
+// slightly. Swapped peers are moved between the current and candidates
+// maps. It returns the new allocations and how many were replaced.
+func (c *Cluster) stickyAllocations(hash *cid.Cid, size uint64, allocs []peer.ID, current, candidates map[peer.ID]api.Metric, threshold float64) ([]peer.ID, int, error) {
+	all := make(map[peer.ID]api.Metric)
+	for p, m := range current {
+		all[p] = m
+	}
+	for p, m := range candidates {
+		all[p] = m
+	}
+
+	// the allocator tells us which metrics are preferred
+	ranking, err := c.getAllocator().Allocate(hash, size, map[peer.ID]api.Metric{}, all)
+	if err != nil {
+		return nil, 0, logError(err.Error())
+	}
+
+	var best, worst []peer.ID
+	for _, p := range ranking {
+		if _, ok := candidates[p]; ok {
+			best = append(best, p)
+		}
+	}
+	for i := len(ranking) - 1; i >= 0; i-- {
+		if _, ok := current[ranking[i]]; ok {
+			worst = append(worst, ranking[i])
+		}
+	}
+
+	moved := 0
+	for i := 0; i < len(best) && i < len(worst); i++ {
+		cand, cur := best[i], worst[i]
+		if indexOfPeer(ranking, cand) > indexOfPeer(ranking, cur) {
+			break // candidates are not better anymore
+		}
+		if !exceedsThreshold(current[cur].Value, candidates[cand].Value, threshold) {
+			break // gaps only get smaller from here
+		}
+
+		logger.Infof("allocate: moving %s from %s to %s", hash, cur.Pretty(), cand.Pretty())
+		for j, p := range allocs {
+			if p == cur {
+				allocs[j] = cand
+			}
+		}
+		current[cand] = candidates[cand]
+		delete(candidates, cand)
+		delete(current, cur)
+		moved++
+	}
+	return allocs, moved, nil
+}
+
+// exceedsThreshold returns true when the difference between two numeric
+// metric values is larger than threshold times the current value.
+// Non-numeric values never exceed it.
+func exceedsThreshold(currentValue, candidateValue string, threshold float64) bool {
+	cur, err := strconv.ParseFloat(currentValue, 64)
+	if err != nil {
+		return false
+	}
+	cand, err := strconv.ParseFloat(candidateValue, 64)
+	if err != nil {
+		return false
+	}
+	return math.Abs(cand-cur) > threshold*math.Abs(cur)
+}
+
+// simulateAllocated updates the metrics of the given peers as if they had
+// pinned an item of the given size, for SimulateAllocations. Pin counts
+// are incremented, and the size of the item, when known, is subtracted
+// from the free space and added to the repository size. Other metrics
+// are left as they are.
+func simulateAllocated(metrics []api.Metric, peers []peer.ID, size uint64) {
+	for i, m := range metrics {
+		if m.Discard() || !containsPeer(peers, m.Peer) {
+			continue
+		}
+		v, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(m.Name, "numpin"):
+			v++
+		case m.Name == "freespace" && v > size:
+			v -= size
+		case m.Name == "freespace":
+			v = 0
+		case m.Name == "reposize":
+			v += size
+		default:
+			continue
+		}
+		metrics[i].Value = strconv.FormatUint(v, 10)
+	}
+}
+
+// cidSize returns the cumulative size of the given Cid as reported by
+// the IPFS daemon, or 0 when it cannot tell it (i.e. the content is not
+// available yet). It blocks until the daemon answers, so it should not
+// be used for every item of a batch.
+func (c *Cluster) cidSize(hash *cid.Cid) uint64 {
+	size, err := c.ipfs.ObjectSize(hash)
+	if err != nil {
+		logger.Debugf("allocate: cannot estimate the size of %s: %s", hash, err)
+		return 0
+	}
+	return size
+}
+
+// lookupSize sets the Size of a pin which has none to the size reported
+// by IPFS, when cluster.allocation_size_lookup is enabled. Otherwise the
+// size given by the client, if any, is used to allocate the pin.
+func (c *Cluster) lookupSize(pin api.Pin) api.Pin {
+	if pin.Size == 0 && c.config.AllocationSizeLookup {
+		pin.Size = c.cidSize(pin.Cid)
+	}
+	return pin
+}
+
+// getLeaderMetrics gets the LastMetrics from the leading monitor. They are
+// the last valid metrics from current cluster peers.
+func (c *Cluster) getLeaderMetrics(metricName string) ([]api.Metric, error) {
+	var metrics []api.Metric
+	l, err := c.consensus.Leader()
+	if err != nil {
+		return nil, errors.New("cannot determine leading Monitor")
+	}
+
+	err = c.rpcClient.Call(l,
+		"Cluster", "PeerMonitorLastMetrics",
+		metricName,
+		&metrics)
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// allocationFilters returns the chain of allocation filters enabled in
+// the configuration.
+func allocationFilters(cfg AllocationFiltersConfig) []AllocationFilter {
+	var chain []AllocationFilter
+	if cfg.MinFreeSpace > 0 {
+		chain = append(chain, filters.MinFreeSpace{MinBytes: cfg.MinFreeSpace})
+	}
+	if cfg.MaxPinQueue > 0 {
+		chain = append(chain, filters.MaxPinQueue(cfg.MaxPinQueue))
+	}
+	if len(cfg.Tags) > 0 {
+		chain = append(chain, filters.TagMatch{Tags: cfg.Tags})
+	}
+	return chain
+}
+
+// filterCandidates runs the chain of allocation filters on the given
+// candidates and returns the ones which were not discarded. The filters
+// enabled in the configuration run first, followed by the ones added
+// with AddAllocationFilter. Discarded peers are added to vetoes with the
+// filter which discarded them.
+func (c *Cluster) filterCandidates(hash *cid.Cid, size uint64, candidates map[peer.ID]api.Metric, vetoes map[peer.ID]string) (map[peer.ID]api.Metric, error) {
+	filters := allocationFilters(c.allocationFiltersConfig())
+	c.allocFiltersMux.RLock()
+	filters = append(filters, c.allocFilters...)
+	c.allocFiltersMux.RUnlock()
+
+	if len(filters) == 0 {
+		return candidates, nil
+	}
+
+	peers := make([]peer.ID, 0, len(candidates))
+	for p := range candidates {
+		peers = append(peers, p)
+	}
+
+	// cache metrics so filters using the same metric do not fetch
+	// them twice.
+	metricsByName := map[string]map[peer.ID]api.Metric{
+		c.getInformer().Name(): candidates,
+	}
+	for _, f := range filters {
+		name := f.MetricName()
+		metrics, ok := metricsByName[name]
+		if !ok {
+			lastMetrics, err := c.getLeaderMetrics(name)
+			if err != nil {
+				return nil, err
+			}
+			metrics = make(map[peer.ID]api.Metric)
+			for _, m := range lastMetrics {
+				metrics[m.Peer] = m
+			}
+			metricsByName[name] = metrics
+		}
+		kept := f.Filter(hash, size, peers, metrics)
+		for _, p := range peers {
+			if !containsPeer(kept, p) {
+				vetoes[p] = fmt.Sprintf("discarded by %T filter", f)
+			}
+		}
+		peers = kept
+		logger.Debugf("allocate: %d candidates after %T filter", len(peers), f)
+	}
+
+	filtered := make(map[peer.ID]api.Metric)
+	for _, p := range peers {
+		if m, ok := candidates[p]; ok {
+			filtered[p] = m
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,95 @@
+package ipfscluster
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+)
+
+// decisionLogger emits every allocation decision as a JSON line, so that
+// they can be collected and analyzed by external tools.
+var decisionLogger = logging.Logger("allocdecisions")
+
+// AllocationHistorySize is the number of allocation decisions that each
+// peer remembers. Older decisions are forgotten.
+var AllocationHistorySize = 1024
+
+// allocationHistory is a ring buffer which stores the last allocation
+// decisions made by this peer.
+type allocationHistory struct {
+	mux     sync.RWMutex
+	records []api.AllocationRecord
+	next    int
+	full    bool
+}
+
+func newAllocationHistory(size int) *allocationHistory {
+	if size <= 0 {
+		size = 1
+	}
+	return &allocationHistory{
+		records: make([]api.AllocationRecord, size, size),
+	}
+}
+
+// add stores a record, overwriting the oldest one when the buffer is full.
+func (ah *allocationHistory) add(rec api.AllocationRecord) {
+	ah.mux.Lock()
+	defer ah.mux.Unlock()
+	ah.records[ah.next] = rec
+	ah.next = (ah.next + 1) % len(ah.records)
+	if ah.next == 0 {
+		ah.full = true
+	}
+}
+
+// get returns the stored records for a Cid, from the oldest to the newest.
+func (ah *allocationHistory) get(c *cid.Cid) []api.AllocationRecord {
+	return ah.filter(func(rec api.AllocationRecord) bool {
+		return rec.Cid.Equals(c)
+	})
+}
+
+// all returns every stored record, from the oldest to the newest.
+func (ah *allocationHistory) all() []api.AllocationRecord {
+	return ah.filter(func(rec api.AllocationRecord) bool {
+		return true
+	})
+}
+
+// filter returns the stored records for which match is true, from the
+// oldest to the newest.
+func (ah *allocationHistory) filter(match func(api.AllocationRecord) bool) []api.AllocationRecord {
+	ah.mux.RLock()
+	defer ah.mux.RUnlock()
+
+	start := 0
+	n := ah.next
+	if ah.full {
+		start = ah.next
+		n = len(ah.records)
+	}
+
+	result := []api.AllocationRecord{}
+	for i := 0; i < n; i++ {
+		rec := ah.records[(start+i)%len(ah.records)]
+		if rec.Cid != nil && match(rec) {
+			result = append(result, rec)
+		}
+	}
+	return result
+}
+
+// logDecision writes an allocation record to the decision log.
+func logDecision(rec api.AllocationRecord) {
+	j, err := json.Marshal(rec.ToSerial())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	decisionLogger.Info(string(j))
+}
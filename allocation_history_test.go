@@ -0,0 +1,45 @@
+package ipfscluster
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestAllocationHistory(t *testing.T) {
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	ah := newAllocationHistory(3)
+	if len(ah.get(c1)) != 0 {
+		t.Fatal("history should be empty")
+	}
+
+	ah.add(api.AllocationRecord{Cid: c1, Reason: "1"})
+	ah.add(api.AllocationRecord{Cid: c2, Reason: "2"})
+	ah.add(api.AllocationRecord{Cid: c1, Reason: "3"})
+
+	recs := ah.get(c1)
+	if len(recs) != 2 || recs[0].Reason != "1" || recs[1].Reason != "3" {
+		t.Fatal("unexpected records:", recs)
+	}
+
+	// overwrite the oldest record
+	ah.add(api.AllocationRecord{Cid: c1, Reason: "4"})
+	recs = ah.get(c1)
+	if len(recs) != 2 || recs[0].Reason != "3" || recs[1].Reason != "4" {
+		t.Fatal("unexpected records after wrapping:", recs)
+	}
+
+	if len(ah.get(c2)) != 1 {
+		t.Error("expected one record for the second cid")
+	}
+
+	all := ah.all()
+	if len(all) != 3 || all[0].Reason != "2" || all[2].Reason != "4" {
+		t.Error("unexpected records:", all)
+	}
+}
@@ -33,8 +33,9 @@ func (alloc AscendAllocator) Shutdown() error { return nil }
 // Allocate returns where to allocate a pin request based on metrics which
 // carry a numeric value such as "used disk". We do not pay attention to
 // the metrics of the currently allocated peers and we just sort the
-// candidates based on their metric values (smallest to largest).
-func (alloc AscendAllocator) Allocate(c *cid.Cid, current, candidates map[peer.ID]api.Metric) ([]peer.ID, error) {
+// candidates based on their metric values (smallest to largest). The
+// size of the content is ignored.
+func (alloc AscendAllocator) Allocate(c *cid.Cid, size uint64, current, candidates map[peer.ID]api.Metric) ([]peer.ID, error) {
 	// sort our metrics
 	return util.SortNumeric(candidates, false), nil
 }
@@ -0,0 +1,150 @@
+// Package balanced implements an ipfscluster.PinAllocator which spreads
+// the allocations of an item as evenly as possible across a hierarchy of
+// peer tags (i.e. region, then datacenter, then host), in the spirit of
+// CRUSH placement rules. Within the same branch of the hierarchy, peers are
+// preferred by their metric value, sorted in descending order (as with the
+// "freespace" metric).
+//
+// Tags are read from the "tags" metric which cluster peers send to every
+// other peer when they have tags configured.
+package balanced
+
+import (
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/allocator/filters"
+	"github.com/ipfs/ipfs-cluster/allocator/util"
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("balancedalloc")
+
+// Allocator is a PinAllocator which balances allocations across the
+// tag hierarchy given by its configuration.
+type Allocator struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewAllocator returns an initialized Allocator.
+func NewAllocator(cfg *Config) (*Allocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &Allocator{config: cfg}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (alloc *Allocator) SetClient(c *rpc.Client) {
+	alloc.rpcClient = c
+}
+
+// Shutdown does nothing in this allocator
+func (alloc *Allocator) Shutdown() error { return nil }
+
+// Allocate returns the candidates in order of preference. At each step,
+// the preferred candidate is the one whose tags are the least used by the
+// current allocations and by the candidates preferred before it, comparing
+// the broadest level of the hierarchy first. Ties are broken by the metric
+// value (largest first). Peers without some tag are grouped together for
+// that level. When the size of the content is known, candidates whose
+// "freespace" metric is smaller than it are refused.
+func (alloc *Allocator) Allocate(c *cid.Cid, size uint64, current, candidates map[peer.ID]api.Metric) ([]peer.ID, error) {
+	if size > 0 {
+		candidates = util.WithFreeSpace(candidates, size)
+	}
+	ranked := util.SortNumeric(candidates, true)
+	if len(alloc.config.Levels) == 0 || len(ranked) < 2 {
+		return ranked, nil
+	}
+
+	tags := alloc.peerTags()
+	usage := make(map[string]int)
+	for p := range current {
+		alloc.use(usage, tags[p])
+	}
+
+	sorted := make([]peer.ID, 0, len(ranked))
+	for len(ranked) > 0 {
+		best := 0
+		for i := 1; i < len(ranked); i++ {
+			if alloc.lessUsed(usage, tags[ranked[i]], tags[ranked[best]]) {
+				best = i
+			}
+		}
+		p := ranked[best]
+		sorted = append(sorted, p)
+		alloc.use(usage, tags[p])
+		ranked = append(ranked[:best], ranked[best+1:]...)
+	}
+	return sorted, nil
+}
+
+// peerTags fetches the last "tags" metric of every peer known to the
+// local monitor.
+func (alloc *Allocator) peerTags() map[peer.ID]map[string]string {
+	tags := make(map[peer.ID]map[string]string)
+	if alloc.rpcClient == nil {
+		return tags
+	}
+
+	var metrics []api.Metric
+	err := alloc.rpcClient.Call("",
+		"Cluster",
+		"PeerMonitorLastMetrics",
+		filters.TagsMetric,
+		&metrics)
+	if err != nil {
+		logger.Warningf("cannot obtain tags, allocations will not be balanced: %s", err)
+		return tags
+	}
+
+	for _, m := range metrics {
+		if m.Discard() {
+			continue
+		}
+		tags[m.Peer] = filters.ParseTags(m.Value)
+	}
+	return tags
+}
+
+// branches returns the branch of the hierarchy a peer belongs to at each
+// level, i.e. "eu", "eu/dc1", "eu/dc1/host1".
+func (alloc *Allocator) branches(tags map[string]string) []string {
+	levels := alloc.config.Levels
+	branches := make([]string, len(levels), len(levels))
+	values := make([]string, 0, len(levels))
+	for i, l := range levels {
+		values = append(values, tags[l])
+		branches[i] = strings.Join(values, "/")
+	}
+	return branches
+}
+
+// use accounts for one more allocation on the branches of a peer.
+func (alloc *Allocator) use(usage map[string]int, tags map[string]string) {
+	for _, b := range alloc.branches(tags) {
+		usage[b]++
+	}
+}
+
+// lessUsed returns true when the branches of a are less used than those of
+// b, comparing from the broadest level to the narrowest.
+func (alloc *Allocator) lessUsed(usage map[string]int, a, b map[string]string) bool {
+	branchesA := alloc.branches(a)
+	branchesB := alloc.branches(b)
+	for i := range branchesA {
+		ua, ub := usage[branchesA[i]], usage[branchesB[i]]
+		if ua != ub {
+			return ua < ub
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package balanced
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var inAMinute = time.Now().Add(time.Minute).Format(time.RFC3339Nano)
+
+func freeSpace(v string) api.Metric {
+	return api.Metric{
+		Name:   "freespace",
+		Value:  v,
+		Expire: inAMinute,
+		Valid:  true,
+	}
+}
+
+func testAllocator(t *testing.T) *Allocator {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Levels = []string{"region", "host"}
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alloc.SetClient(test.NewMockRPCClient(t))
+	return alloc
+}
+
+func checkAllocations(t *testing.T, res, expected []peer.ID) {
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d allocations but got %d", len(expected), len(res))
+	}
+	for i, r := range res {
+		if r != expected[i] {
+			t.Errorf("expected r[%d]=%s but got %s", i, expected[i], r)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	alloc := testAllocator(t)
+	c, _ := cid.Decode(test.TestCid1)
+	candidates := map[peer.ID]api.Metric{
+		test.TestPeerID1: freeSpace("100"),
+		test.TestPeerID2: freeSpace("90"),
+		test.TestPeerID3: freeSpace("10"),
+	}
+
+	// the second allocation goes to the other region even if
+	// it has less free space.
+	res, err := alloc.Allocate(c, 0, map[peer.ID]api.Metric{}, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocations(t, res, []peer.ID{test.TestPeerID1, test.TestPeerID3, test.TestPeerID2})
+}
+
+func TestAllocateWithCurrent(t *testing.T) {
+	alloc := testAllocator(t)
+	c, _ := cid.Decode(test.TestCid1)
+	current := map[peer.ID]api.Metric{
+		test.TestPeerID1: freeSpace("100"),
+	}
+	candidates := map[peer.ID]api.Metric{
+		test.TestPeerID2: freeSpace("90"),
+		test.TestPeerID3: freeSpace("10"),
+	}
+
+	res, err := alloc.Allocate(c, 0, current, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocations(t, res, []peer.ID{test.TestPeerID3, test.TestPeerID2})
+
+	// not enough space in the other region
+	res, err = alloc.Allocate(c, 50, current, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocations(t, res, []peer.ID{test.TestPeerID2})
+}
+
+func TestAllocateWithoutLevels(t *testing.T) {
+	alloc := testAllocator(t)
+	alloc.config.Levels = []string{}
+	c, _ := cid.Decode(test.TestCid1)
+	candidates := map[peer.ID]api.Metric{
+		test.TestPeerID1: freeSpace("100"),
+		test.TestPeerID2: freeSpace("90"),
+		test.TestPeerID3: freeSpace("10"),
+	}
+
+	res, err := alloc.Allocate(c, 0, map[peer.ID]api.Metric{}, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocations(t, res, []peer.ID{test.TestPeerID1, test.TestPeerID2, test.TestPeerID3})
+}
@@ -0,0 +1,79 @@
+package balanced
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "balanced"
+
+// These are the default values for a Config.
+var (
+	DefaultLevels = []string{"region", "datacenter", "host"}
+)
+
+// Config allows to initialize an Allocator.
+type Config struct {
+	config.Saver
+
+	// Levels are the tag keys which define the hierarchy across which
+	// allocations are balanced, from the broadest to the narrowest.
+	Levels []string
+}
+
+type jsonConfig struct {
+	Levels []string `json:"levels"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Levels = make([]string, len(DefaultLevels))
+	copy(cfg.Levels, DefaultLevels)
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	for _, l := range cfg.Levels {
+		if l == "" {
+			return errors.New("balanced.levels cannot contain empty tags")
+		}
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+	if jcfg.Levels != nil {
+		cfg.Levels = jcfg.Levels
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+	jcfg.Levels = cfg.Levels
+	if jcfg.Levels == nil {
+		jcfg.Levels = []string{}
+	}
+
+	return config.DefaultJSONMarshal(jcfg)
+}
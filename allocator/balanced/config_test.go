@@ -0,0 +1,67 @@
+package balanced
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "levels": ["region", "host"]
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Levels) != 2 || cfg.Levels[1] != "host" {
+		t.Error("expected levels region and host")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Levels = []string{"region", ""}
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding levels")
+	}
+
+	err = cfg.LoadJSON([]byte(`{}`))
+	if err != nil || len(cfg.Levels) != len(DefaultLevels) {
+		t.Error("missing levels should take the default")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Levels) != 2 {
+		t.Error("levels did not survive")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Levels = []string{""}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
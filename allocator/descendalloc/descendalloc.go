@@ -33,8 +33,13 @@ func (alloc DescendAllocator) Shutdown() error { return nil }
 // Allocate returns where to allocate a pin request based on metrics which
 // carry a numeric value such as "used disk". We do not pay attention to
 // the metrics of the currently allocated peers and we just sort the
-// candidates based on their metric values (largest to smallest).
-func (alloc DescendAllocator) Allocate(c *cid.Cid, current, candidates map[peer.ID]api.Metric) ([]peer.ID, error) {
+// candidates based on their metric values (largest to smallest). When the
+// size of the content is known, candidates whose "freespace" metric is
+// smaller than it are refused.
+func (alloc DescendAllocator) Allocate(c *cid.Cid, size uint64, current, candidates map[peer.ID]api.Metric) ([]peer.ID, error) {
+	if size > 0 {
+		candidates = util.WithFreeSpace(candidates, size)
+	}
 	// sort our metrics
 	return util.SortNumeric(candidates, true), nil
 }
@@ -99,7 +99,7 @@ func Test(t *testing.T) {
 	alloc := &DescendAllocator{}
 	for i, tc := range testCases {
 		t.Logf("Test case %d", i)
-		res, err := alloc.Allocate(testCid, tc.current, tc.candidates)
+		res, err := alloc.Allocate(testCid, 0, tc.current, tc.candidates)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -113,3 +113,34 @@ func Test(t *testing.T) {
 		}
 	}
 }
+
+func TestAllocateWithSize(t *testing.T) {
+	alloc := &DescendAllocator{}
+	candidates := map[peer.ID]api.Metric{
+		peer0: {
+			Name:   "freespace",
+			Value:  "100",
+			Expire: inAMinute,
+			Valid:  true,
+		},
+		peer1: {
+			Name:   "freespace",
+			Value:  "10",
+			Expire: inAMinute,
+			Valid:  true,
+		},
+	}
+
+	res, err := alloc.Allocate(testCid, 50, map[peer.ID]api.Metric{}, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != peer0 {
+		t.Error("expected only the peer with enough free space")
+	}
+
+	res, _ = alloc.Allocate(testCid, 0, map[peer.ID]api.Metric{}, candidates)
+	if len(res) != 2 {
+		t.Error("expected both peers when the size is unknown")
+	}
+}
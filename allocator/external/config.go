@@ -0,0 +1,96 @@
+package external
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "external"
+
+// These are the default values for a Config.
+const (
+	DefaultTimeout = 10 * time.Second
+)
+
+// Config allows to initialize an Allocator.
+type Config struct {
+	config.Saver
+
+	// Endpoint is the URL of the HTTP service which decides
+	// allocations. Requests are POSTed to it.
+	Endpoint string
+
+	// Command is the path to a plugin binary which decides
+	// allocations. Requests are written to its standard input.
+	Command string
+
+	// Timeout is the maximum amount of time to wait for the
+	// ordering of the candidates.
+	Timeout time.Duration
+}
+
+type jsonConfig struct {
+	Endpoint string `json:"endpoint"`
+	Command  string `json:"command"`
+	Timeout  string `json:"timeout"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Endpoint = ""
+	cfg.Command = ""
+	cfg.Timeout = DefaultTimeout
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.Endpoint != "" && cfg.Command != "" {
+		return errors.New("external.endpoint and external.command cannot be used together")
+	}
+
+	if cfg.Timeout <= 0 {
+		return errors.New("external.timeout is invalid")
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+	cfg.Endpoint = jcfg.Endpoint
+	cfg.Command = jcfg.Command
+	if jcfg.Timeout != "" {
+		// errors ignored as Validate() below will catch them
+		t, _ := time.ParseDuration(jcfg.Timeout)
+		cfg.Timeout = t
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+	jcfg.Endpoint = cfg.Endpoint
+	jcfg.Command = cfg.Command
+	jcfg.Timeout = cfg.Timeout.String()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
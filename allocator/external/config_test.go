@@ -0,0 +1,77 @@
+package external
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "endpoint": "http://127.0.0.1:9000/allocate",
+      "timeout": "5s"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Endpoint != "http://127.0.0.1:9000/allocate" {
+		t.Error("expected the endpoint to be loaded")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Command = "/usr/local/bin/allocate"
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with endpoint and command")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Timeout = "0"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error in timeout")
+	}
+
+	err = cfg.LoadJSON([]byte(`{}`))
+	if err != nil || cfg.Timeout != DefaultTimeout {
+		t.Error("missing timeout should take the default")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Endpoint == "" || cfg.Timeout.Seconds() != 5 {
+		t.Error("configuration did not survive")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Timeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
@@ -0,0 +1,192 @@
+// Package external implements an ipfscluster.PinAllocator which delegates
+// the ordering of the candidates to an external policy engine, either an
+// HTTP service or a plugin binary. This allows organizations to apply
+// custom placement policies without modifying cluster.
+//
+// The engine receives a JSON object with the Cid being allocated, its
+// size (0 when unknown), the name of the metric and the metric values of
+// the current allocations and of the candidates, keyed by peer ID:
+//
+//	{
+//	  "cid": "Qm...",
+//	  "size": 1024,
+//	  "metric_name": "freespace",
+//	  "current": {"QmPeer1": "100"},
+//	  "candidates": {"QmPeer2": "200", "QmPeer3": "50"}
+//	}
+//
+// It must answer with the candidates in order of preference:
+//
+//	{"peers": ["QmPeer2", "QmPeer3"]}
+//
+// Candidates left out of the answer are not allocated.
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("externalalloc")
+
+// Allocator is a PinAllocator which asks an external policy engine
+// for the ordering of the candidates.
+type Allocator struct {
+	config *Config
+	client *http.Client
+}
+
+type allocateRequest struct {
+	Cid        string            `json:"cid"`
+	Size       uint64            `json:"size"`
+	MetricName string            `json:"metric_name"`
+	Current    map[string]string `json:"current"`
+	Candidates map[string]string `json:"candidates"`
+}
+
+type allocateResponse struct {
+	Peers []string `json:"peers"`
+}
+
+// NewAllocator returns an initialized Allocator. Either an endpoint or a
+// command must be configured.
+func NewAllocator(cfg *Config) (*Allocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Endpoint == "" && cfg.Command == "" {
+		return nil, errors.New("the external allocator needs external.endpoint or external.command")
+	}
+	return &Allocator{
+		config: cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// SetClient does nothing in this allocator
+func (alloc *Allocator) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing in this allocator
+func (alloc *Allocator) Shutdown() error { return nil }
+
+// Allocate sends the candidates and their metrics to the external policy
+// engine and returns the candidates in the order it provides. Peers which
+// are not candidates are ignored. An error is returned when the engine
+// cannot be contacted or its answer cannot be understood.
+func (alloc *Allocator) Allocate(c *cid.Cid, size uint64, current, candidates map[peer.ID]api.Metric) ([]peer.ID, error) {
+	req := allocateRequest{
+		Cid:        c.String(),
+		Size:       size,
+		Current:    metricValues(current),
+		Candidates: metricValues(candidates),
+	}
+	for _, m := range candidates {
+		req.MetricName = m.Name
+		break
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []byte
+	if alloc.config.Endpoint != "" {
+		raw, err = alloc.post(body)
+	} else {
+		raw, err = alloc.run(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("external allocator: %s", err)
+	}
+
+	var resp allocateResponse
+	err = json.Unmarshal(raw, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("external allocator: bad response: %s", err)
+	}
+
+	sorted := make([]peer.ID, 0, len(resp.Peers))
+	for _, s := range resp.Peers {
+		p, err := peer.IDB58Decode(s)
+		if err != nil {
+			logger.Warningf("ignoring bad peer ID %s: %s", s, err)
+			continue
+		}
+		if _, ok := candidates[p]; !ok {
+			logger.Warningf("ignoring %s as it is not a candidate", s)
+			continue
+		}
+		if containsPeer(sorted, p) {
+			continue
+		}
+		sorted = append(sorted, p)
+	}
+	return sorted, nil
+}
+
+// post sends the request to the configured endpoint.
+func (alloc *Allocator) post(body []byte) ([]byte, error) {
+	resp, err := alloc.client.Post(alloc.config.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(raw))
+	}
+	return raw, nil
+}
+
+// run executes the configured command, writing the request to its
+// standard input and reading the response from its standard output.
+func (alloc *Allocator) run(body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), alloc.config.Timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, alloc.config.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+func metricValues(metrics map[peer.ID]api.Metric) map[string]string {
+	values := make(map[string]string)
+	for p, m := range metrics {
+		values[peer.IDB58Encode(p)] = m.Value
+	}
+	return values
+}
+
+func containsPeer(list []peer.ID, p peer.ID) bool {
+	for _, q := range list {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
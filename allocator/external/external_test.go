@@ -0,0 +1,144 @@
+package external
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var inAMinute = time.Now().Add(time.Minute).Format(time.RFC3339Nano)
+
+func freeSpace(v string) api.Metric {
+	return api.Metric{
+		Name:   "freespace",
+		Value:  v,
+		Expire: inAMinute,
+		Valid:  true,
+	}
+}
+
+func checkAllocations(t *testing.T, res, expected []peer.ID) {
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d allocations but got %d", len(expected), len(res))
+	}
+	for i, r := range res {
+		if r != expected[i] {
+			t.Errorf("expected r[%d]=%s but got %s", i, expected[i], r)
+		}
+	}
+}
+
+var candidates = map[peer.ID]api.Metric{
+	test.TestPeerID1: freeSpace("100"),
+	test.TestPeerID2: freeSpace("90"),
+}
+
+func TestAllocateEndpoint(t *testing.T) {
+	var req allocateRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		// prefer the peer with less space and name a
+		// peer which is not a candidate.
+		json.NewEncoder(w).Encode(allocateResponse{
+			Peers: []string{
+				test.TestPeerID2.Pretty(),
+				test.TestPeerID3.Pretty(),
+				test.TestPeerID1.Pretty(),
+			},
+		})
+	}))
+	defer srv.Close()
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Endpoint = srv.URL
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	res, err := alloc.Allocate(c, 10, map[peer.ID]api.Metric{}, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocations(t, res, []peer.ID{test.TestPeerID2, test.TestPeerID1})
+
+	if req.Cid != test.TestCid1 || req.Size != 10 || req.MetricName != "freespace" {
+		t.Error("unexpected request:", req)
+	}
+	if req.Candidates[test.TestPeerID1.Pretty()] != "100" {
+		t.Error("the request should include the candidate metrics")
+	}
+}
+
+func TestAllocateEndpointError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "policy failure", 500)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Endpoint = srv.URL
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	_, err = alloc.Allocate(c, 0, map[peer.ID]api.Metric{}, candidates)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestAllocateCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "externalalloc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := "#!/bin/sh\ncat > /dev/null\necho '{\"peers\": [\"" + test.TestPeerID1.Pretty() + "\"]}'\n"
+	path := filepath.Join(dir, "allocate.sh")
+	err = ioutil.WriteFile(path, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Command = path
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	res, err := alloc.Allocate(c, 0, map[peer.ID]api.Metric{}, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocations(t, res, []peer.ID{test.TestPeerID1})
+}
+
+func TestNewAllocatorNeedsEngine(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	_, err := NewAllocator(cfg)
+	if err == nil {
+		t.Error("expected an error without endpoint or command")
+	}
+}
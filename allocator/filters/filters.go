@@ -0,0 +1,149 @@
+// Package filters provides implementations of ipfscluster.AllocationFilter.
+// Filters can be chained so that candidate peers which do not satisfy an
+// allocation policy (not enough free space, too many queued pins, missing
+// tags) are discarded before a PinAllocator sorts the remaining candidates.
+package filters
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("allocfilters")
+
+// Metric names used by the filters in this package.
+const (
+	FreeSpaceMetric = "freespace"
+	PinQueueMetric  = "pinqueue"
+	TagsMetric      = "tags"
+)
+
+// MinFreeSpace discards candidates which would be left with less free
+// space than MinBytes after pinning the item. It uses the "freespace"
+// metric, as provided by the disk informer, minus the size of the item
+// when it is known. Peers without a valid metric are discarded.
+type MinFreeSpace struct {
+	MinBytes uint64
+}
+
+// MetricName returns the name of the metric used by this filter.
+func (f MinFreeSpace) MetricName() string {
+	return FreeSpaceMetric
+}
+
+// Filter returns the candidates with enough free space.
+func (f MinFreeSpace) Filter(c *cid.Cid, size uint64, candidates []peer.ID, metrics map[peer.ID]api.Metric) []peer.ID {
+	return filterNumeric(candidates, metrics, func(v uint64) bool {
+		return v >= size && v-size >= f.MinBytes
+	})
+}
+
+// MaxValue discards candidates whose metric value is larger than Max.
+// By default it uses the "pinqueue" metric, so it can be used to avoid
+// allocating to peers with too many queued pin operations, but any numeric
+// metric can be set in Metric. Peers without a valid metric are discarded.
+type MaxValue struct {
+	Metric string
+	Max    uint64
+}
+
+// MaxPinQueue returns a MaxValue filter which discards peers with more
+// than max queued pin operations.
+func MaxPinQueue(max uint64) MaxValue {
+	return MaxValue{
+		Metric: PinQueueMetric,
+		Max:    max,
+	}
+}
+
+// MetricName returns the name of the metric used by this filter.
+func (f MaxValue) MetricName() string {
+	return f.Metric
+}
+
+// Filter returns the candidates whose metric does not exceed the maximum.
+func (f MaxValue) Filter(c *cid.Cid, size uint64, candidates []peer.ID, metrics map[peer.ID]api.Metric) []peer.ID {
+	return filterNumeric(candidates, metrics, func(v uint64) bool {
+		return v <= f.Max
+	})
+}
+
+// TagMatch discards candidates which do not carry all the given Tags. Tags
+// are read from the "tags" metric, whose value is a comma-separated list of
+// key=value pairs (see ParseTags). Peers without a valid metric are
+// discarded.
+type TagMatch struct {
+	Tags map[string]string
+}
+
+// MetricName returns the name of the metric used by this filter.
+func (f TagMatch) MetricName() string {
+	return TagsMetric
+}
+
+// Filter returns the candidates matching all the tags.
+func (f TagMatch) Filter(c *cid.Cid, size uint64, candidates []peer.ID, metrics map[peer.ID]api.Metric) []peer.ID {
+	filtered := make([]peer.ID, 0, len(candidates))
+	for _, p := range candidates {
+		m, ok := metrics[p]
+		if !ok || m.Discard() {
+			continue
+		}
+		peerTags := ParseTags(m.Value)
+		match := true
+		for k, v := range f.Tags {
+			if pv, ok := peerTags[k]; !ok || pv != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// ParseTags parses a comma-separated list of key=value pairs. Keys without
+// value are assigned the empty string.
+func ParseTags(str string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 1 {
+			tags[kv[0]] = ""
+			continue
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags
+}
+
+func filterNumeric(candidates []peer.ID, metrics map[peer.ID]api.Metric, keep func(uint64) bool) []peer.ID {
+	filtered := make([]peer.ID, 0, len(candidates))
+	for _, p := range candidates {
+		m, ok := metrics[p]
+		if !ok || m.Discard() {
+			continue
+		}
+		v, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			logger.Warningf("metric %s for %s is not numeric: %s", m.Name, p.Pretty(), m.Value)
+			continue
+		}
+		if keep(v) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
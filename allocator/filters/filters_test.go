@@ -0,0 +1,93 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var (
+	peer0      = peer.ID("QmUQ6Nsejt1SuZAu8yL8WgqQZHHAYreLVYYa4VPsLUCed7")
+	peer1      = peer.ID("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	peer2      = peer.ID("QmPrSBATWGAN56fiiEWEhKX3L1F3mTghEQR7vQwaeo7zHi")
+	testCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+)
+
+var inAMinute = time.Now().Add(time.Minute).Format(time.RFC3339Nano)
+
+func metric(name, value string) api.Metric {
+	return api.Metric{
+		Name:   name,
+		Value:  value,
+		Expire: inAMinute,
+		Valid:  true,
+	}
+}
+
+func TestMinFreeSpace(t *testing.T) {
+	metrics := map[peer.ID]api.Metric{
+		peer0: metric(FreeSpaceMetric, "100"),
+		peer1: metric(FreeSpaceMetric, "5"),
+	}
+	f := MinFreeSpace{MinBytes: 10}
+	res := f.Filter(testCid, 0, []peer.ID{peer0, peer1, peer2}, metrics)
+	if len(res) != 1 || res[0] != peer0 {
+		t.Errorf("unexpected result: %s", res)
+	}
+
+	// the size of the item is subtracted from the free space
+	res = f.Filter(testCid, 95, []peer.ID{peer0, peer1, peer2}, metrics)
+	if len(res) != 0 {
+		t.Errorf("unexpected result: %s", res)
+	}
+	res = f.Filter(testCid, 90, []peer.ID{peer0, peer1, peer2}, metrics)
+	if len(res) != 1 || res[0] != peer0 {
+		t.Errorf("unexpected result: %s", res)
+	}
+}
+
+func TestMaxPinQueue(t *testing.T) {
+	invalid := metric(PinQueueMetric, "0")
+	invalid.Valid = false
+	metrics := map[peer.ID]api.Metric{
+		peer0: metric(PinQueueMetric, "100"),
+		peer1: metric(PinQueueMetric, "5"),
+		peer2: invalid,
+	}
+	f := MaxPinQueue(10)
+	res := f.Filter(testCid, 0, []peer.ID{peer0, peer1, peer2}, metrics)
+	if len(res) != 1 || res[0] != peer1 {
+		t.Errorf("unexpected result: %s", res)
+	}
+}
+
+func TestTagMatch(t *testing.T) {
+	metrics := map[peer.ID]api.Metric{
+		peer0: metric(TagsMetric, "region=eu, rack=a"),
+		peer1: metric(TagsMetric, "region=us,rack=a"),
+		peer2: metric(TagsMetric, "ssd"),
+	}
+	f := TagMatch{Tags: map[string]string{"region": "eu"}}
+	res := f.Filter(testCid, 0, []peer.ID{peer0, peer1, peer2}, metrics)
+	if len(res) != 1 || res[0] != peer0 {
+		t.Errorf("unexpected result: %s", res)
+	}
+
+	f = TagMatch{Tags: map[string]string{"ssd": ""}}
+	res = f.Filter(testCid, 0, []peer.ID{peer0, peer1, peer2}, metrics)
+	if len(res) != 1 || res[0] != peer2 {
+		t.Errorf("unexpected result: %s", res)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags("a=1, b=2,c,,d=x=y")
+	if len(tags) != 4 || tags["a"] != "1" || tags["b"] != "2" ||
+		tags["c"] != "" || tags["d"] != "x=y" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
@@ -1,7 +1,7 @@
 // Package util is a utility package used by the allocator
 // implementations. This package provides the SortNumeric function, which may be
 // used by an allocator to sort peers by their metric values (ascending or
-// descending).
+// descending), and WithFreeSpace, to refuse peers which cannot store an item.
 package util
 
 import (
@@ -40,6 +40,22 @@ func SortNumeric(candidates map[peer.ID]api.Metric, reverse bool) []peer.ID {
 	return sorter.peers
 }
 
+// WithFreeSpace returns the candidates which can store size bytes according
+// to their "freespace" metric. Candidates with other metrics are kept.
+func WithFreeSpace(candidates map[peer.ID]api.Metric, size uint64) map[peer.ID]api.Metric {
+	fit := make(map[peer.ID]api.Metric)
+	for p, m := range candidates {
+		if m.Name == "freespace" {
+			free, err := strconv.ParseUint(m.Value, 10, 64)
+			if err == nil && free < size {
+				continue
+			}
+		}
+		fit[p] = m
+	}
+	return fit
+}
+
 // metricSorter implements the sort.Sort interface
 type metricSorter struct {
 	peers   []peer.ID
@@ -0,0 +1,147 @@
+// Package auth implements the authentication shared by the IPFS Cluster
+// API components. Clients authenticate with Basic Authentication
+// credentials or with a Bearer token, sent in an "Authorization" header
+// (or in the "authorization" metadata of gRPC calls). Since both travel
+// in cleartext, APIs using them should be served over TLS.
+package auth
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials are the clients authorized to use an API.
+type Credentials struct {
+	// Basic is a map of username-password pairs which are authorized
+	// to use Basic Authentication.
+	Basic map[string]string
+	// Tokens is a map of names to tokens which are authorized to use
+	// Bearer Authentication.
+	Tokens map[string]string
+}
+
+// Enabled returns true when requests must be authenticated.
+func (c Credentials) Enabled() bool {
+	return c.Basic != nil || c.Tokens != nil
+}
+
+// Challenges returns the values of the WWW-Authenticate header sent
+// along with unauthorized responses.
+func (c Credentials) Challenges() []string {
+	var challenges []string
+	if c.Basic != nil {
+		challenges = append(challenges, `Basic realm="Restricted"`)
+	}
+	if c.Tokens != nil {
+		challenges = append(challenges, `Bearer realm="Restricted"`)
+	}
+	return challenges
+}
+
+// Authorize checks the value of an Authorization header. It returns the
+// name of the client, which is the username or the name of the token,
+// and whether it is authorized.
+func (c Credentials) Authorize(authorization string) (string, bool) {
+	if username, password, ok := ParseBasic(authorization); ok {
+		for u, p := range c.Basic {
+			if secureEqual(u, username) && secureEqual(p, password) {
+				return u, true
+			}
+		}
+		return "", false
+	}
+	if token, ok := ParseBearer(authorization); ok {
+		for name, t := range c.Tokens {
+			if secureEqual(t, token) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// ParseBasic returns the username and password in the value of an
+// Authorization header, when it uses the Basic scheme.
+func ParseBasic(authorization string) (username, password string, ok bool) {
+	encoded, ok := trimScheme(authorization, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ParseBearer returns the token in the value of an Authorization
+// header, when it uses the Bearer scheme.
+func ParseBearer(authorization string) (string, bool) {
+	return trimScheme(authorization, "Bearer ")
+}
+
+// BasicHeader returns the value of an Authorization header carrying the
+// given Basic Authentication credentials.
+func BasicHeader(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// BearerHeader returns the value of an Authorization header carrying the
+// given token.
+func BearerHeader(token string) string {
+	return "Bearer " + token
+}
+
+func trimScheme(authorization, scheme string) (string, bool) {
+	if len(authorization) <= len(scheme) || !strings.EqualFold(authorization[:len(scheme)], scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(scheme):]), true
+}
+
+// secureEqual compares two secrets in constant time.
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// LoadTLSConfig returns the TLS configuration for an API served with the
+// given certificate and key. Relative paths are relative to baseDir.
+func LoadTLSConfig(baseDir, certFile, keyFile string) (*tls.Config, error) {
+	if !filepath.IsAbs(certFile) {
+		certFile = filepath.Join(baseDir, certFile)
+	}
+	if !filepath.IsAbs(keyFile) {
+		keyFile = filepath.Join(baseDir, keyFile)
+	}
+	return NewTLSConfig(certFile, keyFile)
+}
+
+// NewTLSConfig returns the TLS configuration for an API served with the
+// given certificate and key.
+func NewTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.New("Error loading TLS certficate/key: " + err.Error())
+	}
+	// based on https://github.com/denji/golang-tls
+	return &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
+		PreferServerCipherSuites: true,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		},
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
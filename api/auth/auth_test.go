@@ -0,0 +1,58 @@
+package auth
+
+import "testing"
+
+func TestAuthorize(t *testing.T) {
+	creds := Credentials{
+		Basic:  map[string]string{"user": "pass"},
+		Tokens: map[string]string{"ci": "secret-token"},
+	}
+
+	type testcase struct {
+		authorization string
+		name          string
+		ok            bool
+	}
+	testcases := []testcase{
+		{BasicHeader("user", "pass"), "user", true},
+		{"basic " + BasicHeader("user", "pass")[6:], "user", true},
+		{BasicHeader("user", "wrong"), "", false},
+		{BasicHeader("other", "pass"), "", false},
+		{"Basic !!!", "", false},
+		{BearerHeader("secret-token"), "ci", true},
+		{"bearer  secret-token ", "ci", true},
+		{BearerHeader("wrong"), "", false},
+		{"Bearer ", "", false},
+		{"secret-token", "", false},
+		{"", "", false},
+	}
+	for _, tc := range testcases {
+		name, ok := creds.Authorize(tc.authorization)
+		if name != tc.name || ok != tc.ok {
+			t.Errorf("%q: got %q, %t", tc.authorization, name, ok)
+		}
+	}
+
+	basicOnly := Credentials{Basic: creds.Basic}
+	if _, ok := basicOnly.Authorize(BearerHeader("secret-token")); ok {
+		t.Error("tokens should not be accepted")
+	}
+	if len(basicOnly.Challenges()) != 1 || len(creds.Challenges()) != 2 {
+		t.Error("unexpected challenges")
+	}
+	if (Credentials{}).Enabled() || !basicOnly.Enabled() {
+		t.Error("unexpected Enabled()")
+	}
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	_, err := LoadTLSConfig("../rest", "test/server.crt", "test/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadTLSConfig("../rest", "test/server.crt", "abc")
+	if err == nil {
+		t.Error("expected an error with a missing key")
+	}
+}
@@ -0,0 +1,236 @@
+package graphql
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api/auth"
+	"github.com/ipfs/ipfs-cluster/config"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const configKey = "graphql"
+
+// These are the default values for Config
+const (
+	DefaultListenAddr        = "/ip4/127.0.0.1/tcp/9098"
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultReadHeaderTimeout = 5 * time.Second
+	DefaultWriteTimeout      = 60 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+)
+
+// Config is used to initialize the GraphQL API component. It implements
+// the config.ComponentConfig interface.
+type Config struct {
+	config.Saver
+
+	// Enabled starts the GraphQL API along with the cluster peer. It
+	// is disabled by default.
+	Enabled bool
+
+	// Listen parameters for the GraphQL HTTP API.
+	ListenAddr ma.Multiaddr
+
+	// TLS configuration for the HTTP listener
+	TLS *tls.Config
+
+	// pathSSLCertFile is a path to a certificate file used to secure
+	// the HTTP API endpoint. We track it so we can write it in the JSON.
+	pathSSLCertFile string
+
+	// pathSSLKeyFile is a path to the private key corresponding to the
+	// SSLCertFile.
+	pathSSLKeyFile string
+
+	// Maximum duration before timing out reading a full request
+	ReadTimeout time.Duration
+
+	// Maximum duration before timing out reading the headers of a request
+	ReadHeaderTimeout time.Duration
+
+	// Maximum duration before timing out write of the response. It
+	// does not apply to subscriptions.
+	WriteTimeout time.Duration
+
+	// Server-side amount of time a Keep-Alive connection will be
+	// kept idle before being reused
+	IdleTimeout time.Duration
+
+	// BasicAuthCreds is a map of username-password pairs
+	// which are authorized to use Basic Authentication
+	BasicAuthCreds map[string]string
+
+	// BearerTokens is a map of names to tokens which are authorized
+	// to use Bearer Authentication. Credentials of either kind require
+	// TLS.
+	BearerTokens map[string]string
+}
+
+type jsonConfig struct {
+	Enabled            bool              `json:"enabled"`
+	ListenMultiaddress string            `json:"listen_multiaddress"`
+	SSLCertFile        string            `json:"ssl_cert_file,omitempty"`
+	SSLKeyFile         string            `json:"ssl_key_file,omitempty"`
+	ReadTimeout        string            `json:"read_timeout"`
+	ReadHeaderTimeout  string            `json:"read_header_timeout"`
+	WriteTimeout       string            `json:"write_timeout"`
+	IdleTimeout        string            `json:"idle_timeout"`
+	BasicAuthCreds     map[string]string `json:"basic_auth_credentials"`
+	BearerTokens       map[string]string `json:"bearer_tokens,omitempty"`
+}
+
+// ConfigKey returns a human-friendly identifier for this type of
+// Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with working values.
+func (cfg *Config) Default() error {
+	listen, _ := ma.NewMultiaddr(DefaultListenAddr)
+	cfg.Enabled = false
+	cfg.ListenAddr = listen
+	cfg.pathSSLCertFile = ""
+	cfg.pathSSLKeyFile = ""
+	cfg.TLS = nil
+	cfg.ReadTimeout = DefaultReadTimeout
+	cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	cfg.WriteTimeout = DefaultWriteTimeout
+	cfg.IdleTimeout = DefaultIdleTimeout
+	cfg.BasicAuthCreds = nil
+	cfg.BearerTokens = nil
+	return nil
+}
+
+// Validate makes sure that all fields in this Config have
+// working values, at least in appearance.
+func (cfg *Config) Validate() error {
+	if cfg.ListenAddr == nil {
+		return errors.New("graphql.listen_multiaddress not set")
+	}
+
+	if cfg.ReadTimeout <= 0 {
+		return errors.New("graphql.read_timeout is invalid")
+	}
+
+	if cfg.ReadHeaderTimeout <= 0 {
+		return errors.New("graphql.read_header_timeout is invalid")
+	}
+
+	if cfg.WriteTimeout <= 0 {
+		return errors.New("graphql.write_timeout is invalid")
+	}
+
+	if cfg.IdleTimeout <= 0 {
+		return errors.New("graphql.idle_timeout is invalid")
+	}
+
+	if cfg.BasicAuthCreds != nil && len(cfg.BasicAuthCreds) == 0 {
+		return errors.New("graphql.basic_auth_credentials should be null or have at least one entry")
+	}
+
+	if cfg.BearerTokens != nil && len(cfg.BearerTokens) == 0 {
+		return errors.New("graphql.bearer_tokens should be null or have at least one entry")
+	}
+
+	for name, token := range cfg.BearerTokens {
+		if token == "" {
+			return fmt.Errorf("graphql.bearer_tokens: empty token for %s", name)
+		}
+	}
+
+	if (cfg.pathSSLCertFile != "" || cfg.pathSSLKeyFile != "") && cfg.TLS == nil {
+		return errors.New("error loading SSL certificate or key")
+	}
+
+	// credentials would be sent in cleartext otherwise
+	if cfg.credentials().Enabled() && cfg.TLS == nil {
+		return errors.New("graphql.basic_auth_credentials and graphql.bearer_tokens require graphql.ssl_cert_file and graphql.ssl_key_file")
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte slice created by ToJSON() and sets the
+// configuration fields accordingly.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling graphql config")
+		return err
+	}
+
+	listen, err := ma.NewMultiaddr(jcfg.ListenMultiaddress)
+	if err != nil {
+		return fmt.Errorf("error parsing listen_multiaddress: %s", err)
+	}
+	cfg.ListenAddr = listen
+	cfg.Enabled = jcfg.Enabled
+
+	cfg.pathSSLCertFile = jcfg.SSLCertFile
+	cfg.pathSSLKeyFile = jcfg.SSLKeyFile
+	if jcfg.SSLCertFile != "" || jcfg.SSLKeyFile != "" {
+		tlsCfg, err := auth.LoadTLSConfig(cfg.BaseDir, jcfg.SSLCertFile, jcfg.SSLKeyFile)
+		if err != nil {
+			return err
+		}
+		cfg.TLS = tlsCfg
+	}
+
+	// errors ignored as Validate() below will catch them
+	t, _ := time.ParseDuration(jcfg.ReadTimeout)
+	cfg.ReadTimeout = t
+
+	t, _ = time.ParseDuration(jcfg.ReadHeaderTimeout)
+	cfg.ReadHeaderTimeout = t
+
+	t, _ = time.ParseDuration(jcfg.WriteTimeout)
+	cfg.WriteTimeout = t
+
+	t, _ = time.ParseDuration(jcfg.IdleTimeout)
+	cfg.IdleTimeout = t
+
+	cfg.BasicAuthCreds = jcfg.BasicAuthCreds
+	cfg.BearerTokens = jcfg.BearerTokens
+
+	return cfg.Validate()
+}
+
+// ToJSON produce a human-friendly JSON representation of the Config
+// object.
+func (cfg *Config) ToJSON() (raw []byte, err error) {
+	// Multiaddress String() may panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+
+	jcfg := &jsonConfig{}
+	jcfg.Enabled = cfg.Enabled
+	jcfg.ListenMultiaddress = cfg.ListenAddr.String()
+	jcfg.SSLCertFile = cfg.pathSSLCertFile
+	jcfg.SSLKeyFile = cfg.pathSSLKeyFile
+	jcfg.ReadTimeout = cfg.ReadTimeout.String()
+	jcfg.ReadHeaderTimeout = cfg.ReadHeaderTimeout.String()
+	jcfg.WriteTimeout = cfg.WriteTimeout.String()
+	jcfg.IdleTimeout = cfg.IdleTimeout.String()
+	jcfg.BasicAuthCreds = cfg.BasicAuthCreds
+	jcfg.BearerTokens = cfg.BearerTokens
+
+	raw, err = config.DefaultJSONMarshal(jcfg)
+	return
+}
+
+// credentials returns the clients authorized to use the API.
+func (cfg *Config) credentials() auth.Credentials {
+	return auth.Credentials{
+		Basic:  cfg.BasicAuthCreds,
+		Tokens: cfg.BearerTokens,
+	}
+}
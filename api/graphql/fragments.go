@@ -0,0 +1,148 @@
+package graphql
+
+import (
+	"fmt"
+)
+
+// maxSelections limits the number of selections of an operation once
+// its fragments are expanded, so that fragments which spread others
+// many times cannot make a small document expensive to run.
+const maxSelections = 10000
+
+// expander replaces the fragment spreads of an operation with the
+// fragments they reference and evaluates the @skip and @include
+// directives.
+type expander struct {
+	fragments map[string]*fragment
+	vars      map[string]interface{}
+	spreading map[string]bool
+	count     int
+}
+
+// expandFragments returns the selection set of an operation with its
+// fragment spreads replaced by inline fragments, and without the
+// selections skipped by directives. Type conditions are evaluated when
+// the selections are run, with collectFields.
+func expandFragments(doc *document, op *operation, vars map[string]interface{}) ([]*field, error) {
+	e := &expander{
+		fragments: doc.fragments,
+		vars:      vars,
+		spreading: make(map[string]bool),
+	}
+	return e.expand(op.selections, 1)
+}
+
+func (e *expander) expand(sels []*field, depth int) ([]*field, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("the document is nested too deeply")
+	}
+
+	expanded := make([]*field, 0, len(sels))
+	for _, sel := range sels {
+		include, err := e.included(sel.directives)
+		if err != nil {
+			return nil, err
+		}
+		if !include {
+			continue
+		}
+		e.count++
+		if e.count > maxSelections {
+			return nil, fmt.Errorf("the document has more than %d selections", maxSelections)
+		}
+
+		f := *sel
+		f.directives = nil
+		switch {
+		case sel.spread != "":
+			frag, ok := e.fragments[sel.spread]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", sel.spread)
+			}
+			if e.spreading[frag.name] {
+				return nil, fmt.Errorf("fragment %q spreads itself", frag.name)
+			}
+			e.spreading[frag.name] = true
+			f.spread = ""
+			f.onType = frag.onType
+			f.selections, err = e.expand(frag.selections, depth)
+			delete(e.spreading, frag.name)
+		case sel.isFragment():
+			f.selections, err = e.expand(sel.selections, depth)
+		case len(sel.selections) > 0:
+			f.selections, err = e.expand(sel.selections, depth+1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, &f)
+	}
+	return expanded, nil
+}
+
+// included evaluates the @skip and @include directives of a selection.
+func (e *expander) included(dirs []*directive) (bool, error) {
+	for _, dir := range dirs {
+		if dir.name != "skip" && dir.name != "include" {
+			return false, fmt.Errorf("unknown directive @%s", dir.name)
+		}
+		v := dir.args["if"]
+		if ref, ok := v.(variable); ok {
+			v = e.vars[string(ref)]
+		}
+		cond, ok := v.(bool)
+		if !ok || len(dir.args) != 1 {
+			return false, fmt.Errorf("directive @%s takes a Boolean \"if\" argument", dir.name)
+		}
+		if cond == (dir.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// collectFields returns the fields selected on a value of the given type:
+// those in the fragments whose type condition it meets are added in
+// place, and fields with the same key in the response are merged into
+// one with all their selections.
+func collectFields(sels []*field, typ string) []*field {
+	var fields []*field
+	byKey := make(map[string]int)
+
+	var collect func(sels []*field)
+	collect = func(sels []*field) {
+		for _, sel := range sels {
+			if sel.isFragment() {
+				if typeMatches(sel.onType, typ) {
+					collect(sel.selections)
+				}
+				continue
+			}
+			i, ok := byKey[sel.key()]
+			if !ok {
+				byKey[sel.key()] = len(fields)
+				fields = append(fields, sel)
+				continue
+			}
+			merged := *fields[i]
+			merged.selections = append(append([]*field{}, merged.selections...), sel.selections...)
+			fields[i] = &merged
+		}
+	}
+	collect(sels)
+	return fields
+}
+
+// typeMatches tells whether a value of type typ meets a type condition,
+// which is either its type or a union including it.
+func typeMatches(cond, typ string) bool {
+	if cond == "" || cond == typ {
+		return true
+	}
+	for _, member := range unions[cond] {
+		if member == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExpandFragmentsLimit(t *testing.T) {
+	// every fragment spreads the next one twice
+	var b strings.Builder
+	b.WriteString("{ id { ...F0 } }\n")
+	for i := 0; i < 16; i++ {
+		fmt.Fprintf(&b, "fragment F%d on ID { ...F%d ...F%d }\n", i, i+1, i+1)
+	}
+	b.WriteString("fragment F16 on ID { id }")
+
+	doc, err := parse(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = expandFragments(doc, doc.ops[0], nil)
+	if err == nil {
+		t.Fatal("expected an error expanding too many selections")
+	}
+}
+
+func TestCollectFields(t *testing.T) {
+	doc, err := parse(`{ a { x } ... on Query { a { y } b } ... on Other { c } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := collectFields(doc.ops[0].selections, "Query")
+	if len(fields) != 2 || fields[0].name != "a" || fields[1].name != "b" {
+		t.Fatalf("unexpected fields: %+v", fields)
+	}
+	if len(fields[0].selections) != 2 {
+		t.Error("the selections of a should be merged")
+	}
+	if len(doc.ops[0].selections[0].selections) != 1 {
+		t.Error("the parsed selections should not be modified")
+	}
+}
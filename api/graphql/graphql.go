@@ -0,0 +1,426 @@
+// Package graphql implements an IPFS Cluster API component. It provides
+// a GraphQL API over HTTP to query the pins, statuses, peers and metrics
+// of Cluster, selecting only the needed fields, and to subscribe to its
+// events.
+package graphql
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/auth"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+var logger = logging.Logger("graphql")
+
+// maxRequestSize limits the size of the GraphQL requests.
+const maxRequestSize = 1 << 20
+
+// API implements an API and provides a GraphQL endpoint over HTTP
+// for Cluster.
+type API struct {
+	ctx    context.Context
+	cancel func()
+
+	config *Config
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+
+	listener net.Listener
+	server   *http.Server
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+// request is a GraphQL request.
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// response is a GraphQL response.
+type response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []gqlError  `json:"errors,omitempty"`
+}
+
+// NewAPI creates a new GraphQL API component. It receives the
+// multiaddress on which the API listens.
+func NewAPI(cfg *Config) (*API, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	n, addr, err := manet.DialArgs(cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var l net.Listener
+	if cfg.TLS != nil {
+		l, err = tls.Listen(n, addr, cfg.TLS)
+	} else {
+		l, err = net.Listen(n, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newAPI(cfg, l)
+}
+
+func newAPI(cfg *Config, l net.Listener) (*API, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	api := &API{
+		ctx:      ctx,
+		cancel:   cancel,
+		config:   cfg,
+		listener: l,
+		rpcReady: make(chan struct{}, 1),
+	}
+
+	api.server = &http.Server{
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		Handler:           api.handler(),
+	}
+	api.server.SetKeepAlivesEnabled(true)
+	api.run()
+
+	return api, nil
+}
+
+// handler returns the HTTP handler of the API. The write timeout is
+// applied by it, except to subscriptions, which last as long as the
+// client wants.
+func (api *API) handler() http.Handler {
+	mux := http.NewServeMux()
+	graphql := http.TimeoutHandler(http.HandlerFunc(api.graphqlHandler),
+		api.config.WriteTimeout, "")
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		if isEventStream(r) {
+			api.graphqlHandler(w, r)
+			return
+		}
+		graphql.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/graphql/schema", api.schemaHandler)
+
+	creds := api.config.credentials()
+	if !creds.Enabled() {
+		return mux
+	}
+	return authenticate(mux, creds)
+}
+
+// isEventStream tells whether the client asks for a stream of events,
+// as subscriptions are served.
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// authenticate wraps a handler so that it only serves requests carrying
+// valid Basic Authentication credentials or a valid Bearer token.
+func authenticate(h http.Handler, creds auth.Credentials) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, challenge := range creds.Challenges() {
+			w.Header().Add("WWW-Authenticate", challenge)
+		}
+		if _, ok := creds.Authorize(r.Header.Get("Authorization")); !ok {
+			sendErrors(w, 401, gqlError{Message: "Unauthorized"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (api *API) run() {
+	api.wg.Add(1)
+	go func() {
+		defer api.wg.Done()
+		<-api.rpcReady
+
+		logger.Infof("GraphQL API: %s", api.config.ListenAddr)
+		err := api.server.Serve(api.listener)
+		if err != nil && !strings.Contains(err.Error(), "closed network connection") {
+			logger.Error(err)
+		}
+	}()
+}
+
+// Shutdown stops any API listeners.
+func (api *API) Shutdown() error {
+	api.shutdownLock.Lock()
+	defer api.shutdownLock.Unlock()
+
+	if api.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping GraphQL API")
+
+	api.cancel()
+	close(api.rpcReady)
+	// Cancel any outstanding ops
+	api.server.SetKeepAlivesEnabled(false)
+	api.listener.Close()
+
+	api.wg.Wait()
+	api.shutdown = true
+	return nil
+}
+
+// SetClient makes the component ready to perform RPC
+// requests.
+func (api *API) SetClient(c *rpc.Client) {
+	api.rpcClient = c
+	api.rpcReady <- struct{}{}
+}
+
+func (api *API) call(method string, in, out interface{}) error {
+	return api.rpcClient.Call("", "Cluster", method, in, out)
+}
+
+func (api *API) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(schemaDescription()))
+}
+
+func (api *API) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := readRequest(w, r)
+	if err != nil {
+		sendErrors(w, 400, gqlError{Message: err.Error()})
+		return
+	}
+
+	doc, err := parse(req.Query)
+	if err != nil {
+		sendErrors(w, 400, gqlError{Message: err.Error()})
+		return
+	}
+	op, err := pickOperation(doc.ops, req.OperationName)
+	if err != nil {
+		sendErrors(w, 400, gqlError{Message: err.Error()})
+		return
+	}
+	vars, err := checkVars(op, req.Variables)
+	if err != nil {
+		sendErrors(w, 400, gqlError{Message: err.Error()})
+		return
+	}
+	op.selections, err = expandFragments(doc, op, vars)
+	if err != nil {
+		sendErrors(w, 400, gqlError{Message: err.Error()})
+		return
+	}
+
+	if op.typ == "subscription" {
+		api.subscribe(w, r, op, vars)
+		return
+	}
+	api.query(w, op, vars)
+}
+
+// readRequest reads a GraphQL request from the query string of GET
+// requests, or from the body of POST ones, encoded as JSON or given
+// as a plain query with the application/graphql type.
+func readRequest(w http.ResponseWriter, r *http.Request) (*request, error) {
+	req := &request{}
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return nil, fmt.Errorf("error decoding variables: %s", err)
+			}
+		}
+	case "POST":
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			return nil, fmt.Errorf("error reading request: %s", err)
+		}
+		mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediatype == "application/graphql" {
+			req.Query = string(body)
+			break
+		}
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("error decoding request: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	if req.Query == "" {
+		return nil, fmt.Errorf("the request has no query")
+	}
+	return req, nil
+}
+
+// query resolves the root fields of a query. A field which cannot be
+// resolved is null in the response, with an error for it.
+func (api *API) query(w http.ResponseWriter, op *operation, vars map[string]interface{}) {
+	sels := collectFields(op.selections, "Query")
+	allArgs := make([]map[string]interface{}, len(sels))
+	for i, sel := range sels {
+		if sel.name == "__typename" {
+			continue
+		}
+		rf, ok := queryField(sel.name)
+		if !ok {
+			sendErrors(w, 400, gqlError{Message: fmt.Sprintf("unknown field %q of type Query", sel.name)})
+			return
+		}
+		args, err := coerceArgs(sel.name, rf, sel.args, vars)
+		if err != nil {
+			sendErrors(w, 400, gqlError{Message: err.Error()})
+			return
+		}
+		allArgs[i] = args
+	}
+
+	resp := response{}
+	data := make(object, 0, len(sels))
+	for i, sel := range sels {
+		if sel.name == "__typename" {
+			data = append(data, objectField{sel.key(), "Query"})
+			continue
+		}
+		path := []interface{}{sel.key()}
+		rf, _ := queryField(sel.name)
+		v, err := rf.resolve(api, allArgs[i])
+		if err == nil {
+			v, err = selectFields(reflect.ValueOf(v), sel.selections, path)
+		}
+		if err != nil {
+			resp.Errors = append(resp.Errors, toGQLError(err, path))
+			v = nil
+		}
+		data = append(data, objectField{sel.key(), v})
+	}
+	resp.Data = data
+	sendJSON(w, 200, resp)
+}
+
+// subscribe streams the values of a subscription as server-sent events,
+// one response per event, until the client goes away.
+func (api *API) subscribe(w http.ResponseWriter, r *http.Request, op *operation, vars map[string]interface{}) {
+	if !isEventStream(r) {
+		sendErrors(w, 406, gqlError{Message: "subscriptions are streamed as text/event-stream, which the request does not accept"})
+		return
+	}
+	sels := collectFields(op.selections, "Subscription")
+	if len(sels) != 1 {
+		sendErrors(w, 400, gqlError{Message: "subscriptions must select exactly one field"})
+		return
+	}
+	sel := sels[0]
+	rf, ok := subscriptionFields[sel.name]
+	if !ok {
+		sendErrors(w, 400, gqlError{Message: fmt.Sprintf("unknown field %q of type Subscription", sel.name)})
+		return
+	}
+	args, err := coerceArgs(sel.name, rf, sel.args, vars)
+	if err != nil {
+		sendErrors(w, 400, gqlError{Message: err.Error()})
+		return
+	}
+	var seq uint64
+	if since, ok := args["since"].(int); ok {
+		if since < 0 {
+			sendErrors(w, 400, gqlError{Message: "argument \"since\" of field \"events\" cannot be negative"})
+			return
+		}
+		seq = uint64(since)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendErrors(w, 500, gqlError{Message: "streaming is not supported"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	path := []interface{}{sel.key()}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-api.ctx.Done():
+			return
+		default:
+		}
+
+		var evs []types.EventSerial
+		err := api.call("Events", seq, &evs)
+		if err != nil {
+			writeEvent(w, response{Errors: []gqlError{toGQLError(err, path)}})
+			return
+		}
+		for _, ev := range evs {
+			v, err := selectFields(reflect.ValueOf(ev), sel.selections, path)
+			if err != nil {
+				writeEvent(w, response{Errors: []gqlError{toGQLError(err, path)}})
+				return
+			}
+			writeEvent(w, response{Data: object{{sel.key(), v}}})
+			seq = ev.Seq
+		}
+		if len(evs) == 0 {
+			// a comment keeps the connection alive and lets us
+			// notice when the client is gone.
+			w.Write([]byte(":\n\n"))
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, resp response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+func sendErrors(w http.ResponseWriter, code int, errs ...gqlError) {
+	sendJSON(w, code, response{Errors: errs})
+}
+
+func sendJSON(w http.ResponseWriter, code int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logger.Error(err)
+	}
+}
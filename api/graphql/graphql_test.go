@@ -0,0 +1,467 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api/auth"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var apiURL = "http://127.0.0.1:10098/graphql" // should match testAPI()
+
+func testAPI(t *testing.T) *API {
+	cfg := &Config{}
+	cfg.Default()
+	return testAPIWithConfig(t, cfg)
+}
+
+func testAPIWithConfig(t *testing.T, cfg *Config) *API {
+	apiMAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/10098")
+	cfg.ListenAddr = apiMAddr
+
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatal("should be able to create a new API: ", err)
+	}
+
+	// No keep alive! Otherwise tests hang with
+	// connections re-used from previous tests
+	api.server.SetKeepAlivesEnabled(false)
+	api.SetClient(test.NewMockRPCClient(t))
+	return api
+}
+
+type testResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []gqlError                 `json:"errors"`
+}
+
+func doQuery(t *testing.T, query string, vars map[string]interface{}, expectedCode int) testResponse {
+	body, _ := json.Marshal(request{Query: query, Variables: vars})
+	httpResp, err := http.Post(apiURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	respBody, _ := ioutil.ReadAll(httpResp.Body)
+	if httpResp.StatusCode != expectedCode {
+		t.Fatalf("expected code %d and got %d: %s", expectedCode, httpResp.StatusCode, respBody)
+	}
+	var resp testResponse
+	err = json.Unmarshal(respBody, &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestGraphQLQuery(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	resp := doQuery(t, `{
+  __typename
+  myid: id { id ipfs { id } }
+  pins { cid }
+}`, nil, 200)
+	if len(resp.Errors) != 0 {
+		t.Fatal(resp.Errors)
+	}
+
+	expected := `{"id":"` + test.TestPeerID1.Pretty() + `","ipfs":{"id":"` + test.TestPeerID1.Pretty() + `"}}`
+	if string(resp.Data["myid"]) != expected {
+		t.Errorf("unexpected id: %s", resp.Data["myid"])
+	}
+	if string(resp.Data["__typename"]) != `"Query"` {
+		t.Errorf("unexpected typename: %s", resp.Data["__typename"])
+	}
+
+	var pins []map[string]string
+	json.Unmarshal(resp.Data["pins"], &pins)
+	if len(pins) != 3 || pins[0]["cid"] != test.TestCid1 || len(pins[0]) != 1 {
+		t.Errorf("unexpected pins: %s", resp.Data["pins"])
+	}
+}
+
+func TestGraphQLQueryVariables(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	query := `query Status($cid: String!) {
+  status(cid: $cid) { __typename cid peer_map }
+}`
+	resp := doQuery(t, query, map[string]interface{}{"cid": test.TestCid1}, 200)
+	if len(resp.Errors) != 0 {
+		t.Fatal(resp.Errors)
+	}
+	var status struct {
+		Typename string                 `json:"__typename"`
+		Cid      string                 `json:"cid"`
+		PeerMap  map[string]interface{} `json:"peer_map"`
+	}
+	json.Unmarshal(resp.Data["status"], &status)
+	if status.Typename != "GlobalPinInfo" || status.Cid != test.TestCid1 || len(status.PeerMap) != 1 {
+		t.Errorf("unexpected status: %s", resp.Data["status"])
+	}
+
+	// missing required variable
+	doQuery(t, query, nil, 400)
+
+	// a resolver error only nulls its field
+	resp = doQuery(t, query, map[string]interface{}{"cid": test.ErrorCid}, 200)
+	if len(resp.Errors) != 1 || string(resp.Data["status"]) != "null" {
+		t.Fatalf("expected an error for the status field: %+v", resp)
+	}
+	if len(resp.Errors[0].Path) != 1 || resp.Errors[0].Path[0] != "status" {
+		t.Errorf("unexpected error path: %v", resp.Errors[0].Path)
+	}
+}
+
+func TestGraphQLQueryErrors(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	queries := []string{
+		`{ id { id }`,                               // syntax
+		`{ nothing { id } }`,                        // unknown root field
+		`{ pin { cid } }`,                           // missing required argument
+		`{ pin(cid: 1) { cid } }`,                   // wrong argument type
+		`{ peers(all: true) { id } }`,               // unknown argument
+		`{ id { ...Nothing } }`,                     // unknown fragment
+		`{ id { ...F } } fragment F on ID { ...F }`, // cyclic fragment
+		`{ id { id @include(if: "yes") } }`,         // bad directive argument
+		`{ id { id @deprecated } }`,                 // unknown directive
+	}
+	for _, q := range queries {
+		resp := doQuery(t, q, nil, 400)
+		if len(resp.Errors) != 1 || resp.Data != nil {
+			t.Errorf("expected one error for %q", q)
+		}
+	}
+
+	// selection errors happen when resolving
+	queries = []string{
+		`{ id }`,                 // object without selection
+		`{ id { id { x } } }`,    // selection on a scalar
+		`{ id { nothing } }`,     // unknown field
+		`{ id { id(x: 1) } }`,    // arguments in nested fields
+		`{ pins { cid { x } } }`, // in lists too
+	}
+	for _, q := range queries {
+		resp := doQuery(t, q, nil, 200)
+		if len(resp.Errors) != 1 {
+			t.Errorf("expected one error for %q", q)
+		}
+	}
+}
+
+func TestGraphQLFragments(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	query := `query ($local: Boolean!, $skip: Boolean!) {
+  ...Peer
+  status(cid: "` + test.TestCid1 + `", local: $local) {
+    ... on GlobalPinInfo { cid peer_map }
+    ... on PinInfo { cid status }
+  }
+}
+fragment Peer on Query { id { id ...IPFS @skip(if: $skip) } id { peername } }
+fragment IPFS on ID { ipfs { id } }`
+
+	resp := doQuery(t, query, map[string]interface{}{"local": true, "skip": false}, 200)
+	if len(resp.Errors) != 0 {
+		t.Fatal(resp.Errors)
+	}
+	var id map[string]json.RawMessage
+	json.Unmarshal(resp.Data["id"], &id)
+	if len(id) != 3 || id["id"] == nil || id["ipfs"] == nil || id["peername"] == nil {
+		t.Errorf("fields with the same key should be merged: %s", resp.Data["id"])
+	}
+	var status map[string]interface{}
+	json.Unmarshal(resp.Data["status"], &status)
+	if _, ok := status["status"]; !ok || len(status) != 2 {
+		t.Errorf("only the fragment on PinInfo should apply: %s", resp.Data["status"])
+	}
+
+	resp = doQuery(t, query, map[string]interface{}{"local": false, "skip": true}, 200)
+	if len(resp.Errors) != 0 {
+		t.Fatal(resp.Errors)
+	}
+	id = nil
+	json.Unmarshal(resp.Data["id"], &id)
+	if _, ok := id["ipfs"]; ok {
+		t.Errorf("the skipped fragment should not be selected: %s", resp.Data["id"])
+	}
+	status = nil
+	json.Unmarshal(resp.Data["status"], &status)
+	if _, ok := status["peer_map"]; !ok || len(status) != 2 {
+		t.Errorf("only the fragment on GlobalPinInfo should apply: %s", resp.Data["status"])
+	}
+}
+
+func TestGraphQLIntrospection(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	query := `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives { name locations args { ...InputValue } }
+  }
+  pin: __type(name: "Pin") { name kind fields(includeDeprecated: true) { name } }
+  none: __type(name: "Nothing") { name }
+}
+fragment FullType on __Type {
+  kind name
+  fields(includeDeprecated: true) { name args { ...InputValue } type { ...TypeRef } }
+  possibleTypes { name }
+}
+fragment InputValue on __InputValue { name type { ...TypeRef } defaultValue }
+fragment TypeRef on __Type { kind name ofType { kind name ofType { kind name } } }`
+
+	resp := doQuery(t, query, nil, 200)
+	if len(resp.Errors) != 0 {
+		t.Fatal(resp.Errors)
+	}
+
+	type typeRef struct {
+		Kind   string   `json:"kind"`
+		Name   string   `json:"name"`
+		OfType *typeRef `json:"ofType"`
+	}
+	var schema struct {
+		QueryType struct{ Name string } `json:"queryType"`
+		Types     []struct {
+			Kind   string `json:"kind"`
+			Name   string `json:"name"`
+			Fields []struct {
+				Name string `json:"name"`
+				Args []struct {
+					Name string  `json:"name"`
+					Type typeRef `json:"type"`
+				} `json:"args"`
+				Type typeRef `json:"type"`
+			} `json:"fields"`
+			PossibleTypes []struct{ Name string } `json:"possibleTypes"`
+		} `json:"types"`
+		Directives []struct{ Name string } `json:"directives"`
+	}
+	err := json.Unmarshal(resp.Data["__schema"], &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.QueryType.Name != "Query" || len(schema.Directives) != 2 {
+		t.Errorf("unexpected schema: %s", resp.Data["__schema"])
+	}
+
+	var found int
+	for _, typ := range schema.Types {
+		switch typ.Name {
+		case "Query":
+			found++
+			for _, f := range typ.Fields {
+				if f.Name == "__schema" {
+					t.Error("introspection fields should not be listed")
+				}
+				if f.Name != "pin" {
+					continue
+				}
+				if f.Type.Kind != "OBJECT" || f.Type.Name != "Pin" {
+					t.Errorf("unexpected type of pin: %+v", f.Type)
+				}
+				if len(f.Args) != 1 || f.Args[0].Type.Kind != "NON_NULL" || f.Args[0].Type.OfType.Name != "String" {
+					t.Errorf("unexpected arguments of pin: %+v", f.Args)
+				}
+			}
+		case "StatusInfo":
+			found++
+			if typ.Kind != "UNION" || len(typ.PossibleTypes) != 2 {
+				t.Errorf("unexpected union: %+v", typ)
+			}
+		case "ID":
+			found++
+			for _, f := range typ.Fields {
+				if f.Name == "cluster_peers" && (f.Type.Kind != "LIST" || f.Type.OfType.Name != "String") {
+					t.Errorf("unexpected type of cluster_peers: %+v", f.Type)
+				}
+			}
+		}
+	}
+	if found != 3 {
+		t.Error("expected the Query, StatusInfo and ID types")
+	}
+
+	var pin struct {
+		Name   string              `json:"name"`
+		Kind   string              `json:"kind"`
+		Fields []map[string]string `json:"fields"`
+	}
+	json.Unmarshal(resp.Data["pin"], &pin)
+	if pin.Name != "Pin" || pin.Kind != "OBJECT" || len(pin.Fields) == 0 {
+		t.Errorf("unexpected Pin type: %s", resp.Data["pin"])
+	}
+	if string(resp.Data["none"]) != "null" {
+		t.Errorf("unknown types should be null: %s", resp.Data["none"])
+	}
+}
+
+func TestGraphQLGetAndPlainQuery(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	q := url.Values{}
+	q.Set("query", `query V($name: String!) { metrics(name: $name) { peer value } version { Version } }`)
+	q.Set("variables", `{"name": "tags"}`)
+	httpResp, err := http.Get(apiURL + "?" + q.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp testResponse
+	json.NewDecoder(httpResp.Body).Decode(&resp)
+	httpResp.Body.Close()
+	if len(resp.Errors) != 0 {
+		t.Fatal(resp.Errors)
+	}
+	var metrics []map[string]string
+	json.Unmarshal(resp.Data["metrics"], &metrics)
+	if len(metrics) != 3 || metrics[0]["value"] == "" {
+		t.Errorf("unexpected metrics: %s", resp.Data["metrics"])
+	}
+
+	httpResp, err = http.Post(apiURL, "application/graphql", strings.NewReader(`{ health { status } }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = testResponse{}
+	json.NewDecoder(httpResp.Body).Decode(&resp)
+	httpResp.Body.Close()
+	if string(resp.Data["health"]) != `{"status":"ok"}` {
+		t.Errorf("unexpected health: %s", resp.Data["health"])
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	body, _ := json.Marshal(request{Query: `subscription { events(since: 0) { seq type } }`})
+	req, _ := http.NewRequest("POST", apiURL, bytes.NewReader(body))
+	req.Header.Set("Accept", "text/event-stream")
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	if ct := httpResp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatal("unexpected content type: ", ct)
+	}
+
+	scanner := bufio.NewScanner(httpResp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var resp struct {
+			Data struct {
+				Events map[string]interface{} `json:"events"`
+			} `json:"data"`
+		}
+		err := json.Unmarshal([]byte(line[len("data: "):]), &resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev := resp.Data.Events
+		if len(ev) != 2 || ev["seq"] == nil || ev["type"] == nil {
+			t.Errorf("unexpected event: %s", line)
+		}
+		return
+	}
+	t.Fatal("no events received")
+}
+
+func TestGraphQLSubscriptionNotStreamed(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	resp := doQuery(t, `subscription { events { seq } }`, nil, 406)
+	if len(resp.Errors) != 1 {
+		t.Error("expected an error")
+	}
+}
+
+func TestGraphQLAuth(t *testing.T) {
+	tlsCfg, err := auth.NewTLSConfig("../rest/test/server.crt", "../rest/test/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	cfg.Default()
+	cfg.TLS = tlsCfg
+	cfg.BasicAuthCreds = map[string]string{"user": "pass"}
+	cfg.BearerTokens = map[string]string{"ci": "secret-token"}
+	api := testAPIWithConfig(t, cfg)
+	defer api.Shutdown()
+
+	caCert, _ := ioutil.ReadFile("../rest/test/server.crt")
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots},
+			DisableKeepAlives: true,
+		},
+	}
+	httpsURL := strings.Replace(apiURL, "http://", "https://", 1)
+
+	type testcase struct {
+		authorization string
+		code          int
+	}
+	testcases := []testcase{
+		{"", 401},
+		{auth.BasicHeader("user", "wrong"), 401},
+		{auth.BearerHeader("wrong"), 401},
+		{auth.BasicHeader("user", "pass"), 200},
+		{auth.BearerHeader("secret-token"), 200},
+	}
+	for _, tc := range testcases {
+		body, _ := json.Marshal(request{Query: `{ id { id } }`})
+		req, _ := http.NewRequest("POST", httpsURL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		httpResp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp.Body.Close()
+		if httpResp.StatusCode != tc.code {
+			t.Errorf("%q: expected code %d and got %d", tc.authorization, tc.code, httpResp.StatusCode)
+		}
+	}
+}
+
+func TestSchemaDescription(t *testing.T) {
+	desc := schemaDescription()
+	for _, s := range []string{"type Query {", "pin(cid: String!): Pin", "statuses(filter: String, local: Boolean): [StatusInfo]", "type Subscription {"} {
+		if !strings.Contains(desc, s) {
+			t.Errorf("schema description should contain %q", s)
+		}
+	}
+}
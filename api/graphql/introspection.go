@@ -0,0 +1,330 @@
+package graphql
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// This file implements the GraphQL introspection system, so that tools
+// (e.g. GraphiQL or code generators) can discover the schema of this
+// API with the __schema and __type fields of the Query type. The schema
+// is built from the Go types of the values of the root fields. Their
+// fields which are not structs or lists are given as scalars, and maps
+// as the JSON scalar.
+
+type introSchema struct {
+	Types            []*introType      `json:"types"`
+	QueryType        *introType        `json:"queryType"`
+	MutationType     *introType        `json:"mutationType"`
+	SubscriptionType *introType        `json:"subscriptionType"`
+	Directives       []*introDirective `json:"directives"`
+}
+
+type introType struct {
+	Kind           string             `json:"kind"`
+	Name           *string            `json:"name"`
+	Description    *string            `json:"description"`
+	SpecifiedByURL *string            `json:"specifiedByURL"`
+	Fields         []*introField      `json:"fields"`
+	Interfaces     []*introType       `json:"interfaces"`
+	PossibleTypes  []*introType       `json:"possibleTypes"`
+	EnumValues     []*introEnumValue  `json:"enumValues"`
+	InputFields    []*introInputValue `json:"inputFields"`
+	OfType         *introType         `json:"ofType"`
+}
+
+type introField struct {
+	Name              string             `json:"name"`
+	Description       *string            `json:"description"`
+	Args              []*introInputValue `json:"args"`
+	Type              *introType         `json:"type"`
+	IsDeprecated      bool               `json:"isDeprecated"`
+	DeprecationReason *string            `json:"deprecationReason"`
+}
+
+type introInputValue struct {
+	Name              string     `json:"name"`
+	Description       *string    `json:"description"`
+	Type              *introType `json:"type"`
+	DefaultValue      *string    `json:"defaultValue"`
+	IsDeprecated      bool       `json:"isDeprecated"`
+	DeprecationReason *string    `json:"deprecationReason"`
+}
+
+type introEnumValue struct {
+	Name              string  `json:"name"`
+	Description       *string `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+type introDirective struct {
+	Name         string             `json:"name"`
+	Description  *string            `json:"description"`
+	Locations    []string           `json:"locations"`
+	Args         []*introInputValue `json:"args"`
+	IsRepeatable bool               `json:"isRepeatable"`
+}
+
+// introspectionTypes are the names of the introspection types.
+var introspectionTypes = map[reflect.Type]string{
+	reflect.TypeOf(introSchema{}):     "__Schema",
+	reflect.TypeOf(introType{}):       "__Type",
+	reflect.TypeOf(introField{}):      "__Field",
+	reflect.TypeOf(introInputValue{}): "__InputValue",
+	reflect.TypeOf(introEnumValue{}):  "__EnumValue",
+	reflect.TypeOf(introDirective{}):  "__Directive",
+}
+
+// introspectionArgs tells whether the given arguments are accepted by a
+// field of a value of type t. Only the includeDeprecated argument of
+// the fields of the introspection types is, and it is ignored since
+// nothing is deprecated in this API.
+func introspectionArgs(t reflect.Type, args map[string]interface{}) bool {
+	if _, ok := introspectionTypes[t]; !ok {
+		return false
+	}
+	for arg := range args {
+		if arg != "includeDeprecated" {
+			return false
+		}
+	}
+	return true
+}
+
+// introspectionFields are the fields of the Query type which describe
+// the schema.
+var introspectionFields = map[string]rootField{
+	"__schema": {
+		desc: "the schema of this API",
+		typ:  "__Schema!",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			return schema().introSchema, nil
+		},
+	},
+	"__type": {
+		desc: "a type of the schema of this API",
+		args: map[string]argDef{"name": {typ: "String", required: true}},
+		typ:  "__Type",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			return schema().named[args["name"].(string)], nil
+		},
+	},
+}
+
+// queryField returns the root field of the Query type with the given
+// name, including the introspection fields.
+func queryField(name string) (rootField, bool) {
+	if rf, ok := introspectionFields[name]; ok {
+		return rf, true
+	}
+	rf, ok := queryFields[name]
+	return rf, ok
+}
+
+// builtSchema is an introSchema with its types by name.
+type builtSchema struct {
+	*introSchema
+	named map[string]*introType
+}
+
+var (
+	schemaOnce sync.Once
+	theSchema  builtSchema
+)
+
+// schema returns the introspection schema of the API. It is built once.
+func schema() builtSchema {
+	schemaOnce.Do(func() {
+		theSchema = buildSchema()
+	})
+	return theSchema
+}
+
+// schemaBuilder adds the types of the schema as they are found.
+type schemaBuilder struct {
+	named map[string]*introType
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func buildSchema() builtSchema {
+	b := &schemaBuilder{named: make(map[string]*introType)}
+	scalars := map[string]string{
+		"String":  "text",
+		"Int":     "a signed integer",
+		"Float":   "a floating point number",
+		"Boolean": "true or false",
+		"JSON":    "any JSON value, used for maps",
+	}
+	for name, desc := range scalars {
+		b.add(&introType{Kind: "SCALAR", Name: strPtr(name), Description: strPtr(desc)})
+	}
+	for _, t := range schemaTypes {
+		b.goType(t)
+	}
+	for t := range introspectionTypes {
+		b.goType(t)
+	}
+	for name, members := range unions {
+		union := &introType{Kind: "UNION", Name: strPtr(name)}
+		for _, m := range members {
+			union.PossibleTypes = append(union.PossibleTypes, b.ref(m))
+		}
+		b.add(union)
+	}
+
+	s := &introSchema{
+		QueryType:        b.root("Query", queryFields),
+		SubscriptionType: b.root("Subscription", subscriptionFields),
+		Directives: []*introDirective{
+			b.directive("include", "includes the selection only when the argument is true"),
+			b.directive("skip", "skips the selection when the argument is true"),
+		},
+	}
+
+	names := make([]string, 0, len(b.named))
+	for name := range b.named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.Types = append(s.Types, b.named[name])
+	}
+	return builtSchema{s, b.named}
+}
+
+func (b *schemaBuilder) add(t *introType) {
+	b.named[*t.Name] = t
+}
+
+// ref returns a reference to a type given as in rootField.typ, with
+// lists and non-null types.
+func (b *schemaBuilder) ref(typ string) *introType {
+	switch {
+	case strings.HasSuffix(typ, "!"):
+		return &introType{Kind: "NON_NULL", OfType: b.ref(strings.TrimSuffix(typ, "!"))}
+	case strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]"):
+		return &introType{Kind: "LIST", OfType: b.ref(typ[1 : len(typ)-1])}
+	}
+	t, ok := b.named[typ]
+	if !ok {
+		panic(fmt.Sprintf("type %s is not in the schema", typ))
+	}
+	return t
+}
+
+// goType returns the type of the schema for a Go type, adding it to the
+// schema when it is a struct.
+func (b *schemaBuilder) goType(t reflect.Type) *introType {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return b.named["String"]
+	case reflect.Bool:
+		return b.named["Boolean"]
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return b.named["Int"]
+	case reflect.Float32, reflect.Float64:
+		return b.named["Float"]
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return b.named["String"]
+		}
+		return &introType{Kind: "LIST", OfType: b.goType(t.Elem())}
+	case reflect.Struct:
+	default:
+		return b.named["JSON"]
+	}
+
+	name := typeName(t)
+	if obj, ok := b.named[name]; ok {
+		return obj
+	}
+	obj := &introType{Kind: "OBJECT", Name: strPtr(name), Interfaces: []*introType{}}
+	b.add(obj)
+	b.addFields(obj, t)
+	return obj
+}
+
+// addFields adds the fields of a struct, by their JSON names, to an
+// object type. Fields of embedded structs are added too.
+func (b *schemaBuilder) addFields(obj *introType, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			b.addFields(obj, f.Type)
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		obj.Fields = append(obj.Fields, &introField{
+			Name: tag,
+			Args: []*introInputValue{},
+			Type: b.goType(f.Type),
+		})
+	}
+}
+
+// root returns the type of the Query or the Subscription.
+func (b *schemaBuilder) root(name string, fields map[string]rootField) *introType {
+	names := make([]string, 0, len(fields))
+	for n := range fields {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	obj := &introType{Kind: "OBJECT", Name: strPtr(name), Interfaces: []*introType{}}
+	for _, n := range names {
+		rf := fields[n]
+		f := &introField{
+			Name:        n,
+			Description: strPtr(rf.desc),
+			Args:        []*introInputValue{},
+			Type:        b.ref(rf.typ),
+		}
+		argNames := make([]string, 0, len(rf.args))
+		for arg := range rf.args {
+			argNames = append(argNames, arg)
+		}
+		sort.Strings(argNames)
+		for _, arg := range argNames {
+			def := rf.args[arg]
+			typ := def.typ
+			if def.required {
+				typ += "!"
+			}
+			f.Args = append(f.Args, &introInputValue{Name: arg, Type: b.ref(typ)})
+		}
+		obj.Fields = append(obj.Fields, f)
+	}
+	b.add(obj)
+	return obj
+}
+
+func (b *schemaBuilder) directive(name, desc string) *introDirective {
+	return &introDirective{
+		Name:        name,
+		Description: strPtr(desc),
+		Locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		Args: []*introInputValue{
+			{Name: "if", Type: b.ref("Boolean!")},
+		},
+	}
+}
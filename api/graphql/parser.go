@@ -0,0 +1,618 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file implements a parser for the subset of the GraphQL query
+// language supported by this API: query and subscription operations,
+// with variables, aliases, arguments, nested selections, fragments and
+// the @skip and @include directives on them.
+
+// document is a parsed GraphQL document.
+type document struct {
+	ops       []*operation
+	fragments map[string]*fragment
+}
+
+// operation is a query or subscription in a document.
+type operation struct {
+	typ        string // "query" or "subscription"
+	name       string
+	vars       []*varDef
+	selections []*field
+}
+
+// varDef is the definition of a variable of an operation.
+type varDef struct {
+	name     string
+	typ      string
+	required bool
+	def      interface{}
+}
+
+// fragment is a named fragment definition.
+type fragment struct {
+	name       string
+	onType     string
+	selections []*field
+}
+
+// field is a field in a selection set. Fragment spreads and inline
+// fragments are kept as fields without a name, which either reference
+// the spread fragment or have the selections of the inline one.
+type field struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	directives []*directive
+	selections []*field
+
+	spread string // name of the spread fragment
+	onType string // type condition of the fragment, if any
+}
+
+// isFragment tells whether the selection is a fragment spread or an
+// inline fragment.
+func (f *field) isFragment() bool {
+	return f.name == ""
+}
+
+// directive is a directive applied to a selection.
+type directive struct {
+	name string
+	args map[string]interface{}
+}
+
+// key returns the name of the field in the response.
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// variable is a reference to a variable in an argument.
+type variable string
+
+// enumValue is an unquoted name used as an argument value.
+type enumValue string
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+// lexer splits a query in tokens.
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() (token, error) {
+	// skip ignored characters and comments
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+			continue
+		}
+		break
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, val: string(c), pos: start}, nil
+	case c == '.':
+		if strings.HasPrefix(l.src[l.pos:], "...") {
+			l.pos += 3
+			return token{kind: tokPunct, val: "...", pos: start}, nil
+		}
+	case c == '"':
+		return l.readString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return l.readNumber()
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokName, val: l.src[start:l.pos], pos: start}, nil
+	}
+	return token{}, fmt.Errorf("unexpected character %q at %d", c, start)
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (l *lexer) readString() (token, error) {
+	start := l.pos
+	l.pos++ // opening quote
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+		case '\n':
+			return token{}, fmt.Errorf("unterminated string at %d", start)
+		case '"':
+			l.pos++
+			s, err := strconv.Unquote(l.src[start:l.pos])
+			if err != nil {
+				return token{}, fmt.Errorf("invalid string at %d: %s", start, err)
+			}
+			return token{kind: tokString, val: s, pos: start}, nil
+		default:
+			l.pos++
+		}
+	}
+	return token{}, fmt.Errorf("unterminated string at %d", start)
+}
+
+func (l *lexer) readNumber() (token, error) {
+	start := l.pos
+	kind := tokInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-':
+			kind = tokFloat
+		default:
+			return token{kind: kind, val: l.src[start:l.pos], pos: start}, nil
+		}
+		l.pos++
+	}
+	return token{kind: kind, val: l.src[start:l.pos], pos: start}, nil
+}
+
+// maxDepth limits the nesting of selection sets, lists and objects in
+// a document, so that a malicious query cannot exhaust the stack.
+const maxDepth = 32
+
+// parser builds the operations of a document from its tokens.
+type parser struct {
+	lex   *lexer
+	tok   token
+	depth int
+}
+
+// parse parses a GraphQL document.
+func parse(query string) (*document, error) {
+	p := &parser{lex: &lexer{src: query}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokEOF {
+		if p.tok.kind == tokName && p.tok.val == "fragment" {
+			frag, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[frag.name]; ok {
+				return nil, fmt.Errorf("fragment %q is defined twice", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+			continue
+		}
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		doc.ops = append(doc.ops, op)
+	}
+	if len(doc.ops) == 0 {
+		return nil, fmt.Errorf("the document has no operations")
+	}
+	return doc, nil
+}
+
+// nest is called when entering a selection set, list or object. The
+// returned function must be called when leaving it.
+func (p *parser) nest() (func(), error) {
+	if p.depth >= maxDepth {
+		return nil, fmt.Errorf("the document is nested too deeply at %d", p.tok.pos)
+	}
+	p.depth++
+	return func() { p.depth-- }, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) is(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.val == punct
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.is(punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) expectName() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.unexpected()
+	}
+	name := p.tok.val
+	return name, p.advance()
+}
+
+func (p *parser) unexpected() error {
+	switch {
+	case p.tok.kind == tokEOF:
+		return fmt.Errorf("unexpected end of the document")
+	case p.is("@"):
+		return fmt.Errorf("directives are only supported on fields and fragments (at %d)", p.tok.pos)
+	default:
+		return fmt.Errorf("unexpected %q at %d", p.tok.val, p.tok.pos)
+	}
+}
+
+func (p *parser) parseOperation() (*operation, error) {
+	op := &operation{typ: "query"}
+	if p.is("{") {
+		sels, err := p.parseSelections()
+		op.selections = sels
+		return op, err
+	}
+
+	typ, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case "query", "subscription":
+		op.typ = typ
+	default:
+		return nil, fmt.Errorf("unsupported operation type %q", typ)
+	}
+
+	if p.tok.kind == tokName {
+		op.name = p.tok.val
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("(") {
+		op.vars, err = p.parseVarDefs()
+		if err != nil {
+			return nil, err
+		}
+	}
+	op.selections, err = p.parseSelections()
+	return op, err
+}
+
+func (p *parser) parseFragment() (*fragment, error) {
+	if err := p.advance(); err != nil { // fragment
+		return nil, err
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, fmt.Errorf("fragments cannot be named \"on\"")
+	}
+	if p.tok.kind != tokName || p.tok.val != "on" {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	frag := &fragment{name: name}
+	frag.onType, err = p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	frag.selections, err = p.parseSelections()
+	return frag, err
+}
+
+func (p *parser) parseVarDefs() ([]*varDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var defs []*varDef
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		def := &varDef{name: name, typ: typ}
+		if p.is("!") {
+			def.required = true
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		if p.is("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			def.def, err = p.parseValue(true)
+			if err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.advance()
+}
+
+func (p *parser) parseSelections() ([]*field, error) {
+	leave, err := p.nest()
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []*field
+	for !p.is("}") {
+		var f *field
+		var err error
+		if p.is("...") {
+			f, err = p.parseFragmentSelection()
+		} else {
+			f, err = p.parseField()
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty selection set at %d", p.tok.pos)
+	}
+	return fields, p.advance()
+}
+
+func (p *parser) parseField() (*field, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	f := &field{name: name}
+	if p.is(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f.alias = name
+		f.name, err = p.expectName()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.is("(") {
+		f.args, err = p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.directives, err = p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.is("{") {
+		f.selections, err = p.parseSelections()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// parseFragmentSelection parses a fragment spread (...Name) or an inline
+// fragment (... on Type { }), with or without a type condition.
+func (p *parser) parseFragmentSelection() (*field, error) {
+	if err := p.advance(); err != nil { // ...
+		return nil, err
+	}
+	f := &field{}
+	var err error
+	switch {
+	case p.tok.kind == tokName && p.tok.val != "on":
+		f.spread = p.tok.val
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f.directives, err = p.parseDirectives()
+		return f, err
+	case p.tok.kind == tokName: // on
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f.onType, err = p.expectName()
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.directives, err = p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+	f.selections, err = p.parseSelections()
+	return f, err
+}
+
+// parseArgs parses the arguments of a field or a directive.
+func (p *parser) parseArgs() (map[string]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{})
+	for !p.is(")") {
+		arg, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		args[arg], err = p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+func (p *parser) parseDirectives() ([]*directive, error) {
+	var dirs []*directive
+	for p.is("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		dir := &directive{name: name}
+		if p.is("(") {
+			dir.args, err = p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// parseValue parses an argument value. Constant values (i.e. variable
+// defaults) cannot reference variables.
+func (p *parser) parseValue(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		return tok.val, p.advance()
+	case tokInt:
+		n, err := strconv.Atoi(tok.val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer at %d: %s", tok.pos, err)
+		}
+		return n, p.advance()
+	case tokFloat:
+		f, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number at %d: %s", tok.pos, err)
+		}
+		return f, p.advance()
+	case tokName:
+		var v interface{}
+		switch tok.val {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = enumValue(tok.val)
+		}
+		return v, p.advance()
+	}
+
+	if p.is("[") || p.is("{") {
+		leave, err := p.nest()
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+	}
+
+	switch {
+	case p.is("$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		return variable(name), err
+	case p.is("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.is("]") {
+			v, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case p.is("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := make(map[string]interface{})
+		for !p.is("}") {
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			obj[name], err = p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+	}
+	return nil, p.unexpected()
+}
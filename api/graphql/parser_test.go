@@ -0,0 +1,136 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	query := `
+# the pins of a namespace
+query Pins($ns: String = "default", $local: Boolean!) {
+  pins(namespace: $ns) { cid, name }
+  st: statuses(local: $local, filter: "pinned,pinning") {
+    cid
+    peer_map { status }
+  }
+  metrics(name: "freespace", limit: [1, 2.5], opts: {a: true, b: null, c: SOME}) { peer }
+}`
+	doc, err := parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.ops) != 1 {
+		t.Fatal("expected one operation")
+	}
+	op := doc.ops[0]
+	if op.typ != "query" || op.name != "Pins" {
+		t.Errorf("unexpected operation %s %s", op.typ, op.name)
+	}
+
+	if len(op.vars) != 2 {
+		t.Fatal("expected two variables")
+	}
+	if v := op.vars[0]; v.name != "ns" || v.typ != "String" || v.required || v.def != "default" {
+		t.Errorf("bad first variable: %+v", v)
+	}
+	if v := op.vars[1]; v.name != "local" || v.typ != "Boolean" || !v.required || v.def != nil {
+		t.Errorf("bad second variable: %+v", v)
+	}
+
+	if len(op.selections) != 3 {
+		t.Fatal("expected three fields")
+	}
+	pins := op.selections[0]
+	if pins.name != "pins" || pins.args["namespace"] != variable("ns") || len(pins.selections) != 2 {
+		t.Errorf("bad pins field: %+v", pins)
+	}
+	st := op.selections[1]
+	if st.key() != "st" || st.name != "statuses" || st.args["filter"] != "pinned,pinning" {
+		t.Errorf("bad statuses field: %+v", st)
+	}
+	if st.selections[1].name != "peer_map" || st.selections[1].selections[0].name != "status" {
+		t.Error("bad nested selection")
+	}
+
+	args := op.selections[2].args
+	if !reflect.DeepEqual(args["limit"], []interface{}{1, 2.5}) {
+		t.Errorf("bad list argument: %v", args["limit"])
+	}
+	expectedObj := map[string]interface{}{"a": true, "b": nil, "c": enumValue("SOME")}
+	if !reflect.DeepEqual(args["opts"], expectedObj) {
+		t.Errorf("bad object argument: %v", args["opts"])
+	}
+}
+
+func TestParseShorthand(t *testing.T) {
+	doc, err := parse(`{ id { id } } subscription { events { seq } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.ops) != 2 || doc.ops[0].typ != "query" || doc.ops[1].typ != "subscription" {
+		t.Fatal("expected a query and a subscription")
+	}
+}
+
+func TestParseFragments(t *testing.T) {
+	query := `
+query { pin(cid: "a") { ...PinFields @skip(if: $s) ... on Pin { name } ... @include(if: true) { cid } } }
+fragment PinFields on Pin { cid allocations }`
+	doc, err := parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frag, ok := doc.fragments["PinFields"]
+	if !ok || frag.onType != "Pin" || len(frag.selections) != 2 {
+		t.Fatalf("bad fragment: %+v", frag)
+	}
+
+	sels := doc.ops[0].selections[0].selections
+	if len(sels) != 3 {
+		t.Fatal("expected three fragments")
+	}
+	if !sels[0].isFragment() || sels[0].spread != "PinFields" || sels[0].directives[0].args["if"] != variable("s") {
+		t.Errorf("bad fragment spread: %+v", sels[0])
+	}
+	if !sels[1].isFragment() || sels[1].onType != "Pin" || sels[1].selections[0].name != "name" {
+		t.Errorf("bad inline fragment: %+v", sels[1])
+	}
+	if !sels[2].isFragment() || sels[2].onType != "" || sels[2].directives[0].name != "include" {
+		t.Errorf("bad inline fragment without type condition: %+v", sels[2])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	queries := []string{
+		``,
+		`{ id { id }`,
+		`{ }`,
+		`fragment F on ID { id }`,
+		`{ id { id } } fragment F on ID { id } fragment F on ID { peername }`,
+		`{ id { id } } fragment on on ID { id }`,
+		`{ id { id } } fragment F { id }`,
+		`{ id { ... on { id } } }`,
+		`query @foo { id { id } }`,
+		`mutation { pin(cid: "a") { cid } }`,
+		`query ($a String) { id { id } }`,
+		`query ($a: String = $b) { id { id } }`,
+		`{ pin(cid: "abc) { cid } }`,
+		`{ pin(cid: %) { cid } }`,
+		strings.Repeat("{ a ", maxDepth+1) + strings.Repeat("}", maxDepth+1),
+		`{ pins(filter: ` + strings.Repeat("[", maxDepth) + strings.Repeat("]", maxDepth) + `) { cid } }`,
+	}
+	for _, q := range queries {
+		if _, err := parse(q); err == nil {
+			t.Errorf("expected an error parsing %q", q)
+		}
+	}
+}
+
+func TestParseMaxDepth(t *testing.T) {
+	q := strings.Repeat("{ a ", maxDepth) + strings.Repeat("}", maxDepth)
+	if _, err := parse(q); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,472 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// The schema of this API is made of the root fields below. Their values
+// are the serializable types returned by the REST API, and their fields
+// are named like the keys of the REST API responses.
+
+// argDef describes an argument of a root field.
+type argDef struct {
+	typ      string // "String", "Int" or "Boolean"
+	required bool
+}
+
+// rootField is a field of the Query or the Subscription types.
+type rootField struct {
+	desc    string
+	args    map[string]argDef
+	typ     string // e.g. "Pin" or "[Pin]"
+	resolve func(api *API, args map[string]interface{}) (interface{}, error)
+}
+
+// metric is the serializable version of a types.Metric.
+type metric struct {
+	Name   string `json:"name"`
+	Peer   string `json:"peer"`
+	Value  string `json:"value"`
+	Expire string `json:"expire"`
+	Valid  bool   `json:"valid"`
+}
+
+// schemaTypes are the types of the values of the root fields, which
+// are named by typeName. The types of their fields are added to the
+// schema as well.
+var schemaTypes = []reflect.Type{
+	reflect.TypeOf(types.IDSerial{}),
+	reflect.TypeOf(types.HealthSerial{}),
+	reflect.TypeOf(types.Version{}),
+	reflect.TypeOf(types.PinSerial{}),
+	reflect.TypeOf(types.PinInfoSerial{}),
+	reflect.TypeOf(types.GlobalPinInfoSerial{}),
+	reflect.TypeOf(metric{}),
+	reflect.TypeOf(types.EventSerial{}),
+}
+
+// unions are the types of root fields whose values can be of several
+// types. Clients select the fields of each with inline fragments.
+var unions = map[string][]string{
+	"StatusInfo": {"GlobalPinInfo", "PinInfo"},
+}
+
+var queryFields = map[string]rootField{
+	"id": {
+		desc: "the cluster peer and its IPFS daemon",
+		typ:  "ID",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			var id types.IDSerial
+			err := api.call("ID", struct{}{}, &id)
+			return id, err
+		},
+	},
+	"health": {
+		desc: "the health of the cluster peer",
+		typ:  "Health",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			var health types.HealthSerial
+			err := api.call("Health", struct{}{}, &health)
+			return health, err
+		},
+	},
+	"version": {
+		desc: "the cluster version",
+		typ:  "Version",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			var v types.Version
+			err := api.call("Version", struct{}{}, &v)
+			return v, err
+		},
+	},
+	"peers": {
+		desc: "the cluster peers",
+		typ:  "[ID]",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			var peers []types.IDSerial
+			err := api.call("Peers", struct{}{}, &peers)
+			return peers, err
+		},
+	},
+	"pins": {
+		desc: "the items in the shared state, optionally only those of a namespace",
+		args: map[string]argDef{"namespace": {typ: "String"}},
+		typ:  "[Pin]",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			var pins []types.PinSerial
+			err := api.call("Pins", struct{}{}, &pins)
+			ns, ok := args["namespace"].(string)
+			if err != nil || !ok {
+				return pins, err
+			}
+			inNs := []types.PinSerial{}
+			for _, p := range pins {
+				if p.Namespace == ns {
+					inNs = append(inNs, p)
+				}
+			}
+			return inNs, nil
+		},
+	},
+	"pin": {
+		desc: "an item in the shared state",
+		args: map[string]argDef{"cid": {typ: "String", required: true}},
+		typ:  "Pin",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			var pin types.PinSerial
+			err := api.call("PinGet", types.PinSerial{Cid: args["cid"].(string)}, &pin)
+			return pin, err
+		},
+	},
+	"statuses": {
+		desc: "the status of all the items, in every peer or only in this one (local), optionally only those in the given comma-separated statuses",
+		args: map[string]argDef{"local": {typ: "Boolean"}, "filter": {typ: "String"}},
+		typ:  "[StatusInfo]",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			filterStr, _ := args["filter"].(string)
+			filter, err := types.StatusFilterFromString(filterStr)
+			if err != nil {
+				return nil, err
+			}
+			if local, _ := args["local"].(bool); local {
+				var infos []types.PinInfoSerial
+				err := api.call("StatusAllLocal", filter, &infos)
+				return infos, err
+			}
+			var infos []types.GlobalPinInfoSerial
+			err = api.call("StatusAll", filter, &infos)
+			return infos, err
+		},
+	},
+	"status": {
+		desc: "the status of an item, in every peer or only in this one (local)",
+		args: map[string]argDef{"cid": {typ: "String", required: true}, "local": {typ: "Boolean"}},
+		typ:  "StatusInfo",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			pin := types.PinSerial{Cid: args["cid"].(string)}
+			if local, _ := args["local"].(bool); local {
+				var info types.PinInfoSerial
+				err := api.call("StatusLocal", pin, &info)
+				return info, err
+			}
+			var info types.GlobalPinInfoSerial
+			err := api.call("Status", pin, &info)
+			return info, err
+		},
+	},
+	"metrics": {
+		desc: "the last metrics of the given type (i.e. freespace or ping) received from every peer",
+		args: map[string]argDef{"name": {typ: "String", required: true}},
+		typ:  "[Metric]",
+		resolve: func(api *API, args map[string]interface{}) (interface{}, error) {
+			var ms []types.Metric
+			err := api.call("PeerMonitorLastMetrics", args["name"].(string), &ms)
+			metrics := make([]metric, 0, len(ms))
+			for _, m := range ms {
+				metrics = append(metrics, metric{
+					Name:   m.Name,
+					Peer:   peer.IDB58Encode(m.Peer),
+					Value:  m.Value,
+					Expire: m.Expire,
+					Valid:  m.Valid,
+				})
+			}
+			return metrics, err
+		},
+	},
+}
+
+// subscriptionFields are served as streams of values. They are resolved
+// by the handler.
+var subscriptionFields = map[string]rootField{
+	"events": {
+		desc: "the events of the peer (see the /events REST endpoint), starting after the given sequence number",
+		args: map[string]argDef{"since": {typ: "Int"}},
+		typ:  "Event",
+	},
+}
+
+// gqlError is an error in a GraphQL response.
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// object is a JSON object which keeps its keys in the order of the
+// selection set, as GraphQL responses should.
+type object []objectField
+
+type objectField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes the object with its fields in order.
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(f.key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// coerceArgs checks the arguments given to a root field and resolves the
+// variables in them.
+func coerceArgs(name string, rf rootField, given map[string]interface{}, vars map[string]interface{}) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	for arg, v := range given {
+		def, ok := rf.args[arg]
+		if !ok {
+			return nil, fmt.Errorf("unknown argument %q of field %q", arg, name)
+		}
+		if ref, ok := v.(variable); ok {
+			v = vars[string(ref)]
+		}
+		if v == nil {
+			continue
+		}
+		var valid bool
+		switch def.typ {
+		case "String":
+			_, valid = v.(string)
+		case "Boolean":
+			_, valid = v.(bool)
+		case "Int":
+			switch n := v.(type) {
+			case int:
+				valid = true
+			case float64: // from JSON variables
+				if n == float64(int(n)) {
+					v, valid = int(n), true
+				}
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("argument %q of field %q should be of type %s", arg, name, def.typ)
+		}
+		args[arg] = v
+	}
+	for arg, def := range rf.args {
+		if _, ok := args[arg]; def.required && !ok {
+			return nil, fmt.Errorf("argument %q of field %q is required", arg, name)
+		}
+	}
+	return args, nil
+}
+
+// checkVars makes sure that the required variables of an operation are
+// given, and sets the defaults of the rest.
+func checkVars(op *operation, given map[string]interface{}) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	for _, def := range op.vars {
+		v, ok := given[def.name]
+		if !ok {
+			v = def.def
+		}
+		if v == nil && def.required {
+			return nil, fmt.Errorf("variable $%s is required", def.name)
+		}
+		vars[def.name] = v
+	}
+	return vars, nil
+}
+
+// selectFields returns the fields of v picked by the given selection set.
+// Structs are selected by the JSON names of their fields and must have a
+// selection; any other value is returned as is.
+func selectFields(v reflect.Value, sels []*field, path []interface{}) (interface{}, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		if v.IsNil() && len(sels) == 0 {
+			return nil, nil
+		}
+		list := make([]interface{}, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := selectFields(v.Index(i), sels, append(path, i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case v.Kind() == reflect.Struct:
+		if len(sels) == 0 {
+			return nil, pathError(path, "field of type %s must have a selection of subfields", typeName(v.Type()))
+		}
+		typ := typeName(v.Type())
+		fields := collectFields(sels, typ)
+		obj := make(object, 0, len(fields))
+		for _, sel := range fields {
+			if sel.args != nil && !introspectionArgs(v.Type(), sel.args) {
+				return nil, pathError(path, "field %q takes no arguments", sel.name)
+			}
+			if sel.name == "__typename" {
+				obj = append(obj, objectField{sel.key(), typ})
+				continue
+			}
+			fv, ok := jsonField(v, sel.name)
+			if !ok {
+				return nil, pathError(path, "unknown field %q of type %s", sel.name, typeName(v.Type()))
+			}
+			value, err := selectFields(fv, sel.selections, append(path, sel.key()))
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, objectField{sel.key(), value})
+		}
+		return obj, nil
+	}
+
+	if len(sels) > 0 {
+		return nil, pathError(path, "field of type %s has no subfields", v.Type())
+	}
+	return v.Interface(), nil
+}
+
+// jsonField returns the field of a struct with the given JSON name,
+// looking into embedded structs too.
+func jsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if fv, ok := jsonField(v.Field(i), name); ok {
+				return fv, true
+			}
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// typeName names a type like the OpenAPI specification of the REST API.
+func typeName(t reflect.Type) string {
+	if name, ok := introspectionTypes[t]; ok {
+		return name
+	}
+	name := strings.TrimSuffix(t.Name(), "Serial")
+	if name == "" {
+		return "Object"
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// pathErr is an error in the value of a field.
+type pathErr struct {
+	path []interface{}
+	msg  string
+}
+
+func (e *pathErr) Error() string {
+	return e.msg
+}
+
+func pathError(path []interface{}, format string, a ...interface{}) error {
+	p := make([]interface{}, len(path))
+	copy(p, path)
+	return &pathErr{p, fmt.Sprintf(format, a...)}
+}
+
+// toGQLError converts an error to a GraphQL one, located at the field
+// when it is known.
+func toGQLError(err error, path []interface{}) gqlError {
+	if perr, ok := err.(*pathErr); ok {
+		return gqlError{Message: perr.msg, Path: perr.path}
+	}
+	return gqlError{Message: err.Error(), Path: path}
+}
+
+// pickOperation returns the operation to run from a document.
+func pickOperation(ops []*operation, name string) (*operation, error) {
+	if name == "" {
+		if len(ops) > 1 {
+			return nil, errors.New("operationName is required for documents with several operations")
+		}
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// schemaDescription describes the root fields, for people to discover
+// them. Tools can use introspection queries instead.
+func schemaDescription() string {
+	var buf bytes.Buffer
+	describe := func(typ string, fields map[string]rootField) {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&buf, "type %s {\n", typ)
+		for _, name := range names {
+			rf := fields[name]
+			fmt.Fprintf(&buf, "  # %s\n  %s", rf.desc, name)
+			if len(rf.args) > 0 {
+				argNames := make([]string, 0, len(rf.args))
+				for arg := range rf.args {
+					argNames = append(argNames, arg)
+				}
+				sort.Strings(argNames)
+				args := make([]string, 0, len(argNames))
+				for _, arg := range argNames {
+					def := rf.args[arg]
+					a := arg + ": " + def.typ
+					if def.required {
+						a += "!"
+					}
+					args = append(args, a)
+				}
+				fmt.Fprintf(&buf, "(%s)", strings.Join(args, ", "))
+			}
+			fmt.Fprintf(&buf, ": %s\n", rf.typ)
+		}
+		buf.WriteString("}\n")
+	}
+	describe("Query", queryFields)
+	describe("Subscription", subscriptionFields)
+	return buf.String()
+}
@@ -0,0 +1,176 @@
+package grpcapi
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/api/auth"
+	"github.com/ipfs/ipfs-cluster/config"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const configKey = "grpc"
+
+// These are the default values for Config
+const (
+	DefaultListenAddr = "/ip4/127.0.0.1/tcp/9099"
+)
+
+// Config is used to initialize the gRPC API component. It implements
+// the config.ComponentConfig interface.
+type Config struct {
+	config.Saver
+
+	// Enabled starts the gRPC API along with the cluster peer. It is
+	// disabled by default.
+	Enabled bool
+
+	// Listen parameters for the gRPC API.
+	ListenAddr ma.Multiaddr
+
+	// TLS configuration for the gRPC server
+	TLS *tls.Config
+
+	// pathSSLCertFile is a path to a certificate file used to secure
+	// the gRPC API endpoint. We track it so we can write it in the JSON.
+	pathSSLCertFile string
+
+	// pathSSLKeyFile is a path to the private key corresponding to the
+	// SSLCertFile.
+	pathSSLKeyFile string
+
+	// BasicAuthCreds is a map of username-password pairs
+	// which are authorized to use Basic Authentication
+	BasicAuthCreds map[string]string
+
+	// BearerTokens is a map of names to tokens which are authorized
+	// to use Bearer Authentication. Credentials of either kind require
+	// TLS.
+	BearerTokens map[string]string
+}
+
+type jsonConfig struct {
+	Enabled            bool              `json:"enabled"`
+	ListenMultiaddress string            `json:"listen_multiaddress"`
+	SSLCertFile        string            `json:"ssl_cert_file,omitempty"`
+	SSLKeyFile         string            `json:"ssl_key_file,omitempty"`
+	BasicAuthCreds     map[string]string `json:"basic_auth_credentials"`
+	BearerTokens       map[string]string `json:"bearer_tokens,omitempty"`
+}
+
+// ConfigKey returns a human-friendly identifier for this type of
+// Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with working values.
+func (cfg *Config) Default() error {
+	listen, _ := ma.NewMultiaddr(DefaultListenAddr)
+	cfg.Enabled = false
+	cfg.ListenAddr = listen
+	cfg.pathSSLCertFile = ""
+	cfg.pathSSLKeyFile = ""
+	cfg.TLS = nil
+	cfg.BasicAuthCreds = nil
+	cfg.BearerTokens = nil
+	return nil
+}
+
+// Validate makes sure that all fields in this Config have
+// working values, at least in appearance.
+func (cfg *Config) Validate() error {
+	if cfg.ListenAddr == nil {
+		return errors.New("grpc.listen_multiaddress not set")
+	}
+
+	if cfg.BasicAuthCreds != nil && len(cfg.BasicAuthCreds) == 0 {
+		return errors.New("grpc.basic_auth_credentials should be null or have at least one entry")
+	}
+
+	if cfg.BearerTokens != nil && len(cfg.BearerTokens) == 0 {
+		return errors.New("grpc.bearer_tokens should be null or have at least one entry")
+	}
+
+	for name, token := range cfg.BearerTokens {
+		if token == "" {
+			return fmt.Errorf("grpc.bearer_tokens: empty token for %s", name)
+		}
+	}
+
+	if (cfg.pathSSLCertFile != "" || cfg.pathSSLKeyFile != "") && cfg.TLS == nil {
+		return errors.New("error loading SSL certificate or key")
+	}
+
+	// credentials would be sent in cleartext otherwise
+	if cfg.credentials().Enabled() && cfg.TLS == nil {
+		return errors.New("grpc.basic_auth_credentials and grpc.bearer_tokens require grpc.ssl_cert_file and grpc.ssl_key_file")
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte slice created by ToJSON() and sets the
+// configuration fields accordingly.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling grpc config")
+		return err
+	}
+
+	listen, err := ma.NewMultiaddr(jcfg.ListenMultiaddress)
+	if err != nil {
+		return fmt.Errorf("error parsing listen_multiaddress: %s", err)
+	}
+	cfg.ListenAddr = listen
+	cfg.Enabled = jcfg.Enabled
+
+	cfg.pathSSLCertFile = jcfg.SSLCertFile
+	cfg.pathSSLKeyFile = jcfg.SSLKeyFile
+	if jcfg.SSLCertFile != "" || jcfg.SSLKeyFile != "" {
+		tlsCfg, err := auth.LoadTLSConfig(cfg.BaseDir, jcfg.SSLCertFile, jcfg.SSLKeyFile)
+		if err != nil {
+			return err
+		}
+		cfg.TLS = tlsCfg
+	}
+
+	cfg.BasicAuthCreds = jcfg.BasicAuthCreds
+	cfg.BearerTokens = jcfg.BearerTokens
+
+	return cfg.Validate()
+}
+
+// ToJSON produce a human-friendly JSON representation of the Config
+// object.
+func (cfg *Config) ToJSON() (raw []byte, err error) {
+	// Multiaddress String() may panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+
+	jcfg := &jsonConfig{}
+	jcfg.Enabled = cfg.Enabled
+	jcfg.ListenMultiaddress = cfg.ListenAddr.String()
+	jcfg.SSLCertFile = cfg.pathSSLCertFile
+	jcfg.SSLKeyFile = cfg.pathSSLKeyFile
+	jcfg.BasicAuthCreds = cfg.BasicAuthCreds
+	jcfg.BearerTokens = cfg.BearerTokens
+
+	raw, err = config.DefaultJSONMarshal(jcfg)
+	return
+}
+
+// credentials returns the clients authorized to use the API.
+func (cfg *Config) credentials() auth.Credentials {
+	return auth.Credentials{
+		Basic:  cfg.BasicAuthCreds,
+		Tokens: cfg.BearerTokens,
+	}
+}
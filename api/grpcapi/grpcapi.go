@@ -0,0 +1,204 @@
+// Package grpcapi implements an IPFS Cluster API component. It provides
+// a gRPC API, described in pb/cluster.proto, to manage pins and peers and
+// to query or stream the status of the items, for programmatic
+// integrations which prefer protobuf and streaming calls.
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/auth"
+	"github.com/ipfs/ipfs-cluster/api/grpcapi/pb"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+	manet "github.com/multiformats/go-multiaddr-net"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	credentials "google.golang.org/grpc/credentials"
+	metadata "google.golang.org/grpc/metadata"
+	status "google.golang.org/grpc/status"
+)
+
+var logger = logging.Logger("grpcapi")
+
+// API implements an API and provides a gRPC service for Cluster.
+type API struct {
+	ctx    context.Context
+	cancel func()
+
+	config *Config
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+
+	listener net.Listener
+	server   *grpc.Server
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+// NewAPI creates a new gRPC API component. It receives the multiaddress
+// on which the API listens.
+func NewAPI(cfg *Config) (*API, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	n, addr, err := manet.DialArgs(cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen(n, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAPI(cfg, l)
+}
+
+func newAPI(cfg *Config, l net.Listener) (*API, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	api := &API{
+		ctx:      ctx,
+		cancel:   cancel,
+		config:   cfg,
+		listener: l,
+		rpcReady: make(chan struct{}, 1),
+	}
+
+	var opts []grpc.ServerOption
+	if cfg.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(cfg.TLS)))
+	}
+	if cfg.credentials().Enabled() {
+		opts = append(opts,
+			grpc.UnaryInterceptor(api.authUnary),
+			grpc.StreamInterceptor(api.authStream))
+	}
+	api.server = grpc.NewServer(opts...)
+	pb.RegisterClusterServer(api.server, &service{api})
+	api.run()
+
+	return api, nil
+}
+
+func (api *API) run() {
+	api.wg.Add(1)
+	go func() {
+		defer api.wg.Done()
+		<-api.rpcReady
+
+		logger.Infof("gRPC API: %s", api.config.ListenAddr)
+		err := api.server.Serve(api.listener)
+		if err != nil && err != grpc.ErrServerStopped &&
+			!strings.Contains(err.Error(), "closed network connection") {
+			logger.Error(err)
+		}
+	}()
+}
+
+// Shutdown stops any API listeners.
+func (api *API) Shutdown() error {
+	api.shutdownLock.Lock()
+	defer api.shutdownLock.Unlock()
+
+	if api.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping gRPC API")
+
+	api.cancel()
+	close(api.rpcReady)
+	// Stop closes the listener and cancels any outstanding calls
+	api.server.Stop()
+
+	api.wg.Wait()
+	api.shutdown = true
+	return nil
+}
+
+// SetClient makes the component ready to perform RPC
+// requests.
+func (api *API) SetClient(c *rpc.Client) {
+	api.rpcClient = c
+	api.rpcReady <- struct{}{}
+}
+
+func (api *API) call(method string, in, out interface{}) error {
+	return api.rpcClient.Call("", "Cluster", method, in, out)
+}
+
+// authorize checks the Basic Authentication credentials or the Bearer
+// token in the "authorization" metadata of a call.
+func (api *API) authorize(ctx context.Context) error {
+	creds := api.config.credentials()
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authorization := range md["authorization"] {
+		if _, ok := creds.Authorize(authorization); ok {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "Unauthorized")
+}
+
+func (api *API) authUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := api.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (api *API) authStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := api.authorize(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// BasicAuth are the credentials sent by gRPC clients of a peer whose API
+// uses Basic Authentication. It implements the
+// credentials.PerRPCCredentials interface, so it can be given to
+// grpc.WithPerRPCCredentials.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// GetRequestMetadata returns the "authorization" metadata for a call.
+func (a BasicAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": auth.BasicHeader(a.Username, a.Password)}, nil
+}
+
+// RequireTransportSecurity returns true, as the API only accepts
+// credentials over TLS.
+func (a BasicAuth) RequireTransportSecurity() bool {
+	return true
+}
+
+// BearerToken is the token sent by gRPC clients of a peer whose API
+// uses Bearer Authentication. Like BasicAuth, it can be given to
+// grpc.WithPerRPCCredentials.
+type BearerToken string
+
+// GetRequestMetadata returns the "authorization" metadata for a call.
+func (t BearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": auth.BearerHeader(string(t))}, nil
+}
+
+// RequireTransportSecurity returns true, as the API only accepts
+// credentials over TLS.
+func (t BearerToken) RequireTransportSecurity() bool {
+	return true
+}
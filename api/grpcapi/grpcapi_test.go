@@ -0,0 +1,349 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api/auth"
+	"github.com/ipfs/ipfs-cluster/api/grpcapi/pb"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	credentials "google.golang.org/grpc/credentials"
+	status "google.golang.org/grpc/status"
+)
+
+var apiAddr = "127.0.0.1:10099" // should match testAPIWithConfig()
+
+func testAPI(t *testing.T) *API {
+	cfg := &Config{}
+	cfg.Default()
+	return testAPIWithConfig(t, cfg)
+}
+
+func testAPIWithConfig(t *testing.T, cfg *Config) *API {
+	apiMAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/10099")
+	cfg.ListenAddr = apiMAddr
+
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatal("should be able to create a new API: ", err)
+	}
+	api.SetClient(test.NewMockRPCClient(t))
+	return api
+}
+
+func testClient(t *testing.T, opts ...grpc.DialOption) (pb.ClusterClient, func()) {
+	if len(opts) == 0 {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	conn, err := grpc.Dial(apiAddr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pb.NewClusterClient(conn), func() { conn.Close() }
+}
+
+func expectCode(t *testing.T, err error, code codes.Code) {
+	if status.Code(err) != code {
+		t.Errorf("expected a %s error and got: %v", code, err)
+	}
+}
+
+func TestGRPCID(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+	client, closer := testClient(t)
+	defer closer()
+
+	id, err := client.ID(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Id != test.TestPeerID1.Pretty() || id.Ipfs.Id != test.TestPeerID1.Pretty() {
+		t.Error("unexpected id: ", id)
+	}
+	if len(id.Ipfs.Addresses) != 1 {
+		t.Error("expected the ipfs addresses")
+	}
+
+	v, err := client.Version(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version == "" {
+		t.Error("expected a version")
+	}
+}
+
+func TestGRPCPeers(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+	client, closer := testClient(t)
+	defer closer()
+
+	stream, err := client.Peers(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n == 0 {
+		t.Error("expected some peers")
+	}
+
+	_, err = client.PeerAdd(context.Background(), &pb.PeerAddRequest{Multiaddress: "/ip4/1.2.3.4/tcp/9096/ipfs/" + test.TestPeerID1.Pretty()})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = client.PeerAdd(context.Background(), &pb.PeerAddRequest{Multiaddress: "abc"})
+	expectCode(t, err, codes.InvalidArgument)
+
+	_, err = client.PeerRemove(context.Background(), &pb.PeerRemoveRequest{Peer: test.TestPeerID1.Pretty()})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = client.PeerRemove(context.Background(), &pb.PeerRemoveRequest{Peer: "abc"})
+	expectCode(t, err, codes.InvalidArgument)
+}
+
+func TestGRPCPinUnpin(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+	client, closer := testClient(t)
+	defer closer()
+	ctx := context.Background()
+
+	pin, err := client.Pin(ctx, &pb.Pin{Cid: test.TestCid1, Name: "abc", ReplicationFactor: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Cid != test.TestCid1 {
+		t.Error("unexpected pin: ", pin)
+	}
+
+	_, err = client.Pin(ctx, &pb.Pin{Cid: "abc"})
+	expectCode(t, err, codes.InvalidArgument)
+	_, err = client.Pin(ctx, &pb.Pin{Cid: test.ErrorCid})
+	expectCode(t, err, codes.Unknown)
+	_, err = client.Pin(ctx, &pb.Pin{Cid: test.QuotaErrorCid, Namespace: "team-a"})
+	expectCode(t, err, codes.ResourceExhausted)
+
+	_, err = client.Unpin(ctx, &pb.UnpinRequest{Cid: test.TestCid1})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = client.Unpin(ctx, &pb.UnpinRequest{Cid: test.TestCid1, Namespace: "team-a"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = client.Unpin(ctx, &pb.UnpinRequest{Cid: test.TestCid1, Namespace: "team-b"})
+	expectCode(t, err, codes.Unknown)
+
+	pin, err = client.PinGet(ctx, &pb.CidRequest{Cid: test.TestCid1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Cid != test.TestCid1 {
+		t.Error("unexpected pin: ", pin)
+	}
+	_, err = client.PinGet(ctx, &pb.CidRequest{Cid: test.ErrorCid})
+	expectCode(t, err, codes.NotFound)
+}
+
+func TestGRPCPins(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+	client, closer := testClient(t)
+	defer closer()
+
+	stream, err := client.Pins(context.Background(), &pb.PinsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cids []string
+	for {
+		pin, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, pin.Cid)
+	}
+	if len(cids) != 3 || cids[0] != test.TestCid1 {
+		t.Error("unexpected pins: ", cids)
+	}
+}
+
+func TestGRPCStatus(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+	client, closer := testClient(t)
+	defer closer()
+	ctx := context.Background()
+
+	for _, local := range []bool{false, true} {
+		gpi, err := client.Status(ctx, &pb.StatusRequest{Cid: test.TestCid1, Local: local})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gpi.Cid != test.TestCid1 || len(gpi.PeerMap) != 1 {
+			t.Error("unexpected status: ", gpi)
+		}
+		for _, pinfo := range gpi.PeerMap {
+			if pinfo.Status == "" || pinfo.Timestamp == "" {
+				t.Error("expected a status and a timestamp: ", pinfo)
+			}
+		}
+	}
+
+	_, err := client.Status(ctx, &pb.StatusRequest{Cid: test.ErrorCid})
+	expectCode(t, err, codes.Unknown)
+
+	_, err = client.Sync(ctx, &pb.StatusRequest{Cid: test.TestCid1})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = client.Recover(ctx, &pb.StatusRequest{Cid: test.TestCid1, Local: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGRPCStatusAll(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+	client, closer := testClient(t)
+	defer closer()
+
+	for _, local := range []bool{false, true} {
+		stream, err := client.StatusAll(context.Background(), &pb.StatusAllRequest{Local: local})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for {
+			gpi, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gpi.Cid == "" || len(gpi.PeerMap) == 0 {
+				t.Error("unexpected status: ", gpi)
+			}
+			n++
+		}
+		if n == 0 {
+			t.Error("expected some statuses")
+		}
+	}
+
+	stream, err := client.StatusAll(context.Background(), &pb.StatusAllRequest{Filter: "nothing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	expectCode(t, err, codes.InvalidArgument)
+}
+
+func TestGRPCStatusStream(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+	client, closer := testClient(t)
+	defer closer()
+
+	stream, err := client.StatusStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{test.TestCid1, test.ErrorCid, "abc"} {
+		err := stream.Send(&pb.StatusRequest{Cid: c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gpi, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gpi.Cid != c {
+			t.Errorf("expected the status of %s and got %s", c, gpi.Cid)
+		}
+		if c == test.TestCid1 && (gpi.Error != "" || len(gpi.PeerMap) != 1) {
+			t.Error("unexpected status: ", gpi)
+		}
+		if c != test.TestCid1 && gpi.Error == "" {
+			t.Error("expected an error for ", c)
+		}
+	}
+
+	stream.CloseSend()
+	_, err = stream.Recv()
+	if err != io.EOF {
+		t.Error("expected the end of the stream: ", err)
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	tlsCfg, err := auth.NewTLSConfig("../rest/test/server.crt", "../rest/test/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	cfg.Default()
+	cfg.TLS = tlsCfg
+	cfg.BasicAuthCreds = map[string]string{"user": "pass"}
+	cfg.BearerTokens = map[string]string{"ci": "secret-token"}
+	api := testAPIWithConfig(t, cfg)
+	defer api.Shutdown()
+
+	tlsCreds, err := credentials.NewClientTLSFromFile("../rest/test/server.crt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTLS := grpc.WithTransportCredentials(tlsCreds)
+
+	client, closer := testClient(t, withTLS)
+	_, err = client.ID(context.Background(), &pb.Empty{})
+	expectCode(t, err, codes.Unauthenticated)
+
+	stream, err := client.Pins(context.Background(), &pb.PinsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	expectCode(t, err, codes.Unauthenticated)
+	closer()
+
+	type testcase struct {
+		creds credentials.PerRPCCredentials
+		code  codes.Code
+	}
+	testcases := []testcase{
+		{BasicAuth{"user", "wrong"}, codes.Unauthenticated},
+		{BearerToken("wrong"), codes.Unauthenticated},
+		{BasicAuth{"user", "pass"}, codes.OK},
+		{BearerToken("secret-token"), codes.OK},
+	}
+	for _, tc := range testcases {
+		client, closer := testClient(t, withTLS, grpc.WithPerRPCCredentials(tc.creds))
+		_, err = client.ID(context.Background(), &pb.Empty{})
+		expectCode(t, err, tc.code)
+		closer()
+	}
+}
@@ -0,0 +1,1585 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: cluster.proto
+
+package pb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Empty struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+func (*Empty) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{0}
+}
+
+func (m *Empty) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Empty.Unmarshal(m, b)
+}
+func (m *Empty) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Empty.Marshal(b, m, deterministic)
+}
+func (m *Empty) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Empty.Merge(m, src)
+}
+func (m *Empty) XXX_Size() int {
+	return xxx_messageInfo_Empty.Size(m)
+}
+func (m *Empty) XXX_DiscardUnknown() {
+	xxx_messageInfo_Empty.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Empty proto.InternalMessageInfo
+
+type IPFSID struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Addresses            []string `protobuf:"bytes,2,rep,name=addresses,proto3" json:"addresses,omitempty"`
+	Error                string   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *IPFSID) Reset()         { *m = IPFSID{} }
+func (m *IPFSID) String() string { return proto.CompactTextString(m) }
+func (*IPFSID) ProtoMessage()    {}
+func (*IPFSID) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{1}
+}
+
+func (m *IPFSID) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IPFSID.Unmarshal(m, b)
+}
+func (m *IPFSID) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IPFSID.Marshal(b, m, deterministic)
+}
+func (m *IPFSID) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IPFSID.Merge(m, src)
+}
+func (m *IPFSID) XXX_Size() int {
+	return xxx_messageInfo_IPFSID.Size(m)
+}
+func (m *IPFSID) XXX_DiscardUnknown() {
+	xxx_messageInfo_IPFSID.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IPFSID proto.InternalMessageInfo
+
+func (m *IPFSID) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *IPFSID) GetAddresses() []string {
+	if m != nil {
+		return m.Addresses
+	}
+	return nil
+}
+
+func (m *IPFSID) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type ID struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Addresses            []string `protobuf:"bytes,2,rep,name=addresses,proto3" json:"addresses,omitempty"`
+	ClusterPeers         []string `protobuf:"bytes,3,rep,name=cluster_peers,json=clusterPeers,proto3" json:"cluster_peers,omitempty"`
+	Version              string   `protobuf:"bytes,4,opt,name=version,proto3" json:"version,omitempty"`
+	Commit               string   `protobuf:"bytes,5,opt,name=commit,proto3" json:"commit,omitempty"`
+	RpcProtocolVersion   string   `protobuf:"bytes,6,opt,name=rpc_protocol_version,json=rpcProtocolVersion,proto3" json:"rpc_protocol_version,omitempty"`
+	Error                string   `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	Ipfs                 *IPFSID  `protobuf:"bytes,8,opt,name=ipfs,proto3" json:"ipfs,omitempty"`
+	Peername             string   `protobuf:"bytes,9,opt,name=peername,proto3" json:"peername,omitempty"`
+	PinningEnabled       bool     `protobuf:"varint,10,opt,name=pinning_enabled,json=pinningEnabled,proto3" json:"pinning_enabled,omitempty"`
+	Health               string   `protobuf:"bytes,11,opt,name=health,proto3" json:"health,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ID) Reset()         { *m = ID{} }
+func (m *ID) String() string { return proto.CompactTextString(m) }
+func (*ID) ProtoMessage()    {}
+func (*ID) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{2}
+}
+
+func (m *ID) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ID.Unmarshal(m, b)
+}
+func (m *ID) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ID.Marshal(b, m, deterministic)
+}
+func (m *ID) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ID.Merge(m, src)
+}
+func (m *ID) XXX_Size() int {
+	return xxx_messageInfo_ID.Size(m)
+}
+func (m *ID) XXX_DiscardUnknown() {
+	xxx_messageInfo_ID.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ID proto.InternalMessageInfo
+
+func (m *ID) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ID) GetAddresses() []string {
+	if m != nil {
+		return m.Addresses
+	}
+	return nil
+}
+
+func (m *ID) GetClusterPeers() []string {
+	if m != nil {
+		return m.ClusterPeers
+	}
+	return nil
+}
+
+func (m *ID) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *ID) GetCommit() string {
+	if m != nil {
+		return m.Commit
+	}
+	return ""
+}
+
+func (m *ID) GetRpcProtocolVersion() string {
+	if m != nil {
+		return m.RpcProtocolVersion
+	}
+	return ""
+}
+
+func (m *ID) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *ID) GetIpfs() *IPFSID {
+	if m != nil {
+		return m.Ipfs
+	}
+	return nil
+}
+
+func (m *ID) GetPeername() string {
+	if m != nil {
+		return m.Peername
+	}
+	return ""
+}
+
+func (m *ID) GetPinningEnabled() bool {
+	if m != nil {
+		return m.PinningEnabled
+	}
+	return false
+}
+
+func (m *ID) GetHealth() string {
+	if m != nil {
+		return m.Health
+	}
+	return ""
+}
+
+type Version struct {
+	Version              string   `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Version) Reset()         { *m = Version{} }
+func (m *Version) String() string { return proto.CompactTextString(m) }
+func (*Version) ProtoMessage()    {}
+func (*Version) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{3}
+}
+
+func (m *Version) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Version.Unmarshal(m, b)
+}
+func (m *Version) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Version.Marshal(b, m, deterministic)
+}
+func (m *Version) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Version.Merge(m, src)
+}
+func (m *Version) XXX_Size() int {
+	return xxx_messageInfo_Version.Size(m)
+}
+func (m *Version) XXX_DiscardUnknown() {
+	xxx_messageInfo_Version.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Version proto.InternalMessageInfo
+
+func (m *Version) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+type PeerAddRequest struct {
+	Multiaddress         string   `protobuf:"bytes,1,opt,name=multiaddress,proto3" json:"multiaddress,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerAddRequest) Reset()         { *m = PeerAddRequest{} }
+func (m *PeerAddRequest) String() string { return proto.CompactTextString(m) }
+func (*PeerAddRequest) ProtoMessage()    {}
+func (*PeerAddRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{4}
+}
+
+func (m *PeerAddRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerAddRequest.Unmarshal(m, b)
+}
+func (m *PeerAddRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerAddRequest.Marshal(b, m, deterministic)
+}
+func (m *PeerAddRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerAddRequest.Merge(m, src)
+}
+func (m *PeerAddRequest) XXX_Size() int {
+	return xxx_messageInfo_PeerAddRequest.Size(m)
+}
+func (m *PeerAddRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerAddRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerAddRequest proto.InternalMessageInfo
+
+func (m *PeerAddRequest) GetMultiaddress() string {
+	if m != nil {
+		return m.Multiaddress
+	}
+	return ""
+}
+
+type PeerRemoveRequest struct {
+	Peer                 string   `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerRemoveRequest) Reset()         { *m = PeerRemoveRequest{} }
+func (m *PeerRemoveRequest) String() string { return proto.CompactTextString(m) }
+func (*PeerRemoveRequest) ProtoMessage()    {}
+func (*PeerRemoveRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{5}
+}
+
+func (m *PeerRemoveRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerRemoveRequest.Unmarshal(m, b)
+}
+func (m *PeerRemoveRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerRemoveRequest.Marshal(b, m, deterministic)
+}
+func (m *PeerRemoveRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerRemoveRequest.Merge(m, src)
+}
+func (m *PeerRemoveRequest) XXX_Size() int {
+	return xxx_messageInfo_PeerRemoveRequest.Size(m)
+}
+func (m *PeerRemoveRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerRemoveRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerRemoveRequest proto.InternalMessageInfo
+
+func (m *PeerRemoveRequest) GetPeer() string {
+	if m != nil {
+		return m.Peer
+	}
+	return ""
+}
+
+type Pin struct {
+	Cid  string `protobuf:"bytes,1,opt,name=cid,proto3" json:"cid,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// 0 uses the cluster default and -1 pins everywhere.
+	ReplicationFactor int32  `protobuf:"varint,3,opt,name=replication_factor,json=replicationFactor,proto3" json:"replication_factor,omitempty"`
+	Namespace         string `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	// Set by cluster.
+	Allocations          []string `protobuf:"bytes,5,rep,name=allocations,proto3" json:"allocations,omitempty"`
+	Type                 string   `protobuf:"bytes,6,opt,name=type,proto3" json:"type,omitempty"`
+	Path                 string   `protobuf:"bytes,7,opt,name=path,proto3" json:"path,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Pin) Reset()         { *m = Pin{} }
+func (m *Pin) String() string { return proto.CompactTextString(m) }
+func (*Pin) ProtoMessage()    {}
+func (*Pin) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{6}
+}
+
+func (m *Pin) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Pin.Unmarshal(m, b)
+}
+func (m *Pin) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Pin.Marshal(b, m, deterministic)
+}
+func (m *Pin) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Pin.Merge(m, src)
+}
+func (m *Pin) XXX_Size() int {
+	return xxx_messageInfo_Pin.Size(m)
+}
+func (m *Pin) XXX_DiscardUnknown() {
+	xxx_messageInfo_Pin.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Pin proto.InternalMessageInfo
+
+func (m *Pin) GetCid() string {
+	if m != nil {
+		return m.Cid
+	}
+	return ""
+}
+
+func (m *Pin) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Pin) GetReplicationFactor() int32 {
+	if m != nil {
+		return m.ReplicationFactor
+	}
+	return 0
+}
+
+func (m *Pin) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *Pin) GetAllocations() []string {
+	if m != nil {
+		return m.Allocations
+	}
+	return nil
+}
+
+func (m *Pin) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *Pin) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+type UnpinRequest struct {
+	Cid                  string   `protobuf:"bytes,1,opt,name=cid,proto3" json:"cid,omitempty"`
+	Namespace            string   `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UnpinRequest) Reset()         { *m = UnpinRequest{} }
+func (m *UnpinRequest) String() string { return proto.CompactTextString(m) }
+func (*UnpinRequest) ProtoMessage()    {}
+func (*UnpinRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{7}
+}
+
+func (m *UnpinRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UnpinRequest.Unmarshal(m, b)
+}
+func (m *UnpinRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UnpinRequest.Marshal(b, m, deterministic)
+}
+func (m *UnpinRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnpinRequest.Merge(m, src)
+}
+func (m *UnpinRequest) XXX_Size() int {
+	return xxx_messageInfo_UnpinRequest.Size(m)
+}
+func (m *UnpinRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UnpinRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UnpinRequest proto.InternalMessageInfo
+
+func (m *UnpinRequest) GetCid() string {
+	if m != nil {
+		return m.Cid
+	}
+	return ""
+}
+
+func (m *UnpinRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+type CidRequest struct {
+	Cid                  string   `protobuf:"bytes,1,opt,name=cid,proto3" json:"cid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CidRequest) Reset()         { *m = CidRequest{} }
+func (m *CidRequest) String() string { return proto.CompactTextString(m) }
+func (*CidRequest) ProtoMessage()    {}
+func (*CidRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{8}
+}
+
+func (m *CidRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CidRequest.Unmarshal(m, b)
+}
+func (m *CidRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CidRequest.Marshal(b, m, deterministic)
+}
+func (m *CidRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CidRequest.Merge(m, src)
+}
+func (m *CidRequest) XXX_Size() int {
+	return xxx_messageInfo_CidRequest.Size(m)
+}
+func (m *CidRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CidRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CidRequest proto.InternalMessageInfo
+
+func (m *CidRequest) GetCid() string {
+	if m != nil {
+		return m.Cid
+	}
+	return ""
+}
+
+type PinsRequest struct {
+	// Only the items in this namespace, when set.
+	Namespace            string   `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PinsRequest) Reset()         { *m = PinsRequest{} }
+func (m *PinsRequest) String() string { return proto.CompactTextString(m) }
+func (*PinsRequest) ProtoMessage()    {}
+func (*PinsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{9}
+}
+
+func (m *PinsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PinsRequest.Unmarshal(m, b)
+}
+func (m *PinsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PinsRequest.Marshal(b, m, deterministic)
+}
+func (m *PinsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PinsRequest.Merge(m, src)
+}
+func (m *PinsRequest) XXX_Size() int {
+	return xxx_messageInfo_PinsRequest.Size(m)
+}
+func (m *PinsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PinsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PinsRequest proto.InternalMessageInfo
+
+func (m *PinsRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+type StatusRequest struct {
+	Cid string `protobuf:"bytes,1,opt,name=cid,proto3" json:"cid,omitempty"`
+	// Only the status in the contacted peer.
+	Local                bool     `protobuf:"varint,2,opt,name=local,proto3" json:"local,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StatusRequest) Reset()         { *m = StatusRequest{} }
+func (m *StatusRequest) String() string { return proto.CompactTextString(m) }
+func (*StatusRequest) ProtoMessage()    {}
+func (*StatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{10}
+}
+
+func (m *StatusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StatusRequest.Unmarshal(m, b)
+}
+func (m *StatusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StatusRequest.Marshal(b, m, deterministic)
+}
+func (m *StatusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StatusRequest.Merge(m, src)
+}
+func (m *StatusRequest) XXX_Size() int {
+	return xxx_messageInfo_StatusRequest.Size(m)
+}
+func (m *StatusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StatusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StatusRequest proto.InternalMessageInfo
+
+func (m *StatusRequest) GetCid() string {
+	if m != nil {
+		return m.Cid
+	}
+	return ""
+}
+
+func (m *StatusRequest) GetLocal() bool {
+	if m != nil {
+		return m.Local
+	}
+	return false
+}
+
+type StatusAllRequest struct {
+	Local bool `protobuf:"varint,1,opt,name=local,proto3" json:"local,omitempty"`
+	// Comma-separated list of statuses to return. All when empty.
+	Filter               string   `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StatusAllRequest) Reset()         { *m = StatusAllRequest{} }
+func (m *StatusAllRequest) String() string { return proto.CompactTextString(m) }
+func (*StatusAllRequest) ProtoMessage()    {}
+func (*StatusAllRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{11}
+}
+
+func (m *StatusAllRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StatusAllRequest.Unmarshal(m, b)
+}
+func (m *StatusAllRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StatusAllRequest.Marshal(b, m, deterministic)
+}
+func (m *StatusAllRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StatusAllRequest.Merge(m, src)
+}
+func (m *StatusAllRequest) XXX_Size() int {
+	return xxx_messageInfo_StatusAllRequest.Size(m)
+}
+func (m *StatusAllRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StatusAllRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StatusAllRequest proto.InternalMessageInfo
+
+func (m *StatusAllRequest) GetLocal() bool {
+	if m != nil {
+		return m.Local
+	}
+	return false
+}
+
+func (m *StatusAllRequest) GetFilter() string {
+	if m != nil {
+		return m.Filter
+	}
+	return ""
+}
+
+type PinInfo struct {
+	Cid                  string   `protobuf:"bytes,1,opt,name=cid,proto3" json:"cid,omitempty"`
+	Peer                 string   `protobuf:"bytes,2,opt,name=peer,proto3" json:"peer,omitempty"`
+	Status               string   `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Timestamp            string   `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Error                string   `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	Attempts             int32    `protobuf:"varint,6,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Blocks               int64    `protobuf:"varint,7,opt,name=blocks,proto3" json:"blocks,omitempty"`
+	Size                 uint64   `protobuf:"varint,8,opt,name=size,proto3" json:"size,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PinInfo) Reset()         { *m = PinInfo{} }
+func (m *PinInfo) String() string { return proto.CompactTextString(m) }
+func (*PinInfo) ProtoMessage()    {}
+func (*PinInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{12}
+}
+
+func (m *PinInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PinInfo.Unmarshal(m, b)
+}
+func (m *PinInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PinInfo.Marshal(b, m, deterministic)
+}
+func (m *PinInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PinInfo.Merge(m, src)
+}
+func (m *PinInfo) XXX_Size() int {
+	return xxx_messageInfo_PinInfo.Size(m)
+}
+func (m *PinInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_PinInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PinInfo proto.InternalMessageInfo
+
+func (m *PinInfo) GetCid() string {
+	if m != nil {
+		return m.Cid
+	}
+	return ""
+}
+
+func (m *PinInfo) GetPeer() string {
+	if m != nil {
+		return m.Peer
+	}
+	return ""
+}
+
+func (m *PinInfo) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *PinInfo) GetTimestamp() string {
+	if m != nil {
+		return m.Timestamp
+	}
+	return ""
+}
+
+func (m *PinInfo) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *PinInfo) GetAttempts() int32 {
+	if m != nil {
+		return m.Attempts
+	}
+	return 0
+}
+
+func (m *PinInfo) GetBlocks() int64 {
+	if m != nil {
+		return m.Blocks
+	}
+	return 0
+}
+
+func (m *PinInfo) GetSize() uint64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+type GlobalPinInfo struct {
+	Cid     string              `protobuf:"bytes,1,opt,name=cid,proto3" json:"cid,omitempty"`
+	PeerMap map[string]*PinInfo `protobuf:"bytes,2,rep,name=peer_map,json=peerMap,proto3" json:"peer_map,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Only set in the replies of StatusStream.
+	Error                string   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GlobalPinInfo) Reset()         { *m = GlobalPinInfo{} }
+func (m *GlobalPinInfo) String() string { return proto.CompactTextString(m) }
+func (*GlobalPinInfo) ProtoMessage()    {}
+func (*GlobalPinInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfb3b8ec240c376, []int{13}
+}
+
+func (m *GlobalPinInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GlobalPinInfo.Unmarshal(m, b)
+}
+func (m *GlobalPinInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GlobalPinInfo.Marshal(b, m, deterministic)
+}
+func (m *GlobalPinInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GlobalPinInfo.Merge(m, src)
+}
+func (m *GlobalPinInfo) XXX_Size() int {
+	return xxx_messageInfo_GlobalPinInfo.Size(m)
+}
+func (m *GlobalPinInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_GlobalPinInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GlobalPinInfo proto.InternalMessageInfo
+
+func (m *GlobalPinInfo) GetCid() string {
+	if m != nil {
+		return m.Cid
+	}
+	return ""
+}
+
+func (m *GlobalPinInfo) GetPeerMap() map[string]*PinInfo {
+	if m != nil {
+		return m.PeerMap
+	}
+	return nil
+}
+
+func (m *GlobalPinInfo) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*Empty)(nil), "ipfscluster.Empty")
+	proto.RegisterType((*IPFSID)(nil), "ipfscluster.IPFSID")
+	proto.RegisterType((*ID)(nil), "ipfscluster.ID")
+	proto.RegisterType((*Version)(nil), "ipfscluster.Version")
+	proto.RegisterType((*PeerAddRequest)(nil), "ipfscluster.PeerAddRequest")
+	proto.RegisterType((*PeerRemoveRequest)(nil), "ipfscluster.PeerRemoveRequest")
+	proto.RegisterType((*Pin)(nil), "ipfscluster.Pin")
+	proto.RegisterType((*UnpinRequest)(nil), "ipfscluster.UnpinRequest")
+	proto.RegisterType((*CidRequest)(nil), "ipfscluster.CidRequest")
+	proto.RegisterType((*PinsRequest)(nil), "ipfscluster.PinsRequest")
+	proto.RegisterType((*StatusRequest)(nil), "ipfscluster.StatusRequest")
+	proto.RegisterType((*StatusAllRequest)(nil), "ipfscluster.StatusAllRequest")
+	proto.RegisterType((*PinInfo)(nil), "ipfscluster.PinInfo")
+	proto.RegisterType((*GlobalPinInfo)(nil), "ipfscluster.GlobalPinInfo")
+	proto.RegisterMapType((map[string]*PinInfo)(nil), "ipfscluster.GlobalPinInfo.PeerMapEntry")
+}
+
+func init() { proto.RegisterFile("cluster.proto", fileDescriptor_3cfb3b8ec240c376) }
+
+var fileDescriptor_3cfb3b8ec240c376 = []byte{
+	// 885 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0x5f, 0x6f, 0x1b, 0x45,
+	0x10, 0xf7, 0xd9, 0x3e, 0x9f, 0x3d, 0x76, 0xd2, 0x76, 0x88, 0xe0, 0x38, 0xa0, 0xb2, 0xb6, 0x0f,
+	0xb1, 0x88, 0x88, 0xac, 0x40, 0xa1, 0xf0, 0x80, 0xda, 0xa4, 0x69, 0x15, 0x54, 0x24, 0xeb, 0x22,
+	0x78, 0xe0, 0xc5, 0x3a, 0x9f, 0x37, 0x64, 0x95, 0xfb, 0xb3, 0xdc, 0xae, 0x23, 0x99, 0x8f, 0x07,
+	0xcf, 0x3c, 0x23, 0xbe, 0x0d, 0xda, 0xbd, 0xbd, 0xf3, 0x6d, 0x62, 0x57, 0xd0, 0xbe, 0xdd, 0xfc,
+	0xf9, 0xcd, 0xcc, 0x6f, 0x66, 0x67, 0x74, 0xb0, 0x17, 0x27, 0x2b, 0x21, 0x69, 0x71, 0xcc, 0x8b,
+	0x5c, 0xe6, 0x38, 0x64, 0xfc, 0x4a, 0x18, 0x15, 0xf1, 0xc0, 0x3d, 0x4f, 0xb9, 0x5c, 0x93, 0x37,
+	0xd0, 0xbb, 0x98, 0xbd, 0xba, 0xbc, 0x78, 0x89, 0xfb, 0xd0, 0x66, 0x4b, 0xdf, 0x19, 0x3b, 0x93,
+	0x41, 0xd8, 0x66, 0x4b, 0xfc, 0x14, 0x06, 0xd1, 0x72, 0x59, 0x50, 0x21, 0xa8, 0xf0, 0xdb, 0xe3,
+	0xce, 0x64, 0x10, 0x6e, 0x14, 0x78, 0x00, 0x2e, 0x2d, 0x8a, 0xbc, 0xf0, 0x3b, 0x1a, 0x50, 0x0a,
+	0xe4, 0xef, 0x36, 0xb4, 0xff, 0x77, 0xa8, 0x27, 0x75, 0xa5, 0x73, 0x4e, 0x69, 0x21, 0xfc, 0x8e,
+	0xf6, 0x18, 0x19, 0xe5, 0x4c, 0xe9, 0xd0, 0x07, 0xef, 0x96, 0x16, 0x82, 0xe5, 0x99, 0xdf, 0xd5,
+	0x71, 0x2b, 0x11, 0x3f, 0x84, 0x5e, 0x9c, 0xa7, 0x29, 0x93, 0xbe, 0xab, 0x0d, 0x46, 0xc2, 0x29,
+	0x1c, 0x14, 0x3c, 0x9e, 0x6b, 0xf2, 0x71, 0x9e, 0xcc, 0x2b, 0x78, 0x4f, 0x7b, 0x61, 0xc1, 0xe3,
+	0x99, 0x31, 0xfd, 0x6c, 0x22, 0xd5, 0x9c, 0xbc, 0x06, 0x27, 0x3c, 0x84, 0xae, 0xea, 0x9c, 0xdf,
+	0x1f, 0x3b, 0x93, 0xe1, 0xc9, 0x07, 0xc7, 0x8d, 0x36, 0x1e, 0x97, 0xad, 0x0b, 0xb5, 0x03, 0x06,
+	0xd0, 0x57, 0xf5, 0x67, 0x51, 0x4a, 0xfd, 0x81, 0x8e, 0x50, 0xcb, 0x78, 0x08, 0x0f, 0x38, 0xcb,
+	0x32, 0x96, 0xfd, 0x3a, 0xa7, 0x59, 0xb4, 0x48, 0xe8, 0xd2, 0x87, 0xb1, 0x33, 0xe9, 0x87, 0xfb,
+	0x46, 0x7d, 0x5e, 0x6a, 0x15, 0x9b, 0x6b, 0x1a, 0x25, 0xf2, 0xda, 0x1f, 0x96, 0x6c, 0x4a, 0x89,
+	0x3c, 0x01, 0xaf, 0x2a, 0xb3, 0xd1, 0x0a, 0xc7, 0x6a, 0x05, 0xf9, 0x0a, 0xf6, 0x55, 0xb7, 0x5e,
+	0x2c, 0x97, 0x21, 0xfd, 0x6d, 0x45, 0x85, 0x44, 0x02, 0xa3, 0x74, 0x95, 0x48, 0x66, 0xba, 0x6d,
+	0x00, 0x96, 0x8e, 0x1c, 0xc2, 0x23, 0x85, 0x0a, 0x69, 0x9a, 0xdf, 0xd2, 0x0a, 0x88, 0xd0, 0x55,
+	0xc5, 0x1b, 0x80, 0xfe, 0x26, 0x7f, 0x38, 0xd0, 0x99, 0xb1, 0x0c, 0x1f, 0x42, 0x27, 0xae, 0xe7,
+	0xab, 0x3e, 0x95, 0xb7, 0xa6, 0xdd, 0x2e, 0xbd, 0x35, 0xe5, 0x2f, 0x00, 0x0b, 0xca, 0x13, 0x16,
+	0x47, 0x92, 0xe5, 0xd9, 0xfc, 0x2a, 0x8a, 0xa5, 0x79, 0x2e, 0x6e, 0xf8, 0xa8, 0x61, 0x79, 0xa5,
+	0x0d, 0xea, 0x8d, 0x28, 0x98, 0xe0, 0x51, 0x4c, 0xcd, 0x88, 0x37, 0x0a, 0x1c, 0xc3, 0x30, 0x4a,
+	0x92, 0xbc, 0x44, 0x08, 0xdf, 0xd5, 0x2f, 0xa4, 0xa9, 0x52, 0x25, 0xc8, 0x35, 0xa7, 0x66, 0xbc,
+	0xfa, 0x5b, 0x93, 0x88, 0xe4, 0xb5, 0x99, 0xa7, 0xfe, 0x26, 0xdf, 0xc3, 0xe8, 0xa7, 0x8c, 0xb3,
+	0xac, 0x22, 0x7a, 0x9f, 0x8c, 0x55, 0x49, 0xfb, 0x4e, 0x25, 0xe4, 0x31, 0xc0, 0x19, 0x5b, 0xee,
+	0x44, 0x93, 0x23, 0x18, 0xce, 0x58, 0x26, 0x2a, 0x07, 0x2b, 0x98, 0x73, 0x37, 0xd8, 0x37, 0xb0,
+	0x77, 0x29, 0x23, 0xb9, 0x12, 0xbb, 0xab, 0x39, 0x00, 0x57, 0x91, 0x4c, 0x74, 0x25, 0xfd, 0xb0,
+	0x14, 0xc8, 0x73, 0x78, 0x58, 0x02, 0x5f, 0x24, 0x49, 0x85, 0xad, 0x3d, 0x9d, 0x86, 0xa7, 0x7a,
+	0x50, 0x57, 0x2c, 0x91, 0xb4, 0x30, 0x54, 0x8c, 0x44, 0xfe, 0x74, 0xc0, 0x9b, 0xb1, 0xec, 0x22,
+	0xbb, 0xca, 0xb7, 0x0f, 0x94, 0xd3, 0x1a, 0xa3, 0xbf, 0x55, 0x24, 0xa1, 0x73, 0x9a, 0x9d, 0x37,
+	0x92, 0xa2, 0x28, 0x59, 0x4a, 0x85, 0x8c, 0x52, 0x5e, 0x4d, 0xae, 0x56, 0x6c, 0x96, 0xca, 0x6d,
+	0x2e, 0x55, 0x00, 0xfd, 0x48, 0x4a, 0x9a, 0x72, 0x29, 0xf4, 0xc4, 0xdc, 0xb0, 0x96, 0x55, 0x9e,
+	0x45, 0x92, 0xc7, 0x37, 0x42, 0xcf, 0xad, 0x13, 0x1a, 0x49, 0xd5, 0x24, 0xd8, 0xef, 0x54, 0x2f,
+	0x62, 0x37, 0xd4, 0xdf, 0xe4, 0x2f, 0x07, 0xf6, 0x5e, 0x27, 0xf9, 0x22, 0x4a, 0x76, 0x73, 0x39,
+	0x2d, 0xf7, 0x72, 0x9e, 0x46, 0x5c, 0x1f, 0x9f, 0xe1, 0xc9, 0xa1, 0xb5, 0xc4, 0x16, 0xfe, 0x58,
+	0xad, 0xc2, 0x8f, 0x11, 0x3f, 0xcf, 0x64, 0xb1, 0x0e, 0x3d, 0x5e, 0x4a, 0xdb, 0xcf, 0x5d, 0x30,
+	0x83, 0x51, 0xd3, 0x5d, 0xe5, 0xbe, 0xa1, 0xeb, 0x2a, 0xf7, 0x0d, 0x5d, 0xe3, 0xe7, 0xe0, 0xde,
+	0x46, 0xc9, 0xaa, 0x7c, 0x47, 0xc3, 0x93, 0x03, 0x2b, 0xb1, 0x49, 0x19, 0x96, 0x2e, 0xdf, 0xb5,
+	0x9f, 0x39, 0x27, 0xff, 0xf4, 0xc0, 0x3b, 0x2b, 0xcd, 0x78, 0xa4, 0x6f, 0x29, 0x5a, 0x10, 0x7d,
+	0xb4, 0x83, 0x07, 0xf6, 0x11, 0x7a, 0x49, 0x5a, 0xf8, 0x74, 0x73, 0x1f, 0xb6, 0x21, 0xec, 0xc4,
+	0xc6, 0x93, 0xb4, 0x70, 0x0a, 0x6e, 0x79, 0x5f, 0xff, 0x5b, 0x9a, 0xa9, 0x83, 0xdf, 0x82, 0x67,
+	0x6e, 0x0c, 0x7e, 0x62, 0xb3, 0xb1, 0x2e, 0xcf, 0xb6, 0x1a, 0x4f, 0x01, 0x36, 0x87, 0x06, 0x1f,
+	0xdf, 0x43, 0x5b, 0x17, 0x28, 0xd8, 0x52, 0x11, 0x69, 0xe1, 0x91, 0x39, 0x41, 0x77, 0x1b, 0x19,
+	0xdc, 0xd3, 0x90, 0x16, 0x3e, 0x03, 0x57, 0xef, 0x3a, 0x7e, 0x6c, 0x19, 0x9b, 0xfb, 0xbf, 0x23,
+	0xcd, 0x53, 0xe8, 0xcd, 0x58, 0xf6, 0x9a, 0x4a, 0xfc, 0xc8, 0xb2, 0x6f, 0x56, 0x7f, 0x6b, 0xc2,
+	0xaf, 0xa1, 0xab, 0x96, 0x1f, 0xfd, 0xbb, 0x36, 0xf1, 0x16, 0xd4, 0xd4, 0xc1, 0x53, 0xe8, 0x95,
+	0xeb, 0x8c, 0x81, 0x65, 0xb7, 0x8e, 0x43, 0x10, 0xec, 0x7e, 0xb6, 0xa4, 0x85, 0x3f, 0xc0, 0xa0,
+	0x3e, 0x09, 0xf8, 0xd9, 0x96, 0x30, 0x9b, 0x53, 0xf1, 0xf6, 0x48, 0x53, 0x07, 0xdf, 0xc0, 0xa8,
+	0xc4, 0x5c, 0xca, 0x82, 0x46, 0xe9, 0xbb, 0x57, 0x35, 0x71, 0xa6, 0x0e, 0x3e, 0x87, 0xee, 0xe5,
+	0x3a, 0x8b, 0xdf, 0x83, 0xdb, 0x19, 0x78, 0x21, 0x8d, 0xf3, 0x5b, 0x5a, 0xbc, 0x7b, 0x90, 0xd3,
+	0xee, 0x2f, 0x6d, 0xbe, 0x58, 0xf4, 0xf4, 0x0f, 0xc1, 0x97, 0xff, 0x0e, 0x00, 0x3b, 0x26, 0x23,
+	0xc7, 0x1e, 0x09, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// ClusterClient is the client API for Cluster service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ClusterClient interface {
+	// ID returns the cluster peer and its IPFS daemon.
+	ID(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ID, error)
+	// Version returns the cluster version.
+	Version(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Version, error)
+	// Peers streams the IDs of the cluster peers.
+	Peers(ctx context.Context, in *Empty, opts ...grpc.CallOption) (Cluster_PeersClient, error)
+	// PeerAdd adds the peer with the given multiaddress to the cluster.
+	PeerAdd(ctx context.Context, in *PeerAddRequest, opts ...grpc.CallOption) (*ID, error)
+	// PeerRemove removes a peer from the cluster.
+	PeerRemove(ctx context.Context, in *PeerRemoveRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Pin adds an item to the shared state and returns it with its
+	// allocations.
+	Pin(ctx context.Context, in *Pin, opts ...grpc.CallOption) (*Pin, error)
+	// Unpin removes an item from the shared state.
+	Unpin(ctx context.Context, in *UnpinRequest, opts ...grpc.CallOption) (*Empty, error)
+	// PinGet returns an item of the shared state.
+	PinGet(ctx context.Context, in *CidRequest, opts ...grpc.CallOption) (*Pin, error)
+	// Pins streams the items of the shared state.
+	Pins(ctx context.Context, in *PinsRequest, opts ...grpc.CallOption) (Cluster_PinsClient, error)
+	// Status returns the status of an item in the cluster peers.
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*GlobalPinInfo, error)
+	// StatusAll streams the status of all the items.
+	StatusAll(ctx context.Context, in *StatusAllRequest, opts ...grpc.CallOption) (Cluster_StatusAllClient, error)
+	// StatusStream returns the status of every item sent by the client, as
+	// soon as they are received. Failures are reported in the error field
+	// of the replies and do not end the stream.
+	StatusStream(ctx context.Context, opts ...grpc.CallOption) (Cluster_StatusStreamClient, error)
+	// Sync updates the status of an item with the state of IPFS.
+	Sync(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*GlobalPinInfo, error)
+	// Recover retries pinning or unpinning an item in error.
+	Recover(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*GlobalPinInfo, error)
+}
+
+type clusterClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewClusterClient(cc *grpc.ClientConn) ClusterClient {
+	return &clusterClient{cc}
+}
+
+func (c *clusterClient) ID(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ID, error) {
+	out := new(ID)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/ID", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Version(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Version, error) {
+	out := new(Version)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Peers(ctx context.Context, in *Empty, opts ...grpc.CallOption) (Cluster_PeersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Cluster_serviceDesc.Streams[0], "/ipfscluster.Cluster/Peers", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &clusterPeersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cluster_PeersClient interface {
+	Recv() (*ID, error)
+	grpc.ClientStream
+}
+
+type clusterPeersClient struct {
+	grpc.ClientStream
+}
+
+func (x *clusterPeersClient) Recv() (*ID, error) {
+	m := new(ID)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *clusterClient) PeerAdd(ctx context.Context, in *PeerAddRequest, opts ...grpc.CallOption) (*ID, error) {
+	out := new(ID)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/PeerAdd", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) PeerRemove(ctx context.Context, in *PeerRemoveRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/PeerRemove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Pin(ctx context.Context, in *Pin, opts ...grpc.CallOption) (*Pin, error) {
+	out := new(Pin)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/Pin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Unpin(ctx context.Context, in *UnpinRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/Unpin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) PinGet(ctx context.Context, in *CidRequest, opts ...grpc.CallOption) (*Pin, error) {
+	out := new(Pin)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/PinGet", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Pins(ctx context.Context, in *PinsRequest, opts ...grpc.CallOption) (Cluster_PinsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Cluster_serviceDesc.Streams[1], "/ipfscluster.Cluster/Pins", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &clusterPinsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cluster_PinsClient interface {
+	Recv() (*Pin, error)
+	grpc.ClientStream
+}
+
+type clusterPinsClient struct {
+	grpc.ClientStream
+}
+
+func (x *clusterPinsClient) Recv() (*Pin, error) {
+	m := new(Pin)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *clusterClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*GlobalPinInfo, error) {
+	out := new(GlobalPinInfo)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) StatusAll(ctx context.Context, in *StatusAllRequest, opts ...grpc.CallOption) (Cluster_StatusAllClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Cluster_serviceDesc.Streams[2], "/ipfscluster.Cluster/StatusAll", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &clusterStatusAllClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cluster_StatusAllClient interface {
+	Recv() (*GlobalPinInfo, error)
+	grpc.ClientStream
+}
+
+type clusterStatusAllClient struct {
+	grpc.ClientStream
+}
+
+func (x *clusterStatusAllClient) Recv() (*GlobalPinInfo, error) {
+	m := new(GlobalPinInfo)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *clusterClient) StatusStream(ctx context.Context, opts ...grpc.CallOption) (Cluster_StatusStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Cluster_serviceDesc.Streams[3], "/ipfscluster.Cluster/StatusStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &clusterStatusStreamClient{stream}
+	return x, nil
+}
+
+type Cluster_StatusStreamClient interface {
+	Send(*StatusRequest) error
+	Recv() (*GlobalPinInfo, error)
+	grpc.ClientStream
+}
+
+type clusterStatusStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *clusterStatusStreamClient) Send(m *StatusRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *clusterStatusStreamClient) Recv() (*GlobalPinInfo, error) {
+	m := new(GlobalPinInfo)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *clusterClient) Sync(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*GlobalPinInfo, error) {
+	out := new(GlobalPinInfo)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/Sync", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Recover(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*GlobalPinInfo, error) {
+	out := new(GlobalPinInfo)
+	err := c.cc.Invoke(ctx, "/ipfscluster.Cluster/Recover", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClusterServer is the server API for Cluster service.
+type ClusterServer interface {
+	// ID returns the cluster peer and its IPFS daemon.
+	ID(context.Context, *Empty) (*ID, error)
+	// Version returns the cluster version.
+	Version(context.Context, *Empty) (*Version, error)
+	// Peers streams the IDs of the cluster peers.
+	Peers(*Empty, Cluster_PeersServer) error
+	// PeerAdd adds the peer with the given multiaddress to the cluster.
+	PeerAdd(context.Context, *PeerAddRequest) (*ID, error)
+	// PeerRemove removes a peer from the cluster.
+	PeerRemove(context.Context, *PeerRemoveRequest) (*Empty, error)
+	// Pin adds an item to the shared state and returns it with its
+	// allocations.
+	Pin(context.Context, *Pin) (*Pin, error)
+	// Unpin removes an item from the shared state.
+	Unpin(context.Context, *UnpinRequest) (*Empty, error)
+	// PinGet returns an item of the shared state.
+	PinGet(context.Context, *CidRequest) (*Pin, error)
+	// Pins streams the items of the shared state.
+	Pins(*PinsRequest, Cluster_PinsServer) error
+	// Status returns the status of an item in the cluster peers.
+	Status(context.Context, *StatusRequest) (*GlobalPinInfo, error)
+	// StatusAll streams the status of all the items.
+	StatusAll(*StatusAllRequest, Cluster_StatusAllServer) error
+	// StatusStream returns the status of every item sent by the client, as
+	// soon as they are received. Failures are reported in the error field
+	// of the replies and do not end the stream.
+	StatusStream(Cluster_StatusStreamServer) error
+	// Sync updates the status of an item with the state of IPFS.
+	Sync(context.Context, *StatusRequest) (*GlobalPinInfo, error)
+	// Recover retries pinning or unpinning an item in error.
+	Recover(context.Context, *StatusRequest) (*GlobalPinInfo, error)
+}
+
+// UnimplementedClusterServer can be embedded to have forward compatible implementations.
+type UnimplementedClusterServer struct {
+}
+
+func (*UnimplementedClusterServer) ID(ctx context.Context, req *Empty) (*ID, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ID not implemented")
+}
+func (*UnimplementedClusterServer) Version(ctx context.Context, req *Empty) (*Version, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
+func (*UnimplementedClusterServer) Peers(req *Empty, srv Cluster_PeersServer) error {
+	return status.Errorf(codes.Unimplemented, "method Peers not implemented")
+}
+func (*UnimplementedClusterServer) PeerAdd(ctx context.Context, req *PeerAddRequest) (*ID, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PeerAdd not implemented")
+}
+func (*UnimplementedClusterServer) PeerRemove(ctx context.Context, req *PeerRemoveRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PeerRemove not implemented")
+}
+func (*UnimplementedClusterServer) Pin(ctx context.Context, req *Pin) (*Pin, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pin not implemented")
+}
+func (*UnimplementedClusterServer) Unpin(ctx context.Context, req *UnpinRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unpin not implemented")
+}
+func (*UnimplementedClusterServer) PinGet(ctx context.Context, req *CidRequest) (*Pin, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PinGet not implemented")
+}
+func (*UnimplementedClusterServer) Pins(req *PinsRequest, srv Cluster_PinsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Pins not implemented")
+}
+func (*UnimplementedClusterServer) Status(ctx context.Context, req *StatusRequest) (*GlobalPinInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (*UnimplementedClusterServer) StatusAll(req *StatusAllRequest, srv Cluster_StatusAllServer) error {
+	return status.Errorf(codes.Unimplemented, "method StatusAll not implemented")
+}
+func (*UnimplementedClusterServer) StatusStream(srv Cluster_StatusStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method StatusStream not implemented")
+}
+func (*UnimplementedClusterServer) Sync(ctx context.Context, req *StatusRequest) (*GlobalPinInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (*UnimplementedClusterServer) Recover(ctx context.Context, req *StatusRequest) (*GlobalPinInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Recover not implemented")
+}
+
+func RegisterClusterServer(s *grpc.Server, srv ClusterServer) {
+	s.RegisterService(&_Cluster_serviceDesc, srv)
+}
+
+func _Cluster_ID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).ID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/ID",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).ID(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/Version",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Version(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Peers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ClusterServer).Peers(m, &clusterPeersServer{stream})
+}
+
+type Cluster_PeersServer interface {
+	Send(*ID) error
+	grpc.ServerStream
+}
+
+type clusterPeersServer struct {
+	grpc.ServerStream
+}
+
+func (x *clusterPeersServer) Send(m *ID) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cluster_PeerAdd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerAddRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).PeerAdd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/PeerAdd",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).PeerAdd(ctx, req.(*PeerAddRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_PeerRemove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerRemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).PeerRemove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/PeerRemove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).PeerRemove(ctx, req.(*PeerRemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Pin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Pin)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Pin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/Pin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Pin(ctx, req.(*Pin))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Unpin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnpinRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Unpin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/Unpin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Unpin(ctx, req.(*UnpinRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_PinGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CidRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).PinGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/PinGet",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).PinGet(ctx, req.(*CidRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Pins_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PinsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ClusterServer).Pins(m, &clusterPinsServer{stream})
+}
+
+type Cluster_PinsServer interface {
+	Send(*Pin) error
+	grpc.ServerStream
+}
+
+type clusterPinsServer struct {
+	grpc.ServerStream
+}
+
+func (x *clusterPinsServer) Send(m *Pin) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cluster_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_StatusAll_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StatusAllRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ClusterServer).StatusAll(m, &clusterStatusAllServer{stream})
+}
+
+type Cluster_StatusAllServer interface {
+	Send(*GlobalPinInfo) error
+	grpc.ServerStream
+}
+
+type clusterStatusAllServer struct {
+	grpc.ServerStream
+}
+
+func (x *clusterStatusAllServer) Send(m *GlobalPinInfo) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cluster_StatusStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ClusterServer).StatusStream(&clusterStatusStreamServer{stream})
+}
+
+type Cluster_StatusStreamServer interface {
+	Send(*GlobalPinInfo) error
+	Recv() (*StatusRequest, error)
+	grpc.ServerStream
+}
+
+type clusterStatusStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *clusterStatusStreamServer) Send(m *GlobalPinInfo) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *clusterStatusStreamServer) Recv() (*StatusRequest, error) {
+	m := new(StatusRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Cluster_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/Sync",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Sync(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Recover_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Recover(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipfscluster.Cluster/Recover",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Recover(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Cluster_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "ipfscluster.Cluster",
+	HandlerType: (*ClusterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ID",
+			Handler:    _Cluster_ID_Handler,
+		},
+		{
+			MethodName: "Version",
+			Handler:    _Cluster_Version_Handler,
+		},
+		{
+			MethodName: "PeerAdd",
+			Handler:    _Cluster_PeerAdd_Handler,
+		},
+		{
+			MethodName: "PeerRemove",
+			Handler:    _Cluster_PeerRemove_Handler,
+		},
+		{
+			MethodName: "Pin",
+			Handler:    _Cluster_Pin_Handler,
+		},
+		{
+			MethodName: "Unpin",
+			Handler:    _Cluster_Unpin_Handler,
+		},
+		{
+			MethodName: "PinGet",
+			Handler:    _Cluster_PinGet_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _Cluster_Status_Handler,
+		},
+		{
+			MethodName: "Sync",
+			Handler:    _Cluster_Sync_Handler,
+		},
+		{
+			MethodName: "Recover",
+			Handler:    _Cluster_Recover_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Peers",
+			Handler:       _Cluster_Peers_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Pins",
+			Handler:       _Cluster_Pins_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StatusAll",
+			Handler:       _Cluster_StatusAll_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StatusStream",
+			Handler:       _Cluster_StatusStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "cluster.proto",
+}
@@ -0,0 +1,7 @@
+// Package pb contains the messages and the service of the IPFS Cluster
+// gRPC API. cluster.pb.go is generated from cluster.proto with protoc and
+// protoc-gen-go (github.com/golang/protobuf v1.3.2) and must not be edited:
+// change cluster.proto and run "go generate" instead.
+package pb
+
+//go:generate protoc --go_out=plugins=grpc:. cluster.proto
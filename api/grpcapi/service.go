@@ -0,0 +1,326 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/grpcapi/pb"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// service implements pb.ClusterServer with RPC calls to the peer.
+type service struct {
+	api *API
+}
+
+func (s *service) ID(ctx context.Context, in *pb.Empty) (*pb.ID, error) {
+	var id types.IDSerial
+	err := s.api.call("ID", struct{}{}, &id)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return toPbID(id), nil
+}
+
+func (s *service) Version(ctx context.Context, in *pb.Empty) (*pb.Version, error) {
+	var v types.Version
+	err := s.api.call("Version", struct{}{}, &v)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &pb.Version{Version: v.Version}, nil
+}
+
+func (s *service) Peers(in *pb.Empty, stream pb.Cluster_PeersServer) error {
+	var peers []types.IDSerial
+	err := s.api.call("Peers", struct{}{}, &peers)
+	if err != nil {
+		return rpcError(err)
+	}
+	for _, id := range peers {
+		if err := stream.Send(toPbID(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) PeerAdd(ctx context.Context, in *pb.PeerAddRequest) (*pb.ID, error) {
+	mAddr, err := ma.NewMultiaddr(in.Multiaddress)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "error decoding multiaddress: %s", err)
+	}
+	var id types.IDSerial
+	err = s.api.call("PeerAdd", types.MultiaddrToSerial(mAddr), &id)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return toPbID(id), nil
+}
+
+func (s *service) PeerRemove(ctx context.Context, in *pb.PeerRemoveRequest) (*pb.Empty, error) {
+	p, err := peer.IDB58Decode(in.Peer)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "error decoding Peer ID: %s", err)
+	}
+	err = s.api.call("PeerRemove", p, &struct{}{})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// Pin pins an item and returns it as it was added to the shared state,
+// with its allocations. When it cannot be read back, the request is
+// returned instead.
+func (s *service) Pin(ctx context.Context, in *pb.Pin) (*pb.Pin, error) {
+	if err := checkCid(in.Cid); err != nil {
+		return nil, err
+	}
+	ps := types.PinSerial{
+		Cid:               in.Cid,
+		Name:              in.Name,
+		ReplicationFactor: int(in.ReplicationFactor),
+		Namespace:         in.Namespace,
+	}
+	err := s.api.call("Pin", ps, &struct{}{})
+	if err != nil {
+		if _, ok := types.QuotaErrorDetails(err.Error()); ok {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if types.IsInvalidPinError(err.Error()) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, rpcError(err)
+	}
+
+	var pinned types.PinSerial
+	err = s.api.call("PinGet", types.PinSerial{Cid: in.Cid}, &pinned)
+	if err != nil {
+		return toPbPin(ps), nil
+	}
+	return toPbPin(pinned), nil
+}
+
+func (s *service) Unpin(ctx context.Context, in *pb.UnpinRequest) (*pb.Empty, error) {
+	if err := checkCid(in.Cid); err != nil {
+		return nil, err
+	}
+	method := "Unpin"
+	if in.Namespace != "" {
+		method = "UnpinNamespace"
+	}
+	err := s.api.call(method, types.PinSerial{Cid: in.Cid, Namespace: in.Namespace}, &struct{}{})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (s *service) PinGet(ctx context.Context, in *pb.CidRequest) (*pb.Pin, error) {
+	if err := checkCid(in.Cid); err != nil {
+		return nil, err
+	}
+	var pin types.PinSerial
+	err := s.api.call("PinGet", types.PinSerial{Cid: in.Cid}, &pin)
+	if err != nil { // errors here are not found errors
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return toPbPin(pin), nil
+}
+
+func (s *service) Pins(in *pb.PinsRequest, stream pb.Cluster_PinsServer) error {
+	var pins []types.PinSerial
+	err := s.api.call("Pins", struct{}{}, &pins)
+	if err != nil {
+		return rpcError(err)
+	}
+	for _, pin := range pins {
+		if in.Namespace != "" && pin.Namespace != in.Namespace {
+			continue
+		}
+		if err := stream.Send(toPbPin(pin)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) Status(ctx context.Context, in *pb.StatusRequest) (*pb.GlobalPinInfo, error) {
+	return s.pinInfo("Status", in)
+}
+
+func (s *service) Sync(ctx context.Context, in *pb.StatusRequest) (*pb.GlobalPinInfo, error) {
+	return s.pinInfo("Sync", in)
+}
+
+func (s *service) Recover(ctx context.Context, in *pb.StatusRequest) (*pb.GlobalPinInfo, error) {
+	return s.pinInfo("Recover", in)
+}
+
+// pinInfo calls the given status method, or its local version, for an
+// item.
+func (s *service) pinInfo(method string, in *pb.StatusRequest) (*pb.GlobalPinInfo, error) {
+	if err := checkCid(in.Cid); err != nil {
+		return nil, err
+	}
+	ps := types.PinSerial{Cid: in.Cid}
+	if in.Local {
+		var pinfo types.PinInfoSerial
+		err := s.api.call(method+"Local", ps, &pinfo)
+		if err != nil {
+			return nil, rpcError(err)
+		}
+		return toPbGlobalPinInfo(pinInfoToGlobal(pinfo)), nil
+	}
+	var gpinfo types.GlobalPinInfoSerial
+	err := s.api.call(method, ps, &gpinfo)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return toPbGlobalPinInfo(gpinfo), nil
+}
+
+func (s *service) StatusAll(in *pb.StatusAllRequest, stream pb.Cluster_StatusAllServer) error {
+	filter, err := types.StatusFilterFromString(in.Filter)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var gpinfos []types.GlobalPinInfoSerial
+	if in.Local {
+		var pinfos []types.PinInfoSerial
+		err = s.api.call("StatusAllLocal", filter, &pinfos)
+		for _, pinfo := range pinfos {
+			gpinfos = append(gpinfos, pinInfoToGlobal(pinfo))
+		}
+	} else {
+		err = s.api.call("StatusAll", filter, &gpinfos)
+	}
+	if err != nil {
+		return rpcError(err)
+	}
+
+	for _, gpinfo := range gpinfos {
+		if err := stream.Send(toPbGlobalPinInfo(gpinfo)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StatusStream answers every request with the status of its item until
+// the client closes its side of the stream. Errors are sent in the
+// replies so that the stream can go on.
+func (s *service) StatusStream(stream pb.Cluster_StatusStreamServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		gpinfo, err := s.pinInfo("Status", in)
+		if err != nil {
+			gpinfo = &pb.GlobalPinInfo{
+				Cid:   in.Cid,
+				Error: status.Convert(err).Message(),
+			}
+		}
+		if err := stream.Send(gpinfo); err != nil {
+			return err
+		}
+	}
+}
+
+// checkCid returns an InvalidArgument error when the given string is not
+// a valid Cid.
+func checkCid(c string) error {
+	_, err := cid.Decode(c)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "error decoding Cid: %s", err)
+	}
+	return nil
+}
+
+// rpcError converts the error of an RPC call to the peer to a gRPC one.
+func rpcError(err error) error {
+	return status.Error(codes.Unknown, err.Error())
+}
+
+func pinInfoToGlobal(pInfo types.PinInfoSerial) types.GlobalPinInfoSerial {
+	return types.GlobalPinInfoSerial{
+		Cid: pInfo.Cid,
+		PeerMap: map[string]types.PinInfoSerial{
+			pInfo.Peer: pInfo,
+		},
+	}
+}
+
+func toPbID(id types.IDSerial) *pb.ID {
+	return &pb.ID{
+		Id:                 id.ID,
+		Addresses:          multiaddrsToStrings(id.Addresses),
+		ClusterPeers:       id.ClusterPeers,
+		Version:            id.Version,
+		Commit:             id.Commit,
+		RpcProtocolVersion: id.RPCProtocolVersion,
+		Error:              id.Error,
+		Ipfs: &pb.IPFSID{
+			Id:        id.IPFS.ID,
+			Addresses: multiaddrsToStrings(id.IPFS.Addresses),
+			Error:     id.IPFS.Error,
+		},
+		Peername:       id.Peername,
+		PinningEnabled: id.PinningEnabled,
+		Health:         id.Health,
+	}
+}
+
+func multiaddrsToStrings(addrs types.MultiaddrsSerial) []string {
+	strs := make([]string, len(addrs), len(addrs))
+	for i, a := range addrs {
+		strs[i] = string(a)
+	}
+	return strs
+}
+
+func toPbPin(pin types.PinSerial) *pb.Pin {
+	return &pb.Pin{
+		Cid:               pin.Cid,
+		Name:              pin.Name,
+		ReplicationFactor: int32(pin.ReplicationFactor),
+		Namespace:         pin.Namespace,
+		Allocations:       pin.Allocations,
+		Type:              pin.Type,
+		Path:              pin.Path,
+	}
+}
+
+func toPbGlobalPinInfo(gpinfo types.GlobalPinInfoSerial) *pb.GlobalPinInfo {
+	peerMap := make(map[string]*pb.PinInfo, len(gpinfo.PeerMap))
+	for p, pinfo := range gpinfo.PeerMap {
+		peerMap[p] = &pb.PinInfo{
+			Cid:       pinfo.Cid,
+			Peer:      pinfo.Peer,
+			Status:    pinfo.Status,
+			Timestamp: pinfo.TS,
+			Error:     pinfo.Error,
+			Attempts:  int32(pinfo.Attempts),
+			Blocks:    int64(pinfo.Blocks),
+			Size:      pinfo.Size,
+		}
+	}
+	return &pb.GlobalPinInfo{
+		Cid:     gpinfo.Cid,
+		PeerMap: peerMap,
+	}
+}
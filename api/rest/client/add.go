@@ -0,0 +1,120 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// Add adds the given files and directories (recursively) to IPFS
+// through the cluster peer, with the given options, like "ipfs add". The
+// resulting roots are pinned in cluster with the given replication
+// factor and name (their file names when empty). The upload is streamed
+// and the client timeout does not apply to it. Failed uploads are retried
+// from the start, up to the configured number of times. It returns all
+// the added items.
+func (c *Client) Add(paths []string, params api.AddParams, replicationFactor int, name string) ([]api.AddedOutput, error) {
+	q := url.Values{}
+	q.Set("replication_factor", strconv.Itoa(replicationFactor))
+	if name != "" {
+		q.Set("name", name)
+	}
+	if params.Chunker != "" {
+		q.Set("chunker", params.Chunker)
+	}
+	q.Set("raw-leaves", strconv.FormatBool(params.RawLeaves))
+	q.Set("wrap-with-directory", strconv.FormatBool(params.WrapWithDirectory))
+
+	key := newIdempotencyKey()
+	id := newRequestID()
+	var serials []api.AddedOutputSerial
+	err := c.retry(func() error {
+		pr, pw := io.Pipe()
+		mpw := multipart.NewWriter(pw)
+		go func() {
+			err := writeAddBody(mpw, paths)
+			if err == nil {
+				err = mpw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+
+		r, err := c.newTracedRequest("POST", "/add?"+q.Encode(), pr, id)
+		if err != nil {
+			pr.CloseWithError(err)
+			return &api.Error{Code: 0, Message: err.Error()}
+		}
+		r.Header.Set("Content-Type", mpw.FormDataContentType())
+		r.Header.Set(idempotencyKeyHeader, key)
+		client := &http.Client{Transport: c.transport}
+		resp, err := client.Do(r)
+		if err != nil {
+			pr.CloseWithError(err)
+			return &api.Error{Code: 0, Message: err.Error()}
+		}
+		return c.handleResponse(resp, &serials)
+	})
+
+	added := make([]api.AddedOutput, len(serials), len(serials))
+	for i, s := range serials {
+		added[i] = s.ToAddedOutput()
+	}
+	return added, err
+}
+
+// writeAddBody writes a part for every file and directory under the given
+// paths, named after their path relative to the parent of the given ones,
+// as expected by the IPFS add endpoint.
+func writeAddBody(mpw *multipart.Writer, paths []string) error {
+	for _, p := range paths {
+		base := filepath.Dir(filepath.Clean(p))
+		err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+			return writeAddPart(mpw, filepath.ToSlash(rel), path, info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeAddPart(mpw *multipart.Writer, name, path string, info os.FileInfo) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, name))
+	if info.IsDir() {
+		h.Set("Content-Type", "application/x-directory")
+		_, err := mpw.CreatePart(h)
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file or a directory", path)
+	}
+
+	h.Set("Content-Type", "application/octet-stream")
+	part, err := mpw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(part, f)
+	return err
+}
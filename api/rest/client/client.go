@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
 	manet "github.com/multiformats/go-multiaddr-net"
@@ -17,6 +19,9 @@ var (
 	DefaultTimeout  = 60 * time.Second
 	DefaultAPIAddr  = "/ip4/127.0.0.1/tcp/9094"
 	DefaultLogLevel = "info"
+	// RetryDelay is the time to wait before the first retry of a
+	// request. It doubles with every retry.
+	RetryDelay = time.Second
 )
 
 var loggingFacility = "apiclient"
@@ -34,10 +39,20 @@ type Config struct {
 	Username string
 	Password string
 
+	// Token for Bearer authentication. It is used when no Username
+	// is set.
+	Token string
+
 	// The ipfs-cluster REST API endpoint in multiaddress form
-	// (takes precedence over host:port)
+	// (takes precedence over host:port). When it ends with
+	// /ipfs/<peerID>, the API is reached over libp2p, using the
+	// cluster peer's libp2p address (i.e. /ip4/1.2.3.4/tcp/9096/ipfs/<peerID>)
 	APIAddr ma.Multiaddr
 
+	// Secret is the cluster secret, needed to reach the API over libp2p
+	// when the cluster runs on a private network.
+	Secret []byte
+
 	// REST API endpoint host and port. Only valid without
 	// APIAddr
 	Host string
@@ -46,12 +61,24 @@ type Config struct {
 	// Define timeout for network operations
 	Timeout time.Duration
 
+	// Retries is the number of times that pin, unpin and add requests
+	// are retried when they fail because of network errors, server
+	// errors or rate limits. They carry an Idempotency-Key, so the cluster executes
+	// them only once.
+	Retries int
+
 	// Specifies if we attempt to re-use connections to the same
 	// hosts.
 	DisableKeepAlives bool
 
 	// LogLevel defines the verbosity of the logging facility
 	LogLevel string
+
+	// APIVersion is the version of the REST API used by the client
+	// (i.e. "v1", or "v0" for the unversioned routes of older peers).
+	// When empty, the newest version supported by both the client and
+	// the peer is used.
+	APIVersion string
 }
 
 // Client provides methods to interact with the ipfs-cluster API. Use
@@ -63,6 +90,10 @@ type Client struct {
 	transport http.RoundTripper
 	urlPrefix string
 	client    *http.Client
+
+	versionMux        sync.Mutex
+	versionNegotiated bool
+	apiPrefix         string
 }
 
 // NewClient initializes a client given a Config.
@@ -83,6 +114,10 @@ func NewClient(cfg *Config) (*Client, error) {
 		cfg.Timeout = DefaultTimeout
 	}
 
+	if v := cfg.APIVersion; v != "" && !supportedVersion(v) {
+		return nil, fmt.Errorf("unsupported API version: %s", v)
+	}
+
 	// When no host/port/multiaddress defined, we set the default
 	if cfg.APIAddr == nil && cfg.Host == "" && cfg.Port == "" {
 		cfg.APIAddr, _ = ma.NewMultiaddr(DefaultAPIAddr)
@@ -90,16 +125,29 @@ func NewClient(cfg *Config) (*Client, error) {
 
 	var host string
 	// APIAddr takes preference. If it exists, it's resolved and dial args
-	// extracted. Otherwise, host port is used.
+	// extracted. Otherwise, host port is used. Addresses carrying a
+	// peer ID are reached over libp2p.
 	if cfg.APIAddr != nil {
-		// Resolve multiaddress just in case and extract host:port
-		resolveCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
-		defer cancel()
-		resolved, err := madns.Resolve(resolveCtx, cfg.APIAddr)
-		cfg.APIAddr = resolved[0]
-		_, host, err = manet.DialArgs(cfg.APIAddr)
-		if err != nil {
-			return nil, err
+		if addr, pid, ok := libp2pAddr(cfg.APIAddr); ok {
+			var err error
+			tr, err = newLibp2pTransport(ctx, addr, pid, cfg.Secret)
+			if err != nil {
+				return nil, err
+			}
+			// Requests travel over libp2p streams, but they still
+			// need a host in the URL.
+			urlPrefix = "http://"
+			host = peer.IDB58Encode(pid)
+		} else {
+			// Resolve multiaddress just in case and extract host:port
+			resolveCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+			defer cancel()
+			resolved, err := madns.Resolve(resolveCtx, cfg.APIAddr)
+			cfg.APIAddr = resolved[0]
+			_, host, err = manet.DialArgs(cfg.APIAddr)
+			if err != nil {
+				return nil, err
+			}
 		}
 	} else {
 		host = fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
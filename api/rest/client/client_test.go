@@ -1,10 +1,18 @@
 package client
 
 import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	cid "github.com/ipfs/go-cid"
 	ma "github.com/multiformats/go-multiaddr"
 
+	types "github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/api/rest"
 	"github.com/ipfs/ipfs-cluster/test"
 )
@@ -18,6 +26,7 @@ func testAPI(t *testing.T) *rest.API {
 	cfg := &rest.Config{}
 	cfg.Default()
 	cfg.ListenAddr = apiMAddr
+	cfg.EnablePublicStatus = true
 
 	rest, err := rest.NewAPI(cfg)
 	if err != nil {
@@ -112,3 +121,183 @@ func TestDNSMultiaddress(t *testing.T) {
 		t.Error("bad resolved address")
 	}
 }
+
+func TestBearerToken(t *testing.T) {
+	apiMAddr, _ := ma.NewMultiaddr(apiAddr)
+	restCfg := &rest.Config{}
+	restCfg.Default()
+	restCfg.ListenAddr = apiMAddr
+	restCfg.BearerTokens = map[string]string{"ci": "abcdef"}
+	api, err := rest.NewAPI(restCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.SetClient(test.NewMockRPCClient(t))
+	defer api.Shutdown()
+
+	cfg := &Config{
+		APIAddr:           apiMAddr,
+		DisableKeepAlives: true,
+	}
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Version()
+	if err == nil {
+		t.Error("expected an error without a token")
+	}
+
+	cfg.Token = "abcdef"
+	c, err = NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Version()
+	if err != nil {
+		t.Error("expected the token to be accepted:", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	RetryDelay = time.Millisecond
+	defer func() { RetryDelay = time.Second }()
+
+	c := &Client{config: &Config{Retries: 2}}
+	calls := 0
+	err := c.retry(func() error {
+		calls++
+		return &types.Error{Code: 500, Message: "server error"}
+	})
+	if err == nil || calls != 3 {
+		t.Error("expected 3 attempts and an error:", calls, err)
+	}
+
+	calls = 0
+	err = c.retry(func() error {
+		calls++
+		if calls == 1 {
+			return &types.Error{Code: 0, Message: "connection reset"}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Error("expected success on the second attempt:", calls, err)
+	}
+
+	calls = 0
+	c.retry(func() error {
+		calls++
+		return &types.Error{Code: 404, Message: "not found"}
+	})
+	if calls != 1 {
+		t.Error("client errors should not be retried")
+	}
+
+	calls = 0
+	c.retry(func() error {
+		calls++
+		return errors.New("other error")
+	})
+	if calls != 1 {
+		t.Error("unknown errors should not be retried")
+	}
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	_, err := c.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := c.versionPrefix(); p != rest.APIPrefix {
+		t.Error("expected the current version to be negotiated and got", p)
+	}
+
+	addr, _ := ma.NewMultiaddr(apiAddr)
+	c, err = NewClient(&Config{APIAddr: addr, DisableKeepAlives: true, APIVersion: "v0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := c.versionPrefix(); p != "" {
+		t.Error("expected the unversioned routes and got", p)
+	}
+
+	_, err = NewClient(&Config{APIAddr: addr, APIVersion: "v9"})
+	if err == nil {
+		t.Error("expected an error with an unsupported version")
+	}
+}
+
+func TestAPIVersionNegotiationOldPeer(t *testing.T) {
+	// a peer from before the API was versioned
+	mux := http.NewServeMux()
+	mux.HandleFunc("/id", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(types.IDSerial{ID: test.TestPeerID1.Pretty()})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	c, err := NewClient(&Config{Host: host, Port: port, DisableKeepAlives: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := c.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ID != test.TestPeerID1 {
+		t.Error("unexpected id")
+	}
+	if p := c.versionPrefix(); p != "" {
+		t.Error("expected the unversioned routes and got", p)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	RetryDelay = time.Millisecond
+	defer func() { RetryDelay = time.Second }()
+
+	var ids []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pins/"+test.TestCid1, func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(requestIDHeader))
+		if len(ids) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(types.Error{Code: 500, Message: "server error"})
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	c, err := NewClient(&Config{Host: host, Port: port, DisableKeepAlives: true, Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci, _ := cid.Decode(test.TestCid1)
+	err = c.Pin(ci, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] == "" || ids[0] != ids[1] {
+		t.Error("the retry should carry the same request ID:", ids)
+	}
+
+	err = c.Pin(ci, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[2] == ids[0] {
+		t.Error("a new request should have a new ID:", ids)
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	host "github.com/libp2p/go-libp2p-host"
+	ipnet "github.com/libp2p/go-libp2p-interface-pnet"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+	pnet "github.com/libp2p/go-libp2p-pnet"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// libp2pAddr splits a multiaddress like /ip4/1.2.3.4/tcp/9096/ipfs/<id>
+// in the address of the peer and its ID. It returns false when it does
+// not end with an /ipfs/ component.
+func libp2pAddr(addr ma.Multiaddr) (ma.Multiaddr, peer.ID, bool) {
+	pidStr, err := addr.ValueForProtocol(ma.P_IPFS)
+	if err != nil {
+		return nil, "", false
+	}
+	pid, err := peer.IDB58Decode(pidStr)
+	if err != nil {
+		return nil, "", false
+	}
+	ipfsProto, _ := ma.NewMultiaddr("/ipfs/" + pidStr)
+	return addr.Decapsulate(ipfsProto), pid, true
+}
+
+// newLibp2pTransport returns an http.RoundTripper which sends every
+// request over a new stream to the given peer, using a libp2p host
+// with a random identity. The secret must be the cluster secret when
+// the cluster runs on a private network.
+func newLibp2pTransport(ctx context.Context, addr ma.Multiaddr, pid peer.ID, secret []byte) (http.RoundTripper, error) {
+	h, err := newLibp2pHost(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	h.Peerstore().AddAddr(pid, addr, peerstore.PermanentAddrTTL)
+
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			s, err := h.NewStream(ctx, pid, api.RESTLibp2pProtocol)
+			if err != nil {
+				return nil, err
+			}
+			return &streamConn{s}, nil
+		},
+	}, nil
+}
+
+func newLibp2pHost(ctx context.Context, secret []byte) (host.Host, error) {
+	priv, pub, err := crypto.GenerateKeyPairWithReader(crypto.RSA, 2048, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	ps := peerstore.NewPeerstore()
+	ps.AddPubKey(pid, pub)
+	ps.AddPrivKey(pid, priv)
+
+	var protec ipnet.Protector
+	if len(secret) > 0 {
+		key := "/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(secret)
+		protec, err = pnet.NewProtector(strings.NewReader(key))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	network, err := swarm.NewNetworkWithProtector(ctx, nil, pid, ps, protec, nil)
+	if err != nil {
+		return nil, err
+	}
+	return basichost.New(network), nil
+}
+
+// streamAddr is the net.Addr of one of the ends of a libp2p stream.
+type streamAddr struct {
+	id peer.ID
+}
+
+func (a streamAddr) Network() string { return "libp2p" }
+func (a streamAddr) String() string  { return a.id.Pretty() }
+
+// streamConn wraps a libp2p stream so it can be used as a net.Conn.
+type streamConn struct {
+	inet.Stream
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return streamAddr{c.Stream.Conn().LocalPeer()}
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return streamAddr{c.Stream.Conn().RemotePeer()}
+}
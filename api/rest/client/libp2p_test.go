@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	ma "github.com/multiformats/go-multiaddr"
+
+	"github.com/ipfs/ipfs-cluster/api/rest"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+var libp2pPort = 10006
+
+func makeTestingHost(t *testing.T) host.Host {
+	priv, pub, _ := crypto.GenerateKeyPair(crypto.RSA, 2048)
+	pid, _ := peer.IDFromPublicKey(pub)
+	maddr, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", libp2pPort))
+	ps := peerstore.NewPeerstore()
+	ps.AddPubKey(pid, pub)
+	ps.AddPrivKey(pid, priv)
+	ps.AddAddr(pid, maddr, peerstore.PermanentAddrTTL)
+	n, err := swarm.NewNetwork(
+		context.Background(),
+		[]ma.Multiaddr{maddr},
+		pid, ps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return basichost.New(n)
+}
+
+func TestLibp2pAddr(t *testing.T) {
+	pid := test.TestPeerID1
+	addr, _ := ma.NewMultiaddr("/ip4/1.2.3.4/tcp/9096/ipfs/" + peer.IDB58Encode(pid))
+	dialAddr, id, ok := libp2pAddr(addr)
+	if !ok {
+		t.Fatal("should have found a libp2p address")
+	}
+	if id != pid {
+		t.Error("wrong peer ID")
+	}
+	if dialAddr.String() != "/ip4/1.2.3.4/tcp/9096" {
+		t.Error("wrong dial address:", dialAddr)
+	}
+
+	addr, _ = ma.NewMultiaddr("/ip4/1.2.3.4/tcp/9094")
+	if _, _, ok := libp2pAddr(addr); ok {
+		t.Error("should not have found a libp2p address")
+	}
+}
+
+func TestLibp2pClient(t *testing.T) {
+	h := makeTestingHost(t)
+	defer h.Close()
+
+	apiMAddr, _ := ma.NewMultiaddr(apiAddr)
+	cfg := &rest.Config{}
+	cfg.Default()
+	cfg.ListenAddr = apiMAddr
+	cfg.EnableLibp2p = true
+
+	api, err := rest.NewAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.SetHost(h)
+	api.SetClient(test.NewMockRPCClient(t))
+	defer api.Shutdown()
+
+	addr, _ := ma.NewMultiaddr(fmt.Sprintf(
+		"/ip4/127.0.0.1/tcp/%d/ipfs/%s",
+		libp2pPort,
+		peer.IDB58Encode(h.ID()),
+	))
+	c, err := NewClient(&Config{
+		APIAddr:           addr,
+		DisableKeepAlives: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := c.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ID != test.TestPeerID1 {
+		t.Error("bad id")
+	}
+}
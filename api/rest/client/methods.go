@@ -1,14 +1,19 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
+	multihash "github.com/multiformats/go-multihash"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
@@ -20,6 +25,59 @@ func (c *Client) ID() (api.ID, error) {
 	return id.ToID(), err
 }
 
+// Health returns the health state of the cluster peer, which tells
+// whether it is still starting or waiting for its IPFS daemon.
+func (c *Client) Health() (api.Health, error) {
+	var health api.HealthSerial
+	err := c.do("GET", "/health", nil, &health)
+	return health.ToHealth(), err
+}
+
+// SyncStatus returns the state of the periodic sync loops of the
+// cluster peer, along with the time and outcome of their last runs.
+func (c *Client) SyncStatus() (api.SyncStatus, error) {
+	var status api.SyncStatusSerial
+	err := c.do("GET", "/health/sync", nil, &status)
+	return status.ToSyncStatus(), err
+}
+
+// ConnectGraph returns the connectivity graph of the cluster: the links
+// between cluster peers, their IPFS daemons and the swarm peers of those.
+func (c *Client) ConnectGraph() (api.ConnectGraph, error) {
+	var graph api.ConnectGraphSerial
+	err := c.do("GET", "/health/graph", nil, &graph)
+	return graph.ToConnectGraph(), err
+}
+
+// PeersLiveness returns, for every cluster peer, whether its last ping
+// metric is still valid and how long an RPC request to it took.
+func (c *Client) PeersLiveness() ([]api.PeerLiveness, error) {
+	var lives []api.PeerLivenessSerial
+	err := c.do("GET", "/health/peers", nil, &lives)
+	result := make([]api.PeerLiveness, len(lives))
+	for i, l := range lives {
+		result[i] = l.ToPeerLiveness()
+	}
+	return result, err
+}
+
+// TrackerMetrics returns the internals of the pin tracker of the cluster
+// peer: queue lengths, ongoing IPFS requests, errors, retries and the
+// average pin latency.
+func (c *Client) TrackerMetrics() (api.TrackerMetrics, error) {
+	var metrics api.TrackerMetricsSerial
+	err := c.do("GET", "/monitor/tracker", nil, &metrics)
+	return metrics.ToTrackerMetrics(), err
+}
+
+// PublicStatus returns aggregate figures about the cluster. The
+// /public/status endpoint must be enabled in the contacted peer.
+func (c *Client) PublicStatus() (api.PublicStatus, error) {
+	var status api.PublicStatus
+	err := c.do("GET", "/public/status", nil, &status)
+	return status, err
+}
+
 // Peers requests ID information for all cluster peers.
 func (c *Client) Peers() ([]api.ID, error) {
 	var ids []api.IDSerial
@@ -31,6 +89,18 @@ func (c *Client) Peers() ([]api.ID, error) {
 	return result, err
 }
 
+// IPFSLocalPins lists the items pinned by the IPFS daemon of the cluster
+// peer, indicating whether cluster tracks them.
+func (c *Client) IPFSLocalPins() ([]api.LocalPin, error) {
+	var localPins []api.LocalPinSerial
+	err := c.do("GET", "/ipfs/pins/local", nil, &localPins)
+	result := make([]api.LocalPin, len(localPins))
+	for i, lp := range localPins {
+		result[i] = lp.ToLocalPin()
+	}
+	return result, err
+}
+
 type peerAddBody struct {
 	Addr string `json:"peer_multiaddress"`
 }
@@ -54,23 +124,327 @@ func (c *Client) PeerRm(id peer.ID) error {
 	return c.do("DELETE", fmt.Sprintf("/peers/%s", id.Pretty()), nil, nil)
 }
 
+// PeerRemoval returns the progress of the last removal of a peer
+// started by the contacted cluster peer.
+func (c *Client) PeerRemoval(id peer.ID) (api.PeerRemoval, error) {
+	var pr api.PeerRemovalSerial
+	err := c.do("GET", fmt.Sprintf("/peers/%s/removal", id.Pretty()), nil, &pr)
+	return pr.ToPeerRemoval(), err
+}
+
+// PeerMaintenance sets or unsets the maintenance mode for a peer.
+func (c *Client) PeerMaintenance(id peer.ID, enabled bool) error {
+	return c.do("POST", fmt.Sprintf("/peers/%s/maintenance?enabled=%t", id.Pretty(), enabled), nil, nil)
+}
+
+// MaintenancePeers returns the peers which are in maintenance mode.
+func (c *Client) MaintenancePeers() ([]peer.ID, error) {
+	var peers []string
+	err := c.do("GET", "/peers/maintenance", nil, &peers)
+	return api.StringsToPeers(peers), err
+}
+
 // Pin tracks a Cid with the given replication factor and a name for
 // human-friendliness.
 func (c *Client) Pin(ci *cid.Cid, replicationFactor int, name string) error {
+	return c.pin(ci, replicationFactor, name, false)
+}
+
+// PinWait works like Pin, but it only returns once the Cid is pinned in
+// as many peers as it is allocated to (or in every peer when it is pinned
+// everywhere), with its status. It fails when any of those peers cannot
+// pin it, or when the timeout expires first. A 0 timeout means half the
+// write timeout of the API. It must be shorter than the client Timeout.
+func (c *Client) PinWait(ci *cid.Cid, replicationFactor int, name string, timeout time.Duration) (api.GlobalPinInfo, error) {
+	path := fmt.Sprintf("/pins/%s?replication_factor=%d&name=%s&wait=true",
+		ci.String(),
+		replicationFactor,
+		url.QueryEscape(name))
+	if timeout > 0 {
+		path += "&wait-timeout=" + timeout.String()
+	}
+	var gpi api.GlobalPinInfoSerial
+	err := c.doIdempotent("POST", path, nil, &gpi)
+	return gpi.ToGlobalPinInfo(), err
+}
+
+// PinBatch tracks several Cids with the given options (replication
+// factor, name...) at once. They are committed to the shared state in
+// a few consensus operations, which is much faster than pinning them
+// one by one. When it fails, some of the first pins may have been
+// committed anyway: the "committed" detail of the returned *api.Error
+// tells how many.
+func (c *Client) PinBatch(pins []api.Pin) error {
+	serials := make([]api.PinSerial, len(pins), len(pins))
+	for i, p := range pins {
+		serials[i] = p.ToSerial()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(serials)
+
+	return c.doIdempotent("POST", "/pins", buf.Bytes(), nil)
+}
+
+// Batch pins and unpins several Cids at once. Unlike PinBatch, the items
+// which fail do not prevent the rest from being committed: the outcome of
+// every item is returned, in the same order.
+func (c *Client) Batch(items []api.BatchItem) ([]api.BatchResult, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range items {
+		enc.Encode(item.ToSerial())
+	}
+
+	var results []api.BatchResult
+	err := c.doIdempotent("POST", "/pins/batch", buf.Bytes(), &results)
+	return results, err
+}
+
+// PinInline works like Pin, but the contacted peer fetches the block for
+// the Cid from its IPFS daemon and stores it inline in the shared state
+// along with the pin. This is only allowed for content smaller than the
+// cluster's inline_max_size.
+func (c *Client) PinInline(ci *cid.Cid, replicationFactor int, name string) error {
+	return c.pin(ci, replicationFactor, name, true)
+}
+
+// PinSharded pins a sharded dataset. ci is the root of the dataset and
+// shards are the roots of its shards. Every allocated peer tracks and
+// pins each shard independently, and reports the aggregated status of
+// the shards as the status of ci.
+func (c *Client) PinSharded(ci *cid.Cid, shards []*cid.Cid, replicationFactor int, name string) error {
+	shardStrs := make([]string, len(shards), len(shards))
+	for i, sh := range shards {
+		shardStrs[i] = sh.String()
+	}
+	escName := url.QueryEscape(name)
+	err := c.doIdempotent(
+		"POST",
+		fmt.Sprintf("/pins/%s?replication_factor=%d&name=%s&shards=%s",
+			ci.String(),
+			replicationFactor,
+			escName,
+			strings.Join(shardStrs, ",")),
+		nil, nil)
+	return err
+}
+
+// ResolveMultihash returns the Cid that the cluster would use for content
+// known only by its multihash. The contacted peer probes the possible
+// codecs in its IPFS daemon and defaults to dag-pb when the content is not
+// available.
+func (c *Client) ResolveMultihash(mh multihash.Multihash) (*cid.Cid, error) {
+	var resolved api.ResolvedMultihash
+	err := c.do("GET", fmt.Sprintf("/multihash/%s", mh.B58String()), nil, &resolved)
+	if err != nil {
+		return nil, err
+	}
+	return cid.Decode(resolved.Cid)
+}
+
+func (c *Client) pin(ci *cid.Cid, replicationFactor int, name string, inline bool) error {
 	escName := url.QueryEscape(name)
-	err := c.do(
+	err := c.doIdempotent(
 		"POST",
-		fmt.Sprintf("/pins/%s?replication_factor=%d&name=%s",
+		fmt.Sprintf("/pins/%s?replication_factor=%d&name=%s&inline=%t",
 			ci.String(),
 			replicationFactor,
-			escName),
+			escName,
+			inline),
 		nil, nil)
 	return err
 }
 
+// CopyPins copies the given pins, with all their options (name,
+// replication factor, type and shards, inline data, size, path...), from
+// the cluster behind this client to the cluster behind dst (i.e. to
+// promote content from a staging cluster to a production one).
+// Allocations are not copied: the destination cluster decides them.
+//
+// The pins are added to the given namespace of the destination cluster
+// or, when it is empty, to the namespace they have in this one.
+//
+// It returns the outcome of every Cid, in the same order. The Cids which
+// cannot be read from this cluster or pinned in dst have an Error. An
+// error is only returned when dst cannot be contacted.
+func (c *Client) CopyPins(dst *Client, cids []*cid.Cid, namespace string) ([]api.BatchResult, error) {
+	results := make([]api.BatchResult, len(cids), len(cids))
+	items := make([]api.BatchItem, 0, len(cids))
+	itemIdx := make([]int, 0, len(cids))
+	for i, ci := range cids {
+		results[i].Cid = ci.String()
+		pin, err := c.Allocation(ci)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		pin.Allocations = nil
+		pin.Origin = ""
+		pin.RequestID = ""
+		if namespace != "" {
+			pin.Namespace = namespace
+		}
+		items = append(items, api.BatchItem{Pin: pin})
+		itemIdx = append(itemIdx, i)
+	}
+
+	if len(items) == 0 {
+		return results, nil
+	}
+
+	copied, err := dst.Batch(items)
+	if err != nil {
+		return nil, err
+	}
+	for j, res := range copied {
+		results[itemIdx[j]] = res
+	}
+	return results, nil
+}
+
 // Unpin untracks a Cid from cluster.
 func (c *Client) Unpin(ci *cid.Cid) error {
-	return c.do("DELETE", fmt.Sprintf("/pins/%s", ci.String()), nil, nil)
+	return c.doIdempotent("DELETE", fmt.Sprintf("/pins/%s", ci.String()), nil, nil)
+}
+
+// PinPath resolves an IPFS or IPNS path (i.e. /ipns/example.com/data or
+// /ipfs/<cid>/subdir) to a Cid with the IPFS daemon of the peer and pins
+// it, recording the path. It returns the pin, with the resolved Cid.
+func (c *Client) PinPath(path string, replicationFactor int, name string) (api.Pin, error) {
+	var pin api.PinSerial
+	err := c.doIdempotent(
+		"POST",
+		fmt.Sprintf("/pins%s?replication_factor=%d&name=%s",
+			escapePath(path),
+			replicationFactor,
+			url.QueryEscape(name)),
+		nil, &pin)
+	return pin.ToPin(), err
+}
+
+// UnpinPath unpins the Cid that an IPFS or IPNS path currently resolves
+// to. It returns the unpinned item.
+func (c *Client) UnpinPath(path string) (api.Pin, error) {
+	var pin api.PinSerial
+	err := c.doIdempotent("DELETE", "/pins"+escapePath(path), nil, &pin)
+	return pin.ToPin(), err
+}
+
+// escapePath escapes the segments of an IPFS path for use in a URL.
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+// CancelPin stops an ongoing pin, removing the item from the cluster. It
+// fails when no peer is pinning the item.
+func (c *Client) CancelPin(ci *cid.Cid) error {
+	return c.do("POST", fmt.Sprintf("/pins/%s/cancel", ci.String()), nil, nil)
+}
+
+// Namespaces returns the namespaces in which pins can be added, including
+// the default one (with an empty name), with their replication factor,
+// quota and number of pins.
+func (c *Client) Namespaces() ([]api.Namespace, error) {
+	var nss []api.Namespace
+	err := c.do("GET", "/namespaces", nil, &nss)
+	return nss, err
+}
+
+// NamespacePins returns the pins in the given namespace.
+func (c *Client) NamespacePins(ns string) ([]api.Pin, error) {
+	var pins []api.PinSerial
+	err := c.do("GET", fmt.Sprintf("/namespaces/%s/pins", url.PathEscape(ns)), nil, &pins)
+	result := make([]api.Pin, len(pins))
+	for i, p := range pins {
+		result[i] = p.ToPin()
+	}
+	return result, err
+}
+
+// NamespacePin works like Pin, but adds the Cid to the given namespace.
+// A replication factor of 0 means the namespace default.
+func (c *Client) NamespacePin(ns string, ci *cid.Cid, replicationFactor int, name string) error {
+	return c.doIdempotent(
+		"POST",
+		fmt.Sprintf("/namespaces/%s/pins/%s?replication_factor=%d&name=%s",
+			url.PathEscape(ns),
+			ci.String(),
+			replicationFactor,
+			url.QueryEscape(name)),
+		nil, nil)
+}
+
+// NamespaceUnpin works like Unpin, but fails when the Cid is not pinned
+// in the given namespace.
+func (c *Client) NamespaceUnpin(ns string, ci *cid.Cid) error {
+	return c.doIdempotent("DELETE", fmt.Sprintf("/namespaces/%s/pins/%s", url.PathEscape(ns), ci.String()), nil, nil)
+}
+
+// NamespaceAllocation works like Allocation, but fails when the Cid is
+// not pinned in the given namespace.
+func (c *Client) NamespaceAllocation(ns string, ci *cid.Cid) (api.Pin, error) {
+	var pin api.PinSerial
+	err := c.do("GET", fmt.Sprintf("/namespaces/%s/pins/%s", url.PathEscape(ns), ci.String()), nil, &pin)
+	return pin.ToPin(), err
+}
+
+// PinLog returns the pin and unpin operations applied to the shared state
+// by the peer after the given sequence number, from oldest to newest.
+// It fails when the peer no longer remembers them or has restarted. The
+// full pinset should then be obtained with Allocations() before tailing
+// the log again.
+func (c *Client) PinLog(since uint64) ([]api.PinLogEntry, error) {
+	var serials []api.PinLogEntrySerial
+	err := c.do("GET", fmt.Sprintf("/pins/log?since=%d", since), nil, &serials)
+	entries := make([]api.PinLogEntry, len(serials), len(serials))
+	for i, s := range serials {
+		entries[i] = s.ToPinLogEntry()
+	}
+	return entries, err
+}
+
+// Events sends the events which happen in the peer after the given
+// sequence number (pin status changes, peers joining and leaving and
+// alerts) to the given channel, as they are received. Without a sequence
+// number (0), it starts with the events the peer remembers. The client
+// timeout does not apply. It returns when the server ends the stream
+// (i.e. when its write timeout expires), and can be called again with the
+// Seq of the last event received to resume. The channel is closed when
+// done.
+func (c *Client) Events(since uint64, out chan<- api.Event) error {
+	defer close(out)
+	resp, err := c.doStreamRequest("GET", fmt.Sprintf("/events?since=%d", since), nil)
+	if err != nil {
+		return &api.Error{Code: 0, Message: err.Error()}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return c.handleResponse(resp, nil)
+	}
+	defer resp.Body.Close()
+
+	// Every event is sent in a "data:" line, followed by an empty line.
+	// Other lines carry its id and type, which are in the data too, or
+	// are comments.
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var evs api.EventSerial
+		err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), &evs)
+		if err != nil {
+			return &api.Error{Code: resp.StatusCode, Message: err.Error()}
+		}
+		out <- evs.ToEvent()
+	}
+	if err := scanner.Err(); err != nil {
+		return &api.Error{Code: resp.StatusCode, Message: err.Error()}
+	}
+	return nil
 }
 
 // Allocations returns the consensus state listing all tracked items and
@@ -85,6 +459,18 @@ func (c *Client) Allocations() ([]api.Pin, error) {
 	return result, err
 }
 
+// AllocationsPage returns a page of the current allocations, selected
+// and sorted as given by the options.
+func (c *Client) AllocationsPage(opts ListOptions) ([]api.Pin, error) {
+	var pins []api.PinSerial
+	err := c.do("GET", "/allocations?"+opts.query().Encode(), nil, &pins)
+	result := make([]api.Pin, len(pins))
+	for i, p := range pins {
+		result[i] = p.ToPin()
+	}
+	return result, err
+}
+
 // Allocation returns the current allocations for a given Cid.
 func (c *Client) Allocation(ci *cid.Cid) (api.Pin, error) {
 	var pin api.PinSerial
@@ -92,6 +478,199 @@ func (c *Client) Allocation(ci *cid.Cid) (api.Pin, error) {
 	return pin.ToPin(), err
 }
 
+// DuplicatePins returns the groups of pins in the shared state which
+// reference the same content under different Cids.
+func (c *Client) DuplicatePins() ([]api.DuplicatePins, error) {
+	var dups []api.DuplicatePinsSerial
+	err := c.do("GET", "/allocations/duplicates", nil, &dups)
+	return toDuplicatePins(dups), err
+}
+
+// MergeDuplicatePins merges every group of duplicate pins into a single
+// pin which keeps the rest of Cids as aliases. It returns the merged groups.
+func (c *Client) MergeDuplicatePins() ([]api.DuplicatePins, error) {
+	var dups []api.DuplicatePinsSerial
+	err := c.do("POST", "/allocations/duplicates/merge", nil, &dups)
+	return toDuplicatePins(dups), err
+}
+
+// StateStats returns aggregated figures about the pins in the shared
+// state. Pin names are grouped by the part before the given delimiter
+// ("/" when empty).
+func (c *Client) StateStats(delimiter string) (api.StateStats, error) {
+	var stats api.StateStatsSerial
+	err := c.do("GET", fmt.Sprintf("/allocations/stats?delimiter=%s", url.QueryEscape(delimiter)), nil, &stats)
+	return stats.ToStateStats(), err
+}
+
+func toDuplicatePins(dups []api.DuplicatePinsSerial) []api.DuplicatePins {
+	result := make([]api.DuplicatePins, len(dups))
+	for i, d := range dups {
+		result[i] = d.ToDuplicatePins()
+	}
+	return result
+}
+
+// AllocationHistory returns the allocation decisions made for a Cid, sorted
+// by time. If local is true, only decisions made by the contacted peer are
+// returned.
+func (c *Client) AllocationHistory(ci *cid.Cid, local bool) ([]api.AllocationRecord, error) {
+	var records []api.AllocationRecordSerial
+	err := c.do("GET", fmt.Sprintf("/allocations/%s/history?local=%t", ci.String(), local), nil, &records)
+	result := make([]api.AllocationRecord, len(records))
+	for i, r := range records {
+		result[i] = r.ToAllocationRecord()
+	}
+	return result, err
+}
+
+// AllocationDecisions returns every allocation decision remembered by the
+// cluster peers, sorted by time, including the peers considered and the
+// reasons why some were excluded. If local is true, only decisions made by
+// the contacted peer are returned.
+func (c *Client) AllocationDecisions(local bool) ([]api.AllocationRecord, error) {
+	var records []api.AllocationRecordSerial
+	err := c.do("GET", fmt.Sprintf("/allocations/decisions?local=%t", local), nil, &records)
+	result := make([]api.AllocationRecord, len(records))
+	for i, r := range records {
+		result[i] = r.ToAllocationRecord()
+	}
+	return result, err
+}
+
+// AllocationPreview returns the Pin, with allocations, that would result
+// from pinning a Cid with the given replication factors, without actually
+// pinning anything.
+func (c *Client) AllocationPreview(ci *cid.Cid, rplMin, rplMax int) (api.Pin, error) {
+	args := api.AllocationPreviewSerial{
+		Cid:                  ci.String(),
+		ReplicationFactorMin: rplMin,
+		ReplicationFactorMax: rplMax,
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(args)
+
+	var pin api.PinSerial
+	err := c.do("POST", "/allocations/preview", &buf, &pin)
+	return pin.ToPin(), err
+}
+
+// SimulateAllocations returns the allocations that would be decided for
+// the given pins and the projected load on every peer, without actually
+// pinning anything.
+func (c *Client) SimulateAllocations(pins []api.Pin) (api.AllocationSimulation, error) {
+	serials := make([]api.PinSerial, len(pins), len(pins))
+	for i, p := range pins {
+		serials[i] = p.ToSerial()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(serials)
+
+	var sim api.AllocationSimulationSerial
+	err := c.do("POST", "/allocations/simulate", &buf, &sim)
+	return sim.ToAllocationSimulation(), err
+}
+
+// SetLogLevel sets the logging level for the given component (logging
+// facility) in the cluster peer. When allPeers is true, the change is
+// applied in all cluster peers.
+func (c *Client) SetLogLevel(component, level string, allPeers bool) error {
+	body := api.LogLevel{
+		Component: component,
+		Level:     level,
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(body)
+
+	return c.do("POST", fmt.Sprintf("/log/level?all_peers=%t", allPeers), &buf, nil)
+}
+
+// Snapshot makes the cluster peer persist the shared state and compact
+// its consensus log now.
+func (c *Client) Snapshot() error {
+	return c.do("POST", "/consensus/snapshot", nil, nil)
+}
+
+// ConsensusStatus returns the internals of the consensus component of
+// every cluster peer, or only of the contacted one when local is true.
+func (c *Client) ConsensusStatus(local bool) ([]api.ConsensusStatus, error) {
+	var serials []api.ConsensusStatusSerial
+	err := c.do("GET", fmt.Sprintf("/consensus/status?local=%t", local), nil, &serials)
+	statuses := make([]api.ConsensusStatus, len(serials), len(serials))
+	for i, s := range serials {
+		statuses[i] = s.ToConsensusStatus()
+	}
+	return statuses, err
+}
+
+// StateVerify compares the shared state of every cluster peer with the
+// leader's and returns how each of them differs.
+func (c *Client) StateVerify() ([]api.StateDiff, error) {
+	var serials []api.StateDiffSerial
+	err := c.do("GET", "/state/verify", nil, &serials)
+	diffs := make([]api.StateDiff, len(serials), len(serials))
+	for i, s := range serials {
+		diffs[i] = s.ToStateDiff()
+	}
+	return diffs, err
+}
+
+// SetAllocationStrategy changes the allocation strategy (i.e. "numpin"
+// or "disk-freespace") used by the cluster peer, without restarting it.
+// When allPeers is true, the change is applied in all cluster peers.
+func (c *Client) SetAllocationStrategy(name string, allPeers bool) error {
+	body := api.AllocationStrategy{
+		Name: name,
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(body)
+
+	return c.do("POST", fmt.Sprintf("/allocations/strategy?all_peers=%t", allPeers), &buf, nil)
+}
+
+// SetRuntimeConfig changes configuration options which can be tuned
+// without restarting the cluster peer (i.e. "maptracker.concurrent_pins").
+// The changes are saved to the peer's configuration. When allPeers is
+// true, they are applied in all cluster peers.
+func (c *Client) SetRuntimeConfig(rc api.RuntimeConfig, allPeers bool) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(rc)
+
+	return c.do("POST", fmt.Sprintf("/config/runtime?all_peers=%t", allPeers), &buf, nil)
+}
+
+// RPCCall performs a raw RPC call to the given method on the given peer
+// (or on the contacted peer, if pid is empty). The arguments are provided,
+// and the response returned, as JSON. The endpoint must be enabled in the
+// cluster peer's configuration.
+func (c *Client) RPCCall(pid peer.ID, service, method string, args []byte) ([]byte, error) {
+	body := api.RPCCallSerial{
+		Service: service,
+		Method:  method,
+		Args:    args,
+	}
+	if pid != "" {
+		body.Peer = pid.Pretty()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(body)
+
+	var res json.RawMessage
+	err := c.do("POST", "/rpc", &buf, &res)
+	return res, err
+}
+
 // Status returns the current ipfs state for a given Cid. If local is true,
 // the information affects only the current peer, otherwise the information
 // is fetched from all cluster peers.
@@ -101,10 +680,11 @@ func (c *Client) Status(ci *cid.Cid, local bool) (api.GlobalPinInfo, error) {
 	return gpi.ToGlobalPinInfo(), err
 }
 
-// StatusAll gathers Status() for all tracked items.
-func (c *Client) StatusAll(local bool) ([]api.GlobalPinInfo, error) {
+// StatusAll gathers Status() for all tracked items. Only items whose
+// status matches the filter are returned. An empty filter selects all.
+func (c *Client) StatusAll(filter api.StatusFilter, local bool) ([]api.GlobalPinInfo, error) {
 	var gpis []api.GlobalPinInfoSerial
-	err := c.do("GET", fmt.Sprintf("/pins?local=%t", local), nil, &gpis)
+	err := c.do("GET", statusAllPath("/pins", filter, local), nil, &gpis)
 	result := make([]api.GlobalPinInfo, len(gpis))
 	for i, p := range gpis {
 		result[i] = p.ToGlobalPinInfo()
@@ -112,6 +692,67 @@ func (c *Client) StatusAll(local bool) ([]api.GlobalPinInfo, error) {
 	return result, err
 }
 
+// PinSummary counts the status of all tracked items, or of those whose
+// status matches the filter, by status and by peer. It is much cheaper
+// than fetching it with StatusAll.
+func (c *Client) PinSummary(filter api.StatusFilter, local bool) (api.PinSummary, error) {
+	var summary api.PinSummarySerial
+	err := c.do("GET", statusAllPath("/pins/summary", filter, local), nil, &summary)
+	return summary.ToPinSummary(), err
+}
+
+// StatusAllPage works like StatusAll, but only returns the page of the
+// items selected and sorted as given by the options.
+func (c *Client) StatusAllPage(filter api.StatusFilter, local bool, opts ListOptions) ([]api.GlobalPinInfo, error) {
+	var gpis []api.GlobalPinInfoSerial
+	path := statusAllPath("/pins", filter, local)
+	if q := opts.query().Encode(); q != "" {
+		path += "&" + q
+	}
+	err := c.do("GET", path, nil, &gpis)
+	result := make([]api.GlobalPinInfo, len(gpis))
+	for i, p := range gpis {
+		result[i] = p.ToGlobalPinInfo()
+	}
+	return result, err
+}
+
+// StatusAllStream works like StatusAll, but sends the items to the given
+// channel as they are received, so that very large pinsets are not held
+// in memory. The channel is closed when done.
+func (c *Client) StatusAllStream(filter api.StatusFilter, local bool, out chan<- api.GlobalPinInfo) error {
+	defer close(out)
+	resp, err := c.doRequest("GET", statusAllPath("/pins", filter, local), nil)
+	if err != nil {
+		return &api.Error{Code: 0, Message: err.Error()}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return c.handleResponse(resp, nil)
+	}
+	defer resp.Body.Close()
+
+	decodeErr := func(err error) error {
+		return &api.Error{Code: resp.StatusCode, Message: err.Error()}
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	if _, err := dec.Token(); err != nil { // [
+		return decodeErr(err)
+	}
+	for dec.More() {
+		var gpi api.GlobalPinInfoSerial
+		if err := dec.Decode(&gpi); err != nil {
+			return decodeErr(err)
+		}
+		out <- gpi.ToGlobalPinInfo()
+	}
+	// a missing ] means the stream was cut short
+	if _, err := dec.Token(); err != nil {
+		return decodeErr(err)
+	}
+	return nil
+}
+
 // Sync makes sure the state of a Cid corresponds to the state reported by
 // the ipfs daemon, and returns it. If local is true, this operation only
 // happens on the current peer, otherwise it happens on every cluster peer.
@@ -146,10 +787,10 @@ func (c *Client) Recover(ci *cid.Cid, local bool) (api.GlobalPinInfo, error) {
 
 // RecoverAll triggers Recover() operations on all tracked items. If local is
 // true, the operation is limited to the current peer. Otherwise, it happens
-// everywhere.
-func (c *Client) RecoverAll(local bool) ([]api.GlobalPinInfo, error) {
+// everywhere. A non-empty filter limits it to the items with those statuses.
+func (c *Client) RecoverAll(filter api.StatusFilter, local bool) ([]api.GlobalPinInfo, error) {
 	var gpis []api.GlobalPinInfoSerial
-	err := c.do("POST", fmt.Sprintf("/pins/recover?local=%t", local), nil, &gpis)
+	err := c.do("POST", statusAllPath("/pins/recover", filter, local), nil, &gpis)
 	result := make([]api.GlobalPinInfo, len(gpis))
 	for i, p := range gpis {
 		result[i] = p.ToGlobalPinInfo()
@@ -157,9 +798,69 @@ func (c *Client) RecoverAll(local bool) ([]api.GlobalPinInfo, error) {
 	return result, err
 }
 
+// ListOptions select a page of a pin listing (AllocationsPage and
+// StatusAllPage). Items are sorted by Sort: "cid", "name" or, for the
+// status only, "ts" (most recently updated first). Both are sorted by
+// Cid by default. Items up to Cursor (which implies sorting by Cid) and
+// the first Offset of the rest are skipped, and at most Limit are
+// returned (0 means no limit). The Cid of the last item in a page is the
+// cursor for the next one.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	Cursor *cid.Cid
+	Sort   string
+}
+
+func (opts ListOptions) query() url.Values {
+	q := url.Values{}
+	if opts.Limit > 0 {
+		q.Set("limit", fmt.Sprintf("%d", opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", fmt.Sprintf("%d", opts.Offset))
+	}
+	if opts.Cursor != nil {
+		q.Set("cursor", opts.Cursor.String())
+	}
+	if opts.Sort != "" {
+		q.Set("sort", opts.Sort)
+	}
+	return q
+}
+
+func statusAllPath(path string, filter api.StatusFilter, local bool) string {
+	path = fmt.Sprintf("%s?local=%t", path, local)
+	if len(filter) > 0 {
+		path += "&filter=" + url.QueryEscape(filter.String())
+	}
+	return path
+}
+
+// ScalingAdvice returns a recommendation to add or remove cluster peers
+// based on the capacity pressure observed on the current ones.
+func (c *Client) ScalingAdvice() (api.ScalingAdvice, error) {
+	var adv api.ScalingAdviceSerial
+	err := c.do("GET", "/scaling", nil, &adv)
+	return adv.ToScalingAdvice(), err
+}
+
 // Version returns the ipfs-cluster peer's version.
 func (c *Client) Version() (api.Version, error) {
 	var ver api.Version
 	err := c.do("GET", "/version", nil, &ver)
 	return ver, err
 }
+
+// Spec returns the OpenAPI specification of the REST API served by the
+// peer, as a JSON document.
+func (c *Client) Spec() (json.RawMessage, error) {
+	var spec json.RawMessage
+	path := "/spec"
+	if c.versionPrefix() == "" {
+		// peers serving unversioned routes only
+		path = "/api/v0/spec"
+	}
+	err := c.do("GET", path, nil, &spec)
+	return spec, err
+}
@@ -1,11 +1,18 @@
 package client
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	cid "github.com/ipfs/go-cid"
 	ma "github.com/multiformats/go-multiaddr"
 
+	types "github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/test"
 )
 
@@ -32,6 +39,108 @@ func TestID(t *testing.T) {
 	}
 }
 
+func TestHealth(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+	health, err := c.Health()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != types.PeerHealthOK {
+		t.Error("expected ok health")
+	}
+}
+
+func TestSyncStatus(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+	status, err := c.SyncStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State.Interval != time.Minute || status.State.Last.IsZero() {
+		t.Error("unexpected state sync info:", status.State)
+	}
+	if status.IPFS.Interval != 2*time.Minute || !status.IPFS.Last.IsZero() {
+		t.Error("unexpected ipfs sync info:", status.IPFS)
+	}
+}
+
+func TestConnectGraph(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+	graph, err := c.ConnectGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graph.ClusterID != test.TestPeerID1 {
+		t.Error("expected correct cluster ID")
+	}
+	if len(graph.ClusterLinks) != 2 || len(graph.IPFSLinks) != 2 {
+		t.Error("unexpected links:", graph)
+	}
+	if graph.ClustertoIPFS[test.TestPeerID1] != test.TestPeerID4 {
+		t.Error("unexpected ipfs daemons:", graph.ClustertoIPFS)
+	}
+}
+
+func TestPeersLiveness(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+	lives, err := c.PeersLiveness()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lives) != 2 {
+		t.Fatal("expected the liveness of 2 peers")
+	}
+	if !lives[0].Alive || lives[0].RTT != time.Millisecond {
+		t.Error("unexpected liveness:", lives[0])
+	}
+	if lives[1].Peer != test.TestPeerID2 || lives[1].Error == "" {
+		t.Error("expected an unreachable peer:", lives[1])
+	}
+}
+
+func TestTrackerMetrics(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+	metrics, err := c.TrackerMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Pins != 10 || metrics.AvgPinLatency != time.Second {
+		t.Error("unexpected tracker metrics:", metrics)
+	}
+}
+
+func TestPublicStatus(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+	status, err := c.PublicStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Peers != 3 || status.TotalSize != 6000 {
+		t.Error("unexpected public status:", status)
+	}
+}
+
+func TestIPFSLocalPins(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+	localPins, err := c.IPFSLocalPins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(localPins) != 2 {
+		t.Fatal("expected 2 local pins")
+	}
+	if localPins[0].Cid.String() != test.TestCid1 || !localPins[0].Allocated {
+		t.Error("expected an allocated pin")
+	}
+}
+
 func TestPeers(t *testing.T) {
 	c, api := testClient(t)
 	defer api.Shutdown()
@@ -82,6 +191,42 @@ func TestPeerRm(t *testing.T) {
 	}
 }
 
+func TestPeerRemoval(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	pr, err := c.PeerRemoval(test.TestPeerID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Peer != test.TestPeerID1 || pr.Reallocated != 2 {
+		t.Error("unexpected peer removal")
+	}
+}
+
+func TestPeerMaintenance(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	err := c.PeerMaintenance(test.TestPeerID1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaintenancePeers(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	peers, err := c.MaintenancePeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0] != test.TestPeerID1 {
+		t.Error("expected one peer in maintenance")
+	}
+}
+
 func TestPin(t *testing.T) {
 	c, api := testClient(t)
 	defer api.Shutdown()
@@ -93,6 +238,146 @@ func TestPin(t *testing.T) {
 	}
 }
 
+func TestPinWait(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	gpi, err := c.PinWait(ci, 0, "hello", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gpi.Cid.Equals(ci) || gpi.PeerMap[test.TestPeerID1].Status != types.TrackerStatusPinned {
+		t.Error("expected the status of the pinned item:", gpi)
+	}
+}
+
+func TestPinBatch(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	ci2, _ := cid.Decode(test.TestCid2)
+	err := c.PinBatch([]types.Pin{types.PinCid(ci), types.PinCid(ci2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	ci2, _ := cid.Decode(test.TestCid2)
+	ci3, _ := cid.Decode(test.ErrorCid)
+	results, err := c.Batch([]types.BatchItem{
+		{Pin: types.PinCid(ci)},
+		{Pin: types.PinCid(ci2), Unpin: true},
+		{Pin: types.PinCid(ci3)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatal("expected a result for every item")
+	}
+	if results[0].Error != "" || !results[1].Unpin || results[1].Error != "" {
+		t.Error("the first items should have worked:", results)
+	}
+	if results[2].Error == "" {
+		t.Error("the last item should have failed")
+	}
+}
+
+func TestPinPath(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	pin, err := c.PinPath(test.TestPath, 2, "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Cid.String() != test.TestCid1 || pin.Path != test.TestPath {
+		t.Error("expected the resolved pin:", pin)
+	}
+
+	pin, err = c.UnpinPath(test.TestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Cid.String() != test.TestCid1 {
+		t.Error("expected the resolved pin:", pin)
+	}
+
+	_, err = c.PinPath("/ipns/unknown.example.com", 0, "")
+	if err == nil {
+		t.Error("expected an error resolving the path")
+	}
+}
+
+func TestPinSharded(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	sh1, _ := cid.Decode(test.TestCid2)
+	sh2, _ := cid.Decode(test.TestCid3)
+	err := c.PinSharded(ci, []*cid.Cid{sh1, sh2}, 7, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinAllocationError(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.AllocErrorCid)
+	err := c.Pin(ci, 2, "")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	apiErr, ok := err.(*types.Error)
+	if !ok {
+		t.Fatal("expected an *api.Error")
+	}
+	if apiErr.Details[test.TestPeerID3.Pretty()] != "invalid or expired metric" {
+		t.Error("expected the discarded candidates:", apiErr.Details)
+	}
+}
+
+func TestResolveMultihash(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	resolved, err := c.ResolveMultihash(c1.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.String() != test.TestCid1 {
+		t.Error("expected the CIDv0 for the multihash")
+	}
+}
+
+func TestPinInline(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestInlineCid)
+	err := c.PinInline(ci, 1, "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ci, _ = cid.Decode(test.TestCid1)
+	err = c.PinInline(ci, 1, "")
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
 func TestUnpin(t *testing.T) {
 	c, api := testClient(t)
 	defer api.Shutdown()
@@ -104,6 +389,50 @@ func TestUnpin(t *testing.T) {
 	}
 }
 
+func TestCancelPin(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.SlowCid1)
+	err := c.CancelPin(ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ci, _ = cid.Decode(test.TestCid1)
+	err = c.CancelPin(ci)
+	if err == nil {
+		t.Error("expected an error when the item is not being pinned")
+	}
+}
+
+func TestCopyPins(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	ci2, _ := cid.Decode(test.ErrorCid)
+	ci3, _ := cid.Decode(test.TestCid2)
+	results, err := c.CopyPins(c, []*cid.Cid{ci, ci2, ci3}, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatal("expected one result per cid:", results)
+	}
+	for i, ci := range []*cid.Cid{ci, ci2, ci3} {
+		if results[i].Cid != ci.String() {
+			t.Errorf("unexpected result order: %+v", results)
+		}
+	}
+	if results[0].Error != "" || results[2].Error != "" {
+		t.Error("expected the pins to be copied:", results)
+	}
+	if results[1].Error == "" {
+		t.Error("expected an error for the pin which cannot be read")
+	}
+}
+
 func TestAllocations(t *testing.T) {
 	c, api := testClient(t)
 	defer api.Shutdown()
@@ -117,6 +446,129 @@ func TestAllocations(t *testing.T) {
 	}
 }
 
+func TestEvents(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	out := make(chan types.Event, 10)
+	go c.Events(0, out)
+	var evs []types.Event
+	for ev := range out {
+		evs = append(evs, ev)
+		if len(evs) == 2 {
+			// the stream only ends with the server
+			go api.Shutdown()
+		}
+	}
+	if len(evs) != 2 ||
+		evs[0].Type != types.EventPinStatus ||
+		evs[0].PinEvent == nil ||
+		evs[1].Peer != test.TestPeerID2 {
+		t.Error("unexpected events:", evs)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	dir, err := ioutil.TempDir("", "cluster-client-add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "testfile"), []byte("abc"), 0644)
+
+	added, err := c.Add([]string{dir}, types.AddParams{RawLeaves: true}, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0].Cid.String() != test.TestCid1 {
+		t.Error("unexpected added items:", added)
+	}
+
+	_, err = c.Add([]string{filepath.Join(dir, "nonexistent")}, types.AddParams{}, 0, "")
+	if err == nil {
+		t.Error("expected an error adding a missing file")
+	}
+}
+
+func TestAllocationsPage(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	cursor, _ := cid.Decode(test.TestCid2)
+	pins, err := c.AllocationsPage(ListOptions{Limit: 1, Cursor: cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Cid.String() != test.TestCid3 {
+		t.Error("unexpected page:", pins)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	nss, err := c.Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nss) != 2 || nss[1].Name != "team-a" {
+		t.Error("unexpected namespaces:", nss)
+	}
+
+	pins, err := c.NamespacePins("team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Namespace != "team-a" {
+		t.Error("unexpected namespace pins:", pins)
+	}
+
+	ci, _ := cid.Decode(test.TestCid1)
+	pin, err := c.NamespaceAllocation("team-a", ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pin.Cid.Equals(ci) || pin.Namespace != "team-a" {
+		t.Error("unexpected namespace pin:", pin)
+	}
+
+	err = c.NamespacePin("team-a", ci, 0, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.NamespaceUnpin("team-a", ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.NamespaceUnpin("team-b", ci)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestPinLog(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	entries, err := c.PinLog(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Seq != 2 || !entries[0].Pin.Cid.Equals(ci) {
+		t.Error("unexpected pin log:", entries)
+	}
+
+	_, err = c.PinLog(5)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
 func TestAllocation(t *testing.T) {
 	c, api := testClient(t)
 	defer api.Shutdown()
@@ -131,6 +583,243 @@ func TestAllocation(t *testing.T) {
 	}
 }
 
+func TestDuplicatePins(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	dups, err := c.DuplicatePins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dups) != 1 || len(dups[0].Pins) != 2 ||
+		dups[0].Pins[1].Cid.String() != test.TestCid1V1 {
+		t.Error("unexpected duplicates")
+	}
+
+	dups, err = c.MergeDuplicatePins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dups) != 1 {
+		t.Error("expected one merged group")
+	}
+}
+
+func TestStateStats(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	stats, err := c.StateStats("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pins != 3 || stats.ByNamePrefix["-"] != 3 {
+		t.Error("unexpected stats")
+	}
+}
+
+func TestScalingAdvice(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	adv, err := c.ScalingAdvice()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adv.Action != "add_peers" || adv.Peers != 1 {
+		t.Error("unexpected scaling advice:", adv)
+	}
+	if len(adv.Pressure) != 1 || adv.Pressure[0].Peer != test.TestPeerID1 {
+		t.Error("expected pressure on one peer")
+	}
+}
+
+func TestAllocationHistory(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	records, err := c.AllocationHistory(ci, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Cid.String() != test.TestCid1 {
+		t.Fatal("expected one allocation record")
+	}
+	if len(records[0].Allocations) != 2 {
+		t.Error("expected 2 allocations")
+	}
+}
+
+func TestAllocationDecisions(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	records, err := c.AllocationDecisions(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Cid.String() != test.TestCid1 {
+		t.Fatal("expected one allocation record")
+	}
+	if len(records[0].Considered) != 2 || records[0].Vetoes[test.TestPeerID2] == "" {
+		t.Error("expected considered peers and vetoes")
+	}
+}
+
+func TestAllocationPreview(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	pin, err := c.AllocationPreview(ci, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Cid.String() != test.TestCid1 {
+		t.Error("should be same pin")
+	}
+	if len(pin.Allocations) != 2 {
+		t.Error("expected 2 allocations")
+	}
+}
+
+func TestSimulateAllocations(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	ci, _ := cid.Decode(test.TestCid1)
+	ci2, _ := cid.Decode(test.TestCid2)
+	sim, err := c.SimulateAllocations([]types.Pin{types.PinCid(ci), types.PinCid(ci2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sim.Records) != 2 || sim.Records[0].Cid.String() != test.TestCid1 {
+		t.Error("expected a record for each pin")
+	}
+	if len(sim.Load) != 1 || sim.Load[0].Added != 2 {
+		t.Error("expected 2 pins added to the peer load")
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	err := c.SetLogLevel("cluster", "debug", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetLogLevel("cluster", "debug", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetLogLevel("", "debug", false)
+	if err == nil {
+		t.Error("expected an error without component")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsensusStatus(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	statuses, err := c.ConsensusStatus(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[1].Peer != test.TestPeerID2 || statuses[1].Lag != 3 {
+		t.Error("unexpected consensus status")
+	}
+
+	statuses, err = c.ConsensusStatus(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Leader != test.TestPeerID1 {
+		t.Error("unexpected local consensus status")
+	}
+}
+
+func TestStateVerify(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	diffs, err := c.StateVerify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].Diverged() || !diffs[1].Diverged() {
+		t.Fatal("unexpected state diffs")
+	}
+	if len(diffs[1].Missing) != 1 || diffs[1].Missing[0].String() != test.TestCid3 {
+		t.Error("expected a missing item")
+	}
+}
+
+func TestSetAllocationStrategy(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	err := c.SetAllocationStrategy("numpin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetAllocationStrategy("disk-freespace", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetAllocationStrategy("abc", false)
+	if err == nil {
+		t.Error("expected an error with an unknown strategy")
+	}
+}
+
+func TestSetRuntimeConfig(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	rc := types.RuntimeConfig{
+		"maptracker.concurrent_pins": json.RawMessage("4"),
+	}
+	err := c.SetRuntimeConfig(rc, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetRuntimeConfig(rc, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc = types.RuntimeConfig{
+		"cluster.secret": json.RawMessage(`"abc"`),
+	}
+	err = c.SetRuntimeConfig(rc, false)
+	if err == nil {
+		t.Error("expected an error with an option which is not runtime-tunable")
+	}
+}
+
+func TestRPCCall(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	_, err := c.RPCCall(test.TestPeerID1, "Cluster", "Version", nil)
+	if err == nil {
+		t.Error("expected an error as rpc calls are disabled by default")
+	}
+}
+
 func TestStatus(t *testing.T) {
 	c, api := testClient(t)
 	defer api.Shutdown()
@@ -149,7 +838,7 @@ func TestStatusAll(t *testing.T) {
 	c, api := testClient(t)
 	defer api.Shutdown()
 
-	pins, err := c.StatusAll(false)
+	pins, err := c.StatusAll(nil, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -157,6 +846,62 @@ func TestStatusAll(t *testing.T) {
 	if len(pins) == 0 {
 		t.Error("there should be some pins")
 	}
+
+	pins, err = c.StatusAll(types.StatusFilter{types.TrackerStatusPinError}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Cid.String() != test.TestCid3 {
+		t.Error("expected only the item in error")
+	}
+}
+
+func TestPinSummary(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	summary, err := c.PinSummary(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Pins != 3 || summary.ByStatus[types.TrackerStatusPinning] != 1 {
+		t.Error("unexpected summary: ", summary)
+	}
+	if pps := summary.ByPeer[test.TestPeerID1]; pps.Pinned != 1 || pps.Error != 1 {
+		t.Error("unexpected peer summary: ", pps)
+	}
+}
+
+func TestStatusAllPage(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	pins, err := c.StatusAllPage(nil, false, ListOptions{Offset: 2, Sort: "cid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Cid.String() != test.TestCid1 {
+		t.Error("unexpected page:", pins)
+	}
+}
+
+func TestStatusAllStream(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	out := make(chan types.GlobalPinInfo, 10)
+	err := c.StatusAllStream(nil, false, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for range out {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("expected 3 items and got %d", n)
+	}
 }
 
 func TestSync(t *testing.T) {
@@ -205,8 +950,114 @@ func TestRecoverAll(t *testing.T) {
 	c, api := testClient(t)
 	defer api.Shutdown()
 
-	_, err := c.RecoverAll(true)
+	_, err := c.RecoverAll(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gpis, err := c.RecoverAll(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gpis) != 3 {
+		t.Error("expected the recovered items of every peer")
+	}
+}
+
+// specOperations maps every operation in the OpenAPI specification of the
+// REST API to the client method which implements it.
+var specOperations = map[string]string{
+	"ID":                  "ID",
+	"Version":             "Version",
+	"Health":              "Health",
+	"SyncStatus":          "SyncStatus",
+	"HealthGraph":         "ConnectGraph",
+	"PeersHealth":         "PeersLiveness",
+	"TrackerMetrics":      "TrackerMetrics",
+	"PublicStatus":        "PublicStatus",
+	"IPFSLocalPins":       "IPFSLocalPins",
+	"Peers":               "Peers",
+	"PeerAdd":             "PeerAdd",
+	"PeerRemove":          "PeerRm",
+	"PeerRemoval":         "PeerRemoval",
+	"MaintenancePeers":    "MaintenancePeers",
+	"PeerMaintenance":     "PeerMaintenance",
+	"ResolveMultihash":    "ResolveMultihash",
+	"Allocations":         "AllocationsPage",
+	"DuplicatePins":       "DuplicatePins",
+	"MergeDuplicatePins":  "MergeDuplicatePins",
+	"StateStats":          "StateStats",
+	"AllocationDecisions": "AllocationDecisions",
+	"Allocation":          "Allocation",
+	"AllocationHistory":   "AllocationHistory",
+	"AllocationPreview":   "AllocationPreview",
+	"SimulateAllocations": "SimulateAllocations",
+	"StatusAll":           "StatusAllPage",
+	"PinBatch":            "PinBatch",
+	"Batch":               "Batch",
+	"PinPath":             "PinPath",
+	"UnpinPath":           "UnpinPath",
+	"SyncAll":             "SyncAll",
+	"RecoverAll":          "RecoverAll",
+	"PinLog":              "PinLog",
+	"Events":              "Events",
+	"PinSummary":          "PinSummary",
+	"Status":              "Status",
+	"Add":                 "Add",
+	"Pin":                 "Pin",
+	"Unpin":               "Unpin",
+	"Sync":                "Sync",
+	"Recover":             "Recover",
+	"CancelPin":           "CancelPin",
+	"ScalingAdvice":       "ScalingAdvice",
+	"LogLevel":            "SetLogLevel",
+	"Snapshot":            "Snapshot",
+	"ConsensusStatus":     "ConsensusStatus",
+	"StateVerify":         "StateVerify",
+	"Namespaces":          "Namespaces",
+	"NamespacePins":       "NamespacePins",
+	"NamespacePin":        "NamespacePin",
+	"NamespaceUnpin":      "NamespaceUnpin",
+	"NamespaceAllocation": "NamespaceAllocation",
+	"AllocationStrategy":  "SetAllocationStrategy",
+	"RuntimeConfig":       "SetRuntimeConfig",
+	"RPCCall":             "RPCCall",
+	"Spec":                "Spec",
+}
+
+// TestSpec checks that the client implements every operation in the
+// specification of the API.
+func TestSpec(t *testing.T) {
+	c, api := testClient(t)
+	defer api.Shutdown()
+
+	raw, err := c.Spec()
 	if err != nil {
 		t.Fatal(err)
 	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Paths) == 0 {
+		t.Fatal("the spec has no paths")
+	}
+
+	clientType := reflect.TypeOf(c)
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			name, ok := specOperations[op.OperationID]
+			if !ok {
+				t.Errorf("%s %s (%s) is not implemented by the client", method, path, op.OperationID)
+				continue
+			}
+			if _, ok := clientType.MethodByName(name); !ok {
+				t.Errorf("the client has no %s method", name)
+			}
+		}
+	}
 }
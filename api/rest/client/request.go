@@ -1,11 +1,15 @@
 package client
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
@@ -18,9 +22,106 @@ func (c *Client) do(method, path string, body io.Reader, obj interface{}) error
 	return c.handleResponse(resp, obj)
 }
 
+// idempotencyKeyHeader carries a unique key for requests which may be
+// retried, so that the cluster executes them only once.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// doIdempotent works like do, but the request carries a random
+// Idempotency-Key and it is retried, up to the configured number of
+// times, when it fails with a network or server error. All the attempts
+// share the same request ID.
+func (c *Client) doIdempotent(method, path string, body []byte, obj interface{}) error {
+	key := newIdempotencyKey()
+	id := newRequestID()
+	return c.retry(func() error {
+		r, err := c.newTracedRequest(method, path, bytes.NewReader(body), id)
+		if err != nil {
+			return &api.Error{Code: 0, Message: err.Error()}
+		}
+		r.Header.Set(idempotencyKeyHeader, key)
+		resp, err := c.client.Do(r)
+		if err != nil {
+			return &api.Error{Code: 0, Message: err.Error()}
+		}
+		return c.handleResponse(resp, obj)
+	})
+}
+
+// retry calls f until it succeeds or fails with an error which is not
+// worth retrying, at most Retries + 1 times.
+func (c *Client) retry(f func() error) error {
+	delay := RetryDelay
+	for i := 0; ; i++ {
+		err := f()
+		if i >= c.config.Retries || !retriable(err) {
+			return err
+		}
+		logger.Debugf("retrying request in %s: %s", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// retriable returns true for network errors (with a 0 code), server
+// errors, rate-limited requests and conflicts with a request with the
+// same key which has not finished yet.
+func retriable(err error) bool {
+	apiErr, ok := err.(*api.Error)
+	if !ok {
+		return false
+	}
+	switch apiErr.Code {
+	case 0, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return apiErr.Code >= 500
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDHeader carries the ID of a request, which the cluster peers
+// include in their log lines about it.
+const requestIDHeader = "X-Request-ID"
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func (c *Client) doRequest(method, path string, body io.Reader) (*http.Response, error) {
-	urlpath := c.urlPrefix + "/" + strings.TrimPrefix(path, "/")
-	logger.Debugf("%s: %s", method, urlpath)
+	r, err := c.newRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(r)
+}
+
+// doStreamRequest works like doRequest, but the request is not subject
+// to the client timeout, so that the response can be read for as long as
+// the server keeps sending it.
+func (c *Client) doStreamRequest(method, path string, body io.Reader) (*http.Response, error) {
+	r, err := c.newRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: c.transport}
+	return client.Do(r)
+}
+
+func (c *Client) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	return c.newTracedRequest(method, path, body, newRequestID())
+}
+
+// newTracedRequest works like newRequest, but the request carries the
+// given ID, so that retries of a request can be correlated.
+func (c *Client) newTracedRequest(method, path string, body io.Reader, id string) (*http.Request, error) {
+	urlpath := c.urlPrefix + c.versionPrefix() + "/" + strings.TrimPrefix(path, "/")
+	logger.Debugf("%s: %s (request %s)", method, urlpath, id)
 
 	r, err := http.NewRequest(method, urlpath, body)
 	if err != nil {
@@ -30,11 +131,18 @@ func (c *Client) doRequest(method, path string, body io.Reader) (*http.Response,
 		r.Close = true
 	}
 
+	r.Header.Set(requestIDHeader, id)
+	c.setAuth(r)
+	return r, nil
+}
+
+// setAuth adds the configured credentials to a request.
+func (c *Client) setAuth(r *http.Request) {
 	if c.config.Username != "" {
 		r.SetBasicAuth(c.config.Username, c.config.Password)
+	} else if c.config.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.config.Token)
 	}
-
-	return c.client.Do(r)
 }
 
 func (c *Client) handleResponse(resp *http.Response, obj interface{}) error {
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// clientVersions are the versions of the REST API understood by this
+// client, oldest first. "v0" are the unversioned routes.
+var clientVersions = []string{"v0", "v1"}
+
+// versionsPath is where peers list the versions of the API they serve.
+// Peers from before the API was versioned do not have it.
+const versionsPath = "/api/versions"
+
+func supportedVersion(v string) bool {
+	for _, cv := range clientVersions {
+		if cv == v {
+			return true
+		}
+	}
+	return false
+}
+
+// versionPrefix returns the path prefix of the routes of the version of
+// the API used by the client. The version is negotiated with the peer
+// on the first request. When that fails, the unversioned routes are used
+// and the negotiation is tried again with the next request.
+func (c *Client) versionPrefix() string {
+	c.versionMux.Lock()
+	defer c.versionMux.Unlock()
+	if c.versionNegotiated {
+		return c.apiPrefix
+	}
+
+	version, err := c.negotiateVersion()
+	if err != nil {
+		logger.Debugf("cannot negotiate the API version: %s", err)
+		return ""
+	}
+	logger.Debugf("using API version %s", version)
+	if version != "v0" {
+		c.apiPrefix = "/api/" + version
+	}
+	c.versionNegotiated = true
+	return c.apiPrefix
+}
+
+// negotiateVersion returns the configured API version, or the newest
+// one which is supported by both the client and the peer.
+func (c *Client) negotiateVersion() (string, error) {
+	if c.config.APIVersion != "" {
+		return c.config.APIVersion, nil
+	}
+
+	r, err := http.NewRequest("GET", c.urlPrefix+versionsPath, nil)
+	if err != nil {
+		return "", err
+	}
+	c.setAuth(r)
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "v0", nil
+	default:
+		return "", fmt.Errorf("unexpected response listing the versions: %s", resp.Status)
+	}
+
+	var versions api.APIVersions
+	err = json.NewDecoder(resp.Body).Decode(&versions)
+	if err != nil {
+		return "", err
+	}
+	for i := len(clientVersions) - 1; i >= 0; i-- {
+		for _, v := range versions.Versions {
+			if v == clientVersions[i] {
+				return v, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("the peer only supports versions %s", strings.Join(versions.Versions, ", "))
+}
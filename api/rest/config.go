@@ -5,9 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"path/filepath"
 	"time"
 
+	"github.com/ipfs/ipfs-cluster/api/auth"
 	"github.com/ipfs/ipfs-cluster/config"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -22,6 +22,8 @@ const (
 	DefaultReadHeaderTimeout = 5 * time.Second
 	DefaultWriteTimeout      = 60 * time.Second
 	DefaultIdleTimeout       = 120 * time.Second
+	DefaultPublicStatusLimit = 60
+	DefaultIdempotencyWindow = 10 * time.Minute
 )
 
 // Config is used to intialize the API object and allows to
@@ -60,6 +62,56 @@ type Config struct {
 	// BasicAuthCreds is a map of username-password pairs
 	// which are authorized to use Basic Authentication
 	BasicAuthCreds map[string]string
+
+	// BearerTokens is a map of names to tokens which are authorized
+	// to use Bearer Authentication (an "Authorization: Bearer <token>"
+	// header). Names only serve to identify the tokens in the logs.
+	BearerTokens map[string]string
+
+	// EnableRPCCall enables the /rpc endpoint, which allows performing
+	// any RPC call to any peer. It requires BasicAuthCreds or
+	// BearerTokens to be set.
+	EnableRPCCall bool
+
+	// EnableLibp2p makes the API available over libp2p, using the
+	// host of the cluster peer, besides ListenAddr.
+	EnableLibp2p bool
+
+	// EnablePublicStatus enables the /public/status endpoint, which
+	// shows aggregate cluster figures and never requires Basic
+	// Authentication.
+	EnablePublicStatus bool
+
+	// PublicStatusLimit is the number of requests per minute that
+	// a client address can make to the /public/status endpoint.
+	PublicStatusLimit int
+
+	// RateLimit is the number of requests per minute that each client
+	// can make to the API. Clients are identified by the username or the
+	// name of the token they use, or otherwise by their address. 0 means
+	// no limit.
+	RateLimit int
+
+	// ClientRateLimits sets the number of requests per minute for
+	// specific clients (usernames, token names or addresses), instead
+	// of RateLimit. 0 means no limit.
+	ClientRateLimits map[string]int
+
+	// GlobalRateLimit is the number of requests per minute that all
+	// clients together can make to the API. 0 means no limit.
+	GlobalRateLimit int
+
+	// IdempotencyWindow is how long the responses to pin, unpin and
+	// add requests carrying an Idempotency-Key header are remembered,
+	// so that retries with the same key are not executed again. 0
+	// disables it.
+	IdempotencyWindow time.Duration
+
+	// ReadOnly disables the endpoints which change anything, like
+	// pinning, unpinning or adding and removing peers, so that the
+	// status of the cluster can be exposed without risk. Requests to
+	// them fail with a 403 error.
+	ReadOnly bool
 }
 
 type jsonConfig struct {
@@ -71,6 +123,16 @@ type jsonConfig struct {
 	WriteTimeout       string            `json:"write_timeout"`
 	IdleTimeout        string            `json:"idle_timeout"`
 	BasicAuthCreds     map[string]string `json:"basic_auth_credentials"`
+	BearerTokens       map[string]string `json:"bearer_tokens,omitempty"`
+	EnableRPCCall      bool              `json:"enable_rpc_call"`
+	EnableLibp2p       bool              `json:"enable_libp2p,omitempty"`
+	EnablePublicStatus bool              `json:"enable_public_status"`
+	PublicStatusLimit  int               `json:"public_status_limit"`
+	IdempotencyWindow  string            `json:"idempotency_window"`
+	RateLimit          int               `json:"rate_limit"`
+	ClientRateLimits   map[string]int    `json:"client_rate_limits,omitempty"`
+	GlobalRateLimit    int               `json:"global_rate_limit"`
+	ReadOnly           bool              `json:"read_only,omitempty"`
 }
 
 // ConfigKey returns a human-friendly identifier for this type of
@@ -90,6 +152,16 @@ func (cfg *Config) Default() error {
 	cfg.WriteTimeout = DefaultWriteTimeout
 	cfg.IdleTimeout = DefaultIdleTimeout
 	cfg.BasicAuthCreds = nil
+	cfg.BearerTokens = nil
+	cfg.EnableRPCCall = false
+	cfg.EnableLibp2p = false
+	cfg.EnablePublicStatus = false
+	cfg.PublicStatusLimit = DefaultPublicStatusLimit
+	cfg.IdempotencyWindow = DefaultIdempotencyWindow
+	cfg.RateLimit = 0
+	cfg.ClientRateLimits = nil
+	cfg.GlobalRateLimit = 0
+	cfg.ReadOnly = false
 
 	return nil
 }
@@ -121,6 +193,42 @@ func (cfg *Config) Validate() error {
 		return errors.New("restapi.basic_auth_creds should be null or have at least one entry")
 	}
 
+	if cfg.BearerTokens != nil && len(cfg.BearerTokens) == 0 {
+		return errors.New("restapi.bearer_tokens should be null or have at least one entry")
+	}
+
+	for name, token := range cfg.BearerTokens {
+		if token == "" {
+			return fmt.Errorf("restapi.bearer_tokens: empty token for %s", name)
+		}
+	}
+
+	if cfg.EnableRPCCall && !cfg.authEnabled() {
+		return errors.New("restapi.enable_rpc_call requires restapi.basic_auth_credentials or restapi.bearer_tokens")
+	}
+
+	if cfg.PublicStatusLimit <= 0 {
+		return errors.New("restapi.public_status_limit is invalid")
+	}
+
+	if cfg.IdempotencyWindow < 0 {
+		return errors.New("restapi.idempotency_window is invalid")
+	}
+
+	if cfg.RateLimit < 0 {
+		return errors.New("restapi.rate_limit is invalid")
+	}
+
+	for client, limit := range cfg.ClientRateLimits {
+		if limit < 0 {
+			return fmt.Errorf("restapi.client_rate_limits: invalid limit for %s", client)
+		}
+	}
+
+	if cfg.GlobalRateLimit < 0 {
+		return errors.New("restapi.global_rate_limit is invalid")
+	}
+
 	if (cfg.pathSSLCertFile != "" || cfg.pathSSLKeyFile != "") && cfg.TLS == nil {
 		return errors.New("error loading SSL certificate or key")
 	}
@@ -156,17 +264,9 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	cfg.pathSSLKeyFile = key
 
 	if cert != "" || key != "" {
-		// if one is missing, newTLSConfig will
+		// if one is missing, LoadTLSConfig will
 		// error loudly
-		if !filepath.IsAbs(cert) {
-			cert = filepath.Join(cfg.BaseDir, cert)
-		}
-		if !filepath.IsAbs(key) {
-			key = filepath.Join(cfg.BaseDir, key)
-		}
-		logger.Debug(cfg.BaseDir)
-		logger.Debug(cert, key)
-		tlsCfg, err := newTLSConfig(cert, key)
+		tlsCfg, err := auth.LoadTLSConfig(cfg.BaseDir, cert, key)
 		if err != nil {
 			return err
 		}
@@ -187,6 +287,29 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	cfg.IdleTimeout = t
 
 	cfg.BasicAuthCreds = jcfg.BasicAuthCreds
+	cfg.BearerTokens = jcfg.BearerTokens
+	cfg.EnableRPCCall = jcfg.EnableRPCCall
+	cfg.EnableLibp2p = jcfg.EnableLibp2p
+	cfg.EnablePublicStatus = jcfg.EnablePublicStatus
+
+	cfg.PublicStatusLimit = jcfg.PublicStatusLimit
+	if cfg.PublicStatusLimit == 0 {
+		cfg.PublicStatusLimit = DefaultPublicStatusLimit
+	}
+
+	cfg.IdempotencyWindow = DefaultIdempotencyWindow
+	if jcfg.IdempotencyWindow != "" {
+		t, err = time.ParseDuration(jcfg.IdempotencyWindow)
+		if err != nil {
+			return fmt.Errorf("error parsing restapi.idempotency_window: %s", err)
+		}
+		cfg.IdempotencyWindow = t
+	}
+
+	cfg.RateLimit = jcfg.RateLimit
+	cfg.ClientRateLimits = jcfg.ClientRateLimits
+	cfg.GlobalRateLimit = jcfg.GlobalRateLimit
+	cfg.ReadOnly = jcfg.ReadOnly
 
 	return cfg.Validate()
 }
@@ -210,27 +333,37 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 	jcfg.WriteTimeout = cfg.WriteTimeout.String()
 	jcfg.IdleTimeout = cfg.IdleTimeout.String()
 	jcfg.BasicAuthCreds = cfg.BasicAuthCreds
+	jcfg.BearerTokens = cfg.BearerTokens
+	jcfg.EnableRPCCall = cfg.EnableRPCCall
+	jcfg.EnableLibp2p = cfg.EnableLibp2p
+	jcfg.EnablePublicStatus = cfg.EnablePublicStatus
+	jcfg.PublicStatusLimit = cfg.PublicStatusLimit
+	jcfg.IdempotencyWindow = cfg.IdempotencyWindow.String()
+	jcfg.RateLimit = cfg.RateLimit
+	jcfg.ClientRateLimits = cfg.ClientRateLimits
+	jcfg.GlobalRateLimit = cfg.GlobalRateLimit
+	jcfg.ReadOnly = cfg.ReadOnly
 
 	raw, err = config.DefaultJSONMarshal(jcfg)
 	return
 }
 
-func newTLSConfig(certFile, keyFile string) (*tls.Config, error) {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return nil, errors.New("Error loading TLS certficate/key: " + err.Error())
-	}
-	// based on https://github.com/denji/golang-tls
-	return &tls.Config{
-		MinVersion:               tls.VersionTLS12,
-		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
-		PreferServerCipherSuites: true,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-		},
-		Certificates: []tls.Certificate{cert},
-	}, nil
+// authEnabled returns true when requests must be authenticated, either
+// with Basic Authentication or with a Bearer token.
+func (cfg *Config) authEnabled() bool {
+	return cfg.credentials().Enabled()
+}
+
+// credentials returns the clients authorized to use the API.
+func (cfg *Config) credentials() auth.Credentials {
+	return auth.Credentials{
+		Basic:  cfg.BasicAuthCreds,
+		Tokens: cfg.BearerTokens,
+	}
+}
+
+// rateLimitEnabled returns true when the number of requests to the API
+// is limited.
+func (cfg *Config) rateLimitEnabled() bool {
+	return cfg.RateLimit > 0 || cfg.GlobalRateLimit > 0 || len(cfg.ClientRateLimits) > 0
 }
@@ -53,6 +53,42 @@ func TestLoadJSON(t *testing.T) {
 		t.Error("expected error with empty basic auth map")
 	}
 
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.BearerTokens = map[string]string{"ci": ""}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with an empty bearer token")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.BearerTokens = map[string]string{"ci": "abcdef"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || cfg.BearerTokens["ci"] != "abcdef" {
+		t.Error("expected bearer tokens to be loaded")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.EnableLibp2p = true
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || !cfg.EnableLibp2p {
+		t.Error("expected enable_libp2p to be loaded")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.ReadOnly = true
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || !cfg.ReadOnly {
+		t.Error("expected read_only to be loaded")
+	}
+
 	j = &jsonConfig{}
 	json.Unmarshal(cfgJSON, j)
 	j.SSLCertFile = "abc"
@@ -61,6 +97,48 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error with TLS configuration")
 	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.PublicStatusLimit = -1
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error in public_status_limit")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.IdempotencyWindow = "-1m"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error in idempotency_window")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.ClientRateLimits = map[string]int{"ci": -1}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error in client_rate_limits")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.RateLimit = 100
+	j.GlobalRateLimit = 1000
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || cfg.RateLimit != 100 || cfg.GlobalRateLimit != 1000 {
+		t.Error("expected the rate limits to be loaded")
+	}
+
+	err = cfg.LoadJSON(cfgJSON)
+	if err != nil || cfg.IdempotencyWindow != DefaultIdempotencyWindow {
+		t.Error("expected the default idempotency_window")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -94,4 +172,27 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.EnableRPCCall = true
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.BasicAuthCreds = map[string]string{"admin": "secret"}
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.BasicAuthCreds = nil
+	cfg.BearerTokens = map[string]string{"ci": "abcdef"}
+	if cfg.Validate() != nil {
+		t.Fatal("bearer tokens should be enough for enable_rpc_call")
+	}
+
+	cfg.Default()
+	cfg.PublicStatusLimit = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
@@ -0,0 +1,293 @@
+package rest
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the header in which clients send a unique key
+// for requests which they may retry. Requests with the same key are only
+// executed once.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set in responses which were recorded for an
+// earlier request with the same Idempotency-Key.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength is the maximum length of an Idempotency-Key.
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotencyKeys is the number of keys remembered at most. When it is
+// reached, the oldest responses are forgotten before their time.
+var maxIdempotencyKeys = 10000
+
+// idempotentRoutes lists the routes which honor Idempotency-Key headers.
+var idempotentRoutes = map[string]bool{
+	"Pin":            true,
+	"PinBatch":       true,
+	"Batch":          true,
+	"Unpin":          true,
+	"PinPath":        true,
+	"UnpinPath":      true,
+	"Add":            true,
+	"NamespacePin":   true,
+	"NamespaceUnpin": true,
+}
+
+// idempotentResponse is the response to a request with an
+// Idempotency-Key. done is closed once it has been recorded, along with
+// the hash of the request body.
+type idempotentResponse struct {
+	key      string
+	request  string
+	bodyHash string
+	done     chan struct{}
+	expires  time.Time
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+// idempotencyCache remembers the responses to the requests carrying an
+// Idempotency-Key during a window of time, so that retries of the same
+// request get the same response without executing it again. Responses
+// with 5xx codes are not remembered, so those requests can be retried.
+type idempotencyCache struct {
+	mux       sync.Mutex
+	window    time.Duration
+	responses map[string]*idempotentResponse
+	// recorded lists the recorded responses in the order they expire
+	recorded *list.List
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		window:    window,
+		responses: make(map[string]*idempotentResponse),
+		recorded:  list.New(),
+	}
+}
+
+// wrap returns a handler which deduplicates the requests handled by h
+// using their Idempotency-Key. Keys are scoped to the credentials of the
+// request, so different clients cannot see each other's responses. A
+// request only matches the recorded one when it has the same method, URI
+// and body.
+func (ic *idempotencyCache) wrap(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			h(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			sendErrorResponse(w, 400, "Idempotency-Key is too long")
+			return
+		}
+		key = r.Header.Get("Authorization") + "\n" + key
+		request := r.Method + " " + r.URL.RequestURI()
+		body := newHashingReader(r.Body)
+		r.Body = body
+
+		ic.mux.Lock()
+		ic.expire()
+		resp, ok := ic.responses[key]
+		if !ok {
+			if len(ic.responses) >= maxIdempotencyKeys && !ic.evict() {
+				ic.mux.Unlock()
+				sendErrorResponse(w, 503, "too many requests with an Idempotency-Key in progress")
+				return
+			}
+			resp = &idempotentResponse{
+				key:     key,
+				request: request,
+				done:    make(chan struct{}),
+			}
+			ic.responses[key] = resp
+		}
+		ic.mux.Unlock()
+
+		if ok {
+			ic.replay(w, request, body, resp)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			if !completed {
+				// the handler panicked. The key must not stay in
+				// progress forever.
+				ic.record(resp, rec, "")
+			}
+		}()
+		h(rec, r)
+		completed = true
+
+		bodyHash, err := body.sum()
+		if err != nil {
+			// the request cannot be told apart from others with
+			// the same key. Do not remember it.
+			logger.Debugf("not recording the response to %s: %s", request, err)
+			bodyHash = ""
+		}
+		ic.record(resp, rec, bodyHash)
+	}
+}
+
+// record saves the response to a request with the hash of its body. It
+// is forgotten instead when it failed with a 5xx code or when the hash is
+// empty.
+func (ic *idempotencyCache) record(resp *idempotentResponse, rec *responseRecorder, bodyHash string) {
+	ic.mux.Lock()
+	defer ic.mux.Unlock()
+	if rec.status >= 500 || bodyHash == "" {
+		if ic.responses[resp.key] == resp {
+			delete(ic.responses, resp.key)
+		}
+	} else {
+		resp.status = rec.status
+		resp.header = rec.Header()
+		resp.body = rec.body.Bytes()
+		resp.bodyHash = bodyHash
+		resp.expires = time.Now().Add(ic.window)
+		ic.recorded.PushBack(resp)
+	}
+	close(resp.done)
+}
+
+// replay sends a recorded response, or an error when the key belongs to
+// a different request or one which has not finished yet.
+func (ic *idempotencyCache) replay(w http.ResponseWriter, request string, body *hashingReader, resp *idempotentResponse) {
+	if resp.request != request {
+		sendErrorResponse(w, 422, "Idempotency-Key was used with a different request")
+		return
+	}
+
+	select {
+	case <-resp.done:
+	default:
+		sendErrorResponse(w, 409, "a request with this Idempotency-Key is in progress")
+		return
+	}
+
+	if resp.status == 0 { // failed with a 5xx code
+		sendErrorResponse(w, 409, "the request with this Idempotency-Key failed and should be retried")
+		return
+	}
+
+	bodyHash, err := body.sum()
+	if err != nil {
+		sendErrorResponse(w, 400, err.Error())
+		return
+	}
+	if bodyHash != resp.bodyHash {
+		sendErrorResponse(w, 422, "Idempotency-Key was used with a different request")
+		return
+	}
+
+	for k, v := range resp.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
+
+// expire forgets the responses older than the window. It must be called
+// with the lock held.
+func (ic *idempotencyCache) expire() {
+	now := time.Now()
+	for e := ic.recorded.Front(); e != nil; e = ic.recorded.Front() {
+		resp := e.Value.(*idempotentResponse)
+		if now.Before(resp.expires) {
+			return
+		}
+		ic.forget(e)
+	}
+}
+
+// evict forgets the oldest recorded response to make room for a new one.
+// It returns false when there is none, because all the remembered
+// requests are in progress. It must be called with the lock held.
+func (ic *idempotencyCache) evict() bool {
+	e := ic.recorded.Front()
+	if e == nil {
+		return false
+	}
+	ic.forget(e)
+	return true
+}
+
+func (ic *idempotencyCache) forget(e *list.Element) {
+	resp := ic.recorded.Remove(e).(*idempotentResponse)
+	// the key may belong to a newer request already
+	if ic.responses[resp.key] == resp {
+		delete(ic.responses, resp.key)
+	}
+}
+
+// hashingReader hashes a request body as it is read, so that requests
+// with the same Idempotency-Key can be compared without keeping their
+// bodies.
+type hashingReader struct {
+	io.ReadCloser
+	hash hash.Hash
+	eof  bool
+}
+
+func newHashingReader(body io.ReadCloser) *hashingReader {
+	if body == nil {
+		body = http.NoBody
+	}
+	return &hashingReader{
+		ReadCloser: body,
+		hash:       sha256.New(),
+	}
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.ReadCloser.Read(p)
+	hr.hash.Write(p[:n])
+	if err == io.EOF {
+		hr.eof = true
+	}
+	return n, err
+}
+
+// sum reads what is left of the body and returns its hash.
+func (hr *hashingReader) sum() (string, error) {
+	if !hr.eof {
+		if _, err := io.Copy(ioutil.Discard, hr); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hr.hash.Sum(nil)), nil
+}
+
+// responseRecorder keeps a copy of the status and the body written to a
+// ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	calls := 0
+	status := 202
+	ic := newIdempotencyCache(time.Minute)
+	h := ic.wrap(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		sendJSONResponse(w, status, calls)
+	})
+
+	do := func(path, key, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, nil)
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	do("/pins/a", "", "")
+	do("/pins/a", "", "")
+	if calls != 2 {
+		t.Fatal("requests without a key should always be executed")
+	}
+
+	first := do("/pins/a", "key1", "")
+	second := do("/pins/a", "key1", "")
+	if calls != 3 {
+		t.Fatal("the retry should not have been executed")
+	}
+	if second.Code != 202 || second.Body.String() != first.Body.String() {
+		t.Error("the retry should get the same response:", second.Code, second.Body.String())
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("the response should be marked as replayed")
+	}
+
+	if w := do("/pins/b", "key1", ""); w.Code != 422 {
+		t.Error("reusing a key for a different request should fail:", w.Code)
+	}
+
+	do("/pins/a", "key1", "Bearer abc")
+	if calls != 4 {
+		t.Error("keys should be scoped to the credentials")
+	}
+
+	status = 500
+	do("/pins/a", "key2", "")
+	do("/pins/a", "key2", "")
+	if calls != 6 {
+		t.Error("failed requests should be executed again")
+	}
+}
+
+func TestIdempotencyCacheExpire(t *testing.T) {
+	calls := 0
+	ic := newIdempotencyCache(10 * time.Millisecond)
+	h := ic.wrap(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		sendAcceptedResponse(w, nil)
+	})
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("DELETE", "/pins/a", nil)
+		r.Header.Set(IdempotencyKeyHeader, "key")
+		h(httptest.NewRecorder(), r)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if calls != 2 {
+		t.Error("the key should have expired")
+	}
+	if len(ic.responses) != 1 {
+		t.Error("expired responses should be forgotten")
+	}
+}
+
+func TestIdempotencyCacheBody(t *testing.T) {
+	calls := 0
+	ic := newIdempotencyCache(time.Minute)
+	h := ic.wrap(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		sendAcceptedResponse(w, nil)
+	})
+
+	do := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/pins/batch", strings.NewReader(body))
+		r.Header.Set(IdempotencyKeyHeader, "key")
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	// the handler does not read the body, but it is hashed anyway
+	do(`["a"]`)
+	if w := do(`["a"]`); w.Code != 202 || calls != 1 {
+		t.Error("the retry should have been replayed:", w.Code)
+	}
+	if w := do(`["b"]`); w.Code != 422 || calls != 1 {
+		t.Error("reusing a key with a different body should fail:", w.Code)
+	}
+}
+
+func TestIdempotencyCachePanic(t *testing.T) {
+	ic := newIdempotencyCache(time.Minute)
+	h := ic.wrap(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("the panic should be propagated")
+			}
+		}()
+		r := httptest.NewRequest("POST", "/pins/a", nil)
+		r.Header.Set(IdempotencyKeyHeader, "key")
+		h(httptest.NewRecorder(), r)
+	}()
+
+	if len(ic.responses) != 0 {
+		t.Error("the key of a panicked request should be forgotten")
+	}
+}
+
+func TestIdempotencyCacheLimit(t *testing.T) {
+	defer func(n int) { maxIdempotencyKeys = n }(maxIdempotencyKeys)
+	maxIdempotencyKeys = 2
+
+	ic := newIdempotencyCache(time.Minute)
+	h := ic.wrap(func(w http.ResponseWriter, r *http.Request) {
+		sendAcceptedResponse(w, nil)
+	})
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		r := httptest.NewRequest("POST", "/pins/a", nil)
+		r.Header.Set(IdempotencyKeyHeader, key)
+		h(httptest.NewRecorder(), r)
+	}
+	if len(ic.responses) != 2 || ic.recorded.Len() != 2 {
+		t.Fatal("the number of keys should be capped")
+	}
+	if _, ok := ic.responses["\nkey1"]; ok {
+		t.Error("the oldest response should have been forgotten")
+	}
+}
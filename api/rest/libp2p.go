@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var errListenerClosed = errors.New("libp2p listener closed")
+
+// streamAddr is the net.Addr of one of the ends of a libp2p stream.
+type streamAddr struct {
+	id peer.ID
+}
+
+func (a streamAddr) Network() string { return "libp2p" }
+func (a streamAddr) String() string  { return a.id.Pretty() }
+
+// streamConn wraps a libp2p stream so it can be used as a net.Conn.
+type streamConn struct {
+	inet.Stream
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return streamAddr{c.Stream.Conn().LocalPeer()}
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return streamAddr{c.Stream.Conn().RemotePeer()}
+}
+
+// streamListener is a net.Listener which accepts the libp2p streams
+// opened to a host for the RESTLibp2pProtocol.
+type streamListener struct {
+	host   host.Host
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newStreamListener(h host.Host) *streamListener {
+	l := &streamListener{
+		host:   h,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	h.SetStreamHandler(types.RESTLibp2pProtocol, func(s inet.Stream) {
+		select {
+		case l.conns <- &streamConn{s}:
+		case <-l.closed:
+			s.Reset()
+		}
+	})
+	return l
+}
+
+func (l *streamListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *streamListener) Close() error {
+	l.once.Do(func() {
+		l.host.RemoveStreamHandler(types.RESTLibp2pProtocol)
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *streamListener) Addr() net.Addr {
+	return streamAddr{l.host.ID()}
+}
@@ -0,0 +1,482 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+)
+
+// SpecPath is the path on which the API serves its OpenAPI specification.
+const SpecPath = APIPrefix + "/spec"
+
+// openAPIVersion is the version of the OpenAPI specification format.
+const openAPIVersion = "3.0.0"
+
+// param documents a query parameter.
+type param struct {
+	name string
+	typ  string
+	desc string
+}
+
+// Query parameters shared by several endpoints.
+var (
+	localParam    = param{"local", "boolean", "only consider this peer"}
+	filterParam   = param{"filter", "string", "comma-separated list of statuses to include"}
+	allPeersParam = param{"all_peers", "boolean", "apply the change in every peer"}
+	pageParams    = []param{
+		{"limit", "integer", "maximum number of items to return"},
+		{"offset", "integer", "number of items to skip"},
+		{"cursor", "string", "only return items after this Cid"},
+		{"sort", "string", "sort order of the items"},
+	}
+	pinParams = []param{
+		{"replication_factor", "integer", "replication factor for the pin"},
+		{"name", "string", "name for the pin"},
+		{"shards", "string", "comma-separated Cids of the shards of a sharded pin"},
+		{"inline", "boolean", "store the content of the block in the pin"},
+		{"wait", "boolean", "answer with the status of the item once it is pinned"},
+		{"wait-timeout", "string", "how long to wait for the item to be pinned (i.e. 30s)"},
+	}
+)
+
+// routeDoc describes what an API route takes and returns. A nil response
+// means it returns no body. A nil request means it takes no body.
+type routeDoc struct {
+	summary     string
+	params      []param
+	request     interface{}
+	contentType string
+	status      int
+	response    interface{}
+}
+
+// routeDocs documents every route by name. Routes must be added here so
+// that they appear in the specification.
+var routeDocs = map[string]routeDoc{
+	"ID":             {summary: "Show the cluster peer and its IPFS daemon", response: types.IDSerial{}},
+	"Version":        {summary: "Show the cluster version", response: types.Version{}},
+	"Health":         {summary: "Show the health of the peer", response: types.HealthSerial{}},
+	"SyncStatus":     {summary: "Show whether the peer state is in sync", response: types.SyncStatusSerial{}},
+	"HealthGraph":    {summary: "Show the connectivity graph of the cluster", response: types.ConnectGraphSerial{}},
+	"PeersHealth":    {summary: "Show the liveness of every cluster peer", response: []types.PeerLivenessSerial{}},
+	"TrackerMetrics": {summary: "Show the pin tracker metrics", response: types.TrackerMetricsSerial{}},
+	"PublicStatus":   {summary: "Show the public status of the cluster", response: types.PublicStatus{}},
+	"IPFSLocalPins":  {summary: "List the pins in the IPFS daemon", response: []types.LocalPinSerial{}},
+	"Peers":          {summary: "List the cluster peers", response: []types.IDSerial{}},
+	"PeerAdd": {
+		summary:  "Add a peer to the cluster",
+		request:  peerAddBody{},
+		response: types.IDSerial{},
+	},
+	"PeerRemove":       {summary: "Remove a peer from the cluster", status: 204},
+	"PeerRemoval":      {summary: "Show the progress of a peer removal", response: types.PeerRemovalSerial{}},
+	"MaintenancePeers": {summary: "List the peers in maintenance mode", response: []string{}},
+	"PeerMaintenance": {
+		summary: "Put a peer in or out of maintenance mode",
+		params:  []param{{"enabled", "boolean", "enable maintenance mode"}},
+		status:  204,
+	},
+	"ResolveMultihash": {summary: "Resolve a multihash to a pinned Cid", response: types.ResolvedMultihash{}},
+	"Allocations": {
+		summary:  "List the pins in the shared state",
+		params:   pageParams,
+		response: []types.PinSerial{},
+	},
+	"DuplicatePins":      {summary: "List pins with the same content", response: []types.DuplicatePinsSerial{}},
+	"MergeDuplicatePins": {summary: "Merge pins with the same content", response: []types.DuplicatePinsSerial{}},
+	"StateStats": {
+		summary:  "Show statistics about the shared state",
+		params:   []param{{"delimiter", "string", "group pin names by their prefix up to this delimiter"}},
+		response: types.StateStatsSerial{},
+	},
+	"AllocationDecisions": {
+		summary:  "List the recent allocation decisions",
+		params:   []param{localParam},
+		response: []types.AllocationRecordSerial{},
+	},
+	"Allocation": {summary: "Show a pin in the shared state", response: types.PinSerial{}},
+	"AllocationHistory": {
+		summary:  "List the allocation decisions for a pin",
+		params:   []param{localParam},
+		response: []types.AllocationRecordSerial{},
+	},
+	"AllocationPreview": {
+		summary:  "Show where a pin would be allocated",
+		request:  types.AllocationPreviewSerial{},
+		response: types.PinSerial{},
+	},
+	"SimulateAllocations": {
+		summary:  "Simulate the allocation of several pins",
+		request:  []types.PinSerial{},
+		response: types.AllocationSimulationSerial{},
+	},
+	"StatusAll": {
+		summary:  "Show the status of all the pins",
+		params:   append([]param{localParam, filterParam}, pageParams...),
+		response: []types.GlobalPinInfoSerial{},
+	},
+	"PinBatch": {
+		summary: "Pin several items",
+		request: []types.PinSerial{},
+		status:  202,
+	},
+	"Batch": {
+		summary:  "Pin and unpin several items, as a JSON array or ndjson, and show the outcome of each",
+		request:  []types.BatchItemSerial{},
+		status:   202,
+		response: []types.BatchResult{},
+	},
+	"SyncAll": {
+		summary:  "Sync the status of all the pins",
+		params:   []param{localParam},
+		response: []types.GlobalPinInfoSerial{},
+	},
+	"RecoverAll": {
+		summary:  "Recover all the pins in error",
+		params:   []param{localParam, filterParam},
+		response: []types.GlobalPinInfoSerial{},
+	},
+	"PinLog": {
+		summary:  "List the pin and unpin operations",
+		params:   []param{{"since", "integer", "only return entries after this sequence number"}},
+		response: []types.PinLogEntrySerial{},
+	},
+	"Events": {
+		summary:     "Stream the cluster events as server-sent events",
+		params:      []param{{"since", "integer", "only return events after this sequence number"}},
+		contentType: "text/event-stream",
+		response:    types.EventSerial{},
+	},
+	"PinSummary": {
+		summary:  "Count the status of the pins by status and by peer",
+		params:   []param{localParam, filterParam},
+		response: types.PinSummarySerial{},
+	},
+	"Status": {
+		summary:  "Show the status of a pin",
+		params:   []param{localParam},
+		response: types.GlobalPinInfoSerial{},
+	},
+	"Add": {
+		summary: "Add content to IPFS and pin it",
+		params: append([]param{
+			{"chunker", "string", "chunking algorithm"},
+			{"raw-leaves", "boolean", "use raw blocks for the leaf nodes"},
+			{"wrap-with-directory", "boolean", "wrap the files in a directory"},
+		}, pinParams[:2]...),
+		contentType: "multipart/form-data",
+		response:    []types.AddedOutputSerial{},
+	},
+	"Pin": {
+		summary: "Pin an item",
+		params:  pinParams,
+		status:  202,
+	},
+	"PinPath": {
+		summary:  "Pin the item an IPFS or IPNS path resolves to",
+		params:   pinParams[:3],
+		status:   202,
+		response: types.PinSerial{},
+	},
+	"UnpinPath":     {summary: "Unpin the item an IPFS or IPNS path resolves to", status: 202, response: types.PinSerial{}},
+	"Unpin":         {summary: "Unpin an item", status: 202},
+	"Sync":          {summary: "Sync the status of a pin", params: []param{localParam}, response: types.GlobalPinInfoSerial{}},
+	"Recover":       {summary: "Recover a pin in error", params: []param{localParam}, response: types.GlobalPinInfoSerial{}},
+	"CancelPin":     {summary: "Cancel an ongoing pin", status: 202},
+	"ScalingAdvice": {summary: "Show whether the cluster should scale", response: types.ScalingAdviceSerial{}},
+	"LogLevel": {
+		summary: "Set the log level of a component",
+		params:  []param{allPeersParam},
+		request: types.LogLevel{},
+		status:  204,
+	},
+	"Snapshot": {summary: "Take a snapshot of the consensus state", status: 204},
+	"ConsensusStatus": {
+		summary:  "Show the status of the consensus",
+		params:   []param{localParam},
+		response: []types.ConsensusStatusSerial{},
+	},
+	"StateVerify": {summary: "Compare the shared state with the IPFS pins", response: []types.StateDiffSerial{}},
+	"Namespaces":  {summary: "List the namespaces", response: []types.Namespace{}},
+	"NamespacePins": {
+		summary:  "List the pins in a namespace",
+		response: []types.PinSerial{},
+	},
+	"NamespacePin": {
+		summary: "Pin an item in a namespace",
+		params:  pinParams,
+		status:  202,
+	},
+	"NamespaceUnpin":      {summary: "Unpin an item in a namespace", status: 202},
+	"NamespaceAllocation": {summary: "Show a pin in a namespace", response: types.PinSerial{}},
+	"AllocationStrategy": {
+		summary: "Set the allocation strategy",
+		params:  []param{allPeersParam},
+		request: types.AllocationStrategy{},
+		status:  204,
+	},
+	"RuntimeConfig": {
+		summary: "Change configuration options at runtime",
+		params:  []param{allPeersParam},
+		request: types.RuntimeConfig{},
+		status:  204,
+	},
+	"RPCCall": {
+		summary:  "Make an RPC call to a peer",
+		request:  types.RPCCallSerial{},
+		response: json.RawMessage{},
+	},
+	"Spec": {summary: "Show the OpenAPI specification of this API", response: map[string]interface{}{}},
+}
+
+var pathParamRegexp = regexp.MustCompile(`{([^}:]+)(:[^}]+)?}`)
+
+// specPath returns a route pattern without the regular expressions of its
+// variables, as OpenAPI expects it.
+func specPath(pattern string) string {
+	return pathParamRegexp.ReplaceAllString(pattern, "{$1}")
+}
+
+// specBuilder builds an OpenAPI document. The JSON schemas of the named
+// types it finds are added to its components.
+type specBuilder struct {
+	schemas map[string]interface{}
+}
+
+// openAPISpec returns the OpenAPI specification of the given routes, as a
+// JSON-encodable object.
+func (api *API) openAPISpec(routes []route) map[string]interface{} {
+	b := &specBuilder{schemas: make(map[string]interface{})}
+	b.schemaRef(reflect.TypeOf(types.Error{}))
+
+	paths := make(map[string]interface{})
+	for _, route := range routes {
+		path := specPath(route.Pattern)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = b.operation(route)
+	}
+
+	components := map[string]interface{}{
+		"schemas": b.schemas,
+	}
+	spec := map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "IPFS Cluster REST API",
+			"description": "HTTP API to interact with an IPFS Cluster peer.",
+			"version":     APIVersion,
+		},
+		// paths are relative to the prefix of the current version.
+		"servers":    []interface{}{map[string]string{"url": APIPrefix}},
+		"paths":      paths,
+		"components": components,
+	}
+
+	// secure all the operations with the enabled methods.
+	var security []interface{}
+	schemes := make(map[string]interface{})
+	if api.config.BasicAuthCreds != nil {
+		schemes["basicAuth"] = map[string]string{"type": "http", "scheme": "basic"}
+		security = append(security, map[string][]string{"basicAuth": {}})
+	}
+	if api.config.BearerTokens != nil {
+		schemes["bearerAuth"] = map[string]string{"type": "http", "scheme": "bearer"}
+		security = append(security, map[string][]string{"bearerAuth": {}})
+	}
+	if len(schemes) > 0 {
+		components["securitySchemes"] = schemes
+		spec["security"] = security
+	}
+	return spec
+}
+
+func (b *specBuilder) operation(route route) map[string]interface{} {
+	doc := routeDocs[route.Name]
+	op := map[string]interface{}{
+		"operationId": route.Name,
+		"summary":     doc.summary,
+	}
+
+	var params []interface{}
+	for _, m := range pathParamRegexp.FindAllStringSubmatch(route.Pattern, -1) {
+		params = append(params, map[string]interface{}{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]string{"type": "string"},
+		})
+	}
+	for _, p := range doc.params {
+		params = append(params, map[string]interface{}{
+			"name":        p.name,
+			"in":          "query",
+			"description": p.desc,
+			"schema":      map[string]string{"type": p.typ},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if doc.contentType == "multipart/form-data" {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				doc.contentType: map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"file": map[string]interface{}{
+								"type":        "array",
+								"items":       map[string]string{"type": "string", "format": "binary"},
+								"description": "files and directories to add",
+							},
+						},
+					},
+				},
+			},
+		}
+	} else if doc.request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": b.schemaRef(reflect.TypeOf(doc.request)),
+				},
+			},
+		}
+	}
+
+	status := doc.status
+	if status == 0 {
+		status = 200
+	}
+	resp := map[string]interface{}{
+		"description": http.StatusText(status),
+	}
+	if doc.response != nil {
+		contentType := "application/json"
+		if doc.contentType == "text/event-stream" {
+			contentType = doc.contentType
+		}
+		resp["content"] = map[string]interface{}{
+			contentType: map[string]interface{}{
+				"schema": b.schemaRef(reflect.TypeOf(doc.response)),
+			},
+		}
+	}
+	op["responses"] = map[string]interface{}{
+		strconv.Itoa(status): resp,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]string{"$ref": "#/components/schemas/Error"},
+				},
+			},
+		},
+	}
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaRef returns the JSON schema for the given type, as it is encoded
+// by encoding/json. Structs are added to the components and referenced.
+func (b *specBuilder) schemaRef(t reflect.Type) interface{} {
+	switch t {
+	case timeType:
+		return map[string]string{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schemaRef(t.Elem())
+	case reflect.Bool:
+		return map[string]string{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]string{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]string{"type": "number"}
+	case reflect.String:
+		return map[string]string{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]string{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{
+			"type":  "array",
+			"items": b.schemaRef(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": b.schemaRef(t.Elem()),
+		}
+	case reflect.Struct:
+		name := strings.TrimSuffix(t.Name(), "Serial")
+		if name == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.schemas[name]; !ok {
+			// placeholder to stop recursion
+			b.schemas[name] = nil
+			b.schemas[name] = b.structSchema(t)
+		}
+		return map[string]string{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func (b *specBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		name := f.Name
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if tag[0] != "" {
+			name = tag[0]
+		} else if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			// inlined by encoding/json
+			for k, v := range b.structSchema(f.Type)["properties"].(map[string]interface{}) {
+				props[k] = v
+			}
+			continue
+		}
+		props[name] = b.schemaRef(f.Type)
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+}
+
+// specHandler serves the OpenAPI specification of all the routes.
+func (api *API) specHandler(w http.ResponseWriter, r *http.Request) {
+	routes := api.routes()
+	if api.config.EnablePublicStatus {
+		routes = append(routes, route{"PublicStatus", "GET", "/public/status", api.publicStatusHandler})
+	}
+	sendJSONResponse(w, 200, api.openAPISpec(routes))
+}
@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+func TestRouteDocs(t *testing.T) {
+	rest := &API{}
+	names := make(map[string]bool)
+	for _, r := range rest.routes() {
+		names[r.Name] = true
+		if _, ok := routeDocs[r.Name]; !ok {
+			t.Errorf("route %s is not documented", r.Name)
+		}
+	}
+	names["PublicStatus"] = true
+
+	for name := range routeDocs {
+		if !names[name] {
+			t.Errorf("%s is documented but it is not a route", name)
+		}
+	}
+}
+
+func TestSchemaRef(t *testing.T) {
+	b := &specBuilder{schemas: make(map[string]interface{})}
+	ref := b.schemaRef(reflect.TypeOf([]api.PinSerial{}))
+	arr, ok := ref.(map[string]interface{})
+	if !ok || arr["type"] != "array" {
+		t.Fatal("expected an array schema:", ref)
+	}
+
+	pin, ok := b.schemas["Pin"].(map[string]interface{})
+	if !ok {
+		t.Fatal("the Pin schema should have been added")
+	}
+	props := pin["properties"].(map[string]interface{})
+	cid, ok := props["cid"].(map[string]string)
+	if !ok || cid["type"] != "string" {
+		t.Error("expected a cid string property:", props["cid"])
+	}
+	if _, ok := props["allocations"].(map[string]interface{}); !ok {
+		t.Error("expected an allocations array property:", props["allocations"])
+	}
+}
+
+func TestSchemaRefEmbedded(t *testing.T) {
+	b := &specBuilder{schemas: make(map[string]interface{})}
+	b.schemaRef(reflect.TypeOf(api.BatchItemSerial{}))
+	item := b.schemas["BatchItem"].(map[string]interface{})
+	props := item["properties"].(map[string]interface{})
+	if _, ok := props["cid"]; !ok {
+		t.Error("the fields of the pin should be inlined:", props)
+	}
+	if _, ok := props["unpin"]; !ok {
+		t.Error("expected an unpin property:", props)
+	}
+}
+
+func TestSpecPath(t *testing.T) {
+	p := specPath("/pins/{keyType:ipfs|ipns}/{path:.+}")
+	if p != "/pins/{keyType}/{path}" {
+		t.Error("unexpected path:", p)
+	}
+	if p := specPath("/pins/{hash}"); p != "/pins/{hash}" {
+		t.Error("unexpected path:", p)
+	}
+}
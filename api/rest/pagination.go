@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// Sort orders for the pin listing endpoints.
+const (
+	sortByCid  = "cid"
+	sortByName = "name"
+	sortByTS   = "ts"
+)
+
+// listOptions selects a page of a pin listing: items are sorted, those
+// up to the cursor Cid (only when sorting by Cid) and the first offset
+// of the rest are skipped, and at most limit are returned (0 means no
+// limit). Listings are sorted by Cid when no sort is given.
+type listOptions struct {
+	limit  int
+	offset int
+	cursor string
+	sort   string
+}
+
+// parseListOptionsOrError reads the limit, offset, cursor and sort query
+// parameters. Only the given sort orders are accepted. It sends a 400
+// error and returns false when they are not valid.
+func parseListOptionsOrError(w http.ResponseWriter, r *http.Request, sorts ...string) (listOptions, bool) {
+	queryValues := r.URL.Query()
+	opts := listOptions{}
+
+	parseInt := func(name string) (int, bool) {
+		v := queryValues.Get(name)
+		if v == "" {
+			return 0, true
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			sendErrorResponse(w, 400, fmt.Sprintf("error parsing %s: must be 0 or greater", name))
+			return 0, false
+		}
+		return n, true
+	}
+
+	var ok bool
+	if opts.limit, ok = parseInt("limit"); !ok {
+		return opts, false
+	}
+	if opts.offset, ok = parseInt("offset"); !ok {
+		return opts, false
+	}
+
+	if s := queryValues.Get("sort"); s != "" {
+		opts.sort = ""
+		for _, allowed := range sorts {
+			if s == allowed {
+				opts.sort = s
+			}
+		}
+		if opts.sort == "" {
+			sendErrorResponse(w, 400, fmt.Sprintf("unsupported sort order: %s", s))
+			return opts, false
+		}
+	}
+
+	if c := queryValues.Get("cursor"); c != "" {
+		if opts.sort != "" && opts.sort != sortByCid {
+			sendErrorResponse(w, 400, "cursor can only be used when sorting by cid")
+			return opts, false
+		}
+		if _, err := cid.Decode(c); err != nil {
+			sendErrorResponse(w, 400, "error decoding cursor: "+err.Error())
+			return opts, false
+		}
+		opts.cursor = c
+		opts.sort = sortByCid
+	}
+	return opts, true
+}
+
+// page returns the bounds of the page in a sorted listing of n items.
+func (opts listOptions) page(n int) (int, int) {
+	start := opts.offset
+	if start > n {
+		start = n
+	}
+	end := n
+	if opts.limit > 0 && start+opts.limit < n {
+		end = start + opts.limit
+	}
+	return start, end
+}
+
+// pinsPage returns the options to fetch the selected page of the
+// pinset from the cluster.
+func (opts listOptions) pinsPage() types.PinsPage {
+	return types.PinsPage{
+		After:  opts.cursor,
+		Offset: opts.offset,
+		Limit:  opts.limit,
+		ByName: opts.sort == sortByName,
+	}
+}
+
+// sortByLastUpdate sorts the given items by their last update, most
+// recent first.
+func sortByLastUpdate(gpis []types.GlobalPinInfoSerial) {
+	sort.Slice(gpis, func(i, j int) bool {
+		ti, tj := lastUpdate(gpis[i]), lastUpdate(gpis[j])
+		if ti != tj {
+			return ti > tj
+		}
+		return gpis[i].Cid < gpis[j].Cid
+	})
+}
+
+// lastUpdate returns the most recent timestamp among the peers in a
+// GlobalPinInfo. Timestamps are in UTC RFC3339 format, so they can be
+// compared as strings.
+func lastUpdate(gpi types.GlobalPinInfoSerial) string {
+	ts := ""
+	for _, pi := range gpi.PeerMap {
+		if pi.TS > ts {
+			ts = pi.TS
+		}
+	}
+	return ts
+}
@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestSortByLastUpdate(t *testing.T) {
+	gpi := func(c, ts string) api.GlobalPinInfoSerial {
+		return api.GlobalPinInfoSerial{
+			Cid: c,
+			PeerMap: map[string]api.PinInfoSerial{
+				test.TestPeerID1.Pretty(): {Cid: c, TS: ts},
+			},
+		}
+	}
+	gpis := []api.GlobalPinInfoSerial{
+		gpi(test.TestCid1, "2018-01-01T10:00:00Z"),
+		gpi(test.TestCid2, "2018-01-03T10:00:00Z"),
+		gpi(test.TestCid3, "2018-01-02T10:00:00Z"),
+	}
+
+	sortByLastUpdate(gpis)
+	if gpis[0].Cid != test.TestCid2 || gpis[1].Cid != test.TestCid3 ||
+		gpis[2].Cid != test.TestCid1 {
+		t.Error("items should be sorted by last update, most recent first")
+	}
+}
+
+func TestPinsPage(t *testing.T) {
+	opts := listOptions{sort: sortByName, offset: 1, limit: 2}
+	page := opts.pinsPage()
+	if !page.ByName || page.Offset != 1 || page.Limit != 2 || page.After != "" {
+		t.Error("unexpected pins page:", page)
+	}
+
+	opts = listOptions{cursor: test.TestCid1}
+	if page := opts.pinsPage(); page.ByName || page.After != test.TestCid1 {
+		t.Error("unexpected pins page:", page)
+	}
+}
@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+)
+
+// rateLimiter allows a limited number of requests from each client during
+// a period of time, and optionally from all of them together. All the
+// counts are reset when a new period starts. A limit of 0 means no limit.
+type rateLimiter struct {
+	mux    sync.Mutex
+	limit  int
+	limits map[string]int
+	global int
+	period time.Duration
+	start  time.Time
+	counts map[string]int
+	total  int
+}
+
+// newRateLimiter returns a rateLimiter which allows limit requests per
+// period from every client.
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		period: period,
+		start:  time.Now(),
+		counts: make(map[string]int),
+	}
+}
+
+// rateLimit is the outcome of accounting for a request.
+type rateLimit struct {
+	allowed   bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// take accounts for a request from the given client when neither its limit
+// nor the global one have been reached.
+func (rl *rateLimiter) take(client string) rateLimit {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.start) >= rl.period {
+		rl.start = now
+		rl.counts = make(map[string]int)
+		rl.total = 0
+	}
+
+	limit, ok := rl.limits[client]
+	if !ok {
+		limit = rl.limit
+	}
+	rlim := rateLimit{
+		limit: limit,
+		reset: rl.start.Add(rl.period),
+	}
+
+	count := rl.counts[client]
+	if (limit > 0 && count >= limit) || (rl.global > 0 && rl.total >= rl.global) {
+		return rlim
+	}
+	rl.counts[client]++
+	rl.total++
+	rlim.allowed = true
+	if limit > 0 {
+		rlim.remaining = limit - count - 1
+	}
+	return rlim
+}
+
+// wrap returns a handler which answers with a 429 error to the clients
+// which exceed the limits. client identifies the client making a request.
+// The limits are reported in the X-RateLimit-* headers.
+func (rl *rateLimiter) wrap(h http.HandlerFunc, client func(*http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rlim := rl.take(client(r))
+		if rlim.limit > 0 {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rlim.limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(rlim.remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(rlim.reset.Unix(), 10))
+		}
+		if !rlim.allowed {
+			retry := int(time.Until(rlim.reset).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			sendJSONResponse(w, 429, types.Error{
+				Code:    429,
+				Message: "Too many requests",
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// remoteHost identifies clients by their address.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientID identifies clients by the username or the name of the token
+// they authenticate with, or otherwise by their address. Requests must
+// have been authenticated already.
+func (api *API) clientID(r *http.Request) string {
+	if name, ok := api.config.credentials().Authorize(r.Header.Get("Authorization")); ok {
+		return name
+	}
+	return remoteHost(r)
+}
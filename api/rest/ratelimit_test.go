@@ -0,0 +1,37 @@
+package rest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(2, time.Minute)
+	rl.limits = map[string]int{"ci": 0, "bob": 1}
+	rl.global = 5
+
+	rlim := rl.take("alice")
+	if !rlim.allowed || rlim.limit != 2 || rlim.remaining != 1 {
+		t.Error("unexpected limit:", rlim)
+	}
+	rl.take("alice")
+	if rl.take("alice").allowed {
+		t.Error("alice should have reached her limit")
+	}
+
+	if !rl.take("bob").allowed || rl.take("bob").allowed {
+		t.Error("bob should be limited to 1 request")
+	}
+
+	if !rl.take("ci").allowed || !rl.take("ci").allowed {
+		t.Error("ci should not be limited")
+	}
+	if rl.take("ci").allowed {
+		t.Error("the global limit should have been reached")
+	}
+
+	rl.start = time.Now().Add(-time.Minute)
+	if !rl.take("alice").allowed {
+		t.Error("the limits should have been reset")
+	}
+}
@@ -0,0 +1,21 @@
+package rest
+
+import "net/http"
+
+// queryRoutes lists the routes which do not use the GET method but do not
+// change anything either. They are served in read-only mode.
+var queryRoutes = map[string]bool{
+	"AllocationPreview":   true,
+	"SimulateAllocations": true,
+}
+
+// readOnlyRoute returns true when a route is served in read-only mode.
+func readOnlyRoute(r route) bool {
+	return r.Method == "GET" || queryRoutes[r.Name]
+}
+
+// rejectReadOnly answers the requests to the routes which are disabled in
+// read-only mode.
+func rejectReadOnly(w http.ResponseWriter, r *http.Request) {
+	sendErrorResponse(w, 403, "the API is in read-only mode")
+}
@@ -0,0 +1,92 @@
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader carries the ID of a request. Clients may choose it, so
+// that they can find their requests in the logs of the peers. Otherwise,
+// one is generated. It is always sent back in the response.
+//
+// The ID of the requests which pin or unpin items is carried to the peers
+// which commit and track them, and it is part of their log lines.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of the request IDs chosen by
+// clients.
+const maxRequestIDLength = 128
+
+// traceRequests wraps a handler so that every request has an ID, which is
+// sent back in the response and logged along with its outcome. Failed
+// requests are logged as warnings.
+func traceRequests(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		h(rec, r)
+		elapsed := time.Since(start)
+
+		if rec.status >= 500 {
+			logger.Warningf("request %s: %s %s: %d (%s)", id, r.Method, r.URL.Path, rec.status, elapsed)
+			return
+		}
+		logger.Debugf("request %s: %s %s: %d (%s)", id, r.Method, r.URL.Path, rec.status, elapsed)
+	}
+}
+
+// requestID returns the ID of a request handled by traceRequests.
+func requestID(r *http.Request) string {
+	return r.Header.Get(RequestIDHeader)
+}
+
+// validRequestID returns true for non-empty IDs made of letters, digits
+// and "-", "_", ".", ":", up to maxRequestIDLength characters. Other IDs
+// are replaced, as they end up in log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// statusRecorder keeps the status code written to a ResponseWriter. It
+// can be flushed, so streamed responses are not buffered.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
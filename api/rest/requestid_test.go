@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceRequests(t *testing.T) {
+	var seen string
+	h := traceRequests(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+		sendEmptyResponse(w, nil)
+	})
+
+	do := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/pins/a", nil)
+		if id != "" {
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	w := do("client-id:1")
+	if seen != "client-id:1" || w.Header().Get(RequestIDHeader) != "client-id:1" {
+		t.Error("the ID chosen by the client should be used:", seen)
+	}
+
+	for _, id := range []string{"", "bad id", strings.Repeat("a", maxRequestIDLength+1)} {
+		w = do(id)
+		got := w.Header().Get(RequestIDHeader)
+		if got == "" || got == id || got != seen {
+			t.Errorf("a new ID should replace %q: %q", id, got)
+		}
+	}
+
+	if do("").Header().Get(RequestIDHeader) == w.Header().Get(RequestIDHeader) {
+		t.Error("generated IDs should be different")
+	}
+}
+
+func TestAPIRequestIDPropagation(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	req, _ := http.NewRequest("GET", apiHost+"/id", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get(RequestIDHeader) != "abc" {
+		t.Error("the request ID should be sent back")
+	}
+
+	r := httptest.NewRequest("POST", "/pins/a", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	if pin := pinWithOptions("a", r); pin.RequestID != "abc" {
+		t.Error("pins should carry the request ID")
+	}
+}
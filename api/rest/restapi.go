@@ -3,24 +3,34 @@
 package rest
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	types "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/auth"
 
 	mux "github.com/gorilla/mux"
 	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-host"
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr-net"
+	multihash "github.com/multiformats/go-multihash"
 )
 
 var logger = logging.Logger("restapi")
@@ -39,6 +49,9 @@ type API struct {
 
 	listener net.Listener
 	server   *http.Server
+	// p2pListener accepts the libp2p streams for the API, when it is
+	// served over libp2p.
+	p2pListener net.Listener
 
 	shutdownLock sync.Mutex
 	shutdown     bool
@@ -110,40 +123,75 @@ func newAPI(cfg *Config, l net.Listener) (*API, error) {
 }
 
 func (api *API) addRoutes(router *mux.Router) {
+	var idempotency *idempotencyCache
+	if api.config.IdempotencyWindow > 0 {
+		idempotency = newIdempotencyCache(api.config.IdempotencyWindow)
+	}
+
+	var limiter *rateLimiter
+	if api.config.rateLimitEnabled() {
+		limiter = newRateLimiter(api.config.RateLimit, time.Minute)
+		limiter.limits = api.config.ClientRateLimits
+		limiter.global = api.config.GlobalRateLimit
+	}
+
+	wrap := func(h http.HandlerFunc) http.HandlerFunc {
+		// requests are authenticated before being limited, so
+		// clients are identified by their verified credentials.
+		if limiter != nil {
+			h = limiter.wrap(h, api.clientID)
+		}
+		if api.config.authEnabled() {
+			h = authenticate(h, api.config.credentials())
+		}
+		return traceRequests(h)
+	}
+
 	for _, route := range api.routes() {
-		if api.config.BasicAuthCreds != nil {
-			route.HandlerFunc = basicAuth(route.HandlerFunc, api.config.BasicAuthCreds)
+		h := route.HandlerFunc
+		if api.config.ReadOnly && !readOnlyRoute(route) {
+			h = rejectReadOnly
 		}
-		router.
-			Methods(route.Method).
-			Path(route.Pattern).
-			Name(route.Name).
-			Handler(route.HandlerFunc)
+		if idempotency != nil && idempotentRoutes[route.Name] {
+			h = idempotency.wrap(h)
+		}
+		h = wrap(h)
+		addVersionedRoute(router, route, h)
+		if route.Name == "Spec" {
+			router.
+				Methods("GET").
+				Path(legacySpecPath).
+				Name("LegacyV0Spec").
+				Handler(legacy(h))
+		}
+	}
+
+	router.
+		Methods("GET").
+		Path(VersionsPath).
+		Name("Versions").
+		Handler(wrap(api.versionsHandler))
+
+	// public routes never require authentication, but they are
+	// rate-limited as anyone may reach them.
+	if api.config.EnablePublicStatus {
+		publicLimiter := newRateLimiter(api.config.PublicStatusLimit, time.Minute)
+		route := route{"PublicStatus", "GET", "/public/status", nil}
+		addVersionedRoute(router, route, traceRequests(publicLimiter.wrap(api.publicStatusHandler, remoteHost)))
 	}
 	api.router = router
 }
 
-func basicAuth(h http.HandlerFunc, credentials map[string]string) http.HandlerFunc {
+// authenticate wraps a handler so that it only serves requests carrying
+// valid Basic Authentication credentials or a valid Bearer token.
+func authenticate(h http.HandlerFunc, creds auth.Credentials) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		username, password, ok := r.BasicAuth()
-		if !ok {
-			resp, err := unauthorizedResp()
-			if err != nil {
-				logger.Error(err)
-				return
-			}
-			http.Error(w, resp, 401)
-			return
+		for _, challenge := range creds.Challenges() {
+			w.Header().Add("WWW-Authenticate", challenge)
 		}
 
-		authorized := false
-		for u, p := range credentials {
-			if u == username && p == password {
-				authorized = true
-			}
-		}
-		if !authorized {
+		name, ok := creds.Authorize(r.Header.Get("Authorization"))
+		if !ok {
 			resp, err := unauthorizedResp()
 			if err != nil {
 				logger.Error(err)
@@ -152,6 +200,7 @@ func basicAuth(h http.HandlerFunc, credentials map[string]string) http.HandlerFu
 			http.Error(w, resp, 401)
 			return
 		}
+		logger.Debugf("request authorized for %s", name)
 		h.ServeHTTP(w, r)
 	}
 }
@@ -181,6 +230,48 @@ func (api *API) routes() []route {
 			api.versionHandler,
 		},
 
+		{
+			"Health",
+			"GET",
+			"/health",
+			api.healthHandler,
+		},
+
+		{
+			"SyncStatus",
+			"GET",
+			"/health/sync",
+			api.syncStatusHandler,
+		},
+
+		{
+			"HealthGraph",
+			"GET",
+			"/health/graph",
+			api.healthGraphHandler,
+		},
+
+		{
+			"PeersHealth",
+			"GET",
+			"/health/peers",
+			api.peersHealthHandler,
+		},
+
+		{
+			"TrackerMetrics",
+			"GET",
+			"/monitor/tracker",
+			api.trackerMetricsHandler,
+		},
+
+		{
+			"IPFSLocalPins",
+			"GET",
+			"/ipfs/pins/local",
+			api.ipfsLocalPinsHandler,
+		},
+
 		{
 			"Peers",
 			"GET",
@@ -199,25 +290,103 @@ func (api *API) routes() []route {
 			"/peers/{peer}",
 			api.peerRemoveHandler,
 		},
+		{
+			"PeerRemoval",
+			"GET",
+			"/peers/{peer}/removal",
+			api.peerRemovalHandler,
+		},
+		{
+			"MaintenancePeers",
+			"GET",
+			"/peers/maintenance",
+			api.maintenancePeersHandler,
+		},
+		{
+			"PeerMaintenance",
+			"POST",
+			"/peers/{peer}/maintenance",
+			api.peerMaintenanceHandler,
+		},
 
+		{
+			"ResolveMultihash",
+			"GET",
+			"/multihash/{hash}",
+			api.resolveMultihashHandler,
+		},
 		{
 			"Allocations",
 			"GET",
 			"/allocations",
 			api.allocationsHandler,
 		},
+		{
+			"DuplicatePins",
+			"GET",
+			"/allocations/duplicates",
+			api.duplicatePinsHandler,
+		},
+		{
+			"MergeDuplicatePins",
+			"POST",
+			"/allocations/duplicates/merge",
+			api.mergeDuplicatePinsHandler,
+		},
+		{
+			"StateStats",
+			"GET",
+			"/allocations/stats",
+			api.stateStatsHandler,
+		},
+		{
+			"AllocationDecisions",
+			"GET",
+			"/allocations/decisions",
+			api.allocationDecisionsHandler,
+		},
 		{
 			"Allocation",
 			"GET",
 			"/allocations/{hash}",
 			api.allocationHandler,
 		},
+		{
+			"AllocationHistory",
+			"GET",
+			"/allocations/{hash}/history",
+			api.allocationHistoryHandler,
+		},
+		{
+			"AllocationPreview",
+			"POST",
+			"/allocations/preview",
+			api.allocationPreviewHandler,
+		},
+		{
+			"SimulateAllocations",
+			"POST",
+			"/allocations/simulate",
+			api.simulateAllocationsHandler,
+		},
 		{
 			"StatusAll",
 			"GET",
 			"/pins",
 			api.statusAllHandler,
 		},
+		{
+			"PinBatch",
+			"POST",
+			"/pins",
+			api.pinBatchHandler,
+		},
+		{
+			"Batch",
+			"POST",
+			"/pins/batch",
+			api.batchHandler,
+		},
 		{
 			"SyncAll",
 			"POST",
@@ -230,12 +399,48 @@ func (api *API) routes() []route {
 			"/pins/recover",
 			api.recoverAllHandler,
 		},
+		{
+			"PinLog",
+			"GET",
+			"/pins/log",
+			api.pinLogHandler,
+		},
+		{
+			"Events",
+			"GET",
+			"/events",
+			api.eventsHandler,
+		},
+		{
+			"PinPath",
+			"POST",
+			"/pins/{keyType:ipfs|ipns}/{path:.+}",
+			api.pinPathHandler,
+		},
+		{
+			"UnpinPath",
+			"DELETE",
+			"/pins/{keyType:ipfs|ipns}/{path:.+}",
+			api.unpinPathHandler,
+		},
+		{
+			"PinSummary",
+			"GET",
+			"/pins/summary",
+			api.pinSummaryHandler,
+		},
 		{
 			"Status",
 			"GET",
 			"/pins/{hash}",
 			api.statusHandler,
 		},
+		{
+			"Add",
+			"POST",
+			"/add",
+			api.addHandler,
+		},
 		{
 			"Pin",
 			"POST",
@@ -260,6 +465,101 @@ func (api *API) routes() []route {
 			"/pins/{hash}/recover",
 			api.recoverHandler,
 		},
+		{
+			"CancelPin",
+			"POST",
+			"/pins/{hash}/cancel",
+			api.cancelPinHandler,
+		},
+
+		{
+			"ScalingAdvice",
+			"GET",
+			"/scaling",
+			api.scalingAdviceHandler,
+		},
+
+		{
+			"LogLevel",
+			"POST",
+			"/log/level",
+			api.logLevelHandler,
+		},
+
+		{
+			"Snapshot",
+			"POST",
+			"/consensus/snapshot",
+			api.snapshotHandler,
+		},
+		{
+			"ConsensusStatus",
+			"GET",
+			"/consensus/status",
+			api.consensusStatusHandler,
+		},
+		{
+			"StateVerify",
+			"GET",
+			"/state/verify",
+			api.stateVerifyHandler,
+		},
+
+		{
+			"Namespaces",
+			"GET",
+			"/namespaces",
+			api.namespacesHandler,
+		},
+		{
+			"NamespacePins",
+			"GET",
+			"/namespaces/{namespace}/pins",
+			api.namespacePinsHandler,
+		},
+		{
+			"NamespacePin",
+			"POST",
+			"/namespaces/{namespace}/pins/{hash}",
+			api.pinHandler,
+		},
+		{
+			"NamespaceUnpin",
+			"DELETE",
+			"/namespaces/{namespace}/pins/{hash}",
+			api.unpinHandler,
+		},
+		{
+			"NamespaceAllocation",
+			"GET",
+			"/namespaces/{namespace}/pins/{hash}",
+			api.allocationHandler,
+		},
+
+		{
+			"AllocationStrategy",
+			"POST",
+			"/allocations/strategy",
+			api.allocationStrategyHandler,
+		},
+		{
+			"RuntimeConfig",
+			"POST",
+			"/config/runtime",
+			api.runtimeConfigHandler,
+		},
+		{
+			"RPCCall",
+			"POST",
+			"/rpc",
+			api.rpcCallHandler,
+		},
+		{
+			"Spec",
+			"GET",
+			"/spec",
+			api.specHandler,
+		},
 	}
 }
 
@@ -269,6 +569,18 @@ func (api *API) run() {
 		defer api.wg.Done()
 		<-api.rpcReady
 
+		if l := api.p2pListener; l != nil {
+			api.wg.Add(1)
+			go func() {
+				defer api.wg.Done()
+				logger.Infof("REST API (libp2p): /ipfs/%s", l.Addr())
+				err := api.server.Serve(l)
+				if err != nil && err != errListenerClosed {
+					logger.Error(err)
+				}
+			}()
+		}
+
 		logger.Infof("REST API: %s", api.config.ListenAddr)
 		err := api.server.Serve(api.listener)
 		if err != nil && !strings.Contains(err.Error(), "closed network connection") {
@@ -277,6 +589,23 @@ func (api *API) run() {
 	}()
 }
 
+// SetHost makes the API available to other libp2p hosts, over streams
+// for the RESTLibp2pProtocol opened to the given host, when the
+// configuration enables it. Only peers which can connect to the host
+// (that is, which know the cluster secret) can reach it this way. It
+// must be called before SetClient.
+func (api *API) SetHost(h host.Host) {
+	if !api.config.EnableLibp2p {
+		return
+	}
+	api.shutdownLock.Lock()
+	defer api.shutdownLock.Unlock()
+	if api.shutdown || api.p2pListener != nil {
+		return
+	}
+	api.p2pListener = newStreamListener(h)
+}
+
 // Shutdown stops any API listeners.
 func (api *API) Shutdown() error {
 	api.shutdownLock.Lock()
@@ -294,6 +623,9 @@ func (api *API) Shutdown() error {
 	// Cancel any outstanding ops
 	api.server.SetKeepAlivesEnabled(false)
 	api.listener.Close()
+	if api.p2pListener != nil {
+		api.p2pListener.Close()
+	}
 
 	api.wg.Wait()
 	api.shutdown = true
@@ -318,6 +650,39 @@ func (api *API) idHandler(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, err, idSerial)
 }
 
+// ipfsLocalPinsHandler streams the list of local IPFS pins, writing
+// and flushing one item at a time, as it may be very long.
+func (api *API) ipfsLocalPinsHandler(w http.ResponseWriter, r *http.Request) {
+	var localPins []types.LocalPinSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"IPFSLocalPins",
+		struct{}{},
+		&localPins)
+	if !checkRPCErr(w, err) {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	w.Write([]byte("["))
+	for i, lp := range localPins {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		if err := enc.Encode(lp); err != nil {
+			logger.Error(err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	w.Write([]byte("]\n"))
+}
+
 func (api *API) versionHandler(w http.ResponseWriter, r *http.Request) {
 	var v types.Version
 	err := api.rpcClient.Call("",
@@ -329,6 +694,71 @@ func (api *API) versionHandler(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, err, v)
 }
 
+func (api *API) healthHandler(w http.ResponseWriter, r *http.Request) {
+	var health types.HealthSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"Health",
+		struct{}{},
+		&health)
+
+	sendResponse(w, err, health)
+}
+
+func (api *API) syncStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var status types.SyncStatusSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"SyncStatus",
+		struct{}{},
+		&status)
+
+	sendResponse(w, err, status)
+}
+
+func (api *API) healthGraphHandler(w http.ResponseWriter, r *http.Request) {
+	var graph types.ConnectGraphSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"ConnectGraph",
+		struct{}{},
+		&graph)
+
+	sendResponse(w, err, graph)
+}
+
+func (api *API) peersHealthHandler(w http.ResponseWriter, r *http.Request) {
+	var lives []types.PeerLivenessSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"PeersLiveness",
+		struct{}{},
+		&lives)
+
+	sendResponse(w, err, lives)
+}
+
+func (api *API) trackerMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	var metrics types.TrackerMetricsSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"TrackerMetrics",
+		struct{}{},
+		&metrics)
+
+	sendResponse(w, err, metrics)
+}
+
+func (api *API) publicStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var status types.PublicStatus
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"PublicStatus",
+		struct{}{},
+		&status)
+	sendResponse(w, err, status)
+}
+
 func (api *API) peerListHandler(w http.ResponseWriter, r *http.Request) {
 	var peersSerial []types.IDSerial
 	err := api.rpcClient.Call("",
@@ -377,48 +807,577 @@ func (api *API) peerRemoveHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
-	if ps := parseCidOrError(w, r); ps.Cid != "" {
-		logger.Debugf("rest api pinHandler: %s", ps.Cid)
-
-		err := api.rpcClient.Call("",
-			"Cluster",
-			"Pin",
-			ps,
-			&struct{}{})
-		sendAcceptedResponse(w, err)
-		logger.Debug("rest api pinHandler done")
-	}
-}
-
-func (api *API) unpinHandler(w http.ResponseWriter, r *http.Request) {
-	if ps := parseCidOrError(w, r); ps.Cid != "" {
-		logger.Debugf("rest api unpinHandler: %s", ps.Cid)
+func (api *API) peerRemovalHandler(w http.ResponseWriter, r *http.Request) {
+	if p := parsePidOrError(w, r); p != "" {
+		var pr types.PeerRemovalSerial
 		err := api.rpcClient.Call("",
 			"Cluster",
-			"Unpin",
-			ps,
-			&struct{}{})
-		sendAcceptedResponse(w, err)
-		logger.Debug("rest api unpinHandler done")
+			"PeerRemoval",
+			p,
+			&pr)
+		if err != nil { // errors here are 404s
+			sendErrorResponse(w, 404, err.Error())
+			return
+		}
+		sendJSONResponse(w, 200, pr)
 	}
 }
 
-func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
-	var pins []types.PinSerial
+func (api *API) maintenancePeersHandler(w http.ResponseWriter, r *http.Request) {
+	var peers []string
 	err := api.rpcClient.Call("",
 		"Cluster",
-		"Pins",
+		"MaintenancePeers",
 		struct{}{},
-		&pins)
-	sendResponse(w, err, pins)
+		&peers)
+	sendResponse(w, err, peers)
 }
 
-func (api *API) allocationHandler(w http.ResponseWriter, r *http.Request) {
-	if ps := parseCidOrError(w, r); ps.Cid != "" {
-		var pin types.PinSerial
-		err := api.rpcClient.Call("",
-			"Cluster",
+func (api *API) peerMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if p := parsePidOrError(w, r); p != "" {
+		enabledStr := r.URL.Query().Get("enabled")
+		enabled, err := strconv.ParseBool(enabledStr)
+		if err != nil {
+			sendErrorResponse(w, 400, "error parsing enabled: "+err.Error())
+			return
+		}
+
+		pm := types.PeerMaintenance{
+			Peer:    p,
+			Enabled: enabled,
+		}
+		err = api.rpcClient.Call("",
+			"Cluster",
+			"PeerMaintenance",
+			pm.ToSerial(),
+			&struct{}{})
+		sendEmptyResponse(w, err)
+	}
+}
+
+func (api *API) resolveMultihashHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	mh, err := decodeMultihash(vars["hash"])
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding multihash: "+err.Error())
+		return
+	}
+
+	var resolved types.ResolvedMultihash
+	err = api.rpcClient.Call("",
+		"Cluster",
+		"ResolveMultihash",
+		mh.B58String(),
+		&resolved)
+	sendResponse(w, err, resolved)
+}
+
+func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := api.parseCidOrMultihashOrError(w, r); ps.Cid != "" {
+		logger.Debugf("rest api pinHandler: %s", ps.Cid)
+
+		wait, timeout, ok := api.parseWaitOrError(w, r)
+		if !ok {
+			return
+		}
+
+		if r.URL.Query().Get("inline") == "true" {
+			var data []byte
+			err := api.rpcClient.Call("",
+				"Cluster",
+				"IPFSBlockGet",
+				ps,
+				&data)
+			if err != nil {
+				sendErrorResponse(w, 500, "error fetching inline content: "+err.Error())
+				return
+			}
+			ps.Inline = data
+		}
+
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"Pin",
+			ps,
+			&struct{}{})
+		if err != nil {
+			sendPinError(w, err, err.Error())
+			return
+		}
+		if wait {
+			api.waitForPin(w, ps, timeout)
+			return
+		}
+		sendAcceptedResponse(w, nil)
+		logger.Debug("rest api pinHandler done")
+	}
+}
+
+// sendPinError sends the error of a Pin request with the given message:
+// a 400 when the pin is invalid, a 403 with the details of the exceeded
+// quota, or a 500 with the candidates discarded by a failed allocation,
+// if any.
+func sendPinError(w http.ResponseWriter, err error, msg string) {
+	code, details := pinErrorStatus(err)
+	sendErrorResponseWithDetails(w, code, msg, details)
+}
+
+// pinErrorStatus returns the status code and the details of the error
+// response for an error pinning.
+func pinErrorStatus(err error) (int, map[string]string) {
+	if types.IsInvalidPinError(err.Error()) {
+		return 400, nil
+	}
+	if details, ok := types.QuotaErrorDetails(err.Error()); ok {
+		return 403, details
+	}
+	details, _ := types.AllocationErrorDetails(err.Error())
+	return 500, details
+}
+
+// pinPathHandler pins the Cid that an IPFS or IPNS path resolves to. The
+// pin, which records the path, is sent back so that clients learn the Cid.
+func (api *API) pinPathHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := api.parsePathOrError(w, r); ps.Cid != "" {
+		logger.Debugf("rest api pinPathHandler: %s (%s)", ps.Path, ps.Cid)
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"Pin",
+			ps,
+			&struct{}{})
+		if err != nil {
+			sendPinError(w, err, err.Error())
+			return
+		}
+		sendJSONResponse(w, 202, ps)
+	}
+}
+
+// unpinPathHandler unpins the Cid that an IPFS or IPNS path currently
+// resolves to.
+func (api *API) unpinPathHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := api.parsePathOrError(w, r); ps.Cid != "" {
+		logger.Debugf("rest api unpinPathHandler: %s (%s)", ps.Path, ps.Cid)
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"Unpin",
+			ps,
+			&struct{}{})
+		if checkRPCErr(w, err) {
+			sendJSONResponse(w, 202, ps)
+		}
+	}
+}
+
+// addChunkSize is the size of the pieces in which the body of an add
+// request is sent to the IPFS connector.
+const addChunkSize = 256 * 1024
+
+// addHandler adds the files in a multipart request to IPFS, like "ipfs
+// add", and pins the resulting roots in cluster with the options in the
+// query. The body is sent to the IPFS connector in chunks as it is read.
+func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		sendErrorResponse(w, 400, "the request body must be multipart/form-data")
+		return
+	}
+
+	queryValues := r.URL.Query()
+	params := types.AddParams{
+		Chunker:           queryValues.Get("chunker"),
+		RawLeaves:         queryValues.Get("raw-leaves") == "true",
+		WrapWithDirectory: queryValues.Get("wrap-with-directory") == "true",
+	}
+
+	session := make([]byte, 16)
+	rand.Read(session)
+	added, err := api.sendAddBody(r.Body, types.AddChunk{
+		Session:     hex.EncodeToString(session),
+		Params:      params,
+		ContentType: contentType,
+	})
+	if err != nil {
+		sendErrorResponse(w, 500, "error adding content to IPFS: "+err.Error())
+		return
+	}
+
+	for _, root := range addedRoots(added, params.WrapWithDirectory) {
+		pin := pinWithOptions(root.Cid, r)
+		if pin.Name == "" {
+			pin.Name = root.Name
+		}
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"Pin",
+			pin,
+			&struct{}{})
+		if err != nil {
+			sendPinError(w, err, fmt.Sprintf("%s was added but pinning it failed: %s", root.Cid, err))
+			return
+		}
+	}
+	sendJSONResponse(w, 200, added)
+}
+
+// sendAddBody sends the body of an add request to the IPFS connector, one
+// chunk at a time, and returns the added items.
+func (api *API) sendAddBody(body io.Reader, chunk types.AddChunk) ([]types.AddedOutputSerial, error) {
+	buf := make([]byte, addChunkSize)
+	for {
+		n, err := io.ReadFull(body, buf)
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			chunk.Last = true
+		default:
+			api.cancelAdd(chunk)
+			return nil, err
+		}
+
+		chunk.Data = buf[:n]
+		var added []types.AddedOutputSerial
+		err = api.rpcClient.Call("",
+			"Cluster",
+			"IPFSAdd",
+			chunk,
+			&added)
+		if err != nil && !chunk.Last {
+			// the session may still be waiting for chunks
+			api.cancelAdd(chunk)
+		}
+		if err != nil || chunk.Last {
+			return added, err
+		}
+	}
+}
+
+// cancelAdd aborts the add session of a chunk in the IPFS connector.
+func (api *API) cancelAdd(chunk types.AddChunk) {
+	chunk.Data = nil
+	chunk.Cancel = true
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"IPFSAdd",
+		chunk,
+		&[]types.AddedOutputSerial{})
+	if err != nil {
+		logger.Errorf("error cancelling add session %s: %s", chunk.Session, err)
+	}
+}
+
+// addedRoots returns the items which ipfs would have pinned after adding
+// them: the wrapping directory, or otherwise every item at the top level
+// (files and directories which are not inside any other).
+func addedRoots(added []types.AddedOutputSerial, wrapped bool) []types.AddedOutputSerial {
+	if len(added) == 0 {
+		return nil
+	}
+	if wrapped {
+		return added[len(added)-1:]
+	}
+	var roots []types.AddedOutputSerial
+	for _, ao := range added {
+		if !strings.Contains(strings.Trim(ao.Name, "/"), "/") {
+			roots = append(roots, ao)
+		}
+	}
+	return roots
+}
+
+func (api *API) pinBatchHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var pins []types.PinSerial
+	err := dec.Decode(&pins)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	for i, pin := range pins {
+		_, err = cid.Decode(pin.Cid)
+		if err != nil {
+			sendErrorResponse(w, 400, "error decoding Cid: "+err.Error())
+			return
+		}
+		pins[i].RequestID = requestID(r)
+	}
+
+	logger.Debugf("rest api pinBatchHandler: %d pins", len(pins))
+	var committed int
+	err = api.rpcClient.Call("",
+		"Cluster",
+		"PinBatch",
+		pins,
+		&committed)
+	if err != nil {
+		// the first pins may have been committed
+		code, details := pinErrorStatus(err)
+		if details == nil {
+			details = make(map[string]string)
+		}
+		details["committed"] = strconv.Itoa(committed)
+		sendErrorResponseWithDetails(w, code, err.Error(), details)
+		return
+	}
+	sendAcceptedResponse(w, nil)
+}
+
+// batchHandler pins and unpins the items of a batch. It answers with the
+// outcome of every item, so the items which failed can be retried.
+func (api *API) batchHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	items, err := decodeBatch(r.Body)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body: "+err.Error())
+		return
+	}
+
+	results := make([]types.BatchResult, len(items), len(items))
+	valid := make([]types.BatchItemSerial, 0, len(items))
+	validIdx := make([]int, 0, len(items))
+	for i, item := range items {
+		results[i] = types.BatchResult{Cid: item.Cid, Unpin: item.Unpin}
+		_, err := cid.Decode(item.Cid)
+		if err != nil {
+			results[i].Error = "error decoding Cid: " + err.Error()
+			continue
+		}
+		item.RequestID = requestID(r)
+		valid = append(valid, item)
+		validIdx = append(validIdx, i)
+	}
+
+	logger.Debugf("rest api batchHandler: %d items", len(valid))
+	if len(valid) > 0 {
+		var out []types.BatchResult
+		err = api.rpcClient.Call("",
+			"Cluster",
+			"Batch",
+			valid,
+			&out)
+		if err != nil {
+			sendErrorResponse(w, 500, err.Error())
+			return
+		}
+		for j, res := range out {
+			results[validIdx[j]] = res
+		}
+	}
+	sendJSONResponse(w, 202, results)
+}
+
+// decodeBatch reads the items of a batch, given either as a JSON array or
+// as a stream of JSON objects, usually one per line (ndjson).
+func decodeBatch(r io.Reader) ([]types.BatchItemSerial, error) {
+	br := bufio.NewReader(r)
+	var first byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			first = b
+			br.UnreadByte()
+			break
+		}
+	}
+
+	var items []types.BatchItemSerial
+	dec := json.NewDecoder(br)
+	if first == '[' {
+		err := dec.Decode(&items)
+		return items, err
+	}
+	for {
+		var item types.BatchItemSerial
+		err := dec.Decode(&item)
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (api *API) unpinHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := parseCidOrError(w, r); ps.Cid != "" {
+		logger.Debugf("rest api unpinHandler: %s", ps.Cid)
+		method := "Unpin"
+		if ps.Namespace != "" {
+			method = "UnpinNamespace"
+		}
+		err := api.rpcClient.Call("",
+			"Cluster",
+			method,
+			ps,
+			&struct{}{})
+		sendAcceptedResponse(w, err)
+		logger.Debug("rest api unpinHandler done")
+	}
+}
+
+func (api *API) cancelPinHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := parseCidOrError(w, r); ps.Cid != "" {
+		logger.Debugf("rest api cancelPinHandler: %s", ps.Cid)
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"CancelPin",
+			ps,
+			&struct{}{})
+		sendAcceptedResponse(w, err)
+	}
+}
+
+func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
+	opts, ok := parseListOptionsOrError(w, r, sortByCid, sortByName)
+	if !ok {
+		return
+	}
+
+	var pins []types.PinSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"PinsPage",
+		opts.pinsPage(),
+		&pins)
+	sendResponse(w, err, pins)
+}
+
+func (api *API) pinLogHandler(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			sendErrorResponse(w, 400, "error parsing since: "+err.Error())
+			return
+		}
+	}
+
+	var entries []types.PinLogEntrySerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"PinLog",
+		since,
+		&entries)
+	if err != nil { // the requested entries are not available
+		sendErrorResponse(w, http.StatusGone, err.Error())
+		return
+	}
+	sendJSONResponse(w, 200, entries)
+}
+
+// eventsHandler streams the events of the peer as Server-Sent Events,
+// starting after the sequence number given in ?since= or, for clients
+// which reconnect, in the Last-Event-ID header. Without them, it starts
+// with the events the peer remembers. The stream ends when the client
+// goes away, the API shuts down or the write timeout of the server
+// expires, after which clients are expected to reconnect.
+func (api *API) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	since := r.Header.Get("Last-Event-ID")
+	if s := r.URL.Query().Get("since"); s != "" {
+		since = s
+	}
+	var seq uint64
+	if since != "" {
+		var err error
+		seq, err = strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			sendErrorResponse(w, 400, "error parsing since: "+err.Error())
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendErrorResponse(w, 500, "streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-api.ctx.Done():
+			return
+		default:
+		}
+
+		var evs []types.EventSerial
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"Events",
+			seq,
+			&evs)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		for _, ev := range evs {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+			seq = ev.Seq
+		}
+		if len(evs) == 0 {
+			// a comment keeps the connection alive and lets us
+			// notice when the client is gone.
+			w.Write([]byte(":\n\n"))
+		}
+		flusher.Flush()
+	}
+}
+
+func (api *API) duplicatePinsHandler(w http.ResponseWriter, r *http.Request) {
+	var dups []types.DuplicatePinsSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"DuplicatePins",
+		struct{}{},
+		&dups)
+	sendResponse(w, err, dups)
+}
+
+func (api *API) mergeDuplicatePinsHandler(w http.ResponseWriter, r *http.Request) {
+	var dups []types.DuplicatePinsSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"MergeDuplicatePins",
+		struct{}{},
+		&dups)
+	sendResponse(w, err, dups)
+}
+
+func (api *API) stateStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var stats types.StateStatsSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"StateStats",
+		r.URL.Query().Get("delimiter"),
+		&stats)
+	sendResponse(w, err, stats)
+}
+
+func (api *API) allocationHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := parseCidOrError(w, r); ps.Cid != "" {
+		var pin types.PinSerial
+		err := api.rpcClient.Call("",
+			"Cluster",
 			"PinGet",
 			ps,
 			&pin)
@@ -426,31 +1385,338 @@ func (api *API) allocationHandler(w http.ResponseWriter, r *http.Request) {
 			sendErrorResponse(w, 404, err.Error())
 			return
 		}
-		sendJSONResponse(w, 200, pin)
+		if ns := mux.Vars(r)["namespace"]; ns != "" && pin.Namespace != ns {
+			sendErrorResponse(w, 404, "not pinned in namespace "+ns)
+			return
+		}
+		sendJSONResponse(w, 200, pin)
+	}
+}
+
+func (api *API) namespacesHandler(w http.ResponseWriter, r *http.Request) {
+	var nss []types.Namespace
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"Namespaces",
+		struct{}{},
+		&nss)
+	sendResponse(w, err, nss)
+}
+
+func (api *API) namespacePinsHandler(w http.ResponseWriter, r *http.Request) {
+	var pins []types.PinSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"NamespacePins",
+		mux.Vars(r)["namespace"],
+		&pins)
+	if err != nil { // errors here are 404s
+		sendErrorResponse(w, 404, err.Error())
+		return
+	}
+	sendJSONResponse(w, 200, pins)
+}
+
+func (api *API) allocationHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	local := queryValues.Get("local")
+
+	if ps := parseCidOrError(w, r); ps.Cid != "" {
+		method := "AllocationHistory"
+		if local == "true" {
+			method = "AllocationHistoryLocal"
+		}
+
+		var records []types.AllocationRecordSerial
+		err := api.rpcClient.Call("",
+			"Cluster",
+			method,
+			ps,
+			&records)
+		sendResponse(w, err, records)
+	}
+}
+
+func (api *API) allocationDecisionsHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	local := queryValues.Get("local")
+
+	method := "AllocationDecisions"
+	if local == "true" {
+		method = "AllocationDecisionsLocal"
+	}
+
+	var records []types.AllocationRecordSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		method,
+		struct{}{},
+		&records)
+	sendResponse(w, err, records)
+}
+
+func (api *API) allocationPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var args types.AllocationPreviewSerial
+	err := dec.Decode(&args)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	_, err = cid.Decode(args.Cid)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding Cid: "+err.Error())
+		return
+	}
+
+	var pin types.PinSerial
+	err = api.rpcClient.Call("",
+		"Cluster",
+		"AllocationPreview",
+		args,
+		&pin)
+	sendResponse(w, err, pin)
+}
+
+func (api *API) simulateAllocationsHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var pins []types.PinSerial
+	err := dec.Decode(&pins)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	for _, pin := range pins {
+		_, err = cid.Decode(pin.Cid)
+		if err != nil {
+			sendErrorResponse(w, 400, "error decoding Cid: "+err.Error())
+			return
+		}
 	}
+
+	var sim types.AllocationSimulationSerial
+	err = api.rpcClient.Call("",
+		"Cluster",
+		"SimulateAllocations",
+		pins,
+		&sim)
+	sendResponse(w, err, sim)
 }
 
+// statusChunkSize is the number of items fetched from the cluster at a
+// time when streaming the status of all pins.
+const statusChunkSize = 1000
+
+// statusAllHandler streams the status of all pins. It is fetched and
+// written in chunks, so that very large pinsets are not held in memory.
+// Pages sorted by Cid are streamed as well, and chunks are no larger than
+// needed to fill them. Other sort orders are handled by sortedStatusAll.
 func (api *API) statusAllHandler(w http.ResponseWriter, r *http.Request) {
 	queryValues := r.URL.Query()
 	local := queryValues.Get("local")
+	filter, ok := parseFilterOrError(w, r)
+	if !ok {
+		return
+	}
+	opts, ok := parseListOptionsOrError(w, r, sortByCid, sortByName, sortByTS)
+	if !ok {
+		return
+	}
 
-	if local == "true" {
-		var pinInfos []types.PinInfoSerial
+	fetch := api.statusFetcher(local == "true", filter)
+
+	// The status is listed in Cid order by default.
+	if opts.sort != "" && opts.sort != sortByCid {
+		api.sortedStatusAll(w, opts, fetch)
+		return
+	}
+
+	chunk := types.StatusChunk{After: opts.cursor, Limit: statusChunkSize}
+	if opts.limit > 0 && opts.offset+opts.limit < chunk.Limit {
+		chunk.Limit = opts.offset + opts.limit
+	}
+
+	// Errors in the first chunk can still be returned as such.
+	pinInfos, err := fetch(chunk)
+	if !checkRPCErr(w, err) {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	w.Write([]byte("["))
+	skip := opts.offset
+	written := 0
+chunks:
+	for len(pinInfos) > 0 {
+		for _, gpi := range pinInfos {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if opts.limit > 0 && written == opts.limit {
+				break chunks
+			}
+			if written > 0 {
+				w.Write([]byte(","))
+			}
+			written++
+			if err := enc.Encode(gpi); err != nil {
+				logger.Error(err)
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(pinInfos) < chunk.Limit {
+			break
+		}
+
+		chunk.After = pinInfos[len(pinInfos)-1].Cid
+		pinInfos, err = fetch(chunk)
+		if err != nil {
+			// The response has started. Leaving the JSON array
+			// unterminated lets clients notice.
+			logger.Error(err)
+			return
+		}
+	}
+	w.Write([]byte("]\n"))
+}
+
+// statusFetchFunc fetches the given chunk of the status of all pins.
+type statusFetchFunc func(types.StatusChunk) ([]types.GlobalPinInfoSerial, error)
+
+// statusFetcher returns a statusFetchFunc which fetches the status from
+// this peer or from all of them, filtered with the given filter.
+func (api *API) statusFetcher(local bool, filter types.StatusFilter) statusFetchFunc {
+	return func(chunk types.StatusChunk) ([]types.GlobalPinInfoSerial, error) {
+		chunk.Filter = filter
+		if local {
+			var pinInfos []types.PinInfoSerial
+			err := api.rpcClient.Call("",
+				"Cluster",
+				"StatusAllLocalChunk",
+				chunk,
+				&pinInfos)
+			return pinInfosToGlobal(pinInfos), err
+		}
+		var pinInfos []types.GlobalPinInfoSerial
 		err := api.rpcClient.Call("",
 			"Cluster",
-			"StatusAllLocal",
-			struct{}{},
+			"StatusAllChunk",
+			chunk,
 			&pinInfos)
-		sendResponse(w, err, pinInfosToGlobal(pinInfos))
+		return pinInfos, err
+	}
+}
+
+// sortedStatusAll sends the selected page of the status of all pins,
+// sorted by name or by last update.
+func (api *API) sortedStatusAll(w http.ResponseWriter, opts listOptions, fetch statusFetchFunc) {
+	var gpis []types.GlobalPinInfoSerial
+	var ok bool
+	if opts.sort == sortByName {
+		gpis, ok = api.statusAllByName(w, opts, fetch)
 	} else {
-		var pinInfos []types.GlobalPinInfoSerial
+		gpis, ok = api.statusAllByTS(w, opts, fetch)
+	}
+	if ok {
+		sendJSONResponse(w, 200, gpis)
+	}
+}
+
+// statusAllByName walks the pins sorted by name in chunks and fetches the
+// status of each chunk, until the page is complete. Only the Cids in the
+// shared state are listed.
+func (api *API) statusAllByName(w http.ResponseWriter, opts listOptions, fetch statusFetchFunc) ([]types.GlobalPinInfoSerial, bool) {
+	gpis := []types.GlobalPinInfoSerial{}
+	skip := opts.offset
+	page := types.PinsPage{Limit: statusChunkSize, ByName: true}
+	for {
+		var pins []types.PinSerial
 		err := api.rpcClient.Call("",
 			"Cluster",
-			"StatusAll",
-			struct{}{},
-			&pinInfos)
-		sendResponse(w, err, pinInfos)
+			"PinsPage",
+			page,
+			&pins)
+		if !checkRPCErr(w, err) {
+			return nil, false
+		}
+		if len(pins) == 0 {
+			return gpis, true
+		}
+
+		chunk := types.StatusChunk{Cids: make([]string, len(pins), len(pins))}
+		for i, p := range pins {
+			chunk.Cids[i] = p.Cid
+		}
+		byCid, err := fetch(chunk)
+		if !checkRPCErr(w, err) {
+			return nil, false
+		}
+		status := make(map[string]types.GlobalPinInfoSerial, len(byCid))
+		for _, gpi := range byCid {
+			status[gpi.Cid] = gpi
+		}
+
+		for _, p := range pins {
+			gpi, ok := status[p.Cid]
+			if !ok {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			gpis = append(gpis, gpi)
+			if opts.limit > 0 && len(gpis) == opts.limit {
+				return gpis, true
+			}
+		}
+		page.Offset += len(pins)
+	}
+}
+
+// statusAllByTS fetches the status of all pins in chunks and sorts it by
+// last update. When the page is limited, only the items which can make
+// it into the page are kept in memory.
+func (api *API) statusAllByTS(w http.ResponseWriter, opts listOptions, fetch statusFetchFunc) ([]types.GlobalPinInfoSerial, bool) {
+	keep := 0
+	if opts.limit > 0 {
+		keep = opts.offset + opts.limit
+	}
+
+	gpis := []types.GlobalPinInfoSerial{}
+	chunk := types.StatusChunk{Limit: statusChunkSize}
+	for {
+		pinInfos, err := fetch(chunk)
+		if !checkRPCErr(w, err) {
+			return nil, false
+		}
+		gpis = append(gpis, pinInfos...)
+		if keep > 0 && len(gpis) > keep {
+			sortByLastUpdate(gpis)
+			gpis = gpis[:keep]
+		}
+		if len(pinInfos) < statusChunkSize {
+			break
+		}
+		chunk.After = pinInfos[len(pinInfos)-1].Cid
 	}
+
+	sortByLastUpdate(gpis)
+	start, end := opts.page(len(gpis))
+	return gpis[start:end], true
 }
 
 func (api *API) statusHandler(w http.ResponseWriter, r *http.Request) {
@@ -529,16 +1795,26 @@ func (api *API) syncHandler(w http.ResponseWriter, r *http.Request) {
 func (api *API) recoverAllHandler(w http.ResponseWriter, r *http.Request) {
 	queryValues := r.URL.Query()
 	local := queryValues.Get("local")
+	filter, ok := parseFilterOrError(w, r)
+	if !ok {
+		return
+	}
 	if local == "true" {
 		var pinInfos []types.PinInfoSerial
 		err := api.rpcClient.Call("",
 			"Cluster",
 			"RecoverAllLocal",
-			struct{}{},
+			filter,
 			&pinInfos)
 		sendResponse(w, err, pinInfosToGlobal(pinInfos))
 	} else {
-		sendErrorResponse(w, 400, "only requests with parameter local=true are supported")
+		var globalPinInfos []types.GlobalPinInfoSerial
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"RecoverAll",
+			filter,
+			&globalPinInfos)
+		sendResponse(w, err, globalPinInfos)
 	}
 }
 
@@ -567,6 +1843,180 @@ func (api *API) recoverHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (api *API) scalingAdviceHandler(w http.ResponseWriter, r *http.Request) {
+	var adv types.ScalingAdviceSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"ScalingAdvice",
+		struct{}{},
+		&adv)
+	sendResponse(w, err, adv)
+}
+
+func (api *API) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var lvl types.LogLevel
+	err := dec.Decode(&lvl)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	if lvl.Component == "" || lvl.Level == "" {
+		sendErrorResponse(w, 400, "component and level must be set")
+		return
+	}
+
+	method := "SetLogLevel"
+	if r.URL.Query().Get("all_peers") == "true" {
+		method = "SetLogLevelAllPeers"
+	}
+
+	err = api.rpcClient.Call("",
+		"Cluster",
+		method,
+		lvl,
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+func (api *API) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"Snapshot",
+		struct{}{},
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+func (api *API) consensusStatusHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	local := queryValues.Get("local")
+
+	if local == "true" {
+		var status types.ConsensusStatusSerial
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"ConsensusStatus",
+			struct{}{},
+			&status)
+		sendResponse(w, err, []types.ConsensusStatusSerial{status})
+		return
+	}
+
+	var statuses []types.ConsensusStatusSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"ConsensusStatusAll",
+		struct{}{},
+		&statuses)
+	sendResponse(w, err, statuses)
+}
+
+func (api *API) stateVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	var diffs []types.StateDiffSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"StateVerify",
+		struct{}{},
+		&diffs)
+	sendResponse(w, err, diffs)
+}
+
+func (api *API) allocationStrategyHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var strategy types.AllocationStrategy
+	err := dec.Decode(&strategy)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	if strategy.Name == "" {
+		sendErrorResponse(w, 400, "name must be set")
+		return
+	}
+
+	method := "SetAllocationStrategy"
+	if r.URL.Query().Get("all_peers") == "true" {
+		method = "SetAllocationStrategyAllPeers"
+	}
+
+	err = api.rpcClient.Call("",
+		"Cluster",
+		method,
+		strategy,
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+func (api *API) runtimeConfigHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var rc types.RuntimeConfig
+	err := dec.Decode(&rc)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	if len(rc) == 0 {
+		sendErrorResponse(w, 400, "no configuration options given")
+		return
+	}
+
+	method := "SetRuntimeConfig"
+	if r.URL.Query().Get("all_peers") == "true" {
+		method = "SetRuntimeConfigAllPeers"
+	}
+
+	err = api.rpcClient.Call("",
+		"Cluster",
+		method,
+		rc,
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+func (api *API) rpcCallHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.config.EnableRPCCall {
+		sendErrorResponse(w, 403, "rpc calls are disabled in this peer's configuration")
+		return
+	}
+
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var args types.RPCCallSerial
+	err := dec.Decode(&args)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	if args.Peer != "" {
+		_, err = peer.IDB58Decode(args.Peer)
+		if err != nil {
+			sendErrorResponse(w, 400, "error decoding Peer ID: "+err.Error())
+			return
+		}
+	}
+
+	logger.Warningf("rest api rpcCallHandler: %s.%s on %s", args.Service, args.Method, args.Peer)
+	var res []byte
+	err = api.rpcClient.Call("",
+		"Cluster",
+		"RPCCall",
+		args,
+		&res)
+	sendResponse(w, err, json.RawMessage(res))
+}
+
 func parseCidOrError(w http.ResponseWriter, r *http.Request) types.PinSerial {
 	vars := mux.Vars(r)
 	hash := vars["hash"]
@@ -576,9 +2026,88 @@ func parseCidOrError(w http.ResponseWriter, r *http.Request) types.PinSerial {
 		sendErrorResponse(w, 400, "error decoding Cid: "+err.Error())
 		return types.PinSerial{Cid: ""}
 	}
+	return pinWithOptions(hash, r)
+}
+
+// parseFilterOrError reads the "filter" query parameter, a comma-separated
+// list of statuses. It sends an error response and returns false when it
+// is not valid.
+func parseFilterOrError(w http.ResponseWriter, r *http.Request) (types.StatusFilter, bool) {
+	filter, err := types.StatusFilterFromString(r.URL.Query().Get("filter"))
+	if err != nil {
+		sendErrorResponse(w, 400, err.Error())
+		return nil, false
+	}
+	return filter, true
+}
+
+// parseCidOrMultihashOrError works like parseCidOrError, but it also
+// accepts a bare multihash, which is resolved to a Cid by probing the
+// codecs in the IPFS daemon.
+func (api *API) parseCidOrMultihashOrError(w http.ResponseWriter, r *http.Request) types.PinSerial {
+	vars := mux.Vars(r)
+	hash := vars["hash"]
+
+	if _, err := cid.Decode(hash); err == nil {
+		return pinWithOptions(hash, r)
+	}
+	mh, err := decodeMultihash(hash)
+	if err != nil {
+		return parseCidOrError(w, r)
+	}
+
+	var resolved types.ResolvedMultihash
+	err = api.rpcClient.Call("",
+		"Cluster",
+		"ResolveMultihash",
+		mh.B58String(),
+		&resolved)
+	if err != nil {
+		sendErrorResponse(w, 500, "error resolving multihash: "+err.Error())
+		return types.PinSerial{Cid: ""}
+	}
+	return pinWithOptions(resolved.Cid, r)
+}
+
+// parsePathOrError resolves the IPFS or IPNS path in the route to a Cid
+// with the IPFS daemon of the peer, and returns a pin for it which carries
+// the path.
+func (api *API) parsePathOrError(w http.ResponseWriter, r *http.Request) types.PinSerial {
+	vars := mux.Vars(r)
+	path := "/" + vars["keyType"] + "/" + vars["path"]
+
+	var resolved string
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"IPFSResolve",
+		path,
+		&resolved)
+	if err != nil {
+		sendErrorResponse(w, 500, "error resolving path: "+err.Error())
+		return types.PinSerial{Cid: ""}
+	}
+	pin := pinWithOptions(resolved, r)
+	pin.Path = path
+	return pin
+}
+
+// decodeMultihash parses a base58 or hex-encoded multihash.
+func decodeMultihash(s string) (multihash.Multihash, error) {
+	mh, err := multihash.FromB58String(s)
+	if err == nil {
+		return mh, nil
+	}
+	return multihash.FromHexString(s)
+}
 
+// pinWithOptions returns a PinSerial for the given Cid with the name,
+// replication factor and shards from the request query, and the namespace
+// from the route. Pins with shards are MetaType pins. The pin carries the
+// ID of the request.
+func pinWithOptions(hash string, r *http.Request) types.PinSerial {
 	pin := types.PinSerial{
-		Cid: hash,
+		Cid:       hash,
+		RequestID: requestID(r),
 	}
 
 	queryValues := r.URL.Query()
@@ -588,6 +2117,14 @@ func parseCidOrError(w http.ResponseWriter, r *http.Request) types.PinSerial {
 	if rpl, err := strconv.Atoi(rplStr); err == nil {
 		pin.ReplicationFactor = rpl
 	}
+	if size, err := strconv.ParseUint(queryValues.Get("size"), 10, 64); err == nil {
+		pin.Size = size
+	}
+	if shards := queryValues.Get("shards"); shards != "" {
+		pin.Type = types.MetaType.String()
+		pin.Shards = strings.Split(shards, ",")
+	}
+	pin.Namespace = mux.Vars(r)["namespace"]
 
 	return pin
 }
@@ -658,9 +2195,14 @@ func sendJSONResponse(w http.ResponseWriter, code int, resp interface{}) {
 }
 
 func sendErrorResponse(w http.ResponseWriter, code int, msg string) {
+	sendErrorResponseWithDetails(w, code, msg, nil)
+}
+
+func sendErrorResponseWithDetails(w http.ResponseWriter, code int, msg string, details map[string]string) {
 	errorResp := types.Error{
 		Code:    code,
 		Message: msg,
+		Details: details,
 	}
 	logger.Errorf("sending error response: %d: %s", code, msg)
 	sendJSONResponse(w, code, errorResp)
@@ -1,16 +1,20 @@
 package rest
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/test"
 
+	cid "github.com/ipfs/go-cid"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -94,132 +98,1082 @@ func TestRestAPIIDEndpoint(t *testing.T) {
 	}
 }
 
+func TestAPIHealthEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+	health := api.HealthSerial{}
+	makeGet(t, "/health", &health)
+	if health.Peer != test.TestPeerID1.Pretty() {
+		t.Error("expected correct peer")
+	}
+	if health.Status != string(api.PeerHealthOK) {
+		t.Error("expected ok health")
+	}
+}
+
+func TestAPISyncStatusEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+	status := api.SyncStatusSerial{}
+	makeGet(t, "/health/sync", &status)
+	if status.Peer != test.TestPeerID1.Pretty() {
+		t.Error("expected correct peer")
+	}
+	if !status.State.Enabled || status.State.OutOfSync != 1 || status.State.Last == "" {
+		t.Error("unexpected state sync info:", status.State)
+	}
+	if !status.IPFS.Enabled || status.IPFS.Last != "" {
+		t.Error("unexpected ipfs sync info:", status.IPFS)
+	}
+}
+
+func TestAPIHealthGraphEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+	var graph api.ConnectGraphSerial
+	makeGet(t, "/health/graph", &graph)
+	if graph.ClusterID != test.TestPeerID1.Pretty() {
+		t.Error("expected correct cluster ID")
+	}
+	links := graph.ClusterLinks[test.TestPeerID1.Pretty()]
+	if len(links) != 1 || links[0] != test.TestPeerID2.Pretty() {
+		t.Error("unexpected cluster links:", graph.ClusterLinks)
+	}
+	if graph.ClustertoIPFS[test.TestPeerID2.Pretty()] != test.TestPeerID5.Pretty() {
+		t.Error("unexpected ipfs daemons:", graph.ClustertoIPFS)
+	}
+	if len(graph.IPFSLinks[test.TestPeerID4.Pretty()]) != 1 {
+		t.Error("unexpected ipfs links:", graph.IPFSLinks)
+	}
+}
+
+func TestAPIPeersHealthEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+	var lives []api.PeerLivenessSerial
+	makeGet(t, "/health/peers", &lives)
+	if len(lives) != 2 {
+		t.Fatal("expected the liveness of 2 peers")
+	}
+	if !lives[0].Alive || lives[0].RTT != "1ms" || lives[0].LastMetric == "" {
+		t.Error("unexpected liveness:", lives[0])
+	}
+	if lives[1].Alive || lives[1].Error == "" {
+		t.Error("expected an unreachable peer:", lives[1])
+	}
+}
+
+func TestAPITrackerMetricsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+	metrics := api.TrackerMetricsSerial{}
+	makeGet(t, "/monitor/tracker", &metrics)
+	if metrics.Peer != test.TestPeerID1.Pretty() {
+		t.Error("expected correct peer")
+	}
+	if metrics.PinQueue != 2 || metrics.InFlight != 1 || metrics.AvgPinLatency != "1s" {
+		t.Error("unexpected tracker metrics:", metrics)
+	}
+}
+
+func TestAPIPublicStatusEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	httpResp, err := http.Get(apiHost + "/public/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode != 404 {
+		t.Error("the public status should be disabled by default")
+	}
+	rest.Shutdown()
+
+	apiMAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/10002")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ListenAddr = apiMAddr
+	cfg.BasicAuthCreds = map[string]string{"admin": "secret"}
+	cfg.EnablePublicStatus = true
+	cfg.PublicStatusLimit = 2
+	rest, err = NewAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rest.Shutdown()
+	rest.server.SetKeepAlivesEnabled(false)
+	rest.SetClient(test.NewMockRPCClient(t))
+
+	// no credentials are needed
+	status := api.PublicStatus{}
+	makeGet(t, "/public/status", &status)
+	if status.Peers != 3 || status.Pins != 3 || status.Health != api.PeerHealthOK {
+		t.Error("unexpected public status:", status)
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/id", &errResp)
+	if errResp.Code != 401 {
+		t.Error("other endpoints should still require credentials")
+	}
+
+	makeGet(t, "/public/status", &status)
+	errResp = api.Error{}
+	makeGet(t, "/public/status", &errResp)
+	if errResp.Code != 429 {
+		t.Error("expected the request to be rate-limited")
+	}
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	apiMAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/10002")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ListenAddr = apiMAddr
+	cfg.BasicAuthCreds = map[string]string{"admin": "secret"}
+	cfg.BearerTokens = map[string]string{"ci": "abcdef"}
+	rest, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rest.Shutdown()
+	rest.server.SetKeepAlivesEnabled(false)
+	rest.SetClient(test.NewMockRPCClient(t))
+
+	get := func(setAuth func(r *http.Request)) int {
+		req, _ := http.NewRequest("GET", apiHost+"/version", nil)
+		setAuth(req)
+		httpResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp.Body.Close()
+		return httpResp.StatusCode
+	}
+
+	if code := get(func(r *http.Request) {}); code != 401 {
+		t.Error("expected 401 without credentials: ", code)
+	}
+	if code := get(func(r *http.Request) { r.SetBasicAuth("admin", "secret") }); code != 200 {
+		t.Error("expected 200 with basic auth: ", code)
+	}
+	if code := get(func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }); code != 401 {
+		t.Error("expected 401 with a wrong password: ", code)
+	}
+	if code := get(func(r *http.Request) { r.Header.Set("Authorization", "Bearer abcdef") }); code != 200 {
+		t.Error("expected 200 with a token: ", code)
+	}
+	if code := get(func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }); code != 401 {
+		t.Error("expected 401 with a wrong token: ", code)
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/version", &errResp)
+	if errResp.Code != 401 || errResp.Message != "Unauthorized" {
+		t.Error("expected an api.Error: ", errResp)
+	}
+}
+
 func TestAPIVersionEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
-	ver := api.Version{}
-	makeGet(t, "/version", &ver)
-	if ver.Version != "0.0.mock" {
-		t.Error("expected correct version")
+	ver := api.Version{}
+	makeGet(t, "/version", &ver)
+	if ver.Version != "0.0.mock" {
+		t.Error("expected correct version")
+	}
+	if ver.Schema != api.SchemaVersion {
+		t.Error("expected the schema version")
+	}
+}
+
+func TestAPIIPFSLocalPinsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var localPins []api.LocalPinSerial
+	makeGet(t, "/ipfs/pins/local", &localPins)
+	if len(localPins) != 2 {
+		t.Fatal("expected 2 elements")
+	}
+	if localPins[0].Cid != test.TestCid1 || !localPins[0].Tracked {
+		t.Error("expected a tracked pin: ", localPins[0])
+	}
+	if localPins[1].Cid != test.TestCid3 || localPins[1].Tracked {
+		t.Error("expected an untracked pin: ", localPins[1])
+	}
+}
+
+func TestAPIPeerstEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var list []api.IDSerial
+	makeGet(t, "/peers", &list)
+	if len(list) != 1 {
+		t.Fatal("expected 1 element")
+	}
+	if list[0].ID != test.TestPeerID1.Pretty() {
+		t.Error("expected a different peer id list: ", list)
+	}
+}
+
+func TestAPIPeerAddEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	id := api.IDSerial{}
+	// post with valid body
+	body := fmt.Sprintf("{\"peer_multiaddress\":\"/ip4/1.2.3.4/tcp/1234/ipfs/%s\"}", test.TestPeerID1.Pretty())
+	t.Log(body)
+	makePost(t, "/peers", []byte(body), &id)
+
+	if id.ID != test.TestPeerID1.Pretty() {
+		t.Error("expected correct ID")
+	}
+	if id.Error != "" {
+		t.Error("did not expect an error")
+	}
+
+	// Send invalid body
+	errResp := api.Error{}
+	makePost(t, "/peers", []byte("oeoeoeoe"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad body")
+	}
+	// Send invalid multiaddr
+	makePost(t, "/peers", []byte("{\"peer_multiaddress\": \"ab\"}"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad multiaddress")
+	}
+}
+
+func TestAPIPeerRemoveEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	makeDelete(t, "/peers/"+test.TestPeerID1.Pretty(), &struct{}{})
+}
+
+func TestAPIPeerRemovalEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var pr api.PeerRemovalSerial
+	makeGet(t, "/peers/"+test.TestPeerID1.Pretty()+"/removal", &pr)
+	if pr.Peer != test.TestPeerID1.Pretty() || pr.Phase != api.PeerRemovalDone {
+		t.Error("unexpected peer removal: ", pr)
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/peers/"+test.TestPeerID2.Pretty()+"/removal", &errResp)
+	if errResp.Code != 404 {
+		t.Error("expected a 404 for a peer which was not removed")
+	}
+}
+
+func TestAPIPeerMaintenanceEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	makePost(t, "/peers/"+test.TestPeerID1.Pretty()+"/maintenance?enabled=true", []byte{}, &struct{}{})
+
+	errResp := api.Error{}
+	makePost(t, "/peers/"+test.TestPeerID1.Pretty()+"/maintenance?enabled=abc", []byte{}, &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad enabled value")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/peers/abcd/maintenance?enabled=true", []byte{}, &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad peer ID")
+	}
+}
+
+func TestAPIMaintenancePeersEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var peers []string
+	makeGet(t, "/peers/maintenance", &peers)
+	if len(peers) != 1 || peers[0] != test.TestPeerID1.Pretty() {
+		t.Error("expected one peer in maintenance")
+	}
+}
+
+func TestAPIResolveMultihashEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	// TestCid1 is a CIDv0, thus a base58 multihash
+	var resolved api.ResolvedMultihash
+	makeGet(t, "/multihash/"+test.TestCid1, &resolved)
+	if resolved.Cid != test.TestCid1 || !resolved.Available {
+		t.Error("unexpected resolution:", resolved)
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	resolved = api.ResolvedMultihash{}
+	makeGet(t, "/multihash/"+c.Hash().HexString(), &resolved)
+	if resolved.Cid != test.TestCid1 {
+		t.Error("hex multihashes should be accepted:", resolved)
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/multihash/abcd", &errResp)
+	if errResp.Code != 400 {
+		t.Error("should fail with bad multihash")
+	}
+}
+
+func TestAPIPinBatchEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	body := fmt.Sprintf(`[{"cid":"%s","replication_factor":1},{"cid":"%s","replication_factor":1}]`,
+		test.TestCid1, test.TestCid2)
+	makePost(t, "/pins", []byte(body), &struct{}{})
+
+	errResp := api.Error{}
+	body = fmt.Sprintf(`[{"cid":"%s"},{"cid":"%s"}]`, test.TestCid1, test.ErrorCid)
+	makePost(t, "/pins", []byte(body), &errResp)
+	if errResp.Message != test.ErrBadCid.Error() {
+		t.Error("expected different error: ", errResp.Message)
+	}
+	if errResp.Details["committed"] != "1" {
+		t.Error("expected the number of committed pins:", errResp.Details)
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/pins", []byte("oeoeoeoe"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad body")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/pins", []byte(`[{"cid":"abcd"}]`), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad cid")
+	}
+}
+
+func TestAPIPinPathEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var pin api.PinSerial
+	makePost(t, "/pins"+test.TestPath+"?name=data&replication_factor=2", []byte{}, &pin)
+	if pin.Cid != test.TestCid1 || pin.Path != test.TestPath {
+		t.Error("expected the resolved pin:", pin)
+	}
+	if pin.Name != "data" || pin.ReplicationFactor != 2 {
+		t.Error("the pin options should be kept:", pin)
+	}
+
+	pin = api.PinSerial{}
+	makeDelete(t, "/pins"+test.TestPath, &pin)
+	if pin.Cid != test.TestCid1 {
+		t.Error("expected the resolved pin:", pin)
+	}
+
+	errResp := api.Error{}
+	makePost(t, "/pins/ipns/unknown.example.com", []byte{}, &errResp)
+	if errResp.Code != 500 || !strings.Contains(errResp.Message, "error resolving path") {
+		t.Error("expected an error resolving the path:", errResp)
+	}
+}
+
+func TestAPIBatchEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	check := func(results []api.BatchResult) {
+		if len(results) != 4 {
+			t.Fatal("expected a result for every item:", results)
+		}
+		if results[0].Cid != test.TestCid1 || results[0].Error != "" {
+			t.Error("the pin should have worked:", results[0])
+		}
+		if !results[1].Unpin || results[1].Error != "" {
+			t.Error("the unpin should have worked:", results[1])
+		}
+		if results[2].Error != test.ErrBadCid.Error() {
+			t.Error("expected the error of the item:", results[2])
+		}
+		if !strings.Contains(results[3].Error, "error decoding Cid") {
+			t.Error("expected a bad cid:", results[3])
+		}
+	}
+
+	var results []api.BatchResult
+	body := fmt.Sprintf(`[{"cid":"%s","replication_factor":1},{"cid":"%s","unpin":true},{"cid":"%s"},{"cid":"abcd"}]`,
+		test.TestCid1, test.TestCid2, test.ErrorCid)
+	makePost(t, "/pins/batch", []byte(body), &results)
+	check(results)
+
+	results = nil
+	body = fmt.Sprintf("{\"cid\":\"%s\"}\n{\"cid\":\"%s\",\"unpin\":true}\n{\"cid\":\"%s\"}\n{\"cid\":\"abcd\"}\n",
+		test.TestCid1, test.TestCid2, test.ErrorCid)
+	makePost(t, "/pins/batch", []byte(body), &results)
+	check(results)
+
+	errResp := api.Error{}
+	makePost(t, "/pins/batch", []byte("[oeoeoeoe"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad body")
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+	items, err := decodeBatch(strings.NewReader("  \n[]"))
+	if err != nil || len(items) != 0 {
+		t.Error("expected an empty batch:", items, err)
+	}
+	items, err = decodeBatch(strings.NewReader(`{"cid":"a"} {"cid":"b","unpin":true}`))
+	if err != nil || len(items) != 2 || items[0].Cid != "a" || !items[1].Unpin {
+		t.Error("expected two items:", items, err)
+	}
+	_, err = decodeBatch(strings.NewReader(""))
+	if err == nil {
+		t.Error("expected an error with an empty body")
+	}
+}
+
+func TestAPIAddEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	body := new(bytes.Buffer)
+	mpw := multipart.NewWriter(body)
+	part, _ := mpw.CreateFormFile("file", "testfile")
+	part.Write(bytes.Repeat([]byte("a"), addChunkSize+10))
+	mpw.Close()
+
+	httpResp, err := http.Post(apiHost+"/add?replication_factor=2", mpw.FormDataContentType(), body)
+	var resp []api.AddedOutputSerial
+	processResp(t, httpResp, err, &resp)
+	if len(resp) != 1 || resp[0].Cid != test.TestCid1 || resp[0].Name != "testfile" {
+		t.Error("unexpected add response: ", resp)
+	}
+
+	var errResp api.Error
+	makePost(t, "/add", []byte("{}"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected an error when the body is not multipart")
+	}
+}
+
+func TestAddedRoots(t *testing.T) {
+	added := []api.AddedOutputSerial{
+		{Name: "dir/a", Cid: test.TestCid1},
+		{Name: "dir", Cid: test.TestCid2},
+		{Name: "b", Cid: test.TestCid3},
+	}
+	roots := addedRoots(added, false)
+	if len(roots) != 2 || roots[0].Cid != test.TestCid2 || roots[1].Cid != test.TestCid3 {
+		t.Error("unexpected roots: ", roots)
+	}
+	roots = addedRoots(added, true)
+	if len(roots) != 1 || roots[0].Cid != test.TestCid3 {
+		t.Error("only the wrapping directory should be a root")
+	}
+}
+
+func TestAPIPinEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	// test regular post
+	makePost(t, "/pins/"+test.TestCid1, []byte{}, &struct{}{})
+
+	errResp := api.Error{}
+	makePost(t, "/pins/"+test.ErrorCid, []byte{}, &errResp)
+	if errResp.Message != test.ErrBadCid.Error() {
+		t.Error("expected different error: ", errResp.Message)
+	}
+	if errResp.Details != nil {
+		t.Error("expected no details: ", errResp.Details)
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/pins/"+test.AllocErrorCid, []byte{}, &errResp)
+	if errResp.Code != 500 {
+		t.Error("expected an allocation error")
+	}
+	if errResp.Details[test.TestPeerID2.Pretty()] != "blacklisted" ||
+		len(errResp.Details) != 2 {
+		t.Error("expected the discarded candidates: ", errResp.Details)
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/namespaces/team-a/pins/"+test.QuotaErrorCid, []byte{}, &errResp)
+	if errResp.Code != 403 {
+		t.Error("expected a quota error")
+	}
+	if errResp.Details["namespace"] != "team-a" || errResp.Details["quota"] != "max_bytes" {
+		t.Error("expected the quota details: ", errResp.Details)
+	}
+
+	makePost(t, "/pins/abcd", []byte{}, &errResp)
+	if errResp.Code != 400 {
+		t.Error("should fail with bad Cid")
+	}
+
+	// bare multihashes are resolved to a Cid
+	c, _ := cid.Decode(test.TestCid1)
+	makePost(t, "/pins/"+c.Hash().HexString(), []byte{}, &struct{}{})
+
+	makePost(t, "/pins/"+test.TestInlineCid+"?inline=true", []byte{}, &struct{}{})
+
+	errResp = api.Error{}
+	makePost(t, "/pins/"+test.TestCid1+"?inline=true", []byte{}, &errResp)
+	if errResp.Code != 500 {
+		t.Error("should fail when the block cannot be fetched")
+	}
+}
+
+func TestAPIPinWait(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var gpinfo api.GlobalPinInfoSerial
+	makePost(t, "/pins/"+test.TestCid1+"?wait=true&wait-timeout=5s", []byte{}, &gpinfo)
+	if gpinfo.Cid != test.TestCid1 ||
+		gpinfo.PeerMap[test.TestPeerID1.Pretty()].Status != "pinned" {
+		t.Error("expected the status of the pinned item:", gpinfo)
+	}
+
+	for _, timeout := range []string{"abc", "-1s", "2m"} {
+		errResp := api.Error{}
+		makePost(t, "/pins/"+test.TestCid1+"?wait=true&wait-timeout="+timeout, []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Errorf("wait-timeout=%s should be rejected", timeout)
+		}
+	}
+}
+
+func TestAPIUnpinEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	// test regular delete
+	makeDelete(t, "/pins/"+test.TestCid1, &struct{}{})
+
+	errResp := api.Error{}
+	makeDelete(t, "/pins/"+test.ErrorCid, &errResp)
+	if errResp.Message != test.ErrBadCid.Error() {
+		t.Error("expected different error: ", errResp.Message)
+	}
+
+	makeDelete(t, "/pins/abcd", &errResp)
+	if errResp.Code != 400 {
+		t.Error("should fail with bad Cid")
+	}
+}
+
+func TestAPICancelPinEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	makePost(t, "/pins/"+test.SlowCid1+"/cancel", []byte{}, &struct{}{})
+
+	errResp := api.Error{}
+	makePost(t, "/pins/"+test.TestCid1+"/cancel", []byte{}, &errResp)
+	if errResp.Code != 500 {
+		t.Error("expected an error when the item is not being pinned")
+	}
+}
+
+func TestAPIAllocationsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	// pins are sorted by Cid
+	var resp []api.PinSerial
+	makeGet(t, "/allocations", &resp)
+	if len(resp) != 3 ||
+		resp[0].Cid != test.TestCid2 || resp[1].Cid != test.TestCid3 ||
+		resp[2].Cid != test.TestCid1 {
+		t.Error("unexpected pin list: ", resp)
+	}
+
+	var page []api.PinSerial
+	makeGet(t, "/allocations?sort=cid&offset=1&limit=1", &page)
+	if len(page) != 1 || page[0].Cid != test.TestCid3 {
+		t.Error("unexpected page: ", page)
+	}
+
+	var cursorPage []api.PinSerial
+	makeGet(t, "/allocations?cursor="+test.TestCid2, &cursorPage)
+	if len(cursorPage) != 2 || cursorPage[0].Cid != test.TestCid3 ||
+		cursorPage[1].Cid != test.TestCid1 {
+		t.Error("unexpected page after cursor: ", cursorPage)
+	}
+
+	for _, q := range []string{"limit=-1", "offset=a", "sort=ts", "sort=name&cursor=" + test.TestCid1, "cursor=abc"} {
+		var errResp api.Error
+		makeGet(t, "/allocations?"+q, &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected an error with ", q)
+		}
+	}
+}
+
+func TestAPIPinLogEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var resp []api.PinLogEntrySerial
+	makeGet(t, "/pins/log", &resp)
+	if len(resp) != 2 || resp[0].Seq != 1 || resp[1].Op != api.PinLogUnpin {
+		t.Error("unexpected pin log: ", resp)
+	}
+
+	resp = nil
+	makeGet(t, "/pins/log?since=1", &resp)
+	if len(resp) != 1 || resp[0].Seq != 2 {
+		t.Error("unexpected pin log: ", resp)
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/pins/log?since=3", &errResp)
+	if errResp.Code != 410 {
+		t.Error("expected error when the sequence is not in the log")
+	}
+
+	errResp = api.Error{}
+	makeGet(t, "/pins/log?since=abc", &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error parsing since")
+	}
+}
+
+func TestAPIEventsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	req, _ := http.NewRequest("GET", apiHost+"/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	if ct := httpResp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatal("unexpected content type: ", ct)
+	}
+
+	// The mock only has 2 events, and the first one is skipped
+	scanner := bufio.NewScanner(httpResp.Body)
+	var lines []string
+	for scanner.Scan() && len(lines) < 3 {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 ||
+		lines[0] != "id: 2" ||
+		lines[1] != "event: peer_joined" ||
+		!strings.HasPrefix(lines[2], "data: ") {
+		t.Fatal("unexpected event: ", lines)
+	}
+	var ev api.EventSerial
+	err = json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Seq != 2 || ev.Peer != test.TestPeerID2.Pretty() {
+		t.Error("unexpected event data: ", ev)
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/events?since=abc", &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error parsing since")
+	}
+}
+
+func TestAPIDuplicatePinsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var resp []api.DuplicatePinsSerial
+	makeGet(t, "/allocations/duplicates", &resp)
+	if len(resp) != 1 || len(resp[0].Pins) != 2 ||
+		resp[0].Pins[1].Cid != test.TestCid1V1 {
+		t.Error("unexpected duplicates: ", resp)
+	}
+
+	var mergeResp []api.DuplicatePinsSerial
+	makePost(t, "/allocations/duplicates/merge", []byte{}, &mergeResp)
+	if len(mergeResp) != 1 {
+		t.Error("expected one merged group")
+	}
+}
+
+func TestAPIStateStatsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var resp api.StateStatsSerial
+	makeGet(t, "/allocations/stats?delimiter=-", &resp)
+	if resp.Pins != 3 || resp.ByNamePrefix["-"] != 3 {
+		t.Error("unexpected stats: ", resp)
+	}
+}
+
+func TestAPIPinSummaryEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var resp api.PinSummarySerial
+	makeGet(t, "/pins/summary", &resp)
+	pps := resp.ByPeer[test.TestPeerID1.Pretty()]
+	if resp.Pins != 3 || resp.ByStatus["pin_error"] != 1 || pps.Pinned != 1 || pps.Pinning != 1 || pps.Error != 1 {
+		t.Error("unexpected summary: ", resp)
+	}
+
+	var filtered api.PinSummarySerial
+	makeGet(t, "/pins/summary?filter=pinned", &filtered)
+	if filtered.Pins != 1 || len(filtered.ByStatus) != 1 {
+		t.Error("the summary should only count the filtered items: ", filtered)
+	}
+
+	var local api.PinSummarySerial
+	makeGet(t, "/pins/summary?local=true", &local)
+	if local.Pins != 2 || local.ByStatus["pinned"] != 1 {
+		t.Error("unexpected local summary: ", local)
+	}
+}
+
+func TestAPIAllocationEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var resp api.PinSerial
+	makeGet(t, "/allocations/"+test.TestCid1, &resp)
+	if resp.Cid != test.TestCid1 {
+		t.Error("cid should be the same")
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/allocations/"+test.ErrorCid, &errResp)
+	if errResp.Code != 404 {
+		t.Error("a non-pinned cid should 404")
+	}
+}
+
+func TestAPINamespacesEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var nss []api.Namespace
+	makeGet(t, "/namespaces", &nss)
+	if len(nss) != 2 || nss[1].Name != "team-a" || nss[1].MaxPins != 10 {
+		t.Error("unexpected namespaces: ", nss)
+	}
+
+	var pins []api.PinSerial
+	makeGet(t, "/namespaces/team-a/pins", &pins)
+	if len(pins) != 1 || pins[0].Cid != test.TestCid1 || pins[0].Namespace != "team-a" {
+		t.Error("unexpected namespace pins: ", pins)
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/namespaces/team-b/pins", &errResp)
+	if errResp.Code != 404 {
+		t.Error("an unknown namespace should 404")
+	}
+
+	var pin api.PinSerial
+	makeGet(t, "/namespaces/team-a/pins/"+test.TestCid1, &pin)
+	if pin.Cid != test.TestCid1 || pin.Namespace != "team-a" {
+		t.Error("unexpected pin: ", pin)
+	}
+
+	makePost(t, "/namespaces/team-a/pins/"+test.TestCid1, []byte{}, &struct{}{})
+	errResp = api.Error{}
+	makePost(t, "/namespaces/team-b/pins/"+test.TestCid1, []byte{}, &errResp)
+	if errResp.Code != 400 {
+		t.Error("pinning in an unknown namespace should 400")
+	}
+	makeDelete(t, "/namespaces/team-a/pins/"+test.TestCid1, &struct{}{})
+
+	errResp = api.Error{}
+	makeDelete(t, "/namespaces/team-b/pins/"+test.TestCid1, &errResp)
+	if errResp.Message != test.ErrBadCid.Error() {
+		t.Error("expected error unpinning from a different namespace: ", errResp.Message)
+	}
+}
+
+func TestAPILogLevelEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	body := []byte(`{"component":"cluster","level":"debug"}`)
+	makePost(t, "/log/level", body, &struct{}{})
+	makePost(t, "/log/level?all_peers=true", body, &struct{}{})
+
+	errResp := api.Error{}
+	makePost(t, "/log/level", []byte(`{"level":"debug"}`), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error without component")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/log/level", []byte("abc"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad body")
 	}
 }
 
-func TestAPIPeerstEndpoint(t *testing.T) {
+func TestAPISnapshotEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
 
-	var list []api.IDSerial
-	makeGet(t, "/peers", &list)
-	if len(list) != 1 {
-		t.Fatal("expected 1 element")
-	}
-	if list[0].ID != test.TestPeerID1.Pretty() {
-		t.Error("expected a different peer id list: ", list)
+	errResp := api.Error{}
+	makePost(t, "/consensus/snapshot", []byte{}, &errResp)
+	if errResp.Code != 0 {
+		t.Error("expected no error:", errResp.Message)
 	}
 }
 
-func TestAPIPeerAddEndpoint(t *testing.T) {
+func TestAPIConsensusStatusEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
 
-	id := api.IDSerial{}
-	// post with valid body
-	body := fmt.Sprintf("{\"peer_multiaddress\":\"/ip4/1.2.3.4/tcp/1234/ipfs/%s\"}", test.TestPeerID1.Pretty())
-	t.Log(body)
-	makePost(t, "/peers", []byte(body), &id)
+	var statuses []api.ConsensusStatusSerial
+	makeGet(t, "/consensus/status", &statuses)
+	if len(statuses) != 2 || statuses[1].Lag != 3 {
+		t.Error("expected the status of 2 peers")
+	}
 
-	if id.ID != test.TestPeerID1.Pretty() {
-		t.Error("expected correct ID")
+	statuses = nil
+	makeGet(t, "/consensus/status?local=true", &statuses)
+	if len(statuses) != 1 || statuses[0].Peer != test.TestPeerID1.Pretty() {
+		t.Error("expected the status of the local peer")
 	}
-	if id.Error != "" {
-		t.Error("did not expect an error")
+	if statuses[0].CommitIndex != 10 || statuses[0].Term != 2 {
+		t.Error("unexpected status: ", statuses[0])
 	}
+}
+
+func TestAPIStateVerifyEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var diffs []api.StateDiffSerial
+	makeGet(t, "/state/verify", &diffs)
+	if len(diffs) != 2 {
+		t.Fatal("expected the diff of 2 peers")
+	}
+	if diffs[1].Peer != test.TestPeerID2.Pretty() ||
+		len(diffs[1].Missing) != 1 ||
+		diffs[1].Missing[0] != test.TestCid3 {
+		t.Error("unexpected diff: ", diffs[1])
+	}
+}
+
+func TestAPIAllocationStrategyEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	body := []byte(`{"name":"disk-freespace"}`)
+	makePost(t, "/allocations/strategy", body, &struct{}{})
+	makePost(t, "/allocations/strategy?all_peers=true", body, &struct{}{})
 
-	// Send invalid body
 	errResp := api.Error{}
-	makePost(t, "/peers", []byte("oeoeoeoe"), &errResp)
+	makePost(t, "/allocations/strategy", []byte(`{}`), &errResp)
 	if errResp.Code != 400 {
-		t.Error("expected error with bad body")
+		t.Error("expected error without name")
 	}
-	// Send invalid multiaddr
-	makePost(t, "/peers", []byte("{\"peer_multiaddress\": \"ab\"}"), &errResp)
+
+	errResp = api.Error{}
+	makePost(t, "/allocations/strategy", []byte(`{"name":"abc"}`), &errResp)
+	if errResp.Code != 500 {
+		t.Error("expected error with unknown strategy")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/allocations/strategy", []byte("abc"), &errResp)
 	if errResp.Code != 400 {
-		t.Error("expected error with bad multiaddress")
+		t.Error("expected error with bad body")
 	}
 }
 
-func TestAPIPeerRemoveEndpoint(t *testing.T) {
+func TestAPIRuntimeConfigEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
 
-	makeDelete(t, "/peers/"+test.TestPeerID1.Pretty(), &struct{}{})
+	body := []byte(`{"maptracker.concurrent_pins":4}`)
+	makePost(t, "/config/runtime", body, &struct{}{})
+	makePost(t, "/config/runtime?all_peers=true", body, &struct{}{})
+
+	errResp := api.Error{}
+	makePost(t, "/config/runtime", []byte(`{}`), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error without options")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/config/runtime", []byte(`{"cluster.secret":"abc"}`), &errResp)
+	if errResp.Code != 500 {
+		t.Error("expected error with an option which is not runtime-tunable")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/config/runtime", []byte("abc"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad body")
+	}
 }
 
-func TestAPIPinEndpoint(t *testing.T) {
+func TestAPIRPCCallEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
 
-	// test regular post
-	makePost(t, "/pins/"+test.TestCid1, []byte{}, &struct{}{})
+	body := fmt.Sprintf(`{"peer":"%s","service":"Cluster","method":"Version"}`, test.TestPeerID1.Pretty())
 
 	errResp := api.Error{}
-	makePost(t, "/pins/"+test.ErrorCid, []byte{}, &errResp)
-	if errResp.Message != test.ErrBadCid.Error() {
-		t.Error("expected different error: ", errResp.Message)
+	makePost(t, "/rpc", []byte(body), &errResp)
+	if errResp.Code != 403 {
+		t.Error("expected forbidden error when rpc calls are disabled")
 	}
 
-	makePost(t, "/pins/abcd", []byte{}, &errResp)
+	rest.config.EnableRPCCall = true
+
+	var resp api.Version
+	makePost(t, "/rpc", []byte(body), &resp)
+	if resp.Version != "0.0.mock" {
+		t.Error("expected the mock version response")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/rpc", []byte(`{"peer":"abc","service":"Cluster","method":"Version"}`), &errResp)
 	if errResp.Code != 400 {
-		t.Error("should fail with bad Cid")
+		t.Error("expected error with bad peer ID")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/rpc", []byte(`{"service":"Cluster","method":"Nothing"}`), &errResp)
+	if errResp.Code != 500 {
+		t.Error("expected error with unknown method")
 	}
 }
 
-func TestAPIUnpinEndpoint(t *testing.T) {
+func TestAPIScalingAdviceEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
 
-	// test regular delete
-	makeDelete(t, "/pins/"+test.TestCid1, &struct{}{})
+	var resp api.ScalingAdviceSerial
+	makeGet(t, "/scaling", &resp)
+	if resp.Action != string(api.ScalingAddPeers) || resp.Peers != 1 {
+		t.Error("unexpected scaling advice:", resp)
+	}
+	if len(resp.Pressure) != 1 || !resp.Pressure[0].UnderPressure {
+		t.Error("expected one peer under pressure")
+	}
+}
 
-	errResp := api.Error{}
-	makeDelete(t, "/pins/"+test.ErrorCid, &errResp)
-	if errResp.Message != test.ErrBadCid.Error() {
-		t.Error("expected different error: ", errResp.Message)
+func TestAPIAllocationDecisionsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var resp []api.AllocationRecordSerial
+	makeGet(t, "/allocations/decisions", &resp)
+	if len(resp) != 1 || resp[0].Cid != test.TestCid1 {
+		t.Fatal("expected one allocation record")
+	}
+	if len(resp[0].Considered) != 2 || len(resp[0].Vetoes) != 1 {
+		t.Error("expected considered peers and vetoes")
 	}
 
-	makeDelete(t, "/pins/abcd", &errResp)
-	if errResp.Code != 400 {
-		t.Error("should fail with bad Cid")
+	var resp2 []api.AllocationRecordSerial
+	makeGet(t, "/allocations/decisions?local=true", &resp2)
+	if len(resp2) != 1 {
+		t.Error("expected one allocation record")
 	}
 }
 
-func TestAPIAllocationsEndpoint(t *testing.T) {
+func TestAPIAllocationHistoryEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
 
-	var resp []api.PinSerial
-	makeGet(t, "/allocations", &resp)
-	if len(resp) != 3 ||
-		resp[0].Cid != test.TestCid1 || resp[1].Cid != test.TestCid2 ||
-		resp[2].Cid != test.TestCid3 {
-		t.Error("unexpected pin list: ", resp)
+	var resp []api.AllocationRecordSerial
+	makeGet(t, "/allocations/"+test.TestCid1+"/history", &resp)
+	if len(resp) != 1 || resp[0].Cid != test.TestCid1 {
+		t.Fatal("expected one allocation record")
+	}
+	if len(resp[0].Allocations) != 2 || resp[0].Reason == "" {
+		t.Error("unexpected allocation record")
+	}
+
+	var resp2 []api.AllocationRecordSerial
+	makeGet(t, "/allocations/"+test.TestCid1+"/history?local=true", &resp2)
+	if len(resp2) != 1 {
+		t.Error("expected one allocation record")
+	}
+
+	errResp := api.Error{}
+	makeGet(t, "/allocations/abcd/history", &errResp)
+	if errResp.Code != 400 {
+		t.Error("should fail with bad Cid")
 	}
 }
 
-func TestAPIAllocationEndpoint(t *testing.T) {
+func TestAPIAllocationPreviewEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
 
 	var resp api.PinSerial
-	makeGet(t, "/allocations/"+test.TestCid1, &resp)
+	body := fmt.Sprintf(`{"cid":"%s","replication_factor_min":1,"replication_factor_max":2}`, test.TestCid1)
+	makePost(t, "/allocations/preview", []byte(body), &resp)
 	if resp.Cid != test.TestCid1 {
 		t.Error("cid should be the same")
 	}
+	if len(resp.Allocations) != 2 {
+		t.Error("expected 2 allocations")
+	}
 
 	errResp := api.Error{}
-	makeGet(t, "/allocations/"+test.ErrorCid, &errResp)
-	if errResp.Code != 404 {
-		t.Error("a non-pinned cid should 404")
+	makePost(t, "/allocations/preview", []byte("oeoeoeoe"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad body")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/allocations/preview", []byte(`{"cid":"abcd"}`), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad cid")
+	}
+}
+
+func TestAPISimulateAllocationsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var resp api.AllocationSimulationSerial
+	body := fmt.Sprintf(`[{"cid":"%s","replication_factor":1},{"cid":"%s","replication_factor":1}]`,
+		test.TestCid1, test.TestCid2)
+	makePost(t, "/allocations/simulate", []byte(body), &resp)
+	if len(resp.Records) != 2 {
+		t.Fatal("expected 2 records")
+	}
+	if resp.Records[0].Cid != test.TestCid1 {
+		t.Error("cid should be the same")
+	}
+	if len(resp.Load) != 1 || resp.Load[0].Added != 2 {
+		t.Error("expected 2 pins added to the peer load")
+	}
+
+	errResp := api.Error{}
+	makePost(t, "/allocations/simulate", []byte("oeoeoeoe"), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad body")
+	}
+
+	errResp = api.Error{}
+	makePost(t, "/allocations/simulate", []byte(`[{"cid":"abcd"}]`), &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected error with bad cid")
 	}
 }
 
@@ -227,11 +1181,13 @@ func TestAPIStatusAllEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
 
+	// items are sorted by Cid
 	var resp []api.GlobalPinInfoSerial
 	makeGet(t, "/pins", &resp)
 	if len(resp) != 3 ||
-		resp[0].Cid != test.TestCid1 ||
-		resp[1].PeerMap[test.TestPeerID1.Pretty()].Status != "pinning" {
+		resp[0].Cid != test.TestCid2 ||
+		resp[0].PeerMap[test.TestPeerID1.Pretty()].Status != "pinning" ||
+		resp[2].Cid != test.TestCid1 {
 		t.Errorf("unexpected statusAll resp:\n %+v", resp)
 	}
 
@@ -241,6 +1197,62 @@ func TestAPIStatusAllEndpoint(t *testing.T) {
 	if len(resp2) != 2 {
 		t.Errorf("unexpected statusAll+local resp:\n %+v", resp)
 	}
+
+	// Test filter
+	var resp3 []api.GlobalPinInfoSerial
+	makeGet(t, "/pins?filter=pinning,pin_error", &resp3)
+	if len(resp3) != 2 || resp3[0].Cid != test.TestCid2 {
+		t.Errorf("unexpected statusAll+filter resp:\n %+v", resp3)
+	}
+
+	var resp4 []api.GlobalPinInfoSerial
+	makeGet(t, "/pins?local=true&filter=pin_error", &resp4)
+	if len(resp4) != 1 || resp4[0].Cid != test.TestCid3 {
+		t.Errorf("unexpected statusAll+local+filter resp:\n %+v", resp4)
+	}
+
+	var errResp api.Error
+	makeGet(t, "/pins?filter=wrong", &errResp)
+	if errResp.Code != 400 {
+		t.Error("expected an error with a bad filter")
+	}
+
+	// Test pagination
+	var resp5 []api.GlobalPinInfoSerial
+	makeGet(t, "/pins?offset=1&limit=1", &resp5)
+	if len(resp5) != 1 || resp5[0].Cid != test.TestCid3 {
+		t.Errorf("unexpected statusAll+offset+limit resp:\n %+v", resp5)
+	}
+
+	var resp6 []api.GlobalPinInfoSerial
+	makeGet(t, "/pins?cursor="+test.TestCid3+"&filter=pinned,pinning", &resp6)
+	if len(resp6) != 1 || resp6[0].Cid != test.TestCid1 {
+		t.Errorf("unexpected statusAll+cursor+filter resp:\n %+v", resp6)
+	}
+
+	var resp7 []api.GlobalPinInfoSerial
+	makeGet(t, "/pins?sort=ts&limit=2", &resp7)
+	if len(resp7) != 2 {
+		t.Errorf("unexpected statusAll+sort resp:\n %+v", resp7)
+	}
+
+	var resp8 []api.GlobalPinInfoSerial
+	makeGet(t, "/pins?sort=name&offset=1&limit=1&filter=pinned,pinning", &resp8)
+	if len(resp8) != 1 || resp8[0].Cid != test.TestCid1 {
+		t.Errorf("unexpected statusAll+sort+filter resp:\n %+v", resp8)
+	}
+
+	var resp9 []api.GlobalPinInfoSerial
+	makeGet(t, "/pins?sort=name&local=true", &resp9)
+	if len(resp9) != 2 || resp9[0].Cid != test.TestCid3 {
+		t.Errorf("unexpected statusAll+sort+local resp:\n %+v", resp9)
+	}
+
+	var errResp2 api.Error
+	makeGet(t, "/pins?sort=size", &errResp2)
+	if errResp2.Code != 400 {
+		t.Error("expected an error with a bad sort order")
+	}
 }
 
 func TestAPIStatusEndpoint(t *testing.T) {
@@ -364,8 +1376,189 @@ func TestAPIRecoverAllEndpoint(t *testing.T) {
 	}
 
 	var errResp api.Error
-	makePost(t, "/pins/recover", []byte{}, &errResp)
+	makePost(t, "/pins/recover?filter=wrong", []byte{}, &errResp)
 	if errResp.Code != 400 {
 		t.Error("expected a different error")
 	}
+
+	var resp2 []api.GlobalPinInfoSerial
+	makePost(t, "/pins/recover?filter=pin_error", []byte{}, &resp2)
+	if len(resp2) != 1 || resp2[0].Cid != test.TestCid3 {
+		t.Errorf("unexpected recover all response: %+v", resp2)
+	}
+}
+
+func TestAPISpecEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	var spec struct {
+		OpenAPI string                                       `json:"openapi"`
+		Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+		Servers []map[string]string                          `json:"servers"`
+	}
+	makeGet(t, SpecPath, &spec)
+	if spec.OpenAPI != openAPIVersion {
+		t.Error("unexpected openapi version:", spec.OpenAPI)
+	}
+
+	for _, r := range rest.routes() {
+		op, ok := spec.Paths[r.Pattern][strings.ToLower(r.Method)]
+		if !ok {
+			t.Errorf("%s %s is missing from the spec", r.Method, r.Pattern)
+			continue
+		}
+		if op["operationId"] != r.Name {
+			t.Error("unexpected operationId:", op["operationId"])
+		}
+	}
+	if _, ok := spec.Paths["/public/status"]; ok {
+		t.Error("the public status is disabled")
+	}
+	if len(spec.Servers) != 1 || spec.Servers[0]["url"] != APIPrefix {
+		t.Error("paths should be relative to the current version:", spec.Servers)
+	}
+}
+
+func TestAPIVersionedRoutes(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	resp, err := http.Get(apiHost + APIPrefix + "/id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get(VersionHeader) != APIVersion {
+		t.Error("the current version should serve /id")
+	}
+	if resp.Header.Get("Deprecation") != "" {
+		t.Error("the current version is not deprecated")
+	}
+
+	for path, successor := range map[string]string{
+		"/pins/" + test.TestCid1: APIPrefix + "/pins/" + test.TestCid1,
+		"/api/v0/spec":           SpecPath,
+	} {
+		resp, err = http.Get(apiHost + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 || resp.Header.Get("Deprecation") != "true" {
+			t.Errorf("%s should be served and deprecated", path)
+		}
+		expected := "<" + successor + `>; rel="successor-version"`
+		if link := resp.Header.Get("Link"); link != expected {
+			t.Errorf("unexpected link for %s: %s", path, link)
+		}
+	}
+
+	var versions api.APIVersions
+	makeGet(t, VersionsPath, &versions)
+	if versions.Current != APIVersion || len(versions.Versions) != 2 || versions.Versions[0] != "v0" {
+		t.Error("unexpected versions:", versions)
+	}
+}
+
+func TestAPIIdempotencyKey(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	post := func() *http.Response {
+		req, _ := http.NewRequest("POST", apiHost+"/pins/"+test.TestCid1, nil)
+		req.Header.Set(IdempotencyKeyHeader, "abc")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	first := post()
+	if first.StatusCode != 202 || first.Header.Get(IdempotentReplayedHeader) != "" {
+		t.Error("the first request should be executed:", first.StatusCode)
+	}
+	second := post()
+	if second.StatusCode != 202 || second.Header.Get(IdempotentReplayedHeader) != "true" {
+		t.Error("the retry should be replayed:", second.StatusCode)
+	}
+}
+
+func TestAPIRateLimit(t *testing.T) {
+	apiMAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/10002")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ListenAddr = apiMAddr
+	cfg.RateLimit = 2
+	rest, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rest.Shutdown()
+	rest.server.SetKeepAlivesEnabled(false)
+	rest.SetClient(test.NewMockRPCClient(t))
+
+	get := func() *http.Response {
+		resp, err := http.Get(apiHost + "/id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get()
+	if resp.StatusCode != 200 || resp.Header.Get("X-RateLimit-Limit") != "2" || resp.Header.Get("X-RateLimit-Remaining") != "1" {
+		t.Error("unexpected rate limit headers:", resp.Header)
+	}
+	get()
+	resp = get()
+	if resp.StatusCode != 429 || resp.Header.Get("Retry-After") == "" {
+		t.Error("expected the request to be rate-limited:", resp.StatusCode)
+	}
+}
+
+func TestAPIReadOnly(t *testing.T) {
+	apiMAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/10002")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ListenAddr = apiMAddr
+	cfg.ReadOnly = true
+	rest, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rest.Shutdown()
+	rest.server.SetKeepAlivesEnabled(false)
+	rest.SetClient(test.NewMockRPCClient(t))
+
+	var pins []api.GlobalPinInfoSerial
+	makeGet(t, "/pins", &pins)
+	if len(pins) != 3 {
+		t.Error("listings should be served in read-only mode")
+	}
+
+	errResp := api.Error{}
+	makePost(t, "/pins/"+test.TestCid1, []byte{}, &errResp)
+	if errResp.Code != 403 {
+		t.Error("pinning should be rejected in read-only mode:", errResp)
+	}
+
+	errResp = api.Error{}
+	makeDelete(t, APIPrefix+"/peers/"+test.TestPeerID1.Pretty(), &errResp)
+	if errResp.Code != 403 {
+		t.Error("removing peers should be rejected in read-only mode:", errResp)
+	}
+
+	httpResp, err := http.Post(apiHost+"/allocations/preview", "application/json",
+		strings.NewReader(`{"cid":"`+test.TestCid1+`","replication_factor":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode == 403 {
+		t.Error("allocation previews should be served in read-only mode")
+	}
 }
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"net/http"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+)
+
+// pinSummaryHandler counts the status of all pins, or of those matching
+// the filter. The status is fetched in chunks, like in statusAllHandler,
+// so only the counts are held in memory.
+func (api *API) pinSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseFilterOrError(w, r)
+	if !ok {
+		return
+	}
+	fetch := api.statusFetcher(r.URL.Query().Get("local") == "true", filter)
+
+	summary := types.PinSummarySerial{
+		ByStatus: make(map[string]int),
+		ByPeer:   make(map[string]types.PeerPinSummary),
+	}
+	after := ""
+	for {
+		chunk, err := fetch(after)
+		if !checkRPCErr(w, err) {
+			return
+		}
+		for _, gpi := range chunk {
+			addToPinSummary(&summary, gpi)
+		}
+		if len(chunk) < statusChunkSize {
+			break
+		}
+		after = chunk[len(chunk)-1].Cid
+	}
+	sendJSONResponse(w, 200, summary)
+}
+
+// addToPinSummary counts the status of an item in every peer.
+func addToPinSummary(summary *types.PinSummarySerial, gpi types.GlobalPinInfoSerial) {
+	summary.Pins++
+	for p, pinfo := range gpi.PeerMap {
+		summary.ByStatus[pinfo.Status]++
+
+		pps := summary.ByPeer[p]
+		switch types.TrackerStatusFromString(pinfo.Status) {
+		case types.TrackerStatusPinned:
+			pps.Pinned++
+		case types.TrackerStatusPinning:
+			pps.Pinning++
+		case types.TrackerStatusPinError,
+			types.TrackerStatusUnpinError,
+			types.TrackerStatusClusterError:
+			pps.Error++
+		}
+		summary.ByPeer[p] = pps
+	}
+}
@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+
+	mux "github.com/gorilla/mux"
+)
+
+// APIVersion is the current version of the REST API. Its routes are
+// served under APIPrefix.
+const APIVersion = "v1"
+
+// APIPrefix is the path prefix of the routes of the current version.
+const APIPrefix = "/api/" + APIVersion
+
+// VersionsPath is the path on which the API lists its versions, so that
+// clients can choose one.
+const VersionsPath = "/api/versions"
+
+// VersionHeader carries the version of the API which served a response.
+const VersionHeader = "Cluster-Api-Version"
+
+// SupportedVersions are the versions of the API served by this peer,
+// oldest first. The unversioned routes of the "v0" version are kept for
+// compatibility: they are deprecated and respond like the routes of the
+// current version, until these change in a way that breaks them.
+var SupportedVersions = []string{"v0", APIVersion}
+
+// legacySpecPath is where the OpenAPI specification was served before
+// the API was versioned.
+const legacySpecPath = "/api/v0/spec"
+
+// versioned wraps the handler of a route of the current version.
+func versioned(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(VersionHeader, APIVersion)
+		h(w, r)
+	}
+}
+
+// legacy wraps the handler of an unversioned route. Responses are marked
+// as deprecated and link to the same route in the current version.
+func legacy(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(VersionHeader, "v0")
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"",
+			APIPrefix, strings.TrimPrefix(r.URL.Path, "/api/v0")))
+		h(w, r)
+	}
+}
+
+// addVersionedRoute registers a route of the current version and its
+// legacy, unversioned path.
+func addVersionedRoute(router *mux.Router, route route, h http.HandlerFunc) {
+	router.
+		Methods(route.Method).
+		Path(APIPrefix + route.Pattern).
+		Name(route.Name).
+		Handler(versioned(h))
+	router.
+		Methods(route.Method).
+		Path(route.Pattern).
+		Name("Legacy" + route.Name).
+		Handler(legacy(h))
+}
+
+func (api *API) versionsHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSONResponse(w, 200, types.APIVersions{
+		Versions: SupportedVersions,
+		Current:  APIVersion,
+	})
+}
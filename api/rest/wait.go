@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+)
+
+// pinWaitInterval is how often the status of an item is checked while a
+// pin request waits for it to be pinned.
+var pinWaitInterval = 500 * time.Millisecond
+
+// parseWaitOrError reads the "wait" and "wait-timeout" query parameters of
+// a pin request. The timeout defaults to half the write timeout of the
+// API and it must be shorter than it, or the connection would be closed
+// before the response is sent. It sends an error response and returns
+// false when they are not valid.
+func (api *API) parseWaitOrError(w http.ResponseWriter, r *http.Request) (bool, time.Duration, bool) {
+	queryValues := r.URL.Query()
+	if queryValues.Get("wait") != "true" {
+		return false, 0, true
+	}
+
+	timeout := api.config.WriteTimeout / 2
+	if t := queryValues.Get("wait-timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 {
+			sendErrorResponse(w, 400, "invalid wait-timeout: "+t)
+			return false, 0, false
+		}
+		timeout = d
+	}
+	if timeout >= api.config.WriteTimeout {
+		sendErrorResponse(w, 400, fmt.Sprintf(
+			"wait-timeout must be shorter than the write timeout of the API (%s)",
+			api.config.WriteTimeout))
+		return false, 0, false
+	}
+	return true, timeout, true
+}
+
+// waitForPin answers a pin request once the item is pinned in as many
+// peers as it is allocated to (or in every peer for items pinned
+// everywhere), with its status. It fails when any of those peers reports
+// an error, and when the timeout expires first.
+func (api *API) waitForPin(w http.ResponseWriter, ps types.PinSerial, timeout time.Duration) {
+	var pin types.PinSerial
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"PinGet",
+		types.PinSerial{Cid: ps.Cid},
+		&pin)
+	if err != nil {
+		sendErrorResponse(w, 500, err.Error())
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var gpinfo types.GlobalPinInfoSerial
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"Status",
+			types.PinSerial{Cid: ps.Cid},
+			&gpinfo)
+		if err != nil {
+			sendErrorResponse(w, 500, err.Error())
+			return
+		}
+
+		pinned, target, errs := pinProgress(pin, gpinfo)
+		switch {
+		case len(errs) > 0:
+			sendErrorResponseWithDetails(w, 500,
+				fmt.Sprintf("%s could not be pinned in %d peers", ps.Cid, len(errs)), errs)
+			return
+		case pinned >= target:
+			sendJSONResponse(w, 200, gpinfo)
+			return
+		case time.Now().Add(pinWaitInterval).After(deadline):
+			sendErrorResponse(w, 504, fmt.Sprintf(
+				"timed out waiting for %s to be pinned: pinned in %d of %d peers",
+				ps.Cid, pinned, target))
+			return
+		}
+
+		select {
+		case <-time.After(pinWaitInterval):
+		case <-api.ctx.Done():
+			sendErrorResponse(w, 503, "the API is shutting down")
+			return
+		}
+	}
+}
+
+// pinProgress returns in how many peers an item is pinned, in how many it
+// should be and the errors of the peers which failed to pin it. Items
+// without allocations are pinned everywhere: in every peer which does not
+// report them as remote.
+func pinProgress(pin types.PinSerial, gpinfo types.GlobalPinInfoSerial) (int, int, map[string]string) {
+	peers := pin.Allocations
+	if len(peers) == 0 {
+		for p, pinfo := range gpinfo.PeerMap {
+			if pinfo.Status != types.TrackerStatusRemote.String() {
+				peers = append(peers, p)
+			}
+		}
+	}
+
+	pinned := 0
+	errs := make(map[string]string)
+	for _, p := range peers {
+		pinfo, ok := gpinfo.PeerMap[p]
+		if !ok {
+			continue
+		}
+		switch pinfo.Status {
+		case types.TrackerStatusPinned.String():
+			pinned++
+		case types.TrackerStatusPinError.String(), types.TrackerStatusClusterError.String():
+			errs[p] = pinfo.Error
+		}
+	}
+	return pinned, len(peers), errs
+}
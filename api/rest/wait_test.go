@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestPinProgress(t *testing.T) {
+	p1 := test.TestPeerID1.Pretty()
+	p2 := test.TestPeerID2.Pretty()
+	p3 := test.TestPeerID3.Pretty()
+	gpinfo := api.GlobalPinInfoSerial{
+		Cid: test.TestCid1,
+		PeerMap: map[string]api.PinInfoSerial{
+			p1: {Status: "pinned"},
+			p2: {Status: "pinning"},
+			p3: {Status: "remote"},
+		},
+	}
+
+	pin := api.PinSerial{Cid: test.TestCid1, Allocations: []string{p1, p2}}
+	pinned, target, errs := pinProgress(pin, gpinfo)
+	if pinned != 1 || target != 2 || len(errs) != 0 {
+		t.Error("unexpected progress:", pinned, target, errs)
+	}
+
+	// pinned everywhere: remote peers do not count
+	pin.Allocations = nil
+	pinned, target, _ = pinProgress(pin, gpinfo)
+	if pinned != 1 || target != 2 {
+		t.Error("unexpected progress:", pinned, target)
+	}
+
+	gpinfo.PeerMap[p2] = api.PinInfoSerial{Status: "pin_error", Error: "timeout"}
+	_, _, errs = pinProgress(pin, gpinfo)
+	if errs[p2] != "timeout" {
+		t.Error("the error should be reported:", errs)
+	}
+
+	pin.Allocations = []string{p1}
+	pinned, target, errs = pinProgress(pin, gpinfo)
+	if pinned != 1 || target != 1 || len(errs) != 0 {
+		t.Error("only the allocations should count:", pinned, target, errs)
+	}
+}
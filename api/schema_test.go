@@ -0,0 +1,298 @@
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden files for the current SchemaVersion")
+
+// schemaFixtures returns an instance of every type whose JSON
+// representation is covered by SchemaVersion.
+func schemaFixtures() map[string]interface{} {
+	pinfo := PinInfo{
+		Cid:    testCid1,
+		Peer:   testPeerID1,
+		Status: TrackerStatusPinned,
+		TS:     testTime,
+	}
+
+	return map[string]interface{}{
+		"global_pin_info": GlobalPinInfo{
+			Cid: testCid1,
+			PeerMap: map[peer.ID]PinInfo{
+				testPeerID1: pinfo,
+			},
+		}.ToSerial(),
+		"pin_info": pinfo.ToSerial(),
+		"pin_event": PinEvent{
+			PinInfo: PinInfo{
+				Cid:    testCid1,
+				Peer:   testPeerID1,
+				Status: TrackerStatusPinning,
+				TS:     testTime,
+			},
+			Queued: true,
+		}.ToSerial(),
+		"id": ID{
+			ID:                    testPeerID1,
+			Addresses:             []ma.Multiaddr{testMAddr},
+			ClusterPeers:          []peer.ID{testPeerID2},
+			ClusterPeersAddresses: []ma.Multiaddr{testMAddr2},
+			Version:               "0.0.1",
+			Commit:                "abc",
+			RPCProtocolVersion:    "/ipfscluster/0.0.1/rpc",
+			IPFS: IPFSID{
+				ID:        testPeerID2,
+				Addresses: []ma.Multiaddr{testMAddr},
+			},
+			Peername:       "peer1",
+			PinningEnabled: true,
+			Health:         PeerHealthOK,
+		}.ToSerial(),
+		"health": Health{
+			Peer:   testPeerID1,
+			Status: PeerHealthWaitingForIPFS,
+			Error:  "connection refused",
+		}.ToSerial(),
+		"tracker_metrics": TrackerMetrics{
+			Peer:            testPeerID1,
+			PinQueue:        3,
+			UnpinQueue:      1,
+			BackgroundQueue: 10,
+			InFlight:        2,
+			PinErrors:       4,
+			Retries:         7,
+			Pins:            120,
+			AvgPinLatency:   1500 * time.Millisecond,
+		}.ToSerial(),
+		"sync_status": SyncStatus{
+			Peer: testPeerID1,
+			State: SyncInfo{
+				Enabled:   true,
+				Interval:  time.Minute,
+				Jitter:    10 * time.Second,
+				Last:      testTime,
+				OutOfSync: 2,
+			},
+			IPFS: SyncInfo{
+				Error: "connection refused",
+			},
+		}.ToSerial(),
+		"public_status": PublicStatus{
+			Peers:        3,
+			HealthyPeers: 2,
+			Pins:         10,
+			TotalSize:    1024,
+			Health:       PeerHealthOK,
+		},
+		"pin": Pin{
+			Cid:               testCid1,
+			Name:              "name",
+			Allocations:       []peer.ID{testPeerID1},
+			ReplicationFactor: 1,
+		}.ToSerial(),
+		"meta_pin": Pin{
+			Cid:               testCid1,
+			Type:              MetaType,
+			Name:              "name",
+			Allocations:       []peer.ID{testPeerID1},
+			ReplicationFactor: 1,
+			Shards:            []*cid.Cid{testCid1},
+		}.ToSerial(),
+		"allocation_preview": AllocationPreviewSerial{
+			Cid:                  testCid1.String(),
+			ReplicationFactorMin: 1,
+			ReplicationFactorMax: 2,
+		},
+		"peer_maintenance": PeerMaintenance{
+			Peer:    testPeerID1,
+			Enabled: true,
+		}.ToSerial(),
+		"rpc_call": RPCCallSerial{
+			Service: "Cluster",
+			Method:  "ID",
+			Args:    json.RawMessage("{}"),
+		},
+		"resolved_multihash": ResolvedMultihash{
+			Multihash: testCid1.Hash().B58String(),
+			Cid:       testCid1.String(),
+			Available: true,
+		},
+		"allocation_record": AllocationRecord{
+			Cid:         testCid1,
+			Peer:        testPeerID1,
+			Allocations: []peer.ID{testPeerID2},
+			MetricName:  "freespace",
+			Metrics: map[peer.ID]string{
+				testPeerID2: "100",
+			},
+			Considered: []peer.ID{testPeerID1, testPeerID2},
+			Vetoes: map[peer.ID]string{
+				testPeerID1: "in maintenance",
+			},
+			Reason: "reason",
+			TS:     testTime,
+		}.ToSerial(),
+		"allocation_simulation": AllocationSimulation{
+			Records: []AllocationRecord{
+				{
+					Cid:         testCid1,
+					Peer:        testPeerID1,
+					Allocations: []peer.ID{testPeerID2},
+					MetricName:  "numpin",
+					Metrics: map[peer.ID]string{
+						testPeerID2: "3",
+					},
+					Reason: "reason",
+					TS:     testTime,
+				},
+			},
+			Load: []PeerLoad{
+				{
+					Peer:    testPeerID2,
+					Current: 3,
+					Added:   1,
+				},
+			},
+		}.ToSerial(),
+		"scaling_advice": ScalingAdvice{
+			Action: ScalingNone,
+			Pressure: []PeerPressure{
+				{
+					Peer:      testPeerID1,
+					FreeSpace: 1000,
+				},
+			},
+			TS: testTime,
+		}.ToSerial(),
+		"log_level": LogLevel{
+			Component: "cluster",
+			Level:     "debug",
+		},
+		"local_pin": LocalPin{
+			Cid:     testCid1,
+			Type:    IPFSPinStatusRecursive,
+			Tracked: true,
+		}.ToSerial(),
+		"duplicate_pins": DuplicatePins{
+			Multihash: testCid1.Hash().B58String(),
+			Pins: []Pin{
+				{
+					Cid:               testCid1,
+					Name:              "name",
+					ReplicationFactor: -1,
+				},
+				{
+					Cid:               cid.NewCidV1(cid.DagProtobuf, testCid1.Hash()),
+					Allocations:       []peer.ID{testPeerID1},
+					ReplicationFactor: 1,
+				},
+			},
+		}.ToSerial(),
+		"allocation_strategy": AllocationStrategy{
+			Name: "disk-freespace",
+		},
+		"runtime_config": RuntimeConfig{
+			"cluster.pinning_enabled":    json.RawMessage("false"),
+			"maptracker.concurrent_pins": json.RawMessage("4"),
+		},
+		"version": Version{
+			Version: "0.0.1",
+			Schema:  SchemaVersion,
+		},
+		"error": Error{
+			Code:    404,
+			Message: "not found",
+		},
+		"allocation_error": Error{
+			Code:    500,
+			Message: "not enough candidates to allocate",
+			Details: map[string]string{
+				testPeerID1.Pretty(): "blacklisted",
+				testPeerID2.Pretty(): "invalid or expired metric",
+			},
+		},
+	}
+}
+
+// TestSchemaGolden checks that the JSON representation of the Serial types
+// matches the golden files for the current SchemaVersion. If this test
+// fails, the output of the APIs has changed shape: increase SchemaVersion,
+// run the tests with -update-golden and remove the golden files of the
+// previous version.
+func TestSchemaGolden(t *testing.T) {
+	dir := filepath.Join("testdata", fmt.Sprintf("schema_v%d", SchemaVersion))
+	if *updateGolden {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "schema_v*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*updateGolden && (len(files) != 1 || files[0] != dir) {
+		t.Errorf("only the golden files of schema version %d should be kept: %s", SchemaVersion, files)
+	}
+
+	for name, obj := range schemaFixtures() {
+		got, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(dir, name+".json")
+		if *updateGolden {
+			err := ioutil.WriteFile(path, append(got, '\n'), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		golden, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != strings.TrimSpace(string(golden)) {
+			t.Errorf("%s does not match %s:\n%s", name, path, got)
+		}
+	}
+}
+
+// TestSchemaEmptyValues checks that empty slices and maps are not
+// encoded as null.
+func TestSchemaEmptyValues(t *testing.T) {
+	objs := []interface{}{
+		GlobalPinInfo{}.ToSerial(),
+		ID{}.ToSerial(),
+		Pin{}.ToSerial(),
+		AllocationRecord{}.ToSerial(),
+		ScalingAdvice{}.ToSerial(),
+		StateChecksum{}.ToSerial(),
+		StateDiff{}.ToSerial(),
+		Error{},
+	}
+	for _, obj := range objs {
+		j, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(j), "null") {
+			t.Errorf("%T has null values: %s", obj, j)
+		}
+	}
+}
@@ -9,7 +9,11 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	cid "github.com/ipfs/go-cid"
@@ -26,6 +30,15 @@ import (
 
 var logger = logging.Logger("apitypes")
 
+// SchemaVersion is the version of the JSON representation of the types in
+// this package which are sent over the APIs (the Serial types). All their
+// fields are always present (they are never omitted when empty), empty
+// slices and maps are encoded as [] and {}, and fields follow declaration
+// order. Any change in the shape of these types must increase this version
+// and replace the golden files in testdata, which only cover the current
+// version.
+const SchemaVersion = 7
+
 // TrackerStatus values
 const (
 	// IPFSStatus should never take this value
@@ -46,21 +59,33 @@ const (
 	TrackerStatusUnpinned
 	// The IPFS deamon is not pinning the item but it is being tracked
 	TrackerStatusRemote
+	// The IPFS daemon is not pinning the item directly, but it is
+	// covered by another recursive pin
+	TrackerStatusPinnedIndirect
+	// The item is allocated to other peers, but they do not report it
+	// as pinned
+	TrackerStatusRemoteError
+	// The item has been unpinned from the cluster, but it stays pinned
+	// in IPFS until the unpin grace period is over
+	TrackerStatusTrashed
 )
 
 // TrackerStatus represents the status of a tracked Cid in the PinTracker
 type TrackerStatus int
 
 var trackerStatusString = map[TrackerStatus]string{
-	TrackerStatusBug:          "bug",
-	TrackerStatusClusterError: "cluster_error",
-	TrackerStatusPinError:     "pin_error",
-	TrackerStatusUnpinError:   "unpin_error",
-	TrackerStatusPinned:       "pinned",
-	TrackerStatusPinning:      "pinning",
-	TrackerStatusUnpinning:    "unpinning",
-	TrackerStatusUnpinned:     "unpinned",
-	TrackerStatusRemote:       "remote",
+	TrackerStatusBug:            "bug",
+	TrackerStatusClusterError:   "cluster_error",
+	TrackerStatusPinError:       "pin_error",
+	TrackerStatusUnpinError:     "unpin_error",
+	TrackerStatusPinned:         "pinned",
+	TrackerStatusPinning:        "pinning",
+	TrackerStatusUnpinning:      "unpinning",
+	TrackerStatusUnpinned:       "unpinned",
+	TrackerStatusRemote:         "remote",
+	TrackerStatusPinnedIndirect: "pinned_indirect",
+	TrackerStatusRemoteError:    "remote_error",
+	TrackerStatusTrashed:        "trashed",
 }
 
 // String converts a TrackerStatus into a readable string.
@@ -79,6 +104,49 @@ func TrackerStatusFromString(str string) TrackerStatus {
 	return TrackerStatusBug
 }
 
+// StatusFilter selects tracked items with any of the given statuses. An
+// empty filter selects every item.
+type StatusFilter []TrackerStatus
+
+// Match returns whether the filter selects items with the given status.
+func (f StatusFilter) Match(st TrackerStatus) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, fst := range f {
+		if fst == st {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the filter as a comma-separated list of statuses.
+func (f StatusFilter) String() string {
+	strs := make([]string, len(f), len(f))
+	for i, st := range f {
+		strs[i] = st.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+// StatusFilterFromString parses a comma-separated list of statuses, like
+// "pin_error,unpin_error". An empty string returns an empty filter.
+func StatusFilterFromString(str string) (StatusFilter, error) {
+	var f StatusFilter
+	if str == "" {
+		return f, nil
+	}
+	for _, s := range strings.Split(str, ",") {
+		st := TrackerStatusFromString(strings.TrimSpace(s))
+		if st == TrackerStatusBug {
+			return nil, fmt.Errorf("unknown status in filter: %s", s)
+		}
+		f = append(f, st)
+	}
+	return f, nil
+}
+
 // IPFSPinStatus values
 const (
 	IPFSPinStatusBug = iota
@@ -98,7 +166,9 @@ func IPFSPinStatusFromString(t string) IPFSPinStatus {
 	// TODO: This is only used in the http_connector to parse
 	// ipfs-daemon-returned values. Maybe it should be extended.
 	switch {
-	case t == "indirect":
+	// "pin ls" reports "indirect through <parent>" when asked about a
+	// specific Cid.
+	case strings.HasPrefix(t, "indirect"):
 		return IPFSPinStatusIndirect
 	case t == "direct":
 		return IPFSPinStatusDirect
@@ -114,6 +184,70 @@ func (ips IPFSPinStatus) IsPinned() bool {
 	return ips == IPFSPinStatusDirect || ips == IPFSPinStatusRecursive
 }
 
+// String returns the pin type as named by IPFS.
+func (ips IPFSPinStatus) String() string {
+	switch ips {
+	case IPFSPinStatusError:
+		return "error"
+	case IPFSPinStatusDirect:
+		return "direct"
+	case IPFSPinStatusRecursive:
+		return "recursive"
+	case IPFSPinStatusIndirect:
+		return "indirect"
+	case IPFSPinStatusUnpinned:
+		return "unpinned"
+	default:
+		return "bug"
+	}
+}
+
+// LocalPin is an item pinned by the IPFS daemon of a peer, along with
+// whether it is part of the cluster's shared state (Tracked) and whether
+// this peer is allocated to pin it (Allocated).
+type LocalPin struct {
+	Cid       *cid.Cid
+	Type      IPFSPinStatus
+	Tracked   bool
+	Allocated bool
+}
+
+// LocalPinSerial is the serializable version of LocalPin.
+type LocalPinSerial struct {
+	Cid       string `json:"cid"`
+	Type      string `json:"type"`
+	Tracked   bool   `json:"tracked"`
+	Allocated bool   `json:"allocated"`
+}
+
+// ToSerial converts a LocalPin to its serializable version.
+func (lp LocalPin) ToSerial() LocalPinSerial {
+	c := ""
+	if lp.Cid != nil {
+		c = lp.Cid.String()
+	}
+	return LocalPinSerial{
+		Cid:       c,
+		Type:      lp.Type.String(),
+		Tracked:   lp.Tracked,
+		Allocated: lp.Allocated,
+	}
+}
+
+// ToLocalPin converts a LocalPinSerial to its native version.
+func (lps LocalPinSerial) ToLocalPin() LocalPin {
+	c, err := cid.Decode(lps.Cid)
+	if err != nil {
+		logger.Error(lps.Cid, err)
+	}
+	return LocalPin{
+		Cid:       c,
+		Type:      IPFSPinStatusFromString(lps.Type),
+		Tracked:   lps.Tracked,
+		Allocated: lps.Allocated,
+	}
+}
+
 // GlobalPinInfo contains cluster-wide status information about a tracked Cid,
 // indexed by cluster peer.
 type GlobalPinInfo struct {
@@ -167,16 +301,27 @@ type PinInfo struct {
 	Status TrackerStatus
 	TS     time.Time
 	Error  string
+	// Attempts is the number of consecutive failed attempts to pin
+	// the item. It is reset when the item is tracked or recovered.
+	Attempts int
+	// Blocks is the number of blocks fetched so far by an ongoing
+	// pin and Size the total size in bytes of the DAG being pinned,
+	// or 0 when it is not known. Both are only set while pinning.
+	Blocks int
+	Size   uint64
 }
 
 // PinInfoSerial is a serializable version of PinInfo.
 // information is marked as
 type PinInfoSerial struct {
-	Cid    string `json:"cid"`
-	Peer   string `json:"peer"`
-	Status string `json:"status"`
-	TS     string `json:"timestamp"`
-	Error  string `json:"error"`
+	Cid      string `json:"cid"`
+	Peer     string `json:"peer"`
+	Status   string `json:"status"`
+	TS       string `json:"timestamp"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+	Blocks   int    `json:"blocks"`
+	Size     uint64 `json:"size"`
 }
 
 // ToSerial converts a PinInfo to its serializable version.
@@ -191,11 +336,14 @@ func (pi PinInfo) ToSerial() PinInfoSerial {
 	}
 
 	return PinInfoSerial{
-		Cid:    c,
-		Peer:   p,
-		Status: pi.Status.String(),
-		TS:     pi.TS.UTC().Format(time.RFC3339),
-		Error:  pi.Error,
+		Cid:      c,
+		Peer:     p,
+		Status:   pi.Status.String(),
+		TS:       pi.TS.UTC().Format(time.RFC3339),
+		Error:    pi.Error,
+		Attempts: pi.Attempts,
+		Blocks:   pi.Blocks,
+		Size:     pi.Size,
 	}
 }
 
@@ -214,19 +362,470 @@ func (pis PinInfoSerial) ToPinInfo() PinInfo {
 		logger.Error(pis.TS, err)
 	}
 	return PinInfo{
+		Cid:      c,
+		Peer:     p,
+		Status:   TrackerStatusFromString(pis.Status),
+		TS:       ts,
+		Error:    pis.Error,
+		Attempts: pis.Attempts,
+		Blocks:   pis.Blocks,
+		Size:     pis.Size,
+	}
+}
+
+// shardStatusOrder sorts the statuses of the shards of an item, from the
+// one which best describes the item as a whole to the least relevant.
+var shardStatusOrder = []TrackerStatus{
+	TrackerStatusBug,
+	TrackerStatusClusterError,
+	TrackerStatusPinError,
+	TrackerStatusUnpinError,
+	TrackerStatusRemoteError,
+	TrackerStatusPinning,
+	TrackerStatusUnpinning,
+	TrackerStatusTrashed,
+	TrackerStatusUnpinned,
+	TrackerStatusRemote,
+	TrackerStatusPinnedIndirect,
+	TrackerStatusPinned,
+}
+
+// ShardedPinInfo aggregates the PinInfo of every shard of a MetaType pin
+// into the PinInfo for the pin itself. The item is only pinned when all
+// its shards are. Otherwise, it takes the status of the shard furthest
+// from being pinned (errors first, then ongoing operations), along with
+// its error. Progress counters are added up.
+func ShardedPinInfo(c *cid.Cid, pid peer.ID, shards []PinInfo) PinInfo {
+	info := PinInfo{
 		Cid:    c,
-		Peer:   p,
-		Status: TrackerStatusFromString(pis.Status),
-		TS:     ts,
-		Error:  pis.Error,
+		Peer:   pid,
+		Status: TrackerStatusUnpinned,
+		TS:     time.Now(),
+	}
+	if len(shards) == 0 {
+		return info
+	}
+
+	rank := len(shardStatusOrder)
+	for _, sh := range shards {
+		st := sh.Status
+		if st == TrackerStatusPinnedIndirect {
+			st = TrackerStatusPinned
+		}
+		for i, o := range shardStatusOrder {
+			if st == o && i < rank {
+				rank = i
+				info.Error = sh.Error
+				info.TS = sh.TS
+			}
+		}
+		if sh.Attempts > info.Attempts {
+			info.Attempts = sh.Attempts
+		}
+		info.Blocks += sh.Blocks
+		info.Size += sh.Size
+	}
+	if rank < len(shardStatusOrder) {
+		info.Status = shardStatusOrder[rank]
+	}
+	return info
+}
+
+// PinEvent reports that the status of an item has changed in a peer.
+// Queued is set for pinning and unpinning items which are waiting for
+// their turn, and unset once the operation starts.
+type PinEvent struct {
+	PinInfo
+	Queued bool
+}
+
+// PinEventSerial is the serializable version of PinEvent.
+type PinEventSerial struct {
+	PinInfoSerial
+	Queued bool `json:"queued"`
+}
+
+// ToSerial converts a PinEvent to its serializable version.
+func (pe PinEvent) ToSerial() PinEventSerial {
+	return PinEventSerial{
+		PinInfoSerial: pe.PinInfo.ToSerial(),
+		Queued:        pe.Queued,
+	}
+}
+
+// ToPinEvent converts a PinEventSerial to its native version.
+func (pes PinEventSerial) ToPinEvent() PinEvent {
+	return PinEvent{
+		PinInfo: pes.PinInfoSerial.ToPinInfo(),
+		Queued:  pes.Queued,
+	}
+}
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+// EventType values
+const (
+	// EventPinStatus is sent when the status of an item changes in
+	// the peer.
+	EventPinStatus EventType = "pin_status"
+	// EventPeerJoined and EventPeerLeft are sent when the peer sees
+	// other peers joining or leaving the peerset.
+	EventPeerJoined EventType = "peer_joined"
+	EventPeerLeft   EventType = "peer_left"
+	// EventAlert is sent when the peer monitor raises an alert for a
+	// peer (i.e. it stopped sending its ping metric).
+	EventAlert EventType = "alert"
+)
+
+// Event is something which happened in a cluster peer, as recorded by
+// it. Seq numbers are assigned by that peer in order, starting at 1 when
+// it starts. PinEvent is only set for EventPinStatus events, and Peer and
+// MetricName for the rest.
+type Event struct {
+	Seq        uint64
+	Type       EventType
+	TS         time.Time
+	PinEvent   *PinEvent
+	Peer       peer.ID
+	MetricName string
+}
+
+// EventSerial is the serializable version of Event.
+type EventSerial struct {
+	Seq        uint64          `json:"seq"`
+	Type       EventType       `json:"type"`
+	TS         string          `json:"timestamp"`
+	PinEvent   *PinEventSerial `json:"pin_event"`
+	Peer       string          `json:"peer"`
+	MetricName string          `json:"metric_name"`
+}
+
+// ToSerial converts an Event to its serializable version.
+func (ev Event) ToSerial() EventSerial {
+	evs := EventSerial{
+		Seq:        ev.Seq,
+		Type:       ev.Type,
+		TS:         timeToSerial(ev.TS),
+		MetricName: ev.MetricName,
+	}
+	if ev.PinEvent != nil {
+		pes := ev.PinEvent.ToSerial()
+		evs.PinEvent = &pes
+	}
+	if ev.Peer != "" {
+		evs.Peer = peer.IDB58Encode(ev.Peer)
+	}
+	return evs
+}
+
+// ToEvent converts an EventSerial to its native version.
+func (evs EventSerial) ToEvent() Event {
+	ev := Event{
+		Seq:        evs.Seq,
+		Type:       evs.Type,
+		TS:         timeFromSerial(evs.TS),
+		MetricName: evs.MetricName,
+	}
+	if evs.PinEvent != nil {
+		pe := evs.PinEvent.ToPinEvent()
+		ev.PinEvent = &pe
+	}
+	if evs.Peer != "" {
+		ev.Peer, _ = peer.IDB58Decode(evs.Peer)
+	}
+	return ev
+}
+
+// PinProgress describes how far an ongoing pin operation has got, as
+// reported by IPFS: the number of blocks fetched so far and the total
+// size of the DAG, or 0 when it is not known.
+type PinProgress struct {
+	Cid    *cid.Cid
+	Blocks int
+	Size   uint64
+}
+
+// PinProgressSerial is the serializable version of PinProgress.
+type PinProgressSerial struct {
+	Cid    string `json:"cid"`
+	Blocks int    `json:"blocks"`
+	Size   uint64 `json:"size"`
+}
+
+// ToSerial converts a PinProgress to its serializable version.
+func (pp PinProgress) ToSerial() PinProgressSerial {
+	c := ""
+	if pp.Cid != nil {
+		c = pp.Cid.String()
+	}
+	return PinProgressSerial{
+		Cid:    c,
+		Blocks: pp.Blocks,
+		Size:   pp.Size,
+	}
+}
+
+// ToPinProgress converts a PinProgressSerial to its native version.
+func (pps PinProgressSerial) ToPinProgress() PinProgress {
+	c, err := cid.Decode(pps.Cid)
+	if err != nil {
+		logger.Error(pps.Cid, err)
+	}
+	return PinProgress{
+		Cid:    c,
+		Blocks: pps.Blocks,
+		Size:   pps.Size,
+	}
+}
+
+// StatusChunk selects a chunk of the status of all tracked items: up to
+// Limit items matching Filter, in Cid order, which come after the Cid in
+// After. An empty After selects the first chunk. When Cids is set, the
+// chunk holds the status of those items which matches Filter instead, and
+// After and Limit are ignored.
+type StatusChunk struct {
+	After  string       `json:"after"`
+	Limit  int          `json:"limit"`
+	Filter StatusFilter `json:"filter"`
+	Cids   []string     `json:"cids"`
+}
+
+// PinsPage selects a page of the pins in the shared state. They are
+// sorted by Cid or, when ByName is set, by name and then by Cid. The pins
+// up to the Cid in After (only when sorting by Cid) and the first Offset
+// of the rest are skipped, and at most Limit are returned (0 means no
+// limit).
+type PinsPage struct {
+	After  string `json:"after"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+	ByName bool   `json:"by_name"`
+}
+
+// AddParams are the options to add content to IPFS through cluster.
+// They match those of "ipfs add".
+type AddParams struct {
+	Chunker           string `json:"chunker"`
+	RawLeaves         bool   `json:"raw_leaves"`
+	WrapWithDirectory bool   `json:"wrap_with_directory"`
+}
+
+// AddChunk is a piece of the multipart body of a request to add content
+// to IPFS. The first chunk for a Session starts the request, using its
+// Params and ContentType, and the Last one finishes it. Cancel aborts it.
+type AddChunk struct {
+	Session     string    `json:"session"`
+	Params      AddParams `json:"params"`
+	ContentType string    `json:"content_type"`
+	Data        []byte    `json:"data"`
+	Last        bool      `json:"last"`
+	Cancel      bool      `json:"cancel"`
+}
+
+// AddedOutput describes an item (file or directory) added to IPFS, with
+// its path in the request and the cumulative size of its DAG.
+type AddedOutput struct {
+	Name string
+	Cid  *cid.Cid
+	Size uint64
+}
+
+// AddedOutputSerial is the serializable version of AddedOutput.
+type AddedOutputSerial struct {
+	Name string `json:"name"`
+	Cid  string `json:"cid"`
+	Size uint64 `json:"size"`
+}
+
+// ToSerial converts an AddedOutput to its serializable version.
+func (ao AddedOutput) ToSerial() AddedOutputSerial {
+	c := ""
+	if ao.Cid != nil {
+		c = ao.Cid.String()
+	}
+	return AddedOutputSerial{
+		Name: ao.Name,
+		Cid:  c,
+		Size: ao.Size,
+	}
+}
+
+// ToAddedOutput converts an AddedOutputSerial to its native version.
+func (aos AddedOutputSerial) ToAddedOutput() AddedOutput {
+	c, _ := cid.Decode(aos.Cid)
+	return AddedOutput{
+		Name: aos.Name,
+		Cid:  c,
+		Size: aos.Size,
 	}
 }
 
 // Version holds version information
 type Version struct {
 	Version string `json:"Version"`
+	Schema  int    `json:"schema"` // SchemaVersion
+}
+
+// APIVersions lists the versions of the REST API served by a peer,
+// oldest first, and the current one.
+type APIVersions struct {
+	Versions []string `json:"versions"`
+	Current  string   `json:"current"`
+}
+
+// LogLevel holds a logging facility (component) and the level it
+// should be set to.
+type LogLevel struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+// AllocationStrategy holds the name of an allocation strategy (the
+// combination of an informer and an allocator, i.e. "disk-freespace").
+type AllocationStrategy struct {
+	Name string `json:"name"`
+}
+
+// RESTLibp2pProtocol is the libp2p protocol over which the REST API is
+// served, as plain HTTP, when it is enabled.
+var RESTLibp2pProtocol = protocol.ID("/ipfscluster/restapi/http")
+
+// Namespace describes one of the namespaces in which pins can be added,
+// with its replication factor and quotas (0 means none), the number of
+// pins in it and their cumulative size.
+type Namespace struct {
+	Name              string `json:"name"`
+	ReplicationFactor int    `json:"replication_factor"`
+	MaxPins           int    `json:"max_pins"`
+	MaxBytes          uint64 `json:"max_bytes"`
+	Pins              int    `json:"pins"`
+	Bytes             uint64 `json:"bytes"`
+}
+
+// quotaErrorPrefix starts the message of every QuotaError.
+const quotaErrorPrefix = "quota exceeded:"
+
+// QuotaError is returned when a pin request would exceed one of the
+// quotas of a namespace ("max_pins" or "max_bytes"). Used is the usage
+// of the namespace before the request and Requested what the request
+// adds to it.
+type QuotaError struct {
+	Namespace string
+	Quota     string
+	Max       uint64
+	Used      uint64
+	Requested uint64
+}
+
+// Error returns the message of the QuotaError. It lists its fields as
+// key=value pairs, so they survive RPC calls and can be recovered with
+// QuotaErrorDetails.
+func (qe *QuotaError) Error() string {
+	return fmt.Sprintf("%s namespace=%s quota=%s max=%d used=%d requested=%d",
+		quotaErrorPrefix, qe.Namespace, qe.Quota, qe.Max, qe.Used, qe.Requested)
+}
+
+// QuotaErrorDetails returns the fields of a QuotaError from its message,
+// keyed by name. It returns false when the message does not belong to a
+// QuotaError.
+func QuotaErrorDetails(msg string) (map[string]string, bool) {
+	if !strings.HasPrefix(msg, quotaErrorPrefix) {
+		return nil, false
+	}
+	details := make(map[string]string)
+	for _, f := range strings.Fields(strings.TrimPrefix(msg, quotaErrorPrefix)) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) == 2 {
+			details[kv[0]] = kv[1]
+		}
+	}
+	return details, true
+}
+
+// allocationErrorPrefix starts the message of every AllocationError, and
+// allocationErrorVetoes separates the reason from the vetoed peers.
+const (
+	allocationErrorPrefix = "allocation failed:"
+	allocationErrorVetoes = ". Excluded: "
+)
+
+// AllocationError is returned when a Cid cannot be allocated to enough
+// peers. Vetoes lists the candidates which were discarded by the
+// allocation (i.e. blacklisted, in maintenance or discarded by a filter)
+// along with the reason.
+type AllocationError struct {
+	Cid    *cid.Cid
+	Reason string
+	Vetoes map[peer.ID]string
+}
+
+// Error returns the message of the AllocationError. The vetoes are
+// appended as a JSON object, so they survive RPC calls and can be
+// recovered with AllocationErrorDetails.
+func (ae *AllocationError) Error() string {
+	vetoes := make(map[string]string)
+	for p, reason := range ae.Vetoes {
+		vetoes[peer.IDB58Encode(p)] = reason
+	}
+	j, _ := json.Marshal(vetoes)
+	return fmt.Sprintf("%s %s: %s%s%s",
+		allocationErrorPrefix, ae.Cid, ae.Reason, allocationErrorVetoes, j)
+}
+
+// AllocationErrorDetails returns the vetoes of an AllocationError from
+// its message, keyed by peer ID. The message may be wrapped by other
+// errors. It returns false when the message does not contain an
+// AllocationError.
+func AllocationErrorDetails(msg string) (map[string]string, bool) {
+	i := strings.Index(msg, allocationErrorPrefix)
+	if i < 0 {
+		return nil, false
+	}
+	details := make(map[string]string)
+	j := strings.LastIndex(msg[i:], allocationErrorVetoes)
+	if j >= 0 {
+		v := msg[i+j+len(allocationErrorVetoes):]
+		if err := json.Unmarshal([]byte(v), &details); err != nil {
+			logger.Debugf("cannot decode the vetoes of an allocation error: %s", err)
+		}
+	}
+	return details, true
+}
+
+// invalidPinErrorPrefix starts the message of every InvalidPinError.
+const invalidPinErrorPrefix = "invalid pin:"
+
+// InvalidPinError is returned when a pin request cannot be accepted as
+// it was given (i.e. the inline content does not match the Cid, or the
+// namespace does not exist), so that APIs can tell it from other
+// failures.
+type InvalidPinError struct {
+	Reason string
+}
+
+// Error returns the message of the InvalidPinError.
+func (ipe *InvalidPinError) Error() string {
+	return invalidPinErrorPrefix + " " + ipe.Reason
+}
+
+// IsInvalidPinError returns true when the given error message belongs to
+// an InvalidPinError. The message may be wrapped by other errors.
+func IsInvalidPinError(msg string) bool {
+	return strings.Contains(msg, invalidPinErrorPrefix)
+}
+
+// NewInvalidPinError returns an InvalidPinError with the formatted
+// reason.
+func NewInvalidPinError(format string, args ...interface{}) error {
+	return &InvalidPinError{Reason: fmt.Sprintf(format, args...)}
 }
 
+// RuntimeConfig maps the keys of the configuration options which can be
+// changed without restarting a peer (i.e. "maptracker.concurrent_pins")
+// to their new JSON-encoded values.
+type RuntimeConfig map[string]json.RawMessage
+
 // IPFSID is used to store information about the underlying IPFS daemon
 type IPFSID struct {
 	ID        peer.ID
@@ -278,6 +877,8 @@ type ID struct {
 	Error                 string
 	IPFS                  IPFSID
 	Peername              string
+	PinningEnabled        bool
+	Health                PeerHealth
 	//PublicKey          crypto.PubKey
 }
 
@@ -293,6 +894,8 @@ type IDSerial struct {
 	Error                 string           `json:"error"`
 	IPFS                  IPFSIDSerial     `json:"ipfs"`
 	Peername              string           `json:"peername"`
+	PinningEnabled        bool             `json:"pinning_enabled"`
+	Health                string           `json:"health"`
 	//PublicKey          []byte
 }
 
@@ -319,6 +922,8 @@ func (id ID) ToSerial() IDSerial {
 		Error:                 id.Error,
 		IPFS:                  id.IPFS.ToSerial(),
 		Peername:              id.Peername,
+		PinningEnabled:        id.PinningEnabled,
+		Health:                string(id.Health),
 		//PublicKey:          pkey,
 	}
 }
@@ -346,102 +951,885 @@ func (ids IDSerial) ToID() ID {
 	id.Error = ids.Error
 	id.IPFS = ids.IPFS.ToIPFSID()
 	id.Peername = ids.Peername
+	id.PinningEnabled = ids.PinningEnabled
+	id.Health = PeerHealth(ids.Health)
 	return id
 }
 
-// MultiaddrSerial is a Multiaddress in a serializable form
-type MultiaddrSerial string
+// PeerHealth describes whether a cluster peer is ready to work.
+type PeerHealth string
 
-// MultiaddrsSerial is an array of Multiaddresses in serializable form
-type MultiaddrsSerial []MultiaddrSerial
+// PeerHealth values
+const (
+	// The peer is waiting for consensus to be ready
+	PeerHealthStarting PeerHealth = "starting"
+	// The peer restarted with a persisted peerset and waits for
+	// enough of those peers to come back to form a quorum
+	PeerHealthWaitingForQuorum PeerHealth = "waiting_for_quorum"
+	// The peer is ready but its IPFS daemon has not been reachable yet
+	PeerHealthWaitingForIPFS PeerHealth = "waiting_for_ipfs"
+	// The peer and its IPFS daemon are ready
+	PeerHealthOK PeerHealth = "ok"
+)
 
-// MultiaddrToSerial converts a Multiaddress to its serializable form
-func MultiaddrToSerial(addr ma.Multiaddr) MultiaddrSerial {
-	if addr != nil {
-		return MultiaddrSerial(addr.String())
+// Health reports the PeerHealth of a cluster peer, along with the error
+// which keeps it from being ready, if any.
+type Health struct {
+	Peer   peer.ID
+	Status PeerHealth
+	Error  string
+}
+
+// HealthSerial is the serializable version of Health.
+type HealthSerial struct {
+	Peer   string `json:"peer"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// ToSerial converts a Health to its serializable version.
+func (h Health) ToSerial() HealthSerial {
+	p := ""
+	if h.Peer != "" {
+		p = peer.IDB58Encode(h.Peer)
+	}
+	return HealthSerial{
+		Peer:   p,
+		Status: string(h.Status),
+		Error:  h.Error,
 	}
-	return ""
 }
 
-// ToMultiaddr converts a serializable Multiaddress to its original type.
-// All errors are ignored.
-func (addrS MultiaddrSerial) ToMultiaddr() ma.Multiaddr {
-	str := string(addrS)
-	a, err := ma.NewMultiaddr(str)
+// ToHealth converts a HealthSerial to its native version.
+func (hs HealthSerial) ToHealth() Health {
+	p, err := peer.IDB58Decode(hs.Peer)
 	if err != nil {
-		logger.Error(str, err)
+		logger.Error(hs.Peer, err)
+	}
+	return Health{
+		Peer:   p,
+		Status: PeerHealth(hs.Status),
+		Error:  hs.Error,
 	}
-	return a
 }
 
-// MultiaddrsToSerial converts a slice of Multiaddresses to its
-// serializable form.
-func MultiaddrsToSerial(addrs []ma.Multiaddr) MultiaddrsSerial {
-	addrsS := make([]MultiaddrSerial, len(addrs), len(addrs))
-	for i, a := range addrs {
-		if a != nil {
-			addrsS[i] = MultiaddrToSerial(a)
-		}
-	}
-	return addrsS
+// PeerLiveness reports whether a cluster peer is alive. LastMetric is the
+// expiration of the last ping metric from the peer received by the
+// monitor of the leader (zero when there is none) and Alive is true while
+// it has not expired. RTT is the time taken by an RPC request to the peer
+// from the peer which was asked, and Error is set when it failed.
+type PeerLiveness struct {
+	Peer       peer.ID
+	Alive      bool
+	LastMetric time.Time
+	RTT        time.Duration
+	Error      string
 }
 
-// ToMultiaddrs converts MultiaddrsSerial back to a slice of Multiaddresses
-func (addrsS MultiaddrsSerial) ToMultiaddrs() []ma.Multiaddr {
-	addrs := make([]ma.Multiaddr, len(addrsS), len(addrsS))
-	for i, addrS := range addrsS {
-		addrs[i] = addrS.ToMultiaddr()
-	}
-	return addrs
+// PeerLivenessSerial is the serializable version of PeerLiveness.
+type PeerLivenessSerial struct {
+	Peer       string `json:"peer"`
+	Alive      bool   `json:"alive"`
+	LastMetric string `json:"last_metric"`
+	RTT        string `json:"rtt"`
+	Error      string `json:"error"`
 }
 
-// PeersToStrings IDB58Encodes a list of peers.
-func PeersToStrings(peers []peer.ID) []string {
-	strs := make([]string, len(peers))
-	for i, p := range peers {
-		if p != "" {
-			strs[i] = peer.IDB58Encode(p)
-		}
+// ToSerial converts a PeerLiveness to its serializable version.
+func (pl PeerLiveness) ToSerial() PeerLivenessSerial {
+	p := ""
+	if pl.Peer != "" {
+		p = peer.IDB58Encode(pl.Peer)
+	}
+	last := ""
+	if !pl.LastMetric.IsZero() {
+		last = pl.LastMetric.UTC().Format(time.RFC3339Nano)
+	}
+	return PeerLivenessSerial{
+		Peer:       p,
+		Alive:      pl.Alive,
+		LastMetric: last,
+		RTT:        pl.RTT.String(),
+		Error:      pl.Error,
 	}
-	return strs
 }
 
-// StringsToPeers decodes peer.IDs from strings.
-func StringsToPeers(strs []string) []peer.ID {
-	peers := make([]peer.ID, len(strs))
-	for i, p := range strs {
-		var err error
-		peers[i], err = peer.IDB58Decode(p)
+// ToPeerLiveness converts a PeerLivenessSerial to its native version.
+func (pls PeerLivenessSerial) ToPeerLiveness() PeerLiveness {
+	p, err := peer.IDB58Decode(pls.Peer)
+	if err != nil {
+		logger.Error(pls.Peer, err)
+	}
+	var last time.Time
+	if pls.LastMetric != "" {
+		last, err = time.Parse(time.RFC3339Nano, pls.LastMetric)
 		if err != nil {
-			logger.Error(p, err)
+			logger.Error(pls.LastMetric, err)
 		}
 	}
-	return peers
+	rtt, err := time.ParseDuration(pls.RTT)
+	if err != nil {
+		logger.Error(pls.RTT, err)
+	}
+	return PeerLiveness{
+		Peer:       p,
+		Alive:      pls.Alive,
+		LastMetric: last,
+		RTT:        rtt,
+		Error:      pls.Error,
+	}
 }
 
-// Pin is an argument that carries a Cid. It may carry more things in the
-// future.
-type Pin struct {
-	Cid               *cid.Cid
-	Name              string
-	Allocations       []peer.ID
-	ReplicationFactor int
+// ConnectGraph describes the connectivity of a cluster as seen by one of
+// its peers (ClusterID). ClusterLinks are the cluster peers that every
+// cluster peer can reach, ClustertoIPFS the IPFS daemon of every cluster
+// peer and IPFSLinks the swarm peers of every IPFS daemon.
+type ConnectGraph struct {
+	ClusterID     peer.ID
+	ClusterLinks  map[peer.ID][]peer.ID
+	IPFSLinks     map[peer.ID][]peer.ID
+	ClustertoIPFS map[peer.ID]peer.ID
 }
 
-// PinCid is a shorcut to create a Pin only with a Cid.
-func PinCid(c *cid.Cid) Pin {
-	return Pin{
-		Cid: c,
-	}
+// ConnectGraphSerial is the serializable version of ConnectGraph.
+type ConnectGraphSerial struct {
+	ClusterID     string              `json:"cluster_id"`
+	ClusterLinks  map[string][]string `json:"cluster_links"`
+	IPFSLinks     map[string][]string `json:"ipfs_links"`
+	ClustertoIPFS map[string]string   `json:"cluster_to_ipfs"`
 }
 
-// PinSerial is a serializable version of Pin
-type PinSerial struct {
-	Cid               string   `json:"cid"`
-	Name              string   `json:"name"`
-	Allocations       []string `json:"allocations"`
-	Everywhere        bool     `json:"everywhere,omitempty"` // legacy
-	ReplicationFactor int      `json:"replication_factor"`
+// ToSerial converts a ConnectGraph to its serializable version.
+func (cg ConnectGraph) ToSerial() ConnectGraphSerial {
+	links := func(m map[peer.ID][]peer.ID) map[string][]string {
+		sm := make(map[string][]string, len(m))
+		for p, peers := range m {
+			strs := make([]string, len(peers), len(peers))
+			for i, pp := range peers {
+				strs[i] = peer.IDB58Encode(pp)
+			}
+			sm[peer.IDB58Encode(p)] = strs
+		}
+		return sm
+	}
+
+	c2i := make(map[string]string, len(cg.ClustertoIPFS))
+	for c, i := range cg.ClustertoIPFS {
+		c2i[peer.IDB58Encode(c)] = peer.IDB58Encode(i)
+	}
+
+	id := ""
+	if cg.ClusterID != "" {
+		id = peer.IDB58Encode(cg.ClusterID)
+	}
+	return ConnectGraphSerial{
+		ClusterID:     id,
+		ClusterLinks:  links(cg.ClusterLinks),
+		IPFSLinks:     links(cg.IPFSLinks),
+		ClustertoIPFS: c2i,
+	}
+}
+
+// ToConnectGraph converts a ConnectGraphSerial to its native version.
+func (cgs ConnectGraphSerial) ToConnectGraph() ConnectGraph {
+	decode := func(s string) peer.ID {
+		p, err := peer.IDB58Decode(s)
+		if err != nil {
+			logger.Error(s, err)
+		}
+		return p
+	}
+	links := func(sm map[string][]string) map[peer.ID][]peer.ID {
+		m := make(map[peer.ID][]peer.ID, len(sm))
+		for s, strs := range sm {
+			peers := make([]peer.ID, len(strs), len(strs))
+			for i, str := range strs {
+				peers[i] = decode(str)
+			}
+			m[decode(s)] = peers
+		}
+		return m
+	}
+
+	c2i := make(map[peer.ID]peer.ID, len(cgs.ClustertoIPFS))
+	for c, i := range cgs.ClustertoIPFS {
+		c2i[decode(c)] = decode(i)
+	}
+
+	var id peer.ID
+	if cgs.ClusterID != "" {
+		id = decode(cgs.ClusterID)
+	}
+	return ConnectGraph{
+		ClusterID:     id,
+		ClusterLinks:  links(cgs.ClusterLinks),
+		IPFSLinks:     links(cgs.IPFSLinks),
+		ClustertoIPFS: c2i,
+	}
+}
+
+// ConsensusStatus describes the internals of the consensus component of a
+// cluster peer. AppliedIndex lagging behind CommitIndex for long means
+// the state machine is stuck. Lag is the number of log entries the peer
+// has not applied yet with respect to the leader. LastSnapshot and
+// LastContact are zero when unknown.
+type ConsensusStatus struct {
+	Peer              peer.ID
+	Leader            peer.ID
+	Voter             bool
+	Term              uint64
+	CommitIndex       uint64
+	AppliedIndex      uint64
+	LastSnapshotIndex uint64
+	LastSnapshot      time.Time
+	LastContact       time.Time
+	Lag               uint64
+	Error             string
+}
+
+// ConsensusStatusSerial is the serializable version of ConsensusStatus.
+type ConsensusStatusSerial struct {
+	Peer              string `json:"peer"`
+	Leader            string `json:"leader"`
+	Voter             bool   `json:"voter"`
+	Term              uint64 `json:"term"`
+	CommitIndex       uint64 `json:"commit_index"`
+	AppliedIndex      uint64 `json:"applied_index"`
+	LastSnapshotIndex uint64 `json:"last_snapshot_index"`
+	LastSnapshot      string `json:"last_snapshot"`
+	LastContact       string `json:"last_contact"`
+	Lag               uint64 `json:"lag"`
+	Error             string `json:"error"`
+}
+
+func timeToSerial(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func timeFromSerial(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		logger.Error(s, err)
+	}
+	return t
+}
+
+// ToSerial converts a ConsensusStatus to its serializable version.
+func (cs ConsensusStatus) ToSerial() ConsensusStatusSerial {
+	p := ""
+	if cs.Peer != "" {
+		p = peer.IDB58Encode(cs.Peer)
+	}
+	l := ""
+	if cs.Leader != "" {
+		l = peer.IDB58Encode(cs.Leader)
+	}
+	return ConsensusStatusSerial{
+		Peer:              p,
+		Leader:            l,
+		Voter:             cs.Voter,
+		Term:              cs.Term,
+		CommitIndex:       cs.CommitIndex,
+		AppliedIndex:      cs.AppliedIndex,
+		LastSnapshotIndex: cs.LastSnapshotIndex,
+		LastSnapshot:      timeToSerial(cs.LastSnapshot),
+		LastContact:       timeToSerial(cs.LastContact),
+		Lag:               cs.Lag,
+		Error:             cs.Error,
+	}
+}
+
+// ToConsensusStatus converts a ConsensusStatusSerial to its native version.
+func (css ConsensusStatusSerial) ToConsensusStatus() ConsensusStatus {
+	p, err := peer.IDB58Decode(css.Peer)
+	if err != nil {
+		logger.Error(css.Peer, err)
+	}
+	var l peer.ID
+	if css.Leader != "" {
+		l, err = peer.IDB58Decode(css.Leader)
+		if err != nil {
+			logger.Error(css.Leader, err)
+		}
+	}
+	return ConsensusStatus{
+		Peer:              p,
+		Leader:            l,
+		Voter:             css.Voter,
+		Term:              css.Term,
+		CommitIndex:       css.CommitIndex,
+		AppliedIndex:      css.AppliedIndex,
+		LastSnapshotIndex: css.LastSnapshotIndex,
+		LastSnapshot:      timeFromSerial(css.LastSnapshot),
+		LastContact:       timeFromSerial(css.LastContact),
+		Lag:               css.Lag,
+		Error:             css.Error,
+	}
+}
+
+// StateChecksum summarizes the shared state of a cluster peer. Pins are
+// split in buckets by the hash of their Cid. The checksum of a bucket only
+// depends on the pins in it, so peers with the same pins have the same
+// checksums. Root is the checksum of all the buckets.
+type StateChecksum struct {
+	Peer    peer.ID
+	Pins    int
+	Root    string
+	Buckets []string
+}
+
+// StateChecksumSerial is the serializable version of StateChecksum.
+type StateChecksumSerial struct {
+	Peer    string   `json:"peer"`
+	Pins    int      `json:"pins"`
+	Root    string   `json:"root"`
+	Buckets []string `json:"buckets"`
+}
+
+// ToSerial converts a StateChecksum to its serializable version.
+func (sc StateChecksum) ToSerial() StateChecksumSerial {
+	p := ""
+	if sc.Peer != "" {
+		p = peer.IDB58Encode(sc.Peer)
+	}
+	buckets := sc.Buckets
+	if buckets == nil {
+		buckets = []string{}
+	}
+	return StateChecksumSerial{
+		Peer:    p,
+		Pins:    sc.Pins,
+		Root:    sc.Root,
+		Buckets: buckets,
+	}
+}
+
+// ToStateChecksum converts a StateChecksumSerial to its native version.
+func (scs StateChecksumSerial) ToStateChecksum() StateChecksum {
+	p, err := peer.IDB58Decode(scs.Peer)
+	if err != nil {
+		logger.Error(scs.Peer, err)
+	}
+	return StateChecksum{
+		Peer:    p,
+		Pins:    scs.Pins,
+		Root:    scs.Root,
+		Buckets: scs.Buckets,
+	}
+}
+
+// StateDiff describes how the shared state of a peer differs from the
+// one of the leader. Missing items are only pinned in the leader's state,
+// Extra items only in the peer's and Different items are pinned in both
+// with different options. Error is set when the peer could not be
+// verified.
+type StateDiff struct {
+	Peer       peer.ID
+	Root       string
+	LeaderRoot string
+	Missing    []*cid.Cid
+	Extra      []*cid.Cid
+	Different  []*cid.Cid
+	Error      string
+}
+
+// StateDiffSerial is the serializable version of StateDiff.
+type StateDiffSerial struct {
+	Peer       string   `json:"peer"`
+	Root       string   `json:"root"`
+	LeaderRoot string   `json:"leader_root"`
+	Missing    []string `json:"missing"`
+	Extra      []string `json:"extra"`
+	Different  []string `json:"different"`
+	Error      string   `json:"error"`
+}
+
+// Diverged returns true when the peer's state differs from the leader's.
+func (sd StateDiff) Diverged() bool {
+	return sd.Error != "" || sd.Root != sd.LeaderRoot
+}
+
+func cidsToStrings(cids []*cid.Cid) []string {
+	strs := make([]string, len(cids), len(cids))
+	for i, c := range cids {
+		strs[i] = c.String()
+	}
+	return strs
+}
+
+func stringsToCids(strs []string) []*cid.Cid {
+	var cids []*cid.Cid
+	for _, s := range strs {
+		c, err := cid.Decode(s)
+		if err != nil {
+			logger.Error(s, err)
+			continue
+		}
+		cids = append(cids, c)
+	}
+	return cids
+}
+
+// ToSerial converts a StateDiff to its serializable version.
+func (sd StateDiff) ToSerial() StateDiffSerial {
+	p := ""
+	if sd.Peer != "" {
+		p = peer.IDB58Encode(sd.Peer)
+	}
+	return StateDiffSerial{
+		Peer:       p,
+		Root:       sd.Root,
+		LeaderRoot: sd.LeaderRoot,
+		Missing:    cidsToStrings(sd.Missing),
+		Extra:      cidsToStrings(sd.Extra),
+		Different:  cidsToStrings(sd.Different),
+		Error:      sd.Error,
+	}
+}
+
+// ToStateDiff converts a StateDiffSerial to its native version.
+func (sds StateDiffSerial) ToStateDiff() StateDiff {
+	p, err := peer.IDB58Decode(sds.Peer)
+	if err != nil {
+		logger.Error(sds.Peer, err)
+	}
+	return StateDiff{
+		Peer:       p,
+		Root:       sds.Root,
+		LeaderRoot: sds.LeaderRoot,
+		Missing:    stringsToCids(sds.Missing),
+		Extra:      stringsToCids(sds.Extra),
+		Different:  stringsToCids(sds.Different),
+		Error:      sds.Error,
+	}
+}
+
+// PinLogOp is the kind of mutation recorded in a PinLogEntry.
+type PinLogOp string
+
+// PinLogOp values
+const (
+	PinLogPin   PinLogOp = "pin"
+	PinLogUnpin PinLogOp = "unpin"
+)
+
+// PinLogEntry is a pin or unpin operation which was committed to the
+// shared state, as recorded by a peer when applying it. Seq numbers are
+// given by the consensus component and increase in the order in which
+// operations are applied. Operations applied together share one.
+type PinLogEntry struct {
+	Seq uint64
+	Op  PinLogOp
+	Pin Pin
+	TS  time.Time
+}
+
+// PinLogEntrySerial is the serializable version of PinLogEntry.
+type PinLogEntrySerial struct {
+	Seq uint64    `json:"seq"`
+	Op  PinLogOp  `json:"op"`
+	Pin PinSerial `json:"pin"`
+	TS  string    `json:"timestamp"`
+}
+
+// ToSerial converts a PinLogEntry to its serializable version.
+func (ple PinLogEntry) ToSerial() PinLogEntrySerial {
+	return PinLogEntrySerial{
+		Seq: ple.Seq,
+		Op:  ple.Op,
+		Pin: ple.Pin.ToSerial(),
+		TS:  timeToSerial(ple.TS),
+	}
+}
+
+// ToPinLogEntry converts a PinLogEntrySerial to its native version.
+func (ples PinLogEntrySerial) ToPinLogEntry() PinLogEntry {
+	return PinLogEntry{
+		Seq: ples.Seq,
+		Op:  ples.Op,
+		Pin: ples.Pin.ToPin(),
+		TS:  timeFromSerial(ples.TS),
+	}
+}
+
+// SyncInfo describes one of the periodic sync loops of a cluster peer
+// and the outcome of its last run. Last is zero when the loop has not
+// run yet. OutOfSync is the number of items which were found out of
+// sync (or in error) during that run.
+type SyncInfo struct {
+	Enabled   bool
+	Interval  time.Duration
+	Jitter    time.Duration
+	Last      time.Time
+	OutOfSync int
+	Error     string
+}
+
+// SyncInfoSerial is the serializable version of SyncInfo.
+type SyncInfoSerial struct {
+	Enabled   bool   `json:"enabled"`
+	Interval  string `json:"interval"`
+	Jitter    string `json:"jitter"`
+	Last      string `json:"last"`
+	OutOfSync int    `json:"out_of_sync"`
+	Error     string `json:"error"`
+}
+
+// ToSerial converts a SyncInfo to its serializable version.
+func (si SyncInfo) ToSerial() SyncInfoSerial {
+	last := ""
+	if !si.Last.IsZero() {
+		last = si.Last.UTC().Format(time.RFC3339)
+	}
+	return SyncInfoSerial{
+		Enabled:   si.Enabled,
+		Interval:  si.Interval.String(),
+		Jitter:    si.Jitter.String(),
+		Last:      last,
+		OutOfSync: si.OutOfSync,
+		Error:     si.Error,
+	}
+}
+
+// ToSyncInfo converts a SyncInfoSerial to its native version.
+func (sis SyncInfoSerial) ToSyncInfo() SyncInfo {
+	interval, err := time.ParseDuration(sis.Interval)
+	if err != nil {
+		logger.Error(sis.Interval, err)
+	}
+	jitter, err := time.ParseDuration(sis.Jitter)
+	if err != nil {
+		logger.Error(sis.Jitter, err)
+	}
+	var last time.Time
+	if sis.Last != "" {
+		last, err = time.Parse(time.RFC3339, sis.Last)
+		if err != nil {
+			logger.Error(sis.Last, err)
+		}
+	}
+	return SyncInfo{
+		Enabled:   sis.Enabled,
+		Interval:  interval,
+		Jitter:    jitter,
+		Last:      last,
+		OutOfSync: sis.OutOfSync,
+		Error:     sis.Error,
+	}
+}
+
+// SyncStatus reports the state of the periodic sync loops of a cluster
+// peer: State syncs the shared state to the tracker and IPFS syncs the
+// tracker to the IPFS daemon.
+type SyncStatus struct {
+	Peer  peer.ID
+	State SyncInfo
+	IPFS  SyncInfo
+}
+
+// SyncStatusSerial is the serializable version of SyncStatus.
+type SyncStatusSerial struct {
+	Peer  string         `json:"peer"`
+	State SyncInfoSerial `json:"state"`
+	IPFS  SyncInfoSerial `json:"ipfs"`
+}
+
+// ToSerial converts a SyncStatus to its serializable version.
+func (ss SyncStatus) ToSerial() SyncStatusSerial {
+	p := ""
+	if ss.Peer != "" {
+		p = peer.IDB58Encode(ss.Peer)
+	}
+	return SyncStatusSerial{
+		Peer:  p,
+		State: ss.State.ToSerial(),
+		IPFS:  ss.IPFS.ToSerial(),
+	}
+}
+
+// ToSyncStatus converts a SyncStatusSerial to its native version.
+func (sss SyncStatusSerial) ToSyncStatus() SyncStatus {
+	p, err := peer.IDB58Decode(sss.Peer)
+	if err != nil {
+		logger.Error(sss.Peer, err)
+	}
+	return SyncStatus{
+		Peer:  p,
+		State: sss.State.ToSyncInfo(),
+		IPFS:  sss.IPFS.ToSyncInfo(),
+	}
+}
+
+// TrackerMetrics reports the internals of the PinTracker of a peer: the
+// operations waiting in its queues or running against IPFS, the items in
+// error state, the automatic retries and how long pins take.
+type TrackerMetrics struct {
+	Peer            peer.ID
+	PinQueue        int
+	UnpinQueue      int
+	BackgroundQueue int
+	InFlight        int
+	PinErrors       int
+	UnpinErrors     int
+	// Retries counts the automatic retries scheduled since the peer
+	// started.
+	Retries int
+	// Pins counts the successful pins since the peer started, which
+	// took AvgPinLatency on average.
+	Pins          int
+	AvgPinLatency time.Duration
+}
+
+// TrackerMetricsSerial is the serializable version of TrackerMetrics.
+type TrackerMetricsSerial struct {
+	Peer            string `json:"peer"`
+	PinQueue        int    `json:"pin_queue"`
+	UnpinQueue      int    `json:"unpin_queue"`
+	BackgroundQueue int    `json:"background_queue"`
+	InFlight        int    `json:"in_flight"`
+	PinErrors       int    `json:"pin_errors"`
+	UnpinErrors     int    `json:"unpin_errors"`
+	Retries         int    `json:"retries"`
+	Pins            int    `json:"pins"`
+	AvgPinLatency   string `json:"avg_pin_latency"`
+}
+
+// ToSerial converts a TrackerMetrics to its serializable version.
+func (tm TrackerMetrics) ToSerial() TrackerMetricsSerial {
+	p := ""
+	if tm.Peer != "" {
+		p = peer.IDB58Encode(tm.Peer)
+	}
+	return TrackerMetricsSerial{
+		Peer:            p,
+		PinQueue:        tm.PinQueue,
+		UnpinQueue:      tm.UnpinQueue,
+		BackgroundQueue: tm.BackgroundQueue,
+		InFlight:        tm.InFlight,
+		PinErrors:       tm.PinErrors,
+		UnpinErrors:     tm.UnpinErrors,
+		Retries:         tm.Retries,
+		Pins:            tm.Pins,
+		AvgPinLatency:   tm.AvgPinLatency.String(),
+	}
+}
+
+// ToTrackerMetrics converts a TrackerMetricsSerial to its native version.
+func (tms TrackerMetricsSerial) ToTrackerMetrics() TrackerMetrics {
+	p, err := peer.IDB58Decode(tms.Peer)
+	if err != nil {
+		logger.Error(tms.Peer, err)
+	}
+	latency, err := time.ParseDuration(tms.AvgPinLatency)
+	if err != nil {
+		logger.Error(tms.AvgPinLatency, err)
+	}
+	return TrackerMetrics{
+		Peer:            p,
+		PinQueue:        tms.PinQueue,
+		UnpinQueue:      tms.UnpinQueue,
+		BackgroundQueue: tms.BackgroundQueue,
+		InFlight:        tms.InFlight,
+		PinErrors:       tms.PinErrors,
+		UnpinErrors:     tms.UnpinErrors,
+		Retries:         tms.Retries,
+		Pins:            tms.Pins,
+		AvgPinLatency:   latency,
+	}
+}
+
+// ResolvedMultihash holds the Cid chosen for content which was referenced
+// only by its multihash. Available is false when the content could not be
+// found with any codec and the Cid uses the default one (dag-pb).
+type ResolvedMultihash struct {
+	Multihash string `json:"multihash"`
+	Cid       string `json:"cid"`
+	Available bool   `json:"available"`
+}
+
+// PublicStatus holds aggregate figures about a cluster which can be shown
+// to anyone, as they do not reveal which peers or pins are part of it.
+type PublicStatus struct {
+	Peers        int        `json:"peers"`
+	HealthyPeers int        `json:"healthy_peers"`
+	Pins         int        `json:"pins"`
+	TotalSize    uint64     `json:"total_size"` // sum of the peers' repo sizes
+	Health       PeerHealth `json:"health"`     // of the contacted peer
+}
+
+// MultiaddrSerial is a Multiaddress in a serializable form
+type MultiaddrSerial string
+
+// MultiaddrsSerial is an array of Multiaddresses in serializable form
+type MultiaddrsSerial []MultiaddrSerial
+
+// MultiaddrToSerial converts a Multiaddress to its serializable form
+func MultiaddrToSerial(addr ma.Multiaddr) MultiaddrSerial {
+	if addr != nil {
+		return MultiaddrSerial(addr.String())
+	}
+	return ""
+}
+
+// ToMultiaddr converts a serializable Multiaddress to its original type.
+// All errors are ignored.
+func (addrS MultiaddrSerial) ToMultiaddr() ma.Multiaddr {
+	str := string(addrS)
+	a, err := ma.NewMultiaddr(str)
+	if err != nil {
+		logger.Error(str, err)
+	}
+	return a
+}
+
+// MultiaddrsToSerial converts a slice of Multiaddresses to its
+// serializable form.
+func MultiaddrsToSerial(addrs []ma.Multiaddr) MultiaddrsSerial {
+	addrsS := make([]MultiaddrSerial, len(addrs), len(addrs))
+	for i, a := range addrs {
+		if a != nil {
+			addrsS[i] = MultiaddrToSerial(a)
+		}
+	}
+	return addrsS
+}
+
+// ToMultiaddrs converts MultiaddrsSerial back to a slice of Multiaddresses
+func (addrsS MultiaddrsSerial) ToMultiaddrs() []ma.Multiaddr {
+	addrs := make([]ma.Multiaddr, len(addrsS), len(addrsS))
+	for i, addrS := range addrsS {
+		addrs[i] = addrS.ToMultiaddr()
+	}
+	return addrs
+}
+
+// PeersToStrings IDB58Encodes a list of peers.
+func PeersToStrings(peers []peer.ID) []string {
+	strs := make([]string, len(peers))
+	for i, p := range peers {
+		if p != "" {
+			strs[i] = peer.IDB58Encode(p)
+		}
+	}
+	return strs
+}
+
+// StringsToPeers decodes peer.IDs from strings.
+func StringsToPeers(strs []string) []peer.ID {
+	peers := make([]peer.ID, len(strs))
+	for i, p := range strs {
+		var err error
+		peers[i], err = peer.IDB58Decode(p)
+		if err != nil {
+			logger.Error(p, err)
+		}
+	}
+	return peers
+}
+
+// Pin is an argument that carries a Cid. It may carry more things in the
+// future.
+type Pin struct {
+	Cid               *cid.Cid
+	Type              PinType
+	Name              string
+	Allocations       []peer.ID
+	ReplicationFactor int
+	// Aliases are other Cids for the same content (i.e. its CIDv1 when
+	// Cid is a CIDv0) which have been merged into this pin.
+	Aliases []*cid.Cid
+	// Inline holds the raw block for Cid when the content is small
+	// enough to be stored in the shared state.
+	Inline []byte
+	// Shards are the roots of the shards of a MetaType pin.
+	Shards []*cid.Cid
+	// Origin is the REST API address of the followed cluster from
+	// which this pin was mirrored. It is empty for local pins.
+	Origin string
+	// Namespace is the namespace the pin belongs to. It is empty for
+	// the default namespace.
+	Namespace string
+	// Size is the cumulative size of the DAG, when it was known at the
+	// time of pinning. It is 0 otherwise.
+	Size uint64
+	// Path is the IPFS or IPNS path which was resolved to Cid when the
+	// item was pinned by path. It is empty otherwise.
+	Path string
+	// RequestID identifies the API request which pinned or unpinned the
+	// item, so that the log lines of the peers which track it can be
+	// correlated with it. It is not kept in the shared state.
+	RequestID string
+}
+
+// PinType specifies which sort of Pin object we are dealing with.
+// Regular pins are of DataType. A MetaType pin represents a sharded
+// dataset: it is not pinned in IPFS, but each of its Shards is pinned as
+// an independent ShardType pin.
+type PinType int
+
+// PinType values
+const (
+	DataType PinType = iota
+	MetaType
+	ShardType
+)
+
+// String returns a human-readable value for PinType.
+func (pt PinType) String() string {
+	switch pt {
+	case MetaType:
+		return "meta"
+	case ShardType:
+		return "shard"
+	default:
+		return "data"
+	}
+}
+
+// PinTypeFromString parses a string and returns the matching PinType.
+// Empty strings are parsed as DataType.
+func PinTypeFromString(str string) (PinType, error) {
+	switch str {
+	case "", "data":
+		return DataType, nil
+	case "meta":
+		return MetaType, nil
+	case "shard":
+		return ShardType, nil
+	default:
+		return DataType, fmt.Errorf("unknown pin type: %s", str)
+	}
+}
+
+// PinCid is a shorcut to create a Pin only with a Cid.
+func PinCid(c *cid.Cid) Pin {
+	return Pin{
+		Cid: c,
+	}
+}
+
+// PinSerial is a serializable version of Pin
+type PinSerial struct {
+	Cid               string   `json:"cid"`
+	Name              string   `json:"name"`
+	Allocations       []string `json:"allocations"`
+	Everywhere        bool     `json:"everywhere"` // legacy
+	ReplicationFactor int      `json:"replication_factor"`
+	Aliases           []string `json:"aliases"`
+	Inline            []byte   `json:"inline"`
+	Type              string   `json:"type"`
+	Shards            []string `json:"shards"`
+	Origin            string   `json:"origin"`
+	Namespace         string   `json:"namespace"`
+	Size              uint64   `json:"size"`
+	Path              string   `json:"path"`
+	RequestID         string   `json:"request_id"`
 }
 
 // ToSerial converts a Pin to PinSerial.
@@ -455,11 +1843,33 @@ func (pin Pin) ToSerial() PinSerial {
 	allocs := PeersToStrings(pin.Allocations)
 	rpl := pin.ReplicationFactor
 
+	aliases := cidsToStrings(pin.Aliases)
+	shards := cidsToStrings(pin.Shards)
+
+	inline := pin.Inline
+	if inline == nil {
+		inline = []byte{}
+	}
+
+	typ := ""
+	if pin.Type != DataType {
+		typ = pin.Type.String()
+	}
+
 	return PinSerial{
 		Cid:               c,
 		Name:              n,
 		Allocations:       allocs,
 		ReplicationFactor: rpl,
+		Aliases:           aliases,
+		Inline:            inline,
+		Type:              typ,
+		Shards:            shards,
+		Origin:            pin.Origin,
+		Namespace:         pin.Namespace,
+		Size:              pin.Size,
+		Path:              pin.Path,
+		RequestID:         pin.RequestID,
 	}
 }
 
@@ -475,11 +1885,780 @@ func (pins PinSerial) ToPin() Pin {
 		pins.ReplicationFactor = -1
 	}
 
+	var aliases []*cid.Cid
+	for _, a := range pins.Aliases {
+		ac, err := cid.Decode(a)
+		if err != nil {
+			logger.Error(a, err)
+			continue
+		}
+		aliases = append(aliases, ac)
+	}
+
+	var shards []*cid.Cid
+	for _, sh := range pins.Shards {
+		shc, err := cid.Decode(sh)
+		if err != nil {
+			logger.Error(sh, err)
+			continue
+		}
+		shards = append(shards, shc)
+	}
+
+	// an empty inline field means there is no inline content
+	var inline []byte
+	if len(pins.Inline) > 0 {
+		inline = pins.Inline
+	}
+
+	typ, err := PinTypeFromString(pins.Type)
+	if err != nil {
+		logger.Error(err)
+	}
+
 	return Pin{
 		Cid:               c,
+		Type:              typ,
 		Name:              pins.Name,
 		Allocations:       StringsToPeers(pins.Allocations),
 		ReplicationFactor: pins.ReplicationFactor,
+		Aliases:           aliases,
+		Inline:            inline,
+		Shards:            shards,
+		Origin:            pins.Origin,
+		Namespace:         pins.Namespace,
+		Size:              pins.Size,
+		Path:              pins.Path,
+		RequestID:         pins.RequestID,
+	}
+}
+
+// Equals returns true when both pins are the same: they have the same
+// Cid, allocations (in any order), replication factor and metadata. The
+// requests which created them do not matter.
+func (pin Pin) Equals(other Pin) bool {
+	a := pin.ToSerial()
+	b := other.ToSerial()
+	a.RequestID = ""
+	b.RequestID = ""
+	sort.Strings(a.Allocations)
+	sort.Strings(b.Allocations)
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aj, bj)
+}
+
+// ShardPins returns the ShardType pins for the Shards of a MetaType pin.
+// They share the name, replication factor and allocations of the parent.
+func (pin Pin) ShardPins() []Pin {
+	shards := make([]Pin, len(pin.Shards), len(pin.Shards))
+	for i, sh := range pin.Shards {
+		shards[i] = Pin{
+			Cid:               sh,
+			Type:              ShardType,
+			Name:              pin.Name,
+			Allocations:       pin.Allocations,
+			ReplicationFactor: pin.ReplicationFactor,
+		}
+	}
+	return shards
+}
+
+// LogName returns the Cid of the pin followed by the RequestID, when it
+// is set, to identify the pin in log lines.
+func (pin Pin) LogName() string {
+	if pin.RequestID == "" {
+		return pin.Cid.String()
+	}
+	return fmt.Sprintf("%s (request %s)", pin.Cid, pin.RequestID)
+}
+
+// HasAlias returns true if the given Cid is one of the aliases of the pin.
+func (pin Pin) HasAlias(c *cid.Cid) bool {
+	for _, a := range pin.Aliases {
+		if a.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// BatchItem is an item of a batch of pins and unpins: the pin to be
+// committed to the shared state or, when Unpin is set, to be removed from
+// it.
+type BatchItem struct {
+	Pin   Pin
+	Unpin bool
+}
+
+// BatchItemSerial is the serializable version of BatchItem. The fields
+// of the pin are inlined.
+type BatchItemSerial struct {
+	PinSerial
+	Unpin bool `json:"unpin"`
+}
+
+// ToSerial converts a BatchItem to its serializable version.
+func (bi BatchItem) ToSerial() BatchItemSerial {
+	return BatchItemSerial{
+		PinSerial: bi.Pin.ToSerial(),
+		Unpin:     bi.Unpin,
+	}
+}
+
+// ToBatchItem converts a BatchItemSerial to its native version.
+func (bis BatchItemSerial) ToBatchItem() BatchItem {
+	return BatchItem{
+		Pin:   bis.PinSerial.ToPin(),
+		Unpin: bis.Unpin,
+	}
+}
+
+// BatchResult is the outcome of an item of a batch of pins and unpins.
+// Error is empty when the item was committed to the shared state.
+type BatchResult struct {
+	Cid   string `json:"cid"`
+	Unpin bool   `json:"unpin"`
+	Error string `json:"error"`
+}
+
+// DuplicatePins groups the pins in the shared state which reference the
+// same content under different Cids, like the CIDv0 and CIDv1 of an item.
+// Multihash is the base58-encoded multihash shared by all of them.
+type DuplicatePins struct {
+	Multihash string
+	Pins      []Pin
+}
+
+// DuplicatePinsSerial is the serializable version of DuplicatePins.
+type DuplicatePinsSerial struct {
+	Multihash string      `json:"multihash"`
+	Pins      []PinSerial `json:"pins"`
+}
+
+// ToSerial converts a DuplicatePins to its serializable version.
+func (dp DuplicatePins) ToSerial() DuplicatePinsSerial {
+	pins := make([]PinSerial, len(dp.Pins), len(dp.Pins))
+	for i, p := range dp.Pins {
+		pins[i] = p.ToSerial()
+	}
+	return DuplicatePinsSerial{
+		Multihash: dp.Multihash,
+		Pins:      pins,
+	}
+}
+
+// ToDuplicatePins converts a DuplicatePinsSerial to its native version.
+func (dps DuplicatePinsSerial) ToDuplicatePins() DuplicatePins {
+	pins := make([]Pin, len(dps.Pins), len(dps.Pins))
+	for i, p := range dps.Pins {
+		pins[i] = p.ToPin()
+	}
+	return DuplicatePins{
+		Multihash: dps.Multihash,
+		Pins:      pins,
+	}
+}
+
+// StateStats summarizes the pins in the shared state. Pins counts them by
+// replication factor and by name prefix (the part of the name before the
+// first delimiter, or the whole name). Replicas counts the allocations of
+// every peer. Pins allocated everywhere have no allocations, so they are
+// only counted in Everywhere.
+type StateStats struct {
+	Pins                int
+	Everywhere          int
+	Replicas            int
+	ByReplicationFactor map[int]int
+	ByNamePrefix        map[string]int
+	ByPeer              map[peer.ID]int
+}
+
+// StateStatsSerial is the serializable version of StateStats.
+type StateStatsSerial struct {
+	Pins                int            `json:"pins"`
+	Everywhere          int            `json:"everywhere"`
+	Replicas            int            `json:"replicas"`
+	ByReplicationFactor map[int]int    `json:"by_replication_factor"`
+	ByNamePrefix        map[string]int `json:"by_name_prefix"`
+	ByPeer              map[string]int `json:"by_peer"`
+}
+
+// ToSerial converts a StateStats to its serializable version.
+func (ss StateStats) ToSerial() StateStatsSerial {
+	byPeer := make(map[string]int)
+	for p, n := range ss.ByPeer {
+		byPeer[peer.IDB58Encode(p)] = n
+	}
+	return StateStatsSerial{
+		Pins:                ss.Pins,
+		Everywhere:          ss.Everywhere,
+		Replicas:            ss.Replicas,
+		ByReplicationFactor: ss.ByReplicationFactor,
+		ByNamePrefix:        ss.ByNamePrefix,
+		ByPeer:              byPeer,
+	}
+}
+
+// ToStateStats converts a StateStatsSerial to its native version.
+func (sss StateStatsSerial) ToStateStats() StateStats {
+	byPeer := make(map[peer.ID]int)
+	for p, n := range sss.ByPeer {
+		pid, err := peer.IDB58Decode(p)
+		if err != nil {
+			logger.Error(p, err)
+			continue
+		}
+		byPeer[pid] = n
+	}
+	return StateStats{
+		Pins:                sss.Pins,
+		Everywhere:          sss.Everywhere,
+		Replicas:            sss.Replicas,
+		ByReplicationFactor: sss.ByReplicationFactor,
+		ByNamePrefix:        sss.ByNamePrefix,
+		ByPeer:              byPeer,
+	}
+}
+
+// PinSummary counts the status of the tracked items. Pins is the number of
+// items. ByStatus counts the status reported by every peer for every item.
+// ByPeer counts, for every peer, the items it has pinned, is pinning or
+// has failed to pin or unpin.
+type PinSummary struct {
+	Pins     int
+	ByStatus map[TrackerStatus]int
+	ByPeer   map[peer.ID]PeerPinSummary
+}
+
+// PeerPinSummary counts the items pinned, being pinned and in error in a
+// peer.
+type PeerPinSummary struct {
+	Pinned  int `json:"pinned"`
+	Pinning int `json:"pinning"`
+	Error   int `json:"error"`
+}
+
+// PinSummarySerial is the serializable version of PinSummary.
+type PinSummarySerial struct {
+	Pins     int                       `json:"pins"`
+	ByStatus map[string]int            `json:"by_status"`
+	ByPeer   map[string]PeerPinSummary `json:"by_peer"`
+}
+
+// ToSerial converts a PinSummary to its serializable version.
+func (ps PinSummary) ToSerial() PinSummarySerial {
+	byStatus := make(map[string]int)
+	for st, n := range ps.ByStatus {
+		byStatus[st.String()] = n
+	}
+	byPeer := make(map[string]PeerPinSummary)
+	for p, pps := range ps.ByPeer {
+		byPeer[peer.IDB58Encode(p)] = pps
+	}
+	return PinSummarySerial{
+		Pins:     ps.Pins,
+		ByStatus: byStatus,
+		ByPeer:   byPeer,
+	}
+}
+
+// ToPinSummary converts a PinSummarySerial to its native version.
+func (pss PinSummarySerial) ToPinSummary() PinSummary {
+	byStatus := make(map[TrackerStatus]int)
+	for st, n := range pss.ByStatus {
+		byStatus[TrackerStatusFromString(st)] = n
+	}
+	byPeer := make(map[peer.ID]PeerPinSummary)
+	for p, pps := range pss.ByPeer {
+		pid, err := peer.IDB58Decode(p)
+		if err != nil {
+			logger.Error(p, err)
+			continue
+		}
+		byPeer[pid] = pps
+	}
+	return PinSummary{
+		Pins:     pss.Pins,
+		ByStatus: byStatus,
+		ByPeer:   byPeer,
+	}
+}
+
+// AllocationPreviewSerial carries the arguments for a dry-run allocation
+// request: the Cid to allocate and the range of acceptable replication
+// factors.
+type AllocationPreviewSerial struct {
+	Cid                  string `json:"cid"`
+	ReplicationFactorMin int    `json:"replication_factor_min"`
+	ReplicationFactorMax int    `json:"replication_factor_max"`
+}
+
+// ToPin returns a Pin carrying the Cid in the AllocationPreviewSerial.
+func (aps AllocationPreviewSerial) ToPin() Pin {
+	return PinSerial{Cid: aps.Cid}.ToPin()
+}
+
+// PeerMaintenance represents the maintenance mode flag for a peer. Peers
+// in maintenance mode do not receive new allocations, but their
+// existing allocations are kept.
+type PeerMaintenance struct {
+	Peer    peer.ID
+	Enabled bool
+}
+
+// PeerMaintenanceSerial is the serializable version of PeerMaintenance.
+type PeerMaintenanceSerial struct {
+	Peer    string `json:"peer"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ToSerial converts a PeerMaintenance to its serializable version.
+func (pm PeerMaintenance) ToSerial() PeerMaintenanceSerial {
+	return PeerMaintenanceSerial{
+		Peer:    peer.IDB58Encode(pm.Peer),
+		Enabled: pm.Enabled,
+	}
+}
+
+// ToPeerMaintenance converts a PeerMaintenanceSerial to its native form.
+func (pms PeerMaintenanceSerial) ToPeerMaintenance() PeerMaintenance {
+	p, err := peer.IDB58Decode(pms.Peer)
+	if err != nil {
+		logger.Error(pms.Peer, err)
+	}
+	return PeerMaintenance{
+		Peer:    p,
+		Enabled: pms.Enabled,
+	}
+}
+
+// Phases of a peer removal
+const (
+	PeerRemovalRemoving      = "removing"
+	PeerRemovalWaitingQuorum = "waiting_for_quorum"
+	PeerRemovalReallocating  = "reallocating"
+	PeerRemovalDone          = "done"
+	PeerRemovalError         = "error"
+)
+
+// PeerRemoval describes the progress of the removal of a peer: it is
+// removed from the consensus peerset, the rest wait for a quorum with
+// the new configuration and the content allocated to it is re-allocated.
+type PeerRemoval struct {
+	Peer        peer.ID
+	Phase       string
+	Total       int // pins allocated to the peer
+	Reallocated int
+	Failed      int
+	Error       string
+	Start       time.Time
+	End         time.Time
+}
+
+// PeerRemovalSerial is the serializable version of PeerRemoval.
+type PeerRemovalSerial struct {
+	Peer        string `json:"peer"`
+	Phase       string `json:"phase"`
+	Total       int    `json:"total"`
+	Reallocated int    `json:"reallocated"`
+	Failed      int    `json:"failed"`
+	Error       string `json:"error"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+}
+
+// ToSerial converts a PeerRemoval to its serializable version.
+func (pr PeerRemoval) ToSerial() PeerRemovalSerial {
+	end := ""
+	if !pr.End.IsZero() {
+		end = pr.End.UTC().Format(time.RFC3339Nano)
+	}
+	return PeerRemovalSerial{
+		Peer:        peer.IDB58Encode(pr.Peer),
+		Phase:       pr.Phase,
+		Total:       pr.Total,
+		Reallocated: pr.Reallocated,
+		Failed:      pr.Failed,
+		Error:       pr.Error,
+		Start:       pr.Start.UTC().Format(time.RFC3339Nano),
+		End:         end,
+	}
+}
+
+// ToPeerRemoval converts a PeerRemovalSerial to its native form.
+func (prs PeerRemovalSerial) ToPeerRemoval() PeerRemoval {
+	p, err := peer.IDB58Decode(prs.Peer)
+	if err != nil {
+		logger.Error(prs.Peer, err)
+	}
+	start, err := time.Parse(time.RFC3339Nano, prs.Start)
+	if err != nil {
+		logger.Error(prs.Start, err)
+	}
+	var end time.Time
+	if prs.End != "" {
+		end, err = time.Parse(time.RFC3339Nano, prs.End)
+		if err != nil {
+			logger.Error(prs.End, err)
+		}
+	}
+	return PeerRemoval{
+		Peer:        p,
+		Phase:       prs.Phase,
+		Total:       prs.Total,
+		Reallocated: prs.Reallocated,
+		Failed:      prs.Failed,
+		Error:       prs.Error,
+		Start:       start,
+		End:         end,
+	}
+}
+
+// RPCCallSerial carries the arguments for a raw RPC request to a given
+// peer. Args is the JSON representation of the argument expected by the
+// method.
+type RPCCallSerial struct {
+	Peer    string          `json:"peer"`
+	Service string          `json:"service"`
+	Method  string          `json:"method"`
+	Args    json.RawMessage `json:"args"`
+}
+
+// AllocationRecord stores an allocation decision made by a cluster peer:
+// which peers were chosen for a Cid, based on which metrics, and why.
+type AllocationRecord struct {
+	Cid         *cid.Cid
+	Size        uint64  // cumulative size of the Cid, 0 when unknown
+	Peer        peer.ID // the peer which made the decision
+	Allocations []peer.ID
+	MetricName  string
+	Metrics     map[peer.ID]string
+	Considered  []peer.ID          // peers with metrics for this decision
+	Vetoes      map[peer.ID]string // why considered peers were excluded
+	Reason      string
+	TS          time.Time
+	Error       string
+}
+
+// AllocationRecordSerial is the serializable version of AllocationRecord.
+type AllocationRecordSerial struct {
+	Cid         string            `json:"cid"`
+	Size        uint64            `json:"size,omitempty"`
+	Peer        string            `json:"peer"`
+	Allocations []string          `json:"allocations"`
+	MetricName  string            `json:"metric_name"`
+	Metrics     map[string]string `json:"metrics"`
+	Considered  []string          `json:"considered"`
+	Vetoes      map[string]string `json:"vetoes"`
+	Reason      string            `json:"reason"`
+	TS          string            `json:"timestamp"`
+	Error       string            `json:"error"`
+}
+
+// ToSerial converts an AllocationRecord to its serializable version.
+func (ar AllocationRecord) ToSerial() AllocationRecordSerial {
+	c := ""
+	if ar.Cid != nil {
+		c = ar.Cid.String()
+	}
+	p := ""
+	if ar.Peer != "" {
+		p = peer.IDB58Encode(ar.Peer)
+	}
+	metrics := make(map[string]string)
+	for k, v := range ar.Metrics {
+		metrics[peer.IDB58Encode(k)] = v
+	}
+	vetoes := make(map[string]string)
+	for k, v := range ar.Vetoes {
+		vetoes[peer.IDB58Encode(k)] = v
+	}
+
+	return AllocationRecordSerial{
+		Cid:         c,
+		Size:        ar.Size,
+		Peer:        p,
+		Allocations: PeersToStrings(ar.Allocations),
+		MetricName:  ar.MetricName,
+		Metrics:     metrics,
+		Considered:  PeersToStrings(ar.Considered),
+		Vetoes:      vetoes,
+		Reason:      ar.Reason,
+		TS:          ar.TS.UTC().Format(time.RFC3339Nano),
+		Error:       ar.Error,
+	}
+}
+
+// ToAllocationRecord converts an AllocationRecordSerial to its native
+// version.
+func (ars AllocationRecordSerial) ToAllocationRecord() AllocationRecord {
+	c, err := cid.Decode(ars.Cid)
+	if err != nil {
+		logger.Error(ars.Cid, err)
+	}
+	p, err := peer.IDB58Decode(ars.Peer)
+	if err != nil {
+		logger.Error(ars.Peer, err)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, ars.TS)
+	if err != nil {
+		logger.Error(ars.TS, err)
+	}
+	metrics := make(map[peer.ID]string)
+	for k, v := range ars.Metrics {
+		pid, err := peer.IDB58Decode(k)
+		if err != nil {
+			logger.Error(k, err)
+			continue
+		}
+		metrics[pid] = v
+	}
+	vetoes := make(map[peer.ID]string)
+	for k, v := range ars.Vetoes {
+		pid, err := peer.IDB58Decode(k)
+		if err != nil {
+			logger.Error(k, err)
+			continue
+		}
+		vetoes[pid] = v
+	}
+
+	return AllocationRecord{
+		Cid:         c,
+		Size:        ars.Size,
+		Peer:        p,
+		Allocations: StringsToPeers(ars.Allocations),
+		MetricName:  ars.MetricName,
+		Metrics:     metrics,
+		Considered:  StringsToPeers(ars.Considered),
+		Vetoes:      vetoes,
+		Reason:      ars.Reason,
+		TS:          ts,
+		Error:       ars.Error,
+	}
+}
+
+// PeerLoad is the number of pins allocated to a peer in the shared state
+// (Current) and the number of pins which would be added to it (Added).
+type PeerLoad struct {
+	Peer    peer.ID
+	Current int
+	Added   int
+}
+
+// PeerLoadSerial is the serializable version of PeerLoad.
+type PeerLoadSerial struct {
+	Peer    string `json:"peer"`
+	Current int    `json:"current"`
+	Added   int    `json:"added"`
+}
+
+// ToSerial converts a PeerLoad to its serializable version.
+func (pl PeerLoad) ToSerial() PeerLoadSerial {
+	return PeerLoadSerial{
+		Peer:    peer.IDB58Encode(pl.Peer),
+		Current: pl.Current,
+		Added:   pl.Added,
+	}
+}
+
+// ToPeerLoad converts a PeerLoadSerial to its native version.
+func (pls PeerLoadSerial) ToPeerLoad() PeerLoad {
+	p, err := peer.IDB58Decode(pls.Peer)
+	if err != nil {
+		logger.Error(pls.Peer, err)
+	}
+	return PeerLoad{
+		Peer:    p,
+		Current: pls.Current,
+		Added:   pls.Added,
+	}
+}
+
+// AllocationSimulation is the result of allocating a batch of pins without
+// committing them: the allocation decided for each pin and the projected
+// load on every peer. Failed counts the pins which could not be allocated.
+type AllocationSimulation struct {
+	Records []AllocationRecord
+	Load    []PeerLoad
+	Failed  int
+}
+
+// AllocationSimulationSerial is the serializable version of
+// AllocationSimulation.
+type AllocationSimulationSerial struct {
+	Records []AllocationRecordSerial `json:"records"`
+	Load    []PeerLoadSerial         `json:"load"`
+	Failed  int                      `json:"failed"`
+}
+
+// ToSerial converts an AllocationSimulation to its serializable version.
+func (as AllocationSimulation) ToSerial() AllocationSimulationSerial {
+	records := make([]AllocationRecordSerial, len(as.Records), len(as.Records))
+	for i, r := range as.Records {
+		records[i] = r.ToSerial()
+	}
+	load := make([]PeerLoadSerial, len(as.Load), len(as.Load))
+	for i, pl := range as.Load {
+		load[i] = pl.ToSerial()
+	}
+	return AllocationSimulationSerial{
+		Records: records,
+		Load:    load,
+		Failed:  as.Failed,
+	}
+}
+
+// ToAllocationSimulation converts an AllocationSimulationSerial to its
+// native version.
+func (ass AllocationSimulationSerial) ToAllocationSimulation() AllocationSimulation {
+	records := make([]AllocationRecord, len(ass.Records), len(ass.Records))
+	for i, rs := range ass.Records {
+		records[i] = rs.ToAllocationRecord()
+	}
+	load := make([]PeerLoad, len(ass.Load), len(ass.Load))
+	for i, pls := range ass.Load {
+		load[i] = pls.ToPeerLoad()
+	}
+	return AllocationSimulation{
+		Records: records,
+		Load:    load,
+		Failed:  ass.Failed,
+	}
+}
+
+// ScalingAction is the recommendation made in a ScalingAdvice.
+type ScalingAction string
+
+// ScalingAction values
+const (
+	// No peers need to be added or removed
+	ScalingNone ScalingAction = "none"
+	// Peers are under pressure and more peers should be added
+	ScalingAddPeers ScalingAction = "add_peers"
+	// Peers are idle and some can be removed
+	ScalingRemovePeers ScalingAction = "remove_peers"
+)
+
+// PeerPressure summarizes the capacity pressure observed on a cluster peer.
+type PeerPressure struct {
+	Peer          peer.ID
+	FreeSpace     uint64        // last "freespace" metric, in bytes
+	FreeSpaceRate float64       // in bytes/s. Negative when shrinking.
+	TimeToFull    time.Duration // 0 when the free space is not shrinking
+	Queued        int           // pins waiting to be pinned
+	UnderPressure bool
+}
+
+// PeerPressureSerial is the serializable version of PeerPressure.
+type PeerPressureSerial struct {
+	Peer          string  `json:"peer"`
+	FreeSpace     uint64  `json:"free_space"`
+	FreeSpaceRate float64 `json:"free_space_rate"`
+	TimeToFull    string  `json:"time_to_full"`
+	Queued        int     `json:"queued"`
+	UnderPressure bool    `json:"under_pressure"`
+}
+
+// ToSerial converts a PeerPressure to its serializable version.
+func (pp PeerPressure) ToSerial() PeerPressureSerial {
+	ttf := ""
+	if pp.TimeToFull > 0 {
+		ttf = pp.TimeToFull.String()
+	}
+	return PeerPressureSerial{
+		Peer:          peer.IDB58Encode(pp.Peer),
+		FreeSpace:     pp.FreeSpace,
+		FreeSpaceRate: pp.FreeSpaceRate,
+		TimeToFull:    ttf,
+		Queued:        pp.Queued,
+		UnderPressure: pp.UnderPressure,
+	}
+}
+
+// ToPeerPressure converts a PeerPressureSerial to its native version.
+func (pps PeerPressureSerial) ToPeerPressure() PeerPressure {
+	p, err := peer.IDB58Decode(pps.Peer)
+	if err != nil {
+		logger.Error(pps.Peer, err)
+	}
+	var ttf time.Duration
+	if pps.TimeToFull != "" {
+		ttf, err = time.ParseDuration(pps.TimeToFull)
+		if err != nil {
+			logger.Error(pps.TimeToFull, err)
+		}
+	}
+	return PeerPressure{
+		Peer:          p,
+		FreeSpace:     pps.FreeSpace,
+		FreeSpaceRate: pps.FreeSpaceRate,
+		TimeToFull:    ttf,
+		Queued:        pps.Queued,
+		UnderPressure: pps.UnderPressure,
+	}
+}
+
+// ScalingAdvice is a recommendation to add or remove cluster peers based
+// on the capacity pressure observed on the current ones. It is meant to be
+// consumed by autoscaling controllers.
+type ScalingAdvice struct {
+	Action   ScalingAction
+	Peers    int // how many peers to add or remove
+	Reasons  []string
+	Pressure []PeerPressure
+	TS       time.Time
+}
+
+// ScalingAdviceSerial is the serializable version of ScalingAdvice.
+type ScalingAdviceSerial struct {
+	Action   string               `json:"action"`
+	Peers    int                  `json:"peers"`
+	Reasons  []string             `json:"reasons"`
+	Pressure []PeerPressureSerial `json:"pressure"`
+	TS       string               `json:"timestamp"`
+}
+
+// ToSerial converts a ScalingAdvice to its serializable version.
+func (sa ScalingAdvice) ToSerial() ScalingAdviceSerial {
+	pressure := make([]PeerPressureSerial, len(sa.Pressure), len(sa.Pressure))
+	for i, pp := range sa.Pressure {
+		pressure[i] = pp.ToSerial()
+	}
+	reasons := make([]string, len(sa.Reasons), len(sa.Reasons))
+	copy(reasons, sa.Reasons)
+	return ScalingAdviceSerial{
+		Action:   string(sa.Action),
+		Peers:    sa.Peers,
+		Reasons:  reasons,
+		Pressure: pressure,
+		TS:       sa.TS.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// ToScalingAdvice converts a ScalingAdviceSerial to its native version.
+func (sas ScalingAdviceSerial) ToScalingAdvice() ScalingAdvice {
+	ts, err := time.Parse(time.RFC3339Nano, sas.TS)
+	if err != nil {
+		logger.Error(sas.TS, err)
+	}
+	pressure := make([]PeerPressure, len(sas.Pressure), len(sas.Pressure))
+	for i, pps := range sas.Pressure {
+		pressure[i] = pps.ToPeerPressure()
+	}
+	return ScalingAdvice{
+		Action:   ScalingAction(sas.Action),
+		Peers:    sas.Peers,
+		Reasons:  sas.Reasons,
+		Pressure: pressure,
+		TS:       ts,
 	}
 }
 
@@ -541,13 +2720,26 @@ type Alert struct {
 	MetricName string
 }
 
-// Error can be used by APIs to return errors.
+// Error can be used by APIs to return errors. Details may provide
+// additional context, i.e. the candidate peers discarded by a failed
+// allocation, keyed by peer ID.
 type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details"`
 }
 
 // Error implements the error interface and returns the error's message.
 func (e *Error) Error() string {
 	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
 }
+
+// MarshalJSON encodes the Error, with empty Details as {}.
+func (e Error) MarshalJSON() ([]byte, error) {
+	type jsonError Error
+	je := jsonError(e)
+	if je.Details == nil {
+		je.Details = map[string]string{}
+	}
+	return json.Marshal(je)
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -18,7 +20,7 @@ var testPeerID1, _ = peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLe
 var testPeerID2, _ = peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabd")
 
 func TestTrackerFromString(t *testing.T) {
-	testcases := []string{"bug", "cluster_error", "pin_error", "unpin_error", "pinned", "pinning", "unpinning", "unpinned", "remote"}
+	testcases := []string{"bug", "cluster_error", "pin_error", "unpin_error", "pinned", "pinning", "unpinning", "unpinned", "remote", "pinned_indirect", "remote_error"}
 	for i, tc := range testcases {
 		if TrackerStatusFromString(tc).String() != TrackerStatus(i).String() {
 			t.Errorf("%s does not match  TrackerStatus %d", tc, i)
@@ -26,6 +28,32 @@ func TestTrackerFromString(t *testing.T) {
 	}
 }
 
+func TestStatusFilter(t *testing.T) {
+	f, err := StatusFilterFromString("pin_error, unpin_error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Match(TrackerStatusPinError) || !f.Match(TrackerStatusUnpinError) {
+		t.Error("expected the filter to match its statuses")
+	}
+	if f.Match(TrackerStatusPinned) {
+		t.Error("expected the filter not to match other statuses")
+	}
+	if f.String() != "pin_error,unpin_error" {
+		t.Errorf("unexpected filter string: %s", f)
+	}
+
+	f, err = StatusFilterFromString("")
+	if err != nil || !f.Match(TrackerStatusRemote) {
+		t.Error("an empty filter should match everything")
+	}
+
+	_, err = StatusFilterFromString("pinned,wrong")
+	if err == nil {
+		t.Error("expected an error with unknown statuses")
+	}
+}
+
 func TestIPFSPinStatusFromString(t *testing.T) {
 	testcases := []string{"direct", "recursive", "indirect"}
 	for i, tc := range testcases {
@@ -33,6 +61,10 @@ func TestIPFSPinStatusFromString(t *testing.T) {
 			t.Errorf("%s does not match IPFSPinStatus %d", tc, i+2)
 		}
 	}
+
+	if IPFSPinStatusFromString("indirect through QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq") != IPFSPinStatusIndirect {
+		t.Error("expected indirect status for a pin through another")
+	}
 }
 
 func TestGlobalPinInfoConv(t *testing.T) {
@@ -88,6 +120,7 @@ func TestIDConv(t *testing.T) {
 			Addresses: []ma.Multiaddr{testMAddr3},
 			Error:     "abc",
 		},
+		Health: PeerHealthWaitingForIPFS,
 	}
 
 	newid := id.ToSerial().ToID()
@@ -111,7 +144,8 @@ func TestIDConv(t *testing.T) {
 	if id.Version != newid.Version ||
 		id.Commit != newid.Commit ||
 		id.RPCProtocolVersion != newid.RPCProtocolVersion ||
-		id.Error != newid.Error {
+		id.Error != newid.Error ||
+		id.Health != newid.Health {
 		t.Error("some field didn't survive")
 	}
 
@@ -151,16 +185,536 @@ func TestPinConv(t *testing.T) {
 		Cid:               testCid1,
 		Allocations:       []peer.ID{testPeerID1},
 		ReplicationFactor: -1,
+		Inline:            []byte("abc"),
+		Origin:            "/ip4/1.2.3.4/tcp/9094",
+		Namespace:         "team-a",
+		Path:              "/ipns/example.com/data",
+		RequestID:         "req-1",
 	}
 
 	newc := c.ToSerial().ToPin()
 	if c.Cid.String() != newc.Cid.String() ||
 		c.Allocations[0] != newc.Allocations[0] ||
-		c.ReplicationFactor != newc.ReplicationFactor {
+		c.ReplicationFactor != newc.ReplicationFactor ||
+		string(c.Inline) != string(newc.Inline) ||
+		c.Origin != newc.Origin ||
+		c.Namespace != newc.Namespace ||
+		c.Path != newc.Path ||
+		c.RequestID != newc.RequestID {
+		t.Error("mismatch")
+	}
+}
+
+func TestBatchItemConv(t *testing.T) {
+	bi := BatchItem{
+		Pin:   Pin{Cid: testCid1, Name: "a", ReplicationFactor: 2},
+		Unpin: true,
+	}
+
+	j, err := json.Marshal(bi.ToSerial())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	json.Unmarshal(j, &m)
+	if m["cid"] != testCid1.String() || m["unpin"] != true {
+		t.Error("the pin fields should be inlined:", string(j))
+	}
+
+	var bis BatchItemSerial
+	err = json.Unmarshal(j, &bis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newbi := bis.ToBatchItem()
+	if !newbi.Pin.Cid.Equals(testCid1) || newbi.Pin.Name != "a" ||
+		newbi.Pin.ReplicationFactor != 2 || !newbi.Unpin {
+		t.Error("mismatch")
+	}
+}
+
+func TestPinEquals(t *testing.T) {
+	p1 := Pin{
+		Cid:               testCid1,
+		Allocations:       []peer.ID{testPeerID1, testPeerID2},
+		ReplicationFactor: 2,
+		Name:              "a",
+	}
+	p2 := p1
+	p2.Allocations = []peer.ID{testPeerID2, testPeerID1}
+	if !p1.Equals(p2) {
+		t.Error("the order of the allocations should not matter")
+	}
+
+	p2.Name = "b"
+	if p1.Equals(p2) {
+		t.Error("pins with different names should not be equal")
+	}
+
+	p2 = p1
+	p2.ReplicationFactor = 1
+	if p1.Equals(p2) {
+		t.Error("pins with different replication factors should not be equal")
+	}
+
+	p2 = p1
+	p2.RequestID = "req-1"
+	if !p1.Equals(p2) {
+		t.Error("the request which created a pin should not matter")
+	}
+}
+
+func TestMetaPinConv(t *testing.T) {
+	c := Pin{
+		Cid:    testCid1,
+		Type:   MetaType,
+		Shards: []*cid.Cid{testCid1},
+	}
+
+	newc := c.ToSerial().ToPin()
+	if newc.Type != MetaType ||
+		len(newc.Shards) != 1 ||
+		!newc.Shards[0].Equals(testCid1) {
+		t.Error("mismatch")
+	}
+
+	if DataType.String() != "data" || c.ToSerial().Type != "meta" {
+		t.Error("bad pin type strings")
+	}
+	if (Pin{Cid: testCid1}).ToSerial().Type != "" {
+		t.Error("data pins should not serialize their type")
+	}
+	if _, err := PinTypeFromString("foo"); err == nil {
+		t.Error("expected an error parsing an unknown pin type")
+	}
+
+	shards := c.ShardPins()
+	if len(shards) != 1 || shards[0].Type != ShardType || !shards[0].Cid.Equals(testCid1) {
+		t.Error("bad shard pins")
+	}
+}
+
+func TestShardedPinInfo(t *testing.T) {
+	info := ShardedPinInfo(testCid1, testPeerID1, nil)
+	if info.Status != TrackerStatusUnpinned {
+		t.Error("an item without shards should be unpinned")
+	}
+
+	shards := []PinInfo{
+		{Status: TrackerStatusPinned, Size: 1},
+		{Status: TrackerStatusPinnedIndirect, Size: 2},
+	}
+	info = ShardedPinInfo(testCid1, testPeerID1, shards)
+	if info.Status != TrackerStatusPinned || info.Size != 3 {
+		t.Error("all shards are pinned:", info.Status, info.Size)
+	}
+	if !info.Cid.Equals(testCid1) || info.Peer != testPeerID1 {
+		t.Error("bad cid or peer")
+	}
+
+	shards = append(shards,
+		PinInfo{Status: TrackerStatusPinning, Blocks: 4},
+		PinInfo{Status: TrackerStatusPinError, Error: "bad", Attempts: 2},
+	)
+	info = ShardedPinInfo(testCid1, testPeerID1, shards)
+	if info.Status != TrackerStatusPinError || info.Error != "bad" {
+		t.Error("errors should be reported first:", info.Status)
+	}
+	if info.Attempts != 2 || info.Blocks != 4 {
+		t.Error("bad progress counters")
+	}
+
+	info = ShardedPinInfo(testCid1, testPeerID1, shards[:3])
+	if info.Status != TrackerStatusPinning {
+		t.Error("expected pinning:", info.Status)
+	}
+}
+
+func TestAllocationRecordConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	ar := AllocationRecord{
+		Cid:         testCid1,
+		Peer:        testPeerID1,
+		Allocations: []peer.ID{testPeerID2},
+		MetricName:  "freespace",
+		Metrics: map[peer.ID]string{
+			testPeerID2: "100",
+		},
+		Considered: []peer.ID{testPeerID1, testPeerID2},
+		Vetoes: map[peer.ID]string{
+			testPeerID1: "blacklisted",
+		},
+		Reason: "new allocations",
+		TS:     testTime,
+	}
+
+	newar := ar.ToSerial().ToAllocationRecord()
+	if ar.Cid.String() != newar.Cid.String() ||
+		ar.Peer != newar.Peer ||
+		ar.Allocations[0] != newar.Allocations[0] ||
+		ar.Metrics[testPeerID2] != newar.Metrics[testPeerID2] ||
+		len(newar.Considered) != 2 ||
+		ar.Considered[1] != newar.Considered[1] ||
+		ar.Vetoes[testPeerID1] != newar.Vetoes[testPeerID1] ||
+		ar.Reason != newar.Reason ||
+		!ar.TS.Equal(newar.TS) {
+		t.Error("mismatch")
+	}
+}
+
+func TestScalingAdviceConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	sa := ScalingAdvice{
+		Action:  ScalingAddPeers,
+		Peers:   1,
+		Reasons: []string{"running out of space"},
+		Pressure: []PeerPressure{
+			{
+				Peer:          testPeerID1,
+				FreeSpace:     1000,
+				FreeSpaceRate: -10,
+				TimeToFull:    100 * time.Second,
+				Queued:        5,
+				UnderPressure: true,
+			},
+		},
+		TS: testTime,
+	}
+
+	newsa := sa.ToSerial().ToScalingAdvice()
+	if sa.Action != newsa.Action ||
+		sa.Peers != newsa.Peers ||
+		sa.Reasons[0] != newsa.Reasons[0] ||
+		sa.Pressure[0] != newsa.Pressure[0] ||
+		!sa.TS.Equal(newsa.TS) {
+		t.Error("mismatch")
+	}
+}
+
+func TestAllocationSimulationConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	as := AllocationSimulation{
+		Records: []AllocationRecord{
+			{
+				Cid:         testCid1,
+				Peer:        testPeerID1,
+				Allocations: []peer.ID{testPeerID2},
+				MetricName:  "numpin",
+				Metrics: map[peer.ID]string{
+					testPeerID2: "3",
+				},
+				Reason: "under-replicated: added the best candidates",
+				TS:     testTime,
+			},
+		},
+		Load: []PeerLoad{
+			{
+				Peer:    testPeerID2,
+				Current: 3,
+				Added:   1,
+			},
+		},
+		Failed: 1,
+	}
+
+	newas := as.ToSerial().ToAllocationSimulation()
+	if len(newas.Records) != 1 ||
+		as.Records[0].Cid.String() != newas.Records[0].Cid.String() ||
+		as.Records[0].Allocations[0] != newas.Records[0].Allocations[0] ||
+		as.Load[0] != newas.Load[0] ||
+		as.Failed != newas.Failed {
+		t.Error("mismatch")
+	}
+}
+
+func TestLocalPinConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	lp := LocalPin{
+		Cid:       testCid1,
+		Type:      IPFSPinStatusRecursive,
+		Tracked:   true,
+		Allocated: true,
+	}
+
+	newlp := lp.ToSerial().ToLocalPin()
+	if lp.Cid.String() != newlp.Cid.String() ||
+		lp.Type != newlp.Type ||
+		lp.Tracked != newlp.Tracked ||
+		lp.Allocated != newlp.Allocated {
+		t.Error("mismatch")
+	}
+}
+
+func TestPinEventConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	pe := PinEvent{
+		PinInfo: PinInfo{
+			Cid:      testCid1,
+			Peer:     testPeerID1,
+			Status:   TrackerStatusPinError,
+			TS:       testTime,
+			Error:    "error",
+			Attempts: 2,
+		},
+		Queued: true,
+	}
+
+	newpe := pe.ToSerial().ToPinEvent()
+	if !pe.Cid.Equals(newpe.Cid) ||
+		pe.Peer != newpe.Peer ||
+		pe.Status != newpe.Status ||
+		!pe.TS.Equal(newpe.TS) ||
+		pe.Error != newpe.Error ||
+		pe.Attempts != newpe.Attempts ||
+		pe.Queued != newpe.Queued {
+		t.Error("mismatch")
+	}
+}
+
+func TestEventConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	ev := Event{
+		Seq:  3,
+		Type: EventPinStatus,
+		TS:   testTime,
+		PinEvent: &PinEvent{
+			PinInfo: PinInfo{
+				Cid:    testCid1,
+				Peer:   testPeerID1,
+				Status: TrackerStatusPinned,
+				TS:     testTime,
+			},
+		},
+	}
+	newev := ev.ToSerial().ToEvent()
+	if ev.Seq != newev.Seq ||
+		ev.Type != newev.Type ||
+		!ev.TS.Equal(newev.TS) ||
+		newev.PinEvent == nil ||
+		!newev.PinEvent.Cid.Equals(testCid1) ||
+		newev.Peer != "" {
+		t.Error("mismatch")
+	}
+
+	alrt := Event{
+		Seq:        4,
+		Type:       EventAlert,
+		TS:         testTime,
+		Peer:       testPeerID2,
+		MetricName: "ping",
+	}
+	newalrt := alrt.ToSerial().ToEvent()
+	if newalrt.Peer != testPeerID2 ||
+		newalrt.MetricName != "ping" ||
+		newalrt.PinEvent != nil {
 		t.Error("mismatch")
 	}
 }
 
+func TestTrackerMetricsConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	tm := TrackerMetrics{
+		Peer:            testPeerID1,
+		PinQueue:        3,
+		BackgroundQueue: 10,
+		InFlight:        1,
+		UnpinErrors:     2,
+		Retries:         5,
+		Pins:            40,
+		AvgPinLatency:   2 * time.Second,
+	}
+	if newtm := tm.ToSerial().ToTrackerMetrics(); newtm != tm {
+		t.Errorf("mismatch: %+v", newtm)
+	}
+}
+
+func TestSyncStatusConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	ss := SyncStatus{
+		Peer: testPeerID1,
+		State: SyncInfo{
+			Enabled:   true,
+			Interval:  time.Minute,
+			Jitter:    10 * time.Second,
+			Last:      testTime,
+			OutOfSync: 3,
+		},
+		IPFS: SyncInfo{
+			Interval: 0,
+			Error:    "ipfs unreachable",
+		},
+	}
+
+	newss := ss.ToSerial().ToSyncStatus()
+	if ss.Peer != newss.Peer ||
+		ss.State != newss.State ||
+		ss.IPFS != newss.IPFS {
+		t.Error("mismatch")
+	}
+	if !newss.IPFS.Last.IsZero() {
+		t.Error("a sync which never ran should have a zero Last time")
+	}
+}
+
+func TestDuplicatePinsConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	v1 := cid.NewCidV1(cid.DagProtobuf, testCid1.Hash())
+	dp := DuplicatePins{
+		Multihash: testCid1.Hash().B58String(),
+		Pins: []Pin{
+			{
+				Cid:               testCid1,
+				ReplicationFactor: -1,
+				Aliases:           []*cid.Cid{v1},
+			},
+			{
+				Cid:               v1,
+				ReplicationFactor: 1,
+				Allocations:       []peer.ID{testPeerID1},
+			},
+		},
+	}
+
+	newdp := dp.ToSerial().ToDuplicatePins()
+	if dp.Multihash != newdp.Multihash ||
+		len(newdp.Pins) != 2 ||
+		!newdp.Pins[0].HasAlias(v1) ||
+		newdp.Pins[1].Cid.String() != v1.String() ||
+		newdp.Pins[1].Allocations[0] != testPeerID1 {
+		t.Error("mismatch")
+	}
+}
+
+func TestPeerRemovalConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	pr := PeerRemoval{
+		Peer:        testPeerID1,
+		Phase:       PeerRemovalReallocating,
+		Total:       3,
+		Reallocated: 1,
+		Start:       time.Now(),
+	}
+
+	newpr := pr.ToSerial().ToPeerRemoval()
+	if newpr.Peer != pr.Peer ||
+		newpr.Phase != pr.Phase ||
+		newpr.Total != 3 ||
+		newpr.Reallocated != 1 ||
+		!newpr.Start.Equal(pr.Start) ||
+		!newpr.End.IsZero() {
+		t.Error("mismatch")
+	}
+}
+
+func TestConsensusStatusConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	cs := ConsensusStatus{
+		Peer:         testPeerID1,
+		Leader:       testPeerID2,
+		Term:         3,
+		CommitIndex:  20,
+		AppliedIndex: 18,
+		LastSnapshot: time.Now(),
+	}
+
+	newcs := cs.ToSerial().ToConsensusStatus()
+	if newcs.Peer != cs.Peer ||
+		newcs.Leader != cs.Leader ||
+		newcs.Term != 3 ||
+		newcs.CommitIndex != 20 ||
+		newcs.AppliedIndex != 18 ||
+		!newcs.LastSnapshot.Equal(cs.LastSnapshot) ||
+		!newcs.LastContact.IsZero() {
+		t.Error("mismatch")
+	}
+}
+
+func TestStateDiffConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	sd := StateDiff{
+		Peer:       testPeerID1,
+		Root:       "abc",
+		LeaderRoot: "def",
+		Missing:    []*cid.Cid{testCid1},
+	}
+
+	newsd := sd.ToSerial().ToStateDiff()
+	if newsd.Peer != sd.Peer ||
+		newsd.Root != "abc" ||
+		newsd.LeaderRoot != "def" ||
+		len(newsd.Missing) != 1 || !newsd.Missing[0].Equals(testCid1) ||
+		len(newsd.Extra) != 0 {
+		t.Error("mismatch")
+	}
+	if !newsd.Diverged() {
+		t.Error("different roots should mean divergence")
+	}
+	newsd.LeaderRoot = "abc"
+	if newsd.Diverged() {
+		t.Error("same roots should not mean divergence")
+	}
+}
+
 func TestMetric(t *testing.T) {
 	m := Metric{
 		Name:  "hello",
@@ -200,3 +754,129 @@ func TestMetric(t *testing.T) {
 		t.Error("looks like a bad ttl")
 	}
 }
+
+func TestPinLogEntryConv(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatal("paniced")
+		}
+	}()
+
+	ple := PinLogEntry{
+		Seq: 3,
+		Op:  PinLogUnpin,
+		Pin: PinCid(testCid1),
+		TS:  testTime,
+	}
+
+	newple := ple.ToSerial().ToPinLogEntry()
+	if newple.Seq != 3 ||
+		newple.Op != PinLogUnpin ||
+		!newple.Pin.Cid.Equals(testCid1) ||
+		!newple.TS.Equal(ple.TS) {
+		t.Error("mismatch")
+	}
+}
+
+func TestAllocationErrorDetails(t *testing.T) {
+	ae := &AllocationError{
+		Cid:    testCid1,
+		Reason: "not enough candidates",
+		Vetoes: map[peer.ID]string{
+			testPeerID1: "blacklisted",
+			testPeerID2: "discarded by filters.TagMatch filter",
+		},
+	}
+	wrapped := fmt.Errorf("error allocating %s: %s", testCid1, ae)
+	details, ok := AllocationErrorDetails(wrapped.Error())
+	if !ok {
+		t.Fatal("expected an allocation error")
+	}
+	if len(details) != 2 || details[testPeerID1.Pretty()] != "blacklisted" ||
+		details[testPeerID2.Pretty()] != "discarded by filters.TagMatch filter" {
+		t.Error("unexpected details:", details)
+	}
+
+	_, ok = AllocationErrorDetails("some other error")
+	if ok {
+		t.Error("expected false for other errors")
+	}
+}
+
+func TestInvalidPinError(t *testing.T) {
+	err := NewInvalidPinError("unknown namespace '%s'", "team-a")
+	if !IsInvalidPinError(fmt.Sprintf("error pinning: %s", err)) {
+		t.Error("expected an invalid pin error")
+	}
+	if IsInvalidPinError("some other error") {
+		t.Error("expected false for other errors")
+	}
+}
+
+func TestQuotaErrorDetails(t *testing.T) {
+	qe := &QuotaError{
+		Namespace: "team-a",
+		Quota:     "max_bytes",
+		Max:       100,
+		Used:      90,
+		Requested: 20,
+	}
+	details, ok := QuotaErrorDetails(qe.Error())
+	if !ok {
+		t.Fatal("expected a quota error")
+	}
+	if details["namespace"] != "team-a" || details["quota"] != "max_bytes" ||
+		details["max"] != "100" || details["used"] != "90" || details["requested"] != "20" {
+		t.Error("unexpected details:", details)
+	}
+
+	_, ok = QuotaErrorDetails("some other error")
+	if ok {
+		t.Error("expected false for other errors")
+	}
+}
+
+func TestPeerLivenessConv(t *testing.T) {
+	pl := PeerLiveness{
+		Peer:       testPeerID1,
+		Alive:      true,
+		LastMetric: time.Now().Add(30 * time.Second),
+		RTT:        15 * time.Millisecond,
+	}
+
+	newpl := pl.ToSerial().ToPeerLiveness()
+	if pl.Peer != newpl.Peer ||
+		pl.Alive != newpl.Alive ||
+		!pl.LastMetric.Equal(newpl.LastMetric) ||
+		pl.RTT != newpl.RTT {
+		t.Error("mismatch")
+	}
+}
+
+func TestConnectGraphConv(t *testing.T) {
+	testPeerID3, _ := peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabe")
+	testPeerID4, _ := peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabf")
+	cg := ConnectGraph{
+		ClusterID: testPeerID1,
+		ClusterLinks: map[peer.ID][]peer.ID{
+			testPeerID1: {testPeerID2},
+			testPeerID2: {testPeerID1},
+		},
+		IPFSLinks: map[peer.ID][]peer.ID{
+			testPeerID3: {testPeerID4},
+		},
+		ClustertoIPFS: map[peer.ID]peer.ID{
+			testPeerID1: testPeerID3,
+			testPeerID2: testPeerID4,
+		},
+	}
+
+	newcg := cg.ToSerial().ToConnectGraph()
+	if newcg.ClusterID != cg.ClusterID ||
+		len(newcg.ClusterLinks) != 2 ||
+		newcg.ClusterLinks[testPeerID1][0] != testPeerID2 ||
+		newcg.IPFSLinks[testPeerID3][0] != testPeerID4 ||
+		newcg.ClustertoIPFS[testPeerID2] != testPeerID4 {
+		t.Error("mismatch")
+	}
+}
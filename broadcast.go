@@ -0,0 +1,156 @@
+package ipfscluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Broadcaster performs the same RPC request on several destinations
+// concurrently. Requests sent to the same destination are spaced by
+// at least MinInterval and failed requests are retried up to Retries
+// times, waiting RetryDelay between attempts. It is used to distribute
+// metrics, to notify peers of cluster changes and to gather the status
+// of every peer, so all of them behave the same way on slow links.
+type Broadcaster struct {
+	// MinInterval is the minimum amount of time between two
+	// requests sent to the same destination. 0 disables rate limiting.
+	MinInterval time.Duration
+	// Retries is the number of times a failed request is retried.
+	Retries int
+	// RetryDelay is the time to wait before retrying a failed request.
+	RetryDelay time.Duration
+
+	ctx       context.Context
+	rpcClient *rpc.Client
+
+	mux  sync.Mutex
+	next map[peer.ID]time.Time
+}
+
+// NewBroadcaster returns a Broadcaster which uses the given RPC client.
+// Pending retries and rate-limited requests are abandoned when the
+// context is cancelled.
+func NewBroadcaster(ctx context.Context, rpcClient *rpc.Client, minInterval time.Duration, retries int, retryDelay time.Duration) *Broadcaster {
+	return &Broadcaster{
+		MinInterval: minInterval,
+		Retries:     retries,
+		RetryDelay:  retryDelay,
+		ctx:         ctx,
+		rpcClient:   rpcClient,
+		next:        make(map[peer.ID]time.Time),
+	}
+}
+
+// Broadcast calls svcName.svcMethod with the given arguments on every
+// destination and places each response in the matching reply. It returns
+// one error per destination, which is nil when the request succeeded.
+func (b *Broadcaster) Broadcast(dests []peer.ID, svcName, svcMethod string, args interface{}, replies []interface{}) []error {
+	if len(dests) != len(replies) {
+		panic("must have matching dests and replies")
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(dests), len(dests))
+
+	for i := range dests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = b.call(dests[i], svcName, svcMethod, args, replies[i])
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// call performs a single request with rate limiting and retries.
+func (b *Broadcaster) call(dest peer.ID, svcName, svcMethod string, args, reply interface{}) error {
+	var err error
+	for attempt := 0; attempt <= b.Retries; attempt++ {
+		if attempt > 0 {
+			logger.Debugf("retrying %s.%s on %s: %s", svcName, svcMethod, dest.Pretty(), err)
+			if !b.wait(b.RetryDelay) {
+				return err
+			}
+		}
+		if !b.wait(b.reserve(dest)) {
+			return b.ctx.Err()
+		}
+		err = b.rpcClient.Call(dest, svcName, svcMethod, args, reply)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// reserve books the next slot to send a request to dest and returns
+// how long the caller needs to wait for it.
+func (b *Broadcaster) reserve(dest peer.ID) time.Duration {
+	if b.MinInterval <= 0 {
+		return 0
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	now := time.Now()
+	slot, ok := b.next[dest]
+	if !ok || slot.Before(now) {
+		slot = now
+	}
+	b.next[dest] = slot.Add(b.MinInterval)
+	return slot.Sub(now)
+}
+
+// wait sleeps for d. It returns false if the context was cancelled
+// in the meantime.
+func (b *Broadcaster) wait(d time.Duration) bool {
+	if d <= 0 {
+		return b.ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-b.ctx.Done():
+		return false
+	}
+}
+
+// BroadcastError reports the destinations of a broadcast which could
+// not be reached, along with their errors.
+type BroadcastError struct {
+	Peers  []peer.ID
+	Errors []error
+}
+
+// NewBroadcastError returns a *BroadcastError with the failed
+// destinations among dests, or nil when all errs are nil.
+func NewBroadcastError(dests []peer.ID, errs []error) error {
+	var bErr BroadcastError
+	for i, e := range errs {
+		if e != nil {
+			bErr.Peers = append(bErr.Peers, dests[i])
+			bErr.Errors = append(bErr.Errors, e)
+		}
+	}
+	if len(bErr.Peers) == 0 {
+		return nil
+	}
+	return &bErr
+}
+
+// Error lists every failed destination with its error.
+func (e *BroadcastError) Error() string {
+	failed := make([]string, len(e.Peers), len(e.Peers))
+	for i := range e.Peers {
+		failed[i] = fmt.Sprintf("%s: %s", e.Peers[i].Pretty(), e.Errors[i])
+	}
+	return strings.Join(failed, "; ")
+}
@@ -0,0 +1,93 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestBroadcast(t *testing.T) {
+	b := NewBroadcaster(context.Background(), test.NewMockRPCClient(t), 0, 0, 0)
+	dests := []peer.ID{"", "", ""}
+	replies := make([]api.IDSerial, len(dests), len(dests))
+	errs := b.Broadcast(dests, "Cluster", "ID", struct{}{}, copyIDSerialsToIfaces(replies))
+	for i, e := range errs {
+		if e != nil {
+			t.Fatal(e)
+		}
+		if replies[i].ID != test.TestPeerID1.Pretty() {
+			t.Error("expected a reply for each destination")
+		}
+	}
+}
+
+func TestBroadcastRetries(t *testing.T) {
+	b := NewBroadcaster(context.Background(), test.NewMockRPCClient(t), 0, 2, 50*time.Millisecond)
+	dests := []peer.ID{""}
+	pin := api.PinSerial{Cid: test.ErrorCid}
+	start := time.Now()
+	errs := b.Broadcast(dests, "Cluster", "Pin", pin, []interface{}{&struct{}{}})
+	if errs[0] == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("expected two retries")
+	}
+}
+
+func TestBroadcastRetriesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := NewBroadcaster(ctx, test.NewMockRPCClient(t), 0, 1, time.Minute)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	pin := api.PinSerial{Cid: test.ErrorCid}
+	errs := b.Broadcast([]peer.ID{""}, "Cluster", "Pin", pin, []interface{}{&struct{}{}})
+	if errs[0] == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestBroadcastMinInterval(t *testing.T) {
+	b := NewBroadcaster(context.Background(), test.NewMockRPCClient(t), 100*time.Millisecond, 0, 0)
+	dests := []peer.ID{"", "", ""}
+	start := time.Now()
+	errs := b.Broadcast(dests, "Cluster", "ID", struct{}{},
+		copyIDSerialsToIfaces(make([]api.IDSerial, len(dests), len(dests))))
+	for _, e := range errs {
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	if time.Since(start) < 200*time.Millisecond {
+		t.Error("requests to the same destination should have been spaced")
+	}
+}
+
+func TestNewBroadcastError(t *testing.T) {
+	dests := []peer.ID{test.TestPeerID1, test.TestPeerID2, test.TestPeerID3}
+	err := NewBroadcastError(dests, []error{nil, nil, nil})
+	if err != nil {
+		t.Error("expected no error")
+	}
+
+	err = NewBroadcastError(dests, []error{nil, errors.New("a"), errors.New("b")})
+	bErr, ok := err.(*BroadcastError)
+	if !ok {
+		t.Fatal("expected a BroadcastError")
+	}
+	if len(bErr.Peers) != 2 || bErr.Peers[0] != test.TestPeerID2 {
+		t.Error("expected two failed peers")
+	}
+	if !strings.Contains(err.Error(), test.TestPeerID3.Pretty()+": b") {
+		t.Error("expected the error to list failed peers")
+	}
+}
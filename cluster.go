@@ -1,8 +1,12 @@
 package ipfscluster
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -10,11 +14,15 @@ import (
 	pnet "github.com/libp2p/go-libp2p-pnet"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
+	"github.com/ipfs/ipfs-cluster/consensus/etcd"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
 	"github.com/ipfs/ipfs-cluster/state"
 
 	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
+	floodsub "github.com/libp2p/go-floodsub"
 	host "github.com/libp2p/go-libp2p-host"
 	ipnet "github.com/libp2p/go-libp2p-interface-pnet"
 	peer "github.com/libp2p/go-libp2p-peer"
@@ -35,16 +43,47 @@ type Cluster struct {
 	host        host.Host
 	rpcServer   *rpc.Server
 	rpcClient   *rpc.Client
+	broadcaster *Broadcaster
 	peerManager *peerManager
 
 	consensus Consensus
-	api       API
+	apis      []API
 	ipfs      IPFSConnector
 	state     state.State
 	tracker   PinTracker
 	monitor   PeerMonitor
-	allocator PinAllocator
-	informer  Informer
+
+	// the allocator and the informer can be swapped at runtime
+	allocMux        sync.RWMutex
+	allocator       PinAllocator
+	informer        Informer
+	allocBuilder    AllocationStrategyBuilder
+	informerSwapped chan struct{}
+
+	allocFiltersMux sync.RWMutex
+	allocFilters    []AllocationFilter
+
+	// quotas are checked and pins committed under namespacesMux
+	namespacesMux sync.Mutex
+
+	allocHistory *allocationHistory
+	pinLog       *pinLog
+	eventLog     *eventLog
+	repinner     *RepinScheduler
+	followers    []*follower
+
+	stateSyncLoop *syncLoop
+	ipfsSyncLoop  *syncLoop
+
+	statusCache *statusCache
+
+	peerRemovals *peerRemovals
+
+	// pin events from the tracker are sent to subscribers and to
+	// the pubsub topic
+	eventSubsMux sync.Mutex
+	eventSubs    map[chan api.PinEvent]struct{}
+	pubsub       *floodsub.PubSub
 
 	shutdownLock sync.Mutex
 	shutdownB    bool
@@ -54,6 +93,13 @@ type Cluster struct {
 	readyB       bool
 	wg           sync.WaitGroup
 
+	ipfsMux   sync.RWMutex
+	ipfsReady bool
+	ipfsErr   error
+
+	quorumMux sync.RWMutex
+	quorumErr error
+
 	// paMux sync.Mutex
 }
 
@@ -63,10 +109,14 @@ type Cluster struct {
 // The new cluster peer may still be performing initialization tasks when
 // this call returns (consensus may still be bootstrapping). Use Cluster.Ready()
 // if you need to wait until the peer is fully up.
+//
+// The consensus configuration decides which Consensus component is used:
+// a *raft.Config, a *crdt.Config or an *etcd.Config. Several API
+// components (i.e. the REST and GraphQL APIs) can be given.
 func NewCluster(
 	cfg *Config,
-	consensusCfg *raft.Config,
-	api API,
+	consensusCfg config.ComponentConfig,
+	apis []API,
 	ipfs IPFSConnector,
 	st state.State,
 	tracker PinTracker,
@@ -91,6 +141,12 @@ func NewCluster(
 		logger.Infof("        %s/ipfs/%s", addr, host.ID().Pretty())
 	}
 
+	for _, api := range apis {
+		if lapi, ok := api.(Libp2pAPI); ok {
+			lapi.SetHost(host)
+		}
+	}
+
 	peerManager := newPeerManager(host)
 	peerManager.importAddresses(cfg.Peers)
 	peerManager.importAddresses(cfg.Bootstrap)
@@ -101,7 +157,7 @@ func NewCluster(
 		id:          host.ID(),
 		config:      cfg,
 		host:        host,
-		api:         api,
+		apis:        apis,
 		ipfs:        ipfs,
 		state:       st,
 		tracker:     tracker,
@@ -114,6 +170,18 @@ func NewCluster(
 		doneCh:      make(chan struct{}),
 		readyCh:     make(chan struct{}),
 		readyB:      false,
+
+		informerSwapped: make(chan struct{}, 1),
+		allocHistory:    newAllocationHistory(AllocationHistorySize),
+		eventLog:        newEventLog(EventLogSize),
+		statusCache:     newStatusCache(cfg.StatusCacheTTL),
+		peerRemovals:    newPeerRemovals(),
+	}
+
+	c.pinLog, err = openPinLog(cfg, PinLogSize)
+	if err != nil {
+		c.Shutdown()
+		return nil, err
 	}
 
 	err = c.setupRPC()
@@ -122,6 +190,18 @@ func NewCluster(
 		return nil, err
 	}
 
+	err = c.setupPinEvents()
+	if err != nil {
+		c.Shutdown()
+		return nil, err
+	}
+
+	err = c.setupFollowers()
+	if err != nil {
+		c.Shutdown()
+		return nil, err
+	}
+
 	err = c.setupConsensus(consensusCfg)
 	if err != nil {
 		c.Shutdown()
@@ -134,6 +214,7 @@ func NewCluster(
 		c.Shutdown()
 		return nil, errors.New("bootstrap unsuccessful")
 	}
+	go c.waitForIPFS()
 	go func() {
 		c.ready()
 		c.run()
@@ -150,10 +231,53 @@ func (c *Cluster) setupRPC() error {
 	c.rpcServer = rpcServer
 	rpcClient := rpc.NewClientWithServer(c.host, RPCProtocol, rpcServer)
 	c.rpcClient = rpcClient
+	c.broadcaster = NewBroadcaster(
+		c.ctx,
+		rpcClient,
+		c.config.BroadcastMinInterval,
+		c.config.BroadcastRetries,
+		c.config.BroadcastRetryDelay)
+	c.repinner = NewRepinScheduler(
+		c.ctx,
+		c.pin,
+		c.config.MaxConcurrentRepins,
+		c.config.RepinPeerRate)
+	c.stateSyncLoop = newSyncLoop(
+		"StateSync()",
+		c.config.StateSyncInterval,
+		c.config.SyncJitter,
+		c.StateSync)
+	c.ipfsSyncLoop = newSyncLoop(
+		"SyncAllLocal()",
+		c.config.IPFSSyncInterval,
+		c.config.SyncJitter,
+		c.ipfsSync)
+	return nil
+}
+
+func (c *Cluster) setupConsensus(consensuscfg config.ComponentConfig) error {
+	var consensus Consensus
+	var err error
+
+	switch cfg := consensuscfg.(type) {
+	case *raft.Config:
+		consensus, err = c.setupRaftConsensus(cfg)
+	case *crdt.Config:
+		consensus, err = c.setupCrdtConsensus(cfg)
+	case *etcd.Config:
+		consensus, err = etcd.NewConsensus(c.host, cfg, c.state)
+	default:
+		err = errors.New("unknown consensus configuration")
+	}
+	if err != nil {
+		logger.Errorf("error creating consensus: %s", err)
+		return err
+	}
+	c.consensus = consensus
 	return nil
 }
 
-func (c *Cluster) setupConsensus(consensuscfg *raft.Config) error {
+func (c *Cluster) setupRaftConsensus(cfg *raft.Config) (Consensus, error) {
 	var startPeers []peer.ID
 
 	if len(c.config.Peers) > 0 {
@@ -164,49 +288,37 @@ func (c *Cluster) setupConsensus(consensuscfg *raft.Config) error {
 		startPeers = []peer.ID{}
 	}
 
-	consensus, err := raft.NewConsensus(
+	return raft.NewConsensus(
 		append(startPeers, c.id),
 		c.host,
-		consensuscfg,
+		cfg,
 		c.state)
-	if err != nil {
-		logger.Errorf("error creating consensus: %s", err)
-		return err
+}
+
+func (c *Cluster) setupCrdtConsensus(cfg *crdt.Config) (Consensus, error) {
+	// pubsub may have been started already for pin events
+	if c.pubsub == nil {
+		ps, err := floodsub.NewFloodSub(c.ctx, c.host)
+		if err != nil {
+			return nil, err
+		}
+		c.pubsub = ps
 	}
-	c.consensus = consensus
-	return nil
+	return crdt.NewConsensus(c.host, cfg, c.state, c.pubsub)
 }
 
 func (c *Cluster) setupRPCClients() {
 	c.tracker.SetClient(c.rpcClient)
 	c.ipfs.SetClient(c.rpcClient)
-	c.api.SetClient(c.rpcClient)
+	for _, api := range c.apis {
+		api.SetClient(c.rpcClient)
+	}
 	c.consensus.SetClient(c.rpcClient)
 	c.monitor.SetClient(c.rpcClient)
 	c.allocator.SetClient(c.rpcClient)
 	c.informer.SetClient(c.rpcClient)
 }
 
-// syncWatcher loops and triggers StateSync and SyncAllLocal from time to time
-func (c *Cluster) syncWatcher() {
-	stateSyncTicker := time.NewTicker(c.config.StateSyncInterval)
-	syncTicker := time.NewTicker(c.config.IPFSSyncInterval)
-
-	for {
-		select {
-		case <-stateSyncTicker.C:
-			logger.Debug("auto-triggering StateSync()")
-			c.StateSync()
-		case <-syncTicker.C:
-			logger.Debug("auto-triggering SyncAllLocal()")
-			c.SyncAllLocal()
-		case <-c.ctx.Done():
-			stateSyncTicker.Stop()
-			return
-		}
-	}
-}
-
 func (c *Cluster) broadcastMetric(m api.Metric) error {
 	peers, err := c.consensus.Peers()
 	if err != nil {
@@ -232,7 +344,7 @@ func (c *Cluster) broadcastMetric(m api.Metric) error {
 			// Leader needs to broadcast its metric to everyone
 			// in case it goes down (new leader will have to detect this node went down)
 			logger.Debugf("Leader %s about to broadcast metric %s to %s. Expires: %s", c.id, m.Name, peers, m.Expire)
-			errs := c.multiRPC(peers,
+			errs := c.broadcaster.Broadcast(peers,
 				"Cluster",
 				"PeerMonitorLogMetric",
 				m,
@@ -247,11 +359,11 @@ func (c *Cluster) broadcastMetric(m api.Metric) error {
 			// non-leaders just need to forward their metrics to the leader
 			logger.Debugf("Peer %s about to send metric %s to %s. Expires: %s", c.id, m.Name, leader, m.Expire)
 
-			err := c.rpcClient.Call(leader,
+			errs := c.broadcaster.Broadcast([]peer.ID{leader},
 				"Cluster", "PeerMonitorLogMetric",
-				m, &struct{}{})
-			if err != nil {
-				logger.Error(err)
+				m, []interface{}{&struct{}{}})
+			if errs[0] != nil {
+				logger.Errorf("error pushing metric to %s: %s", leader.Pretty(), errs[0])
 			}
 			logger.Debugf("Peer %s sent metric %s to %s. Expires: %s", c.id, m.Name, leader, m.Expire)
 
@@ -272,11 +384,20 @@ func (c *Cluster) pushInformerMetrics() {
 		select {
 		case <-c.ctx.Done():
 			return
+		case <-c.informerSwapped:
+			// send the metric of the new informer right away
 		case <-timer.C:
 			// wait
 		}
 
-		metric := c.informer.GetMetric()
+		// informer metrics are sent again when pinning or the
+		// informer are enabled
+		informer := c.getInformer()
+		if !c.pinningEnabled() || !c.informerEnabled(informer.Name()) {
+			continue
+		}
+
+		metric := informer.GetMetric()
 		metric.Peer = c.id
 
 		err := c.broadcastMetric(metric)
@@ -316,6 +437,58 @@ func (c *Cluster) pushPingMetrics() {
 	}
 }
 
+// pushExtraInformerMetrics sends the metrics of an informer added with
+// AddInformer every TTL/2. They are sent to every cluster peer, and not
+// only to the leader like other metrics, so that any peer can use them
+// (i.e. the balanced allocator reads the "tags" of every peer).
+func (c *Cluster) pushExtraInformerMetrics(informer Informer) {
+	select {
+	case <-c.ctx.Done():
+		return
+	case <-c.readyCh:
+	}
+
+	timer := time.NewTimer(0) // fire immediately first
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		next := c.config.MonitorPingInterval
+		if c.informerEnabled(informer.Name()) {
+			metric := informer.GetMetric()
+			metric.Peer = c.id
+			c.pushMetricToAll(metric)
+			if ttl := metric.GetTTL(); ttl > 0 {
+				next = ttl / 2
+			}
+		}
+		timer.Reset(next)
+	}
+}
+
+// pushMetricToAll sends a metric to every cluster peer.
+func (c *Cluster) pushMetricToAll(metric api.Metric) {
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	errs := c.broadcaster.Broadcast(peers,
+		"Cluster",
+		"PeerMonitorLogMetric",
+		metric,
+		copyEmptyStructToIfaces(make([]struct{}, len(peers), len(peers))))
+	for i, e := range errs {
+		if e != nil {
+			logger.Debugf("error pushing metric %s to %s: %s", metric.Name, peers[i].Pretty(), e)
+		}
+	}
+}
+
 // read the alerts channel from the monitor and triggers repins
 func (c *Cluster) alertsHandler() {
 	for {
@@ -323,21 +496,35 @@ func (c *Cluster) alertsHandler() {
 		case <-c.ctx.Done():
 			return
 		case alrt := <-c.monitor.Alerts():
+			c.eventLog.add(api.Event{
+				Type:       api.EventAlert,
+				Peer:       alrt.Peer,
+				MetricName: alrt.MetricName,
+			})
 			// only the leader handles alerts
 			leader, err := c.consensus.Leader()
 			if err == nil && leader == c.id {
 				logger.Warningf("Peer %s received alert for %s in %s", c.id, alrt.MetricName, alrt.Peer.Pretty())
 				switch alrt.MetricName {
 				case "ping":
-					c.repinFromPeer(alrt.Peer)
+					if !c.isMember(alrt.Peer) {
+						logger.Infof("%s is no longer a cluster peer. Ignoring alert", alrt.Peer.Pretty())
+						continue
+					}
+					if c.inMaintenance(alrt.Peer) {
+						logger.Infof("%s is in maintenance mode. Not re-pinning its content", alrt.Peer.Pretty())
+						continue
+					}
+					go c.repinFromPeer(alrt.Peer)
 				}
 			}
 		}
 	}
 }
 
-// detects any changes in the peerset and saves the configuration. When it
-// detects that we have been removed from the peerset, it shuts down this peer.
+// detects any changes in the peerset, saves the configuration and
+// reconciles the pins which should be pinned everywhere. When it detects
+// that we have been removed from the peerset, it shuts down this peer.
 func (c *Cluster) watchPeers() {
 	// TODO: Config option?
 	ticker := time.NewTicker(5 * time.Second)
@@ -363,16 +550,18 @@ func (c *Cluster) watchPeers() {
 				}
 			}
 
-			if len(peers) != len(lastPeers) {
+			added, removed := diffPeers(lastPeers, peers)
+			if len(added) != 0 || len(removed) != 0 {
 				save = true
-			} else {
-				added, removed := diffPeers(lastPeers, peers)
-				if len(added) != 0 || len(removed) != 0 {
-					save = true
-				}
 			}
 
 			lastPeers = peers
+			for _, p := range added {
+				c.eventLog.add(api.Event{Type: api.EventPeerJoined, Peer: p})
+			}
+			for _, p := range removed {
+				c.eventLog.add(api.Event{Type: api.EventPeerLeft, Peer: p})
+			}
 
 			if !hasMe {
 				logger.Infof("%s: removed from raft. Initiating shutdown", c.id.Pretty())
@@ -386,51 +575,168 @@ func (c *Cluster) watchPeers() {
 			if save {
 				logger.Info("peerset change detected")
 				c.config.savePeers(c.peerManager.addresses(peers))
+				c.reconcileEverywherePins(added, removed)
 			}
 		}
 	}
 }
 
+// reconcileEverywherePins makes sure that this peer tracks every pin with
+// a replication factor of -1 after a peerset change. Peers which just
+// joined pick them up without waiting for the next StateSync. Pins
+// everywhere carry no allocations, so departed peers need no re-pinning.
+func (c *Cluster) reconcileEverywherePins(added, removed []peer.ID) {
+	if len(removed) > 0 {
+		logger.Infof("peers left the cluster: %s. Pins everywhere need no re-allocation", removed)
+	}
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	n := 0
+	statuses := c.trackerStatuses()
+	for _, pin := range cState.List() {
+		if pin.ReplicationFactor >= 0 {
+			continue
+		}
+		if st, ok := statuses[pin.Cid.String()]; !ok || st == api.TrackerStatusUnpinned {
+			n++
+			go c.tracker.TrackInBackground(c.trackedPin(pin))
+		}
+	}
+	if n > 0 {
+		logger.Infof("peerset changed (added: %s): tracking %d pins everywhere", added, n)
+	}
+}
+
+// isMember returns true when the given peer is part of the current
+// peerset. If the peerset cannot be obtained, it assumes it is.
+func (c *Cluster) isMember(p peer.ID) bool {
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		logger.Warning(err)
+		return true
+	}
+	return containsPeer(peers, p)
+}
+
+// inMaintenance returns true when the given peer is flagged as in
+// maintenance mode in the shared state.
+func (c *Cluster) inMaintenance(p peer.ID) bool {
+	peers, err := c.MaintenancePeers()
+	if err != nil {
+		logger.Warning(err)
+		return false
+	}
+	return containsPeer(peers, p)
+}
+
 // find all Cids pinned to a given peer and triggers re-pins on them.
+// Repins are throttled by the repin scheduler. It returns when all
+// of them have finished.
 func (c *Cluster) repinFromPeer(p peer.ID) {
 	cState, err := c.consensus.State()
 	if err != nil {
 		logger.Warning(err)
 		return
 	}
-	list := cState.List()
-	for _, pin := range list {
+	var list []api.Pin
+	for _, pin := range cState.List() {
 		if containsPeer(pin.Allocations, p) {
-			logger.Infof("repinning %s out of %s", pin.Cid, p.Pretty())
-			c.pin(pin, []peer.ID{p}) // pin blacklisting this peer
+			list = append(list, pin)
 		}
 	}
+	c.peerRemovals.update(p, func(pr *api.PeerRemoval) {
+		pr.Total = len(list)
+	})
+
+	var wg sync.WaitGroup
+	for _, pin := range list {
+		wg.Add(1)
+		go func(pin api.Pin) {
+			defer wg.Done()
+			logger.Infof("repinning %s out of %s", pin.Cid, p.Pretty())
+			// pin blacklisting this peer
+			err := c.repinner.Repin(pin, []peer.ID{p})
+			if err != nil {
+				logger.Errorf("error repinning %s out of %s: %s", pin.Cid, p.Pretty(), err)
+			}
+			c.peerRemovals.update(p, func(pr *api.PeerRemoval) {
+				if err != nil {
+					pr.Failed++
+					return
+				}
+				pr.Reallocated++
+			})
+		}(pin)
+	}
+	wg.Wait()
 }
 
 // run launches some go-routines which live throughout the cluster's life
 func (c *Cluster) run() {
-	go c.syncWatcher()
+	go c.stateSyncLoop.run(c.ctx)
+	go c.ipfsSyncLoop.run(c.ctx)
 	go c.pushPingMetrics()
+	// Peers without informer metrics are never allocation candidates.
+	if !c.pinningEnabled() {
+		logger.Info("pinning is disabled: this peer will not be allocated any content")
+	}
 	go c.pushInformerMetrics()
 	go c.watchPeers()
 	go c.alertsHandler()
+	for _, f := range c.followers {
+		go f.run(c.ctx)
+	}
 }
 
+// QuorumRetryInterval is how often a peer which starts with a persisted
+// peerset tries to reconnect to those peers while it waits for the
+// consensus to become ready.
+var QuorumRetryInterval = 5 * time.Second
+
 func (c *Cluster) ready() {
 	// We bootstrapped first because with dirty state consensus
 	// may have a peerset and not find a leader so we cannot wait
 	// for it.
-	timer := time.NewTimer(30 * time.Second)
-	select {
-	case <-timer.C:
-		logger.Error("consensus start timed out")
-		c.Shutdown()
-		return
-	case <-c.consensus.Ready():
-	case <-c.ctx.Done():
-		return
+	var timeout, retry <-chan time.Time
+
+	// When the whole cluster is restarted (i.e. after a power
+	// failure), peers come back at different times. Those with a
+	// persisted peerset keep dialing it until there is quorum again.
+	if len(c.config.Peers) > 0 {
+		if c.config.QuorumWaitTimeout > 0 {
+			timeout = time.After(c.config.QuorumWaitTimeout)
+		}
+		ticker := time.NewTicker(QuorumRetryInterval)
+		defer ticker.Stop()
+		retry = ticker.C
+	} else {
+		timeout = time.After(30 * time.Second)
+	}
+
+wait:
+	for {
+		select {
+		case <-timeout:
+			logger.Error("consensus start timed out")
+			c.Shutdown()
+			return
+		case <-retry:
+			c.reconnectPeers()
+		case <-c.consensus.Ready():
+			break wait
+		case <-c.ctx.Done():
+			return
+		}
 	}
 
+	c.quorumMux.Lock()
+	c.quorumErr = nil
+	c.quorumMux.Unlock()
+
 	// Cluster is ready.
 	peers, err := c.consensus.Peers()
 	if err != nil {
@@ -453,70 +759,580 @@ func (c *Cluster) ready() {
 	logger.Info("** IPFS Cluster is READY **")
 }
 
-func (c *Cluster) bootstrap() bool {
-	// Cases in which we do not bootstrap
-	if len(c.config.Bootstrap) == 0 || len(c.config.Peers) > 0 {
-		return true
+// reconnectPeers dials the peers in the persisted peerset, forgetting
+// about previous failed dials, and records how many of them are
+// reachable.
+func (c *Cluster) reconnectPeers() {
+	peers := peersFromMultiaddrs(c.config.Peers)
+	total, reachable := 1, 1 // ourselves
+	for _, p := range peers {
+		if p == c.id {
+			continue
+		}
+		total++
+		if snet, ok := c.host.Network().(*swarm.Network); ok {
+			snet.Swarm().Backoff().Clear(p)
+		}
+		ctx, cancel := context.WithTimeout(c.ctx, QuorumRetryInterval)
+		err := c.host.Connect(ctx, peerstore.PeerInfo{
+			ID:    p,
+			Addrs: c.host.Peerstore().Addrs(p),
+		})
+		cancel()
+		if err != nil {
+			logger.Debugf("cannot reach %s: %s", p.Pretty(), err)
+			continue
+		}
+		reachable++
 	}
 
-	for _, b := range c.config.Bootstrap {
-		logger.Infof("Bootstrapping to %s", b)
-		err := c.Join(b)
+	err := fmt.Errorf("%d of %d peers reachable", reachable, total)
+	logger.Warningf("waiting for quorum: %s", err)
+	c.quorumMux.Lock()
+	c.quorumErr = err
+	c.quorumMux.Unlock()
+}
+
+// IPFSRetryMinDelay and IPFSRetryMaxDelay bound the time a peer waits
+// between attempts to reach an unavailable IPFS daemon at startup. The
+// delay doubles after every failed attempt.
+var (
+	IPFSRetryMinDelay = 1 * time.Second
+	IPFSRetryMaxDelay = 1 * time.Minute
+)
+
+// waitForIPFS checks that the IPFS daemon is reachable, retrying with an
+// increasing delay until it is. Peers can thus be started before their
+// IPFS daemon, which they report by being in the "waiting_for_ipfs"
+// health state. When the daemon appears after having been unreachable,
+// the peer connects it to the other daemons and recovers the pins which
+// failed in the meantime.
+func (c *Cluster) waitForIPFS() {
+	delay := IPFSRetryMinDelay
+	waited := false
+	for {
+		_, err := c.ipfs.ID()
+		c.ipfsMux.Lock()
+		c.ipfsReady = err == nil
+		c.ipfsErr = err
+		c.ipfsMux.Unlock()
 		if err == nil {
-			return true
+			break
+		}
+
+		if !waited {
+			logger.Warningf("waiting for IPFS: %s", err)
+		}
+		logger.Debugf("IPFS not available, retrying in %s: %s", delay, err)
+		waited = true
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > IPFSRetryMaxDelay {
+			delay = IPFSRetryMaxDelay
 		}
-		logger.Error(err)
 	}
 
-	return false
+	if !waited {
+		return
+	}
+	logger.Info("IPFS daemon is now available")
+
+	select {
+	case <-c.ctx.Done():
+		return
+	case <-c.readyCh:
+	}
+	c.ipfs.ConnectSwarms()
+	c.recoverInBackground(c.tracker.StatusAll(), false)
 }
 
-// Ready returns a channel which signals when this peer is
-// fully initialized (including consensus).
-func (c *Cluster) Ready() <-chan struct{} {
-	return c.readyCh
+// Health returns the health state of this peer.
+func (c *Cluster) Health() api.Health {
+	h := api.Health{
+		Peer:   c.id,
+		Status: api.PeerHealthOK,
+	}
+
+	c.ipfsMux.RLock()
+	ipfsReady, ipfsErr := c.ipfsReady, c.ipfsErr
+	c.ipfsMux.RUnlock()
+
+	c.quorumMux.RLock()
+	quorumErr := c.quorumErr
+	c.quorumMux.RUnlock()
+
+	switch {
+	case !c.readyB && quorumErr != nil:
+		h.Status = api.PeerHealthWaitingForQuorum
+		h.Error = quorumErr.Error()
+	case !c.readyB:
+		h.Status = api.PeerHealthStarting
+	case !ipfsReady:
+		h.Status = api.PeerHealthWaitingForIPFS
+		if ipfsErr != nil {
+			h.Error = ipfsErr.Error()
+		}
+	}
+	return h
 }
 
-// Shutdown stops the IPFS cluster components
-func (c *Cluster) Shutdown() error {
-	c.shutdownLock.Lock()
-	defer c.shutdownLock.Unlock()
+// SyncStatus returns the state of the periodic sync loops of this peer
+// and the outcome of their last runs.
+func (c *Cluster) SyncStatus() api.SyncStatus {
+	return api.SyncStatus{
+		Peer:  c.id,
+		State: c.stateSyncLoop.info(),
+		IPFS:  c.ipfsSyncLoop.info(),
+	}
+}
 
-	if c.shutdownB {
-		logger.Debug("Cluster is already shutdown")
-		return nil
+// ConsensusStatus returns the internals of the consensus component
+// of this peer.
+func (c *Cluster) ConsensusStatus() api.ConsensusStatus {
+	return c.consensus.Status()
+}
+
+// ConsensusStatusAll returns the ConsensusStatus of every cluster peer.
+// The Lag of each peer is the number of entries it has not applied yet
+// with respect to the highest commit index reported, which is usually
+// the leader's. Peers which cannot be contacted are reported with an
+// error.
+func (c *Cluster) ConsensusStatusAll() ([]api.ConsensusStatus, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
 	}
 
-	logger.Info("shutting down Cluster")
+	serials := make([]api.ConsensusStatusSerial, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members, "Cluster", "ConsensusStatus", struct{}{},
+		copyConsensusStatusSerialsToIfaces(serials))
 
-	// Only attempt to leave if:
-	// - consensus is initialized
-	// - cluster was ready (no bootstrapping error)
-	// - We are not removed already (means watchPeers() called uss)
-	if c.consensus != nil && c.config.LeaveOnShutdown && c.readyB && !c.removed {
-		c.removed = true
-		peers, err := c.consensus.Peers()
-		if err == nil {
-			// best effort
-			logger.Warning("attempting to leave the cluster. This may take some seconds")
-			err := c.consensus.RmPeer(c.id)
-			if err != nil {
-				logger.Error("leaving cluster: " + err.Error())
+	statuses := make([]api.ConsensusStatus, len(members), len(members))
+	var maxCommit uint64
+	for i, s := range serials {
+		if errs[i] != nil {
+			statuses[i] = api.ConsensusStatus{
+				Peer:  members[i],
+				Error: errs[i].Error(),
 			}
-			// save peers as bootstrappers
-			c.config.Bootstrap = c.peerManager.addresses(peers)
-			c.config.savePeers([]ma.Multiaddr{})
+			continue
+		}
+		statuses[i] = s.ToConsensusStatus()
+		if statuses[i].CommitIndex > maxCommit {
+			maxCommit = statuses[i].CommitIndex
 		}
 	}
 
-	if con := c.consensus; con != nil {
-		if err := con.Shutdown(); err != nil {
-			logger.Errorf("error stopping consensus: %s", err)
-			return err
+	for i := range statuses {
+		if errs[i] == nil && statuses[i].AppliedIndex < maxCommit {
+			statuses[i].Lag = maxCommit - statuses[i].AppliedIndex
 		}
 	}
+	return statuses, nil
+}
 
-	// Do not save anything if we were not ready
+// StateChecksum returns the checksum of the shared state of this peer.
+func (c *Cluster) StateChecksum() (api.StateChecksum, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return api.StateChecksum{}, err
+	}
+	root, buckets, err := state.Checksum(cState)
+	if err != nil {
+		logger.Error(err)
+		return api.StateChecksum{}, err
+	}
+	return api.StateChecksum{
+		Peer:    c.id,
+		Pins:    len(cState.List()),
+		Root:    root,
+		Buckets: buckets,
+	}, nil
+}
+
+// StateBucket returns the pins of the shared state of this peer which
+// fall in the given checksum bucket.
+func (c *Cluster) StateBucket(bucket int) ([]api.Pin, error) {
+	if bucket < 0 || bucket >= state.ChecksumBuckets {
+		return nil, errors.New("invalid checksum bucket")
+	}
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	return state.BucketPins(cState, bucket), nil
+}
+
+// StateVerify compares the shared state of every cluster peer with the
+// one of the leader and returns how each of them differs. Only the pins
+// in the buckets whose checksums differ are fetched to find out which
+// items diverge.
+func (c *Cluster) StateVerify() ([]api.StateDiff, error) {
+	leader, err := c.consensus.Leader()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	serials := make([]api.StateChecksumSerial, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members, "Cluster", "StateChecksum", struct{}{},
+		copyStateChecksumSerialsToIfaces(serials))
+
+	var leaderSum *api.StateChecksum
+	for i, p := range members {
+		if p != leader {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, fmt.Errorf("error getting the state checksum of the leader: %s", errs[i])
+		}
+		sum := serials[i].ToStateChecksum()
+		leaderSum = &sum
+	}
+	if leaderSum == nil {
+		return nil, errors.New("the leader is not among the cluster peers")
+	}
+
+	// leader pins by bucket, fetched once for all the peers
+	leaderBuckets := make(map[int]map[string]api.Pin)
+
+	diffs := make([]api.StateDiff, len(members), len(members))
+	for i, p := range members {
+		diffs[i] = api.StateDiff{
+			Peer:       p,
+			LeaderRoot: leaderSum.Root,
+		}
+		if errs[i] != nil {
+			diffs[i].Error = errs[i].Error()
+			continue
+		}
+		sum := serials[i].ToStateChecksum()
+		diffs[i].Root = sum.Root
+		if p == leader || sum.Root == leaderSum.Root {
+			continue
+		}
+		err := c.diffStates(&diffs[i], sum, *leaderSum, leaderBuckets)
+		if err != nil {
+			diffs[i].Error = err.Error()
+		}
+	}
+	return diffs, nil
+}
+
+// diffStates fills in the items which differ between a peer's state and
+// the leader's by comparing the pins in their differing buckets.
+func (c *Cluster) diffStates(diff *api.StateDiff, sum, leaderSum api.StateChecksum, leaderBuckets map[int]map[string]api.Pin) error {
+	if len(sum.Buckets) != len(leaderSum.Buckets) {
+		return errors.New("the number of checksum buckets does not match the leader's")
+	}
+
+	for b := range sum.Buckets {
+		if sum.Buckets[b] == leaderSum.Buckets[b] {
+			continue
+		}
+		leaderPins, ok := leaderBuckets[b]
+		if !ok {
+			var err error
+			leaderPins, err = c.bucketPins(leaderSum.Peer, b)
+			if err != nil {
+				return err
+			}
+			leaderBuckets[b] = leaderPins
+		}
+		peerPins, err := c.bucketPins(sum.Peer, b)
+		if err != nil {
+			return err
+		}
+
+		for k, pin := range leaderPins {
+			peerPin, ok := peerPins[k]
+			switch {
+			case !ok:
+				diff.Missing = append(diff.Missing, pin.Cid)
+			case !samePin(pin, peerPin):
+				diff.Different = append(diff.Different, pin.Cid)
+			}
+		}
+		for k, pin := range peerPins {
+			if _, ok := leaderPins[k]; !ok {
+				diff.Extra = append(diff.Extra, pin.Cid)
+			}
+		}
+	}
+	return nil
+}
+
+// bucketPins fetches the pins of a peer in a checksum bucket, by Cid.
+func (c *Cluster) bucketPins(p peer.ID, bucket int) (map[string]api.Pin, error) {
+	var serials []api.PinSerial
+	err := c.rpcClient.Call(p, "Cluster", "StateBucket", bucket, &serials)
+	if err != nil {
+		return nil, err
+	}
+	pins := make(map[string]api.Pin, len(serials))
+	for _, s := range serials {
+		pin := s.ToPin()
+		pins[pin.Cid.String()] = pin
+	}
+	return pins, nil
+}
+
+// samePin returns true when both pins have the same options, as
+// considered by the state checksum.
+func samePin(a, b api.Pin) bool {
+	aj, err := json.Marshal(a.ToSerial())
+	if err != nil {
+		return false
+	}
+	bj, err := json.Marshal(b.ToSerial())
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aj, bj)
+}
+
+// PublicStatus returns aggregate figures about the cluster: the number of
+// peers and how many of them are healthy, the number of pins and the sum
+// of the IPFS repository sizes of the peers. Peers which cannot be
+// contacted count as unhealthy and do not add to the total size.
+func (c *Cluster) PublicStatus() (api.PublicStatus, error) {
+	status := api.PublicStatus{
+		Health: c.Health().Status,
+	}
+
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return status, err
+	}
+	status.Peers = len(members)
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return status, err
+	}
+	status.Pins = len(cState.List())
+
+	healths := make([]api.HealthSerial, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members, "Cluster", "Health", struct{}{},
+		copyHealthSerialsToIfaces(healths))
+	for i, h := range healths {
+		if errs[i] == nil && h.Status == string(api.PeerHealthOK) {
+			status.HealthyPeers++
+		}
+	}
+
+	sizes := make([]uint64, len(members), len(members))
+	errs = c.broadcaster.Broadcast(members, "Cluster", "IPFSRepoSize", struct{}{},
+		copyUint64ToIfaces(sizes))
+	for i, size := range sizes {
+		if errs[i] != nil {
+			logger.Debugf("public status: no repo size from %s: %s", members[i].Pretty(), errs[i])
+			continue
+		}
+		status.TotalSize += size
+	}
+	return status, nil
+}
+
+func (c *Cluster) bootstrap() bool {
+	// Cases in which we do not bootstrap
+	if len(c.config.Bootstrap) == 0 || len(c.config.Peers) > 0 {
+		return true
+	}
+
+	for _, b := range c.config.Bootstrap {
+		logger.Infof("Bootstrapping to %s", b)
+		err := c.Join(b)
+		if err == nil {
+			return true
+		}
+		logger.Error(err)
+	}
+
+	return false
+}
+
+// AddAllocationFilter appends an AllocationFilter to the chain of filters
+// which are run on the candidate peers before calling the PinAllocator.
+// Filters run in the order they were added, after the ones enabled in
+// cluster.allocation_filters.
+func (c *Cluster) AddAllocationFilter(f AllocationFilter) {
+	c.allocFiltersMux.Lock()
+	defer c.allocFiltersMux.Unlock()
+	c.allocFilters = append(c.allocFilters, f)
+}
+
+// AddInformer adds an Informer whose metrics are sent to every cluster
+// peer, besides the one of the allocation strategy. It provides the
+// metrics used by allocation filters (i.e. "pinqueue" or "tags"). Added
+// informers cannot be removed, but they can be disabled at runtime with
+// the cluster.disabled_informers option.
+func (c *Cluster) AddInformer(informer Informer) {
+	informer.SetClient(c.rpcClient)
+	go c.pushExtraInformerMetrics(informer)
+}
+
+// AllocationStrategyBuilder creates the Informer and the PinAllocator for
+// the allocation strategy with the given name.
+type AllocationStrategyBuilder func(name string) (Informer, PinAllocator, error)
+
+// SetAllocationStrategyBuilder sets the function used by
+// SetAllocationStrategy to create the components for an allocation
+// strategy.
+func (c *Cluster) SetAllocationStrategyBuilder(b AllocationStrategyBuilder) {
+	c.allocMux.Lock()
+	defer c.allocMux.Unlock()
+	c.allocBuilder = b
+}
+
+// SetAllocationStrategy replaces the Informer and the PinAllocator used by
+// this peer with those of the given allocation strategy, without
+// restarting. The new informer starts sending metrics right away. The
+// strategy is saved as the AllocationStrategy of the configuration, so
+// it is used after restarting too. It should be the same in all peers,
+// since allocations use the metrics sent by every peer: see
+// SetAllocationStrategyAllPeers.
+func (c *Cluster) SetAllocationStrategy(name string) error {
+	c.allocMux.RLock()
+	builder := c.allocBuilder
+	c.allocMux.RUnlock()
+	if builder == nil {
+		return errors.New("this peer does not support changing the allocation strategy")
+	}
+
+	informer, allocator, err := builder(name)
+	if err != nil {
+		return err
+	}
+	informer.SetClient(c.rpcClient)
+	allocator.SetClient(c.rpcClient)
+
+	c.allocMux.Lock()
+	oldInformer, oldAllocator := c.informer, c.allocator
+	c.informer, c.allocator = informer, allocator
+	c.allocMux.Unlock()
+
+	c.config.lock.Lock()
+	c.config.AllocationStrategy = name
+	c.config.lock.Unlock()
+	c.config.NotifySave()
+
+	logger.Infof("allocation strategy set to %s", name)
+	select {
+	case c.informerSwapped <- struct{}{}:
+	default:
+	}
+
+	if err := oldInformer.Shutdown(); err != nil {
+		logger.Errorf("error stopping previous informer: %s", err)
+	}
+	if err := oldAllocator.Shutdown(); err != nil {
+		logger.Errorf("error stopping previous allocator: %s", err)
+	}
+	return nil
+}
+
+// SetAllocationStrategyAllPeers runs SetAllocationStrategy in every cluster
+// peer. It returns an error listing the peers which failed to apply the
+// change, if any.
+func (c *Cluster) SetAllocationStrategyAllPeers(name string) error {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	replies := make([]struct{}, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members,
+		"Cluster",
+		"SetAllocationStrategy",
+		api.AllocationStrategy{Name: name},
+		copyEmptyStructToIfaces(replies))
+
+	for i, e := range errs {
+		if e != nil {
+			logger.Errorf("%s: error setting allocation strategy in %s: %s", c.id, members[i], e)
+		}
+	}
+	if err := NewBroadcastError(members, errs); err != nil {
+		return fmt.Errorf("could not set the allocation strategy in some peers: %s", err)
+	}
+	return nil
+}
+
+func (c *Cluster) getInformer() Informer {
+	c.allocMux.RLock()
+	defer c.allocMux.RUnlock()
+	return c.informer
+}
+
+func (c *Cluster) getAllocator() PinAllocator {
+	c.allocMux.RLock()
+	defer c.allocMux.RUnlock()
+	return c.allocator
+}
+
+// Ready returns a channel which signals when this peer is
+// fully initialized (including consensus).
+func (c *Cluster) Ready() <-chan struct{} {
+	return c.readyCh
+}
+
+// Shutdown stops the IPFS cluster components
+func (c *Cluster) Shutdown() error {
+	c.shutdownLock.Lock()
+	defer c.shutdownLock.Unlock()
+
+	if c.shutdownB {
+		logger.Debug("Cluster is already shutdown")
+		return nil
+	}
+
+	logger.Info("shutting down Cluster")
+
+	// Only attempt to leave if:
+	// - consensus is initialized
+	// - cluster was ready (no bootstrapping error)
+	// - We are not removed already (means watchPeers() called uss)
+	if c.consensus != nil && c.config.LeaveOnShutdown && c.readyB && !c.removed {
+		c.removed = true
+		peers, err := c.consensus.Peers()
+		if err == nil {
+			// best effort
+			logger.Warning("attempting to leave the cluster. This may take some seconds")
+			err := c.consensus.RmPeer(c.id)
+			if err != nil {
+				logger.Error("leaving cluster: " + err.Error())
+			}
+			// save peers as bootstrappers
+			c.config.Bootstrap = c.peerManager.addresses(peers)
+			c.config.savePeers([]ma.Multiaddr{})
+		}
+	}
+
+	if con := c.consensus; con != nil {
+		if err := con.Shutdown(); err != nil {
+			logger.Errorf("error stopping consensus: %s", err)
+			return err
+		}
+	}
+
+	// Do not save anything if we were not ready
 	// if c.readyB {
 	// 	// peers are saved usually on addPeer/rmPeer
 	// 	// c.peerManager.savePeers()
@@ -536,9 +1352,11 @@ func (c *Cluster) Shutdown() error {
 		return err
 	}
 
-	if err := c.api.Shutdown(); err != nil {
-		logger.Errorf("error stopping API: %s", err)
-		return err
+	for _, api := range c.apis {
+		if err := api.Shutdown(); err != nil {
+			logger.Errorf("error stopping API: %s", err)
+			return err
+		}
 	}
 	if err := c.ipfs.Shutdown(); err != nil {
 		logger.Errorf("error stopping IPFS Connector: %s", err)
@@ -555,6 +1373,11 @@ func (c *Cluster) Shutdown() error {
 	c.cancel()
 	c.host.Close() // Shutdown all network services
 	c.wg.Wait()
+	if c.pinLog != nil {
+		if err := c.pinLog.close(); err != nil {
+			logger.Errorf("error closing the pin log: %s", err)
+		}
+	}
 	c.shutdownB = true
 	close(c.doneCh)
 	return nil
@@ -599,7 +1422,37 @@ func (c *Cluster) ID() api.ID {
 		RPCProtocolVersion:    RPCProtocol,
 		IPFS:                  ipfsID,
 		Peername:              c.config.Peername,
+		PinningEnabled:        c.pinningEnabled(),
+		Health:                c.Health().Status,
+	}
+}
+
+// trackerStatuses returns the status of every item known to the tracker,
+// indexed by Cid. Items missing from the map are unpinned. A single
+// StatusAll call is much cheaper than calling Status for every pin with
+// trackers which do not keep the status in memory.
+func (c *Cluster) trackerStatuses() map[string]api.TrackerStatus {
+	return pinInfosToStatuses(c.tracker.StatusAll())
+}
+
+func pinInfosToStatuses(infos []api.PinInfo) map[string]api.TrackerStatus {
+	statuses := make(map[string]api.TrackerStatus, len(infos))
+	for _, info := range infos {
+		statuses[info.Cid.String()] = info.Status
 	}
+	return statuses
+}
+
+// trackedPin returns the pin as it should be handed to the tracker.
+// Peers with pinning disabled never pin anything, so for them every
+// pin is remote, including those which are pinned everywhere.
+func (c *Cluster) trackedPin(pin api.Pin) api.Pin {
+	if c.pinningEnabled() {
+		return pin
+	}
+	pin.ReplicationFactor = 0
+	pin.Allocations = nil
+	return pin
 }
 
 // PeerAdd adds a new peer to this Cluster.
@@ -633,19 +1486,13 @@ func (c *Cluster) PeerAdd(addr ma.Multiaddr) (api.ID, error) {
 		return api.ID{Error: err.Error()}, err
 	}
 
-	errs := c.multiRPC(peers, "Cluster",
+	errs := c.broadcaster.Broadcast(peers, "Cluster",
 		"PeerManagerAddPeer",
 		api.MultiaddrToSerial(remoteAddr),
 		copyEmptyStructToIfaces(make([]struct{}, len(peers), len(peers))))
 
-	brk := false
-	for i, e := range errs {
-		if e != nil {
-			brk = true
-			logger.Errorf("%s: %s", peers[i].Pretty(), e)
-		}
-	}
-	if brk {
+	if bErr := NewBroadcastError(peers, errs); bErr != nil {
+		logger.Error(bErr)
 		msg := "error broadcasting new peer's address: all cluster members need to be healthy for this operation to succeed. Try removing any unhealthy peers. Check the logs for more information about the error."
 		logger.Error(msg)
 		id := api.ID{ID: pid, Error: "error broadcasting new peer's address"}
@@ -675,8 +1522,22 @@ func (c *Cluster) PeerAdd(addr ma.Multiaddr) (api.ID, error) {
 		logger.Error(err)
 	}
 
+	// Peers may ask to be added as non-voting members, so that
+	// they do not affect the quorum.
+	voter := true
+	err = c.rpcClient.Call(pid, "Cluster", "ConsensusVoter", struct{}{}, &voter)
+	if err != nil {
+		logger.Warningf("could not find if %s is a voter. Assuming it is: %s", pid.Pretty(), err)
+		voter = true
+	}
+
 	// Log the new peer in the log so everyone gets it.
-	err = c.consensus.AddPeer(pid)
+	if voter {
+		err = c.consensus.AddPeer(pid)
+	} else {
+		logger.Infof("adding %s as a non-voting peer", pid.Pretty())
+		err = c.consensus.AddNonVoter(pid)
+	}
 	if err != nil {
 		logger.Error(err)
 		id := api.ID{ID: pid, Error: err.Error()}
@@ -721,21 +1582,82 @@ func (c *Cluster) PeerAdd(addr ma.Multiaddr) (api.ID, error) {
 //
 // The peer will be removed from the consensus peerset, all it's content
 // will be re-pinned and the peer it will shut itself down.
+//
+// When removing another peer (i.e. one which is down), it is first
+// removed from the consensus configuration. Then, once the remaining
+// peers have a quorum again, its content is re-allocated. The progress
+// can be followed with PeerRemoval.
 func (c *Cluster) PeerRemove(pid peer.ID) error {
-	// We need to repin before removing the peer, otherwise, it won't
-	// be able to submit the pins.
-	logger.Infof("re-allocating all CIDs directly associated to %s", pid)
-	c.repinFromPeer(pid)
+	c.peerRemovals.start(pid)
+	err := c.peerRemove(pid)
+	if err != nil {
+		logger.Error(err)
+	}
+	c.peerRemovals.finish(pid, err)
+	return err
+}
+
+func (c *Cluster) peerRemove(pid peer.ID) error {
+	if pid == c.id {
+		// We need to repin before removing ourselves, otherwise,
+		// we won't be able to submit the pins.
+		c.peerRemovals.setPhase(pid, api.PeerRemovalReallocating)
+		logger.Infof("re-allocating all CIDs directly associated to %s", pid)
+		c.repinFromPeer(pid)
+
+		c.peerRemovals.setPhase(pid, api.PeerRemovalRemoving)
+		return c.consensus.RmPeer(pid)
+	}
 
 	err := c.consensus.RmPeer(pid)
 	if err != nil {
-		logger.Error(err)
 		return err
 	}
 
+	c.peerRemovals.setPhase(pid, api.PeerRemovalWaitingQuorum)
+	logger.Infof("waiting for consensus after removing %s", pid)
+	err = c.consensus.WaitForSync()
+	if err != nil {
+		return err
+	}
+
+	c.peerRemovals.setPhase(pid, api.PeerRemovalReallocating)
+	logger.Infof("re-allocating all CIDs directly associated to %s", pid)
+	c.repinFromPeer(pid)
 	return nil
 }
 
+// PeerRemoval returns the progress of the last removal of the given peer
+// started by this Cluster peer.
+func (c *Cluster) PeerRemoval(pid peer.ID) (api.PeerRemoval, error) {
+	pr, ok := c.peerRemovals.get(pid)
+	if !ok {
+		return pr, fmt.Errorf("%s has not been removed by this peer", pid.Pretty())
+	}
+	return pr, nil
+}
+
+// PeerMaintenance sets or unsets the maintenance mode for a peer. Peers in
+// maintenance mode are not given new allocations, but their current
+// allocations are kept and they are not re-pinned elsewhere when the peer
+// goes down. The flag is stored in the shared state.
+func (c *Cluster) PeerMaintenance(pid peer.ID, enabled bool) error {
+	logger.Infof("setting maintenance mode for %s: %t", pid.Pretty(), enabled)
+	return c.consensus.LogMaintenance(api.PeerMaintenance{
+		Peer:    pid,
+		Enabled: enabled,
+	})
+}
+
+// MaintenancePeers returns the peers which are in maintenance mode.
+func (c *Cluster) MaintenancePeers() ([]peer.ID, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		return nil, err
+	}
+	return cState.MaintenancePeers(), nil
+}
+
 // Join adds this peer to an existing cluster. The calling peer should
 // be a single-peer cluster node. This is almost equivalent to calling
 // PeerAdd on the destination cluster.
@@ -810,21 +1732,23 @@ func (c *Cluster) StateSync() ([]api.PinInfo, error) {
 
 	logger.Debug("syncing state to tracker")
 	clusterPins := cState.List()
+	trackerPins := c.tracker.StatusAll()
+	statuses := pinInfosToStatuses(trackerPins)
 	var changed []*cid.Cid
 
 	// Track items which are not tracked
 	for _, pin := range clusterPins {
-		if c.tracker.Status(pin.Cid).Status == api.TrackerStatusUnpinned {
+		if st, ok := statuses[pin.Cid.String()]; !ok || st == api.TrackerStatusUnpinned {
 			changed = append(changed, pin.Cid)
-			go c.tracker.Track(pin)
+			go c.tracker.TrackInBackground(c.trackedPin(pin))
 		}
 	}
 
 	// Untrack items which should not be tracked
-	for _, p := range c.tracker.StatusAll() {
+	for _, p := range trackerPins {
 		if !cState.Has(p.Cid) {
 			changed = append(changed, p.Cid)
-			go c.tracker.Untrack(p.Cid)
+			go c.tracker.UntrackInBackground(p.Cid)
 		}
 	}
 
@@ -837,21 +1761,213 @@ func (c *Cluster) StateSync() ([]api.PinInfo, error) {
 
 // StatusAll returns the GlobalPinInfo for all tracked Cids in all peers.
 // If an error happens, the slice will contain as much information as
-// could be fetched from other peers.
-func (c *Cluster) StatusAll() ([]api.GlobalPinInfo, error) {
-	return c.globalPinInfoSlice("TrackerStatusAll")
-}
+// could be fetched from other peers. Peers only report the items whose
+// status matches the filter. The status reported by other peers may come
+// from the status cache.
+func (c *Cluster) StatusAll(filter api.StatusFilter) ([]api.GlobalPinInfo, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return []api.GlobalPinInfo{}, err
+	}
+
+	replies := make([][]api.PinInfoSerial, len(members), len(members))
+	errs := make([]error, len(members), len(members))
+	var ask []peer.ID
+	var askIdx []int
+	for i, p := range members {
+		if p != c.id {
+			if r, ok := c.statusCache.getAll(filter, p); ok {
+				replies[i] = r
+				continue
+			}
+		}
+		ask = append(ask, p)
+		askIdx = append(askIdx, i)
+	}
+
+	askReplies := make([][]api.PinInfoSerial, len(ask), len(ask))
+	askErrs := c.broadcaster.Broadcast(ask,
+		"Cluster",
+		"TrackerStatusAll", filter,
+		copyPinInfoSerialSliceToIfaces(askReplies))
+	for j, i := range askIdx {
+		replies[i] = askReplies[j]
+		errs[i] = askErrs[j]
+		if errs[i] == nil && members[i] != c.id {
+			c.statusCache.putAll(filter, members[i], replies[i])
+		}
+	}
+
+	return c.mergePinInfoSlices(members, replies, errs), nil
+}
+
+// StatusAllLocal returns the PinInfo for all the tracked Cids in this peer
+// whose status matches the filter.
+func (c *Cluster) StatusAllLocal(filter api.StatusFilter) []api.PinInfo {
+	return filterPinInfos(c.tracker.StatusAll(), filter)
+}
+
+var errChunkLimit = errors.New("the chunk limit must be positive")
 
-// StatusAllLocal returns the PinInfo for all the tracked Cids in this peer.
-func (c *Cluster) StatusAllLocal() []api.PinInfo {
-	return c.tracker.StatusAll()
+// StatusAllChunk returns the GlobalPinInfo for up to limit tracked Cids
+// which come after the given one, in Cid order. Calling it again with the
+// last Cid returned walks the status of very large pinsets without holding
+// them in memory. An empty result means there are no more items. Peers only
+// report the items whose status matches the filter.
+func (c *Cluster) StatusAllChunk(after string, limit int, filter api.StatusFilter) ([]api.GlobalPinInfo, error) {
+	return c.statusChunk(api.StatusChunk{After: after, Limit: limit, Filter: filter})
+}
+
+// statusChunk returns the GlobalPinInfo for the chunk of the status
+// selected by the given options, as reported by all peers.
+func (c *Cluster) statusChunk(chunk api.StatusChunk) ([]api.GlobalPinInfo, error) {
+	limit := chunk.Limit
+	if len(chunk.Cids) > 0 {
+		limit = len(chunk.Cids)
+	} else if limit <= 0 {
+		return nil, errChunkLimit
+	}
+
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	replies := make([][]api.PinInfoSerial, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members,
+		"Cluster",
+		"TrackerStatusAllChunk",
+		chunk,
+		copyPinInfoSerialSliceToIfaces(replies))
+
+	// Peers returning a full chunk may have more items. Only the Cids up
+	// to the smallest last Cid among them have been reported by every
+	// peer and can be returned in this chunk.
+	bound := ""
+	for i, r := range replies {
+		if errs[i] == nil && len(chunk.Cids) == 0 && len(r) == limit {
+			if last := r[len(r)-1].Cid; bound == "" || last < bound {
+				bound = last
+			}
+		}
+	}
+
+	fullMap := make(map[string]api.GlobalPinInfo)
+	erroredPeers := make(map[peer.ID]string)
+	for i, r := range replies {
+		if e := errs[i]; e != nil {
+			logger.Errorf("%s: error in broadcast response from %s: %s ", c.id, members[i], e)
+			erroredPeers[members[i]] = e.Error()
+			continue
+		}
+		for _, pserial := range r {
+			if bound != "" && pserial.Cid > bound {
+				break
+			}
+			p := pserial.ToPinInfo()
+			item, ok := fullMap[pserial.Cid]
+			if !ok {
+				item = api.GlobalPinInfo{
+					Cid:     p.Cid,
+					PeerMap: make(map[peer.ID]api.PinInfo),
+				}
+				fullMap[pserial.Cid] = item
+			}
+			item.PeerMap[p.Peer] = p
+		}
+	}
+
+	keys := make([]string, 0, len(fullMap))
+	for k := range fullMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	infos := make([]api.GlobalPinInfo, 0, len(keys))
+	for _, k := range keys {
+		gpi := fullMap[k]
+		for p, msg := range erroredPeers {
+			gpi.PeerMap[p] = api.PinInfo{
+				Cid:    gpi.Cid,
+				Peer:   p,
+				Status: api.TrackerStatusClusterError,
+				TS:     time.Now(),
+				Error:  msg,
+			}
+		}
+		infos = append(infos, gpi)
+	}
+	return infos, nil
+}
+
+// StatusAllLocalChunk returns the PinInfo for up to limit Cids tracked
+// by this peer which come after the given one and whose status matches
+// the filter, in Cid order.
+func (c *Cluster) StatusAllLocalChunk(after string, limit int, filter api.StatusFilter) ([]api.PinInfo, error) {
+	return c.localStatusChunk(api.StatusChunk{After: after, Limit: limit, Filter: filter})
+}
+
+// localStatusChunk returns this peer's PinInfo for the chunk of the
+// status selected by the given options, in Cid order.
+func (c *Cluster) localStatusChunk(chunk api.StatusChunk) ([]api.PinInfo, error) {
+	if len(chunk.Cids) == 0 {
+		if chunk.Limit <= 0 {
+			return nil, errChunkLimit
+		}
+		infos := filterPinInfos(c.tracker.StatusAll(), chunk.Filter)
+		return pinInfoChunk(infos, chunk.After, chunk.Limit), nil
+	}
+
+	infos := make([]api.PinInfo, 0, len(chunk.Cids))
+	for _, cs := range chunk.Cids {
+		h, err := cid.Decode(cs)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, c.tracker.Status(h))
+	}
+	infos = filterPinInfos(infos, chunk.Filter)
+	return pinInfoChunk(infos, "", len(infos)), nil
 }
 
 // Status returns the GlobalPinInfo for a given Cid as fetched from all
 // current peers. If an error happens, the GlobalPinInfo should contain
-// as much information as could be fetched from the other peers.
+// as much information as could be fetched from the other peers. The
+// status reported by other peers may come from the status cache.
 func (c *Cluster) Status(h *cid.Cid) (api.GlobalPinInfo, error) {
-	return c.globalPinInfoCid("TrackerStatus", h)
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return api.GlobalPinInfo{}, err
+	}
+
+	cached := make(map[peer.ID]api.PinInfo)
+	var ask []peer.ID
+	for _, p := range members {
+		if p != c.id {
+			if pinfo, ok := c.statusCache.get(h, p); ok {
+				cached[p] = pinfo
+				continue
+			}
+		}
+		ask = append(ask, p)
+	}
+
+	gpi := c.peersPinInfoCid("TrackerStatus", h, ask)
+	for p, pinfo := range gpi.PeerMap {
+		if p != c.id && pinfo.Status != api.TrackerStatusClusterError {
+			c.statusCache.put(h, p, pinfo)
+		}
+	}
+	for p, pinfo := range cached {
+		gpi.PeerMap[p] = pinfo
+	}
+	return gpi, nil
 }
 
 // StatusLocal returns this peer's PinInfo for a given Cid.
@@ -864,7 +1980,7 @@ func (c *Cluster) StatusLocal(h *cid.Cid) api.PinInfo {
 // and returning the results as GlobalPinInfo. If an error happens, the slice
 // will contain as much information as could be fetched from the peers.
 func (c *Cluster) SyncAll() ([]api.GlobalPinInfo, error) {
-	return c.globalPinInfoSlice("SyncAllLocal")
+	return c.globalPinInfoSlice("SyncAllLocal", struct{}{})
 }
 
 // SyncAllLocal makes sure that the current state for all tracked items
@@ -883,6 +1999,43 @@ func (c *Cluster) SyncAllLocal() ([]api.PinInfo, error) {
 	return syncedItems, err
 }
 
+// ipfsSync runs SyncAllLocal and queues the recovery of the items found
+// in error with the background maintenance operations. Failed pins which
+// are retried automatically are left to their retries.
+func (c *Cluster) ipfsSync() ([]api.PinInfo, error) {
+	infos, err := c.SyncAllLocal()
+	if err != nil {
+		// the ipfs daemon is not available
+		return infos, err
+	}
+	c.recoverInBackground(infos, true)
+	return infos, nil
+}
+
+// recoverInBackground queues the recovery of the given items which are in
+// error state with the background maintenance operations, so that they
+// do not delay the operations requested by users. With skipRetried,
+// failed pins with previous attempts are skipped.
+func (c *Cluster) recoverInBackground(infos []api.PinInfo, skipRetried bool) {
+	n := 0
+	for _, pi := range infos {
+		if pi.Status != api.TrackerStatusPinError && pi.Status != api.TrackerStatusUnpinError {
+			continue
+		}
+		if skipRetried && pi.Attempts > 0 {
+			continue
+		}
+		if err := c.tracker.RecoverInBackground(pi.Cid); err != nil {
+			logger.Errorf("error recovering %s: %s", pi.Cid, err)
+			continue
+		}
+		n++
+	}
+	if n > 0 {
+		logger.Infof("recovering %d items in the background", n)
+	}
+}
+
 // Sync triggers a SyncLocal() operation for a given Cid.
 // in all cluster peers.
 func (c *Cluster) Sync(h *cid.Cid) (api.GlobalPinInfo, error) {
@@ -904,10 +2057,42 @@ func (c *Cluster) SyncLocal(h *cid.Cid) (api.PinInfo, error) {
 	return pInfo, err
 }
 
+// RecoverAll triggers a RecoverAllLocal operation in all cluster peers
+// for the items in error state (pin_error or unpin_error), or for those
+// matching the given filter when it is not empty. It returns the items
+// which were recovered, with their status after recovery in each peer.
+// As with SyncAll, errors contacting peers are contained in the
+// GlobalPinInfos.
+func (c *Cluster) RecoverAll(filter api.StatusFilter) ([]api.GlobalPinInfo, error) {
+	if len(filter) == 0 {
+		filter = api.StatusFilter{
+			api.TrackerStatusPinError,
+			api.TrackerStatusUnpinError,
+		}
+	}
+	return c.globalPinInfoSlice("RecoverAllLocal", filter)
+}
+
 // RecoverAllLocal triggers a RecoverLocal operation for all Cids tracked
-// by this peer.
-func (c *Cluster) RecoverAllLocal() ([]api.PinInfo, error) {
-	return c.tracker.RecoverAll()
+// by this peer. With a non-empty filter, only the items whose status
+// matches it are recovered and returned. In that case, items which
+// fail to recover do not stop the rest: they are returned in error
+// state.
+func (c *Cluster) RecoverAllLocal(filter api.StatusFilter) ([]api.PinInfo, error) {
+	if len(filter) == 0 {
+		return c.tracker.RecoverAll()
+	}
+
+	infos := filterPinInfos(c.tracker.StatusAll(), filter)
+	recovered := make([]api.PinInfo, 0, len(infos))
+	for _, pi := range infos {
+		r, err := c.tracker.Recover(pi.Cid)
+		if err != nil {
+			logger.Errorf("error recovering %s: %s", pi.Cid, err)
+		}
+		recovered = append(recovered, r)
+	}
+	return recovered, nil
 }
 
 // Recover triggers a recover operation for a given Cid in all
@@ -922,6 +2107,24 @@ func (c *Cluster) RecoverLocal(h *cid.Cid) (api.PinInfo, error) {
 	return c.tracker.Recover(h)
 }
 
+// checkStaleness returns an error when the local copy of the shared
+// state may be older than the configured StateMaxStaleness. Read-only
+// queries are answered from the local state and do not need a leader,
+// so this is the only thing that may prevent them during elections.
+func (c *Cluster) checkStaleness() error {
+	if c.config.StateMaxStaleness <= 0 {
+		return nil
+	}
+	last := c.consensus.LastContact()
+	if last.IsZero() {
+		return errors.New("the local state has never been in sync with the cluster")
+	}
+	if since := time.Since(last); since > c.config.StateMaxStaleness {
+		return fmt.Errorf("the local state may be stale: last contact with the cluster was %s ago", since)
+	}
+	return nil
+}
+
 // Pins returns the list of Cids managed by Cluster and which are part
 // of the current global state. This is the source of truth as to which
 // pins are managed and their allocation, but does not indicate if
@@ -936,6 +2139,23 @@ func (c *Cluster) Pins() []api.Pin {
 	return cState.List()
 }
 
+// PinsPage returns a page of the pins in the current global state, so
+// that listing them does not need to transfer the full pinset.
+func (c *Cluster) PinsPage(page api.PinsPage) []api.Pin {
+	return pinsPage(c.Pins(), page)
+}
+
+// PinLog returns the pin and unpin operations applied to the shared
+// state by this peer after the given sequence number, from oldest to
+// newest. It allows to follow the changes to the pinset without listing
+// it every time. Sequence numbers are given by the consensus component
+// (the Raft log index, the etcd revision, or a local counter with CRDTs)
+// and are kept across restarts. An error is returned when the requested
+// operations are no longer remembered or the sequence number is unknown.
+func (c *Cluster) PinLog(since uint64) ([]api.PinLogEntry, error) {
+	return c.pinLog.since(since)
+}
+
 // PinGet returns information for a single Cid managed by Cluster.
 // The information is obtained from the current global state. The
 // returned api.Pin provides information about the allocations
@@ -943,6 +2163,10 @@ func (c *Cluster) Pins() []api.Pin {
 // the item is successfully pinned. For that, use Status(). PinGet
 // returns an error if the given Cid is not part of the global state.
 func (c *Cluster) PinGet(h *cid.Cid) (api.Pin, error) {
+	err := c.checkStaleness()
+	if err != nil {
+		return api.Pin{}, err
+	}
 	cState, err := c.consensus.State()
 	if err != nil {
 		logger.Error(err)
@@ -955,6 +2179,256 @@ func (c *Cluster) PinGet(h *cid.Cid) (api.Pin, error) {
 	return pin, nil
 }
 
+// IPFSLocalPins returns the items pinned (recursively or directly) by the
+// IPFS daemon of this peer, sorted by Cid, indicating for each of them
+// whether it is part of the shared state and whether this peer is
+// allocated to pin it. It allows to check the parity between what
+// the daemon pins and what cluster tracks.
+func (c *Cluster) IPFSLocalPins() ([]api.LocalPin, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	var localPins []api.LocalPin
+	for _, t := range []string{"recursive", "direct"} {
+		ipfsPins, err := c.ipfs.PinLs(t)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range ipfsPins {
+			h, err := cid.Decode(k)
+			if err != nil {
+				logger.Error(k, err)
+				continue
+			}
+			lp := api.LocalPin{
+				Cid:  h,
+				Type: v,
+			}
+			if cState.Has(h) {
+				pin := cState.Get(h)
+				lp.Tracked = true
+				lp.Allocated = pin.ReplicationFactor < 0 || containsPeer(pin.Allocations, c.id)
+			}
+			localPins = append(localPins, lp)
+		}
+	}
+
+	sort.Slice(localPins, func(i, j int) bool {
+		return localPins[i].Cid.String() < localPins[j].Cid.String()
+	})
+	return localPins, nil
+}
+
+// AllocationPreview runs the allocation process for the given Cid and
+// replication factors and returns the Pin which would be committed to the
+// shared state, without committing anything. It allows to check which peers
+// would be chosen by the current allocation policy. When both replication
+// factors are 0, the cluster's default replication factor is used.
+func (c *Cluster) AllocationPreview(h *cid.Cid, rplMin, rplMax int) (api.Pin, error) {
+	pin := api.PinCid(h)
+	if rplMin == 0 && rplMax == 0 {
+		rplMin = c.config.ReplicationFactor
+		rplMax = c.config.ReplicationFactor
+	}
+	if rplMin == 0 {
+		rplMin = rplMax
+	}
+	if rplMax == 0 {
+		rplMax = rplMin
+	}
+
+	switch {
+	case rplMin < 0 || rplMax < 0:
+		pin.ReplicationFactor = -1
+		pin.Allocations = []peer.ID{}
+		return pin, nil
+	case rplMin > rplMax:
+		return pin, errors.New("minimum replication factor is larger than maximum")
+	}
+
+	pin = c.lookupSize(pin)
+	rec, err := c.allocate(h, pin.Size, rplMin, rplMax, []peer.ID{})
+	if err != nil {
+		return pin, err
+	}
+	pin.ReplicationFactor = len(rec.Allocations)
+	pin.Allocations = rec.Allocations
+	return pin, nil
+}
+
+// SimulateAllocations runs the allocation process for a batch of pins
+// against the current metrics, without committing anything, and reports the
+// allocations decided for each pin along with the projected number of pins
+// on every peer. Pins with a replication factor of 0 use the cluster's
+// default. After every decision, the metrics of the allocated peers are
+// updated as if they had pinned the item (see simulateAllocated), so the
+// pins are spread as they would be when peers report new metrics between
+// pin requests. Only the sizes given in the pins are used: IPFS is not
+// asked for them.
+func (c *Cluster) SimulateAllocations(pins []api.Pin) (api.AllocationSimulation, error) {
+	sim := api.AllocationSimulation{
+		Records: []api.AllocationRecord{},
+		Load:    []api.PeerLoad{},
+	}
+
+	metrics, err := c.getLeaderMetrics(c.getInformer().Name())
+	if err != nil {
+		return sim, err
+	}
+	var available []peer.ID
+	for _, m := range metrics {
+		if !m.Discard() {
+			available = append(available, m.Peer)
+		}
+	}
+
+	st, err := c.consensus.State()
+	if err != nil {
+		return sim, err
+	}
+	statePins := st.List()
+	maintenance := st.MaintenancePeers()
+
+	current := make(map[peer.ID]int)
+	allocations := make(map[string][]peer.ID)
+	for _, pin := range statePins {
+		allocs := pin.Allocations
+		if pin.ReplicationFactor < 0 {
+			allocs = available
+		}
+		for _, p := range allocs {
+			current[p]++
+		}
+		allocations[pin.Cid.KeyString()] = allocs
+	}
+
+	added := make(map[peer.ID]int)
+	for _, pin := range pins {
+		rpl := pin.ReplicationFactor
+		if rpl == 0 {
+			rpl = c.config.ReplicationFactor
+		}
+
+		rec := api.AllocationRecord{
+			Cid:        pin.Cid,
+			Size:       pin.Size,
+			Peer:       c.id,
+			MetricName: c.getInformer().Name(),
+			Metrics:    make(map[peer.ID]string),
+			Vetoes:     make(map[peer.ID]string),
+			TS:         time.Now(),
+		}
+		prev := allocations[pin.Cid.KeyString()]
+		if rpl < 0 {
+			rec.Reason = "replication factor -1: allocated everywhere"
+			rec.Allocations = available
+		} else {
+			rec, err = c.decideAllocation(rec, rpl, rpl, []peer.ID{}, prev, maintenance, metrics)
+			if err != nil {
+				sim.Failed++
+				sim.Records = append(sim.Records, rec)
+				continue
+			}
+		}
+
+		var newPeers []peer.ID
+		for _, p := range rec.Allocations {
+			if !containsPeer(prev, p) {
+				added[p]++
+				newPeers = append(newPeers, p)
+			}
+		}
+		if len(newPeers) > 0 {
+			simulateAllocated(metrics, newPeers, pin.Size)
+		}
+		allocations[pin.Cid.KeyString()] = rec.Allocations
+		sim.Records = append(sim.Records, rec)
+	}
+
+	var loadPeers []peer.ID
+	for p := range current {
+		loadPeers = append(loadPeers, p)
+	}
+	for p := range added {
+		if _, ok := current[p]; !ok {
+			loadPeers = append(loadPeers, p)
+		}
+	}
+	sort.Slice(loadPeers, func(i, j int) bool {
+		return loadPeers[i] < loadPeers[j]
+	})
+	for _, p := range loadPeers {
+		sim.Load = append(sim.Load, api.PeerLoad{
+			Peer:    p,
+			Current: current[p],
+			Added:   added[p],
+		})
+	}
+	return sim, nil
+}
+
+// AllocationHistoryLocal returns the allocation decisions for a Cid which
+// were made by this peer and are still remembered, from oldest to newest.
+func (c *Cluster) AllocationHistoryLocal(h *cid.Cid) []api.AllocationRecord {
+	return c.allocHistory.get(h)
+}
+
+// AllocationHistory returns the allocation decisions for a Cid made by any
+// cluster peer, sorted by time. Allocations are decided by the peer which
+// receives the pin request, thus every peer is queried.
+func (c *Cluster) AllocationHistory(h *cid.Cid) ([]api.AllocationRecord, error) {
+	return c.broadcastAllocationRecords("AllocationHistoryLocal", api.PinCid(h).ToSerial())
+}
+
+// AllocationDecisionsLocal returns every allocation decision made by this
+// peer which is still remembered, from oldest to newest.
+func (c *Cluster) AllocationDecisionsLocal() []api.AllocationRecord {
+	return c.allocHistory.all()
+}
+
+// AllocationDecisions returns the allocation decisions remembered by every
+// cluster peer, sorted by time. Each record includes the peers which were
+// considered and why some of them were excluded.
+func (c *Cluster) AllocationDecisions() ([]api.AllocationRecord, error) {
+	return c.broadcastAllocationRecords("AllocationDecisionsLocal", struct{}{})
+}
+
+// broadcastAllocationRecords calls the given RPC method on every cluster
+// peer and merges the allocation records they return, sorted by time.
+func (c *Cluster) broadcastAllocationRecords(method string, arg interface{}) ([]api.AllocationRecord, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	replies := make([][]api.AllocationRecordSerial, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members,
+		"Cluster",
+		method,
+		arg,
+		copyAllocationRecordSerialSliceToIfaces(replies))
+
+	records := []api.AllocationRecord{}
+	for i, r := range replies {
+		if e := errs[i]; e != nil {
+			logger.Errorf("%s: error in broadcast response from %s: %s ", c.id, members[i], e)
+			continue
+		}
+		for _, recS := range r {
+			records = append(records, recS.ToAllocationRecord())
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].TS.Before(records[j].TS)
+	})
+	return records, nil
+}
+
 // Pin makes the cluster Pin a Cid. This implies adding the Cid
 // to the IPFS Cluster peers shared-state. Depending on the cluster
 // pinning strategy, the PinTracker may then request the IPFS daemon
@@ -963,37 +2437,304 @@ func (c *Cluster) PinGet(h *cid.Cid) (api.Pin, error) {
 // Pin returns an error if the operation could not be persisted
 // to the global state. Pin does not reflect the success or failure
 // of underlying IPFS daemon pinning operations.
+//
+// When MergeDuplicatePins is enabled and the content is already pinned
+// under a different Cid (i.e. its CIDv0), the given Cid is added as an
+// alias of the existing pin instead of being pinned again.
+//
+// Pins may carry the raw block for their Cid as Inline content, up to
+// InlineMaxSize bytes. It is stored in the shared state, so it can be
+// provided to IPFS by any peer.
+//
+// Pins are added to their Namespace, which must be configured in
+// Namespaces unless it is the default one.
 func (c *Cluster) Pin(pin api.Pin) error {
-	return c.pin(pin, []peer.ID{})
+	c.statusCache.invalidate(pin.Cid)
+	if len(pin.Inline) > 0 {
+		err := c.checkInline(pin)
+		if err != nil {
+			return err
+		}
+	}
+
+	checked := []api.Pin{pin}
+	unlock := c.lockNamespaces(checked)
+	defer unlock()
+	err := c.checkNamespaces(checked)
+	if err != nil {
+		return err
+	}
+	pin = checked[0]
+
+	if c.config.MergeDuplicatePins {
+		if existing, ok := c.equivalentPin(pin.Cid); ok {
+			if existing.HasAlias(pin.Cid) {
+				return nil
+			}
+			logger.Infof("%s is already pinned as %s: adding it as an alias", pin.LogName(), existing.Cid)
+			existing.Aliases = append(existing.Aliases, pin.Cid)
+			existing.RequestID = pin.RequestID
+			return c.consensus.LogPin(existing)
+		}
+	}
+
+	// re-pinning an item keeps its aliases and inline content
+	if pin.Aliases == nil || pin.Inline == nil {
+		cState, err := c.consensus.State()
+		if err == nil {
+			existing := cState.Get(pin.Cid)
+			if pin.Aliases == nil {
+				pin.Aliases = existing.Aliases
+			}
+			if pin.Inline == nil {
+				pin.Inline = existing.Inline
+			}
+		}
+	}
+	_, err = c.pin(c.lookupSize(pin), []peer.ID{})
+	return err
+}
+
+// checkInline verifies that the inline content of a pin is allowed and
+// that it is the block for the pin's Cid.
+func (c *Cluster) checkInline(pin api.Pin) error {
+	max := c.config.InlineMaxSize
+	switch {
+	case max == 0:
+		return api.NewInvalidPinError("inline content is disabled (cluster.inline_max_size is 0)")
+	case len(pin.Inline) > max:
+		return api.NewInvalidPinError("inline content is %d bytes. Maximum is %d", len(pin.Inline), max)
+	}
+
+	h, err := pin.Cid.Prefix().Sum(pin.Inline)
+	if err != nil {
+		return err
+	}
+	if !h.Equals(pin.Cid) {
+		return api.NewInvalidPinError("inline content does not match %s", pin.Cid)
+	}
+	return nil
 }
 
 // pin performs the actual pinning and supports a blacklist to be
-// able to evacuate a node.
-func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID) error {
+// able to evacuate a node. It returns the new allocations.
+func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID) ([]peer.ID, error) {
+	pin, err := c.allocatePin(pin, blacklist)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.consensus.LogPin(pin)
+	if err != nil {
+		return nil, err
+	}
+	return pin.Allocations, nil
+}
+
+// allocatePin sets the replication factor and the allocations of
+// a pin which is about to be committed.
+func (c *Cluster) allocatePin(pin api.Pin, blacklist []peer.ID) (api.Pin, error) {
+	if pin.Type == api.MetaType && len(pin.Shards) == 0 {
+		return pin, api.NewInvalidPinError("meta pins need at least one shard")
+	}
+
 	rpl := pin.ReplicationFactor
 	if rpl == 0 {
-		rpl = c.config.ReplicationFactor
+		rpl = c.namespaceReplicationFactor(pin.Namespace)
 		pin.ReplicationFactor = rpl
 	}
 	switch {
 	case rpl == 0:
-		return errors.New("replication factor is 0")
+		return pin, errors.New("replication factor is 0")
 	case rpl < 0:
 		pin.Allocations = []peer.ID{}
-		logger.Infof("IPFS cluster pinning %s everywhere:", pin.Cid)
+		logger.Infof("IPFS cluster pinning %s everywhere:", pin.LogName())
 	case rpl > 0:
-		allocs, err := c.allocate(pin.Cid, pin.ReplicationFactor, blacklist)
+		rec, err := c.allocate(pin.Cid, pin.Size, rpl, rpl, blacklist)
+		c.allocHistory.add(rec)
+		logDecision(rec)
 		if err != nil {
-			return err
+			return pin, err
 		}
-		pin.Allocations = allocs
-		logger.Infof("IPFS cluster pinning %s on %s:", pin.Cid, pin.Allocations)
-
+		pin.Allocations = rec.Allocations
+		logger.Infof("IPFS cluster pinning %s on %s:", pin.LogName(), pin.Allocations)
 	}
+	return pin, nil
+}
+
+// PinBatchSize is the maximum number of pins committed to the shared
+// state in a single consensus operation by PinBatch.
+var PinBatchSize = 1000
 
-	err := c.consensus.LogPin(pin)
+// PinBatch makes the cluster pin several Cids at once. Allocations
+// are made for every item as with Pin, but they are committed to the
+// shared state together, in chunks of PinBatchSize items, which is
+// much faster than pinning them one by one when there are many.
+//
+// PinBatch does not merge duplicates nor keep the aliases and inline
+// content of items which are already pinned. It returns the number of
+// pins committed. All the items are allocated before committing any,
+// so when one cannot be allocated nothing is committed. Committing a
+// chunk can still fail after the previous ones were committed: the
+// error is returned along with the number of items committed so far,
+// which are the first ones.
+func (c *Cluster) PinBatch(pins []api.Pin) (int, error) {
+	unlock := c.lockNamespaces(pins)
+	defer unlock()
+	err := c.checkNamespaces(pins)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	batch := make([]api.Pin, 0, len(pins))
+	for _, pin := range pins {
+		if len(pin.Inline) > 0 {
+			err := c.checkInline(pin)
+			if err != nil {
+				return 0, err
+			}
+		}
+		pin, err := c.allocatePin(pin, []peer.ID{})
+		if err != nil {
+			return 0, fmt.Errorf("error allocating %s: %s", pin.Cid, err)
+		}
+		batch = append(batch, pin)
+	}
+
+	committed := 0
+	for committed < len(batch) {
+		n := PinBatchSize
+		if n > len(batch)-committed {
+			n = len(batch) - committed
+		}
+		chunk := batch[committed : committed+n]
+		err := c.consensus.LogPinBatch(chunk)
+		if err != nil {
+			return committed, err
+		}
+		for _, pin := range chunk {
+			c.statusCache.invalidate(pin.Cid)
+		}
+		committed += n
+	}
+	return committed, nil
+}
+
+// Batch commits a batch of pins and unpins, returning the outcome of
+// every item. Unlike PinBatch, items which cannot be pinned are left out
+// instead of failing the whole batch. The pins are committed first,
+// together in chunks of PinBatchSize items, and then the unpins, one by
+// one. When a chunk cannot be committed, all its pins fail.
+func (c *Cluster) Batch(items []api.BatchItem) []api.BatchResult {
+	results := make([]api.BatchResult, len(items), len(items))
+	var pins []api.Pin
+	var pinIdx []int
+	for i, item := range items {
+		results[i].Cid = item.Pin.Cid.String()
+		results[i].Unpin = item.Unpin
+		if item.Unpin {
+			continue
+		}
+		if err := c.checkBatchPin(item.Pin); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		pins = append(pins, item.Pin)
+		pinIdx = append(pinIdx, i)
+	}
+
+	// Quotas are checked for all the pins in a namespace together. When
+	// they are exceeded, none of those pins is committed. Other errors
+	// (unknown sizes) fail all the pins in namespaces.
+	unlock := c.lockNamespaces(pins)
+	defer unlock()
+	for len(pins) > 0 {
+		err := c.checkNamespaces(pins)
+		if err == nil {
+			break
+		}
+		qerr, ok := err.(*api.QuotaError)
+		n := len(pins)
+		for j := 0; j < len(pins); j++ {
+			ns := pins[j].Namespace
+			if ns == "" || (ok && ns != qerr.Namespace) {
+				continue
+			}
+			results[pinIdx[j]].Error = err.Error()
+			pins = append(pins[:j], pins[j+1:]...)
+			pinIdx = append(pinIdx[:j], pinIdx[j+1:]...)
+			j--
+		}
+		if len(pins) == n { // should not happen
+			for _, i := range pinIdx {
+				results[i].Error = err.Error()
+			}
+			pins = nil
+		}
+	}
+
+	var batch []api.Pin
+	var batchIdx []int
+	for j, pin := range pins {
+		pin, err := c.allocatePin(pin, []peer.ID{})
+		if err != nil {
+			results[pinIdx[j]].Error = fmt.Sprintf("error allocating %s: %s", pin.Cid, err)
+			continue
+		}
+		batch = append(batch, pin)
+		batchIdx = append(batchIdx, pinIdx[j])
+	}
+
+	for len(batch) > 0 {
+		n := PinBatchSize
+		if n > len(batch) {
+			n = len(batch)
+		}
+		err := c.consensus.LogPinBatch(batch[:n])
+		for j, pin := range batch[:n] {
+			if err != nil {
+				results[batchIdx[j]].Error = err.Error()
+				continue
+			}
+			c.statusCache.invalidate(pin.Cid)
+		}
+		batch = batch[n:]
+		batchIdx = batchIdx[n:]
+	}
+
+	for i, item := range items {
+		if !item.Unpin {
+			continue
+		}
+		var err error
+		if item.Pin.Namespace != "" {
+			err = c.unpinNamespace(item.Pin)
+		} else {
+			err = c.unpin(item.Pin)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// checkBatchPin verifies the namespace and the inline content of a pin
+// in a batch on its own.
+func (c *Cluster) checkBatchPin(pin api.Pin) error {
+	if pin.Namespace != "" {
+		if _, ok := c.config.Namespaces[pin.Namespace]; !ok {
+			return api.NewInvalidPinError("unknown namespace '%s'", pin.Namespace)
+		}
+	}
+	if cState, err := c.consensus.State(); err == nil && cState.Has(pin.Cid) {
+		existing := cState.Get(pin.Cid)
+		if existing.Namespace != pin.Namespace {
+			return api.NewInvalidPinError("%s is pinned in namespace '%s'", pin.Cid, existing.Namespace)
+		}
+	}
+	if len(pin.Inline) > 0 {
+		return c.checkInline(pin)
 	}
 	return nil
 }
@@ -1005,10 +2746,36 @@ func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID) error {
 // to the global state. Unpin does not reflect the success or failure
 // of underlying IPFS daemon unpinning operations.
 func (c *Cluster) Unpin(h *cid.Cid) error {
-	logger.Info("IPFS cluster unpinning:", h)
+	return c.unpin(api.PinCid(h))
+}
 
-	pin := api.Pin{
-		Cid: h,
+// unpin unpins the Cid of the given pin. Only its RequestID is kept in
+// the unpin operation, for tracing.
+func (c *Cluster) unpin(pin api.Pin) error {
+	h := pin.Cid
+	c.statusCache.invalidate(h)
+	// Unpinning an alias only removes it from the pin it was merged into.
+	// Aliases are only looked up when MergeDuplicatePins is enabled.
+	if c.config.MergeDuplicatePins {
+		if owner, ok := c.aliasOwner(h); ok {
+			logger.Infof("removing alias %s from %s", pin.LogName(), owner.Cid)
+			aliases := []*cid.Cid{}
+			for _, a := range owner.Aliases {
+				if !a.Equals(h) {
+					aliases = append(aliases, a)
+				}
+			}
+			owner.Aliases = aliases
+			owner.RequestID = pin.RequestID
+			return c.consensus.LogPin(owner)
+		}
+	}
+
+	logger.Info("IPFS cluster unpinning:", pin.LogName())
+
+	pin = api.Pin{
+		Cid:       h,
+		RequestID: pin.RequestID,
 	}
 
 	err := c.consensus.LogUnpin(pin)
@@ -1018,11 +2785,102 @@ func (c *Cluster) Unpin(h *cid.Cid) error {
 	return nil
 }
 
+// CancelPin stops an ongoing pin. Every peer which is still pinning the
+// item (or its shards) replaces that pin with an unpin of whatever was
+// fetched. Peers which have finished already are left alone by this
+// step, which is atomic in each of them. The item is then removed from
+// the shared state, so that it is not pinned again. CancelPin fails,
+// without removing anything, when no peer was pinning the item, so that
+// completed pins are not removed by mistake.
+func (c *Cluster) CancelPin(h *cid.Cid) error {
+	pin, err := c.PinGet(h)
+	if err != nil {
+		return err
+	}
+	cids := []*cid.Cid{h}
+	if pin.Type == api.MetaType {
+		cids = pin.Shards
+	}
+
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	cancelled := false
+	for _, ci := range cids {
+		errs := c.broadcaster.Broadcast(members,
+			"Cluster",
+			"TrackerCancelPin",
+			api.PinCid(ci).ToSerial(),
+			copyEmptyStructToIfaces(make([]struct{}, len(members), len(members))))
+		for i, e := range errs {
+			if e != nil {
+				logger.Debugf("%s: not cancelling %s: %s", members[i].Pretty(), ci, e)
+				continue
+			}
+			cancelled = true
+		}
+	}
+	if !cancelled {
+		return fmt.Errorf("%s is not being pinned by any peer", h)
+	}
+
+	logger.Infof("cancelled the pin of %s. Removing it", h)
+	return c.consensus.LogUnpin(api.Pin{Cid: h, RequestID: pin.RequestID})
+}
+
 // Version returns the current IPFS Cluster version.
 func (c *Cluster) Version() string {
 	return Version
 }
 
+// SetLogLevel sets the logging level for the given component (logging
+// facility) in this peer. "*" sets the level for all of them.
+func (c *Cluster) SetLogLevel(component, level string) error {
+	if component == "" {
+		return errors.New("no logging component given")
+	}
+	logger.Infof("setting log level for %s to %s", component, level)
+	return SetFacilityLogLevel(component, level)
+}
+
+// SetLogLevelAllPeers runs SetLogLevel in every cluster peer. It returns an
+// error listing the peers which failed to apply the change, if any.
+func (c *Cluster) SetLogLevelAllPeers(component, level string) error {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	replies := make([]struct{}, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members,
+		"Cluster",
+		"SetLogLevel",
+		api.LogLevel{Component: component, Level: level},
+		copyEmptyStructToIfaces(replies))
+
+	for i, e := range errs {
+		if e != nil {
+			logger.Errorf("%s: error setting log level in %s: %s", c.id, members[i], e)
+		}
+	}
+	if err := NewBroadcastError(members, errs); err != nil {
+		return fmt.Errorf("could not set the log level in some peers: %s", err)
+	}
+	return nil
+}
+
+// Snapshot makes the consensus component persist the current state
+// and compact its log now, rather than waiting for the next automatic
+// snapshot.
+func (c *Cluster) Snapshot() error {
+	logger.Info("taking a snapshot of the shared state")
+	return c.consensus.Snapshot()
+}
+
 // Peers returns the IDs of the members of this Cluster.
 func (c *Cluster) Peers() []api.ID {
 	members, err := c.consensus.Peers()
@@ -1035,7 +2893,7 @@ func (c *Cluster) Peers() []api.ID {
 	peersSerial := make([]api.IDSerial, len(members), len(members))
 	peers := make([]api.ID, len(members), len(members))
 
-	errs := c.multiRPC(members, "Cluster", "ID", struct{}{},
+	errs := c.broadcaster.Broadcast(members, "Cluster", "ID", struct{}{},
 		copyIDSerialsToIfaces(peersSerial))
 
 	for i, err := range errs {
@@ -1117,48 +2975,27 @@ func makeHost(ctx context.Context, cfg *Config) (host.Host, error) {
 }
 
 // Perform an RPC request to multiple destinations
-func (c *Cluster) multiRPC(dests []peer.ID, svcName, svcMethod string, args interface{}, reply []interface{}) []error {
-	if len(dests) != len(reply) {
-		panic("must have matching dests and replies")
-	}
-	var wg sync.WaitGroup
-	errs := make([]error, len(dests), len(dests))
-
-	for i := range dests {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			err := c.rpcClient.Call(
-				dests[i],
-				svcName,
-				svcMethod,
-				args,
-				reply[i])
-			errs[i] = err
-		}(i)
+func (c *Cluster) globalPinInfoCid(method string, h *cid.Cid) (api.GlobalPinInfo, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return api.GlobalPinInfo{}, err
 	}
-	wg.Wait()
-	return errs
-
+	return c.peersPinInfoCid(method, h, members), nil
 }
 
-func (c *Cluster) globalPinInfoCid(method string, h *cid.Cid) (api.GlobalPinInfo, error) {
+// peersPinInfoCid performs an RPC request for a Cid to the given peers.
+func (c *Cluster) peersPinInfoCid(method string, h *cid.Cid, members []peer.ID) api.GlobalPinInfo {
 	pin := api.GlobalPinInfo{
 		Cid:     h,
 		PeerMap: make(map[peer.ID]api.PinInfo),
 	}
 
-	members, err := c.consensus.Peers()
-	if err != nil {
-		logger.Error(err)
-		return api.GlobalPinInfo{}, err
-	}
-
 	replies := make([]api.PinInfoSerial, len(members), len(members))
 	arg := api.Pin{
 		Cid: h,
 	}
-	errs := c.multiRPC(members,
+	errs := c.broadcaster.Broadcast(members,
 		"Cluster",
 		method, arg.ToSerial(),
 		copyPinInfoSerialToIfaces(replies))
@@ -1197,13 +3034,10 @@ func (c *Cluster) globalPinInfoCid(method string, h *cid.Cid) (api.GlobalPinInfo
 		}
 	}
 
-	return pin, nil
+	return pin
 }
 
-func (c *Cluster) globalPinInfoSlice(method string) ([]api.GlobalPinInfo, error) {
-	var infos []api.GlobalPinInfo
-	fullMap := make(map[string]api.GlobalPinInfo)
-
+func (c *Cluster) globalPinInfoSlice(method string, arg interface{}) ([]api.GlobalPinInfo, error) {
 	members, err := c.consensus.Peers()
 	if err != nil {
 		logger.Error(err)
@@ -1211,11 +3045,21 @@ func (c *Cluster) globalPinInfoSlice(method string) ([]api.GlobalPinInfo, error)
 	}
 
 	replies := make([][]api.PinInfoSerial, len(members), len(members))
-	errs := c.multiRPC(members,
+	errs := c.broadcaster.Broadcast(members,
 		"Cluster",
-		method, struct{}{},
+		method, arg,
 		copyPinInfoSerialSliceToIfaces(replies))
 
+	return c.mergePinInfoSlices(members, replies, errs), nil
+}
+
+// mergePinInfoSlices builds GlobalPinInfos from the items reported by
+// every peer. Peers which failed to answer are reported with a
+// ClusterError for every item.
+func (c *Cluster) mergePinInfoSlices(members []peer.ID, replies [][]api.PinInfoSerial, errs []error) []api.GlobalPinInfo {
+	var infos []api.GlobalPinInfo
+	fullMap := make(map[string]api.GlobalPinInfo)
+
 	mergePins := func(pins []api.PinInfoSerial) {
 		for _, pserial := range pins {
 			p := pserial.ToPinInfo()
@@ -1261,7 +3105,7 @@ func (c *Cluster) globalPinInfoSlice(method string) ([]api.GlobalPinInfo, error)
 		infos = append(infos, v)
 	}
 
-	return infos, nil
+	return infos
 }
 
 func (c *Cluster) getIDForPeer(pid peer.ID) (api.ID, error) {
@@ -1276,104 +3120,6 @@ func (c *Cluster) getIDForPeer(pid peer.ID) (api.ID, error) {
 	return id, err
 }
 
-// allocate finds peers to allocate a hash using the informer and the monitor
-// it should only be used with a positive replication factor
-func (c *Cluster) allocate(hash *cid.Cid, repl int, blacklist []peer.ID) ([]peer.ID, error) {
-	if repl <= 0 {
-		return nil, errors.New("cannot decide allocation for replication factor <= 0")
-	}
-
-	// Figure out who is currently holding this
-	var pinAllocations []peer.ID
-	st, err := c.consensus.State()
-	if err != nil {
-		// no state we assume it is empty. If there was other
-		// problem, we would fail to commit anyway.
-		pinAllocations = []peer.ID{}
-	} else {
-		pin := st.Get(hash)
-		pinAllocations = pin.Allocations
-	}
-
-	// Get the LastMetrics from the leading monitor. They are the last
-	// valid metrics from current cluster peers
-	var metrics []api.Metric
-	metricName := c.informer.Name()
-	l, err := c.consensus.Leader()
-	if err != nil {
-		return nil, errors.New("cannot determine leading Monitor")
-	}
-
-	err = c.rpcClient.Call(l,
-		"Cluster", "PeerMonitorLastMetrics",
-		metricName,
-		&metrics)
-	if err != nil {
-		return nil, err
-	}
-
-	// We must divide the metrics between current and candidates
-	current := make(map[peer.ID]api.Metric)
-	candidates := make(map[peer.ID]api.Metric)
-	validAllocations := make([]peer.ID, 0, len(pinAllocations))
-	for _, m := range metrics {
-		if m.Discard() || containsPeer(blacklist, m.Peer) {
-			// blacklisted peers do not exist for us
-			continue
-		} else if containsPeer(pinAllocations, m.Peer) {
-			current[m.Peer] = m
-			validAllocations = append(validAllocations, m.Peer)
-		} else {
-			candidates[m.Peer] = m
-		}
-	}
-
-	currentValid := len(validAllocations)
-	candidatesValid := len(candidates)
-	needed := repl - currentValid
-
-	logger.Debugf("allocate: Valid allocations: %d", currentValid)
-	logger.Debugf("allocate: Valid candidates: %d", candidatesValid)
-	logger.Debugf("allocate: Needed: %d", needed)
-
-	// If needed == 0, we don't need anything. If needed < 0, we are
-	// reducing the replication factor
-	switch {
-
-	case needed <= 0: // set the allocations to the needed ones
-		return validAllocations[0 : len(validAllocations)+needed], nil
-	case candidatesValid < needed:
-		candidatesIds := []peer.ID{}
-		for k := range candidates {
-			candidatesIds = append(candidatesIds, k)
-		}
-		err = logError(
-			"not enough candidates to allocate %s. Needed: %d. Got: %d (%s)",
-			hash, needed, candidatesValid, candidatesIds)
-		return nil, err
-	default:
-		// this will return candidate peers in order of
-		// preference according to the allocator.
-		candidateAllocs, err := c.allocator.Allocate(hash, current, candidates)
-		if err != nil {
-			return nil, logError(err.Error())
-		}
-
-		logger.Debugf("allocate: candidate allocations: %s", candidateAllocs)
-
-		// we don't have enough peers to pin
-		if got := len(candidateAllocs); got < needed {
-			err = logError(
-				"cannot find enough allocations for %s. Needed: %d. Got: %d (%s)",
-				hash, needed, got, candidateAllocs)
-			return nil, err
-		}
-
-		// the new allocations = the valid ones we had + the needed ones
-		return append(validAllocations, candidateAllocs[0:needed]...), nil
-	}
-}
-
 // diffPeers returns the peerIDs added and removed from peers2 in relation to
 // peers1
 func diffPeers(peers1, peers2 []peer.ID) (added, removed []peer.ID) {
@@ -9,6 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,14 +25,31 @@ const configKey = "cluster"
 
 // Configuration defaults
 const (
-	DefaultConfigCrypto        = crypto.RSA
-	DefaultConfigKeyLength     = 2048
-	DefaultListenAddr          = "/ip4/0.0.0.0/tcp/9096"
-	DefaultStateSyncInterval   = 60 * time.Second
-	DefaultIPFSSyncInterval    = 130 * time.Second
-	DefaultMonitorPingInterval = 15 * time.Second
-	DefaultReplicationFactor   = -1
-	DefaultLeaveOnShutdown     = false
+	DefaultConfigCrypto          = crypto.RSA
+	DefaultConfigKeyLength       = 2048
+	DefaultListenAddr            = "/ip4/0.0.0.0/tcp/9096"
+	DefaultStateSyncInterval     = 60 * time.Second
+	DefaultIPFSSyncInterval      = 130 * time.Second
+	DefaultSyncJitter            = 10 * time.Second
+	DefaultMonitorPingInterval   = 15 * time.Second
+	DefaultReplicationFactor     = -1
+	DefaultLeaveOnShutdown       = false
+	DefaultPinningEnabled        = true
+	DefaultBroadcastMinInterval  = 0
+	DefaultBroadcastRetries      = 1
+	DefaultBroadcastRetryDelay   = 1 * time.Second
+	DefaultReallocationThreshold = 0.0
+	DefaultMergeDuplicatePins    = false
+	DefaultAllocationSizeLookup  = false
+	DefaultInlineMaxSize         = 0
+	DefaultMaxConcurrentRepins   = 4
+	DefaultRepinPeerRate         = 0
+	DefaultStatusCacheTTL        = 0
+	DefaultStateMaxStaleness     = 0
+	DefaultQuorumWaitTimeout     = 5 * time.Minute
+	DefaultFollowPollInterval    = 1 * time.Minute
+	DefaultConsensus             = "raft"
+	DefaultAllocationStrategy    = "disk-freespace"
 )
 
 // Config is the configuration object containing customizable variables to
@@ -76,7 +95,8 @@ type Config struct {
 	// Time between syncs of the consensus state to the
 	// tracker state. Normally states are synced anyway, but this helps
 	// when new nodes are joining the cluster. Reduce for faster
-	// consistency, increase with larger states.
+	// consistency, increase with larger states. 0 disables the
+	// periodic state sync.
 	StateSyncInterval time.Duration
 
 	// Number of seconds between syncs of the local state and
@@ -84,9 +104,14 @@ type Config struct {
 	// provides the right status for tracked items (for example
 	// to detect that a pin has been removed. Reduce for faster
 	// consistency, increase when the number of pinned items is very
-	// large.
+	// large. 0 disables the periodic ipfs sync.
 	IPFSSyncInterval time.Duration
 
+	// SyncJitter is the maximum random delay added to every
+	// StateSyncInterval and IPFSSyncInterval wait, so that peers
+	// started at the same time do not sync in lockstep. 0 disables it.
+	SyncJitter time.Duration
+
 	// ReplicationFactor indicates the number of nodes that must pin content.
 	// For exampe, a replication_factor of 2 will prompt cluster to choose
 	// two nodes for each pinned hash. A replication_factor -1 will
@@ -97,6 +122,185 @@ type Config struct {
 	// monitoring component. The ping metric has a TTL set to the double
 	// of this value.
 	MonitorPingInterval time.Duration
+
+	// PinningEnabled indicates whether this peer can be allocated
+	// content. When false, the peer takes part in the consensus and
+	// serves the APIs, but it is never selected to pin anything.
+	PinningEnabled bool
+
+	// ReallocationThreshold controls when re-pinning an item moves
+	// its allocations from a current peer to a candidate with a better
+	// metric. The candidate metric must improve the current one by more
+	// than this fraction of it (0.2 means 20%). 0 disables it, so
+	// healthy allocations are never moved.
+	ReallocationThreshold float64
+
+	// MergeDuplicatePins makes pins for content which is already pinned
+	// under a different Cid (i.e. the CIDv1 of a pinned CIDv0) be added
+	// as aliases of the existing pin, so the content is not replicated
+	// twice. Aliases can only be unpinned on their own while it is
+	// enabled.
+	MergeDuplicatePins bool
+
+	// AllocationSizeLookup makes the peer ask its IPFS daemon for the
+	// cumulative size of an item pinned without a size, before
+	// allocating it, so that the min_free_space allocation filter
+	// accounts for it. The lookup blocks the pin request, so it is
+	// only done for single pins and never for batches.
+	AllocationSizeLookup bool
+
+	// InlineMaxSize is the maximum size in bytes of the content which
+	// can be stored inline in the shared state along with its pin.
+	// 0 disables inline content.
+	InlineMaxSize int
+
+	// Tags are key=value pairs describing this peer (i.e. its region
+	// or datacenter). They are sent to every peer as the "tags" metric
+	// so that allocators and filters can place content by tag.
+	Tags map[string]string
+
+	// DisabledInformers lists the names of the informers (i.e. "tags")
+	// whose metrics this peer does not send. Peers without the metric of
+	// the allocation strategy informer are never allocated content.
+	DisabledInformers []string
+
+	// BroadcastMinInterval is the minimum time between two requests
+	// sent to the same peer when broadcasting metrics, peer
+	// notifications or status requests. 0 disables rate limiting.
+	BroadcastMinInterval time.Duration
+
+	// BroadcastRetries is the number of times a broadcasted request
+	// is retried when it fails for a peer.
+	BroadcastRetries int
+
+	// BroadcastRetryDelay is the time to wait before retrying a
+	// broadcasted request.
+	BroadcastRetryDelay time.Duration
+
+	// MaxConcurrentRepins is the maximum number of items re-pinned
+	// at the same time when peers fail or are removed.
+	MaxConcurrentRepins int
+
+	// RepinPeerRate is the maximum number of re-pinned items which
+	// can be assigned to a single peer per minute. 0 means unlimited.
+	RepinPeerRate int
+
+	// StatusCacheTTL is how long the status reported by other peers
+	// is cached by this peer, so that frequent status requests do not
+	// reach every peer every time. Cached items are invalidated when
+	// they are pinned or unpinned. 0 disables the cache.
+	StatusCacheTTL time.Duration
+
+	// StateMaxStaleness bounds how out of date the local copy of the
+	// shared state may be when answering read-only queries (pins and
+	// allocations). Queries fail when the consensus has not heard from
+	// the rest of the cluster (i.e. the Raft leader) for longer. 0
+	// means the local state is always used.
+	StateMaxStaleness time.Duration
+
+	// QuorumWaitTimeout is how long a peer which starts with a
+	// persisted peerset (i.e. after the whole cluster was restarted)
+	// waits for the consensus to become ready, while it tries to
+	// reconnect to those peers. 0 means waiting indefinitely.
+	QuorumWaitTimeout time.Duration
+
+	// PinEventsTopic is the libp2p pubsub topic where this peer
+	// publishes an event every time the status of an item changes
+	// locally. Empty disables publishing.
+	PinEventsTopic string
+
+	// Consensus selects the consensus component used by this peer.
+	// It can be "raft" (default), "crdt" or "etcd".
+	Consensus string
+
+	// AllocationStrategy is the name of the allocation strategy used by
+	// this peer (see the --alloc flag of ipfs-cluster-service). It is
+	// updated by SetAllocationStrategy, so that changes are kept across
+	// restarts.
+	AllocationStrategy string
+
+	// AllocationFilters configures the filters which discard candidate
+	// peers before they are sorted by the allocator.
+	AllocationFilters AllocationFiltersConfig
+
+	// Follow lists other clusters whose pinset is mirrored into this
+	// one.
+	Follow []FollowConfig
+
+	// Namespaces are the namespaces, besides the default one, in
+	// which pins can be added, keyed by name.
+	Namespaces map[string]NamespaceConfig
+
+	// EncryptionKey, when set, is used to encrypt the pin log. It is
+	// not part of the configuration file: peers set it to the
+	// raft.encryption_key.
+	EncryptionKey []byte
+}
+
+// NamespaceConfig holds the defaults and limits of a namespace.
+type NamespaceConfig struct {
+	// ReplicationFactor is used for the pins added to the namespace
+	// without one. 0 means cluster.replication_factor.
+	ReplicationFactor int
+	// MaxPins is the maximum number of pins in the namespace. 0 means
+	// no limit.
+	MaxPins int
+	// MaxBytes is the maximum cumulative size of the pins in the
+	// namespace. 0 means no limit.
+	MaxBytes uint64
+}
+
+type namespaceConfigJSON struct {
+	ReplicationFactor int    `json:"replication_factor,omitempty"`
+	MaxPins           int    `json:"max_pins,omitempty"`
+	MaxBytes          uint64 `json:"max_bytes,omitempty"`
+}
+
+// AllocationFiltersConfig enables the allocation filters. Filters run
+// in the order of the fields.
+type AllocationFiltersConfig struct {
+	// MinFreeSpace discards candidates which would be left with less
+	// free space, in bytes, in the "freespace" metric after pinning
+	// the item. 0 disables it.
+	MinFreeSpace uint64
+	// MaxPinQueue discards candidates with more queued pins in the
+	// "pinqueue" metric. 0 disables it.
+	MaxPinQueue uint64
+	// Tags discards candidates which do not carry all these tags in
+	// the "tags" metric. Empty disables it.
+	Tags map[string]string
+}
+
+type allocationFiltersConfigJSON struct {
+	MinFreeSpace uint64            `json:"min_free_space"`
+	MaxPinQueue  uint64            `json:"max_pin_queue"`
+	Tags         map[string]string `json:"tags"`
+}
+
+// FollowConfig describes another cluster whose pinset is mirrored by
+// this one. Its REST API is polled every PollInterval.
+type FollowConfig struct {
+	// APIAddr is the multiaddress of the REST API of a peer of the
+	// followed cluster.
+	APIAddr ma.Multiaddr
+	// SSL, Username and Password are used to access that API.
+	SSL      bool
+	Username string
+	Password string
+	// PollInterval is the time between polls.
+	PollInterval time.Duration
+	// ReplicationFactor is used for the mirrored pins. 0 means
+	// cluster.replication_factor.
+	ReplicationFactor int
+}
+
+type followConfigJSON struct {
+	APIAddr           string `json:"api_addr"`
+	SSL               bool   `json:"ssl,omitempty"`
+	Username          string `json:"username,omitempty"`
+	Password          string `json:"password,omitempty"`
+	PollInterval      string `json:"poll_interval,omitempty"`
+	ReplicationFactor int    `json:"replication_factor,omitempty"`
 }
 
 // configJSON represents a Cluster configuration as it will look when it is
@@ -113,8 +317,39 @@ type configJSON struct {
 	ListenMultiaddress  string   `json:"listen_multiaddress"`
 	StateSyncInterval   string   `json:"state_sync_interval"`
 	IPFSSyncInterval    string   `json:"ipfs_sync_interval"`
+	SyncJitter          string   `json:"sync_jitter,omitempty"`
 	ReplicationFactor   int      `json:"replication_factor"`
 	MonitorPingInterval string   `json:"monitor_ping_interval"`
+	PinningEnabled      *bool    `json:"pinning_enabled,omitempty"`
+
+	ReallocationThreshold float64 `json:"reallocation_threshold"`
+	MergeDuplicatePins    bool    `json:"merge_duplicate_pins"`
+	AllocationSizeLookup  bool    `json:"allocation_size_lookup"`
+	InlineMaxSize         int     `json:"inline_max_size"`
+
+	Tags              map[string]string `json:"tags"`
+	DisabledInformers []string          `json:"disabled_informers"`
+
+	BroadcastMinInterval string `json:"broadcast_min_interval,omitempty"`
+	BroadcastRetries     *int   `json:"broadcast_retries,omitempty"`
+	BroadcastRetryDelay  string `json:"broadcast_retry_delay,omitempty"`
+
+	MaxConcurrentRepins int `json:"max_concurrent_repins,omitempty"`
+	RepinPeerRate       int `json:"repin_peer_rate"`
+
+	StatusCacheTTL    string `json:"status_cache_ttl,omitempty"`
+	StateMaxStaleness string `json:"state_max_staleness,omitempty"`
+	QuorumWaitTimeout string `json:"quorum_wait_timeout,omitempty"`
+	PinEventsTopic    string `json:"pin_events_topic"`
+	Consensus         string `json:"consensus,omitempty"`
+
+	AllocationStrategy string `json:"allocation_strategy,omitempty"`
+
+	AllocationFilters *allocationFiltersConfigJSON `json:"allocation_filters,omitempty"`
+
+	Follow []followConfigJSON `json:"follow,omitempty"`
+
+	Namespaces map[string]namespaceConfigJSON `json:"namespaces,omitempty"`
 }
 
 // ConfigKey returns a human-readable string to identify
@@ -178,14 +413,18 @@ func (cfg *Config) Validate() error {
 		return errors.New("cluster.listen_addr is indefined")
 	}
 
-	if cfg.StateSyncInterval <= 0 {
+	if cfg.StateSyncInterval < 0 {
 		return errors.New("cluster.state_sync_interval is invalid")
 	}
 
-	if cfg.IPFSSyncInterval <= 0 {
+	if cfg.IPFSSyncInterval < 0 {
 		return errors.New("cluster.ipfs_sync_interval is invalid")
 	}
 
+	if cfg.SyncJitter < 0 {
+		return errors.New("cluster.sync_jitter is invalid")
+	}
+
 	if cfg.MonitorPingInterval <= 0 {
 		return errors.New("cluster.monitoring_interval is invalid")
 	}
@@ -194,6 +433,92 @@ func (cfg *Config) Validate() error {
 		return errors.New("cluster.replication_factor is invalid")
 	}
 
+	if cfg.ReallocationThreshold < 0 {
+		return errors.New("cluster.reallocation_threshold is invalid")
+	}
+
+	for k, v := range cfg.Tags {
+		if k == "" || strings.ContainsAny(k, ",=") || strings.Contains(v, ",") {
+			return fmt.Errorf("cluster.tags: invalid tag %s=%s", k, v)
+		}
+	}
+
+	if cfg.InlineMaxSize < 0 {
+		return errors.New("cluster.inline_max_size is invalid")
+	}
+
+	if cfg.BroadcastMinInterval < 0 {
+		return errors.New("cluster.broadcast_min_interval is invalid")
+	}
+
+	if cfg.BroadcastRetries < 0 {
+		return errors.New("cluster.broadcast_retries is invalid")
+	}
+
+	if cfg.BroadcastRetryDelay < 0 {
+		return errors.New("cluster.broadcast_retry_delay is invalid")
+	}
+
+	if cfg.MaxConcurrentRepins <= 0 {
+		return errors.New("cluster.max_concurrent_repins is invalid")
+	}
+
+	if cfg.StatusCacheTTL < 0 {
+		return errors.New("cluster.status_cache_ttl is invalid")
+	}
+
+	if cfg.StateMaxStaleness < 0 {
+		return errors.New("cluster.state_max_staleness is invalid")
+	}
+
+	if cfg.QuorumWaitTimeout < 0 {
+		return errors.New("cluster.quorum_wait_timeout is invalid")
+	}
+
+	if cfg.RepinPeerRate < 0 {
+		return errors.New("cluster.repin_peer_rate is invalid")
+	}
+
+	switch cfg.Consensus {
+	case "raft", "crdt", "etcd":
+	default:
+		return errors.New("cluster.consensus must be raft, crdt or etcd")
+	}
+
+	if cfg.AllocationStrategy == "" {
+		return errors.New("cluster.allocation_strategy is undefined")
+	}
+
+	for _, f := range cfg.Follow {
+		if f.APIAddr == nil {
+			return errors.New("cluster.follow: api_addr is undefined")
+		}
+		if f.PollInterval <= 0 {
+			return errors.New("cluster.follow: poll_interval is invalid")
+		}
+		if f.ReplicationFactor < -1 {
+			return errors.New("cluster.follow: replication_factor is invalid")
+		}
+	}
+
+	for k, v := range cfg.AllocationFilters.Tags {
+		if k == "" || strings.ContainsAny(k, ",=") || strings.Contains(v, ",") {
+			return fmt.Errorf("cluster.allocation_filters.tags: invalid tag %s=%s", k, v)
+		}
+	}
+
+	for name, ns := range cfg.Namespaces {
+		if name == "" || strings.ContainsAny(name, "/ ") {
+			return fmt.Errorf("cluster.namespaces: invalid name '%s'", name)
+		}
+		if ns.ReplicationFactor < -1 {
+			return fmt.Errorf("cluster.namespaces: %s: replication_factor is invalid", name)
+		}
+		if ns.MaxPins < 0 {
+			return fmt.Errorf("cluster.namespaces: %s: max_pins is invalid", name)
+		}
+	}
+
 	return nil
 }
 
@@ -212,8 +537,28 @@ func (cfg *Config) setDefaults() {
 	cfg.LeaveOnShutdown = DefaultLeaveOnShutdown
 	cfg.StateSyncInterval = DefaultStateSyncInterval
 	cfg.IPFSSyncInterval = DefaultIPFSSyncInterval
+	cfg.SyncJitter = DefaultSyncJitter
 	cfg.ReplicationFactor = DefaultReplicationFactor
 	cfg.MonitorPingInterval = DefaultMonitorPingInterval
+	cfg.PinningEnabled = DefaultPinningEnabled
+	cfg.ReallocationThreshold = DefaultReallocationThreshold
+	cfg.MergeDuplicatePins = DefaultMergeDuplicatePins
+	cfg.AllocationSizeLookup = DefaultAllocationSizeLookup
+	cfg.InlineMaxSize = DefaultInlineMaxSize
+	cfg.Tags = make(map[string]string)
+	cfg.BroadcastMinInterval = DefaultBroadcastMinInterval
+	cfg.BroadcastRetries = DefaultBroadcastRetries
+	cfg.BroadcastRetryDelay = DefaultBroadcastRetryDelay
+	cfg.MaxConcurrentRepins = DefaultMaxConcurrentRepins
+	cfg.RepinPeerRate = DefaultRepinPeerRate
+	cfg.StatusCacheTTL = DefaultStatusCacheTTL
+	cfg.StateMaxStaleness = DefaultStateMaxStaleness
+	cfg.QuorumWaitTimeout = DefaultQuorumWaitTimeout
+	cfg.PinEventsTopic = ""
+	cfg.Consensus = DefaultConsensus
+	cfg.AllocationStrategy = DefaultAllocationStrategy
+	cfg.Follow = []FollowConfig{}
+	cfg.Namespaces = make(map[string]NamespaceConfig)
 }
 
 // LoadJSON receives a raw json-formatted configuration and
@@ -298,18 +643,148 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 		cfg.ReplicationFactor = rf
 	}
 
-	// Validation will detect problems here
-	interval, _ := time.ParseDuration(jcfg.StateSyncInterval)
+	// A sync interval of 0 disables the sync, so it must be given
+	// explicitly.
+	interval, err := time.ParseDuration(jcfg.StateSyncInterval)
+	if err != nil {
+		return fmt.Errorf("error parsing state_sync_interval: %s", err)
+	}
 	cfg.StateSyncInterval = interval
 
-	interval, _ = time.ParseDuration(jcfg.IPFSSyncInterval)
+	interval, err = time.ParseDuration(jcfg.IPFSSyncInterval)
+	if err != nil {
+		return fmt.Errorf("error parsing ipfs_sync_interval: %s", err)
+	}
 	cfg.IPFSSyncInterval = interval
 
+	// Older configurations do not have this key and keep the default.
+	if jcfg.SyncJitter != "" {
+		interval, err = time.ParseDuration(jcfg.SyncJitter)
+		if err != nil {
+			return fmt.Errorf("error parsing sync_jitter: %s", err)
+		}
+		cfg.SyncJitter = interval
+	}
+
+	// Validation will detect problems here
 	interval, _ = time.ParseDuration(jcfg.MonitorPingInterval)
 	cfg.MonitorPingInterval = interval
 
 	cfg.LeaveOnShutdown = jcfg.LeaveOnShutdown
 
+	// Older configurations do not have this key and keep pinning.
+	if jcfg.PinningEnabled != nil {
+		cfg.PinningEnabled = *jcfg.PinningEnabled
+	}
+
+	cfg.ReallocationThreshold = jcfg.ReallocationThreshold
+	cfg.MergeDuplicatePins = jcfg.MergeDuplicatePins
+	cfg.AllocationSizeLookup = jcfg.AllocationSizeLookup
+	cfg.InlineMaxSize = jcfg.InlineMaxSize
+	if jcfg.Tags != nil {
+		cfg.Tags = jcfg.Tags
+	}
+	cfg.DisabledInformers = jcfg.DisabledInformers
+
+	// Broadcast options are optional and keep their defaults
+	// when missing.
+	if jcfg.BroadcastMinInterval != "" {
+		interval, err = time.ParseDuration(jcfg.BroadcastMinInterval)
+		if err != nil {
+			return fmt.Errorf("error parsing broadcast_min_interval: %s", err)
+		}
+		cfg.BroadcastMinInterval = interval
+	}
+
+	if jcfg.BroadcastRetries != nil {
+		cfg.BroadcastRetries = *jcfg.BroadcastRetries
+	}
+
+	if jcfg.BroadcastRetryDelay != "" {
+		interval, err = time.ParseDuration(jcfg.BroadcastRetryDelay)
+		if err != nil {
+			return fmt.Errorf("error parsing broadcast_retry_delay: %s", err)
+		}
+		cfg.BroadcastRetryDelay = interval
+	}
+
+	// 0 or missing means default.
+	if jcfg.MaxConcurrentRepins != 0 {
+		cfg.MaxConcurrentRepins = jcfg.MaxConcurrentRepins
+	}
+	cfg.RepinPeerRate = jcfg.RepinPeerRate
+
+	if jcfg.StatusCacheTTL != "" {
+		interval, err = time.ParseDuration(jcfg.StatusCacheTTL)
+		if err != nil {
+			return fmt.Errorf("error parsing status_cache_ttl: %s", err)
+		}
+		cfg.StatusCacheTTL = interval
+	}
+
+	if jcfg.StateMaxStaleness != "" {
+		interval, err = time.ParseDuration(jcfg.StateMaxStaleness)
+		if err != nil {
+			return fmt.Errorf("error parsing state_max_staleness: %s", err)
+		}
+		cfg.StateMaxStaleness = interval
+	}
+
+	if jcfg.QuorumWaitTimeout != "" {
+		interval, err = time.ParseDuration(jcfg.QuorumWaitTimeout)
+		if err != nil {
+			return fmt.Errorf("error parsing quorum_wait_timeout: %s", err)
+		}
+		cfg.QuorumWaitTimeout = interval
+	}
+
+	cfg.PinEventsTopic = jcfg.PinEventsTopic
+
+	// empty means default.
+	if jcfg.Consensus != "" {
+		cfg.Consensus = jcfg.Consensus
+	}
+	if jcfg.AllocationStrategy != "" {
+		cfg.AllocationStrategy = jcfg.AllocationStrategy
+	}
+
+	for _, jf := range jcfg.Follow {
+		f := FollowConfig{
+			SSL:               jf.SSL,
+			Username:          jf.Username,
+			Password:          jf.Password,
+			PollInterval:      DefaultFollowPollInterval,
+			ReplicationFactor: jf.ReplicationFactor,
+		}
+		f.APIAddr, err = ma.NewMultiaddr(jf.APIAddr)
+		if err != nil {
+			return fmt.Errorf("error parsing follow api_addr: %s", err)
+		}
+		if jf.PollInterval != "" {
+			f.PollInterval, err = time.ParseDuration(jf.PollInterval)
+			if err != nil {
+				return fmt.Errorf("error parsing follow poll_interval: %s", err)
+			}
+		}
+		cfg.Follow = append(cfg.Follow, f)
+	}
+
+	if jf := jcfg.AllocationFilters; jf != nil {
+		cfg.AllocationFilters = AllocationFiltersConfig{
+			MinFreeSpace: jf.MinFreeSpace,
+			MaxPinQueue:  jf.MaxPinQueue,
+			Tags:         jf.Tags,
+		}
+	}
+
+	for name, jns := range jcfg.Namespaces {
+		cfg.Namespaces[name] = NamespaceConfig{
+			ReplicationFactor: jns.ReplicationFactor,
+			MaxPins:           jns.MaxPins,
+			MaxBytes:          jns.MaxBytes,
+		}
+	}
+
 	return cfg.Validate()
 }
 
@@ -355,7 +830,62 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 	jcfg.ListenMultiaddress = cfg.ListenAddr.String()
 	jcfg.StateSyncInterval = cfg.StateSyncInterval.String()
 	jcfg.IPFSSyncInterval = cfg.IPFSSyncInterval.String()
+	jcfg.SyncJitter = cfg.SyncJitter.String()
 	jcfg.MonitorPingInterval = cfg.MonitorPingInterval.String()
+	pinningEnabled := cfg.PinningEnabled
+	jcfg.PinningEnabled = &pinningEnabled
+	jcfg.ReallocationThreshold = cfg.ReallocationThreshold
+	jcfg.MergeDuplicatePins = cfg.MergeDuplicatePins
+	jcfg.AllocationSizeLookup = cfg.AllocationSizeLookup
+	jcfg.InlineMaxSize = cfg.InlineMaxSize
+	jcfg.Tags = cfg.Tags
+	if jcfg.Tags == nil {
+		jcfg.Tags = make(map[string]string)
+	}
+	jcfg.DisabledInformers = cfg.DisabledInformers
+	if jcfg.DisabledInformers == nil {
+		jcfg.DisabledInformers = []string{}
+	}
+	jcfg.BroadcastMinInterval = cfg.BroadcastMinInterval.String()
+	broadcastRetries := cfg.BroadcastRetries
+	jcfg.BroadcastRetries = &broadcastRetries
+	jcfg.BroadcastRetryDelay = cfg.BroadcastRetryDelay.String()
+	jcfg.MaxConcurrentRepins = cfg.MaxConcurrentRepins
+	jcfg.RepinPeerRate = cfg.RepinPeerRate
+	jcfg.StatusCacheTTL = cfg.StatusCacheTTL.String()
+	jcfg.StateMaxStaleness = cfg.StateMaxStaleness.String()
+	jcfg.QuorumWaitTimeout = cfg.QuorumWaitTimeout.String()
+	jcfg.PinEventsTopic = cfg.PinEventsTopic
+	jcfg.Consensus = cfg.Consensus
+	jcfg.AllocationStrategy = cfg.AllocationStrategy
+	for _, f := range cfg.Follow {
+		jcfg.Follow = append(jcfg.Follow, followConfigJSON{
+			APIAddr:           f.APIAddr.String(),
+			SSL:               f.SSL,
+			Username:          f.Username,
+			Password:          f.Password,
+			PollInterval:      f.PollInterval.String(),
+			ReplicationFactor: f.ReplicationFactor,
+		})
+	}
+	jcfg.AllocationFilters = &allocationFiltersConfigJSON{
+		MinFreeSpace: cfg.AllocationFilters.MinFreeSpace,
+		MaxPinQueue:  cfg.AllocationFilters.MaxPinQueue,
+		Tags:         cfg.AllocationFilters.Tags,
+	}
+	if jcfg.AllocationFilters.Tags == nil {
+		jcfg.AllocationFilters.Tags = make(map[string]string)
+	}
+	if len(cfg.Namespaces) > 0 {
+		jcfg.Namespaces = make(map[string]namespaceConfigJSON)
+		for name, ns := range cfg.Namespaces {
+			jcfg.Namespaces[name] = namespaceConfigJSON{
+				ReplicationFactor: ns.ReplicationFactor,
+				MaxPins:           ns.MaxPins,
+				MaxBytes:          ns.MaxBytes,
+			}
+		}
+	}
 
 	raw, err = json.MarshalIndent(jcfg, "", "    ")
 	return
@@ -368,6 +898,12 @@ func (cfg *Config) savePeers(addrs []ma.Multiaddr) {
 	cfg.NotifySave()
 }
 
+// GetPinLogFolder returns the folder where the pin log is kept:
+// DefaultPinLogSubFolder in the configuration folder.
+func (cfg *Config) GetPinLogFolder() string {
+	return filepath.Join(cfg.BaseDir, DefaultPinLogSubFolder)
+}
+
 // DecodeClusterSecret parses a hex-encoded string, checks that it is exactly
 // 32 bytes long and returns its value as a byte-slice.x
 func DecodeClusterSecret(hexSecret string) ([]byte, error) {
@@ -3,6 +3,7 @@ package ipfscluster
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 var ccfgTestJSON = []byte(`
@@ -126,6 +127,342 @@ func TestLoadJSON(t *testing.T) {
 	if cfg.ReplicationFactor != -1 {
 		t.Error("expected default replication factor")
 	}
+
+	if !cfg.PinningEnabled {
+		t.Error("expected pinning enabled by default")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	pinningEnabled := false
+	j.PinningEnabled = &pinningEnabled
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.PinningEnabled {
+		t.Error("expected pinning disabled")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.BroadcastRetries != DefaultBroadcastRetries ||
+		cfg.BroadcastRetryDelay != DefaultBroadcastRetryDelay {
+		t.Error("expected default broadcast options")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.AllocationSizeLookup = true
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if !cfg.AllocationSizeLookup {
+		t.Error("expected allocation_size_lookup to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.DisabledInformers = []string{"tags"}
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if len(cfg.DisabledInformers) != 1 || cfg.DisabledInformers[0] != "tags" {
+		t.Error("expected disabled_informers to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.Tags = map[string]string{"region": "eu"}
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.Tags["region"] != "eu" {
+		t.Error("expected tag region=eu")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.Tags = map[string]string{"a,b": "c"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with invalid tags")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.AllocationFilters = &allocationFiltersConfigJSON{
+		MaxPinQueue: 10,
+		Tags:        map[string]string{"region": "eu"},
+	}
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.AllocationFilters.MaxPinQueue != 10 || cfg.AllocationFilters.Tags["region"] != "eu" {
+		t.Error("expected allocation_filters to be loaded")
+	}
+
+	j.AllocationFilters.Tags = map[string]string{"a=b": "c"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with invalid filter tags")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.BroadcastMinInterval = "abc"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error parsing broadcast_min_interval")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	broadcastRetries := -1
+	j.BroadcastRetries = &broadcastRetries
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with negative broadcast_retries")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.MaxConcurrentRepins != DefaultMaxConcurrentRepins ||
+		cfg.RepinPeerRate != DefaultRepinPeerRate {
+		t.Error("expected default repin options")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.MaxConcurrentRepins = 10
+	j.RepinPeerRate = 100
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.MaxConcurrentRepins != 10 || cfg.RepinPeerRate != 100 {
+		t.Error("expected repin options to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.RepinPeerRate = -1
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with negative repin_peer_rate")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.StatusCacheTTL = "5s"
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.StatusCacheTTL != 5*time.Second {
+		t.Error("expected status_cache_ttl to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.StatusCacheTTL = "-1s"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with negative status_cache_ttl")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.StateMaxStaleness = "30s"
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.StateMaxStaleness != 30*time.Second {
+		t.Error("expected state_max_staleness to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.StateMaxStaleness = "-1s"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with negative state_max_staleness")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.QuorumWaitTimeout != DefaultQuorumWaitTimeout {
+		t.Error("expected default quorum_wait_timeout")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.QuorumWaitTimeout = "0s"
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.QuorumWaitTimeout != 0 {
+		t.Error("expected quorum_wait_timeout to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.QuorumWaitTimeout = "-1s"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with negative quorum_wait_timeout")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.PinEventsTopic = "pin-events"
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.PinEventsTopic != "pin-events" {
+		t.Error("expected pin_events_topic to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.Follow = []followConfigJSON{
+		{
+			APIAddr:  "/dns4/cluster.example.org/tcp/9094",
+			SSL:      true,
+			Username: "user",
+		},
+	}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Follow) != 1 ||
+		!cfg.Follow[0].SSL ||
+		cfg.Follow[0].Username != "user" ||
+		cfg.Follow[0].PollInterval != DefaultFollowPollInterval {
+		t.Error("expected follow to be loaded with the default poll_interval")
+	}
+
+	j.Follow[0].APIAddr = "abc"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error parsing follow api_addr")
+	}
+
+	j.Follow[0].APIAddr = "/ip4/1.2.3.4/tcp/9094"
+	j.Follow[0].PollInterval = "-1s"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with negative follow poll_interval")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.Namespaces = map[string]namespaceConfigJSON{
+		"team-a": {ReplicationFactor: 2, MaxPins: 10, MaxBytes: 1024},
+	}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns, ok := cfg.Namespaces["team-a"]; !ok || ns.ReplicationFactor != 2 || ns.MaxPins != 10 || ns.MaxBytes != 1024 {
+		t.Error("expected namespaces to be loaded")
+	}
+
+	j.Namespaces["team/b"] = namespaceConfigJSON{}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with an invalid namespace name")
+	}
+
+	delete(j.Namespaces, "team/b")
+	j.Namespaces["team-a"] = namespaceConfigJSON{MaxPins: -1}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with negative max_pins")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.SyncJitter != DefaultSyncJitter {
+		t.Error("expected default sync_jitter")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.StateSyncInterval = "0s"
+	j.IPFSSyncInterval = "0s"
+	j.SyncJitter = "5s"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StateSyncInterval != 0 || cfg.IPFSSyncInterval != 0 ||
+		cfg.SyncJitter != 5*time.Second {
+		t.Error("expected disabled syncs and sync_jitter to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.SyncJitter = "-1s"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with negative sync_jitter")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.Consensus != DefaultConsensus {
+		t.Error("expected default consensus")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.Consensus = "crdt"
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.Consensus != "crdt" {
+		t.Error("expected consensus to be loaded")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.Consensus = "paxos"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with unknown consensus")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.AllocationStrategy != DefaultAllocationStrategy {
+		t.Error("expected default allocation strategy")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.AllocationStrategy = "numpin"
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.AllocationStrategy != "numpin" {
+		t.Error("expected allocation strategy to be loaded")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -163,4 +500,10 @@ func TestValidate(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.IPFSSyncInterval = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
@@ -1,9 +1,12 @@
 package ipfscluster
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,11 +15,14 @@ import (
 	"github.com/ipfs/ipfs-cluster/informer/numpin"
 	"github.com/ipfs/ipfs-cluster/monitor/basic"
 	"github.com/ipfs/ipfs-cluster/pintracker/maptracker"
+	"github.com/ipfs/ipfs-cluster/state"
 	"github.com/ipfs/ipfs-cluster/state/mapstate"
 	"github.com/ipfs/ipfs-cluster/test"
 
 	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 type mockComponent struct {
@@ -76,6 +82,9 @@ func (ipfs *mockConnector) PinLs(filter string) (map[string]api.IPFSPinStatus, e
 		return nil, errors.New("")
 	}
 	m := make(map[string]api.IPFSPinStatus)
+	if filter == "direct" {
+		m[test.TestCid1] = api.IPFSPinStatusDirect
+	}
 	return m, nil
 }
 
@@ -83,6 +92,41 @@ func (ipfs *mockConnector) ConnectSwarms() error                          { retu
 func (ipfs *mockConnector) ConfigKey(keypath string) (interface{}, error) { return nil, nil }
 func (ipfs *mockConnector) FreeSpace() (uint64, error)                    { return 100, nil }
 func (ipfs *mockConnector) RepoSize() (uint64, error)                     { return 0, nil }
+func (ipfs *mockConnector) BandwidthRate() (uint64, error)                { return 0, nil }
+func (ipfs *mockConnector) BlockPut(c *cid.Cid, data []byte) error        { return nil }
+func (ipfs *mockConnector) Cancel(c *cid.Cid) error                       { return nil }
+func (ipfs *mockConnector) SwarmPeers() ([]peer.ID, error) {
+	return []peer.ID{test.TestPeerID4, test.TestPeerID5}, nil
+}
+
+func (ipfs *mockConnector) Resolve(path string) (*cid.Cid, error) {
+	if path != test.TestPath {
+		return nil, errors.New("cannot resolve " + path)
+	}
+	return cid.Decode(test.TestCid1)
+}
+
+func (ipfs *mockConnector) Add(chunk api.AddChunk) ([]api.AddedOutput, error) {
+	if !chunk.Last {
+		return nil, nil
+	}
+	c, _ := cid.Decode(test.TestCid1)
+	return []api.AddedOutput{{Name: "file", Cid: c}}, nil
+}
+
+func (ipfs *mockConnector) BlockGet(c *cid.Cid) ([]byte, error) {
+	if c.String() != test.TestInlineCid {
+		return nil, errors.New("block not found")
+	}
+	return test.TestInlineData, nil
+}
+
+func (ipfs *mockConnector) ObjectSize(c *cid.Cid) (uint64, error) {
+	if c.String() != test.TestInlineCid {
+		return 0, errors.New("object not found")
+	}
+	return uint64(len(test.TestInlineData)), nil
+}
 
 func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, *mapstate.MapState, *maptracker.MapPinTracker) {
 	clusterCfg, _, _, consensusCfg, trackerCfg, monCfg, _ := testingConfigs()
@@ -101,7 +145,7 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, *mapstate
 	cl, err := NewCluster(
 		clusterCfg,
 		consensusCfg,
-		api,
+		[]API{api},
 		ipfs,
 		st,
 		tracker,
@@ -166,6 +210,76 @@ func TestClusterStateSync(t *testing.T) {
 	}
 }
 
+func TestClusterSubscribePinEvents(t *testing.T) {
+	cleanRaft()
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := cl.SubscribePinEvents(ctx)
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for pinned := false; !pinned; {
+		select {
+		case ev := <-events:
+			if !ev.Cid.Equals(c) {
+				t.Fatal("unexpected event for", ev.Cid)
+			}
+			pinned = ev.Status == api.TrackerStatusPinned
+		case <-timeout:
+			t.Fatal("expected a pinned event")
+		}
+	}
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("no more events were expected")
+		}
+	case <-time.After(time.Second):
+		t.Error("the channel should be closed when the context is cancelled")
+	}
+
+	if _, err := cl.SubscribeClusterPinEvents(context.Background()); err == nil {
+		t.Error("expected an error when no pubsub topic is set")
+	}
+}
+
+func TestClusterSyncStatus(t *testing.T) {
+	cleanRaft()
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	status := cl.SyncStatus()
+	if status.Peer != cl.id {
+		t.Error("expected this peer's ID")
+	}
+	if !status.State.Enabled || status.State.Interval != cl.config.StateSyncInterval {
+		t.Error("unexpected state sync info:", status.State)
+	}
+	if !status.IPFS.Enabled || status.IPFS.Interval != cl.config.IPFSSyncInterval {
+		t.Error("unexpected ipfs sync info:", status.IPFS)
+	}
+
+	cl.ipfsSyncLoop.trigger()
+	status = cl.SyncStatus()
+	if status.IPFS.Last.IsZero() {
+		t.Error("expected a last ipfs sync time")
+	}
+	if !status.State.Last.IsZero() {
+		t.Error("the state sync has not run")
+	}
+}
+
 func TestClusterID(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
@@ -185,6 +299,61 @@ func TestClusterID(t *testing.T) {
 	//}
 }
 
+func TestClusterResolveMultihash(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	// the inline block is only available as raw
+	inline, _ := cid.Decode(test.TestInlineCid)
+	c, available, err := cl.ResolveMultihash(inline.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available || c.String() != test.TestInlineCid {
+		t.Error("expected the raw cid:", c)
+	}
+
+	// unavailable content defaults to dag-pb (CIDv0)
+	c1, _ := cid.Decode(test.TestCid1)
+	c, available, err = cl.ResolveMultihash(c1.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available || c.String() != test.TestCid1 {
+		t.Error("expected the CIDv0:", c)
+	}
+
+	_, _, err = cl.ResolveMultihash([]byte("abcd"))
+	if err == nil {
+		t.Error("expected an error with a bad multihash")
+	}
+}
+
+func TestClusterPublicStatus(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+	<-cl.Ready()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	status, err := cl.PublicStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Peers != 1 || status.HealthyPeers != 1 || status.Pins != 1 {
+		t.Error("unexpected public status:", status)
+	}
+	if status.Health != api.PeerHealthOK {
+		t.Error("expected ok health")
+	}
+}
+
 func TestClusterPin(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
@@ -204,6 +373,62 @@ func TestClusterPin(t *testing.T) {
 	}
 }
 
+func TestClusterPinningDisabled(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+	cl.config.PinningEnabled = false
+
+	if cl.ID().PinningEnabled {
+		t.Error("ID should advertise that pinning is disabled")
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.ReplicationFactor = -1
+	err := cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	time.Sleep(time.Second)
+
+	if st := cl.tracker.Status(c).Status; st != api.TrackerStatusRemote {
+		t.Error("pin should be remote in a peer with pinning disabled:", st)
+	}
+}
+
+func TestClusterIPFSLocalPins(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	localPins, err := cl.IPFSLocalPins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(localPins) != 1 || localPins[0].Type != api.IPFSPinStatusDirect {
+		t.Fatalf("expected 1 direct pin: %+v", localPins)
+	}
+	if localPins[0].Tracked {
+		t.Error("the pin should not be tracked yet")
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.ReplicationFactor = -1
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	localPins, err = cl.IPFSLocalPins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !localPins[0].Tracked || !localPins[0].Allocated {
+		t.Error("the pin should be tracked and allocated to the peer")
+	}
+}
+
 func TestClusterPins(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
@@ -224,77 +449,264 @@ func TestClusterPins(t *testing.T) {
 	}
 }
 
-func TestClusterPinGet(t *testing.T) {
+func TestClusterPinsPage(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	names := map[string]string{
+		test.TestCid1: "b",
+		test.TestCid2: "c",
+		test.TestCid3: "a",
+	}
+	for c, name := range names {
+		h, _ := cid.Decode(c)
+		pin := api.PinCid(h)
+		pin.Name = name
+		if err := cl.Pin(pin); err != nil {
+			t.Fatal("pin should have worked:", err)
+		}
+	}
+
+	pins := cl.PinsPage(api.PinsPage{ByName: true, Offset: 1, Limit: 1})
+	if len(pins) != 1 || pins[0].Name != "b" {
+		t.Error("unexpected page sorted by name:", pins)
+	}
+
+	// Cid order: TestCid2, TestCid3, TestCid1
+	pins = cl.PinsPage(api.PinsPage{After: test.TestCid2})
+	if len(pins) != 2 || pins[0].Cid.String() != test.TestCid3 {
+		t.Error("unexpected page after cursor:", pins)
+	}
+
+	pins = cl.PinsPage(api.PinsPage{Offset: 5})
+	if len(pins) != 0 {
+		t.Error("offset beyond the end should give an empty page")
+	}
+}
+
+func TestClusterPinBatch(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	defer func(n int) { PinBatchSize = n }(PinBatchSize)
+	PinBatchSize = 2
+
+	pins := []api.Pin{}
+	for _, s := range []string{test.TestCid1, test.TestCid2, test.TestCid3} {
+		c, _ := cid.Decode(s)
+		pins = append(pins, api.PinCid(c))
+	}
+	n, err := cl.PinBatch(pins)
+	if err != nil {
+		t.Fatal("pin batch should have worked:", err)
+	}
+	if n != 3 {
+		t.Error("expected 3 committed pins, got", n)
+	}
+
+	if len(cl.Pins()) != 3 {
+		t.Fatal("all pins should be part of the state")
+	}
+}
+
+func TestClusterBatch(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
 	defer cl.Shutdown()
 
+	defer func(n int) { PinBatchSize = n }(PinBatchSize)
+	PinBatchSize = 2
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	c3, _ := cid.Decode(test.TestCid3)
+	err := cl.Pin(api.PinCid(c1))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	badNs := api.PinCid(c3)
+	badNs.Namespace = "nope"
+	results := cl.Batch([]api.BatchItem{
+		{Pin: api.PinCid(c1), Unpin: true},
+		{Pin: api.PinCid(c2)},
+		{Pin: badNs},
+		{Pin: api.PinCid(c3)},
+	})
+	if len(results) != 4 {
+		t.Fatal("expected a result for every item")
+	}
+	for i, r := range results {
+		if i == 2 {
+			if r.Error == "" {
+				t.Error("pinning in an unknown namespace should fail")
+			}
+			continue
+		}
+		if r.Error != "" {
+			t.Errorf("item %d should have worked: %s", i, r.Error)
+		}
+	}
+
+	pins := cl.Pins()
+	if len(pins) != 2 {
+		t.Fatal("expected 2 pins in the state:", pins)
+	}
+	for _, p := range pins {
+		if p.Cid.Equals(c1) {
+			t.Error("the first cid should have been unpinned")
+		}
+	}
+}
+
+func TestClusterReconcileEverywherePins(t *testing.T) {
+	cl, _, _, _, tracker := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
 	c, _ := cid.Decode(test.TestCid1)
-	err := cl.Pin(api.PinCid(c))
+	pin := api.PinCid(c)
+	pin.ReplicationFactor = -1
+	err := cl.Pin(pin)
 	if err != nil {
 		t.Fatal("pin should have worked:", err)
 	}
+	time.Sleep(time.Second)
 
-	pin, err := cl.PinGet(c)
+	// simulate a peer which has not picked up the pin yet
+	err = tracker.Untrack(c)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !pin.Cid.Equals(c) || pin.ReplicationFactor != -1 {
-		t.Error("the Pin does not look as expected")
+	time.Sleep(time.Second)
+	if tracker.Status(c).Status != api.TrackerStatusUnpinned {
+		t.Fatal("the pin should not be tracked")
 	}
 
-	c2, _ := cid.Decode(test.TestCid2)
-	_, err = cl.PinGet(c2)
-	if err == nil {
-		t.Fatal("expected an error")
+	cl.reconcileEverywherePins([]peer.ID{test.TestPeerID2}, []peer.ID{test.TestPeerID3})
+	time.Sleep(time.Second)
+	if st := tracker.Status(c).Status; st != api.TrackerStatusPinned {
+		t.Error("the pin everywhere should be tracked again:", st)
 	}
 }
 
-func TestClusterUnpin(t *testing.T) {
+func TestClusterPinInline(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
 	defer cl.Shutdown()
 
-	c, _ := cid.Decode(test.TestCid1)
-	err := cl.Unpin(c)
+	c, _ := cid.Decode(test.TestInlineCid)
+	pin := api.PinCid(c)
+	pin.ReplicationFactor = -1
+	pin.Inline = test.TestInlineData
+	err := cl.Pin(pin)
+	if err == nil {
+		t.Error("expected an error with inline content disabled")
+	}
+
+	cl.config.InlineMaxSize = 5
+	err = cl.Pin(pin)
+	if err == nil {
+		t.Error("expected an error with too large inline content")
+	}
+
+	cl.config.InlineMaxSize = 1024
+	pin.Inline = []byte("abc")
+	err = cl.Pin(pin)
+	if err == nil {
+		t.Error("expected an error with content not matching the cid")
+	}
+
+	pin.Inline = test.TestInlineData
+	err = cl.Pin(pin)
 	if err != nil {
 		t.Fatal("pin should have worked:", err)
 	}
 
-	// test an error case
-	cl.consensus.Shutdown()
-	err = cl.Unpin(c)
-	if err == nil {
-		t.Error("expected an error but things worked")
+	// re-pinning keeps the inline content
+	pin.Inline = nil
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	p, err := cl.PinGet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.Inline) != string(test.TestInlineData) {
+		t.Error("the pin should carry the inline content")
 	}
 }
 
-func TestClusterPeers(t *testing.T) {
+func TestClusterDuplicatePins(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
 	defer cl.Shutdown()
-	peers := cl.Peers()
-	if len(peers) != 1 {
-		t.Fatal("expected 1 peer")
+
+	c, _ := cid.Decode(test.TestCid1)
+	v1, _ := cid.Decode(test.TestCid1V1)
+	for _, h := range []*cid.Cid{c, v1} {
+		err := cl.Pin(api.PinCid(h))
+		if err != nil {
+			t.Fatal("pin should have worked:", err)
+		}
 	}
 
-	clusterCfg := &Config{}
-	clusterCfg.LoadJSON(testingClusterCfg)
-	if peers[0].ID != clusterCfg.ID {
-		t.Error("bad member")
+	dups, err := cl.DuplicatePins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dups) != 1 || len(dups[0].Pins) != 2 {
+		t.Fatal("expected one group of duplicates")
+	}
+
+	_, err = cl.MergeDuplicatePins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins := cl.Pins()
+	if len(pins) != 1 || len(pins[0].Aliases) != 1 {
+		t.Fatal("expected a single pin with an alias")
+	}
+	alias := v1
+	if pins[0].Cid.Equals(v1) {
+		alias = c
+	}
+
+	err = cl.Unpin(alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins = cl.Pins()
+	if len(pins) != 1 || len(pins[0].Aliases) != 0 {
+		t.Fatal("unpinning an alias should only remove the alias")
 	}
 }
 
-func TestVersion(t *testing.T) {
+func TestClusterMergeDuplicatePinsOnPin(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
 	defer cl.Shutdown()
-	if cl.Version() != Version {
-		t.Error("bad Version()")
+
+	cl.config.MergeDuplicatePins = true
+	c, _ := cid.Decode(test.TestCid1)
+	v1, _ := cid.Decode(test.TestCid1V1)
+	for _, h := range []*cid.Cid{c, v1} {
+		err := cl.Pin(api.PinCid(h))
+		if err != nil {
+			t.Fatal("pin should have worked:", err)
+		}
+	}
+
+	pins := cl.Pins()
+	if len(pins) != 1 || !pins[0].Cid.Equals(c) || !pins[0].HasAlias(v1) {
+		t.Error("the CIDv1 should have been added as an alias")
 	}
 }
 
-func TestClusterRecoverAllLocal(t *testing.T) {
+func TestClusterPinGet(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
 	defer cl.Shutdown()
@@ -305,16 +717,859 @@ func TestClusterRecoverAllLocal(t *testing.T) {
 		t.Fatal("pin should have worked:", err)
 	}
 
-	time.Sleep(time.Second)
-
-	recov, err := cl.RecoverAllLocal()
+	pin, err := cl.PinGet(c)
 	if err != nil {
-		t.Error("did not expect an error")
+		t.Fatal(err)
 	}
-	if len(recov) != 1 {
-		t.Fatal("there should be only one pin")
+	if !pin.Cid.Equals(c) || pin.ReplicationFactor != -1 {
+		t.Error("the Pin does not look as expected")
 	}
-	if recov[0].Status != api.TrackerStatusPinned {
-		t.Error("the pin should have been recovered")
+
+	c2, _ := cid.Decode(test.TestCid2)
+	_, err = cl.PinGet(c2)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestClusterStateStaleness(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	// A single peer is the leader, so its state is never stale.
+	cl.config.StateMaxStaleness = time.Second
+	_, err = cl.PinGet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterConsensusStatus(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	statuses, err := cl.ConsensusStatusAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatal("expected the status of one peer")
+	}
+	if statuses[0].Peer != cl.id || statuses[0].Leader != cl.id {
+		t.Error("this peer should be the leader:", statuses[0].Error)
+	}
+	if statuses[0].Lag != 0 {
+		t.Error("the leader should not lag")
+	}
+}
+
+func TestClusterStateVerify(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := cl.StateChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Pins != 1 || len(sum.Buckets) != state.ChecksumBuckets {
+		t.Error("unexpected checksum:", sum)
+	}
+
+	pins, err := cl.StateBucket(state.Bucket(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || !pins[0].Cid.Equals(c) {
+		t.Error("expected the pin in its bucket")
+	}
+	_, err = cl.StateBucket(state.ChecksumBuckets)
+	if err == nil {
+		t.Error("expected an error with an invalid bucket")
+	}
+
+	diffs, err := cl.StateVerify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Diverged() || diffs[0].Root != sum.Root {
+		t.Error("a single peer cannot diverge from itself:", diffs)
+	}
+}
+
+func TestClusterPeerMaintenance(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	err := cl.PeerMaintenance(cl.id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := cl.MaintenancePeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0] != cl.id {
+		t.Fatal("expected this peer to be in maintenance")
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.ReplicationFactor = 1
+	err = cl.Pin(pin)
+	if err == nil {
+		t.Error("expected an error as the only peer is in maintenance")
+	}
+
+	err = cl.PeerMaintenance(cl.id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Error("pin should have worked:", err)
+	}
+}
+
+func TestClusterSetLogLevel(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	defer cl.SetLogLevel("cluster", logLevel)
+	err := cl.SetLogLevel("cluster", "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cl.SetLogLevel("cluster", "notalevel")
+	if err == nil {
+		t.Error("expected an error with a bad level")
+	}
+
+	err = cl.SetLogLevel("", "debug")
+	if err == nil {
+		t.Error("expected an error without component")
+	}
+
+	err = cl.SetLogLevelAllPeers("cluster", "debug")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClusterRPCCall(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	res, err := cl.RPCCall("", "Cluster", "Version", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v api.Version
+	err = json.Unmarshal(res, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != Version {
+		t.Error("expected the cluster version")
+	}
+
+	_, err = cl.RPCCall("", "Cluster", "PinGet", []byte(`{"cid":"`+test.ErrorCid+`"}`))
+	if err == nil {
+		t.Error("expected an error for a non-pinned cid")
+	}
+
+	_, err = cl.RPCCall("", "Cluster", "DoesNotExist", nil)
+	if err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+
+	_, err = cl.RPCCall("", "Other", "Version", nil)
+	if err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+}
+
+func TestClusterScalingAdvice(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	adv, err := cl.ScalingAdvice()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a single idle peer cannot be removed
+	if adv.Action != api.ScalingNone {
+		t.Error("no scaling action expected:", adv)
+	}
+	if len(adv.Pressure) != 1 || adv.Pressure[0].Peer != cl.id {
+		t.Error("expected pressure information for this peer")
+	}
+	// the testing cluster uses the numpin informer
+	if len(adv.Reasons) != 1 {
+		t.Error("expected a note about missing freespace metrics")
+	}
+}
+
+func TestClusterAllocationHistory(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.ReplicationFactor = 1
+	err := cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	records, err := cl.AllocationHistory(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatal("expected one allocation record")
+	}
+	rec := records[0]
+	if len(rec.Allocations) != 1 || rec.Allocations[0] != cl.id {
+		t.Error("expected allocation on this peer")
+	}
+	if rec.Reason == "" || rec.Error != "" || rec.Peer != cl.id {
+		t.Error("unexpected allocation record:", rec)
+	}
+	if _, ok := rec.Metrics[cl.id]; !ok {
+		t.Error("the record should include this peer's metric")
+	}
+
+	// this pin will fail as there are not enough peers
+	pin.ReplicationFactor = 2
+	cl.Pin(pin)
+	records = cl.AllocationHistoryLocal(c)
+	if len(records) != 2 || records[1].Error == "" {
+		t.Error("expected a second record with an error")
+	}
+}
+
+func TestClusterAllocationDecisions(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	metric := func(p peer.ID, v string) api.Metric {
+		m := api.Metric{Name: "numpin", Peer: p, Value: v, Valid: true}
+		m.SetTTL(30)
+		return m
+	}
+	metrics := []api.Metric{
+		metric(test.TestPeerID1, "1"),
+		metric(test.TestPeerID2, "2"),
+		metric(test.TestPeerID3, "3"),
+	}
+	rec := api.AllocationRecord{
+		Cid:     c,
+		Metrics: make(map[peer.ID]string),
+		Vetoes:  make(map[peer.ID]string),
+	}
+
+	r, err := cl.decideAllocation(rec, 1, 1, []peer.ID{test.TestPeerID2}, nil, []peer.ID{test.TestPeerID3}, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Considered) != 3 {
+		t.Error("all peers with metrics should be considered")
+	}
+	if r.Vetoes[test.TestPeerID2] != "blacklisted" ||
+		r.Vetoes[test.TestPeerID3] != "in maintenance" {
+		t.Error("unexpected vetoes:", r.Vetoes)
+	}
+	if _, ok := r.Vetoes[test.TestPeerID1]; ok {
+		t.Error("the allocated peer should not be vetoed")
+	}
+
+	pin := api.PinCid(c)
+	pin.ReplicationFactor = 1
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	records, err := cl.AllocationDecisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || len(records[0].Considered) != 1 {
+		t.Fatal("expected one allocation decision considering this peer")
+	}
+	if len(cl.AllocationDecisionsLocal()) != 1 {
+		t.Error("expected one local allocation decision")
+	}
+}
+
+func TestClusterAllocationPreview(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin, err := cl.AllocationPreview(c, 0, 0)
+	if err != nil {
+		t.Fatal("preview should have worked:", err)
+	}
+	if !pin.Cid.Equals(c) || pin.ReplicationFactor != -1 {
+		t.Error("the Pin does not look as expected")
+	}
+
+	_, err = cl.AllocationPreview(c, 2, 1)
+	if err == nil {
+		t.Error("expected an error with rplMin > rplMax")
+	}
+
+	if len(cl.Pins()) != 0 {
+		t.Error("a preview should not modify the shared state")
+	}
+}
+
+func TestClusterSimulateAllocations(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	c3, _ := cid.Decode(test.TestCid3)
+	// wait for metrics to arrive
+	time.Sleep(time.Second)
+	pin := api.PinCid(c1)
+	pin.ReplicationFactor = 1
+	err := cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	pin2 := api.PinCid(c2)
+	pin2.ReplicationFactor = 1
+	pin3 := api.PinCid(c3)
+	pin3.ReplicationFactor = 2
+	sim, err := cl.SimulateAllocations([]api.Pin{pin2, pin3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sim.Records) != 2 || sim.Failed != 1 {
+		t.Fatalf("expected 2 records and 1 failure: %+v", sim)
+	}
+	if len(sim.Records[0].Allocations) != 1 || sim.Records[1].Error == "" {
+		t.Errorf("unexpected records: %+v", sim.Records)
+	}
+	if len(sim.Load) != 1 {
+		t.Fatal("expected the load of 1 peer")
+	}
+	if pl := sim.Load[0]; pl.Peer != cl.id || pl.Current != 1 || pl.Added != 1 {
+		t.Errorf("unexpected load: %+v", pl)
+	}
+}
+
+func TestSimulateAllocated(t *testing.T) {
+	metric := func(name string, p peer.ID, v string) api.Metric {
+		m := api.Metric{Name: name, Peer: p, Value: v, Valid: true}
+		m.SetTTL(30)
+		return m
+	}
+	metrics := []api.Metric{
+		metric("numpin", test.TestPeerID1, "10"),
+		metric("numpin", test.TestPeerID2, "10"),
+		metric("freespace", test.TestPeerID1, "1000"),
+		metric("freespace", test.TestPeerID2, "100"),
+		metric("reposize", test.TestPeerID1, "1000"),
+		metric("bandwidth", test.TestPeerID1, "1000"),
+	}
+
+	simulateAllocated(metrics, []peer.ID{test.TestPeerID1}, 300)
+	simulateAllocated(metrics, []peer.ID{test.TestPeerID2}, 300)
+	expected := []string{"11", "11", "700", "0", "1300", "1000"}
+	for i, m := range metrics {
+		if m.Value != expected[i] {
+			t.Errorf("%s of %s: expected %s and got %s", m.Name, m.Peer, expected[i], m.Value)
+		}
+	}
+}
+
+func TestClusterSetAllocationStrategy(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	err := cl.SetAllocationStrategy("numpin-tracked")
+	if err == nil {
+		t.Error("expected an error without a strategy builder")
+	}
+
+	cl.SetAllocationStrategyBuilder(func(name string) (Informer, PinAllocator, error) {
+		if name != "numpin-tracked" {
+			return nil, nil, errors.New("unknown allocation strategy")
+		}
+		cfg := &numpin.Config{}
+		cfg.Default()
+		cfg.Type = numpin.MetricTrackedPins
+		inf, err := numpin.NewInformer(cfg)
+		return inf, ascendalloc.NewAllocator(), err
+	})
+
+	err = cl.SetAllocationStrategy("abc")
+	if err == nil {
+		t.Error("expected an error with an unknown strategy")
+	}
+
+	err = cl.SetAllocationStrategy("numpin-tracked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.getInformer().Name() != "numpin-tracked" {
+		t.Error("the informer should have been replaced")
+	}
+
+	// the new informer sends its metric right away
+	time.Sleep(time.Second)
+	c, _ := cid.Decode(test.TestCid1)
+	_, err = cl.AllocationPreview(c, 1, 1)
+	if err != nil {
+		t.Error("allocation should use the new metrics:", err)
+	}
+}
+
+func TestClusterSetRuntimeConfig(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	err := cl.SetRuntimeConfig(api.RuntimeConfig{})
+	if err == nil {
+		t.Error("expected an error without options")
+	}
+
+	err = cl.SetRuntimeConfig(api.RuntimeConfig{
+		"cluster.secret": json.RawMessage(`"abc"`),
+	})
+	if err == nil {
+		t.Error("expected an error with an option which is not runtime-tunable")
+	}
+
+	// nothing is applied when a value is invalid
+	err = cl.SetRuntimeConfig(api.RuntimeConfig{
+		"cluster.allocation_filters.min_free_space": json.RawMessage("1024"),
+		"maptracker.concurrent_pins":                json.RawMessage("0"),
+	})
+	if err == nil {
+		t.Error("expected an error with an invalid value")
+	}
+	if cl.allocationFiltersConfig().MinFreeSpace != 0 {
+		t.Error("no option should have been changed")
+	}
+
+	err = cl.SetRuntimeConfig(api.RuntimeConfig{
+		"cluster.reallocation_threshold":            json.RawMessage("0.2"),
+		"cluster.allocation_filters.min_free_space": json.RawMessage("1024"),
+		"maptracker.concurrent_pins":                json.RawMessage("3"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.reallocationThreshold() != 0.2 || cl.allocationFiltersConfig().MinFreeSpace != 1024 {
+		t.Error("cluster options should have been changed")
+	}
+
+	// options of a tracker which is not in use are rejected
+	err = cl.SetRuntimeConfig(api.RuntimeConfig{
+		"stateless.concurrent_pins": json.RawMessage("3"),
+	})
+	if err == nil {
+		t.Error("expected an error with an option of another tracker")
+	}
+
+	informer := cl.getInformer().Name()
+	err = cl.SetRuntimeConfig(api.RuntimeConfig{
+		"cluster.disabled_informers": json.RawMessage(`["` + informer + `"]`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.informerEnabled(informer) || !cl.informerEnabled("tags") {
+		t.Error("only the allocation informer should be disabled")
+	}
+
+	err = cl.SetRuntimeConfigAllPeers(api.RuntimeConfig{
+		"cluster.pinning_enabled": json.RawMessage("false"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.pinningEnabled() || cl.ID().PinningEnabled {
+		t.Error("pinning should be disabled")
+	}
+}
+
+type discardAllFilter struct{}
+
+func (f discardAllFilter) MetricName() string { return "numpin" }
+func (f discardAllFilter) Filter(c *cid.Cid, size uint64, candidates []peer.ID, m map[peer.ID]api.Metric) []peer.ID {
+	return []peer.ID{}
+}
+
+func TestClusterAllocationFilters(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	// wait for metrics to arrive
+	time.Sleep(time.Second)
+	_, err := cl.AllocationPreview(c, 1, 1)
+	if err != nil {
+		t.Fatal("preview should have worked:", err)
+	}
+
+	cl.AddAllocationFilter(discardAllFilter{})
+	_, err = cl.AllocationPreview(c, 1, 1)
+	if err == nil {
+		t.Error("expected an error as all candidates are filtered")
+	}
+}
+
+func TestAllocationFiltersFromConfig(t *testing.T) {
+	chain := allocationFilters(AllocationFiltersConfig{})
+	if len(chain) != 0 {
+		t.Error("no filters should be enabled by default")
+	}
+
+	chain = allocationFilters(AllocationFiltersConfig{
+		MinFreeSpace: 1024,
+		MaxPinQueue:  10,
+		Tags:         map[string]string{"region": "eu"},
+	})
+	if len(chain) != 3 {
+		t.Fatal("expected three filters")
+	}
+	if chain[0].MetricName() != "freespace" ||
+		chain[1].MetricName() != "pinqueue" ||
+		chain[2].MetricName() != "tags" {
+		t.Error("unexpected filter chain")
+	}
+}
+
+func TestClusterReallocationThreshold(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	metric := func(p peer.ID, v string) api.Metric {
+		m := api.Metric{Name: "numpin", Peer: p, Value: v, Valid: true}
+		m.SetTTL(30)
+		return m
+	}
+	metrics := []api.Metric{
+		metric(test.TestPeerID1, "10"),
+		metric(test.TestPeerID2, "9"),
+		metric(test.TestPeerID3, "2"),
+	}
+	rec := func() api.AllocationRecord {
+		return api.AllocationRecord{Cid: c, Metrics: make(map[peer.ID]string), Vetoes: make(map[peer.ID]string)}
+	}
+	current := []peer.ID{test.TestPeerID1}
+
+	r, err := cl.decideAllocation(rec(), 1, 1, nil, current, nil, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Allocations[0] != test.TestPeerID1 {
+		t.Error("allocations should not move without a threshold")
+	}
+
+	cl.config.ReallocationThreshold = 0.9
+	r, err = cl.decideAllocation(rec(), 1, 1, nil, current, nil, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Allocations[0] != test.TestPeerID1 {
+		t.Error("improvement is below the threshold")
+	}
+
+	cl.config.ReallocationThreshold = 0.5
+	r, err = cl.decideAllocation(rec(), 1, 1, nil, current, nil, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Allocations) != 1 || r.Allocations[0] != test.TestPeerID3 {
+		t.Error("allocation should have moved to the best candidate")
+	}
+}
+
+func TestClusterMinFreeSpace(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	metric := func(name, v string) api.Metric {
+		m := api.Metric{Name: name, Peer: cl.id, Value: v, Valid: true}
+		m.SetTTL(30)
+		return m
+	}
+	metrics := []api.Metric{metric("numpin", "0")}
+	rec := func(size uint64) api.AllocationRecord {
+		c, _ := cid.Decode(test.TestCid1)
+		return api.AllocationRecord{Cid: c, Size: size, Metrics: make(map[peer.ID]string), Vetoes: make(map[peer.ID]string)}
+	}
+
+	cl.config.AllocationFilters.MinFreeSpace = 100
+	cl.monitor.LogMetric(metric("freespace", "110"))
+
+	_, err := cl.decideAllocation(rec(0), 1, 1, nil, nil, nil, metrics)
+	if err != nil {
+		t.Fatal("allocation should have worked:", err)
+	}
+
+	// the size of the item leaves less than 100 bytes
+	_, err = cl.decideAllocation(rec(20), 1, 1, nil, nil, nil, metrics)
+	if err == nil {
+		t.Fatal("expected an error as the only peer was excluded")
+	}
+	aerr, ok := err.(*api.AllocationError)
+	if !ok || aerr.Vetoes[cl.id] != "discarded by filters.MinFreeSpace filter" {
+		t.Error("the error should report the excluded peer:", err)
+	}
+
+	cl.config.AllocationFilters.MinFreeSpace = 0
+	_, err = cl.decideAllocation(rec(20), 1, 1, nil, nil, nil, metrics)
+	if err != nil {
+		t.Error("the filter should be disabled:", err)
+	}
+}
+
+func TestClusterAllocationSizeLookup(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestInlineCid)
+	if pin := cl.lookupSize(api.PinCid(c)); pin.Size != 0 {
+		t.Error("IPFS should not be asked by default")
+	}
+
+	pin := api.PinCid(c)
+	pin.Size = 5
+	cl.config.AllocationSizeLookup = true
+	if pin := cl.lookupSize(pin); pin.Size != 5 {
+		t.Error("the size given by the client should be kept")
+	}
+	if pin := cl.lookupSize(api.PinCid(c)); pin.Size != uint64(len(test.TestInlineData)) {
+		t.Error("the size should have been asked to IPFS")
+	}
+}
+
+func TestClusterWaitForIPFS(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	<-cl.Ready()
+	if h := cl.Health(); h.Status != api.PeerHealthOK {
+		t.Fatal("expected ok health:", h.Status)
+	}
+
+	defer func(d time.Duration) { IPFSRetryMinDelay = d }(IPFSRetryMinDelay)
+	IPFSRetryMinDelay = 100 * time.Millisecond
+
+	ipfs.returnError = true
+	go cl.waitForIPFS()
+	time.Sleep(50 * time.Millisecond)
+	if h := cl.Health(); h.Status != api.PeerHealthWaitingForIPFS {
+		t.Error("expected to be waiting for ipfs:", h.Status)
+	}
+	if id := cl.ID(); id.Health != api.PeerHealthWaitingForIPFS {
+		t.Error("the peer ID should report the health")
+	}
+
+	ipfs.returnError = false
+	time.Sleep(300 * time.Millisecond)
+	if h := cl.Health(); h.Status != api.PeerHealthOK {
+		t.Error("expected ok health once ipfs is available:", h.Status)
+	}
+}
+
+func TestClusterWaitForQuorum(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	// Pretend we restarted with a peerset where the other
+	// peer is gone.
+	addr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/1/ipfs/" + test.TestPeerID2.Pretty())
+	cl.config.Peers = []ma.Multiaddr{addr}
+	cl.readyB = false
+	defer func() { cl.readyB = true }()
+
+	cl.reconnectPeers()
+	h := cl.Health()
+	if h.Status != api.PeerHealthWaitingForQuorum {
+		t.Fatal("expected to be waiting for quorum:", h.Status)
+	}
+	if !strings.Contains(h.Error, "1 of 2") {
+		t.Error("expected the number of reachable peers:", h.Error)
+	}
+}
+
+func TestClusterUnpin(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Unpin(c)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	// test an error case
+	cl.consensus.Shutdown()
+	err = cl.Unpin(c)
+	if err == nil {
+		t.Error("expected an error but things worked")
+	}
+}
+
+func TestClusterPinMeta(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	sh1, _ := cid.Decode(test.TestCid2)
+	sh2, _ := cid.Decode(test.TestCid3)
+	pin := api.PinCid(c)
+	pin.Type = api.MetaType
+	err := cl.Pin(pin)
+	if err == nil {
+		t.Fatal("expected an error pinning a meta pin without shards")
+	}
+
+	pin.Shards = []*cid.Cid{sh1, sh2}
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	time.Sleep(time.Second)
+
+	info := cl.tracker.Status(c)
+	if info.Status != api.TrackerStatusPinned {
+		t.Error("meta pin should be pinned and is", info.Status)
+	}
+	info = cl.tracker.Status(sh2)
+	if info.Status != api.TrackerStatusPinned {
+		t.Error("shard should be pinned and is", info.Status)
+	}
+}
+
+func TestClusterCancelPin(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.CancelPin(c)
+	if err == nil {
+		t.Error("expected an error cancelling an item which is not pinned")
+	}
+
+	err = cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	time.Sleep(time.Second)
+
+	err = cl.CancelPin(c)
+	if err == nil {
+		t.Error("expected an error cancelling a completed pin")
+	}
+	if _, err := cl.PinGet(c); err != nil {
+		t.Error("a completed pin should not be removed by CancelPin")
+	}
+}
+
+func TestClusterPeers(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+	peers := cl.Peers()
+	if len(peers) != 1 {
+		t.Fatal("expected 1 peer")
+	}
+
+	clusterCfg := &Config{}
+	clusterCfg.LoadJSON(testingClusterCfg)
+	if peers[0].ID != clusterCfg.ID {
+		t.Error("bad member")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+	if cl.Version() != Version {
+		t.Error("bad Version()")
+	}
+}
+
+func TestClusterRecoverAllLocal(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	time.Sleep(time.Second)
+
+	recov, err := cl.RecoverAllLocal(nil)
+	if err != nil {
+		t.Error("did not expect an error")
+	}
+	if len(recov) != 1 {
+		t.Fatal("there should be only one pin")
+	}
+	if recov[0].Status != api.TrackerStatusPinned {
+		t.Error("the pin should have been recovered")
+	}
+
+	// only items in error are selected
+	recov, err = cl.RecoverAllLocal(api.StatusFilter{api.TrackerStatusPinError})
+	if err != nil {
+		t.Error("did not expect an error")
+	}
+	if len(recov) != 0 {
+		t.Error("no pins should match the filter")
 	}
 }
@@ -0,0 +1,126 @@
+package ipfscluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// ConnectGraph returns a description of the connectivity of the cluster:
+// the cluster peers reached by every cluster peer, the IPFS daemon of
+// every cluster peer and the swarm peers of those daemons. Peers which
+// cannot be contacted have no links.
+func (c *Cluster) ConnectGraph() (api.ConnectGraph, error) {
+	cg := api.ConnectGraph{
+		ClusterID:     c.id,
+		ClusterLinks:  make(map[peer.ID][]peer.ID),
+		IPFSLinks:     make(map[peer.ID][]peer.ID),
+		ClustertoIPFS: make(map[peer.ID]peer.ID),
+	}
+
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return cg, err
+	}
+
+	peersSerials := make([][]api.IDSerial, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members, "Cluster", "Peers", struct{}{},
+		copyIDSerialSliceToIfaces(peersSerials))
+
+	var ipfsMembers []peer.ID
+	for i, err := range errs {
+		p := members[i]
+		cg.ClusterLinks[p] = []peer.ID{}
+		if err != nil {
+			logger.Errorf("connect graph: cannot get peers of %s: %s", p.Pretty(), err)
+			continue
+		}
+
+		for _, idS := range peersSerials[i] {
+			id := idS.ToID()
+			if id.Error != "" {
+				continue
+			}
+			if id.ID != p {
+				cg.ClusterLinks[p] = append(cg.ClusterLinks[p], id.ID)
+				continue
+			}
+			// the peer itself carries the ID of its ipfs daemon
+			if id.IPFS.Error == "" && id.IPFS.ID != "" {
+				cg.ClustertoIPFS[p] = id.IPFS.ID
+				ipfsMembers = append(ipfsMembers, p)
+			}
+		}
+	}
+
+	swarms := make([][]peer.ID, len(ipfsMembers), len(ipfsMembers))
+	errs = c.broadcaster.Broadcast(ipfsMembers, "Cluster", "IPFSSwarmPeers", struct{}{},
+		copyPIDSliceToIfaces(swarms))
+	for i, err := range errs {
+		p := ipfsMembers[i]
+		ipfsID := cg.ClustertoIPFS[p]
+		if err != nil {
+			logger.Errorf("connect graph: cannot get ipfs swarm peers of %s: %s", p.Pretty(), err)
+			cg.IPFSLinks[ipfsID] = []peer.ID{}
+			continue
+		}
+		cg.IPFSLinks[ipfsID] = swarms[i]
+	}
+	return cg, nil
+}
+
+// PeersLiveness reports, for every cluster peer, the last ping metric
+// received from it by the peer monitor of the leader and the time taken
+// by an RPC request to it from this peer.
+func (c *Cluster) PeersLiveness() ([]api.PeerLiveness, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	lastPings := make(map[peer.ID]api.Metric)
+	var history []api.Metric
+	leader, err := c.consensus.Leader()
+	if err == nil {
+		err = c.rpcClient.Call(leader, "Cluster", "PeerMonitorMetricHistory", "ping", &history)
+	}
+	if err != nil {
+		logger.Errorf("liveness: cannot get the ping metrics from the leader: %s", err)
+	}
+	for _, m := range history {
+		// newest first for each peer
+		if _, ok := lastPings[m.Peer]; !ok {
+			lastPings[m.Peer] = m
+		}
+	}
+
+	lives := make([]api.PeerLiveness, len(members), len(members))
+	var wg sync.WaitGroup
+	for i, p := range members {
+		lives[i].Peer = p
+		if m, ok := lastPings[p]; ok {
+			lives[i].Alive = !m.Expired()
+			lives[i].LastMetric, _ = time.Parse(time.RFC3339Nano, m.Expire)
+		}
+
+		wg.Add(1)
+		go func(pl *api.PeerLiveness) {
+			defer wg.Done()
+			var v api.Version
+			start := time.Now()
+			err := c.rpcClient.Call(pl.Peer, "Cluster", "Version", struct{}{}, &v)
+			if err != nil {
+				pl.Error = err.Error()
+				return
+			}
+			pl.RTT = time.Since(start)
+		}(&lives[i])
+	}
+	wg.Wait()
+	return lives, nil
+}
@@ -0,0 +1,162 @@
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+var configKey = "crdt"
+
+// Configuration defaults
+var (
+	DefaultTopic               = "ipfs-cluster-crdt"
+	DefaultHeartbeatInterval   = 10 * time.Second
+	DefaultPeerTimeout         = 1 * time.Minute
+	DefaultRebroadcastInterval = 1 * time.Minute
+	DefaultTombstoneTTL        = 24 * time.Hour
+	DefaultStateFile           = "crdt-state.json"
+)
+
+// Config allows to configure the CRDT Consensus component for ipfs-cluster.
+// The component's configuration section is represented by jsonConfig.
+// Config implements the ComponentConfig interface.
+type Config struct {
+	config.Saver
+
+	// will shutdown libp2p host on shutdown. Useful for testing
+	hostShutdown bool
+
+	// Topic is the libp2p pubsub topic used to exchange state updates
+	// with the rest of the peers.
+	Topic string
+	// HeartbeatInterval specifies how often this peer announces
+	// itself to the rest.
+	HeartbeatInterval time.Duration
+	// PeerTimeout specifies how long a peer is considered part of
+	// the cluster after its last message.
+	PeerTimeout time.Duration
+	// RebroadcastInterval specifies how often the full state is
+	// published, so that peers which missed updates converge.
+	RebroadcastInterval time.Duration
+	// TombstoneTTL specifies how long removed pins are remembered.
+	// Peers offline for longer may bring them back when they return.
+	TombstoneTTL time.Duration
+	// StateFile is where the state is persisted. Relative paths are
+	// relative to the configuration folder.
+	StateFile string
+}
+
+type jsonConfig struct {
+	Topic               string `json:"topic"`
+	HeartbeatInterval   string `json:"heartbeat_interval"`
+	PeerTimeout         string `json:"peer_timeout"`
+	RebroadcastInterval string `json:"rebroadcast_interval"`
+	TombstoneTTL        string `json:"tombstone_ttl"`
+	StateFile           string `json:"state_file,omitempty"`
+}
+
+// ConfigKey returns a human-friendly indentifier for this Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this configuration with working defaults.
+func (cfg *Config) Default() error {
+	cfg.Topic = DefaultTopic
+	cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	cfg.PeerTimeout = DefaultPeerTimeout
+	cfg.RebroadcastInterval = DefaultRebroadcastInterval
+	cfg.TombstoneTTL = DefaultTombstoneTTL
+	cfg.StateFile = "" // empty so it gets omitted
+	return nil
+}
+
+// Validate checks that this configuration has working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	if cfg.Topic == "" {
+		return errors.New("crdt.topic is empty")
+	}
+
+	if cfg.HeartbeatInterval <= 0 {
+		return errors.New("crdt.heartbeat_interval is invalid")
+	}
+
+	if cfg.PeerTimeout <= cfg.HeartbeatInterval {
+		return errors.New("crdt.peer_timeout must be larger than heartbeat_interval")
+	}
+
+	if cfg.RebroadcastInterval <= 0 {
+		return errors.New("crdt.rebroadcast_interval is invalid")
+	}
+
+	if cfg.TombstoneTTL <= cfg.RebroadcastInterval {
+		return errors.New("crdt.tombstone_ttl must be larger than rebroadcast_interval")
+	}
+	return nil
+}
+
+// LoadJSON parses a json-encoded configuration (see jsonConfig).
+// The Config will have default values for all fields not explicited
+// in the given json object.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling crdt config")
+		return err
+	}
+
+	cfg.Default()
+
+	parseDuration := func(txt string) time.Duration {
+		d, _ := time.ParseDuration(txt)
+		if txt != "" && d == 0 {
+			logger.Warningf("%s is not a valid duration. Default will be used", txt)
+		}
+		return d
+	}
+
+	heartbeatInterval := parseDuration(jcfg.HeartbeatInterval)
+	peerTimeout := parseDuration(jcfg.PeerTimeout)
+	rebroadcastInterval := parseDuration(jcfg.RebroadcastInterval)
+	tombstoneTTL := parseDuration(jcfg.TombstoneTTL)
+
+	config.SetIfNotDefault(jcfg.Topic, &cfg.Topic)
+	config.SetIfNotDefault(heartbeatInterval, &cfg.HeartbeatInterval)
+	config.SetIfNotDefault(peerTimeout, &cfg.PeerTimeout)
+	config.SetIfNotDefault(rebroadcastInterval, &cfg.RebroadcastInterval)
+	config.SetIfNotDefault(tombstoneTTL, &cfg.TombstoneTTL)
+	config.SetIfNotDefault(jcfg.StateFile, &cfg.StateFile)
+
+	return cfg.Validate()
+}
+
+// ToJSON returns the pretty JSON representation of a Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+	jcfg.Topic = cfg.Topic
+	jcfg.HeartbeatInterval = cfg.HeartbeatInterval.String()
+	jcfg.PeerTimeout = cfg.PeerTimeout.String()
+	jcfg.RebroadcastInterval = cfg.RebroadcastInterval.String()
+	jcfg.TombstoneTTL = cfg.TombstoneTTL.String()
+	jcfg.StateFile = cfg.StateFile
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+// GetStateFile returns the path where the state is persisted. When
+// StateFile is not set, it is DefaultStateFile in the configuration folder.
+func (cfg *Config) GetStateFile() string {
+	if cfg.StateFile == "" {
+		return filepath.Join(cfg.BaseDir, DefaultStateFile)
+	}
+	if filepath.IsAbs(cfg.StateFile) {
+		return cfg.StateFile
+	}
+	return filepath.Join(cfg.BaseDir, cfg.StateFile)
+}
@@ -0,0 +1,110 @@
+package crdt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+    "topic": "test-topic",
+    "heartbeat_interval": "5s",
+    "peer_timeout": "30s",
+    "rebroadcast_interval": "2m0s",
+    "tombstone_ttl": "1h0m0s"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Topic != "test-topic" ||
+		cfg.HeartbeatInterval != 5*time.Second ||
+		cfg.PeerTimeout != 30*time.Second ||
+		cfg.RebroadcastInterval != 2*time.Minute ||
+		cfg.TombstoneTTL != time.Hour {
+		t.Error("config values not loaded")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.PeerTimeout = "1s"
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with peer_timeout < heartbeat_interval")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Topic = ""
+	j.HeartbeatInterval = "abc"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Topic != DefaultTopic || cfg.HeartbeatInterval != DefaultHeartbeatInterval {
+		t.Error("expected default values")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.RebroadcastInterval = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Topic = ""
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.TombstoneTTL = cfg.RebroadcastInterval
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestGetStateFile(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.SetBaseDir("/base")
+	if cfg.GetStateFile() != "/base/"+DefaultStateFile {
+		t.Error("expected default state file in base dir")
+	}
+	cfg.StateFile = "state.json"
+	if cfg.GetStateFile() != "/base/state.json" {
+		t.Error("expected relative state file in base dir")
+	}
+	cfg.StateFile = "/abs/state.json"
+	if cfg.GetStateFile() != "/abs/state.json" {
+		t.Error("expected absolute state file")
+	}
+}
@@ -0,0 +1,698 @@
+// Package crdt implements a Consensus component for IPFS Cluster which
+// replicates the shared state as a CRDT (a last-writer-wins map) over
+// libp2p pubsub. It needs no leader and peers can join and leave freely.
+package crdt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+	floodsub "github.com/libp2p/go-floodsub"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("consensus")
+
+type messageType int
+
+// Types of messages published on the topic
+const (
+	msgHeartbeat messageType = iota
+	msgDelta
+	msgFull
+	msgSyncRequest
+)
+
+// maxMessageSize is the maximum size of the states published at once.
+// Pubsub drops messages larger than 1MiB, so larger states are split
+// (see crdtState.split).
+const maxMessageSize = 512 * 1024
+
+type message struct {
+	Type  messageType `json:"type"`
+	State *crdtState  `json:"state,omitempty"`
+	// ID identifies a sync request.
+	ID string `json:"id,omitempty"`
+	// Reply is the ID of the sync request answered by a msgFull.
+	Reply string `json:"reply,omitempty"`
+}
+
+// Consensus handles the work of keeping a shared-state between
+// the peers of an IPFS Cluster. Updates are applied locally and
+// published to the rest of peers, which merge them in their own
+// copies. All copies converge regardless of the order in which
+// updates are received.
+type Consensus struct {
+	ctx    context.Context
+	cancel func()
+	config *Config
+
+	host   host.Host
+	pubsub *floodsub.PubSub
+	sub    *floodsub.Subscription
+
+	state state.State
+
+	mux      sync.Mutex
+	crdt     *crdtState
+	lastSeen map[peer.ID]time.Time
+	// sync requests which this peer will answer unless
+	// someone else does first
+	syncReplies map[string]*time.Timer
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+	readyCh   chan struct{}
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+}
+
+// NewConsensus builds a new CRDT Consensus component. The given state
+// is updated as the CRDT changes. Any previously persisted CRDT is
+// loaded into it.
+func NewConsensus(host host.Host, cfg *Config, st state.State, ps *floodsub.PubSub) (*Consensus, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	persisted, err := loadCrdtState(cfg.GetStateFile())
+	if err != nil {
+		logger.Error("error loading crdt state: ", err)
+		return nil, err
+	}
+
+	sub, err := ps.Subscribe(cfg.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cc := &Consensus{
+		ctx:         ctx,
+		cancel:      cancel,
+		config:      cfg,
+		host:        host,
+		pubsub:      ps,
+		sub:         sub,
+		state:       st,
+		crdt:        newCrdtState(),
+		lastSeen:    make(map[peer.ID]time.Time),
+		syncReplies: make(map[string]*time.Timer),
+		rpcReady:    make(chan struct{}, 1),
+		readyCh:     make(chan struct{}, 1),
+	}
+
+	cc.apply(persisted)
+
+	go cc.handleMessages()
+	go cc.run()
+	go cc.finishBootstrap()
+	return cc, nil
+}
+
+// WaitForSync asks the rest of peers to send their state. Only one
+// of them answers. It does not wait for the answer, as the state
+// converges on its own.
+func (cc *Consensus) WaitForSync() error {
+	id := fmt.Sprintf("%s-%d", peer.IDB58Encode(cc.host.ID()), time.Now().UnixNano())
+	return cc.publish(&message{Type: msgSyncRequest, ID: id})
+}
+
+// syncs the state to the tracker once RPC is ready
+func (cc *Consensus) finishBootstrap() {
+	err := cc.WaitForSync()
+	if err != nil {
+		logger.Error(err)
+	}
+
+	// While rpc is not ready we cannot perform a sync
+	select {
+	case <-cc.ctx.Done():
+		return
+	case <-cc.rpcReady:
+	}
+
+	var pInfoSerial []api.PinInfoSerial
+	cc.rpcClient.Go(
+		"",
+		"Cluster",
+		"StateSync",
+		struct{}{},
+		&pInfoSerial,
+		nil)
+	cc.readyCh <- struct{}{}
+	logger.Debug("consensus ready")
+}
+
+// Shutdown stops the component so it will not process any
+// more updates. The state is persisted to disk.
+func (cc *Consensus) Shutdown() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+
+	if cc.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping Consensus component")
+
+	cc.sub.Cancel()
+	cc.cancel()
+
+	cc.mux.Lock()
+	for id, t := range cc.syncReplies {
+		t.Stop()
+		delete(cc.syncReplies, id)
+	}
+	cc.mux.Unlock()
+
+	err := cc.save()
+	if err != nil {
+		logger.Error(err)
+	}
+
+	if cc.config.hostShutdown {
+		cc.host.Close()
+	}
+
+	cc.shutdown = true
+	return nil
+}
+
+// SetClient makes the component ready to perform RPC requets
+func (cc *Consensus) SetClient(c *rpc.Client) {
+	cc.rpcClient = c
+	select {
+	case cc.rpcReady <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// Ready returns a channel which is signaled when the Consensus
+// component has finished bootstrapping and is ready to use
+func (cc *Consensus) Ready() <-chan struct{} {
+	return cc.readyCh
+}
+
+func (cc *Consensus) run() {
+	heartbeat := time.NewTicker(cc.config.HeartbeatInterval)
+	defer heartbeat.Stop()
+	rebroadcast := time.NewTicker(cc.config.RebroadcastInterval)
+	defer rebroadcast.Stop()
+
+	for {
+		select {
+		case <-cc.ctx.Done():
+			return
+		case <-heartbeat.C:
+			err := cc.publish(&message{Type: msgHeartbeat})
+			if err != nil {
+				logger.Error(err)
+			}
+		case <-rebroadcast.C:
+			cc.mux.Lock()
+			n := cc.crdt.gc(cc.config.TombstoneTTL)
+			cc.mux.Unlock()
+			if n > 0 {
+				logger.Debugf("removed %d expired tombstones", n)
+			}
+			err := cc.publishFull("")
+			if err != nil {
+				logger.Error(err)
+			}
+			err = cc.save()
+			if err != nil {
+				logger.Error("error saving crdt state: ", err)
+			}
+		}
+	}
+}
+
+func (cc *Consensus) handleMessages() {
+	for {
+		msg, err := cc.sub.Next(cc.ctx)
+		if err != nil { // cancelled
+			return
+		}
+		from := peer.ID(msg.GetFrom())
+		if from == cc.host.ID() {
+			continue
+		}
+
+		var m message
+		err = json.Unmarshal(msg.Data, &m)
+		if err != nil {
+			logger.Warningf("bad crdt message from %s: %s", from.Pretty(), err)
+			continue
+		}
+
+		cc.mux.Lock()
+		cc.lastSeen[from] = time.Now()
+		cc.mux.Unlock()
+
+		switch m.Type {
+		case msgDelta, msgFull:
+			if m.Reply != "" {
+				cc.cancelSyncReply(m.Reply)
+			}
+			if m.State != nil {
+				cc.apply(m.State)
+			}
+		case msgSyncRequest:
+			cc.scheduleSyncReply(m.ID)
+		}
+	}
+}
+
+// scheduleSyncReply answers a sync request after a random delay of up
+// to a HeartbeatInterval, unless another peer answers it first. This
+// way a new peer does not get the full state from every other peer.
+func (cc *Consensus) scheduleSyncReply(id string) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	if _, ok := cc.syncReplies[id]; ok {
+		return
+	}
+	delay := time.Duration(rand.Int63n(int64(cc.config.HeartbeatInterval)))
+	cc.syncReplies[id] = time.AfterFunc(delay, func() {
+		cc.mux.Lock()
+		_, ok := cc.syncReplies[id]
+		delete(cc.syncReplies, id)
+		cc.mux.Unlock()
+		if !ok { // answered by someone else
+			return
+		}
+		err := cc.publishFull(id)
+		if err != nil {
+			logger.Error(err)
+		}
+	})
+}
+
+// cancelSyncReply forgets about answering a sync request.
+func (cc *Consensus) cancelSyncReply(id string) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	if t, ok := cc.syncReplies[id]; ok {
+		t.Stop()
+		delete(cc.syncReplies, id)
+	}
+}
+
+func (cc *Consensus) publish(m *message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return cc.pubsub.Publish(cc.config.Topic, data)
+}
+
+// publishState publishes a state, split in as many messages as
+// needed to respect maxMessageSize.
+func (cc *Consensus) publishState(t messageType, st *crdtState, reply string) error {
+	parts, err := st.split(maxMessageSize)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		err := cc.publish(&message{Type: t, State: part, Reply: reply})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishFull publishes the whole state. When answering a sync
+// request, reply is its ID.
+func (cc *Consensus) publishFull(reply string) error {
+	cc.mux.Lock()
+	st := cc.crdt.copy()
+	cc.mux.Unlock()
+	return cc.publishState(msgFull, st, reply)
+}
+
+func (cc *Consensus) save() error {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	return cc.crdt.save(cc.config.GetStateFile())
+}
+
+// apply merges the given CRDT into ours and updates the State
+// with the entries that won. The PinTracker is told to track
+// or untrack the items which changed.
+func (cc *Consensus) apply(in *crdtState) {
+	var track, untrack []api.PinSerial
+
+	cc.mux.Lock()
+	for k, e := range in.Pins {
+		if e.expired(cc.config.TombstoneTTL) {
+			// It may still delete an older entry here,
+			// but unknown items need no tombstone anymore.
+			if _, ok := cc.crdt.Pins[k]; !ok {
+				continue
+			}
+		}
+		if !cc.crdt.mergePin(k, e) {
+			continue
+		}
+		pin := e.Pin.ToPin()
+		if pin.Cid == nil {
+			logger.Warningf("ignoring bad crdt entry: %s", k)
+			continue
+		}
+		if e.Deleted {
+			if cc.state.Has(pin.Cid) {
+				cc.state.Rm(pin.Cid)
+				untrack = append(untrack, e.Pin)
+			}
+			continue
+		}
+		err := cc.state.Add(pin)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		track = append(track, e.Pin)
+	}
+	for k, e := range in.Maintenance {
+		if !cc.crdt.mergeMaintenance(k, e) {
+			continue
+		}
+		pid, err := peer.IDB58Decode(k)
+		if err != nil {
+			logger.Warningf("ignoring bad crdt entry: %s", k)
+			continue
+		}
+		cc.state.SetMaintenance(pid, e.Enabled)
+	}
+	if in.Clock > cc.crdt.Clock {
+		cc.crdt.Clock = in.Clock
+	}
+	cc.mux.Unlock()
+
+	if cc.rpcClient == nil { // StateSync will take care on bootstrap
+		return
+	}
+
+	cc.logPins(track, untrack)
+
+	// Async, we let the PinTracker take care of any problems
+	for _, p := range track {
+		cc.rpcClient.Go("",
+			"Cluster",
+			"Track",
+			p,
+			&struct{}{},
+			nil)
+	}
+	for _, p := range untrack {
+		cc.rpcClient.Go("",
+			"Cluster",
+			"Untrack",
+			p,
+			&struct{}{},
+			nil)
+	}
+}
+
+// logPins records the merged changes in the pin log of the peer. CRDT
+// updates have no global order, so the log numbers them itself as they
+// are recorded.
+func (cc *Consensus) logPins(pinned, unpinned []api.PinSerial) {
+	if len(pinned)+len(unpinned) == 0 {
+		return
+	}
+	entries := make([]api.PinLogEntrySerial, 0, len(pinned)+len(unpinned))
+	for _, p := range pinned {
+		entries = append(entries, api.PinLogEntrySerial{Op: api.PinLogPin, Pin: p})
+	}
+	for _, p := range unpinned {
+		entries = append(entries, api.PinLogEntrySerial{Op: api.PinLogUnpin, Pin: p})
+	}
+	err := cc.rpcClient.Call("",
+		"Cluster",
+		"PinLogAdd",
+		entries,
+		&struct{}{})
+	if err != nil {
+		logger.Error("error recording the pin log: ", err)
+	}
+}
+
+// commit applies a local update and publishes it.
+func (cc *Consensus) commit(delta *crdtState) error {
+	cc.shutdownLock.Lock() // do not shut down while committing
+	defer cc.shutdownLock.Unlock()
+	if cc.shutdown {
+		return errors.New("consensus is shutdown")
+	}
+	cc.apply(delta)
+	return cc.publishState(msgDelta, delta, "")
+}
+
+// newDelta returns an empty update with the next clock value.
+func (cc *Consensus) newDelta() *crdtState {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	delta := newCrdtState()
+	delta.Clock = cc.crdt.tick(0)
+	return delta
+}
+
+// logPin commits a delta with the given pin. Its RequestID is not stored
+// nor broadcasted.
+func (cc *Consensus) logPin(pin api.Pin, deleted bool) error {
+	pin.RequestID = ""
+	delta := cc.newDelta()
+	e := pinEntry{
+		Pin:     pin.ToSerial(),
+		Deleted: deleted,
+		Clock:   delta.Clock,
+		Peer:    peer.IDB58Encode(cc.host.ID()),
+	}
+	if deleted {
+		e.DeletedAt = time.Now().Unix()
+	}
+	delta.Pins[pin.Cid.String()] = e
+	return cc.commit(delta)
+}
+
+// LogPin adds a Cid to the shared state of the cluster.
+func (cc *Consensus) LogPin(pin api.Pin) error {
+	err := cc.logPin(pin, false)
+	if err != nil {
+		return err
+	}
+	logger.Infof("pin committed to global state: %s", pin.LogName())
+	return nil
+}
+
+// LogPinBatch adds several Cids to the shared state of the cluster
+// with a single update.
+func (cc *Consensus) LogPinBatch(pins []api.Pin) error {
+	delta := cc.newDelta()
+	author := peer.IDB58Encode(cc.host.ID())
+	for _, pin := range pins {
+		delta.Pins[pin.Cid.String()] = pinEntry{
+			Pin:   pin.ToSerial(),
+			Clock: delta.Clock,
+			Peer:  author,
+		}
+	}
+	err := cc.commit(delta)
+	if err != nil {
+		return err
+	}
+	logger.Infof("batch of %d pins committed to global state", len(pins))
+	return nil
+}
+
+// LogUnpin removes a Cid from the shared state of the cluster.
+func (cc *Consensus) LogUnpin(pin api.Pin) error {
+	err := cc.logPin(pin, true)
+	if err != nil {
+		return err
+	}
+	logger.Infof("unpin committed to global state: %s", pin.LogName())
+	return nil
+}
+
+// LogMaintenance sets or unsets the maintenance mode for a peer in the
+// shared state of the cluster.
+func (cc *Consensus) LogMaintenance(pm api.PeerMaintenance) error {
+	delta := cc.newDelta()
+	delta.Maintenance[peer.IDB58Encode(pm.Peer)] = maintenanceEntry{
+		Enabled: pm.Enabled,
+		Clock:   delta.Clock,
+		Peer:    peer.IDB58Encode(cc.host.ID()),
+	}
+	err := cc.commit(delta)
+	if err != nil {
+		return err
+	}
+	logger.Infof("maintenance mode for %s committed to global state: %t",
+		pm.Peer, pm.Enabled)
+	return nil
+}
+
+// AddNonVoter is a no-op, like AddPeer. There are no votes
+// in this consensus.
+func (cc *Consensus) AddNonVoter(pid peer.ID) error {
+	return nil
+}
+
+// Voter returns true. There are no votes in this consensus, so
+// every peer takes part in it equally.
+func (cc *Consensus) Voter() bool {
+	return true
+}
+
+// AddPeer is a no-op. Peers become part of the consensus as soon
+// as they are heard from.
+func (cc *Consensus) AddPeer(pid peer.ID) error {
+	return nil
+}
+
+// RmPeer forgets about a peer. It will be part of the consensus
+// again if it keeps publishing updates.
+func (cc *Consensus) RmPeer(pid peer.ID) error {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	delete(cc.lastSeen, pid)
+	return nil
+}
+
+// State returns the current State. It reflects all the updates
+// received by this peer so far.
+func (cc *Consensus) State() (state.State, error) {
+	return cc.state, nil
+}
+
+// Leader returns the peer with the lowest ID among the current Peers.
+// There are no elections in this consensus, but the tasks which only
+// the leader performs (i.e. re-pinning the content of lost peers or
+// following other clusters) must not run in every peer at once, so
+// this peer acts as their coordinator. Peers which see the same peerset
+// agree on it.
+func (cc *Consensus) Leader() (peer.ID, error) {
+	peers, err := cc.Peers()
+	if err != nil {
+		return "", err
+	}
+	return peers[0], nil
+}
+
+// Clean removes the persisted state from disk. Next time
+// a full new peer will be bootstrapped.
+func (cc *Consensus) Clean() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+	if !cc.shutdown {
+		return errors.New("consensus component is not shutdown")
+	}
+
+	err := os.Remove(cc.config.GetStateFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	logger.Info("consensus data cleaned")
+	return nil
+}
+
+// Snapshot saves the current state to disk. There is no log to compact.
+func (cc *Consensus) Snapshot() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+	if cc.shutdown {
+		return errors.New("consensus is shutdown")
+	}
+	return cc.save()
+}
+
+// LastContact returns the last time a message from another peer
+// was received. Since peers may come and go, a peer which has not
+// heard from anyone yet is considered up to date and the current
+// time is returned.
+func (cc *Consensus) LastContact() time.Time {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	if len(cc.lastSeen) == 0 {
+		return time.Now()
+	}
+	var last time.Time
+	for _, t := range cc.lastSeen {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// Status returns the clock of the state as commit and applied
+// index. There are no terms.
+func (cc *Consensus) Status() api.ConsensusStatus {
+	cc.mux.Lock()
+	clock := cc.crdt.Clock
+	cc.mux.Unlock()
+	leader, _ := cc.Leader()
+	return api.ConsensusStatus{
+		Peer:         cc.host.ID(),
+		Leader:       leader,
+		Voter:        true,
+		CommitIndex:  clock,
+		AppliedIndex: clock,
+		LastContact:  cc.LastContact(),
+	}
+}
+
+// Peers returns this peer and those heard from within PeerTimeout.
+// The list will be sorted alphabetically.
+func (cc *Consensus) Peers() ([]peer.ID, error) {
+	cc.shutdownLock.Lock()
+	shutdown := cc.shutdown
+	cc.shutdownLock.Unlock()
+	if shutdown {
+		return nil, errors.New("consensus is shutdown")
+	}
+
+	cc.mux.Lock()
+	pids := []string{peer.IDB58Encode(cc.host.ID())}
+	for p, t := range cc.lastSeen {
+		if time.Since(t) > cc.config.PeerTimeout {
+			delete(cc.lastSeen, p)
+			continue
+		}
+		pids = append(pids, peer.IDB58Encode(p))
+	}
+	cc.mux.Unlock()
+
+	sort.Strings(pids)
+
+	peers := []peer.ID{}
+	for _, p := range pids {
+		id, err := peer.IDB58Decode(p)
+		if err != nil {
+			panic("could not decode peer")
+		}
+		peers = append(peers, id)
+	}
+	return peers, nil
+}
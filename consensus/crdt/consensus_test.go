@@ -0,0 +1,507 @@
+package crdt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	floodsub "github.com/libp2p/go-floodsub"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	ma "github.com/multiformats/go-multiaddr"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+var p2pPort = 12000
+var p2pPortAlt = 13000
+
+func stateFile(port int) string {
+	return fmt.Sprintf("crdtStateFromTests%d.json", port)
+}
+
+func cleanState(port int) {
+	os.Remove(stateFile(port))
+}
+
+func makeTestingHost(t *testing.T, port int) host.Host {
+	priv, pub, _ := crypto.GenerateKeyPair(crypto.RSA, 2048)
+	pid, _ := peer.IDFromPublicKey(pub)
+	maddr, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port))
+	ps := peerstore.NewPeerstore()
+	ps.AddPubKey(pid, pub)
+	ps.AddPrivKey(pid, priv)
+	ps.AddAddr(pid, maddr, peerstore.PermanentAddrTTL)
+	n, _ := swarm.NewNetwork(
+		context.Background(),
+		[]ma.Multiaddr{maddr},
+		pid, ps, nil)
+	return basichost.New(n)
+}
+
+func testingConsensus(t *testing.T, port int) *Consensus {
+	h := makeTestingHost(t, port)
+	st := mapstate.NewMapState()
+	ps, err := floodsub.NewFloodSub(context.Background(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.StateFile = stateFile(port)
+	cfg.HeartbeatInterval = 200 * time.Millisecond
+	cfg.hostShutdown = true
+
+	cc, err := NewConsensus(h, cfg, st, ps)
+	if err != nil {
+		t.Fatal("cannot create Consensus:", err)
+	}
+	cc.SetClient(test.NewMockRPCClientWithHost(t, h))
+	<-cc.Ready()
+	return cc
+}
+
+func connect(t *testing.T, cc, cc2 *Consensus) {
+	err := cc.host.Connect(context.Background(), peerstore.PeerInfo{
+		ID:    cc2.host.ID(),
+		Addrs: cc2.host.Addrs(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// let floodsub learn about the topics
+	time.Sleep(time.Second)
+}
+
+func TestShutdownConsensus(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+	err := cc.Shutdown()
+	if err != nil {
+		t.Fatal("Consensus cannot shutdown:", err)
+	}
+	err = cc.Shutdown() // should be fine to shutdown twice
+	if err != nil {
+		t.Fatal("Consensus should be able to shutdown several times")
+	}
+	// should not block or panic
+	cc.SetClient(test.NewMockRPCClient(t))
+	if _, err := cc.Peers(); err == nil {
+		t.Error("expected an error listing the peers of a shutdown consensus")
+	}
+}
+
+func TestConsensusPin(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort) // Remember defer runs in LIFO order
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+	if err != nil {
+		t.Error("the operation did not make it to the state:", err)
+	}
+
+	st, err := cc.State()
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+
+	pins := st.List()
+	if len(pins) != 1 || pins[0].Cid.String() != test.TestCid1 {
+		t.Error("the added pin should be in the state")
+	}
+
+	err = cc.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Error("the operation did not make it to the state:", err)
+	}
+	if st.Has(c) {
+		t.Error("the pin should have been removed")
+	}
+}
+
+func TestConsensusPinRequestID(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1, RequestID: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc.mux.Lock()
+	entry := cc.crdt.Pins[test.TestCid1]
+	cc.mux.Unlock()
+	if entry.Pin.RequestID != "" {
+		t.Error("the request ID should not be stored")
+	}
+}
+
+func TestConsensusPinBatch(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+	defer cc.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	err := cc.LogPinBatch([]api.Pin{api.PinCid(c1), api.PinCid(c2)})
+	if err != nil {
+		t.Error("the operation did not make it to the state:", err)
+	}
+
+	st, err := cc.State()
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+	if len(st.List()) != 2 || !st.Has(c1) || !st.Has(c2) {
+		t.Error("the added pins should be in the state")
+	}
+}
+
+func TestConsensusLogMaintenance(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+	defer cc.Shutdown()
+
+	err := cc.LogMaintenance(api.PeerMaintenance{Peer: test.TestPeerID1, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cc.State()
+	peers := st.MaintenancePeers()
+	if len(peers) != 1 || peers[0] != test.TestPeerID1 {
+		t.Error("expected peer in maintenance mode")
+	}
+}
+
+func TestConsensusLeader(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+	defer cc.Shutdown()
+
+	l, err := cc.Leader()
+	if err != nil {
+		t.Fatal("No leader:", err)
+	}
+	if l != cc.host.ID() {
+		t.Errorf("expected %s as leader but got %s", cc.host.ID(), l)
+	}
+}
+
+func TestConsensusLastContact(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+	defer cc.Shutdown()
+
+	// no other peers seen yet
+	if time.Since(cc.LastContact()) > time.Second {
+		t.Error("a lonely peer should be up to date")
+	}
+
+	seen := time.Now().Add(-time.Minute)
+	cc.mux.Lock()
+	cc.lastSeen[test.TestPeerID1] = seen
+	cc.mux.Unlock()
+	if !cc.LastContact().Equal(seen) {
+		t.Error("expected the last time a peer was seen")
+	}
+}
+
+func TestConsensusReplication(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	cc2 := testingConsensus(t, p2pPortAlt)
+	defer cleanState(p2pPort)
+	defer cleanState(p2pPortAlt)
+	defer cc.Shutdown()
+	defer cc2.Shutdown()
+
+	connect(t, cc, cc2)
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	st2, _ := cc2.State()
+	if !st2.Has(c) {
+		t.Fatal("the pin should have been replicated")
+	}
+
+	err = cc2.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	st, _ := cc.State()
+	if st.Has(c) {
+		t.Error("the unpin should have been replicated")
+	}
+
+	peers, err := cc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 {
+		t.Error("expected 2 peers")
+	}
+
+	l, err := cc.Leader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := cc2.Leader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != l2 || l != peers[0] {
+		t.Errorf("both peers should agree on %s as leader but got %s and %s", peers[0], l, l2)
+	}
+
+	err = cc.RmPeer(cc2.host.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsensusSyncRequest(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+
+	// Not connected when the pin happened
+	cc2 := testingConsensus(t, p2pPortAlt)
+	defer cleanState(p2pPortAlt)
+	defer cc2.Shutdown()
+	connect(t, cc, cc2)
+
+	err := cc2.WaitForSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	st2, _ := cc2.State()
+	if !st2.Has(c) {
+		t.Error("the state should have been synced")
+	}
+}
+
+// testingPins returns n pins with distinct cids.
+func testingPins(n int) []api.Pin {
+	pins := make([]api.Pin, n)
+	for i := range pins {
+		h, _ := multihash.Sum([]byte(fmt.Sprintf("pin-%d", i)), multihash.SHA2_256, -1)
+		pins[i] = api.Pin{
+			Cid:               cid.NewCidV1(cid.DagProtobuf, h),
+			Name:              fmt.Sprintf("pin-%d", i),
+			ReplicationFactor: -1,
+		}
+	}
+	return pins
+}
+
+func TestConsensusSyncLargeState(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+	defer cc.Shutdown()
+
+	pins := testingPins(5000)
+	err := cc.LogPinBatch(pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc.mux.Lock()
+	full := cc.crdt.copy()
+	cc.mux.Unlock()
+	data, _ := json.Marshal(&message{Type: msgFull, State: full})
+	if len(data) <= 1024*1024 {
+		t.Fatal("the state should not fit in a single pubsub message")
+	}
+
+	cc2 := testingConsensus(t, p2pPortAlt)
+	defer cleanState(p2pPortAlt)
+	defer cc2.Shutdown()
+	connect(t, cc, cc2)
+
+	err = cc2.WaitForSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st2, _ := cc2.State()
+	for i := 0; i < 20 && len(st2.List()) != len(pins); i++ {
+		time.Sleep(500 * time.Millisecond)
+	}
+	if n := len(st2.List()); n != len(pins) {
+		t.Errorf("expected %d pins in the synced state, got %d", len(pins), n)
+	}
+}
+
+func TestStateSplit(t *testing.T) {
+	st := newCrdtState()
+	st.Clock = 7
+	for i, pin := range testingPins(1000) {
+		st.Pins[pin.Cid.String()] = pinEntry{Pin: pin.ToSerial(), Clock: uint64(i)}
+	}
+	st.Maintenance["a"] = maintenanceEntry{Enabled: true, Clock: 3}
+
+	parts, err := st.split(16 * 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 2 {
+		t.Fatal("expected several parts")
+	}
+
+	merged := newCrdtState()
+	for _, part := range parts {
+		data, _ := json.Marshal(&message{Type: msgFull, State: part})
+		if len(data) > 16*1024 {
+			t.Errorf("part too large: %d bytes", len(data))
+		}
+		if part.Clock != st.Clock {
+			t.Error("all parts should carry the clock")
+		}
+		for k, e := range part.Pins {
+			merged.mergePin(k, e)
+		}
+		for k, e := range part.Maintenance {
+			merged.mergeMaintenance(k, e)
+		}
+	}
+	if len(merged.Pins) != len(st.Pins) || len(merged.Maintenance) != 1 {
+		t.Error("the parts should contain the whole state")
+	}
+}
+
+func TestTombstoneGC(t *testing.T) {
+	st := newCrdtState()
+	c, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	c3, _ := cid.Decode(test.TestCid3)
+	old := time.Now().Add(-2 * time.Hour).Unix()
+	st.Pins[test.TestCid1] = pinEntry{Pin: api.PinCid(c).ToSerial(), Deleted: true, DeletedAt: old}
+	st.Pins[test.TestCid2] = pinEntry{Pin: api.PinCid(c2).ToSerial(), Deleted: true, DeletedAt: time.Now().Unix()}
+	st.Pins[test.TestCid3] = pinEntry{Pin: api.PinCid(c3).ToSerial()}
+
+	if n := st.gc(time.Hour); n != 1 {
+		t.Fatalf("expected 1 tombstone removed, got %d", n)
+	}
+	if _, ok := st.Pins[test.TestCid1]; ok {
+		t.Error("the expired tombstone should have been removed")
+	}
+	if len(st.Pins) != 2 {
+		t.Error("the rest of entries should be kept")
+	}
+}
+
+func TestConsensusPersistence(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanState(p2pPort)
+
+	c, _ := cid.Decode(test.TestCid1)
+	cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+	cc.Shutdown()
+
+	cc = testingConsensus(t, p2pPort)
+	st, _ := cc.State()
+	if !st.Has(c) {
+		t.Error("the state should have been loaded from disk")
+	}
+	cc.Shutdown()
+
+	err := cc.Clean()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stateFile(p2pPort)); !os.IsNotExist(err) {
+		t.Error("expected state file to be removed")
+	}
+}
+
+func TestMergeLastWriterWins(t *testing.T) {
+	st := newCrdtState()
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c).ToSerial()
+
+	if !st.mergePin(test.TestCid1, pinEntry{Pin: pin, Clock: 2, Peer: "a"}) {
+		t.Error("first entry should win")
+	}
+	if st.mergePin(test.TestCid1, pinEntry{Pin: pin, Deleted: true, Clock: 1, Peer: "b"}) {
+		t.Error("older entry should not win")
+	}
+	if !st.mergePin(test.TestCid1, pinEntry{Pin: pin, Deleted: true, Clock: 2, Peer: "b"}) {
+		t.Error("ties should be won by the largest peer")
+	}
+	if !st.Pins[test.TestCid1].Deleted || st.Clock != 2 {
+		t.Error("unexpected state after merging")
+	}
+	if st.tick(5) != 6 {
+		t.Error("clock should move past the seen value")
+	}
+}
+
+func TestSaveStateLastState(t *testing.T) {
+	defer cleanState(p2pPort)
+	cfg := &Config{}
+	cfg.Default()
+	cfg.StateFile = stateFile(p2pPort)
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	ms := mapstate.NewMapState()
+	ms.Add(api.Pin{Cid: c1, ReplicationFactor: -1})
+	err := SaveState(cfg, ms, test.TestPeerID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms = mapstate.NewMapState()
+	ms.Add(api.Pin{Cid: c2, ReplicationFactor: -1})
+	ms.SetMaintenance(test.TestPeerID2, true)
+	err = SaveState(cfg, ms, test.TestPeerID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := LastState(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Has(c1) || !st.Has(c2) {
+		t.Error("the saved state should have replaced the previous one")
+	}
+	if len(st.MaintenancePeers()) != 1 {
+		t.Error("expected one peer in maintenance mode")
+	}
+
+	cc := testingConsensus(t, p2pPort)
+	defer cc.Shutdown()
+	st2, _ := cc.State()
+	if st2.Has(c1) || !st2.Has(c2) {
+		t.Error("the saved state should be loaded on start")
+	}
+}
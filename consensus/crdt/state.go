@@ -0,0 +1,302 @@
+package crdt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// pinEntry is an element of the last-writer-wins map of pins. Removed
+// pins are kept as tombstones so that older additions do not
+// resurrect them, until they expire (see Config.TombstoneTTL).
+type pinEntry struct {
+	Pin     api.PinSerial `json:"pin"`
+	Deleted bool          `json:"deleted,omitempty"`
+	// DeletedAt is the Unix time when the pin was removed.
+	DeletedAt int64  `json:"deleted_at,omitempty"`
+	Clock     uint64 `json:"clock"`
+	Peer      string `json:"peer"`
+}
+
+// expired returns true for tombstones older than the given ttl.
+func (e pinEntry) expired(ttl time.Duration) bool {
+	if !e.Deleted || e.DeletedAt == 0 {
+		return false
+	}
+	return time.Since(time.Unix(e.DeletedAt, 0)) > ttl
+}
+
+// maintenanceEntry is an element of the last-writer-wins map of peers
+// in maintenance mode.
+type maintenanceEntry struct {
+	Enabled bool   `json:"enabled"`
+	Clock   uint64 `json:"clock"`
+	Peer    string `json:"peer"`
+}
+
+// newer returns true when an update with the given clock and author
+// wins over the existing one. Ties are broken by peer ID so that every
+// peer picks the same winner.
+func newer(clock uint64, pid string, curClock uint64, curPid string) bool {
+	if clock != curClock {
+		return clock > curClock
+	}
+	return pid > curPid
+}
+
+// crdtState is the replicated state: a last-writer-wins map of pins
+// keyed by Cid and another one for the maintenance mode keyed by peer.
+// It is what gets exchanged between peers and persisted to disk.
+type crdtState struct {
+	Clock       uint64                      `json:"clock"`
+	Pins        map[string]pinEntry         `json:"pins,omitempty"`
+	Maintenance map[string]maintenanceEntry `json:"maintenance,omitempty"`
+}
+
+func newCrdtState() *crdtState {
+	return &crdtState{
+		Pins:        make(map[string]pinEntry),
+		Maintenance: make(map[string]maintenanceEntry),
+	}
+}
+
+func loadCrdtState(path string) (*crdtState, error) {
+	st := newCrdtState()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, st)
+	if err != nil {
+		return nil, err
+	}
+	if st.Pins == nil {
+		st.Pins = make(map[string]pinEntry)
+	}
+	if st.Maintenance == nil {
+		st.Maintenance = make(map[string]maintenanceEntry)
+	}
+	// Tombstones saved by older versions expire from now on.
+	now := time.Now().Unix()
+	for k, e := range st.Pins {
+		if e.Deleted && e.DeletedAt == 0 {
+			e.DeletedAt = now
+			st.Pins[k] = e
+		}
+	}
+	return st, nil
+}
+
+func (st *crdtState) save(path string) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// copy returns a copy of the state which can be used
+// without holding any locks.
+func (st *crdtState) copy() *crdtState {
+	cp := newCrdtState()
+	cp.Clock = st.Clock
+	for k, v := range st.Pins {
+		cp.Pins[k] = v
+	}
+	for k, v := range st.Maintenance {
+		cp.Maintenance[k] = v
+	}
+	return cp
+}
+
+// split divides the state in parts which encode to less than max
+// bytes each (unless a single entry is larger). Entries are merged
+// one by one, so each part can be applied on its own. All parts carry
+// the clock and the first one has the maintenance entries.
+func (st *crdtState) split(max int) ([]*crdtState, error) {
+	newPart := func() *crdtState {
+		part := newCrdtState()
+		part.Clock = st.Clock
+		return part
+	}
+
+	empty, err := json.Marshal(newPart())
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []*crdtState
+	part := newPart()
+	for k, e := range st.Maintenance {
+		part.Maintenance[k] = e
+	}
+	data, err := json.Marshal(part)
+	if err != nil {
+		return nil, err
+	}
+	size := len(data) + len(`,"pins":{}`)
+
+	for k, e := range st.Pins {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		entrySize := len(k) + len(data) + 4 // quotes, colon and comma
+		if len(part.Pins) > 0 && size+entrySize > max {
+			parts = append(parts, part)
+			part = newPart()
+			size = len(empty) + len(`,"pins":{}`)
+		}
+		part.Pins[k] = e
+		size += entrySize
+	}
+	return append(parts, part), nil
+}
+
+// gc removes the tombstones older than ttl and returns how many
+// were removed.
+func (st *crdtState) gc(ttl time.Duration) int {
+	n := 0
+	for k, e := range st.Pins {
+		if e.expired(ttl) {
+			delete(st.Pins, k)
+			n++
+		}
+	}
+	return n
+}
+
+// tick advances the clock, taking into account the clocks
+// seen from other peers.
+func (st *crdtState) tick(seen uint64) uint64 {
+	if seen > st.Clock {
+		st.Clock = seen
+	}
+	st.Clock++
+	return st.Clock
+}
+
+// mergePin applies an entry and returns true if it won.
+func (st *crdtState) mergePin(key string, e pinEntry) bool {
+	cur, ok := st.Pins[key]
+	if ok && !newer(e.Clock, e.Peer, cur.Clock, cur.Peer) {
+		return false
+	}
+	st.Pins[key] = e
+	if e.Clock > st.Clock {
+		st.Clock = e.Clock
+	}
+	return true
+}
+
+// mergeMaintenance applies an entry and returns true if it won.
+func (st *crdtState) mergeMaintenance(key string, e maintenanceEntry) bool {
+	cur, ok := st.Maintenance[key]
+	if ok && !newer(e.Clock, e.Peer, cur.Clock, cur.Peer) {
+		return false
+	}
+	st.Maintenance[key] = e
+	if e.Clock > st.Clock {
+		st.Clock = e.Clock
+	}
+	return true
+}
+
+// LastState returns the state persisted by a CRDT Consensus component
+// using the given configuration. It should not be running.
+func LastState(cfg *Config) (*mapstate.MapState, error) {
+	cst, err := loadCrdtState(cfg.GetStateFile())
+	if err != nil {
+		return nil, err
+	}
+
+	ms := mapstate.NewMapState()
+	for k, e := range cst.Pins {
+		if e.Deleted {
+			continue
+		}
+		pin := e.Pin.ToPin()
+		if pin.Cid == nil {
+			logger.Warningf("ignoring bad crdt entry: %s", k)
+			continue
+		}
+		ms.Add(pin)
+	}
+	for k, e := range cst.Maintenance {
+		if !e.Enabled {
+			continue
+		}
+		pid, err := peer.IDB58Decode(k)
+		if err != nil {
+			logger.Warningf("ignoring bad crdt entry: %s", k)
+			continue
+		}
+		ms.SetMaintenance(pid, true)
+	}
+	return ms, nil
+}
+
+// SaveState replaces the state persisted by a CRDT Consensus component
+// using the given configuration, so that it is loaded next time it
+// starts. The changes are attributed to the given peer and win over
+// anything persisted before.
+func SaveState(cfg *Config, st state.State, pid peer.ID) error {
+	path := cfg.GetStateFile()
+	cst, err := loadCrdtState(path)
+	if err != nil {
+		return err
+	}
+
+	clock := cst.tick(0)
+	author := peer.IDB58Encode(pid)
+	now := time.Now().Unix()
+
+	for k, e := range cst.Pins {
+		if e.Deleted {
+			continue
+		}
+		e.Deleted = true
+		e.DeletedAt = now
+		e.Clock = clock
+		e.Peer = author
+		cst.Pins[k] = e
+	}
+	for k, e := range cst.Maintenance {
+		e.Enabled = false
+		e.Clock = clock
+		e.Peer = author
+		cst.Maintenance[k] = e
+	}
+
+	for _, pin := range st.List() {
+		cst.Pins[pin.Cid.String()] = pinEntry{
+			Pin:   pin.ToSerial(),
+			Clock: clock,
+			Peer:  author,
+		}
+	}
+	for _, p := range st.MaintenancePeers() {
+		cst.Maintenance[peer.IDB58Encode(p)] = maintenanceEntry{
+			Enabled: true,
+			Clock:   clock,
+			Peer:    author,
+		}
+	}
+
+	return cst.save(path)
+}
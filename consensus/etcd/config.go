@@ -0,0 +1,154 @@
+package etcd
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+var configKey = "etcd"
+
+// Configuration defaults
+var (
+	DefaultEndpoints      = []string{"127.0.0.1:2379"}
+	DefaultPrefix         = "/ipfs-cluster"
+	DefaultDialTimeout    = 5 * time.Second
+	DefaultRequestTimeout = 10 * time.Second
+	DefaultSessionTTL     = 10 * time.Second
+)
+
+// Config allows to configure the etcd Consensus component for ipfs-cluster.
+// The component's configuration section is represented by jsonConfig.
+// Config implements the ComponentConfig interface.
+type Config struct {
+	config.Saver
+
+	// will shutdown libp2p host on shutdown. Useful for testing
+	hostShutdown bool
+
+	// Endpoints lists the client URLs of the etcd cluster.
+	Endpoints []string
+	// Prefix is prepended to every key written by this component.
+	// All the peers of a cluster must use the same one, and different
+	// clusters can share an etcd cluster by using different ones.
+	Prefix string
+	// Username and Password authenticate against etcd, when set.
+	Username string
+	Password string
+	// DialTimeout is the maximum time to establish a connection
+	// to etcd.
+	DialTimeout time.Duration
+	// RequestTimeout is the maximum time for any request to etcd.
+	RequestTimeout time.Duration
+	// SessionTTL specifies how long a peer is considered part of the
+	// cluster (and leader, if it is) after losing contact with etcd.
+	SessionTTL time.Duration
+}
+
+type jsonConfig struct {
+	Endpoints      []string `json:"endpoints"`
+	Prefix         string   `json:"prefix"`
+	Username       string   `json:"username,omitempty"`
+	Password       string   `json:"password,omitempty"`
+	DialTimeout    string   `json:"dial_timeout"`
+	RequestTimeout string   `json:"request_timeout"`
+	SessionTTL     string   `json:"session_ttl"`
+}
+
+// ConfigKey returns a human-friendly indentifier for this Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this configuration with working defaults.
+func (cfg *Config) Default() error {
+	cfg.Endpoints = DefaultEndpoints
+	cfg.Prefix = DefaultPrefix
+	cfg.Username = ""
+	cfg.Password = ""
+	cfg.DialTimeout = DefaultDialTimeout
+	cfg.RequestTimeout = DefaultRequestTimeout
+	cfg.SessionTTL = DefaultSessionTTL
+	return nil
+}
+
+// Validate checks that this configuration has working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	if len(cfg.Endpoints) == 0 {
+		return errors.New("etcd.endpoints is empty")
+	}
+
+	if !strings.HasPrefix(cfg.Prefix, "/") || strings.HasSuffix(cfg.Prefix, "/") {
+		return errors.New("etcd.prefix must start and not end with /")
+	}
+
+	if cfg.DialTimeout <= 0 {
+		return errors.New("etcd.dial_timeout is invalid")
+	}
+
+	if cfg.RequestTimeout <= 0 {
+		return errors.New("etcd.request_timeout is invalid")
+	}
+
+	// etcd leases are granted in seconds
+	if cfg.SessionTTL < time.Second {
+		return errors.New("etcd.session_ttl must be at least 1s")
+	}
+	return nil
+}
+
+// LoadJSON parses a json-encoded configuration (see jsonConfig).
+// The Config will have default values for all fields not explicited
+// in the given json object.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling etcd config")
+		return err
+	}
+
+	cfg.Default()
+
+	parseDuration := func(txt string) time.Duration {
+		d, _ := time.ParseDuration(txt)
+		if txt != "" && d == 0 {
+			logger.Warningf("%s is not a valid duration. Default will be used", txt)
+		}
+		return d
+	}
+
+	dialTimeout := parseDuration(jcfg.DialTimeout)
+	requestTimeout := parseDuration(jcfg.RequestTimeout)
+	sessionTTL := parseDuration(jcfg.SessionTTL)
+
+	if len(jcfg.Endpoints) > 0 {
+		cfg.Endpoints = jcfg.Endpoints
+	}
+	config.SetIfNotDefault(jcfg.Prefix, &cfg.Prefix)
+	config.SetIfNotDefault(jcfg.Username, &cfg.Username)
+	config.SetIfNotDefault(jcfg.Password, &cfg.Password)
+	config.SetIfNotDefault(dialTimeout, &cfg.DialTimeout)
+	config.SetIfNotDefault(requestTimeout, &cfg.RequestTimeout)
+	config.SetIfNotDefault(sessionTTL, &cfg.SessionTTL)
+
+	return cfg.Validate()
+}
+
+// ToJSON returns the pretty JSON representation of a Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+	jcfg.Endpoints = cfg.Endpoints
+	jcfg.Prefix = cfg.Prefix
+	jcfg.Username = cfg.Username
+	jcfg.Password = cfg.Password
+	jcfg.DialTimeout = cfg.DialTimeout.String()
+	jcfg.RequestTimeout = cfg.RequestTimeout.String()
+	jcfg.SessionTTL = cfg.SessionTTL.String()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
@@ -0,0 +1,102 @@
+package etcd
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+    "endpoints": ["127.0.0.1:12379", "127.0.0.1:22379"],
+    "prefix": "/test-cluster",
+    "dial_timeout": "2s",
+    "request_timeout": "3s",
+    "session_ttl": "4s"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Endpoints) != 2 ||
+		cfg.Prefix != "/test-cluster" ||
+		cfg.DialTimeout != 2*time.Second ||
+		cfg.RequestTimeout != 3*time.Second ||
+		cfg.SessionTTL != 4*time.Second {
+		t.Error("config values not loaded")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Prefix = "/test-cluster/"
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with a trailing slash in the prefix")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.SessionTTL = "500ms"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with session_ttl < 1s")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Endpoints = nil
+	j.Prefix = ""
+	j.DialTimeout = "abc"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Endpoints) != len(DefaultEndpoints) ||
+		cfg.Prefix != DefaultPrefix ||
+		cfg.DialTimeout != DefaultDialTimeout {
+		t.Error("expected default values")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Prefix != "/test-cluster" {
+		t.Error("expected the prefix to be kept")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Endpoints = []string{}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RequestTimeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
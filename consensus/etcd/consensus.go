@@ -0,0 +1,817 @@
+// Package etcd implements a Consensus component for IPFS Cluster which
+// delegates the shared state to an external etcd cluster. Cluster peers
+// keep no consensus data on disk: they read the pinset from etcd on
+// start and follow its changes with a watch.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("consensus")
+
+// maxTxnOps is the default maximum number of operations that etcd
+// accepts in a single transaction.
+var maxTxnOps = 128
+
+// Consensus handles the work of keeping a shared-state between
+// the peers of an IPFS Cluster. The state lives in etcd, which
+// provides the ordering of the updates. Every peer keeps a copy of
+// it which follows the changes under the configured prefix.
+type Consensus struct {
+	ctx    context.Context
+	cancel func()
+	config *Config
+
+	host   host.Host
+	client *clientv3.Client
+
+	state state.State
+
+	mux         sync.Mutex
+	session     *concurrency.Session
+	election    *concurrency.Election
+	rev         int64 // etcd revision reflected in the state
+	lastRev     int64 // last etcd revision seen
+	term        uint64
+	lastContact time.Time
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+	readyCh   chan struct{}
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+}
+
+// NewConsensus builds a new etcd Consensus component. The given state
+// is replaced with the one stored in etcd and updated as it changes.
+func NewConsensus(host host.Host, cfg *Config, st state.State) (*Consensus, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		logger.Error("error connecting to etcd: ", err)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cc := &Consensus{
+		ctx:      ctx,
+		cancel:   cancel,
+		config:   cfg,
+		host:     host,
+		client:   client,
+		state:    st,
+		rpcReady: make(chan struct{}, 1),
+		readyCh:  make(chan struct{}, 1),
+	}
+
+	err = cc.resync()
+	if err == nil {
+		err = cc.startSession()
+	}
+	if err != nil {
+		logger.Error("error bootstrapping from etcd: ", err)
+		cancel()
+		client.Close()
+		return nil, err
+	}
+
+	go cc.watch()
+	go cc.run()
+	go cc.finishBootstrap()
+	return cc, nil
+}
+
+func pinsPrefix(cfg *Config) string {
+	return cfg.Prefix + "/pins/"
+}
+
+func maintenancePrefix(cfg *Config) string {
+	return cfg.Prefix + "/maintenance/"
+}
+
+func peersPrefix(cfg *Config) string {
+	return cfg.Prefix + "/peers/"
+}
+
+func electionPrefix(cfg *Config) string {
+	return cfg.Prefix + "/leader"
+}
+
+func pinKey(cfg *Config, c *cid.Cid) string {
+	return pinsPrefix(cfg) + c.String()
+}
+
+func maintenanceKey(cfg *Config, p peer.ID) string {
+	return maintenancePrefix(cfg) + peer.IDB58Encode(p)
+}
+
+func peerKey(cfg *Config, p peer.ID) string {
+	return peersPrefix(cfg) + peer.IDB58Encode(p)
+}
+
+// requestCtx returns a context for a single request to etcd.
+func (cc *Consensus) requestCtx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(cc.ctx, cc.config.RequestTimeout)
+}
+
+// startSession obtains a lease which keeps this peer registered in
+// etcd while it is alive and campaigns for leadership with it.
+func (cc *Consensus) startSession() error {
+	session, err := concurrency.NewSession(
+		cc.client,
+		concurrency.WithTTL(int(cc.config.SessionTTL/time.Second)),
+		concurrency.WithContext(cc.ctx))
+	if err != nil {
+		return err
+	}
+	election := concurrency.NewElection(session, electionPrefix(cc.config))
+
+	cc.mux.Lock()
+	cc.session = session
+	cc.election = election
+	cc.mux.Unlock()
+
+	_, err = cc.heartbeat(true)
+	if err != nil {
+		session.Close()
+		return err
+	}
+
+	go func() {
+		err := election.Campaign(cc.ctx, peer.IDB58Encode(cc.host.ID()))
+		if err != nil && cc.ctx.Err() == nil {
+			logger.Error("error campaigning for leadership: ", err)
+			return
+		}
+		logger.Debug("elected as leader")
+	}()
+	return nil
+}
+
+// heartbeat updates the key which registers this peer, attached to the
+// session lease. Unless create is set, the key is only updated when it
+// exists, so that peers removed with RmPeer do not register again. It
+// returns the revision of the update, or 0 when nothing was written.
+func (cc *Consensus) heartbeat(create bool) (int64, error) {
+	cc.mux.Lock()
+	lease := cc.session.Lease()
+	cc.mux.Unlock()
+
+	key := peerKey(cc.config, cc.host.ID())
+	put := clientv3.OpPut(
+		key,
+		time.Now().UTC().Format(time.RFC3339Nano),
+		clientv3.WithLease(lease))
+
+	ctx, cancel := cc.requestCtx()
+	defer cancel()
+	txn := cc.client.Txn(ctx)
+	if !create {
+		txn = txn.If(clientv3.Compare(clientv3.Version(key), ">", 0))
+	}
+	resp, err := txn.Then(put).Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, nil
+	}
+	cc.seen(resp.Header.Revision, resp.Header.RaftTerm)
+	return resp.Header.Revision, nil
+}
+
+// seen records the latest revision and term known from etcd.
+func (cc *Consensus) seen(rev int64, term uint64) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	if rev > cc.lastRev {
+		cc.lastRev = rev
+	}
+	if term > cc.term {
+		cc.term = term
+	}
+}
+
+// WaitForSync only returns when the state includes all the updates
+// made in etcd before it was called.
+func (cc *Consensus) WaitForSync() error {
+	rev, err := cc.heartbeat(false)
+	if err != nil {
+		return err
+	}
+	if rev == 0 { // we are not registered
+		return cc.resync()
+	}
+	return cc.waitForRevision(rev)
+}
+
+// waitForRevision waits until the state reflects the given etcd
+// revision.
+func (cc *Consensus) waitForRevision(rev int64) error {
+	ctx, cancel := cc.requestCtx()
+	defer cancel()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		cc.mux.Lock()
+		applied := cc.rev
+		cc.mux.Unlock()
+		if applied >= rev {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.New("timed out waiting for the state to sync with etcd")
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncs the state to the tracker once RPC is ready
+func (cc *Consensus) finishBootstrap() {
+	// While rpc is not ready we cannot perform a sync
+	select {
+	case <-cc.ctx.Done():
+		return
+	case <-cc.rpcReady:
+	}
+
+	var pInfoSerial []api.PinInfoSerial
+	cc.rpcClient.Go(
+		"",
+		"Cluster",
+		"StateSync",
+		struct{}{},
+		&pInfoSerial,
+		nil)
+	cc.readyCh <- struct{}{}
+	logger.Debug("consensus ready")
+}
+
+// Shutdown stops the component so it will not process any more
+// updates. This peer is unregistered from etcd and resigns
+// leadership if it held it.
+func (cc *Consensus) Shutdown() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+
+	if cc.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping Consensus component")
+
+	cc.mux.Lock()
+	session := cc.session
+	cc.mux.Unlock()
+
+	// Revoking the lease removes our peer key and our leadership.
+	ctx, cancel := context.WithTimeout(context.Background(), cc.config.RequestTimeout)
+	_, err := cc.client.Revoke(ctx, session.Lease())
+	cancel()
+	if err != nil {
+		logger.Error("error revoking etcd lease: ", err)
+	}
+
+	cc.cancel()
+	session.Close()
+
+	err = cc.client.Close()
+	if err != nil {
+		logger.Error(err)
+	}
+
+	if cc.config.hostShutdown {
+		cc.host.Close()
+	}
+
+	cc.shutdown = true
+	return nil
+}
+
+// SetClient makes the component ready to perform RPC requets
+func (cc *Consensus) SetClient(c *rpc.Client) {
+	cc.rpcClient = c
+	select {
+	case cc.rpcReady <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// Ready returns a channel which is signaled when the Consensus
+// component has finished bootstrapping and is ready to use
+func (cc *Consensus) Ready() <-chan struct{} {
+	return cc.readyCh
+}
+
+// run refreshes our peer key regularly, so that LastContact and Status
+// can tell how far behind etcd the state is, and starts a new session
+// when the current one expires (i.e. after losing contact with etcd).
+func (cc *Consensus) run() {
+	ticker := time.NewTicker(cc.config.SessionTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		cc.mux.Lock()
+		sessionDone := cc.session.Done()
+		cc.mux.Unlock()
+
+		select {
+		case <-cc.ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := cc.heartbeat(false)
+			if err != nil {
+				logger.Error("error sending heartbeat to etcd: ", err)
+			}
+		case <-sessionDone:
+			if cc.ctx.Err() != nil {
+				return
+			}
+			logger.Warning("etcd session expired. Starting a new one")
+			err := cc.startSession()
+			if err != nil {
+				logger.Error("error starting etcd session: ", err)
+				// wait and retry
+				select {
+				case <-cc.ctx.Done():
+				case <-time.After(cc.config.DialTimeout):
+				}
+			}
+		}
+	}
+}
+
+// watch follows the changes under the prefix and applies them to the
+// state. When etcd has compacted the revisions we need, or the watch
+// fails, the whole state is read again.
+func (cc *Consensus) watch() {
+	for {
+		cc.mux.Lock()
+		rev := cc.rev
+		cc.mux.Unlock()
+
+		wch := cc.client.Watch(
+			clientv3.WithRequireLeader(cc.ctx),
+			cc.config.Prefix+"/",
+			clientv3.WithPrefix(),
+			clientv3.WithRev(rev+1))
+
+		for wresp := range wch {
+			if wresp.CompactRevision != 0 {
+				logger.Warningf("etcd compacted revision %d. Reading the full state", wresp.CompactRevision)
+				break
+			}
+			if err := wresp.Err(); err != nil {
+				logger.Error("error watching etcd: ", err)
+				break
+			}
+			cc.seen(wresp.Header.Revision, wresp.Header.RaftTerm)
+			cc.applyEvents(wresp.Events)
+		}
+
+		if cc.ctx.Err() != nil {
+			return
+		}
+
+		err := cc.resync()
+		if err != nil {
+			logger.Error("error reading the state from etcd: ", err)
+			select {
+			case <-cc.ctx.Done():
+				return
+			case <-time.After(cc.config.DialTimeout):
+			}
+		}
+	}
+}
+
+// applyEvents updates the State with the given changes. The PinTracker
+// is told to track or untrack the items which changed. All the changes
+// made in a transaction share its revision, and come in the same watch
+// response, so the applied revision is only updated once all of them
+// are in the state.
+func (cc *Consensus) applyEvents(events []*clientv3.Event) {
+	var track, untrack []api.PinSerial
+	ownKey := peerKey(cc.config, cc.host.ID())
+
+	cc.mux.Lock()
+	applied := cc.rev
+	last := cc.rev
+	for _, ev := range events {
+		if ev.Kv.ModRevision <= applied { // already in the state
+			continue
+		}
+		if ev.Kv.ModRevision > last {
+			last = ev.Kv.ModRevision
+		}
+		key := string(ev.Kv.Key)
+		put := ev.Type == mvccpb.PUT
+
+		switch {
+		case strings.HasPrefix(key, pinsPrefix(cc.config)):
+			if !put {
+				c, err := cid.Decode(strings.TrimPrefix(key, pinsPrefix(cc.config)))
+				if err != nil {
+					logger.Warningf("ignoring bad etcd key: %s", key)
+					continue
+				}
+				if cc.state.Has(c) {
+					cc.state.Rm(c)
+					untrack = append(untrack, api.PinCid(c).ToSerial())
+				}
+				continue
+			}
+			var pin api.PinSerial
+			err := json.Unmarshal(ev.Kv.Value, &pin)
+			if err != nil || pin.Cid == "" {
+				logger.Warningf("ignoring bad etcd entry: %s", key)
+				continue
+			}
+			err = cc.state.Add(pin.ToPin())
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			track = append(track, pin)
+		case strings.HasPrefix(key, maintenancePrefix(cc.config)):
+			pid, err := peer.IDB58Decode(strings.TrimPrefix(key, maintenancePrefix(cc.config)))
+			if err != nil {
+				logger.Warningf("ignoring bad etcd key: %s", key)
+				continue
+			}
+			cc.state.SetMaintenance(pid, put)
+		case key == ownKey && put:
+			// we have caught up with our last heartbeat
+			cc.lastContact = time.Now()
+		}
+	}
+	cc.rev = last
+	cc.mux.Unlock()
+
+	cc.logPins(last, track, untrack)
+	cc.track(track, untrack)
+}
+
+// resync reads the full state from etcd and replaces ours with it.
+func (cc *Consensus) resync() error {
+	ctx, cancel := cc.requestCtx()
+	defer cancel()
+	resp, err := cc.client.Get(ctx, cc.config.Prefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	cc.seen(resp.Header.Revision, resp.Header.RaftTerm)
+
+	pins, maintenance := decodeState(cc.config, resp.Kvs)
+
+	var track, untrack, added []api.PinSerial
+
+	cc.mux.Lock()
+	for _, pin := range cc.state.List() {
+		if _, ok := pins[pin.Cid.String()]; !ok {
+			cc.state.Rm(pin.Cid)
+			untrack = append(untrack, pin.ToSerial())
+		}
+	}
+	for _, pin := range pins {
+		p := pin.ToPin()
+		had := cc.state.Has(p.Cid)
+		err := cc.state.Add(p)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		track = append(track, pin)
+		if !had {
+			added = append(added, pin)
+		}
+	}
+	for _, p := range cc.state.MaintenancePeers() {
+		if _, ok := maintenance[p]; !ok {
+			cc.state.SetMaintenance(p, false)
+		}
+	}
+	for p := range maintenance {
+		cc.state.SetMaintenance(p, true)
+	}
+	cc.rev = resp.Header.Revision
+	cc.lastContact = time.Now()
+	cc.mux.Unlock()
+
+	// Only the changes go to the pin log. The rest are tracked again.
+	cc.logPins(resp.Header.Revision, added, untrack)
+	cc.track(track, untrack)
+	return nil
+}
+
+// logPins records the changes applied at the given revision in the pin
+// log of the peer, numbered with it. The call is synchronous so that
+// they are recorded in the order in which they are applied.
+func (cc *Consensus) logPins(rev int64, pinned, unpinned []api.PinSerial) {
+	if cc.rpcClient == nil || len(pinned)+len(unpinned) == 0 {
+		return
+	}
+	entries := make([]api.PinLogEntrySerial, 0, len(pinned)+len(unpinned))
+	for _, p := range pinned {
+		entries = append(entries, api.PinLogEntrySerial{Seq: uint64(rev), Op: api.PinLogPin, Pin: p})
+	}
+	for _, p := range unpinned {
+		entries = append(entries, api.PinLogEntrySerial{Seq: uint64(rev), Op: api.PinLogUnpin, Pin: p})
+	}
+	err := cc.rpcClient.Call("",
+		"Cluster",
+		"PinLogAdd",
+		entries,
+		&struct{}{})
+	if err != nil {
+		logger.Error("error recording the pin log: ", err)
+	}
+}
+
+// track asks the PinTracker to track and untrack the given items.
+func (cc *Consensus) track(track, untrack []api.PinSerial) {
+	if cc.rpcClient == nil { // StateSync will take care on bootstrap
+		return
+	}
+
+	// Async, we let the PinTracker take care of any problems
+	for _, p := range track {
+		cc.rpcClient.Go("",
+			"Cluster",
+			"Track",
+			p,
+			&struct{}{},
+			nil)
+	}
+	for _, p := range untrack {
+		cc.rpcClient.Go("",
+			"Cluster",
+			"Untrack",
+			p,
+			&struct{}{},
+			nil)
+	}
+}
+
+// commit runs the given operations in a transaction and waits until
+// they are reflected in the state.
+func (cc *Consensus) commit(ops ...clientv3.Op) error {
+	cc.shutdownLock.Lock() // do not shut down while committing
+	defer cc.shutdownLock.Unlock()
+	if cc.shutdown {
+		return errors.New("consensus is shutdown")
+	}
+
+	ctx, cancel := cc.requestCtx()
+	resp, err := cc.client.Txn(ctx).Then(ops...).Commit()
+	cancel()
+	if err != nil {
+		return err
+	}
+	cc.seen(resp.Header.Revision, resp.Header.RaftTerm)
+
+	// Deleting missing keys does not create a new revision
+	for _, r := range resp.Responses {
+		if d := r.GetResponseDeleteRange(); d != nil && d.Deleted == 0 {
+			continue
+		}
+		return cc.waitForRevision(resp.Header.Revision)
+	}
+	return nil
+}
+
+// pinOp returns the put operation for a pin. Its RequestID is not stored.
+func (cc *Consensus) pinOp(pin api.Pin) (clientv3.Op, error) {
+	pin.RequestID = ""
+	v, err := json.Marshal(pin.ToSerial())
+	if err != nil {
+		return clientv3.Op{}, err
+	}
+	return clientv3.OpPut(pinKey(cc.config, pin.Cid), string(v)), nil
+}
+
+// LogPin adds a Cid to the shared state of the cluster.
+func (cc *Consensus) LogPin(pin api.Pin) error {
+	op, err := cc.pinOp(pin)
+	if err != nil {
+		return err
+	}
+	err = cc.commit(op)
+	if err != nil {
+		return err
+	}
+	logger.Infof("pin committed to global state: %s", pin.LogName())
+	return nil
+}
+
+// LogPinBatch adds several Cids to the shared state of the cluster.
+// Pins are committed in as few transactions as etcd allows.
+func (cc *Consensus) LogPinBatch(pins []api.Pin) error {
+	for len(pins) > 0 {
+		n := len(pins)
+		if n > maxTxnOps {
+			n = maxTxnOps
+		}
+		ops := make([]clientv3.Op, 0, n)
+		for _, pin := range pins[:n] {
+			op, err := cc.pinOp(pin)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, op)
+		}
+		err := cc.commit(ops...)
+		if err != nil {
+			return err
+		}
+		logger.Infof("batch of %d pins committed to global state", n)
+		pins = pins[n:]
+	}
+	return nil
+}
+
+// LogUnpin removes a Cid from the shared state of the cluster.
+func (cc *Consensus) LogUnpin(pin api.Pin) error {
+	err := cc.commit(clientv3.OpDelete(pinKey(cc.config, pin.Cid)))
+	if err != nil {
+		return err
+	}
+	logger.Infof("unpin committed to global state: %s", pin.LogName())
+	return nil
+}
+
+// LogMaintenance sets or unsets the maintenance mode for a peer in the
+// shared state of the cluster.
+func (cc *Consensus) LogMaintenance(pm api.PeerMaintenance) error {
+	op := clientv3.OpDelete(maintenanceKey(cc.config, pm.Peer))
+	if pm.Enabled {
+		op = clientv3.OpPut(maintenanceKey(cc.config, pm.Peer), "")
+	}
+	err := cc.commit(op)
+	if err != nil {
+		return err
+	}
+	logger.Infof("maintenance mode for %s committed to global state: %t",
+		pm.Peer, pm.Enabled)
+	return nil
+}
+
+// AddPeer is a no-op. Peers register themselves in etcd when
+// they start.
+func (cc *Consensus) AddPeer(pid peer.ID) error {
+	return nil
+}
+
+// AddNonVoter is a no-op, like AddPeer. Votes happen among the
+// etcd members, not among cluster peers.
+func (cc *Consensus) AddNonVoter(pid peer.ID) error {
+	return nil
+}
+
+// Voter returns true. Votes happen among the etcd members, so every
+// cluster peer takes part in the consensus equally.
+func (cc *Consensus) Voter() bool {
+	return true
+}
+
+// RmPeer unregisters a peer from etcd. It will not be part of the
+// peerset until it starts again.
+func (cc *Consensus) RmPeer(pid peer.ID) error {
+	ctx, cancel := cc.requestCtx()
+	defer cancel()
+	_, err := cc.client.Delete(ctx, peerKey(cc.config, pid))
+	return err
+}
+
+// State returns the current State. It reflects all the updates
+// received from etcd so far.
+func (cc *Consensus) State() (state.State, error) {
+	return cc.state, nil
+}
+
+// Leader returns the peer which won the last election held in etcd.
+func (cc *Consensus) Leader() (peer.ID, error) {
+	cc.mux.Lock()
+	election := cc.election
+	cc.mux.Unlock()
+
+	ctx, cancel := cc.requestCtx()
+	defer cancel()
+	resp, err := election.Leader(ctx)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDB58Decode(string(resp.Kvs[0].Value))
+}
+
+// Clean does nothing besides checking that the component is shut
+// down. The shared state lives in etcd and this peer persists nothing.
+func (cc *Consensus) Clean() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+	if !cc.shutdown {
+		return errors.New("consensus component is not shutdown")
+	}
+	logger.Info("etcd consensus keeps no local data to clean")
+	return nil
+}
+
+// Snapshot is a no-op. Compacting and defragmenting the etcd history
+// is a task for the etcd cluster.
+func (cc *Consensus) Snapshot() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+	if cc.shutdown {
+		return errors.New("consensus is shutdown")
+	}
+	return nil
+}
+
+// LastContact returns the last time this peer's state was known to
+// include every update made in etcd, that is, when it last saw its own
+// heartbeat.
+func (cc *Consensus) LastContact() time.Time {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	return cc.lastContact
+}
+
+// Status returns the etcd term, the last etcd revision known (as commit
+// index) and the revision reflected in the state (as applied index).
+func (cc *Consensus) Status() api.ConsensusStatus {
+	cc.mux.Lock()
+	status := api.ConsensusStatus{
+		Peer:         cc.host.ID(),
+		Voter:        true,
+		Term:         cc.term,
+		CommitIndex:  uint64(cc.lastRev),
+		AppliedIndex: uint64(cc.rev),
+		LastContact:  cc.lastContact,
+	}
+	cc.mux.Unlock()
+
+	leader, err := cc.Leader()
+	if err != nil {
+		status.Error = err.Error()
+	}
+	status.Leader = leader
+	return status
+}
+
+// Peers returns the peers registered in etcd. The list will be sorted
+// alphabetically.
+func (cc *Consensus) Peers() ([]peer.ID, error) {
+	cc.shutdownLock.Lock()
+	shutdown := cc.shutdown
+	cc.shutdownLock.Unlock()
+	if shutdown {
+		return nil, errors.New("consensus is shutdown")
+	}
+
+	ctx, cancel := cc.requestCtx()
+	defer cancel()
+	resp, err := cc.client.Get(ctx, peersPrefix(cc.config), clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	pids := []string{}
+	for _, kv := range resp.Kvs {
+		pids = append(pids, strings.TrimPrefix(string(kv.Key), peersPrefix(cc.config)))
+	}
+	sort.Strings(pids)
+
+	peers := []peer.ID{}
+	for _, p := range pids {
+		id, err := peer.IDB58Decode(p)
+		if err != nil {
+			logger.Warningf("ignoring bad etcd key: %s", p)
+			continue
+		}
+		peers = append(peers, id)
+	}
+	return peers, nil
+}
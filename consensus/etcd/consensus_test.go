@@ -0,0 +1,373 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	"github.com/coreos/etcd/embed"
+	cid "github.com/ipfs/go-cid"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var p2pPort = 14000
+var p2pPortAlt = 15000
+var etcdPort = 12379
+
+// testingEtcd starts an embedded single-member etcd cluster.
+func testingEtcd(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "etcd-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", etcdPort))
+	peerURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", etcdPort+1))
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LCUrls = []url.URL{*clientURL}
+	cfg.ACUrls = []url.URL{*clientURL}
+	cfg.LPUrls = []url.URL{*peerURL}
+	cfg.APUrls = []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		t.Fatal("etcd took too long to start")
+	}
+	return func() {
+		e.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func testingConfig() *Config {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Endpoints = []string{fmt.Sprintf("127.0.0.1:%d", etcdPort)}
+	cfg.SessionTTL = 2 * time.Second
+	cfg.hostShutdown = true
+	return cfg
+}
+
+func makeTestingHost(t *testing.T, port int) host.Host {
+	priv, pub, _ := crypto.GenerateKeyPair(crypto.RSA, 2048)
+	pid, _ := peer.IDFromPublicKey(pub)
+	maddr, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port))
+	ps := peerstore.NewPeerstore()
+	ps.AddPubKey(pid, pub)
+	ps.AddPrivKey(pid, priv)
+	ps.AddAddr(pid, maddr, peerstore.PermanentAddrTTL)
+	n, _ := swarm.NewNetwork(
+		context.Background(),
+		[]ma.Multiaddr{maddr},
+		pid, ps, nil)
+	return basichost.New(n)
+}
+
+func testingConsensus(t *testing.T, port int) *Consensus {
+	h := makeTestingHost(t, port)
+	st := mapstate.NewMapState()
+
+	cc, err := NewConsensus(h, testingConfig(), st)
+	if err != nil {
+		t.Fatal("cannot create Consensus:", err)
+	}
+	cc.SetClient(test.NewMockRPCClientWithHost(t, h))
+	<-cc.Ready()
+	return cc
+}
+
+func inMaintenance(st state.State, p peer.ID) bool {
+	for _, mp := range st.MaintenancePeers() {
+		if mp == p {
+			return true
+		}
+	}
+	return false
+}
+
+func TestShutdownConsensus(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cc := testingConsensus(t, p2pPort)
+	err := cc.Shutdown()
+	if err != nil {
+		t.Fatal("Consensus cannot shutdown:", err)
+	}
+	err = cc.Shutdown() // should be fine to shutdown twice
+	if err != nil {
+		t.Fatal("Consensus should be able to shutdown several times")
+	}
+}
+
+func TestConsensusPin(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cc := testingConsensus(t, p2pPort)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+	if err != nil {
+		t.Error("the operation did not make it to the state:", err)
+	}
+
+	st, err := cc.State()
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+
+	pins := st.List()
+	if len(pins) != 1 || pins[0].Cid.String() != test.TestCid1 {
+		t.Error("the added pin should be in the state")
+	}
+
+	err = cc.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Error("the operation did not make it to the state:", err)
+	}
+	if st.Has(c) {
+		t.Error("the removed pin should not be in the state")
+	}
+
+	// unpinning something not pinned should not block
+	err = cc.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsensusPinBatch(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cc := testingConsensus(t, p2pPort)
+	defer cc.Shutdown()
+
+	// more pins than operations allowed in a transaction
+	c, _ := cid.Decode(test.TestCid1)
+	pins := make([]api.Pin, 0, maxTxnOps+1)
+	for i := 0; i <= maxTxnOps; i++ {
+		ci, err := c.Prefix().Sum([]byte(fmt.Sprintf("pin-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pins = append(pins, api.Pin{Cid: ci, ReplicationFactor: -1})
+	}
+	err := cc.LogPinBatch(pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, _ := cc.State()
+	if len(st.List()) != len(pins) {
+		t.Error("all the pins should be in the state")
+	}
+}
+
+func TestConsensusPinBatchReplication(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cc := testingConsensus(t, p2pPort)
+	defer cc.Shutdown()
+	cc2 := testingConsensus(t, p2pPortAlt)
+	defer cc2.Shutdown()
+
+	// every pin in a transaction has the same revision
+	c, _ := cid.Decode(test.TestCid1)
+	pins := make([]api.Pin, 0, maxTxnOps+1)
+	for i := 0; i <= maxTxnOps; i++ {
+		ci, err := c.Prefix().Sum([]byte(fmt.Sprintf("pin-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pins = append(pins, api.Pin{Cid: ci, ReplicationFactor: -1})
+	}
+	err := cc.LogPinBatch(pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cc2.WaitForSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cc2.State()
+	if n := len(st.List()); n != len(pins) {
+		t.Errorf("the watcher of another peer should see all the pins: %d", n)
+	}
+}
+
+func TestConsensusLogMaintenance(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cc := testingConsensus(t, p2pPort)
+	defer cc.Shutdown()
+
+	err := cc.LogMaintenance(api.PeerMaintenance{Peer: test.TestPeerID1, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cc.State()
+	if !inMaintenance(st, test.TestPeerID1) {
+		t.Error("peer should be in maintenance mode")
+	}
+
+	err = cc.LogMaintenance(api.PeerMaintenance{Peer: test.TestPeerID1, Enabled: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inMaintenance(st, test.TestPeerID1) {
+		t.Error("peer should not be in maintenance mode")
+	}
+}
+
+func TestConsensusReplication(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cc := testingConsensus(t, p2pPort)
+	defer cc.Shutdown()
+	cc2 := testingConsensus(t, p2pPortAlt)
+	defer cc2.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cc2.WaitForSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cc2.State()
+	if !st.Has(c) {
+		t.Error("the pin should have been replicated")
+	}
+
+	peers, err := cc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 {
+		t.Error("expected 2 peers registered in etcd")
+	}
+
+	err = cc.RmPeer(cc2.host.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers, _ = cc.Peers()
+	if len(peers) != 1 || peers[0] != cc.host.ID() {
+		t.Error("the removed peer should not be listed")
+	}
+}
+
+func TestConsensusLeader(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cc := testingConsensus(t, p2pPort)
+	cc2 := testingConsensus(t, p2pPortAlt)
+	defer cc2.Shutdown()
+
+	time.Sleep(time.Second)
+	l, err := cc2.Leader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != cc.host.ID() {
+		t.Error("the first peer should be the leader")
+	}
+
+	cc.Shutdown()
+	time.Sleep(time.Second)
+	l, err = cc2.Leader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != cc2.host.ID() {
+		t.Error("the second peer should have taken over leadership")
+	}
+}
+
+func TestConsensusStatus(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cc := testingConsensus(t, p2pPort)
+	defer cc.Shutdown()
+
+	err := cc.WaitForSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := cc.Status()
+	if status.Peer != cc.host.ID() || status.Term == 0 || status.AppliedIndex == 0 {
+		t.Error("unexpected status:", status)
+	}
+	if status.AppliedIndex < status.CommitIndex {
+		t.Error("the state should be in sync after WaitForSync")
+	}
+	if time.Since(cc.LastContact()) > time.Second {
+		t.Error("last contact should be recent")
+	}
+}
+
+func TestSaveStateLastState(t *testing.T) {
+	stop := testingEtcd(t)
+	defer stop()
+	cfg := testingConfig()
+
+	c, _ := cid.Decode(test.TestCid1)
+	ms := mapstate.NewMapState()
+	ms.Add(api.Pin{Cid: c, ReplicationFactor: -1})
+	ms.SetMaintenance(test.TestPeerID1, true)
+	err := SaveState(cfg, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc := testingConsensus(t, p2pPort)
+	st, _ := cc.State()
+	if !st.Has(c) || !inMaintenance(st, test.TestPeerID1) {
+		t.Error("the saved state should be loaded on start")
+	}
+	cc.Shutdown()
+
+	last, err := LastState(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Has(c) || !inMaintenance(last, test.TestPeerID1) {
+		t.Error("LastState should return the saved state")
+	}
+
+	err = SaveState(cfg, mapstate.NewMapState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, _ = LastState(cfg)
+	if len(last.List()) != 0 || len(last.MaintenancePeers()) != 0 {
+		t.Error("the state should have been replaced")
+	}
+}
@@ -0,0 +1,125 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// decodeState returns the pins (by Cid) and the peers in maintenance
+// mode found among the given keys.
+func decodeState(cfg *Config, kvs []*mvccpb.KeyValue) (map[string]api.PinSerial, map[peer.ID]struct{}) {
+	pins := make(map[string]api.PinSerial)
+	maintenance := make(map[peer.ID]struct{})
+	for _, kv := range kvs {
+		key := string(kv.Key)
+		switch {
+		case strings.HasPrefix(key, pinsPrefix(cfg)):
+			var pin api.PinSerial
+			err := json.Unmarshal(kv.Value, &pin)
+			if err != nil || pin.Cid == "" {
+				logger.Warningf("ignoring bad etcd entry: %s", key)
+				continue
+			}
+			pins[pin.Cid] = pin
+		case strings.HasPrefix(key, maintenancePrefix(cfg)):
+			pid, err := peer.IDB58Decode(strings.TrimPrefix(key, maintenancePrefix(cfg)))
+			if err != nil {
+				logger.Warningf("ignoring bad etcd key: %s", key)
+				continue
+			}
+			maintenance[pid] = struct{}{}
+		}
+	}
+	return pins, maintenance
+}
+
+func newClient(cfg *Config) (*clientv3.Client, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: cfg.DialTimeout,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+	})
+}
+
+// LastState returns the state stored in etcd under the prefix of the
+// given configuration.
+func LastState(cfg *Config) (*mapstate.MapState, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RequestTimeout)
+	defer cancel()
+	resp, err := client.Get(ctx, cfg.Prefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	ms := mapstate.NewMapState()
+	pins, maintenance := decodeState(cfg, resp.Kvs)
+	for _, pin := range pins {
+		ms.Add(pin.ToPin())
+	}
+	for p := range maintenance {
+		ms.SetMaintenance(p, true)
+	}
+	return ms, nil
+}
+
+// SaveState replaces the state stored in etcd under the prefix of the
+// given configuration. Running peers pick up the changes right away.
+// Large states are written in several transactions, so the replacement
+// is not atomic.
+func SaveState(cfg *Config, st state.State) error {
+	client, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ops := []clientv3.Op{
+		clientv3.OpDelete(pinsPrefix(cfg), clientv3.WithPrefix()),
+		clientv3.OpDelete(maintenancePrefix(cfg), clientv3.WithPrefix()),
+	}
+	for _, pin := range st.List() {
+		v, err := json.Marshal(pin.ToSerial())
+		if err != nil {
+			return err
+		}
+		ops = append(ops, clientv3.OpPut(pinKey(cfg, pin.Cid), string(v)))
+	}
+	for _, p := range st.MaintenancePeers() {
+		ops = append(ops, clientv3.OpPut(maintenanceKey(cfg, p), ""))
+	}
+
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > maxTxnOps {
+			n = maxTxnOps
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.RequestTimeout)
+		_, err := client.Txn(ctx).Then(ops[:n]...).Commit()
+		cancel()
+		if err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+// gzipMagic are the first bytes of any gzip stream. Uncompressed
+// snapshots start with the state version instead.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressedFSM wraps a Raft FSM so that the snapshots it takes are
+// gzip-compressed. Raft stores them as they are and sends them as they
+// are to peers which are too far behind to catch up from the log (i.e.
+// new peers), so a large pinset is transferred in a fraction of the
+// size. Restore accepts both compressed and uncompressed snapshots.
+type compressedFSM struct {
+	hraft.FSM
+}
+
+// Snapshot returns an FSMSnapshot which compresses what it persists.
+func (fsm *compressedFSM) Snapshot() (hraft.FSMSnapshot, error) {
+	snap, err := fsm.FSM.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &compressedFSMSnapshot{snap}, nil
+}
+
+// Restore decompresses the snapshot, if needed, and restores the
+// wrapped FSM from it.
+func (fsm *compressedFSM) Restore(r io.ReadCloser) error {
+	dr, err := decompressSnapshot(r)
+	if err != nil {
+		return err
+	}
+	return fsm.FSM.Restore(dr)
+}
+
+type compressedFSMSnapshot struct {
+	hraft.FSMSnapshot
+}
+
+func (snap *compressedFSMSnapshot) Persist(sink hraft.SnapshotSink) error {
+	return snap.FSMSnapshot.Persist(&gzipSnapshotSink{
+		SnapshotSink: sink,
+		gz:           gzip.NewWriter(sink),
+	})
+}
+
+// gzipSnapshotSink compresses everything written to it and flushes
+// it to the underlying sink on Close.
+type gzipSnapshotSink struct {
+	hraft.SnapshotSink
+	gz *gzip.Writer
+}
+
+func (sink *gzipSnapshotSink) Write(p []byte) (int, error) {
+	return sink.gz.Write(p)
+}
+
+func (sink *gzipSnapshotSink) Close() error {
+	err := sink.gz.Close()
+	if err != nil {
+		sink.SnapshotSink.Cancel()
+		return err
+	}
+	return sink.SnapshotSink.Close()
+}
+
+// compressSnapshot returns the gzip-compressed version of the given
+// snapshot bytes.
+func compressSnapshot(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// snapshotReader reads the (decompressed) contents of a snapshot and
+// closes the original reader.
+type snapshotReader struct {
+	io.Reader
+	io.Closer
+}
+
+// decompressSnapshot returns a reader to the decompressed contents of
+// the given snapshot. Snapshots which are not compressed are read as
+// they are.
+func decompressSnapshot(r io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		// too short or not compressed: let the caller deal with it.
+		return &snapshotReader{br, r}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotReader{gz, r}, nil
+}
@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+func TestDecompressSnapshot(t *testing.T) {
+	plain := bytes.Repeat([]byte("some pinset"), 100)
+	comp, err := compressSnapshot(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comp) >= len(plain) {
+		t.Error("the snapshot should have been compressed")
+	}
+
+	r, err := decompressSnapshot(ioutil.NopCloser(bytes.NewReader(comp)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, _ := ioutil.ReadAll(r)
+	if !bytes.Equal(dec, plain) {
+		t.Error("decompressed snapshot does not match")
+	}
+
+	// Uncompressed snapshots are read as they are
+	r, err = decompressSnapshot(ioutil.NopCloser(bytes.NewReader(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, _ = ioutil.ReadAll(r)
+	if !bytes.Equal(dec, plain) {
+		t.Error("uncompressed snapshot does not match")
+	}
+}
+
+func TestGzipSnapshotSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-compression-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newSnapshotStore(dir, RaftMaxSnapshots, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, trans := hraft.NewInmemTransport("")
+	sink, err := store.Create(1, 10, 3, hraft.Configuration{}, 1, trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzSink := &gzipSnapshotSink{
+		SnapshotSink: sink,
+		gz:           gzip.NewWriter(sink),
+	}
+	plain := []byte("snapshot contents")
+	gzSink.Write(plain)
+	if err := gzSink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, r, err := store.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ioutil.ReadAll(r)
+	r.Close()
+	if !bytes.HasPrefix(raw, gzipMagic) {
+		t.Error("snapshot was not stored compressed")
+	}
+
+	_, r, err = store.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := decompressSnapshot(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, _ := ioutil.ReadAll(dr)
+	dr.Close()
+	if !bytes.Equal(dec, plain) {
+		t.Error("decompressed snapshot does not match")
+	}
+}
@@ -1,9 +1,11 @@
 package raft
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"strings"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/config"
@@ -48,6 +50,21 @@ type Config struct {
 	CommitRetries int
 	// How long to wait between retries
 	CommitRetryDelay time.Duration
+	// EncryptionKey, when set, is used to encrypt the Raft log entries
+	// and snapshots stored on disk (AES-GCM). It must be 16, 24 or 32
+	// bytes long.
+	EncryptionKey []byte
+	// EncryptionKeyFile is the path to a file containing the hex-encoded
+	// EncryptionKey. When set, the key is read from there rather than
+	// from the configuration (i.e. a secret placed by a KMS).
+	EncryptionKeyFile string
+	// MaxSnapshots is the number of snapshots kept in the data folder.
+	// Older ones are removed when a new snapshot is taken.
+	MaxSnapshots int
+	// NonVoter makes this peer join clusters as a non-voting member:
+	// it replicates the state but does not take part in elections
+	// nor counts towards the quorum.
+	NonVoter bool
 }
 
 // ConfigJSON represents a human-friendly Config
@@ -73,6 +90,19 @@ type jsonConfig struct {
 	// How long to wait between commit retries
 	CommitRetryDelay string `json:"commit_retry_delay"`
 
+	// Hex-encoded key used to encrypt the Raft data at rest
+	EncryptionKey string `json:"encryption_key,omitempty"`
+
+	// File holding the hex-encoded encryption key. Takes precedence
+	// over encryption_key.
+	EncryptionKeyFile string `json:"encryption_key_file,omitempty"`
+
+	// How many snapshots to keep in the data folder
+	MaxSnapshots int `json:"max_snapshots,omitempty"`
+
+	// Join clusters as a non-voting member
+	NonVoter bool `json:"non_voter,omitempty"`
+
 	// HeartbeatTimeout specifies the time in follower state without
 	// a leader before we attempt an election.
 	HeartbeatTimeout string `json:"heartbeat_timeout,omitempty"`
@@ -143,6 +173,16 @@ func (cfg *Config) Validate() error {
 		return errors.New("commit_retry_delay is invalid")
 	}
 
+	switch len(cfg.EncryptionKey) {
+	case 0, 16, 24, 32:
+	default:
+		return errors.New("encryption_key must be 16, 24 or 32 bytes long")
+	}
+
+	if cfg.MaxSnapshots < 1 {
+		return errors.New("max_snapshots must be at least 1")
+	}
+
 	return hraft.ValidateConfig(cfg.RaftConfig)
 }
 
@@ -186,6 +226,27 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	config.SetIfNotDefault(networkTimeout, &cfg.NetworkTimeout)
 	cfg.CommitRetries = jcfg.CommitRetries
 	config.SetIfNotDefault(commitRetryDelay, &cfg.CommitRetryDelay)
+	config.SetIfNotDefault(jcfg.MaxSnapshots, &cfg.MaxSnapshots)
+	cfg.NonVoter = jcfg.NonVoter
+
+	keyHex := jcfg.EncryptionKey
+	if jcfg.EncryptionKeyFile != "" {
+		cfg.EncryptionKeyFile = jcfg.EncryptionKeyFile
+		keyBytes, err := ioutil.ReadFile(jcfg.EncryptionKeyFile)
+		if err != nil {
+			logger.Error("error reading encryption_key_file")
+			return err
+		}
+		keyHex = string(keyBytes)
+	}
+	if keyHex != "" {
+		key, err := hex.DecodeString(strings.TrimSpace(keyHex))
+		if err != nil {
+			logger.Error("error decoding encryption key")
+			return err
+		}
+		cfg.EncryptionKey = key
+	}
 
 	// Raft values
 	config.SetIfNotDefault(heartbeatTimeout, &cfg.RaftConfig.HeartbeatTimeout)
@@ -208,6 +269,13 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 	jcfg.NetworkTimeout = cfg.NetworkTimeout.String()
 	jcfg.CommitRetries = cfg.CommitRetries
 	jcfg.CommitRetryDelay = cfg.CommitRetryDelay.String()
+	jcfg.MaxSnapshots = cfg.MaxSnapshots
+	jcfg.NonVoter = cfg.NonVoter
+	if cfg.EncryptionKeyFile != "" {
+		jcfg.EncryptionKeyFile = cfg.EncryptionKeyFile
+	} else if len(cfg.EncryptionKey) > 0 {
+		jcfg.EncryptionKey = hex.EncodeToString(cfg.EncryptionKey)
+	}
 	jcfg.HeartbeatTimeout = cfg.RaftConfig.HeartbeatTimeout.String()
 	jcfg.ElectionTimeout = cfg.RaftConfig.ElectionTimeout.String()
 	jcfg.CommitTimeout = cfg.RaftConfig.CommitTimeout.String()
@@ -227,6 +295,10 @@ func (cfg *Config) Default() error {
 	cfg.NetworkTimeout = DefaultNetworkTimeout
 	cfg.CommitRetries = DefaultCommitRetries
 	cfg.CommitRetryDelay = DefaultCommitRetryDelay
+	cfg.EncryptionKey = nil
+	cfg.EncryptionKeyFile = ""
+	cfg.MaxSnapshots = RaftMaxSnapshots
+	cfg.NonVoter = false
 	cfg.RaftConfig = hraft.DefaultConfig()
 
 	// These options are imposed over any Default Raft Config.
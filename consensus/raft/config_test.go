@@ -94,4 +94,85 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.EncryptionKey = []byte("abc")
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MaxSnapshots = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestMaxSnapshotsJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	if cfg.MaxSnapshots != RaftMaxSnapshots {
+		t.Error("expected default max_snapshots")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MaxSnapshots = 2
+	tst, _ := json.Marshal(j)
+	err := cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxSnapshots != 2 {
+		t.Error("expected max_snapshots to be loaded")
+	}
+}
+
+func TestNonVoterJSON(t *testing.T) {
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.NonVoter = true
+	tst, _ := json.Marshal(j)
+
+	cfg := &Config{}
+	err := cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.NonVoter {
+		t.Error("expected non_voter to be loaded")
+	}
+
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	j = &jsonConfig{}
+	json.Unmarshal(newjson, j)
+	if !j.NonVoter {
+		t.Error("expected non_voter to be saved")
+	}
+}
+
+func TestEncryptionKeyJSON(t *testing.T) {
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.EncryptionKey = "000102030405060708090a0b0c0d0e0f"
+	tst, _ := json.Marshal(j)
+
+	cfg := &Config{}
+	err := cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.EncryptionKey) != 16 {
+		t.Error("expected a 16 bytes encryption key")
+	}
+
+	j.EncryptionKey = "xyz"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected an error decoding encryption_key")
+	}
 }
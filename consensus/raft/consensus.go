@@ -37,6 +37,7 @@ type Consensus struct {
 	consensus consensus.OpLogConsensus
 	actor     consensus.Actor
 	baseOp    *LogOp
+	fsm       *indexedFSM
 	raft      *raftWrapper
 
 	rpcClient *rpc.Client
@@ -60,7 +61,8 @@ func NewConsensus(clusterPeers []peer.ID, host host.Host, cfg *Config, state sta
 
 	logger.Debug("starting Consensus and waiting for a leader...")
 	consensus := libp2praft.NewOpLog(state, baseOp)
-	raft, err := newRaftWrapper(clusterPeers, host, cfg, consensus.FSM())
+	fsm := &indexedFSM{FSM: consensus.FSM()}
+	raft, err := newRaftWrapper(clusterPeers, host, cfg, fsm)
 	if err != nil {
 		logger.Error("error creating raft: ", err)
 		return nil, err
@@ -78,6 +80,7 @@ func NewConsensus(clusterPeers []peer.ID, host host.Host, cfg *Config, state sta
 		consensus: consensus,
 		actor:     actor,
 		baseOp:    baseOp,
+		fsm:       fsm,
 		raft:      raft,
 		rpcReady:  make(chan struct{}, 1),
 		readyCh:   make(chan struct{}, 1),
@@ -109,9 +112,20 @@ func (cc *Consensus) WaitForSync() error {
 // waits until there is a consensus leader and syncs the state
 // to the tracker
 func (cc *Consensus) finishBootstrap() {
-	err := cc.WaitForSync()
-	if err != nil {
-		return
+	// After a total cluster restart, peers may take a while to come
+	// back and elect a leader. Keep waiting until they do or we are
+	// shut down.
+	for {
+		err := cc.WaitForSync()
+		if err == nil {
+			break
+		}
+		logger.Warningf("raft not ready yet: %s. Retrying.", err)
+		select {
+		case <-cc.ctx.Done():
+			return
+		default:
+		}
 	}
 	logger.Debug("Raft state is now up to date")
 
@@ -281,9 +295,14 @@ func (cc *Consensus) commit(op *LogOp, rpcOp string, redirectArg interface{}) er
 
 		switch op.Type {
 		case LogOpPin:
-			logger.Infof("pin committed to global state: %s", op.Cid.Cid)
+			logger.Infof("pin committed to global state: %s", op.Cid.ToPin().LogName())
 		case LogOpUnpin:
-			logger.Infof("unpin committed to global state: %s", op.Cid.Cid)
+			logger.Infof("unpin committed to global state: %s", op.Cid.ToPin().LogName())
+		case LogOpPinBatch:
+			logger.Infof("batch of %d pins committed to global state", len(op.Pins))
+		case LogOpMaintenance:
+			logger.Infof("maintenance mode for %s committed to global state: %t",
+				op.Maintenance.Peer, op.Maintenance.Enabled)
 		}
 		break
 
@@ -294,8 +313,13 @@ func (cc *Consensus) commit(op *LogOp, rpcOp string, redirectArg interface{}) er
 }
 
 // LogPin submits a Cid to the shared state of the cluster. It will forward
-// the operation to the leader if this is not it.
+// the operation to the leader if this is not it. Nothing is committed
+// when the leader already has the same pin in the state.
 func (cc *Consensus) LogPin(pin api.Pin) error {
+	if cc.unchangedPin(pin) {
+		logger.Debugf("%s is already in the global state: skipping commit", pin.Cid)
+		return nil
+	}
 	op := cc.op(pin, LogOpPin)
 	err := cc.commit(op, "ConsensusLogPin", pin.ToSerial())
 	if err != nil {
@@ -304,6 +328,35 @@ func (cc *Consensus) LogPin(pin api.Pin) error {
 	return nil
 }
 
+// unchangedPin returns true when this peer is the leader and its state
+// holds a pin equal to the given one. Followers may have a stale state,
+// so they leave the decision to the leader.
+func (cc *Consensus) unchangedPin(pin api.Pin) bool {
+	leader, err := cc.Leader()
+	if err != nil || leader != cc.host.ID() {
+		return false
+	}
+	st, err := cc.State()
+	if err != nil || !st.Has(pin.Cid) {
+		return false
+	}
+	return st.Get(pin.Cid).Equals(pin)
+}
+
+// LogPinBatch adds several Cids to the shared state of the cluster
+// with a single log entry.
+func (cc *Consensus) LogPinBatch(pins []api.Pin) error {
+	serials := make([]api.PinSerial, 0, len(pins))
+	for _, pin := range pins {
+		serials = append(serials, pin.ToSerial())
+	}
+	op := &LogOp{
+		Pins: serials,
+		Type: LogOpPinBatch,
+	}
+	return cc.commit(op, "ConsensusLogPinBatch", serials)
+}
+
 // LogUnpin removes a Cid from the shared state of the cluster.
 func (cc *Consensus) LogUnpin(pin api.Pin) error {
 	op := cc.op(pin, LogOpUnpin)
@@ -314,33 +367,71 @@ func (cc *Consensus) LogUnpin(pin api.Pin) error {
 	return nil
 }
 
+// LogMaintenance sets or unsets the maintenance mode for a peer in the
+// shared state of the cluster.
+func (cc *Consensus) LogMaintenance(pm api.PeerMaintenance) error {
+	op := &LogOp{
+		Maintenance: pm.ToSerial(),
+		Type:        LogOpMaintenance,
+	}
+	return cc.commit(op, "ConsensusLogMaintenance", pm.ToSerial())
+}
+
 // AddPeer adds a new peer to participate in this consensus. It will
 // forward the operation to the leader if this is not it.
 func (cc *Consensus) AddPeer(pid peer.ID) error {
+	return cc.addPeer(pid, true, "ConsensusAddPeer")
+}
+
+// AddNonVoter adds a new peer which receives the log, but does not
+// vote in elections nor counts towards the quorum. It will forward the
+// operation to the leader if this is not it.
+func (cc *Consensus) AddNonVoter(pid peer.ID) error {
+	return cc.addPeer(pid, false, "ConsensusAddNonVoter")
+}
+
+func (cc *Consensus) addPeer(pid peer.ID, voter bool, rpcOp string) error {
 	var finalErr error
 	for i := 0; i <= cc.config.CommitRetries; i++ {
-		logger.Debugf("attempt #%d: AddPeer %s", i, pid.Pretty())
+		logger.Debugf("attempt #%d: AddPeer %s (voter: %t)", i, pid.Pretty(), voter)
 		if finalErr != nil {
 			logger.Errorf("retrying to add peer. Attempt #%d failed: %s", i, finalErr)
 		}
-		ok, err := cc.redirectToLeader("ConsensusAddPeer", pid)
+		ok, err := cc.redirectToLeader(rpcOp, pid)
 		if err != nil || ok {
 			return err
 		}
-		// Being here means we are the leader and can commit
+		// Being here means we are the leader and can commit.
+		// Snapshot first, so that the new peer is sent the
+		// (compressed) snapshot and only replays the trailing
+		// logs, rather than the whole log since the last one.
+		err = cc.Snapshot()
+		if err != nil {
+			logger.Warningf("could not snapshot before adding %s: %s", pid.Pretty(), err)
+		}
 		cc.shutdownLock.Lock() // do not shutdown while committing
-		finalErr = cc.raft.AddPeer(peer.IDB58Encode(pid))
+		finalErr = cc.raft.AddPeer(peer.IDB58Encode(pid), voter)
 		cc.shutdownLock.Unlock()
 		if finalErr != nil {
 			time.Sleep(cc.config.CommitRetryDelay)
 			continue
 		}
-		logger.Infof("peer added to Raft: %s", pid.Pretty())
+		if voter {
+			logger.Infof("peer added to Raft: %s", pid.Pretty())
+		} else {
+			logger.Infof("non-voting peer added to Raft: %s", pid.Pretty())
+		}
 		break
 	}
 	return finalErr
 }
 
+// Voter returns false when this peer is configured to join
+// clusters as a non-voting member.
+func (cc *Consensus) Voter() bool {
+	return !cc.config.NonVoter
+}
+
 // RmPeer removes a peer from this consensus. It will
 // forward the operation to the leader if this is not it.
 func (cc *Consensus) RmPeer(pid peer.ID) error {
@@ -407,6 +498,46 @@ func (cc *Consensus) Clean() error {
 	return nil
 }
 
+// Snapshot tells Raft to take a snapshot of the current state now. Log
+// entries included in it, other than the last trailing_logs, are
+// removed afterwards.
+func (cc *Consensus) Snapshot() error {
+	cc.shutdownLock.Lock() // do not shut down while snapshotting
+	defer cc.shutdownLock.Unlock()
+	if cc.shutdown {
+		return errors.New("consensus is shutdown")
+	}
+	err := cc.raft.Snapshot()
+	if err != nil {
+		return err
+	}
+	logger.Info("raft snapshot taken")
+	return nil
+}
+
+// LastContact returns when this peer last heard from the Raft leader,
+// that is, when its copy of the state was last known to be current.
+// Leaders always return the current time. The result is the zero time
+// if the leader has never been contacted.
+func (cc *Consensus) LastContact() time.Time {
+	return cc.raft.LastContact()
+}
+
+// Status returns the internals of Raft in this peer: the current leader
+// and term, the commit and applied indexes, and the last snapshot.
+func (cc *Consensus) Status() api.ConsensusStatus {
+	status := cc.raft.Status()
+	status.Peer = cc.host.ID()
+	status.Voter = cc.Voter()
+	leader, err := cc.Leader()
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Leader = leader
+	}
+	return status
+}
+
 // Rollback replaces the current agreed-upon
 // state with the state provided. Only the consensus leader
 // can perform this operation.
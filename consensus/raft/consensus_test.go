@@ -11,6 +11,7 @@ import (
 	"github.com/ipfs/ipfs-cluster/state/mapstate"
 	"github.com/ipfs/ipfs-cluster/test"
 
+	hraft "github.com/hashicorp/raft"
 	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
 	crypto "github.com/libp2p/go-libp2p-crypto"
@@ -113,6 +114,66 @@ func TestConsensusPin(t *testing.T) {
 	}
 }
 
+func TestConsensusPinUnchanged(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanRaft(p2pPort)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.Pin{Cid: c, ReplicationFactor: -1}
+	err := cc.LogPin(pin)
+	if err != nil {
+		t.Fatal("the operation did not make it to the log:", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	index := cc.Status().CommitIndex
+
+	err = cc.LogPin(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if cc.Status().CommitIndex != index {
+		t.Error("an unchanged pin should not be committed")
+	}
+
+	pin.Name = "changed"
+	err = cc.LogPin(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if cc.Status().CommitIndex == index {
+		t.Error("a changed pin should be committed")
+	}
+}
+
+func TestConsensusPinBatch(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanRaft(p2pPort)
+	defer cc.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	err := cc.LogPinBatch([]api.Pin{
+		{Cid: c1, ReplicationFactor: -1},
+		{Cid: c2, ReplicationFactor: -1},
+	})
+	if err != nil {
+		t.Error("the operation did not make it to the log:", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	st, err := cc.State()
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+
+	if len(st.List()) != 2 || !st.Has(c1) || !st.Has(c2) {
+		t.Error("the added pins should be in the state")
+	}
+}
+
 func TestConsensusUnpin(t *testing.T) {
 	cc := testingConsensus(t, p2pPort)
 	defer cleanRaft(p2pPort)
@@ -160,6 +221,53 @@ func TestConsensusAddPeer(t *testing.T) {
 	}
 }
 
+func TestConsensusAddNonVoter(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	cc2 := testingConsensus(t, p2pPortAlt)
+	defer cleanRaft(p2pPort)
+	defer cleanRaft(p2pPortAlt)
+	defer cc.Shutdown()
+	defer cc2.Shutdown()
+
+	if !cc2.Voter() {
+		t.Error("peers are voters by default")
+	}
+
+	addr, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", p2pPortAlt))
+	cc.host.Peerstore().AddAddr(cc2.host.ID(), addr, peerstore.PermanentAddrTTL)
+	err := cc.AddNonVoter(cc2.host.ID())
+	if err != nil {
+		t.Error("the operation did not make it to the log:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = cc2.raft.WaitForPeer(ctx, cc.host.ID().Pretty(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := cc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 {
+		t.Error("non-voters should be part of the peerset")
+	}
+
+	// the only voter keeps the quorum and can commit on its own
+	c, _ := cid.Decode(test.TestCid1)
+	err = cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+	if err != nil {
+		t.Error("the leader should be able to commit:", err)
+	}
+
+	l, err := cc2.Leader()
+	if err != nil || l != cc.host.ID() {
+		t.Error("the non-voter should follow the leader")
+	}
+}
+
 func TestConsensusRmPeer(t *testing.T) {
 	cc := testingConsensus(t, p2pPort)
 	cc2 := testingConsensus(t, p2pPortAlt)
@@ -227,6 +335,86 @@ func TestConsensusLeader(t *testing.T) {
 	}
 }
 
+func TestConsensusLastContact(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanRaft(p2pPort)
+	defer cc.Shutdown()
+
+	// the only peer is the leader
+	last := cc.LastContact()
+	if time.Since(last) > time.Second {
+		t.Error("the leader should always be up to date")
+	}
+}
+
+func TestConsensusStatus(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanRaft(p2pPort)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal("the operation did not make it to the log:", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+
+	err = cc.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := cc.Status()
+	if status.Peer != cc.host.ID() || status.Leader != cc.host.ID() {
+		t.Error("this peer should be the leader")
+	}
+	if status.Term == 0 || status.CommitIndex == 0 {
+		t.Error("expected a term and a commit index")
+	}
+	if status.AppliedIndex != status.CommitIndex {
+		t.Error("all entries should have been applied")
+	}
+	if status.LastSnapshotIndex == 0 || time.Since(status.LastSnapshot) > time.Minute {
+		t.Error("expected the snapshot to be reported")
+	}
+}
+
+func TestSnapshotTime(t *testing.T) {
+	ts := snapshotTime("2-12-1519404800000")
+	if !ts.Equal(time.Unix(1519404800, 0)) {
+		t.Error("unexpected snapshot time:", ts)
+	}
+	if !snapshotTime("bad").IsZero() {
+		t.Error("expected zero time for bad ids")
+	}
+}
+
+func TestConsensusSnapshot(t *testing.T) {
+	cc := testingConsensus(t, p2pPort)
+	defer cleanRaft(p2pPort)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal("the operation did not make it to the log:", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+
+	err = cc.Snapshot()
+	if err != nil {
+		t.Fatal("error taking snapshot:", err)
+	}
+
+	snaps, err := cc.raft.snapshotStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) == 0 {
+		t.Error("expected a snapshot to be stored")
+	}
+}
+
 func TestRaftLatestSnapshot(t *testing.T) {
 	cc := testingConsensus(t, p2pPort)
 	defer cleanRaft(p2pPort)
@@ -289,3 +477,21 @@ func TestRaftLatestSnapshot(t *testing.T) {
 		t.Fatal("Latest snapshot not read")
 	}
 }
+
+func TestHasServer(t *testing.T) {
+	cfg := hraft.Configuration{}
+	if !hasServer(cfg, hraft.ServerID("a")) {
+		t.Error("an empty configuration should be accepted")
+	}
+
+	cfg.Servers = []hraft.Server{
+		{ID: hraft.ServerID("a")},
+		{ID: hraft.ServerID("b")},
+	}
+	if !hasServer(cfg, hraft.ServerID("b")) {
+		t.Error("b is part of the configuration")
+	}
+	if hasServer(cfg, hraft.ServerID("c")) {
+		t.Error("c is not part of the configuration")
+	}
+}
@@ -0,0 +1,409 @@
+package raft
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ipfs/ipfs-cluster/state/encryption"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+// Snapshots are encrypted as a stream, so that they never need to be
+// held in memory. An encrypted snapshot starts with snapshotMagic and a
+// random base nonce, followed by segments of up to snapshotSegmentSize
+// bytes of plaintext, each sealed separately. Every segment is prefixed
+// by its length, whose highest bit marks the last segment. The nonce of
+// each segment is the base nonce with its sequence number XORed in, and
+// the last-segment flag is authenticated too, so segments cannot be
+// reordered, dropped or truncated without decryption failing.
+// Snapshots from previous versions, which are a single sealed blob,
+// remain readable.
+const (
+	snapshotSegmentSize = 64 * 1024
+	lastSegmentFlag     = 1 << 31
+)
+
+var snapshotMagic = []byte("\x00ipfsce1")
+
+var errTruncatedSnapshot = errors.New("encrypted snapshot is truncated")
+
+// segmentNonce returns the nonce for the segment with the given
+// sequence number.
+func segmentNonce(base []byte, seq uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	off := len(nonce) - 8
+	binary.BigEndian.PutUint64(nonce[off:], binary.BigEndian.Uint64(nonce[off:])^seq)
+	return nonce
+}
+
+func segmentAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// segmentWriter encrypts what is written to it, segment by segment.
+// Close must be called to write the last segment.
+type segmentWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	seq   uint64
+	buf   []byte
+}
+
+func newSegmentWriter(w io.Writer, sc *encryption.Cipher) (*segmentWriter, error) {
+	nonce := make([]byte, sc.AEAD.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	header := append(append([]byte{}, snapshotMagic...), nonce...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &segmentWriter{
+		w:     w,
+		aead:  sc.AEAD,
+		nonce: nonce,
+		buf:   make([]byte, 0, snapshotSegmentSize),
+	}, nil
+}
+
+func (sw *segmentWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		free := snapshotSegmentSize - len(sw.buf)
+		if free > len(p) {
+			free = len(p)
+		}
+		sw.buf = append(sw.buf, p[:free]...)
+		p = p[free:]
+		n += free
+		if len(sw.buf) == snapshotSegmentSize {
+			if err := sw.seal(false); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the last segment, which may be empty.
+func (sw *segmentWriter) Close() error {
+	return sw.seal(true)
+}
+
+func (sw *segmentWriter) seal(last bool) error {
+	sealed := sw.aead.Seal(nil, segmentNonce(sw.nonce, sw.seq), sw.buf, segmentAD(last))
+	sw.seq++
+	sw.buf = sw.buf[:0]
+
+	length := uint32(len(sealed))
+	if last {
+		length |= lastSegmentFlag
+	}
+	err := binary.Write(sw.w, binary.BigEndian, length)
+	if err != nil {
+		return err
+	}
+	_, err = sw.w.Write(sealed)
+	return err
+}
+
+// segmentReader decrypts the segments written by a segmentWriter as
+// they are read.
+type segmentReader struct {
+	r     io.ReadCloser
+	aead  cipher.AEAD
+	nonce []byte
+	seq   uint64
+	plain []byte
+	done  bool
+}
+
+func (sr *segmentReader) Read(p []byte) (int, error) {
+	for len(sr.plain) == 0 {
+		if sr.done {
+			return 0, io.EOF
+		}
+		if err := sr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, sr.plain)
+	sr.plain = sr.plain[n:]
+	return n, nil
+}
+
+func (sr *segmentReader) next() error {
+	var length uint32
+	err := binary.Read(sr.r, binary.BigEndian, &length)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errTruncatedSnapshot
+	}
+	if err != nil {
+		return err
+	}
+	last := length&lastSegmentFlag != 0
+	length &^= lastSegmentFlag
+	if int(length) > snapshotSegmentSize+sr.aead.Overhead() {
+		return errors.New("encrypted snapshot segment is too large")
+	}
+
+	sealed := make([]byte, length)
+	_, err = io.ReadFull(sr.r, sealed)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errTruncatedSnapshot
+	}
+	if err != nil {
+		return err
+	}
+	sr.plain, err = sr.aead.Open(sealed[:0], segmentNonce(sr.nonce, sr.seq), sealed, segmentAD(last))
+	if err != nil {
+		return err
+	}
+	sr.seq++
+	sr.done = last
+	return nil
+}
+
+func (sr *segmentReader) Close() error {
+	return sr.r.Close()
+}
+
+// plainSnapshotSize returns the size of the plaintext of a snapshot
+// written by a segmentWriter, given the size of the encrypted one. Raft
+// checks that it receives as many bytes as the snapshot metadata says.
+func plainSnapshotSize(size int64, aead cipher.AEAD) int64 {
+	overhead := int64(4 + aead.Overhead())
+	body := size - int64(len(snapshotMagic)+aead.NonceSize()) - overhead
+	if body < 0 {
+		return 0
+	}
+	full := int64(snapshotSegmentSize) + overhead
+	return body/full*snapshotSegmentSize + body%full
+}
+
+// encryptedSnapshotStore wraps a SnapshotStore so that snapshot contents
+// are encrypted before they hit the disk. Snapshot metadata (index, term,
+// configuration) is left untouched.
+type encryptedSnapshotStore struct {
+	hraft.SnapshotStore
+	cipher *encryption.Cipher
+}
+
+// Create returns a sink which encrypts everything written to it.
+func (s *encryptedSnapshotStore) Create(version hraft.SnapshotVersion, index, term uint64, configuration hraft.Configuration, configurationIndex uint64, trans hraft.Transport) (hraft.SnapshotSink, error) {
+	sink, err := s.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	sw, err := newSegmentWriter(sink, s.cipher)
+	if err != nil {
+		sink.Cancel()
+		return nil, err
+	}
+	return &encryptedSnapshotSink{
+		SnapshotSink: sink,
+		sw:           sw,
+	}, nil
+}
+
+// Open returns a reader which decrypts the contents of a snapshot as
+// they are read.
+func (s *encryptedSnapshotStore) Open(id string) (*hraft.SnapshotMeta, io.ReadCloser, error) {
+	meta, r, err := s.SnapshotStore.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nSize := s.cipher.AEAD.NonceSize()
+	header := make([]byte, len(snapshotMagic)+nSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		r.Close()
+		return nil, nil, err
+	}
+	if n < len(header) || !bytes.Equal(header[:len(snapshotMagic)], snapshotMagic) {
+		return s.openLegacy(meta, header[:n], r)
+	}
+
+	meta.Size = plainSnapshotSize(meta.Size, s.cipher.AEAD)
+	return meta, &segmentReader{
+		r:     r,
+		aead:  s.cipher.AEAD,
+		nonce: header[len(snapshotMagic):],
+	}, nil
+}
+
+// openLegacy decrypts a snapshot sealed as a single blob, as done by
+// previous versions. The start of it has already been read.
+func (s *encryptedSnapshotStore) openLegacy(meta *hraft.SnapshotMeta, start []byte, r io.ReadCloser) (*hraft.SnapshotMeta, io.ReadCloser, error) {
+	defer r.Close()
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := s.cipher.Decrypt(append(start, rest...))
+	if err != nil {
+		return nil, nil, err
+	}
+	meta.Size = int64(len(plain))
+	return meta, ioutil.NopCloser(bytes.NewReader(plain)), nil
+}
+
+// encryptedSnapshotSink encrypts the snapshot as it is written to the
+// underlying sink.
+type encryptedSnapshotSink struct {
+	hraft.SnapshotSink
+	sw *segmentWriter
+}
+
+func (sink *encryptedSnapshotSink) Write(p []byte) (int, error) {
+	return sink.sw.Write(p)
+}
+
+func (sink *encryptedSnapshotSink) Close() error {
+	err := sink.sw.Close()
+	if err != nil {
+		sink.SnapshotSink.Cancel()
+		return err
+	}
+	return sink.SnapshotSink.Close()
+}
+
+// encryptedLogStore wraps a LogStore so that the data carried by the
+// log entries (the pinset operations) is encrypted on disk.
+type encryptedLogStore struct {
+	hraft.LogStore
+	cipher *encryption.Cipher
+}
+
+// GetLog retrieves and decrypts a log entry.
+func (s *encryptedLogStore) GetLog(index uint64, log *hraft.Log) error {
+	err := s.LogStore.GetLog(index, log)
+	if err != nil {
+		return err
+	}
+	if len(log.Data) == 0 {
+		return nil
+	}
+	plain, err := s.cipher.Decrypt(log.Data)
+	if err != nil {
+		return err
+	}
+	log.Data = plain
+	return nil
+}
+
+// StoreLog encrypts and stores a log entry.
+func (s *encryptedLogStore) StoreLog(log *hraft.Log) error {
+	return s.StoreLogs([]*hraft.Log{log})
+}
+
+// StoreLogs encrypts and stores multiple log entries. The given
+// entries are not modified.
+func (s *encryptedLogStore) StoreLogs(logs []*hraft.Log) error {
+	encLogs := make([]*hraft.Log, len(logs), len(logs))
+	for i, l := range logs {
+		encLog := *l
+		if len(l.Data) > 0 {
+			data, err := s.cipher.Encrypt(l.Data)
+			if err != nil {
+				return err
+			}
+			encLog.Data = data
+		}
+		encLogs[i] = &encLog
+	}
+	return s.LogStore.StoreLogs(encLogs)
+}
+
+// checkEncryptedState verifies that the existing Raft data can be read
+// with the configured encryption key, by decrypting the last log entry
+// and the start of the latest snapshot. Otherwise, Raft would fail much
+// later and in confusing ways when the key is set on a data folder
+// written without it (or with a different key).
+func checkEncryptedState(logs hraft.LogStore, snaps hraft.SnapshotStore) error {
+	last, err := logs.LastIndex()
+	if err != nil {
+		return err
+	}
+	if last > 0 {
+		var log hraft.Log
+		if err := logs.GetLog(last, &log); err != nil {
+			return errUndecryptableState(err)
+		}
+	}
+
+	snapMetas, err := snaps.List()
+	if err != nil {
+		return err
+	}
+	if len(snapMetas) == 0 {
+		return nil
+	}
+	_, r, err := snaps.Open(snapMetas[0].ID)
+	if err != nil {
+		return errUndecryptableState(err)
+	}
+	defer r.Close()
+	_, err = r.Read(make([]byte, 1))
+	if err != nil && err != io.EOF {
+		return errUndecryptableState(err)
+	}
+	return nil
+}
+
+func errUndecryptableState(err error) error {
+	return fmt.Errorf(
+		"the raft data cannot be decrypted with the configured encryption key (%s). "+
+			"To encrypt an existing state, export it with `ipfs-cluster-service state export` "+
+			"before setting the key, then set it and run `state cleanup` and `state import`",
+		err,
+	)
+}
+
+// newSnapshotStore returns a file snapshot store in the given folder, which
+// keeps the last retain snapshots and removes older ones. When
+// an encryption key is provided, the store is wrapped to transparently
+// encrypt and decrypt snapshots.
+func newSnapshotStore(dataFolder string, retain int, key []byte) (hraft.SnapshotStore, error) {
+	snapstore, err := hraft.NewFileSnapshotStoreWithLogger(
+		dataFolder, retain, raftStdLogger)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return snapstore, nil
+	}
+
+	sc, err := encryption.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedSnapshotStore{snapstore, sc}, nil
+}
+
+// wrapLogStore wraps the given LogStore with encryption when an
+// encryption key is provided.
+func wrapLogStore(store hraft.LogStore, key []byte) (hraft.LogStore, error) {
+	if len(key) == 0 {
+		return store, nil
+	}
+
+	sc, err := encryption.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedLogStore{store, sc}, nil
+}
@@ -0,0 +1,269 @@
+package raft
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/state/encryption"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestEncryptedSnapshotStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-encryption-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newSnapshotStore(dir, RaftMaxSnapshots, testEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, trans := hraft.NewInmemTransport("")
+	sink, err := store.Create(1, 10, 3, hraft.Configuration{}, 1, trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte("snapshot contents")
+	sink.Write(plain)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The raw store should not see the plaintext
+	rawStore, _ := newSnapshotStore(dir, RaftMaxSnapshots, nil)
+	_, r, err := rawStore.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ioutil.ReadAll(r)
+	r.Close()
+	if bytes.Contains(raw, plain) {
+		t.Error("snapshot was stored in plaintext")
+	}
+
+	meta, r, err := store.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, _ := ioutil.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(dec, plain) {
+		t.Error("decrypted snapshot does not match")
+	}
+	if meta.Index != 10 || meta.Size != int64(len(plain)) {
+		t.Error("unexpected snapshot metadata")
+	}
+}
+
+func TestEncryptedSnapshotStoreSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-encryption-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newSnapshotStore(dir, RaftMaxSnapshots, testEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, trans := hraft.NewInmemTransport("")
+
+	sizes := []int{
+		0,
+		snapshotSegmentSize - 1,
+		snapshotSegmentSize,
+		3*snapshotSegmentSize + 100,
+	}
+	for i, size := range sizes {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		sink, err := store.Create(1, uint64(i+1), 1, hraft.Configuration{}, 1, trans)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Written in small pieces, as the FSM snapshots do
+		for j := 0; j < len(plain); j += 1000 {
+			end := j + 1000
+			if end > len(plain) {
+				end = len(plain)
+			}
+			sink.Write(plain[j:end])
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		meta, r, err := store.Open(sink.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dec, plain) {
+			t.Errorf("%d bytes: decrypted snapshot does not match", size)
+		}
+		if meta.Size != int64(size) {
+			t.Errorf("%d bytes: meta.Size is %d", size, meta.Size)
+		}
+	}
+}
+
+func TestEncryptedSnapshotTruncated(t *testing.T) {
+	sc, err := encryption.New(testEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := make([]byte, 2*snapshotSegmentSize+10)
+	var buf bytes.Buffer
+	sw, err := newSegmentWriter(&buf, sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw.Write(plain)
+	sw.Close()
+	enc := buf.Bytes()
+
+	header := len(snapshotMagic) + sc.AEAD.NonceSize()
+	fullSegment := 4 + snapshotSegmentSize + sc.AEAD.Overhead()
+	cuts := []int{
+		len(enc) - 1,                // last segment cut short
+		header + 2*fullSegment,      // last segment missing
+		header + fullSegment,        // segments missing
+		header + fullSegment/2 + 10, // first segment cut short
+	}
+	for _, cut := range cuts {
+		sr := &segmentReader{
+			r:     ioutil.NopCloser(bytes.NewReader(enc[header:cut])),
+			aead:  sc.AEAD,
+			nonce: enc[len(snapshotMagic):header],
+		}
+		_, err := ioutil.ReadAll(sr)
+		if err == nil {
+			t.Errorf("expected an error reading a snapshot cut at %d", cut)
+		}
+	}
+}
+
+func TestEncryptedSnapshotStoreLegacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-encryption-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sc, err := encryption.New(testEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte("snapshot contents")
+	legacy, err := sc.Encrypt(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshots encrypted by previous versions were a single blob
+	rawStore, _ := newSnapshotStore(dir, RaftMaxSnapshots, nil)
+	_, trans := hraft.NewInmemTransport("")
+	sink, err := rawStore.Create(1, 10, 3, hraft.Configuration{}, 1, trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write(legacy)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, _ := newSnapshotStore(dir, RaftMaxSnapshots, testEncryptionKey)
+	meta, r, err := store.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, _ := ioutil.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(dec, plain) {
+		t.Error("decrypted legacy snapshot does not match")
+	}
+	if meta.Size != int64(len(plain)) {
+		t.Error("unexpected snapshot metadata")
+	}
+}
+
+func TestCheckEncryptedState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-encryption-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Data written without encryption
+	inmem := hraft.NewInmemStore()
+	inmem.StoreLog(&hraft.Log{Index: 1, Term: 1, Type: hraft.LogCommand, Data: []byte("pin operation")})
+	rawSnaps, _ := newSnapshotStore(dir, RaftMaxSnapshots, nil)
+	_, trans := hraft.NewInmemTransport("")
+	sink, _ := rawSnaps.Create(1, 1, 1, hraft.Configuration{}, 1, trans)
+	sink.Write([]byte("snapshot contents"))
+	sink.Close()
+
+	logs, _ := wrapLogStore(inmem, testEncryptionKey)
+	snaps, _ := newSnapshotStore(dir, RaftMaxSnapshots, testEncryptionKey)
+	if checkEncryptedState(logs, snaps) == nil {
+		t.Error("expected an error with an unencrypted log")
+	}
+
+	inmem.DeleteRange(1, 1)
+	logs.StoreLog(&hraft.Log{Index: 2, Term: 1, Type: hraft.LogCommand, Data: []byte("pin operation")})
+	if checkEncryptedState(logs, snaps) == nil {
+		t.Error("expected an error with an unencrypted snapshot")
+	}
+
+	sink, _ = snaps.Create(1, 2, 1, hraft.Configuration{}, 1, trans)
+	sink.Write([]byte("snapshot contents"))
+	sink.Close()
+	if err := checkEncryptedState(logs, snaps); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncryptedLogStore(t *testing.T) {
+	inmem := hraft.NewInmemStore()
+	store, err := wrapLogStore(inmem, testEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := []byte("pin operation")
+	log := &hraft.Log{Index: 1, Term: 1, Type: hraft.LogCommand, Data: plain}
+	if err := store.StoreLog(log); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(log.Data, plain) {
+		t.Error("StoreLog should not modify the given log")
+	}
+
+	var raw hraft.Log
+	inmem.GetLog(1, &raw)
+	if bytes.Equal(raw.Data, plain) {
+		t.Error("log was stored in plaintext")
+	}
+
+	var dec hraft.Log
+	if err := store.GetLog(1, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec.Data, plain) {
+		t.Error("decrypted log does not match")
+	}
+}
@@ -0,0 +1,28 @@
+package raft
+
+import (
+	"sync/atomic"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+// indexedFSM wraps a Raft FSM to remember the index of the log entry
+// which is being applied, so that LogOps can number the operations
+// they record in the pin log with it. Raft applies entries one at a
+// time, in order.
+type indexedFSM struct {
+	hraft.FSM
+	index uint64
+}
+
+// Apply records the index of the entry and applies it to the wrapped
+// FSM.
+func (fsm *indexedFSM) Apply(log *hraft.Log) interface{} {
+	atomic.StoreUint64(&fsm.index, log.Index)
+	return fsm.FSM.Apply(log)
+}
+
+// Index returns the index of the last entry applied.
+func (fsm *indexedFSM) Index() uint64 {
+	return atomic.LoadUint64(&fsm.index)
+}
@@ -2,10 +2,12 @@ package raft
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
 
+	cid "github.com/ipfs/go-cid"
 	consensus "github.com/libp2p/go-libp2p-consensus"
 )
 
@@ -13,6 +15,8 @@ import (
 const (
 	LogOpPin = iota + 1
 	LogOpUnpin
+	LogOpMaintenance
+	LogOpPinBatch
 )
 
 // LogOpType expresses the type of a consensus Operation
@@ -22,9 +26,11 @@ type LogOpType int
 // It implements the consensus.Op interface and it is used by the
 // Consensus component.
 type LogOp struct {
-	Cid       api.PinSerial
-	Type      LogOpType
-	consensus *Consensus
+	Cid         api.PinSerial
+	Pins        []api.PinSerial
+	Maintenance api.PeerMaintenanceSerial
+	Type        LogOpType
+	consensus   *Consensus
 }
 
 // ApplyTo applies the operation to the State
@@ -42,6 +48,7 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 		if err != nil {
 			goto ROLLBACK
 		}
+		op.consensus.logPins(api.PinLogPin, op.Cid)
 		// Async, we let the PinTracker take care of any problems
 		op.consensus.rpcClient.Go("",
 			"Cluster",
@@ -54,6 +61,7 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 		if err != nil {
 			goto ROLLBACK
 		}
+		op.consensus.logPins(api.PinLogUnpin, op.Cid)
 		// Async, we let the PinTracker take care of any problems
 		op.consensus.rpcClient.Go("",
 			"Cluster",
@@ -61,6 +69,27 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 			op.Cid,
 			&struct{}{},
 			nil)
+	case LogOpPinBatch:
+		err = addBatch(state, op.Pins)
+		if err != nil {
+			goto ROLLBACK
+		}
+		op.consensus.logPins(api.PinLogPin, op.Pins...)
+		for _, pin := range op.Pins {
+			// Async, we let the PinTracker take care of any problems
+			op.consensus.rpcClient.Go("",
+				"Cluster",
+				"Track",
+				pin,
+				&struct{}{},
+				nil)
+		}
+	case LogOpMaintenance:
+		pm := op.Maintenance.ToPeerMaintenance()
+		err = state.SetMaintenance(pm.Peer, pm.Enabled)
+		if err != nil {
+			goto ROLLBACK
+		}
 
 	default:
 		logger.Error("unknown LogOp type. Ignoring")
@@ -75,3 +104,78 @@ ROLLBACK:
 	logger.Error("Rollbacks are not implemented")
 	return nil, errors.New("a rollback may be necessary. Reason: " + err.Error())
 }
+
+// logPins records the applied pins in the pin log of the peer, numbered
+// with the index of the Raft log entry being applied. The call is
+// synchronous so that they are recorded in the order in which they are
+// applied. Entries which are applied again when the peer restarts are
+// ignored by the log.
+func (cc *Consensus) logPins(op api.PinLogOp, pins ...api.PinSerial) {
+	if cc.rpcClient == nil {
+		return
+	}
+	seq := cc.fsm.Index()
+	entries := make([]api.PinLogEntrySerial, len(pins))
+	for i, pin := range pins {
+		entries[i] = api.PinLogEntrySerial{
+			Seq: seq,
+			Op:  op,
+			Pin: pin,
+		}
+	}
+	err := cc.rpcClient.Call("",
+		"Cluster",
+		"PinLogAdd",
+		entries,
+		&struct{}{})
+	if err != nil {
+		logger.Errorf("error recording %s in the pin log: %s", op, err)
+	}
+}
+
+// batchUndo is what is needed to restore an item of the state
+// after a failed batch.
+type batchUndo struct {
+	cid *cid.Cid
+	had bool
+	pin api.Pin
+}
+
+// addBatch adds all the pins to the state or none. They are validated
+// first, and if adding one fails anyway (i.e. a disk error with a
+// datastore-backed state), the items already added are restored to
+// what they were before.
+func addBatch(st state.State, pins []api.PinSerial) error {
+	batch := make([]api.Pin, len(pins))
+	for i, p := range pins {
+		batch[i] = p.ToPin()
+		if batch[i].Cid == nil {
+			return fmt.Errorf("bad cid in pin batch: %s", p.Cid)
+		}
+	}
+
+	undo := make([]batchUndo, 0, len(batch))
+	for _, pin := range batch {
+		u := batchUndo{cid: pin.Cid, had: st.Has(pin.Cid)}
+		if u.had {
+			u.pin = st.Get(pin.Cid)
+		}
+		err := st.Add(pin)
+		if err != nil {
+			for i := len(undo) - 1; i >= 0; i-- {
+				var uerr error
+				if undo[i].had {
+					uerr = st.Add(undo[i].pin)
+				} else {
+					uerr = st.Rm(undo[i].cid)
+				}
+				if uerr != nil {
+					logger.Errorf("undoing pin batch for %s: %s", undo[i].cid, uerr)
+				}
+			}
+			return err
+		}
+		undo = append(undo, u)
+	}
+	return nil
+}
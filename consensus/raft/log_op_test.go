@@ -1,6 +1,7 @@
 package raft
 
 import (
+	"errors"
 	"testing"
 
 	cid "github.com/ipfs/go-cid"
@@ -48,6 +49,50 @@ func TestApplyToUnpin(t *testing.T) {
 	}
 }
 
+// failingState fails to add the given cid.
+type failingState struct {
+	*mapstate.MapState
+	fail string
+}
+
+func (st *failingState) Add(pin api.Pin) error {
+	if pin.Cid.String() == st.fail {
+		return errors.New("add failed")
+	}
+	return st.MapState.Add(pin)
+}
+
+func TestApplyToPinBatchFailure(t *testing.T) {
+	c1, _ := cid.Decode(test.TestCid1)
+	st := &failingState{MapState: mapstate.NewMapState(), fail: test.TestCid3}
+	st.Add(api.Pin{Cid: c1, Name: "old", ReplicationFactor: -1})
+
+	op := &LogOp{
+		Pins: []api.PinSerial{
+			{Cid: test.TestCid1, Name: "new"},
+			{Cid: test.TestCid2},
+			{Cid: test.TestCid3},
+		},
+		Type: LogOpPinBatch,
+	}
+	_, err := op.ApplyTo(st)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if st.Get(c1).Name != "old" || len(st.List()) != 1 {
+		t.Error("the pins added before the failure should have been undone")
+	}
+
+	op.Pins = []api.PinSerial{{Cid: test.TestCid2}, {Cid: "abc"}}
+	_, err = op.ApplyTo(st)
+	if err == nil {
+		t.Fatal("expected an error with a bad cid")
+	}
+	if len(st.List()) != 1 {
+		t.Error("nothing should have been added")
+	}
+}
+
 func TestApplyToBadState(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
@@ -6,6 +6,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	hraft "github.com/hashicorp/raft"
@@ -14,6 +16,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-peer"
 	p2praft "github.com/libp2p/go-libp2p-raft"
 
+	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
 )
 
@@ -21,14 +24,16 @@ import (
 // because the cluster peers do not match the raft peers.
 var errBadRaftState = errors.New("cluster peers do not match raft peers")
 
+// errNotInPeerset is returned when the consensus component cannot start
+// because this peer is not part of the persisted raft peerset.
+var errNotInPeerset = errors.New("this peer is not part of the persisted raft peerset")
+
 // ErrWaitingForSelf is returned when we are waiting for ourselves to depart
 // the peer set, which won't happen
 var errWaitingForSelf = errors.New("waiting for ourselves to depart")
 
 // RaftMaxSnapshots indicates how many snapshots to keep in the consensus data
-// folder.
-// TODO: Maybe include this in Config. Not sure how useful it is to touch
-// this anyways.
+// folder by default. See Config.MaxSnapshots.
 var RaftMaxSnapshots = 5
 
 // RaftLogCacheSize is the maximum number of logs to cache in-memory.
@@ -85,8 +90,7 @@ func newRaftWrapper(peers []peer.ID, host host.Host, cfg *Config, fsm hraft.FSM)
 	var snap hraft.SnapshotStore
 
 	logger.Debug("creating raft snapshot store")
-	snapstore, err := hraft.NewFileSnapshotStoreWithLogger(
-		dataFolder, RaftMaxSnapshots, raftStdLogger)
+	snapstore, err := newSnapshotStore(dataFolder, cfg.MaxSnapshots, cfg.EncryptionKey)
 	if err != nil {
 		return nil, err
 	}
@@ -98,9 +102,15 @@ func newRaftWrapper(peers []peer.ID, host host.Host, cfg *Config, fsm hraft.FSM)
 		return nil, err
 	}
 
+	// encrypts log entries if an encryption key is configured.
+	logStore, err := wrapLogStore(store, cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
 	// wraps the store in a LogCache to improve performance.
 	// See consul/agent/consul/serger.go
-	cacheStore, err := hraft.NewLogCache(RaftLogCacheSize, store)
+	cacheStore, err := hraft.NewLogCache(RaftLogCacheSize, logStore)
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +124,12 @@ func newRaftWrapper(peers []peer.ID, host host.Host, cfg *Config, fsm hraft.FSM)
 	if err != nil {
 		return nil, err
 	}
+	if hasState && len(cfg.EncryptionKey) > 0 {
+		err := checkEncryptedState(logStore, snapstore)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if !hasState {
 		logger.Info("initializing raft cluster")
 		err := hraft.BootstrapCluster(cfg.RaftConfig,
@@ -128,7 +144,7 @@ func newRaftWrapper(peers []peer.ID, host host.Host, cfg *Config, fsm hraft.FSM)
 
 	logger.Debug("creating Raft")
 	r, err := hraft.NewRaft(cfg.RaftConfig,
-		fsm, log, stable, snap, transport)
+		&compressedFSM{fsm}, log, stable, snap, transport)
 	if err != nil {
 		logger.Error("initializing raft: ", err)
 		return nil, err
@@ -152,6 +168,25 @@ func newRaftWrapper(peers []peer.ID, host host.Host, cfg *Config, fsm hraft.FSM)
 			return nil, err
 		}
 		currentCfg := cf.Configuration()
+		if !hasServer(currentCfg, cfg.RaftConfig.LocalID) {
+			raftW.Shutdown()
+			logger.Error("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
+			logger.Errorf("This peer (%s) is not part of the raft peerset", cfg.RaftConfig.LocalID)
+			logger.Error("stored in its data folder. This happens when the peer was removed")
+			logger.Error("from the cluster or when the identity (id and private_key) in the")
+			logger.Error("configuration has changed since the raft state was created.")
+			logger.Error("To fix it, either restore the original identity or clean the raft")
+			logger.Errorf("state for this peer (%s)", dataFolder)
+			logger.Error("with \"ipfs-cluster-service state cleanup\" and bootstrap it to a")
+			logger.Error("working cluster.")
+			logger.Error("Raft peers:")
+			for _, s := range currentCfg.Servers {
+				logger.Errorf("  - %s", s.ID)
+			}
+			logger.Error("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
+			return nil, errNotInPeerset
+		}
+
 		added, removed := diffConfigurations(srvCfg, currentCfg)
 		if len(added)+len(removed) > 0 {
 			raftW.Shutdown()
@@ -178,6 +213,21 @@ func newRaftWrapper(peers []peer.ID, host host.Host, cfg *Config, fsm hraft.FSM)
 	return raftW, nil
 }
 
+// hasServer returns true if the given server ID is part of the given
+// configuration or if the configuration is empty (as it is before
+// bootstrapping).
+func hasServer(cfg hraft.Configuration, id hraft.ServerID) bool {
+	if len(cfg.Servers) == 0 {
+		return true
+	}
+	for _, s := range cfg.Servers {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 // returns the folder path after creating it.
 // if folder is empty, it uses baseDir+Default.
 func makeDataFolder(baseDir, folder string) (string, error) {
@@ -340,6 +390,57 @@ func (rw *raftWrapper) Snapshot() error {
 	return nil
 }
 
+// LastContact returns the last time this peer heard from the
+// leader, or the current time if it is the leader.
+func (rw *raftWrapper) LastContact() time.Time {
+	if rw.raft.State() == hraft.Leader {
+		return time.Now()
+	}
+	return rw.raft.LastContact()
+}
+
+// Status returns the term and indexes of this peer, as reported by
+// Raft, along with the time of the last snapshot.
+func (rw *raftWrapper) Status() api.ConsensusStatus {
+	stats := rw.raft.Stats()
+	parseUint := func(key string) uint64 {
+		n, err := strconv.ParseUint(stats[key], 10, 64)
+		if err != nil {
+			logger.Debugf("bad raft stat %s: %s", key, stats[key])
+		}
+		return n
+	}
+
+	status := api.ConsensusStatus{
+		Term:              parseUint("term"),
+		CommitIndex:       parseUint("commit_index"),
+		AppliedIndex:      parseUint("applied_index"),
+		LastSnapshotIndex: parseUint("last_snapshot_index"),
+		LastContact:       rw.LastContact(),
+	}
+
+	snaps, err := rw.snapshotStore.List()
+	if err == nil && len(snaps) > 0 {
+		status.LastSnapshot = snapshotTime(snaps[0].ID)
+	}
+	return status
+}
+
+// snapshotTime extracts the creation time from the ID of a file
+// snapshot (term-index-milliseconds). It returns the zero time
+// when it cannot.
+func snapshotTime(id string) time.Time {
+	parts := strings.Split(id, "-")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	ms, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
 // snapshotOnShutdown attempts to take a snapshot before a shutdown.
 // Snapshotting might fail if the raft applied index is not the last index.
 // This waits for the updates and tries to take a snapshot when the
@@ -405,7 +506,7 @@ func (rw *raftWrapper) Shutdown() error {
 }
 
 // AddPeer adds a peer to Raft
-func (rw *raftWrapper) AddPeer(peer string) error {
+func (rw *raftWrapper) AddPeer(peer string, voter bool) error {
 	// Check that we don't have it to not waste
 	// log entries if so.
 	peers, err := rw.Peers()
@@ -417,7 +518,11 @@ func (rw *raftWrapper) AddPeer(peer string) error {
 		return nil
 	}
 
-	future := rw.raft.AddVoter(
+	addF := rw.raft.AddVoter
+	if !voter {
+		addF = rw.raft.AddNonvoter
+	}
+	future := addF(
 		hraft.ServerID(peer),
 		hraft.ServerAddress(peer),
 		0,
@@ -483,8 +588,8 @@ func (rw *raftWrapper) Peers() ([]string, error) {
 // latestSnapshot looks for the most recent raft snapshot stored at the
 // provided basedir.  It returns a boolean indicating if any snapshot is
 // readable, the snapshot's metadata, and a reader to the snapshot's bytes
-func latestSnapshot(raftDataFolder string) (*hraft.SnapshotMeta, io.ReadCloser, error) {
-	store, err := hraft.NewFileSnapshotStore(raftDataFolder, RaftMaxSnapshots, nil)
+func latestSnapshot(raftDataFolder string, key []byte) (*hraft.SnapshotMeta, io.ReadCloser, error) {
+	store, err := newSnapshotStore(raftDataFolder, RaftMaxSnapshots, key)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -499,7 +604,12 @@ func latestSnapshot(raftDataFolder string) (*hraft.SnapshotMeta, io.ReadCloser,
 	if err != nil {
 		return nil, nil, err
 	}
-	return meta, r, nil
+	dr, err := decompressSnapshot(r)
+	if err != nil {
+		r.Close()
+		return nil, nil, err
+	}
+	return meta, dr, nil
 }
 
 // LastStateRaw returns the bytes of the last snapshot stored, its metadata,
@@ -510,7 +620,7 @@ func LastStateRaw(cfg *Config) (io.Reader, bool, error) {
 	if err != nil {
 		return nil, false, err
 	}
-	meta, r, err := latestSnapshot(dataFolder)
+	meta, r, err := latestSnapshot(dataFolder, cfg.EncryptionKey)
 	if err != nil {
 		return nil, false, err
 	}
@@ -520,6 +630,61 @@ func LastStateRaw(cfg *Config) (io.Reader, bool, error) {
 	return r, true, nil
 }
 
+// SnapshotIndexes returns the raft indexes of the snapshots currently
+// stored in the data folder, from the most recent to the oldest.
+func SnapshotIndexes(cfg *Config) ([]uint64, error) {
+	dataFolder, err := makeDataFolder(cfg.BaseDir, cfg.DataFolder)
+	if err != nil {
+		return nil, err
+	}
+	store, err := newSnapshotStore(dataFolder, cfg.MaxSnapshots, cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	snapMetas, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([]uint64, len(snapMetas), len(snapMetas))
+	for i, meta := range snapMetas {
+		indexes[i] = meta.Index
+	}
+	return indexes, nil
+}
+
+// StateRawAt returns the bytes of the stored snapshot taken at the given
+// raft index and a flag indicating whether such snapshot was found.
+func StateRawAt(cfg *Config, index uint64) (io.Reader, bool, error) {
+	dataFolder, err := makeDataFolder(cfg.BaseDir, cfg.DataFolder)
+	if err != nil {
+		return nil, false, err
+	}
+	store, err := newSnapshotStore(dataFolder, cfg.MaxSnapshots, cfg.EncryptionKey)
+	if err != nil {
+		return nil, false, err
+	}
+	snapMetas, err := store.List()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, meta := range snapMetas {
+		if meta.Index != index {
+			continue
+		}
+		_, r, err := store.Open(meta.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		dr, err := decompressSnapshot(r)
+		if err != nil {
+			r.Close()
+			return nil, false, err
+		}
+		return dr, true, nil
+	}
+	return nil, false, nil
+}
+
 // SnapshotSave saves the provided state to a snapshot in the
 // raft data path.  Old raft data is backed up and replaced
 // by the new snapshot
@@ -528,11 +693,15 @@ func SnapshotSave(cfg *Config, newState state.State, pid peer.ID) error {
 	if err != nil {
 		return err
 	}
+	newStateBytes, err = compressSnapshot(newStateBytes)
+	if err != nil {
+		return err
+	}
 	dataFolder, err := makeDataFolder(cfg.BaseDir, cfg.DataFolder)
 	if err != nil {
 		return err
 	}
-	meta, _, err := latestSnapshot(dataFolder)
+	meta, _, err := latestSnapshot(dataFolder, cfg.EncryptionKey)
 	if err != nil {
 		return err
 	}
@@ -555,7 +724,7 @@ func SnapshotSave(cfg *Config, newState state.State, pid peer.ID) error {
 		srvCfg = makeServerConf([]peer.ID{pid})
 	}
 
-	snapshotStore, err := hraft.NewFileSnapshotStoreWithLogger(dataFolder, RaftMaxSnapshots, nil)
+	snapshotStore, err := newSnapshotStore(dataFolder, cfg.MaxSnapshots, cfg.EncryptionKey)
 	if err != nil {
 		return err
 	}
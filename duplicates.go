@@ -0,0 +1,165 @@
+package ipfscluster
+
+import (
+	"sort"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// findDuplicatePins groups the given pins by the content they reference
+// and returns the groups with more than one pin, sorted by multihash.
+// The pins in every group are sorted by Cid.
+func findDuplicatePins(pins []api.Pin) []api.DuplicatePins {
+	groups := make(map[string][]api.Pin)
+	for _, p := range pins {
+		if p.Cid == nil {
+			continue
+		}
+		k := state.ContentKey(p.Cid)
+		groups[k] = append(groups[k], p)
+	}
+
+	dups := []api.DuplicatePins{}
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool {
+			return g[i].Cid.String() < g[j].Cid.String()
+		})
+		dups = append(dups, api.DuplicatePins{
+			Multihash: g[0].Cid.Hash().B58String(),
+			Pins:      g,
+		})
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		return dups[i].Multihash < dups[j].Multihash
+	})
+	return dups
+}
+
+// mergePins returns the pin which should be kept out of a group of
+// duplicates, with the rest of them added as its aliases. The kept pin
+// is the one with the largest replication factor (-1 being the largest),
+// so merging never lowers the replication of an item.
+func mergePins(group []api.Pin) api.Pin {
+	keepIdx := 0
+	for i, p := range group {
+		if largerReplication(p.ReplicationFactor, group[keepIdx].ReplicationFactor) {
+			keepIdx = i
+		}
+	}
+
+	keep := group[keepIdx]
+	for i, p := range group {
+		if i == keepIdx {
+			continue
+		}
+		for _, a := range append([]*cid.Cid{p.Cid}, p.Aliases...) {
+			if !a.Equals(keep.Cid) && !keep.HasAlias(a) {
+				keep.Aliases = append(keep.Aliases, a)
+			}
+		}
+	}
+	return keep
+}
+
+func largerReplication(a, b int) bool {
+	switch {
+	case a == b:
+		return false
+	case a < 0:
+		return true
+	case b < 0:
+		return false
+	default:
+		return a > b
+	}
+}
+
+// DuplicatePins returns the groups of pins in the shared state which
+// reference the same content under different Cids (i.e. the CIDv0 and
+// the CIDv1 of an item). Each of those pins is allocated separately, so
+// the content is replicated more than intended.
+func (c *Cluster) DuplicatePins() ([]api.DuplicatePins, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	return findDuplicatePins(cState.List()), nil
+}
+
+// MergeDuplicatePins merges every group of duplicate pins into a single
+// pin which keeps the other Cids as aliases. The rest of the pins in the
+// group are unpinned. It returns the groups which were merged. Aliases
+// can only be unpinned on their own while MergeDuplicatePins is enabled
+// in the configuration.
+func (c *Cluster) MergeDuplicatePins() ([]api.DuplicatePins, error) {
+	dups, err := c.DuplicatePins()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range dups {
+		keep := mergePins(d.Pins)
+		logger.Infof("merging duplicate pins for %s into %s", d.Multihash, keep.Cid)
+		err := c.consensus.LogPin(keep)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range d.Pins {
+			if p.Cid.Equals(keep.Cid) {
+				continue
+			}
+			err := c.consensus.LogUnpin(api.PinCid(p.Cid))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dups, nil
+}
+
+// equivalentPin returns the pin in the shared state which references the
+// same content as the given Cid under a different Cid, if any.
+func (c *Cluster) equivalentPin(h *cid.Cid) (api.Pin, bool) {
+	pins, ok := c.otherContentPins(h)
+	if !ok || len(pins) == 0 {
+		return api.Pin{}, false
+	}
+	return pins[0], true
+}
+
+// aliasOwner returns the pin in the shared state which has the given
+// Cid as an alias, if any.
+func (c *Cluster) aliasOwner(h *cid.Cid) (api.Pin, bool) {
+	pins, _ := c.otherContentPins(h)
+	for _, p := range pins {
+		if p.HasAlias(h) {
+			return p, true
+		}
+	}
+	return api.Pin{}, false
+}
+
+// otherContentPins returns the pins which reference the same content as
+// the given Cid, which is not pinned itself, using the content index of
+// the shared state. It returns false when the Cid is pinned or the state
+// is not available.
+func (c *Cluster) otherContentPins(h *cid.Cid) ([]api.Pin, bool) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		return nil, false
+	}
+	pins := cState.ByContent(h)
+	for _, p := range pins {
+		if p.Cid.Equals(h) {
+			return nil, false
+		}
+	}
+	return pins, true
+}
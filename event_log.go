@@ -0,0 +1,76 @@
+package ipfscluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// EventLogSize is the number of events that each peer remembers for the
+// clients following them with Events. Older events are forgotten.
+var EventLogSize = 1024
+
+// EventsWait is how long Events waits for a new event before returning
+// an empty list.
+var EventsWait = 5 * time.Second
+
+// eventLog keeps the last events which happened in this peer (pin status
+// changes, peerset changes and alerts) in a ring buffer, numbered with
+// increasing sequence numbers, starting at 1 when the peer starts.
+type eventLog struct {
+	mux     sync.Mutex
+	entries []api.Event
+	last    uint64
+	// notify is closed and replaced every time an event is added.
+	notify chan struct{}
+}
+
+func newEventLog(size int) *eventLog {
+	if size <= 0 {
+		size = 1
+	}
+	return &eventLog{
+		entries: make([]api.Event, size, size),
+		notify:  make(chan struct{}),
+	}
+}
+
+// add numbers and timestamps an event, appends it to the log and
+// wakes up anyone waiting for it.
+func (el *eventLog) add(ev api.Event) {
+	el.mux.Lock()
+	defer el.mux.Unlock()
+	el.last++
+	ev.Seq = el.last
+	ev.TS = time.Now()
+	el.entries[el.last%uint64(len(el.entries))] = ev
+	close(el.notify)
+	el.notify = make(chan struct{})
+}
+
+// since returns the remembered events with a sequence number larger than
+// seq, from the oldest to the newest, along with a channel which is
+// closed when the next event is added. Unlike the pin log, events are not
+// guaranteed: when some of them have been forgotten, the remembered ones
+// are returned, and when seq is in the future (i.e. the peer restarted),
+// all of them are.
+func (el *eventLog) since(seq uint64) ([]api.Event, <-chan struct{}) {
+	el.mux.Lock()
+	defer el.mux.Unlock()
+
+	size := uint64(len(el.entries))
+	first := uint64(1)
+	if el.last > size {
+		first = el.last - size + 1
+	}
+	if seq > el.last || seq+1 < first {
+		seq = first - 1
+	}
+
+	evs := make([]api.Event, 0, el.last-seq)
+	for i := seq + 1; i <= el.last; i++ {
+		evs = append(evs, el.entries[i%size])
+	}
+	return evs, el.notify
+}
@@ -0,0 +1,49 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestEventLog(t *testing.T) {
+	el := newEventLog(3)
+	evs, notify := el.since(0)
+	if len(evs) != 0 {
+		t.Fatal("log should be empty")
+	}
+
+	go el.add(api.Event{Type: api.EventPeerJoined, Peer: test.TestPeerID1})
+	select {
+	case <-notify:
+	case <-time.After(time.Second):
+		t.Fatal("should have been notified of the new event")
+	}
+
+	el.add(api.Event{Type: api.EventAlert, Peer: test.TestPeerID1, MetricName: "ping"})
+	el.add(api.Event{Type: api.EventPeerLeft, Peer: test.TestPeerID1})
+	evs, _ = el.since(1)
+	if len(evs) != 2 || evs[0].Seq != 2 || evs[1].Type != api.EventPeerLeft {
+		t.Fatal("unexpected events:", evs)
+	}
+
+	// overwrite the oldest event. The remembered ones are returned.
+	el.add(api.Event{Type: api.EventPeerJoined, Peer: test.TestPeerID2})
+	evs, _ = el.since(0)
+	if len(evs) != 3 || evs[0].Seq != 2 || evs[2].Seq != 4 {
+		t.Error("unexpected events after wrapping:", evs)
+	}
+
+	evs, _ = el.since(4)
+	if len(evs) != 0 {
+		t.Error("expected no events after the last one")
+	}
+
+	// in the future: everything is returned
+	evs, _ = el.since(10)
+	if len(evs) != 3 {
+		t.Error("expected all events when the sequence is in the future")
+	}
+}
@@ -0,0 +1,161 @@
+package ipfscluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	floodsub "github.com/libp2p/go-floodsub"
+)
+
+// PinEventSubscriberCap specifies how much buffer the channels returned
+// by SubscribePinEvents have. Events are dropped for subscribers which do
+// not keep up.
+var PinEventSubscriberCap = 256
+
+// setupPinEvents starts distributing the events from the PinTracker to
+// the subscribers and, when PinEventsTopic is set, to the peers listening
+// on that pubsub topic.
+func (c *Cluster) setupPinEvents() error {
+	c.eventSubs = make(map[chan api.PinEvent]struct{})
+	if c.config.PinEventsTopic != "" {
+		ps, err := floodsub.NewFloodSub(c.ctx, c.host)
+		if err != nil {
+			return err
+		}
+		c.pubsub = ps
+	}
+	go c.watchPinEvents()
+	return nil
+}
+
+func (c *Cluster) watchPinEvents() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case ev := <-c.tracker.Events():
+			pinEv := ev
+			c.eventLog.add(api.Event{Type: api.EventPinStatus, PinEvent: &pinEv})
+			c.eventSubsMux.Lock()
+			for ch := range c.eventSubs {
+				select {
+				case ch <- ev:
+				default:
+					logger.Warning("pin event subscriber is not keeping up. Dropping event")
+				}
+			}
+			c.eventSubsMux.Unlock()
+			c.publishPinEvent(ev)
+		}
+	}
+}
+
+func (c *Cluster) publishPinEvent(ev api.PinEvent) {
+	if c.pubsub == nil || c.config.PinEventsTopic == "" {
+		return
+	}
+	data, err := json.Marshal(ev.ToSerial())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	err = c.pubsub.Publish(c.config.PinEventsTopic, data)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// SubscribePinEvents returns a channel on which an event is delivered
+// every time the status of an item changes in this peer. The channel is
+// closed when the context is cancelled or the peer shuts down.
+func (c *Cluster) SubscribePinEvents(ctx context.Context) <-chan api.PinEvent {
+	ch := make(chan api.PinEvent, PinEventSubscriberCap)
+	c.eventSubsMux.Lock()
+	c.eventSubs[ch] = struct{}{}
+	c.eventSubsMux.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.ctx.Done():
+		}
+		c.eventSubsMux.Lock()
+		delete(c.eventSubs, ch)
+		close(ch)
+		c.eventSubsMux.Unlock()
+	}()
+	return ch
+}
+
+// Events returns the events which happened in this peer after the given
+// sequence number: pin status changes, peers joining and leaving the
+// peerset and alerts. When there are none, it waits for up to EventsWait
+// for new ones. Only the last EventLogSize events are remembered, and
+// sequence numbers start again when the peer restarts, in which case all
+// the remembered events are returned. Clients can follow them by calling
+// it again with the last sequence number they have seen.
+func (c *Cluster) Events(since uint64) []api.Event {
+	evs, notify := c.eventLog.since(since)
+	if len(evs) > 0 {
+		return evs
+	}
+	select {
+	case <-notify:
+	case <-time.After(EventsWait):
+	case <-c.ctx.Done():
+	}
+	evs, _ = c.eventLog.since(since)
+	return evs
+}
+
+// SubscribeClusterPinEvents works like SubscribePinEvents, but delivers
+// the events of every peer publishing them on PinEventsTopic, this one
+// included. It returns an error when PinEventsTopic is not set.
+func (c *Cluster) SubscribeClusterPinEvents(ctx context.Context) (<-chan api.PinEvent, error) {
+	if c.pubsub == nil || c.config.PinEventsTopic == "" {
+		return nil, errors.New("cluster.pin_events_topic is not set")
+	}
+	sub, err := c.pubsub.Subscribe(c.config.PinEventsTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	// stop when the peer shuts down too
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.ctx.Done():
+			cancel()
+		}
+	}()
+
+	ch := make(chan api.PinEvent, PinEventSubscriberCap)
+	go func() {
+		defer close(ch)
+		defer sub.Cancel()
+		defer cancel()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil { // cancelled
+				return
+			}
+			var evs api.PinEventSerial
+			err = json.Unmarshal(msg.Data, &evs)
+			if err != nil {
+				logger.Warningf("bad pin event from %s: %s", msg.GetFrom(), err)
+				continue
+			}
+			select {
+			case ch <- evs.ToPinEvent():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
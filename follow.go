@@ -0,0 +1,162 @@
+package ipfscluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/rest/client"
+)
+
+// pinLister provides the pinset of a followed cluster.
+type pinLister interface {
+	Allocations() ([]api.Pin, error)
+}
+
+// follower mirrors the pinset of another cluster into this one. Every
+// PollInterval, it lists the pins of the followed cluster through its
+// REST API, pins those which are missing here and unpins those which
+// it mirrored before and are gone there. Mirrored pins carry the API
+// address of the followed cluster as their Origin, so that local pins
+// and pins from other followed clusters are never removed.
+type follower struct {
+	c      *Cluster
+	cfg    FollowConfig
+	origin string
+	remote pinLister
+}
+
+// setupFollowers creates a follower for every cluster in the Follow
+// configuration.
+func (c *Cluster) setupFollowers() error {
+	for _, fcfg := range c.config.Follow {
+		remote, err := client.NewClient(&client.Config{
+			APIAddr:  fcfg.APIAddr,
+			SSL:      fcfg.SSL,
+			Username: fcfg.Username,
+			Password: fcfg.Password,
+		})
+		if err != nil {
+			return err
+		}
+		c.followers = append(c.followers, &follower{
+			c:      c,
+			cfg:    fcfg,
+			origin: fcfg.APIAddr.String(),
+			remote: remote,
+		})
+	}
+	return nil
+}
+
+// run polls the followed cluster until the context is cancelled. Only
+// the leader mirrors the pins, so that they are committed once.
+func (f *follower) run(ctx context.Context) {
+	logger.Infof("following the cluster at %s", f.origin)
+	ticker := time.NewTicker(f.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		leader, err := f.c.consensus.Leader()
+		if err == nil && leader == f.c.id {
+			err = f.sync()
+			if err != nil {
+				logger.Errorf("error following %s: %s", f.origin, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync mirrors the current pinset of the followed cluster.
+func (f *follower) sync() error {
+	remotePins, err := f.remote.Allocations()
+	if err != nil {
+		return err
+	}
+	cState, err := f.c.consensus.State()
+	if err != nil {
+		return err
+	}
+
+	upstream := make(map[string]api.Pin)
+	for _, pin := range remotePins {
+		// meta pins are not pinned in ipfs. Their shards
+		// are listed as pins of their own.
+		if pin.Type == api.MetaType {
+			continue
+		}
+		upstream[pin.Cid.String()] = pin
+	}
+
+	local := make(map[string]api.Pin)
+	for _, pin := range cState.List() {
+		local[pin.Cid.String()] = pin
+	}
+
+	var mirror []api.Pin
+	for k, pin := range upstream {
+		// Items pinned here already, whatever their origin,
+		// are left alone.
+		if _, ok := local[k]; ok {
+			continue
+		}
+		mirror = append(mirror, api.Pin{
+			Cid:               pin.Cid,
+			Name:              pin.Name,
+			ReplicationFactor: f.cfg.ReplicationFactor,
+			Origin:            f.origin,
+		})
+	}
+	f.mirror(mirror)
+
+	var gone []api.Pin
+	for k, pin := range local {
+		if pin.Origin != f.origin {
+			continue
+		}
+		if _, ok := upstream[k]; ok {
+			continue
+		}
+		gone = append(gone, pin)
+	}
+	// An empty pinset is more likely a broken or reset followed
+	// cluster than one which unpinned everything.
+	if len(upstream) == 0 && len(gone) > 0 {
+		logger.Warningf("%s has no pins. Not unpinning the %d items mirrored from it", f.origin, len(gone))
+		return nil
+	}
+	for _, pin := range gone {
+		logger.Infof("%s is no longer pinned in %s. Unpinning", pin.Cid, f.origin)
+		err := f.c.Unpin(pin.Cid)
+		if err != nil {
+			logger.Errorf("error unpinning %s: %s", pin.Cid, err)
+		}
+	}
+	return nil
+}
+
+// mirror pins the given items with PinBatch. When the batch fails (e.g.
+// an item cannot be allocated), those which were not committed are
+// pinned one by one, so that the rest are mirrored anyway.
+func (f *follower) mirror(pins []api.Pin) {
+	if len(pins) == 0 {
+		return
+	}
+	logger.Infof("mirroring %d items from %s", len(pins), f.origin)
+	n, err := f.c.PinBatch(pins)
+	if err == nil {
+		return
+	}
+	logger.Warningf("error mirroring a batch from %s: %s. Pinning items one by one", f.origin, err)
+	for _, pin := range pins[n:] {
+		err := f.c.Pin(pin)
+		if err != nil {
+			logger.Errorf("error mirroring %s from %s: %s", pin.Cid, f.origin, err)
+		}
+	}
+}
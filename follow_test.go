@@ -0,0 +1,96 @@
+package ipfscluster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+type mockPinLister struct {
+	pins []api.Pin
+	err  error
+}
+
+func (m *mockPinLister) Allocations() ([]api.Pin, error) {
+	return m.pins, m.err
+}
+
+func TestFollowerSync(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	c3, _ := cid.Decode(test.TestCid3)
+
+	err := cl.Pin(api.PinCid(c3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &mockPinLister{
+		pins: []api.Pin{
+			{Cid: c1, Name: "one"},
+			{Cid: c2},
+			{Cid: c3},
+		},
+	}
+	f := &follower{
+		c:      cl,
+		cfg:    FollowConfig{ReplicationFactor: -1},
+		origin: "/ip4/1.2.3.4/tcp/9094",
+		remote: remote,
+	}
+
+	err = f.sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin, err := cl.PinGet(c1)
+	if err != nil {
+		t.Fatal("the followed pin should be mirrored:", err)
+	}
+	if pin.Origin != f.origin || pin.Name != "one" || pin.ReplicationFactor != -1 {
+		t.Error("unexpected mirrored pin:", pin)
+	}
+	pin, _ = cl.PinGet(c3)
+	if pin.Origin != "" {
+		t.Error("local pins should not be taken over")
+	}
+
+	remote.pins = []api.Pin{{Cid: c1}}
+	err = f.sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.PinGet(c2); err == nil {
+		t.Error("pins removed from the followed cluster should be unpinned")
+	}
+	if _, err := cl.PinGet(c3); err != nil {
+		t.Error("local pins should be kept")
+	}
+
+	remote.pins = nil
+	err = f.sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.PinGet(c1); err != nil {
+		t.Error("nothing should be unpinned when the followed cluster has no pins")
+	}
+
+	remote.pins = []api.Pin{{Cid: c1}}
+	remote.err = errors.New("unreachable")
+	err = f.sync()
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := cl.PinGet(c1); err != nil {
+		t.Error("nothing should be unpinned when the followed cluster cannot be listed")
+	}
+}
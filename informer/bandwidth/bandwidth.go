@@ -0,0 +1,93 @@
+// Package bandwidth implements an ipfs-cluster informer which samples the
+// bandwidth used by the IPFS daemon and returns the spare bandwidth, that
+// is, the configured capacity minus the current rate, as an api.Metric.
+package bandwidth
+
+import (
+	"fmt"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricName specifies the name of our metric
+var MetricName = "bandwidth"
+
+var logger = logging.Logger("bwinfo")
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces.
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// Name returns the name of this informer.
+func (bw *Informer) Name() string {
+	return MetricName
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (bw *Informer) SetClient(c *rpc.Client) {
+	bw.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (bw *Informer) Shutdown() error {
+	bw.rpcClient = nil
+	return nil
+}
+
+// GetMetric asks the IPFSConnector for the current bandwidth rate and
+// returns the spare bandwidth in bytes per second. Peers using more than
+// their capacity report 0.
+func (bw *Informer) GetMetric() api.Metric {
+	if bw.rpcClient == nil {
+		return api.Metric{
+			Name:  MetricName,
+			Valid: false,
+		}
+	}
+
+	var rate uint64
+	valid := true
+	err := bw.rpcClient.Call("",
+		"Cluster",
+		"IPFSBandwidthRate",
+		struct{}{},
+		&rate)
+	if err != nil {
+		logger.Error(err)
+		valid = false
+	}
+
+	var spare uint64
+	if rate < bw.config.Capacity {
+		spare = bw.config.Capacity - rate
+	}
+
+	m := api.Metric{
+		Name:  MetricName,
+		Value: fmt.Sprintf("%d", spare),
+		Valid: valid,
+	}
+
+	m.SetTTLDuration(bw.config.MetricTTL)
+	return m
+}
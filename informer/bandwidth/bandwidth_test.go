@@ -0,0 +1,81 @@
+package bandwidth
+
+import (
+	"errors"
+	"testing"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+type badRPCService struct{}
+
+func badRPCClient(t *testing.T) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", &badRPCService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (mock *badRPCService) IPFSBandwidthRate(in struct{}, out *uint64) error {
+	*out = 2
+	return errors.New("fake error")
+}
+
+func Test(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Error("metric should be invalid")
+	}
+	inf.SetClient(test.NewMockRPCClient(t))
+	m = inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	// The mock rpc uses 3000 bytes/s
+	if m.Value != "12497000" {
+		t.Error("bad metric value:", m.Value)
+	}
+}
+
+func TestOverCapacity(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Capacity = 1000
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+	inf.SetClient(test.NewMockRPCClient(t))
+	m := inf.GetMetric()
+	if m.Value != "0" {
+		t.Error("a peer over capacity should have no spare bandwidth")
+	}
+}
+
+func TestWithErrors(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+	inf.SetClient(badRPCClient(t))
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Errorf("metric should be invalid")
+	}
+}
@@ -0,0 +1,85 @@
+package bandwidth
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "bandwidth"
+
+// These are the default values for a Config.
+const (
+	DefaultMetricTTL = 30 * time.Second
+	// DefaultCapacity corresponds to a 100Mbit/s link.
+	DefaultCapacity = 12500000
+)
+
+// Config allows to initialize an Informer.
+type Config struct {
+	config.Saver
+
+	MetricTTL time.Duration
+	// Capacity is the bandwidth available to the IPFS daemon, in
+	// bytes per second.
+	Capacity uint64
+}
+
+type jsonConfig struct {
+	MetricTTL string `json:"metric_ttl"`
+	Capacity  uint64 `json:"capacity"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.MetricTTL = DefaultMetricTTL
+	cfg.Capacity = DefaultCapacity
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.MetricTTL <= 0 {
+		return errors.New("bandwidth.metric_ttl is invalid")
+	}
+
+	if cfg.Capacity == 0 {
+		return errors.New("bandwidth.capacity is invalid")
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling bandwidth informer config")
+		return err
+	}
+
+	t, _ := time.ParseDuration(jcfg.MetricTTL)
+	cfg.MetricTTL = t
+	cfg.Capacity = jcfg.Capacity
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.MetricTTL = cfg.MetricTTL.String()
+	jcfg.Capacity = cfg.Capacity
+
+	return config.DefaultJSONMarshal(jcfg)
+}
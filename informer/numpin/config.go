@@ -12,18 +12,34 @@ const configKey = "numpin"
 
 // These are the default values for a Config.
 const (
-	DefaultMetricTTL = 10 * time.Second
+	DefaultMetricTTL  = 10 * time.Second
+	DefaultMetricType = MetricIPFSPins
 )
 
+// String returns a string representation for MetricType.
+func (t MetricType) String() string {
+	switch t {
+	case MetricIPFSPins:
+		return "ipfs"
+	case MetricTrackedPins:
+		return "tracked"
+	case MetricQueuedPins:
+		return "queued"
+	}
+	return ""
+}
+
 // Config allows to initialize an Informer.
 type Config struct {
 	config.Saver
 
 	MetricTTL time.Duration
+	Type      MetricType
 }
 
 type jsonConfig struct {
 	MetricTTL string `json:"metric_ttl"`
+	Type      string `json:"metric_type,omitempty"`
 }
 
 // ConfigKey returns a human-friendly identifier for this
@@ -35,6 +51,7 @@ func (cfg *Config) ConfigKey() string {
 // Default initializes this Config with sensible values.
 func (cfg *Config) Default() error {
 	cfg.MetricTTL = DefaultMetricTTL
+	cfg.Type = DefaultMetricType
 	return nil
 }
 
@@ -42,9 +59,12 @@ func (cfg *Config) Default() error {
 // sensible values.
 func (cfg *Config) Validate() error {
 	if cfg.MetricTTL <= 0 {
-		return errors.New("disk.metric_ttl is invalid")
+		return errors.New("numpin.metric_ttl is invalid")
 	}
 
+	if _, ok := metricNames[cfg.Type]; !ok {
+		return errors.New("numpin.metric_type is invalid")
+	}
 	return nil
 }
 
@@ -59,6 +79,17 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	t, _ := time.ParseDuration(jcfg.MetricTTL)
 	cfg.MetricTTL = t
 
+	switch jcfg.Type {
+	case "", "ipfs": // configurations from older versions have no type
+		cfg.Type = MetricIPFSPins
+	case "tracked":
+		cfg.Type = MetricTrackedPins
+	case "queued":
+		cfg.Type = MetricQueuedPins
+	default:
+		return errors.New("numpin.metric_type is invalid")
+	}
+
 	return cfg.Validate()
 }
 
@@ -67,6 +98,7 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 	jcfg := &jsonConfig{}
 
 	jcfg.MetricTTL = cfg.MetricTTL.String()
+	jcfg.Type = cfg.Type.String()
 
 	return config.DefaultJSONMarshal(jcfg)
 }
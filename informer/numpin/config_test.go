@@ -7,7 +7,8 @@ import (
 
 var cfgJSON = []byte(`
 {
-      "metric_ttl": "1s"
+      "metric_ttl": "1s",
+      "metric_type": "tracked"
 }
 `)
 
@@ -27,6 +28,24 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error decoding metric_ttl")
 	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Type = "abc"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding metric_type")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Type = ""
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || cfg.Type != MetricIPFSPins {
+		t.Error("an empty metric_type should default to ipfs")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -54,4 +73,10 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.Type = 80
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
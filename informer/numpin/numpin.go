@@ -1,5 +1,7 @@
 // Package numpin implements an ipfs-cluster informer which determines how many
-// items this peer is pinning and returns it as api.Metric
+// items this peer is pinning and returns it as api.Metric. Depending on the
+// configured MetricType, it counts the pins in IPFS, the pins tracked by
+// the peer or the pins queued in the peer.
 package numpin
 
 import (
@@ -13,6 +15,27 @@ import (
 // MetricName specifies the name of our metric
 var MetricName = "numpin"
 
+// MetricType identifies which pins are counted by the Informer.
+type MetricType int
+
+// MetricType values
+const (
+	// MetricIPFSPins counts the recursive pins in the IPFS daemon
+	MetricIPFSPins MetricType = iota
+	// MetricTrackedPins counts the pins tracked by this peer, including
+	// the queued ones and those which failed and will be retried
+	MetricTrackedPins
+	// MetricQueuedPins counts the pins waiting to be pinned by this peer
+	MetricQueuedPins
+)
+
+// metricNames maps each MetricType to the name of the metric
+var metricNames = map[MetricType]string{
+	MetricIPFSPins:    MetricName,
+	MetricTrackedPins: MetricName + "-tracked",
+	MetricQueuedPins:  MetricName + "-queued",
+}
+
 // Informer is a simple object to implement the ipfscluster.Informer
 // and Component interfaces
 type Informer struct {
@@ -47,19 +70,42 @@ func (npi *Informer) Shutdown() error {
 
 // Name returns the name of this informer
 func (npi *Informer) Name() string {
-	return MetricName
+	return metricNames[npi.config.Type]
 }
 
-// GetMetric contacts the IPFSConnector component and
-// requests the `pin ls` command. We return the number
-// of pins in IPFS.
+// GetMetric returns the number of pins as counted according to
+// the configured MetricType.
 func (npi *Informer) GetMetric() api.Metric {
 	if npi.rpcClient == nil {
 		return api.Metric{
+			Name:  npi.Name(),
 			Valid: false,
 		}
 	}
 
+	var n int
+	var err error
+	switch npi.config.Type {
+	case MetricTrackedPins, MetricQueuedPins:
+		n, err = npi.trackedPins()
+	default:
+		n, err = npi.ipfsPins()
+	}
+
+	m := api.Metric{
+		Name:  npi.Name(),
+		Value: fmt.Sprintf("%d", n),
+		Valid: err == nil,
+	}
+
+	m.SetTTLDuration(npi.config.MetricTTL)
+	return m
+}
+
+// ipfsPins contacts the IPFSConnector component and
+// requests the `pin ls` command. We return the number
+// of pins in IPFS.
+func (npi *Informer) ipfsPins() (int, error) {
 	pinMap := make(map[string]api.IPFSPinStatus)
 
 	// make use of the RPC API to obtain information
@@ -69,15 +115,41 @@ func (npi *Informer) GetMetric() api.Metric {
 		"IPFSPinLs", // Method name
 		"recursive", // in arg
 		&pinMap)     // out arg
+	return len(pinMap), err
+}
 
-	valid := err == nil
+// trackedPins asks the PinTracker for the items which this peer pins
+// (or is queued to pin) and counts them. Pins which are being pinned
+// are the queued ones.
+func (npi *Informer) trackedPins() (int, error) {
+	var pinInfos []api.PinInfoSerial
+	err := npi.rpcClient.Call("",
+		"Cluster",
+		"TrackerStatusAll",
+		api.StatusFilter{
+			api.TrackerStatusPinning,
+			api.TrackerStatusPinned,
+			api.TrackerStatusPinnedIndirect,
+			api.TrackerStatusPinError,
+		},
+		&pinInfos)
+	if err != nil {
+		return 0, err
+	}
 
-	m := api.Metric{
-		Name:  MetricName,
-		Value: fmt.Sprintf("%d", len(pinMap)),
-		Valid: valid,
+	tracked, queued := 0, 0
+	for _, pinfo := range pinInfos {
+		switch api.TrackerStatusFromString(pinfo.Status) {
+		case api.TrackerStatusPinning:
+			queued++
+			tracked++
+		case api.TrackerStatusPinned, api.TrackerStatusPinnedIndirect, api.TrackerStatusPinError:
+			tracked++
+		}
 	}
 
-	m.SetTTLDuration(npi.config.MetricTTL)
-	return m
+	if npi.config.Type == MetricQueuedPins {
+		return queued, nil
+	}
+	return tracked, nil
 }
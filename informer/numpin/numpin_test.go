@@ -28,6 +28,16 @@ func (mock *mockService) IPFSPinLs(in string, out *map[string]api.IPFSPinStatus)
 	return nil
 }
 
+func (mock *mockService) TrackerStatusAll(in api.StatusFilter, out *[]api.PinInfoSerial) error {
+	*out = []api.PinInfoSerial{
+		{Cid: "QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa", Status: "pinned"},
+		{Cid: "QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6", Status: "pinning"},
+		{Cid: "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq", Status: "pin_error"},
+		{Cid: "QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuNRE", Status: "remote"},
+	}
+	return nil
+}
+
 func Test(t *testing.T) {
 	cfg := &Config{}
 	cfg.Default()
@@ -48,3 +58,32 @@ func Test(t *testing.T) {
 		t.Error("bad metric value")
 	}
 }
+
+func TestTrackedPins(t *testing.T) {
+	testType := func(mtype MetricType, name, value string) {
+		cfg := &Config{}
+		cfg.Default()
+		cfg.Type = mtype
+		inf, err := NewInformer(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inf.Name() != name {
+			t.Error("bad metric name:", inf.Name())
+		}
+		inf.SetClient(mockRPCClient(t))
+		m := inf.GetMetric()
+		if !m.Valid {
+			t.Error("metric should be valid")
+		}
+		if m.Name != name {
+			t.Error("bad metric name:", m.Name)
+		}
+		if m.Value != value {
+			t.Errorf("%s: expected %s but got %s", name, value, m.Value)
+		}
+	}
+
+	testType(MetricTrackedPins, "numpin-tracked", "3")
+	testType(MetricQueuedPins, "numpin-queued", "1")
+}
@@ -0,0 +1,79 @@
+// Package pinqueue implements an ipfs-cluster informer which reports how
+// many pin operations are waiting in the queue of this peer's PinTracker.
+// Its metric is used by the MaxValue allocation filter to skip busy peers.
+package pinqueue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricName specifies the name of our metric
+var MetricName = "pinqueue"
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	metricTTL time.Duration
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an Informer whose metrics are valid for the
+// given TTL.
+func NewInformer(metricTTL time.Duration) (*Informer, error) {
+	if metricTTL <= 0 {
+		return nil, errors.New("pinqueue metric TTL is invalid")
+	}
+	return &Informer{
+		metricTTL: metricTTL,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (pqi *Informer) SetClient(c *rpc.Client) {
+	pqi.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (pqi *Informer) Shutdown() error {
+	pqi.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of this informer
+func (pqi *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetric returns the number of queued pin operations, as reported
+// by the PinTracker.
+func (pqi *Informer) GetMetric() api.Metric {
+	if pqi.rpcClient == nil {
+		return api.Metric{
+			Name:  MetricName,
+			Valid: false,
+		}
+	}
+
+	var tm api.TrackerMetricsSerial
+	err := pqi.rpcClient.Call("",
+		"Cluster",
+		"TrackerMetrics",
+		struct{}{},
+		&tm)
+
+	m := api.Metric{
+		Name:  MetricName,
+		Value: fmt.Sprintf("%d", tm.PinQueue),
+		Valid: err == nil,
+	}
+	m.SetTTLDuration(pqi.metricTTL)
+	return m
+}
@@ -0,0 +1,54 @@
+package pinqueue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+)
+
+type mockService struct{}
+
+func mockRPCClient(t *testing.T) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", &mockService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (mock *mockService) TrackerMetrics(in struct{}, out *api.TrackerMetricsSerial) error {
+	*out = api.TrackerMetricsSerial{
+		PinQueue:   3,
+		UnpinQueue: 1,
+	}
+	return nil
+}
+
+func Test(t *testing.T) {
+	_, err := NewInformer(0)
+	if err == nil {
+		t.Error("expected an error with an invalid TTL")
+	}
+
+	inf, err := NewInformer(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Error("metric should be invalid")
+	}
+	inf.SetClient(mockRPCClient(t))
+	m = inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	if m.Name != MetricName || m.Value != "3" {
+		t.Error("bad metric:", m.Name, m.Value)
+	}
+}
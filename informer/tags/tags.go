@@ -0,0 +1,73 @@
+// Package tags implements an ipfs-cluster informer which reports the
+// tags of this peer (i.e. its region or datacenter) as a comma-separated
+// list of key=value pairs. Its metric is used by the TagMatch allocation
+// filter and by the balanced allocator.
+package tags
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricName specifies the name of our metric
+var MetricName = "tags"
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	tags      map[string]string
+	metricTTL time.Duration
+}
+
+// NewInformer returns an Informer which reports the given tags, with
+// metrics valid for the given TTL.
+func NewInformer(tags map[string]string, metricTTL time.Duration) (*Informer, error) {
+	if metricTTL <= 0 {
+		return nil, errors.New("tags metric TTL is invalid")
+	}
+	return &Informer{
+		tags:      tags,
+		metricTTL: metricTTL,
+	}, nil
+}
+
+// SetClient does nothing, as tags are known locally.
+func (ti *Informer) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing.
+func (ti *Informer) Shutdown() error {
+	return nil
+}
+
+// Name returns the name of this informer
+func (ti *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetric returns the tags of this peer, sorted by key.
+func (ti *Informer) GetMetric() api.Metric {
+	m := api.Metric{
+		Name:  MetricName,
+		Value: tagsToString(ti.tags),
+		Valid: true,
+	}
+	m.SetTTLDuration(ti.metricTTL)
+	return m
+}
+
+// tagsToString formats tags as a comma-separated list of key=value
+// pairs, sorted by key.
+func tagsToString(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
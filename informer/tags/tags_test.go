@@ -0,0 +1,28 @@
+package tags
+
+import (
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) {
+	_, err := NewInformer(nil, 0)
+	if err == nil {
+		t.Error("expected an error with an invalid TTL")
+	}
+
+	inf, err := NewInformer(map[string]string{
+		"region":     "eu",
+		"datacenter": "dc1",
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	if m.Name != MetricName || m.Value != "datacenter=dc1,region=eu" {
+		t.Error("bad metric:", m.Name, m.Value)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"sort"
 	"strings"
 
+	peer "github.com/libp2p/go-libp2p-peer"
+
 	"github.com/ipfs/ipfs-cluster/api"
 )
 
@@ -22,8 +24,41 @@ func jsonFormatObject(resp interface{}) {
 		jsonFormatPrint(resp.(api.Pin).ToSerial())
 	case api.Version:
 		jsonFormatPrint(resp.(api.Version))
+	case api.Health:
+		jsonFormatPrint(resp.(api.Health).ToSerial())
+	case api.SyncStatus:
+		jsonFormatPrint(resp.(api.SyncStatus).ToSerial())
+	case api.TrackerMetrics:
+		jsonFormatPrint(resp.(api.TrackerMetrics).ToSerial())
+	case api.ConnectGraph:
+		jsonFormatPrint(resp.(api.ConnectGraph).ToSerial())
+	case api.ScalingAdvice:
+		jsonFormatPrint(resp.(api.ScalingAdvice).ToSerial())
+	case api.AllocationSimulation:
+		jsonFormatPrint(resp.(api.AllocationSimulation).ToSerial())
+	case api.PeerRemoval:
+		jsonFormatPrint(resp.(api.PeerRemoval).ToSerial())
+	case api.StateStats:
+		jsonFormatPrint(resp.(api.StateStats).ToSerial())
+	case api.PinSummary:
+		jsonFormatPrint(resp.(api.PinSummary).ToSerial())
+	case api.Event:
+		jsonFormatPrint(resp.(api.Event).ToSerial())
 	case api.Error:
 		jsonFormatPrint(resp.(api.Error))
+	case json.RawMessage:
+		jsonFormatPrint(resp.(json.RawMessage))
+	case []peer.ID:
+		jsonFormatPrint(api.PeersToStrings(resp.([]peer.ID)))
+	case []api.BatchResult:
+		jsonFormatPrint(resp.([]api.BatchResult))
+	case []api.PeerLiveness:
+		r := resp.([]api.PeerLiveness)
+		serials := make([]api.PeerLivenessSerial, len(r), len(r))
+		for i, item := range r {
+			serials[i] = item.ToSerial()
+		}
+		jsonFormatPrint(serials)
 	case []api.ID:
 		r := resp.([]api.ID)
 		serials := make([]api.IDSerial, len(r), len(r))
@@ -46,6 +81,50 @@ func jsonFormatObject(resp interface{}) {
 			serials[i] = item.ToSerial()
 		}
 		jsonFormatPrint(serials)
+	case []api.AllocationRecord:
+		r := resp.([]api.AllocationRecord)
+		serials := make([]api.AllocationRecordSerial, len(r), len(r))
+		for i, item := range r {
+			serials[i] = item.ToSerial()
+		}
+		jsonFormatPrint(serials)
+	case []api.LocalPin:
+		r := resp.([]api.LocalPin)
+		serials := make([]api.LocalPinSerial, len(r), len(r))
+		for i, item := range r {
+			serials[i] = item.ToSerial()
+		}
+		jsonFormatPrint(serials)
+	case []api.ConsensusStatus:
+		r := resp.([]api.ConsensusStatus)
+		serials := make([]api.ConsensusStatusSerial, len(r), len(r))
+		for i, item := range r {
+			serials[i] = item.ToSerial()
+		}
+		jsonFormatPrint(serials)
+	case []api.DuplicatePins:
+		r := resp.([]api.DuplicatePins)
+		serials := make([]api.DuplicatePinsSerial, len(r), len(r))
+		for i, item := range r {
+			serials[i] = item.ToSerial()
+		}
+		jsonFormatPrint(serials)
+	case []api.Namespace:
+		jsonFormatPrint(resp)
+	case []api.AddedOutput:
+		r := resp.([]api.AddedOutput)
+		serials := make([]api.AddedOutputSerial, len(r), len(r))
+		for i, item := range r {
+			serials[i] = item.ToSerial()
+		}
+		jsonFormatPrint(serials)
+	case []api.PinLogEntry:
+		r := resp.([]api.PinLogEntry)
+		serials := make([]api.PinLogEntrySerial, len(r), len(r))
+		for i, item := range r {
+			serials[i] = item.ToSerial()
+		}
+		jsonFormatPrint(serials)
 	default:
 		checkErr("", errors.New("unsupported type returned"))
 	}
@@ -73,9 +152,54 @@ func textFormatObject(resp interface{}) {
 	case api.Version:
 		serial := resp.(api.Version)
 		textFormatPrintVersion(&serial)
+	case api.Health:
+		serial := resp.(api.Health).ToSerial()
+		textFormatPrintHealth(&serial)
+	case api.SyncStatus:
+		serial := resp.(api.SyncStatus).ToSerial()
+		textFormatPrintSyncStatus(&serial)
+	case api.TrackerMetrics:
+		serial := resp.(api.TrackerMetrics).ToSerial()
+		textFormatPrintTrackerMetrics(&serial)
+	case api.ConnectGraph:
+		serial := resp.(api.ConnectGraph).ToSerial()
+		textFormatPrintConnectGraph(&serial)
+	case api.ScalingAdvice:
+		serial := resp.(api.ScalingAdvice).ToSerial()
+		textFormatPrintScalingAdvice(&serial)
+	case api.AllocationSimulation:
+		serial := resp.(api.AllocationSimulation).ToSerial()
+		textFormatPrintAllocationSimulation(&serial)
+	case api.PeerRemoval:
+		serial := resp.(api.PeerRemoval).ToSerial()
+		textFormatPrintPeerRemoval(&serial)
+	case api.StateStats:
+		serial := resp.(api.StateStats).ToSerial()
+		textFormatPrintStateStats(&serial)
+	case api.PinSummary:
+		serial := resp.(api.PinSummary).ToSerial()
+		textFormatPrintPinSummary(&serial)
+	case api.Event:
+		serial := resp.(api.Event).ToSerial()
+		textFormatPrintEvent(&serial)
 	case api.Error:
 		serial := resp.(api.Error)
 		textFormatPrintError(&serial)
+	case json.RawMessage:
+		jsonFormatPrint(resp.(json.RawMessage))
+	case []peer.ID:
+		for _, p := range resp.([]peer.ID) {
+			fmt.Println(p.Pretty())
+		}
+	case []api.BatchResult:
+		for _, item := range resp.([]api.BatchResult) {
+			textFormatPrintBatchResult(&item)
+		}
+	case []api.PeerLiveness:
+		for _, item := range resp.([]api.PeerLiveness) {
+			serial := item.ToSerial()
+			textFormatPrintPeerLiveness(&serial)
+		}
 	case []api.ID:
 		for _, item := range resp.([]api.ID) {
 			textFormatObject(item)
@@ -89,6 +213,40 @@ func textFormatObject(resp interface{}) {
 		for _, item := range resp.([]api.Pin) {
 			textFormatObject(item)
 		}
+	case []api.AllocationRecord:
+		for _, item := range resp.([]api.AllocationRecord) {
+			serial := item.ToSerial()
+			textFormatPrintAllocationRecord(&serial)
+		}
+	case []api.LocalPin:
+		for _, item := range resp.([]api.LocalPin) {
+			serial := item.ToSerial()
+			textFormatPrintLocalPin(&serial)
+		}
+	case []api.ConsensusStatus:
+		for _, item := range resp.([]api.ConsensusStatus) {
+			serial := item.ToSerial()
+			textFormatPrintConsensusStatus(&serial)
+		}
+	case []api.DuplicatePins:
+		for _, item := range resp.([]api.DuplicatePins) {
+			serial := item.ToSerial()
+			textFormatPrintDuplicatePins(&serial)
+		}
+	case []api.Namespace:
+		for _, item := range resp.([]api.Namespace) {
+			textFormatPrintNamespace(&item)
+		}
+	case []api.AddedOutput:
+		for _, item := range resp.([]api.AddedOutput) {
+			serial := item.ToSerial()
+			fmt.Printf("added %s %s\n", serial.Cid, serial.Name)
+		}
+	case []api.PinLogEntry:
+		for _, item := range resp.([]api.PinLogEntry) {
+			serial := item.ToSerial()
+			textFormatPrintPinLogEntry(&serial)
+		}
 	default:
 		checkErr("", errors.New("unsupported type returned"))
 	}
@@ -101,6 +259,12 @@ func textFormatPrintIDSerial(obj *api.IDSerial) {
 	}
 
 	fmt.Printf("%s | %s | Sees %d other peers\n", obj.ID, obj.Peername, len(obj.ClusterPeers)-1)
+	if obj.Health != "" && obj.Health != string(api.PeerHealthOK) {
+		fmt.Printf("  > Health: %s\n", obj.Health)
+	}
+	if !obj.PinningEnabled {
+		fmt.Println("  > Pinning disabled")
+	}
 	addrs := make(sort.StringSlice, 0, len(obj.Addresses))
 	for _, a := range obj.Addresses {
 		addrs = append(addrs, string(a))
@@ -137,13 +301,39 @@ func textFormatPrintGPInfo(obj *api.GlobalPinInfoSerial) {
 	for _, k := range peers {
 		v := obj.PeerMap[k]
 		if v.Error != "" {
+			if v.Attempts > 0 {
+				fmt.Printf("    > Peer %s : ERROR | %s | Attempts: %d\n", k, v.Error, v.Attempts)
+				continue
+			}
 			fmt.Printf("    > Peer %s : ERROR | %s\n", k, v.Error)
 			continue
 		}
-		fmt.Printf("    > Peer %s : %s | %s\n", k, strings.ToUpper(v.Status), v.TS)
+		fmt.Printf("    > Peer %s : %s | %s", k, strings.ToUpper(v.Status), v.TS)
+		if v.Blocks > 0 {
+			fmt.Printf(" | %s", pinProgress(v.Blocks, v.Size))
+		}
+		fmt.Println()
 	}
 }
 
+// defaultBlockSize is the size of the blocks produced by the default IPFS
+// chunker, used to estimate how much of a DAG has been fetched.
+const defaultBlockSize = 256 * 1024
+
+// pinProgress describes how far a pin has got. IPFS only reports the
+// number of blocks fetched, so the percentage is an estimate which assumes
+// blocks of the default size.
+func pinProgress(blocks int, size uint64) string {
+	if size == 0 {
+		return fmt.Sprintf("%d blocks fetched", blocks)
+	}
+	pct := uint64(blocks) * defaultBlockSize * 100 / size
+	if pct > 99 {
+		pct = 99
+	}
+	return fmt.Sprintf("%d blocks fetched (~%d%% of %d B)", blocks, pct, size)
+}
+
 func textFormatPrintPInfo(obj *api.PinInfoSerial) {
 	gpinfo := api.GlobalPinInfoSerial{
 		Cid: obj.Cid,
@@ -167,10 +357,354 @@ func textFormatPrintPin(obj *api.PinSerial) {
 		sortAlloc.Sort()
 		fmt.Printf("%s\n", sortAlloc)
 	}
+	if len(obj.Aliases) > 0 {
+		fmt.Printf("  > Aliases: %s\n", obj.Aliases)
+	}
+	if len(obj.Inline) > 0 {
+		fmt.Printf("  > Inline content: %d bytes\n", len(obj.Inline))
+	}
+	if obj.Path != "" {
+		fmt.Printf("  > Path: %s\n", obj.Path)
+	}
+	if obj.Origin != "" {
+		fmt.Printf("  > Mirrored from: %s\n", obj.Origin)
+	}
+	if obj.Namespace != "" {
+		fmt.Printf("  > Namespace: %s\n", obj.Namespace)
+	}
+}
+
+func textFormatPrintDuplicatePins(obj *api.DuplicatePinsSerial) {
+	fmt.Printf("%s:\n", obj.Multihash)
+	for _, p := range obj.Pins {
+		fmt.Printf("  > ")
+		textFormatPrintPin(&p)
+	}
+}
+
+func textFormatPrintStateStats(obj *api.StateStatsSerial) {
+	fmt.Printf("Pins: %d | Allocated everywhere: %d | Replicas: %d\n",
+		obj.Pins, obj.Everywhere, obj.Replicas)
+
+	rfs := make([]int, 0, len(obj.ByReplicationFactor))
+	for rf := range obj.ByReplicationFactor {
+		rfs = append(rfs, rf)
+	}
+	sort.Ints(rfs)
+	fmt.Println("  > By replication factor:")
+	for _, rf := range rfs {
+		fmt.Printf("    - %d: %d\n", rf, obj.ByReplicationFactor[rf])
+	}
+
+	printCounts := func(title string, counts map[string]int) {
+		keys := make([]string, 0, len(counts))
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Printf("  > %s:\n", title)
+		for _, k := range keys {
+			fmt.Printf("    - %s: %d\n", k, counts[k])
+		}
+	}
+	printCounts("By name prefix", obj.ByNamePrefix)
+	printCounts("Replicas by peer", obj.ByPeer)
+}
+
+func textFormatPrintPinSummary(obj *api.PinSummarySerial) {
+	fmt.Printf("Pins: %d\n", obj.Pins)
+
+	statuses := make([]string, 0, len(obj.ByStatus))
+	for st := range obj.ByStatus {
+		statuses = append(statuses, st)
+	}
+	sort.Strings(statuses)
+	fmt.Println("  > By status:")
+	for _, st := range statuses {
+		fmt.Printf("    - %s: %d\n", st, obj.ByStatus[st])
+	}
+
+	peers := make([]string, 0, len(obj.ByPeer))
+	for p := range obj.ByPeer {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	fmt.Println("  > By peer:")
+	for _, p := range peers {
+		pps := obj.ByPeer[p]
+		fmt.Printf("    - %s: pinned: %d | pinning: %d | error: %d\n",
+			p, pps.Pinned, pps.Pinning, pps.Error)
+	}
+}
+
+func textFormatPrintNamespace(obj *api.Namespace) {
+	name := obj.Name
+	if name == "" {
+		name = "(default)"
+	}
+	fmt.Printf("%s | Replication factor: %d | Pins: %d", name, obj.ReplicationFactor, obj.Pins)
+	if obj.MaxPins > 0 {
+		fmt.Printf(" of %d", obj.MaxPins)
+	}
+	fmt.Printf(" | Bytes: %d", obj.Bytes)
+	if obj.MaxBytes > 0 {
+		fmt.Printf(" of %d", obj.MaxBytes)
+	}
+	fmt.Printf("\n")
+}
+
+func textFormatPrintPinLogEntry(obj *api.PinLogEntrySerial) {
+	fmt.Printf("%d | %s | %s | %s\n", obj.Seq, obj.TS, obj.Op, obj.Pin.Cid)
+}
+
+func textFormatPrintEvent(obj *api.EventSerial) {
+	fmt.Printf("%d | %s | %s | ", obj.Seq, obj.TS, obj.Type)
+	switch {
+	case obj.PinEvent != nil:
+		fmt.Printf("%s | %s: %s", obj.PinEvent.Cid, obj.PinEvent.Peer, obj.PinEvent.Status)
+		if obj.PinEvent.Queued {
+			fmt.Printf(" (queued)")
+		}
+		if obj.PinEvent.Error != "" {
+			fmt.Printf(" | %s", obj.PinEvent.Error)
+		}
+	case obj.MetricName != "":
+		fmt.Printf("%s: %s", obj.Peer, obj.MetricName)
+	default:
+		fmt.Printf("%s", obj.Peer)
+	}
+	fmt.Printf("\n")
+}
+
+func textFormatPrintAllocationRecord(obj *api.AllocationRecordSerial) {
+	fmt.Printf("%s | %s | decided by %s | %s\n", obj.Cid, obj.TS, obj.Peer, obj.Reason)
+	if obj.Error != "" {
+		fmt.Printf("  > ERROR: %s\n", obj.Error)
+	}
+	var sortAlloc sort.StringSlice = obj.Allocations
+	sortAlloc.Sort()
+	fmt.Printf("  > Allocations: %s\n", sortAlloc)
+	fmt.Printf("  > Metrics (%s):\n", obj.MetricName)
+	peers := make(sort.StringSlice, 0, len(obj.Metrics))
+	for p := range obj.Metrics {
+		peers = append(peers, p)
+	}
+	peers.Sort()
+	for _, p := range peers {
+		fmt.Printf("    - %s: %s\n", p, obj.Metrics[p])
+	}
+	if len(obj.Considered) > 0 {
+		fmt.Printf("  > Considered: %d peers\n", len(obj.Considered))
+	}
+	if len(obj.Vetoes) > 0 {
+		fmt.Printf("  > Excluded:\n")
+		vetoed := make(sort.StringSlice, 0, len(obj.Vetoes))
+		for p := range obj.Vetoes {
+			vetoed = append(vetoed, p)
+		}
+		vetoed.Sort()
+		for _, p := range vetoed {
+			fmt.Printf("    - %s: %s\n", p, obj.Vetoes[p])
+		}
+	}
+}
+
+func textFormatPrintLocalPin(obj *api.LocalPinSerial) {
+	fmt.Printf("%s | %s", obj.Cid, obj.Type)
+	switch {
+	case !obj.Tracked:
+		fmt.Printf(" | UNTRACKED")
+	case !obj.Allocated:
+		fmt.Printf(" | NOT ALLOCATED")
+	}
+	fmt.Println()
+}
+
+func textFormatPrintHealth(obj *api.HealthSerial) {
+	if obj.Error != "" {
+		fmt.Printf("%s: %s | %s\n", obj.Peer, obj.Status, obj.Error)
+		return
+	}
+	fmt.Printf("%s: %s\n", obj.Peer, obj.Status)
+}
+
+func textFormatPrintSyncStatus(obj *api.SyncStatusSerial) {
+	fmt.Printf("%s:\n", obj.Peer)
+	textFormatPrintSyncInfo("state", &obj.State)
+	textFormatPrintSyncInfo("ipfs", &obj.IPFS)
+}
+
+func textFormatPrintSyncInfo(name string, obj *api.SyncInfoSerial) {
+	if !obj.Enabled {
+		fmt.Printf("  > %s sync: disabled\n", name)
+		return
+	}
+	fmt.Printf("  > %s sync: every %s (+%s jitter)", name, obj.Interval, obj.Jitter)
+	if obj.Last == "" {
+		fmt.Println(" | never run")
+		return
+	}
+	fmt.Printf(" | last: %s | out of sync: %d", obj.Last, obj.OutOfSync)
+	if obj.Error != "" {
+		fmt.Printf(" | %s", obj.Error)
+	}
+	fmt.Println()
+}
+
+func textFormatPrintTrackerMetrics(obj *api.TrackerMetricsSerial) {
+	fmt.Printf("%s:\n", obj.Peer)
+	fmt.Printf("  > queued: %d pins | %d unpins | %d background\n",
+		obj.PinQueue, obj.UnpinQueue, obj.BackgroundQueue)
+	fmt.Printf("  > in flight: %d\n", obj.InFlight)
+	fmt.Printf("  > errors: %d pin | %d unpin\n", obj.PinErrors, obj.UnpinErrors)
+	fmt.Printf("  > retries: %d\n", obj.Retries)
+	fmt.Printf("  > pins: %d (avg. %s)\n", obj.Pins, obj.AvgPinLatency)
+}
+
+func textFormatPrintBatchResult(obj *api.BatchResult) {
+	op := "pinned"
+	if obj.Unpin {
+		op = "unpinned"
+	}
+	if obj.Error != "" {
+		fmt.Printf("%s: not %s | %s\n", obj.Cid, op, obj.Error)
+		return
+	}
+	fmt.Printf("%s: %s\n", obj.Cid, op)
+}
+
+func textFormatPrintConnectGraph(obj *api.ConnectGraphSerial) {
+	peers := make([]string, 0, len(obj.ClusterLinks))
+	for p := range obj.ClusterLinks {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	for _, p := range peers {
+		if p == obj.ClusterID {
+			fmt.Printf("%s (self):\n", p)
+		} else {
+			fmt.Printf("%s:\n", p)
+		}
+		fmt.Printf("  > cluster peers: %d\n", len(obj.ClusterLinks[p]))
+		for _, l := range obj.ClusterLinks[p] {
+			fmt.Printf("    - %s\n", l)
+		}
+		ipfs, ok := obj.ClustertoIPFS[p]
+		if !ok {
+			fmt.Println("  > ipfs: unknown")
+			continue
+		}
+		fmt.Printf("  > ipfs: %s | swarm peers: %d\n", ipfs, len(obj.IPFSLinks[ipfs]))
+	}
+}
+
+func textFormatPrintPeerLiveness(obj *api.PeerLivenessSerial) {
+	if obj.Error != "" {
+		fmt.Printf("%s: unreachable | %s\n", obj.Peer, obj.Error)
+		return
+	}
+	alive := "alive"
+	if !obj.Alive {
+		alive = "no valid ping metric"
+	}
+	fmt.Printf("%s: %s | rtt: %s", obj.Peer, alive, obj.RTT)
+	if obj.LastMetric != "" {
+		fmt.Printf(" | last ping expires: %s", obj.LastMetric)
+	}
+	fmt.Println()
+}
+
+func textFormatPrintScalingAdvice(obj *api.ScalingAdviceSerial) {
+	fmt.Printf("%s | %s", obj.TS, obj.Action)
+	if obj.Peers > 0 {
+		fmt.Printf(": %d peers", obj.Peers)
+	}
+	fmt.Println()
+	for _, r := range obj.Reasons {
+		fmt.Printf("  > %s\n", r)
+	}
+	fmt.Println("  > Peers:")
+	for _, pp := range obj.Pressure {
+		fmt.Printf("    - %s | free: %d B (%.2f B/s) | queued: %d",
+			pp.Peer, pp.FreeSpace, pp.FreeSpaceRate, pp.Queued)
+		if pp.TimeToFull != "" {
+			fmt.Printf(" | full in %s", pp.TimeToFull)
+		}
+		if pp.UnderPressure {
+			fmt.Printf(" | UNDER PRESSURE")
+		}
+		fmt.Println()
+	}
+}
+
+func textFormatPrintAllocationSimulation(obj *api.AllocationSimulationSerial) {
+	for _, r := range obj.Records {
+		if r.Error != "" {
+			fmt.Printf("%s | ERROR: %s\n", r.Cid, r.Error)
+			continue
+		}
+		var sortAlloc sort.StringSlice = r.Allocations
+		sortAlloc.Sort()
+		fmt.Printf("%s | Allocations: %s\n", r.Cid, sortAlloc)
+	}
+	fmt.Printf("Failed: %d\n", obj.Failed)
+	fmt.Println("Peers:")
+	for _, pl := range obj.Load {
+		fmt.Printf("  - %s | current: %d | added: %d | projected: %d\n",
+			pl.Peer, pl.Current, pl.Added, pl.Current+pl.Added)
+	}
+}
+
+func textFormatPrintConsensusStatus(obj *api.ConsensusStatusSerial) {
+	if obj.Error != "" && obj.Term == 0 {
+		fmt.Printf("%s: ERROR: %s\n", obj.Peer, obj.Error)
+		return
+	}
+	fmt.Printf("%s: leader: %s", obj.Peer, obj.Leader)
+	if !obj.Voter {
+		fmt.Printf(" | NON-VOTER")
+	}
+	fmt.Println()
+	fmt.Printf("  > term: %d | commit index: %d | applied index: %d | lag: %d\n",
+		obj.Term, obj.CommitIndex, obj.AppliedIndex, obj.Lag)
+	snap := obj.LastSnapshot
+	if snap == "" {
+		snap = "never"
+	}
+	fmt.Printf("  > last snapshot: %s (index %d)\n", snap, obj.LastSnapshotIndex)
+	if obj.LastContact != "" {
+		fmt.Printf("  > last contact: %s\n", obj.LastContact)
+	}
+	if obj.Error != "" {
+		fmt.Printf("  > error: %s\n", obj.Error)
+	}
+}
+
+func textFormatPrintPeerRemoval(obj *api.PeerRemovalSerial) {
+	fmt.Printf("%s: %s | started: %s", obj.Peer, obj.Phase, obj.Start)
+	if obj.End != "" {
+		fmt.Printf(" | finished: %s", obj.End)
+	}
+	fmt.Println()
+	fmt.Printf("  > re-allocated: %d/%d | failed: %d\n", obj.Reallocated, obj.Total, obj.Failed)
+	if obj.Error != "" {
+		fmt.Printf("  > error: %s\n", obj.Error)
+	}
 }
 
 func textFormatPrintError(obj *api.Error) {
 	fmt.Printf("An error occurred:\n")
 	fmt.Printf("  Code: %d\n", obj.Code)
 	fmt.Printf("  Message: %s\n", obj.Message)
+	if len(obj.Details) > 0 {
+		fmt.Printf("  Details:\n")
+		keys := make(sort.StringSlice, 0, len(obj.Details))
+		for k := range obj.Details {
+			keys = append(keys, k)
+		}
+		keys.Sort()
+		for _, k := range keys {
+			fmt.Printf("    - %s: %s\n", k, obj.Details[k])
+		}
+	}
 }
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -11,6 +15,7 @@ import (
 	logging "github.com/ipfs/go-log"
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
+	multihash "github.com/multiformats/go-multihash"
 	cli "github.com/urfave/cli"
 
 	"github.com/ipfs/ipfs-cluster/api"
@@ -63,6 +68,23 @@ func out(m string, a ...interface{}) {
 	fmt.Fprintf(os.Stderr, m, a...)
 }
 
+// parseCidOrMultihash decodes a Cid. When the argument is a bare multihash
+// instead, the Cid is obtained from the cluster.
+func parseCidOrMultihash(arg string) (*cid.Cid, error) {
+	ci, err := cid.Decode(arg)
+	if err == nil {
+		return ci, nil
+	}
+	mh, mhErr := multihash.FromB58String(arg)
+	if mhErr != nil {
+		mh, mhErr = multihash.FromHexString(arg)
+	}
+	if mhErr != nil {
+		return nil, err
+	}
+	return globalClient.ResolveMultihash(mh)
+}
+
 func checkErr(doing string, err error) {
 	if err != nil {
 		out("error %s: %s\n", doing, err)
@@ -80,7 +102,9 @@ func main() {
 		cli.StringFlag{
 			Name:  "host, l",
 			Value: defaultHost,
-			Usage: "multiaddress of the IPFS Cluster service API",
+			Usage: `multiaddress of the IPFS Cluster service API. Use the libp2p
+address of a peer (i.e. /ip4/1.2.3.4/tcp/9096/ipfs/<peerID>) to talk to its API over
+libp2p, when enabled`,
 		},
 		cli.BoolFlag{
 			Name:  "https, s",
@@ -100,6 +124,14 @@ func main() {
 			Value: defaultTimeout,
 			Usage: "number of seconds to wait before timing out a request",
 		},
+		cli.IntFlag{
+			Name:  "retries",
+			Usage: "number of times to retry pin, unpin and add requests which fail because of network or server errors",
+		},
+		cli.StringFlag{
+			Name:  "api-version",
+			Usage: "version of the REST API to use (i.e. v1, or v0 for older peers). Negotiated with the peer by default",
+		},
 		cli.BoolFlag{
 			Name:  "debug, d",
 			Usage: "set debug log level",
@@ -110,9 +142,21 @@ func main() {
 requires authorization. implies --https, which you can disable with --force-http`,
 			EnvVar: "CLUSTER_CREDENTIALS",
 		},
+		cli.StringFlag{
+			Name: "token",
+			Usage: `<token> specify a Bearer token for a server that requires
+authorization. implies --https, which you can disable with --force-http`,
+			EnvVar: "CLUSTER_TOKEN",
+		},
+		cli.StringFlag{
+			Name: "secret",
+			Usage: `<secret> the cluster secret (hex-encoded), needed to reach the API
+over libp2p when the cluster runs on a private network`,
+			EnvVar: "CLUSTER_SECRET",
+		},
 		cli.BoolFlag{
 			Name:  "force-http, f",
-			Usage: "force HTTP. only valid when using BasicAuth",
+			Usage: "force HTTP. only valid when using BasicAuth or a token",
 		},
 	}
 
@@ -122,14 +166,22 @@ requires authorization. implies --https, which you can disable with --force-http
 		checkErr("parsing host multiaddress", err)
 		cfg.APIAddr = addr
 
+		if secret := c.String("secret"); secret != "" {
+			cfg.Secret, err = hex.DecodeString(secret)
+			checkErr("decoding cluster secret", err)
+		}
+
 		cfg.Timeout = time.Duration(c.Int("timeout")) * time.Second
+		cfg.Retries = c.Int("retries")
+		cfg.APIVersion = c.String("api-version")
 		cfg.SSL = c.Bool("https")
 		cfg.NoVerifyCert = c.Bool("no-check-certificate")
 		user, pass := parseCredentials(c.String("basic-auth"))
 		cfg.Username = user
 		cfg.Password = pass
-		if user != "" && !cfg.SSL && !c.Bool("force-http") {
-			logger.Warning("SSL automatically enabled with basic auth credentials. Set \"force-http\" to disable")
+		cfg.Token = c.String("token")
+		if (user != "" || cfg.Token != "") && !cfg.SSL && !c.Bool("force-http") {
+			logger.Warning("SSL automatically enabled with authentication credentials. Set \"force-http\" to disable")
 			cfg.SSL = true
 		}
 
@@ -164,6 +216,75 @@ This command displays information about the peer that the tool is contacting
 				return nil
 			},
 		},
+		{
+			Name:  "health",
+			Usage: "retrieve peer health",
+			Description: `
+This command displays the health state of the peer that the tool is
+contacting: "starting" while the peer waits for consensus to be ready,
+"waiting_for_ipfs" while its IPFS daemon cannot be reached (the peer keeps
+retrying) and "ok" otherwise.
+
+With --sync, it displays the periodic state and IPFS syncs of the peer
+instead: their interval and jitter (or whether they are disabled), the time of
+their last run and how many items were found out of sync.
+
+With --tracker, it displays the internals of the pin tracker of the peer: the
+operations waiting in each queue, the IPFS requests in progress, the items in
+error state, the automatic retries and the average time a pin takes.
+
+With --graph, it displays the connectivity graph of the cluster: the cluster
+peers that every peer is connected to, its IPFS daemon and the swarm peers of
+that daemon.
+
+With --peers, it displays the liveness of every cluster peer: whether its last
+ping metric is still valid and how long a request to it takes.
+`,
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "sync",
+					Usage: "display the status of the periodic syncs",
+				},
+				cli.BoolFlag{
+					Name:  "tracker",
+					Usage: "display the pin tracker metrics",
+				},
+				cli.BoolFlag{
+					Name:  "graph",
+					Usage: "display the connectivity graph of the cluster",
+				},
+				cli.BoolFlag{
+					Name:  "peers",
+					Usage: "display the liveness of every cluster peer",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Bool("sync") {
+					resp, cerr := globalClient.SyncStatus()
+					formatResponse(c, resp, cerr)
+					return nil
+				}
+				if c.Bool("tracker") {
+					resp, cerr := globalClient.TrackerMetrics()
+					formatResponse(c, resp, cerr)
+					return nil
+				}
+				if c.Bool("graph") {
+					resp, cerr := globalClient.ConnectGraph()
+					formatResponse(c, resp, cerr)
+					return nil
+				}
+				if c.Bool("peers") {
+					resp, cerr := globalClient.PeersLiveness()
+					formatResponse(c, resp, cerr)
+					return nil
+				}
+				resp, cerr := globalClient.Health()
+				formatResponse(c, resp, cerr)
+				return nil
+			},
+		},
 		{
 			Name:        "peers",
 			Description: "list and manage IPFS Cluster peers",
@@ -224,6 +345,135 @@ cluster peers.
 						return nil
 					},
 				},
+				{
+					Name:  "removal",
+					Usage: "show the progress of a peer removal",
+					Description: `
+This command shows the progress of the last removal of a peer started by the
+contacted cluster peer. When removing a peer which is down, it is first removed
+from the consensus configuration ("removing"), then the remaining peers wait
+for a quorum ("waiting_for_quorum") and finally the content allocated to the
+removed peer is re-allocated to others ("reallocating"), until the removal is
+"done" or fails with an "error".
+`,
+					ArgsUsage: "<peer ID>",
+					Flags:     []cli.Flag{},
+					Action: func(c *cli.Context) error {
+						pid := c.Args().First()
+						p, err := peer.IDB58Decode(pid)
+						checkErr("parsing peer ID", err)
+						resp, cerr := globalClient.PeerRemoval(p)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "maintenance",
+					Usage: "set or unset maintenance mode for a peer",
+					Description: `
+This command flags a peer as being in maintenance mode ("on") or clears that
+flag ("off"). Peers in maintenance mode do not receive new allocations, but
+keep their current ones and their content is not re-pinned elsewhere when
+they go down. The flag is stored in the shared cluster state.
+
+Without arguments, it lists the peers currently in maintenance mode.
+`,
+					ArgsUsage: "[<peer ID> on|off]",
+					Flags:     []cli.Flag{},
+					Action: func(c *cli.Context) error {
+						if c.NArg() == 0 {
+							resp, cerr := globalClient.MaintenancePeers()
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+
+						pid := c.Args().Get(0)
+						p, err := peer.IDB58Decode(pid)
+						checkErr("parsing peer ID", err)
+
+						var enabled bool
+						switch c.Args().Get(1) {
+						case "on":
+							enabled = true
+						case "off":
+							enabled = false
+						default:
+							return cli.NewExitError("Error: maintenance mode must be \"on\" or \"off\"", 1)
+						}
+						cerr := globalClient.PeerMaintenance(p, enabled)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "namespaces",
+			Usage: "List the namespaces in which CIDs can be pinned",
+			Description: `
+This command lists the namespaces configured in the cluster, along with their
+default replication factor, their quota (maximum number of pins, 0 means no
+limit) and the number of pins in them. The default namespace has no name.
+
+Use the --namespace option of "pin add", "pin rm" and "pin ls" to work with
+the pins in a namespace.
+`,
+			ArgsUsage: " ",
+			Action: func(c *cli.Context) error {
+				resp, cerr := globalClient.Namespaces()
+				formatResponse(c, resp, cerr)
+				return nil
+			},
+		},
+		{
+			Name:  "add",
+			Usage: "Add content to IPFS and pin it in the cluster",
+			Description: `
+This command adds the given files and directories (recursively) to the IPFS
+daemon of the contacted peer, like "ipfs add", and pins the resulting roots in
+the cluster with the given replication factor and name (their file names by
+default). With --wrap-with-directory, the files are wrapped in a directory and
+only that directory is pinned. --chunker and --raw-leaves work like in "ipfs
+add". The command prints every added item.
+`,
+			ArgsUsage: "<path> [path...]",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "replication, r",
+					Value: 0,
+					Usage: "Sets a custom replication factor for the added content",
+				},
+				cli.StringFlag{
+					Name:  "name, n",
+					Value: "",
+					Usage: "Sets a name for the pins",
+				},
+				cli.StringFlag{
+					Name:  "chunker, s",
+					Usage: "chunking algorithm, i.e. size-262144 or rabin",
+				},
+				cli.BoolFlag{
+					Name:  "raw-leaves",
+					Usage: "use raw blocks for the leaf nodes",
+				},
+				cli.BoolFlag{
+					Name:  "wrap-with-directory, w",
+					Usage: "wrap the files in a directory",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				paths := c.Args()
+				if len(paths) == 0 {
+					return cli.NewExitError("Error: at least a path is needed", 1)
+				}
+				params := api.AddParams{
+					Chunker:           c.String("chunker"),
+					RawLeaves:         c.Bool("raw-leaves"),
+					WrapWithDirectory: c.Bool("wrap-with-directory"),
+				}
+				resp, cerr := globalClient.Add(paths, params, c.Int("replication"), c.String("name"))
+				formatResponse(c, resp, cerr)
+				return nil
 			},
 		},
 		{
@@ -244,8 +494,31 @@ in the cluster and should be part of the list offered by "pin ls".
 An optional replication factor can be provided: -1 means "pin everywhere"
 and 0 means use cluster's default setting. Positive values indicate how many
 peers should pin this content.
+
+With --inline, the block for the CID is fetched from the IPFS daemon of the
+contacted peer and stored in the cluster state along with the pin, so that any
+peer can provide it to IPFS. This only works for single-block content smaller
+than the cluster's inline_max_size.
+
+A bare multihash (base58 or hex) can be given instead of a CID, i.e. when
+only digests from a legacy system are known. The contacted peer then looks
+for the content in its IPFS daemon as dag-pb and as raw, and uses dag-pb
+when it cannot find it.
+
+With --namespace, the CID is added to the given namespace (see "namespaces"),
+and a replication factor of 0 means the namespace's default setting.
+
+An IPFS or IPNS path (i.e. /ipns/example.com/data or /ipfs/<CID>/subdir) can
+be given too. The contacted peer resolves it with its IPFS daemon and pins the
+resulting CID, recording the path in the pin. It cannot be used with --inline
+or --namespace.
+
+With --wait, the command only returns once the CID is pinned in as many peers
+as it is allocated to (or in every peer when pinned everywhere), or fails when
+any of them cannot pin it or when --wait-timeout expires. It cannot be used
+with --inline, --namespace or paths.
 `,
-					ArgsUsage: "<CID>",
+					ArgsUsage: "<CID|multihash|path>",
 					Flags: []cli.Flag{
 						cli.IntFlag{
 							Name:  "replication, r",
@@ -257,12 +530,65 @@ peers should pin this content.
 							Value: "",
 							Usage: "Sets a name for this pin",
 						},
+						cli.BoolFlag{
+							Name:  "inline",
+							Usage: "Store the content inline in the cluster state",
+						},
+						cli.StringFlag{
+							Name:  "namespace",
+							Value: "",
+							Usage: "Adds the pin to this namespace",
+						},
+						cli.BoolFlag{
+							Name:  "wait",
+							Usage: "Wait until the CID is pinned",
+						},
+						cli.DurationFlag{
+							Name:  "wait-timeout",
+							Usage: "How long to wait with --wait. 0 means the API's default",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						cidStr := c.Args().First()
-						ci, err := cid.Decode(cidStr)
+						if c.Bool("wait") {
+							if isIPFSPath(cidStr) || c.Bool("inline") || c.String("namespace") != "" {
+								checkErr("", errors.New("--wait cannot be used with --inline, --namespace or paths"))
+							}
+							ci, err := parseCidOrMultihash(cidStr)
+							checkErr("parsing cid", err)
+							resp, cerr := globalClient.PinWait(ci, c.Int("replication"), c.String("name"), c.Duration("wait-timeout"))
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+						if isIPFSPath(cidStr) {
+							if c.Bool("inline") || c.String("namespace") != "" {
+								checkErr("", errors.New("paths cannot be used with --inline or --namespace"))
+							}
+							pin, cerr := globalClient.PinPath(cidStr, c.Int("replication"), c.String("name"))
+							if cerr != nil {
+								formatResponse(c, nil, cerr)
+								return nil
+							}
+							time.Sleep(1000 * time.Millisecond)
+							resp, cerr := globalClient.Status(pin.Cid, false)
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+						ci, err := parseCidOrMultihash(cidStr)
 						checkErr("parsing cid", err)
-						cerr := globalClient.Pin(ci, c.Int("replication"), c.String("name"))
+						pinF := globalClient.Pin
+						if c.Bool("inline") {
+							pinF = globalClient.PinInline
+						}
+						if ns := c.String("namespace"); ns != "" {
+							if c.Bool("inline") {
+								checkErr("", errors.New("--inline cannot be used with --namespace"))
+							}
+							pinF = func(ci *cid.Cid, rpl int, name string) error {
+								return globalClient.NamespacePin(ns, ci, rpl, name)
+							}
+						}
+						cerr := pinF(ci, c.Int("replication"), c.String("name"))
 						if cerr != nil {
 							formatResponse(c, nil, cerr)
 							return nil
@@ -273,6 +599,101 @@ peers should pin this content.
 						return nil
 					},
 				},
+				{
+					Name:  "batch",
+					Usage: "Track many CIDs at once",
+					Description: `
+This command works like "pin add" for several CIDs at once. They are
+committed to the cluster's state in a few consensus operations instead of
+one per CID, which is much faster when importing a large number of pins.
+
+The CIDs are given as arguments or, when there are none, read from the
+standard input, one per line. The replication factor and name apply to all
+of them. If any of the CIDs cannot be allocated, none is pinned.
+`,
+					ArgsUsage: "[<CID>...]",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "replication, r",
+							Value: 0,
+							Usage: "Sets a custom replication factor for these pins",
+						},
+						cli.StringFlag{
+							Name:  "name, n",
+							Value: "",
+							Usage: "Sets a name for these pins",
+						},
+						cli.StringFlag{
+							Name:  "namespace",
+							Value: "",
+							Usage: "Adds the pins to this namespace",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						cidStrs := []string(c.Args())
+						if len(cidStrs) == 0 {
+							scanner := bufio.NewScanner(os.Stdin)
+							for scanner.Scan() {
+								line := strings.TrimSpace(scanner.Text())
+								if line != "" {
+									cidStrs = append(cidStrs, line)
+								}
+							}
+							checkErr("reading standard input", scanner.Err())
+						}
+
+						pins := make([]api.Pin, 0, len(cidStrs))
+						for _, cidStr := range cidStrs {
+							ci, err := cid.Decode(cidStr)
+							checkErr("parsing cid "+cidStr, err)
+							pin := api.PinCid(ci)
+							pin.ReplicationFactor = c.Int("replication")
+							pin.Name = c.String("name")
+							pin.Namespace = c.String("namespace")
+							pins = append(pins, pin)
+						}
+						cerr := globalClient.PinBatch(pins)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "import",
+					Usage: "Pin and unpin many CIDs, reporting each outcome",
+					Description: `
+This command reads a list of pins and unpins from a file (or from the
+standard input when no file is given) and sends them to the cluster in a
+single request. The list is a JSON array or a stream of JSON objects, one
+per line, with the same fields as the pins in "--enc=json pin ls" output.
+Objects with "unpin": true are unpinned.
+
+Pins are committed to the cluster's state in a few consensus operations.
+Unlike "pin batch", the items which fail do not prevent the rest from
+being committed: the outcome of every item is displayed.
+`,
+					ArgsUsage: "[<file>]",
+					Action: func(c *cli.Context) error {
+						in := os.Stdin
+						if path := c.Args().First(); path != "" {
+							f, err := os.Open(path)
+							checkErr("opening "+path, err)
+							defer f.Close()
+							in = f
+						}
+
+						serials, err := readBatchItems(in)
+						checkErr("reading items", err)
+						items := make([]api.BatchItem, 0, len(serials))
+						for _, item := range serials {
+							_, err := cid.Decode(item.Cid)
+							checkErr("parsing cid "+item.Cid, err)
+							items = append(items, item.ToBatchItem())
+						}
+						resp, cerr := globalClient.Batch(items)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
 				{
 					Name:  "rm",
 					Usage: "Stop tracking a CID (unpin)",
@@ -283,6 +704,67 @@ trigger unpinning operations in all the IPFS nodes holding the content.
 When the request has succeeded, the command returns the status of the CID
 in the cluster. The CID should disappear from the list offered by "pin ls",
 although unpinning operations in the cluster may take longer or fail.
+
+With --namespace, the command fails unless the CID is pinned in the given
+namespace.
+
+An IPFS or IPNS path can be given instead of a CID. The CID it currently
+resolves to is unpinned, which may not be the one pinned with that path
+when an IPNS name has been updated since.
+`,
+					ArgsUsage: "<CID|path>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "namespace",
+							Value: "",
+							Usage: "Only unpin from this namespace",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						cidStr := c.Args().First()
+						if isIPFSPath(cidStr) {
+							if c.String("namespace") != "" {
+								checkErr("", errors.New("paths cannot be used with --namespace"))
+							}
+							pin, cerr := globalClient.UnpinPath(cidStr)
+							if cerr != nil {
+								formatResponse(c, nil, cerr)
+								return nil
+							}
+							time.Sleep(1000 * time.Millisecond)
+							resp, cerr := globalClient.Status(pin.Cid, false)
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+						ci, err := cid.Decode(cidStr)
+						checkErr("parsing cid", err)
+						var cerr error
+						if ns := c.String("namespace"); ns != "" {
+							cerr = globalClient.NamespaceUnpin(ns, ci)
+						} else {
+							cerr = globalClient.Unpin(ci)
+						}
+						if cerr != nil {
+							formatResponse(c, nil, cerr)
+							return nil
+						}
+						time.Sleep(1000 * time.Millisecond)
+						resp, cerr := globalClient.Status(ci, false)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "cancel",
+					Usage: "Stop an ongoing pin",
+					Description: `
+This command stops the pinning of a CID which is still in progress, i.e. when
+the wrong CID was pinned and its content is very large. The CID is removed
+from IPFS Cluster, like with "pin rm", so the IPFS requests fetching it are
+aborted in every peer and whatever was fetched is unpinned.
+
+The command fails when no peer is pinning the CID. Use "pin rm" to unpin
+content which has been pinned already.
 `,
 					ArgsUsage: "<CID>",
 					Flags:     []cli.Flag{},
@@ -290,7 +772,7 @@ although unpinning operations in the cluster may take longer or fail.
 						cidStr := c.Args().First()
 						ci, err := cid.Decode(cidStr)
 						checkErr("parsing cid", err)
-						cerr := globalClient.Unpin(ci)
+						cerr := globalClient.CancelPin(ci)
 						if cerr != nil {
 							formatResponse(c, nil, cerr)
 							return nil
@@ -310,16 +792,35 @@ which peers they are currently allocated. This list does not include
 any monitoring information about the IPFS status of the CIDs, it
 merely represents the list of pins which are part of the shared state of
 the cluster. For IPFS-status information about the pins, use "status".
+
+With --namespace, only the CIDs in the given namespace are listed.
+
+--limit, --offset, --cursor and --sort ("cid" or "name") select a page of the
+list. The last CID of a page is the --cursor for the next one.
 `,
 					ArgsUsage: "[CID]",
-					Flags:     []cli.Flag{},
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:  "namespace",
+							Value: "",
+							Usage: "Only list the pins in this namespace",
+						},
+					}, pageFlags()...),
 					Action: func(c *cli.Context) error {
 						cidStr := c.Args().First()
+						if c.IsSet("namespace") && cidStr == "" {
+							resp, cerr := globalClient.NamespacePins(c.String("namespace"))
+							formatResponse(c, resp, cerr)
+							return nil
+						}
 						if cidStr != "" {
 							ci, err := cid.Decode(cidStr)
 							checkErr("parsing cid", err)
 							resp, cerr := globalClient.Allocation(ci)
 							formatResponse(c, resp, cerr)
+						} else if opts, ok := parsePageFlags(c); ok {
+							resp, cerr := globalClient.AllocationsPage(opts)
+							formatResponse(c, resp, cerr)
 						} else {
 							resp, cerr := globalClient.Allocations()
 							formatResponse(c, resp, cerr)
@@ -327,6 +828,291 @@ the cluster. For IPFS-status information about the pins, use "status".
 						return nil
 					},
 				},
+				{
+					Name:  "log",
+					Usage: "List the latest pin and unpin operations",
+					Description: `
+This command lists the pin and unpin operations applied to the shared state
+by the contacted peer after the given sequence number (--since), from oldest to
+newest. Sequence numbers come from the consensus (e.g. the Raft log index) and
+are kept when the peer restarts. Tools which need to follow the changes to the pinset can list it once
+and then poll this command with the last sequence number they have seen. When
+the peer no longer remembers the requested operations, an error is returned
+and the pinset should be listed again.
+`,
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						cli.Uint64Flag{
+							Name:  "since",
+							Usage: "only list operations after this sequence number",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.PinLog(c.Uint64("since"))
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "local",
+					Usage: "List the items pinned by the IPFS daemon",
+					Description: `
+This command lists the items pinned (recursively or directly) by the IPFS
+daemon of the contacted cluster peer, and shows whether each of them is
+tracked by IPFS Cluster and whether the peer is allocated to pin it. Items
+pinned by IPFS but not tracked by IPFS Cluster are flagged as UNTRACKED, and
+items which are tracked but not allocated to the peer as NOT ALLOCATED.
+`,
+					ArgsUsage: " ",
+					Flags:     []cli.Flag{},
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.IPFSLocalPins()
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "duplicates",
+					Usage: "List pins for the same content under different CIDs",
+					Description: `
+This command lists the groups of tracked CIDs which reference the same
+content, like the CIDv0 and the CIDv1 of an item. Each of them is allocated
+separately, so the content is replicated more than intended.
+
+With --merge, every group is merged into a single pin, which keeps the rest of
+CIDs as aliases, and the rest of pins are removed. The pin with the largest
+replication factor is the one kept. Unpinning an alias later only removes it
+from the pin.
+`,
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "merge",
+							Usage: "merge the duplicates into a single pin",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var resp []api.DuplicatePins
+						var cerr error
+						if c.Bool("merge") {
+							resp, cerr = globalClient.MergeDuplicatePins()
+						} else {
+							resp, cerr = globalClient.DuplicatePins()
+						}
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "stats",
+					Usage: "Show aggregated figures about the tracked CIDs",
+					Description: `
+This command walks the shared state and shows the number of tracked CIDs by
+replication factor and by name prefix, along with the number of replicas
+allocated to every peer. It is useful for capacity reviews without exporting
+the whole list of pins.
+
+The name prefix of a pin is the part of its name before the first --delimiter,
+or the whole name when it does not contain it. Pins with replication factor -1
+are allocated everywhere, so they are not counted in the replicas of any peer.
+`,
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "delimiter",
+							Value: "/",
+							Usage: "separator of the name prefix",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.StateStats(c.String("delimiter"))
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "copy",
+					Usage: "Copy pins to a different cluster",
+					Description: `
+This command copies the given CIDs, with all their options (name, replication
+factor, shards, inline data...), to the cluster whose API listens on
+--dest-host (i.e. to promote content from a staging cluster to a production
+one). Allocations are not copied: the destination cluster decides them.
+
+The pins keep their namespace unless --dest-namespace is given. The global
+--timeout, --https and --no-check-certificate flags apply to both clusters.
+The output shows whether each CID was copied, or the error which prevented
+it.
+`,
+					ArgsUsage: "<CID> [<CID>...]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "dest-host",
+							Usage: "multiaddress of the destination cluster API",
+						},
+						cli.StringFlag{
+							Name:  "dest-basic-auth",
+							Usage: "<username>[:<password>] BasicAuth credentials for the destination cluster",
+						},
+						cli.StringFlag{
+							Name:  "dest-namespace",
+							Usage: "namespace of the destination cluster to copy the pins to",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if !c.Args().Present() {
+							return cli.NewExitError("Error: at least one CID is needed", 1)
+						}
+						var cids []*cid.Cid
+						for _, arg := range c.Args() {
+							ci, err := cid.Decode(arg)
+							checkErr("parsing cid", err)
+							cids = append(cids, ci)
+						}
+
+						if c.String("dest-host") == "" {
+							return cli.NewExitError("Error: --dest-host is needed", 1)
+						}
+						addr, err := ma.NewMultiaddr(c.String("dest-host"))
+						checkErr("parsing destination host multiaddress", err)
+						user, pass := parseCredentials(c.String("dest-basic-auth"))
+						dstCfg := &client.Config{
+							APIAddr:      addr,
+							Timeout:      time.Duration(c.GlobalInt("timeout")) * time.Second,
+							SSL:          c.GlobalBool("https"),
+							NoVerifyCert: c.GlobalBool("no-check-certificate"),
+							Username:     user,
+							Password:     pass,
+						}
+						dst, err := client.NewClient(dstCfg)
+						checkErr("creating destination API client", err)
+
+						resp, cerr := globalClient.CopyPins(dst, cids, c.String("dest-namespace"))
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "simulate",
+					Usage: "Simulate the allocation of several CIDs",
+					Description: `
+This command runs the allocation process for the given CIDs against the current
+metrics, without pinning anything, and shows the peers which would be allocated
+to each CID along with the number of pins that each peer has now and the number
+of pins that would be added to it. It helps planning bulk imports.
+
+After every CID, the metrics of the peers allocated to it are updated as if
+they had pinned it (pin counts grow, and free space shrinks by the size of the
+CID when it is known), so the CIDs are spread as they would be in a real
+import.
+`,
+					ArgsUsage: "<CID> [<CID>...]",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "replication, r",
+							Value: 0,
+							Usage: "Sets a custom replication factor for the pins",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if !c.Args().Present() {
+							return cli.NewExitError("Error: at least one CID is needed", 1)
+						}
+						var pins []api.Pin
+						for _, arg := range c.Args() {
+							ci, err := cid.Decode(arg)
+							checkErr("parsing cid", err)
+							pin := api.PinCid(ci)
+							pin.ReplicationFactor = c.Int("replication")
+							pins = append(pins, pin)
+						}
+						resp, cerr := globalClient.SimulateAllocations(pins)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "history",
+					Usage: "Show the allocation decisions for a CID",
+					Description: `
+This command lists the allocation decisions made for a CID: the peers which
+were chosen, the metrics used to choose them and the reason for the decision.
+Each peer remembers a limited number of recent decisions.
+
+When the --local flag is passed, only the decisions made by the contacted
+peer are shown. By default, all peers are queried.
+`,
+					ArgsUsage: "<CID>",
+					Flags: []cli.Flag{
+						localFlag(),
+					},
+					Action: func(c *cli.Context) error {
+						cidStr := c.Args().First()
+						ci, err := cid.Decode(cidStr)
+						checkErr("parsing cid", err)
+						resp, cerr := globalClient.AllocationHistory(ci, c.Bool("local"))
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "decisions",
+					Usage: "Show the recent allocation decisions for all CIDs",
+					Description: `
+This command lists the allocation decisions remembered by the cluster peers
+for every CID, sorted by time. Along with the chosen peers and the metrics
+used, each decision shows how many peers were considered and why some of
+them were excluded (blacklisted, in maintenance or discarded by a
+filter).
+
+When the --local flag is passed, only the decisions made by the contacted
+peer are shown. By default, all peers are queried.
+`,
+					Flags: []cli.Flag{
+						localFlag(),
+					},
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.AllocationDecisions(c.Bool("local"))
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "events",
+			Usage: "Follow the events of the contacted peer",
+			Description: `
+This command prints the events which happen in the contacted peer as they
+are received: pin status changes ("pin_status"), peers joining and leaving the
+cluster ("peer_joined" and "peer_left") and alerts raised by the peer monitor
+("alert"). It starts with the events that the peer remembers, or with those
+after the given sequence number (--since), and keeps following them until it is
+interrupted. Events may be missed when they happen faster than they are read.
+`,
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.Uint64Flag{
+					Name:  "since",
+					Usage: "only print events after this sequence number",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				since := c.Uint64("since")
+				for {
+					evs := make(chan api.Event, 1024)
+					errCh := make(chan error, 1)
+					go func() {
+						errCh <- globalClient.Events(since, evs)
+					}()
+					for ev := range evs {
+						since = ev.Seq
+						formatResponse(c, ev, nil)
+					}
+					// the server ends the stream from time to
+					// time. Resume it unless it failed.
+					formatResponse(c, nil, <-errCh)
+				}
 			},
 		},
 		{
@@ -343,21 +1129,51 @@ with "sync".
 
 When the --local flag is passed, it will only fetch the status from the
 contacted cluster peer. By default, status will be fetched from all peers.
+
+The --filter flag limits the output to the items with the given statuses
+(i.e. "pin_error,unpin_error"). Peers only send the matching items.
+
+--limit, --offset, --cursor and --sort ("cid", "name" or "ts", most recently
+updated first) select a page of the items. The last CID of a page is the
+--cursor for the next one.
+
+The --summary flag only shows the number of items, the number of them in every
+status and, for every peer, how many are pinned, pinning or in error. It
+honors --local and --filter.
 `,
 			ArgsUsage: "[CID]",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				localFlag(),
-			},
+				filterFlag(),
+				cli.BoolFlag{
+					Name:  "summary",
+					Usage: "only count the items by status and by peer",
+				},
+			}, pageFlags()...),
 			Action: func(c *cli.Context) error {
 				cidStr := c.Args().First()
-				if cidStr != "" {
+				if c.Bool("summary") {
+					if cidStr != "" {
+						checkErr("", errors.New("--summary cannot be used with a CID"))
+					}
+					resp, cerr := globalClient.PinSummary(parseFilter(c), c.Bool("local"))
+					formatResponse(c, resp, cerr)
+				} else if cidStr != "" {
 					ci, err := cid.Decode(cidStr)
 					checkErr("parsing cid", err)
 					resp, cerr := globalClient.Status(ci, c.Bool("local"))
 					formatResponse(c, resp, cerr)
-				} else {
-					resp, cerr := globalClient.StatusAll(c.Bool("local"))
+				} else if opts, ok := parsePageFlags(c); ok {
+					resp, cerr := globalClient.StatusAllPage(parseFilter(c), c.Bool("local"), opts)
 					formatResponse(c, resp, cerr)
+				} else {
+					items := make(chan api.GlobalPinInfo, 1024)
+					errCh := make(chan error, 1)
+					go func() {
+						errCh <- globalClient.StatusAllStream(parseFilter(c), c.Bool("local"), items)
+					}()
+					formatStream(c, items)
+					formatResponse(c, nil, <-errCh)
 				}
 				return nil
 			},
@@ -410,11 +1226,17 @@ of the item upon completion. Note that, when running on the full sets of tracked
 CIDs (without argument), it may take a considerably long time.
 
 When the --local flag is passed, it will only trigger recover
-operations on the contacted peer (as opposed to on every peer).
+operations on the contacted peer (as opposed to on every peer). Without CID,
+every peer recovers its items in "pin_error" or "unpin_error" state, and the
+command lists them along with their status on each peer after recovery.
+
+The --filter flag limits the recover operations to the items with the given
+statuses (i.e. "unpin_error").
 `,
 			ArgsUsage: "[CID]",
 			Flags: []cli.Flag{
 				localFlag(),
+				filterFlag(),
 			},
 			Action: func(c *cli.Context) error {
 				cidStr := c.Args().First()
@@ -424,12 +1246,237 @@ operations on the contacted peer (as opposed to on every peer).
 					resp, cerr := globalClient.Recover(ci, c.Bool("local"))
 					formatResponse(c, resp, cerr)
 				} else {
-					resp, cerr := globalClient.RecoverAll(c.Bool("local"))
+					resp, cerr := globalClient.RecoverAll(parseFilter(c), c.Bool("local"))
 					formatResponse(c, resp, cerr)
 				}
 				return nil
 			},
 		},
+		{
+			Name:        "log",
+			Description: "manage the logging of cluster peers",
+			Subcommands: []cli.Command{
+				{
+					Name:  "level",
+					Usage: "set the log level for a component at runtime",
+					Description: `
+This command sets the logging level for a component (logging facility)
+of the contacted cluster peer, without restarting it. Use "*" as component
+to set the level for all of them. Valid levels are critical, error, warning,
+notice, info and debug.
+
+When the --all-peers flag is passed, the change is applied in all the
+cluster peers.
+`,
+					ArgsUsage: "<component> <level>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all-peers",
+							Usage: "apply the change to all cluster peers",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 2 {
+							return cli.NewExitError("Error: component and level arguments are needed", 1)
+						}
+						cerr := globalClient.SetLogLevel(c.Args().Get(0), c.Args().Get(1), c.Bool("all-peers"))
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "consensus",
+			Description: "manage the consensus component of cluster peers",
+			Subcommands: []cli.Command{
+				{
+					Name:  "snapshot",
+					Usage: "take a snapshot of the shared state",
+					Description: `
+This command asks the contacted cluster peer to persist the current shared
+state and compact its consensus log right away, instead of waiting for the
+configured snapshot_interval or snapshot_threshold. Raft peers keep only the
+last "max_snapshots" snapshots in their data folder.
+`,
+					Action: func(c *cli.Context) error {
+						cerr := globalClient.Snapshot()
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "status",
+					Usage: "show the internals of the consensus in every peer",
+					Description: `
+This command displays, for every cluster peer, the consensus leader it
+knows, the Raft term, the commit and applied indexes, the last snapshot and
+when it last heard from the leader. The lag is the number of log entries
+that a peer has not applied yet with respect to the most advanced peer
+(usually the leader). A growing lag, or an applied index stuck behind the
+commit index, usually anticipates failing pins.
+
+With --local, only the contacted peer is displayed.
+`,
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						localFlag(),
+					},
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.ConsensusStatus(c.Bool("local"))
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "allocation",
+			Description: "manage how cluster peers are allocated content",
+			Subcommands: []cli.Command{
+				{
+					Name:  "strategy",
+					Usage: "set the allocation strategy at runtime",
+					Description: `
+This command sets the allocation strategy (the informer and the allocator)
+of the contacted cluster peer, without restarting it. The strategies are
+the same accepted by the --alloc flag of ipfs-cluster-service.
+
+Allocations use the metrics sent by every peer, so all peers should use
+the same strategy: pass the --all-peers flag to apply the change in all
+the cluster peers. The strategy is not saved, peers use the one given
+by --alloc when they restart.
+`,
+					ArgsUsage: "<strategy>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all-peers",
+							Usage: "apply the change to all cluster peers",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return cli.NewExitError("Error: a strategy argument is needed", 1)
+						}
+						cerr := globalClient.SetAllocationStrategy(c.Args().First(), c.Bool("all-peers"))
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "config",
+			Description: "tune the configuration of cluster peers at runtime",
+			Subcommands: []cli.Command{
+				{
+					Name:  "set",
+					Usage: "change a configuration option without restarting",
+					Description: `
+This command changes a configuration option of the contacted cluster peer
+without restarting it. The change applies immediately and is saved to the
+peer's configuration file. The value is given as JSON (i.e. 4, 0.2, false).
+
+Only the following options can be changed at runtime:
+
+  - cluster.pinning_enabled: enables or disables the informer, and with it,
+    new allocations to the peer.
+  - cluster.reallocation_threshold
+  - cluster.allocation_filters.min_free_space
+  - cluster.disabled_informers: a list with the names of the informers
+    (i.e. ["tags"]) whose metrics the peer stops sending.
+  - maptracker.concurrent_pins or stateless.concurrent_pins, depending on
+    the tracker used by the peer.
+
+Pass the --all-peers flag to apply the change in all the cluster peers.
+`,
+					ArgsUsage: "<option> <json-value>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all-peers",
+							Usage: "apply the change to all cluster peers",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 2 {
+							return cli.NewExitError("Error: option and value arguments are needed", 1)
+						}
+						value := []byte(c.Args().Get(1))
+						if !json.Valid(value) {
+							checkErr("parsing value", errors.New("the value must be valid JSON"))
+						}
+						rc := api.RuntimeConfig{
+							c.Args().Get(0): json.RawMessage(value),
+						}
+						cerr := globalClient.SetRuntimeConfig(rc, c.Bool("all-peers"))
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "rpc",
+			Description: "debug cluster peers by performing raw RPC calls",
+			Subcommands: []cli.Command{
+				{
+					Name:  "call",
+					Usage: "call any RPC method on a cluster peer",
+					Description: `
+This command asks the contacted cluster peer to perform an RPC call to the
+given method on the given peer and prints the JSON response. Arguments are
+provided as JSON and must match the type expected by the method. Use "" as
+peer ID to run the call on the contacted peer.
+
+This is a debugging tool. It is only available when "enable_rpc_call" is set
+in the "restapi" configuration of the contacted peer, which requires
+basic authentication.
+`,
+					ArgsUsage: "<peer ID> <component> <method> [<json-args>]",
+					Flags:     []cli.Flag{},
+					Action: func(c *cli.Context) error {
+						if c.NArg() < 3 {
+							return cli.NewExitError("Error: peer ID, component and method arguments are needed", 1)
+						}
+						var p peer.ID
+						if pid := c.Args().Get(0); pid != "" {
+							var err error
+							p, err = peer.IDB58Decode(pid)
+							checkErr("parsing peer ID", err)
+						}
+						var args []byte
+						if jsonArgs := c.Args().Get(3); jsonArgs != "" {
+							args = []byte(jsonArgs)
+						}
+						resp, cerr := globalClient.RPCCall(p, c.Args().Get(1), c.Args().Get(2), args)
+						formatResponse(c, json.RawMessage(resp), cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "scaling",
+			Usage: "Get a recommendation to add or remove peers",
+			Description: `
+This command analyzes the capacity pressure on the cluster peers and
+recommends adding peers ("add_peers") or removing them ("remove_peers").
+
+A peer is under pressure when it has many pins queued or when, following the
+trend of its "freespace" metric, it will run out of space soon. The free space
+trend is only available when peers use the disk informer with the freespace
+metric. Peers can be removed when no peer is under pressure and all of them
+are idle (nothing queued and free space not shrinking), as long as enough
+peers remain for the replication factor.
+`,
+			ArgsUsage: " ",
+			Flags:     []cli.Flag{},
+			Action: func(c *cli.Context) error {
+				resp, cerr := globalClient.ScalingAdvice()
+				formatResponse(c, resp, cerr)
+				return nil
+			},
+		},
 		{
 			Name:  "version",
 			Usage: "Retrieve cluster version",
@@ -475,6 +1522,57 @@ func localFlag() cli.BoolFlag {
 	}
 }
 
+func filterFlag() cli.StringFlag {
+	return cli.StringFlag{
+		Name:  "filter",
+		Usage: "comma-separated list of statuses to select items",
+	}
+}
+
+func parseFilter(c *cli.Context) api.StatusFilter {
+	filter, err := api.StatusFilterFromString(c.String("filter"))
+	checkErr("parsing filter", err)
+	return filter
+}
+
+func pageFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:  "limit",
+			Usage: "maximum number of items to list",
+		},
+		cli.IntFlag{
+			Name:  "offset",
+			Usage: "number of items to skip",
+		},
+		cli.StringFlag{
+			Name:  "cursor",
+			Usage: "only list the items after this CID (sorted by CID)",
+		},
+		cli.StringFlag{
+			Name:  "sort",
+			Usage: "sort order for the items",
+		},
+	}
+}
+
+// parsePageFlags returns the ListOptions given with pageFlags. It returns
+// false when none was set.
+func parsePageFlags(c *cli.Context) (client.ListOptions, bool) {
+	opts := client.ListOptions{
+		Limit:  c.Int("limit"),
+		Offset: c.Int("offset"),
+		Sort:   c.String("sort"),
+	}
+	if cursor := c.String("cursor"); cursor != "" {
+		ci, err := cid.Decode(cursor)
+		checkErr("parsing cursor", err)
+		opts.Cursor = ci
+	}
+	set := opts.Limit != 0 || opts.Offset != 0 || opts.Sort != "" || opts.Cursor != nil
+	return opts, set
+}
+
 func walkCommands(cmds []cli.Command, parentHelpName string) {
 	for _, c := range cmds {
 		h := c.HelpName
@@ -523,6 +1621,30 @@ func formatResponse(c *cli.Context, resp interface{}, err error) {
 	}
 }
 
+// formatStream prints items as they are received. With the json encoding,
+// they form a JSON array.
+func formatStream(c *cli.Context, items <-chan api.GlobalPinInfo) {
+	enc := c.GlobalString("encoding")
+	switch enc {
+	case "text":
+		for item := range items {
+			textFormatObject(item)
+		}
+	case "json":
+		fmt.Print("[")
+		sep := "\n"
+		for item := range items {
+			j, err := json.MarshalIndent(item.ToSerial(), "    ", "    ")
+			checkErr("generating json output", err)
+			fmt.Printf("%s    %s", sep, j)
+			sep = ",\n"
+		}
+		fmt.Println("\n]")
+	default:
+		checkErr("", errors.New("unsupported encoding selected"))
+	}
+}
+
 func parseCredentials(userInput string) (string, string) {
 	credentials := strings.SplitN(userInput, ":", 2)
 	switch len(credentials) {
@@ -537,3 +1659,46 @@ func parseCredentials(userInput string) (string, string) {
 		return "", ""
 	}
 }
+
+// readBatchItems reads the items given to "pin import", either as a JSON
+// array or as a stream of JSON objects.
+func readBatchItems(r io.Reader) ([]api.BatchItemSerial, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			break
+		}
+		br.ReadByte()
+	}
+
+	var items []api.BatchItemSerial
+	dec := json.NewDecoder(br)
+	if b, _ := br.Peek(1); b[0] == '[' {
+		err := dec.Decode(&items)
+		return items, err
+	}
+	for {
+		var item api.BatchItemSerial
+		err := dec.Decode(&item)
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+// isIPFSPath returns true for IPFS and IPNS paths, which are given to the
+// cluster to be resolved.
+func isIPFSPath(s string) bool {
+	return strings.HasPrefix(s, "/ipfs/") || strings.HasPrefix(s, "/ipns/")
+}
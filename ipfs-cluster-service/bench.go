@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ma "github.com/multiformats/go-multiaddr"
+	multihash "github.com/multiformats/go-multihash"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
+)
+
+// benchOptions controls the synthetic load generated by bench.
+type benchOptions struct {
+	Pins              int
+	Size              int
+	BlockSize         int
+	Concurrency       int
+	ReplicationFactor int
+	Timeout           time.Duration
+	Keep              bool
+	Username          string
+	Password          string
+}
+
+// benchResult holds the measurements taken by bench.
+type benchResult struct {
+	Peers     int
+	Blocks    int
+	Added     time.Duration
+	Committed time.Duration
+	Pinned    time.Duration
+	Failed    int
+	TimedOut  int
+	PinLat    []time.Duration
+	StatusLat []time.Duration
+	StatusAll time.Duration
+	Total     int
+}
+
+// bench generates synthetic pins on the running cluster peer using this
+// peer's configuration: random DAGs are added to the IPFS daemon through
+// the connector and pinned through the REST API. It measures how fast
+// pins are committed to the shared state, how long they take to be pinned
+// by the allocated peers and how long status requests take, and writes a
+// sizing report to w.
+func bench(w io.Writer, opts benchOptions) error {
+	if opts.Pins <= 0 || opts.Size <= 0 || opts.BlockSize <= 0 || opts.Concurrency <= 0 {
+		return errors.New("pins, size, block size and concurrency must be larger than 0")
+	}
+
+	cfg, cfgs := makeConfigs()
+	err := cfg.LoadJSONFromFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	// The running peer already listens on the proxy address.
+	cfgs.ipfshttpCfg.ProxyAddr, _ = ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	ipfs, err := ipfshttp.NewConnector(cfgs.ipfshttpCfg)
+	if err != nil {
+		return err
+	}
+	defer ipfs.Shutdown()
+
+	clusterClient, err := newAPIClient(cfgs.apiCfg, opts.Username, opts.Password)
+	if err != nil {
+		return err
+	}
+
+	peers, err := clusterClient.Peers()
+	if err != nil {
+		return fmt.Errorf("contacting the cluster peer: %s", err)
+	}
+
+	res := &benchResult{
+		Peers:  len(peers),
+		PinLat: make([]time.Duration, opts.Pins),
+	}
+	cids := make([]*cid.Cid, opts.Pins)
+	errs := make([]error, opts.Pins)
+
+	logger.Infof("adding %d random DAGs of %d bytes", opts.Pins, opts.Size)
+	start := time.Now()
+	runConcurrently(opts.Pins, opts.Concurrency, func(i int) {
+		cids[i], errs[i] = putRandomDAG(ipfs, opts.Size, opts.BlockSize)
+	})
+	res.Added = time.Since(start)
+	if err := firstError(errs); err != nil {
+		return fmt.Errorf("adding content: %s", err)
+	}
+	res.Blocks = (opts.Size + opts.BlockSize - 1) / opts.BlockSize
+
+	logger.Infof("pinning %d items", opts.Pins)
+	start = time.Now()
+	runConcurrently(opts.Pins, opts.Concurrency, func(i int) {
+		t := time.Now()
+		errs[i] = clusterClient.Pin(cids[i], opts.ReplicationFactor, fmt.Sprintf("bench-%d", i))
+		res.PinLat[i] = time.Since(t)
+	})
+	res.Committed = time.Since(start)
+	if err := firstError(errs); err != nil {
+		return fmt.Errorf("pinning: %s", err)
+	}
+
+	logger.Info("waiting for items to be pinned")
+	var mux sync.Mutex
+	deadline := start.Add(opts.Timeout)
+	runConcurrently(opts.Pins, opts.Concurrency, func(i int) {
+		for {
+			t := time.Now()
+			gpi, err := clusterClient.Status(cids[i], false)
+			lat := time.Since(t)
+
+			mux.Lock()
+			res.StatusLat = append(res.StatusLat, lat)
+			mux.Unlock()
+
+			done, failed := err == nil && pinDone(gpi), err == nil && pinFailed(gpi)
+			if done || failed || time.Now().After(deadline) {
+				mux.Lock()
+				switch {
+				case failed:
+					res.Failed++
+				case !done:
+					res.TimedOut++
+				}
+				mux.Unlock()
+				return
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	})
+	res.Pinned = time.Since(start)
+
+	start = time.Now()
+	all, err := clusterClient.StatusAll(nil, false)
+	if err != nil {
+		return fmt.Errorf("requesting status: %s", err)
+	}
+	res.StatusAll = time.Since(start)
+	res.Total = len(all)
+
+	if !opts.Keep {
+		logger.Info("unpinning benchmark items")
+		runConcurrently(opts.Pins, opts.Concurrency, func(i int) {
+			if err := clusterClient.Unpin(cids[i]); err != nil {
+				logger.Errorf("error unpinning %s: %s", cids[i], err)
+			}
+		})
+	}
+
+	printBenchReport(w, opts, res)
+	return nil
+}
+
+// putRandomDAG stores a unixfs file of size random bytes, made of raw
+// leaves of blockSize bytes linked from a dag-pb root, and returns the Cid
+// of the root.
+func putRandomDAG(ipfs *ipfshttp.Connector, size, blockSize int) (*cid.Cid, error) {
+	var links, blockSizes []byte
+	for left := size; left > 0; left -= blockSize {
+		n := blockSize
+		if left < n {
+			n = left
+		}
+		data := make([]byte, n)
+		rand.Read(data)
+		h, err := multihash.Sum(data, multihash.SHA2_256, -1)
+		if err != nil {
+			return nil, err
+		}
+		leaf := cid.NewCidV1(cid.Raw, h)
+		if err := ipfs.BlockPut(leaf, data); err != nil {
+			return nil, err
+		}
+
+		var link []byte
+		link = pbBytes(link, 1, leaf.Bytes())
+		link = pbBytes(link, 2, nil)
+		link = pbVarint(link, 3, uint64(n))
+		links = pbBytes(links, 2, link)
+		blockSizes = pbVarint(blockSizes, 4, uint64(n))
+	}
+
+	// unixfs Data: Type File, filesize and blocksizes
+	var unixfs []byte
+	unixfs = pbVarint(unixfs, 1, 2)
+	unixfs = pbVarint(unixfs, 3, uint64(size))
+	unixfs = append(unixfs, blockSizes...)
+
+	root := pbBytes(links, 1, unixfs)
+	h, err := multihash.Sum(root, multihash.SHA2_256, -1)
+	if err != nil {
+		return nil, err
+	}
+	rootCid := cid.NewCidV0(h)
+	return rootCid, ipfs.BlockPut(rootCid, root)
+}
+
+// pbVarint appends a protobuf varint field to buf.
+func pbVarint(buf []byte, field int, v uint64) []byte {
+	buf = appendUvarint(buf, uint64(field<<3))
+	return appendUvarint(buf, v)
+}
+
+// pbBytes appends a protobuf length-delimited field to buf.
+func pbBytes(buf []byte, field int, b []byte) []byte {
+	buf = appendUvarint(buf, uint64(field<<3|2))
+	buf = appendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+	return append(buf, tmp[:n]...)
+}
+
+// runConcurrently calls f for every index in [0, n) using the given
+// number of goroutines.
+func runConcurrently(n, concurrency int, f func(i int)) {
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pinDone returns true when every peer has pinned the item or is not
+// allocated to it.
+func pinDone(gpi api.GlobalPinInfo) bool {
+	pinned := false
+	for _, pinfo := range gpi.PeerMap {
+		switch pinfo.Status {
+		case api.TrackerStatusPinned, api.TrackerStatusPinnedIndirect:
+			pinned = true
+		case api.TrackerStatusRemote:
+		default:
+			return false
+		}
+	}
+	return pinned
+}
+
+func pinFailed(gpi api.GlobalPinInfo) bool {
+	for _, pinfo := range gpi.PeerMap {
+		if pinfo.Status == api.TrackerStatusPinError {
+			return true
+		}
+	}
+	return false
+}
+
+// latencies returns the average, median, 95th percentile and maximum of
+// the given durations.
+func latencies(ds []time.Duration) (avg, p50, p95, max time.Duration) {
+	if len(ds) == 0 {
+		return
+	}
+	sorted := make([]time.Duration, len(ds))
+	copy(sorted, ds)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	avg = total / time.Duration(len(sorted))
+	p50 = sorted[len(sorted)/2]
+	p95 = sorted[len(sorted)*95/100]
+	max = sorted[len(sorted)-1]
+	return
+}
+
+func perSecond(n int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+func printLatencies(w io.Writer, name string, ds []time.Duration) {
+	avg, p50, p95, max := latencies(ds)
+	fmt.Fprintf(w, "  %-20s avg %s, p50 %s, p95 %s, max %s\n", name, avg, p50, p95, max)
+}
+
+func printBenchReport(w io.Writer, opts benchOptions, res *benchResult) {
+	pinned := opts.Pins - res.Failed - res.TimedOut
+	totalBytes := opts.Pins * opts.Size
+
+	fmt.Fprintf(w, "Benchmark: %d pins of %d bytes (%d blocks each), concurrency %d, %d cluster peers\n\n",
+		opts.Pins, opts.Size, res.Blocks, opts.Concurrency, res.Peers)
+
+	fmt.Fprintln(w, "Throughput:")
+	fmt.Fprintf(w, "  %-20s %.2f blocks/s (%.2f MB/s)\n", "ipfs block put",
+		perSecond(opts.Pins*res.Blocks, res.Added),
+		perSecond(totalBytes, res.Added)/1e6)
+	fmt.Fprintf(w, "  %-20s %.2f pins/s\n", "consensus commits",
+		perSecond(opts.Pins, res.Committed))
+	fmt.Fprintf(w, "  %-20s %.2f pins/s (%.2f MB/s)\n", "pinned",
+		perSecond(pinned, res.Pinned),
+		perSecond(pinned*opts.Size, res.Pinned)/1e6)
+
+	fmt.Fprintln(w, "\nLatency:")
+	printLatencies(w, "pin", res.PinLat)
+	printLatencies(w, "status", res.StatusLat)
+	fmt.Fprintf(w, "  %-20s %s for %d items\n", "status all", res.StatusAll, res.Total)
+
+	fmt.Fprintln(w, "\nResults:")
+	fmt.Fprintf(w, "  %-20s %d\n", "pinned", pinned)
+	fmt.Fprintf(w, "  %-20s %d\n", "failed", res.Failed)
+	fmt.Fprintf(w, "  %-20s %d\n", "timed out", res.TimedOut)
+
+	fmt.Fprintln(w, "\nSizing estimates (at the measured rates):")
+	commitRate := perSecond(opts.Pins, res.Committed)
+	pinRate := perSecond(pinned, res.Pinned)
+	for _, n := range []int{10000, 100000, 1000000} {
+		fmt.Fprintf(w, "  %-20s commit in %s, pinned in %s\n",
+			fmt.Sprintf("%d pins", n),
+			estimate(n, commitRate),
+			estimate(n, pinRate))
+	}
+	if res.Total > 0 {
+		perItem := res.StatusAll / time.Duration(res.Total)
+		fmt.Fprintf(w, "  %-20s %s per 100000 items\n", "status all", perItem*100000)
+	}
+}
+
+func estimate(n int, rate float64) string {
+	if rate <= 0 {
+		return "n/a"
+	}
+	return time.Duration(float64(n) / rate * float64(time.Second)).String()
+}
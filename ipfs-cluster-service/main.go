@@ -9,26 +9,39 @@ import (
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	//	_ "net/http/pprof"
 
 	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
 	cli "github.com/urfave/cli"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 	"github.com/ipfs/ipfs-cluster/allocator/ascendalloc"
+	"github.com/ipfs/ipfs-cluster/allocator/balanced"
 	"github.com/ipfs/ipfs-cluster/allocator/descendalloc"
+	"github.com/ipfs/ipfs-cluster/allocator/external"
+	"github.com/ipfs/ipfs-cluster/api/graphql"
+	"github.com/ipfs/ipfs-cluster/api/grpcapi"
 	"github.com/ipfs/ipfs-cluster/api/rest"
 	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
+	"github.com/ipfs/ipfs-cluster/consensus/etcd"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
+	"github.com/ipfs/ipfs-cluster/informer/bandwidth"
 	"github.com/ipfs/ipfs-cluster/informer/disk"
 	"github.com/ipfs/ipfs-cluster/informer/numpin"
+	"github.com/ipfs/ipfs-cluster/informer/pinqueue"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
 	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
 	"github.com/ipfs/ipfs-cluster/monitor/basic"
 	"github.com/ipfs/ipfs-cluster/pintracker/maptracker"
-	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/pintracker/stateless"
+	"github.com/ipfs/ipfs-cluster/state/dsstate"
 )
 
 // ProgramName of this application
@@ -190,8 +203,12 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:  "alloc, a",
-			Value: "disk-freespace",
-			Usage: "allocation strategy to use [disk-freespace,disk-reposize,numpin].",
+			Usage: "allocation strategy to use [disk-freespace,disk-reposize,numpin,numpin-tracked,numpin-queued,bandwidth,balanced,external]. Overrides cluster.allocation_strategy (disk-freespace by default)",
+		},
+		cli.StringFlag{
+			Name:  "tracker",
+			Value: "map",
+			Usage: "pin tracker to use [map,stateless]. The stateless tracker does not keep the status of every pin in memory",
 		},
 	}
 
@@ -222,7 +239,7 @@ configuration.
 			},
 			Action: func(c *cli.Context) error {
 				userSecret, userSecretDefined := userProvidedSecret(c.Bool("custom-secret"))
-				cfg, clustercfg, _, _, _, _, _, _, _ := makeConfigs()
+				cfg, cfgs := makeConfigs()
 				defer cfg.Shutdown() // wait for saves
 
 				// Generate defaults for all registered components
@@ -231,7 +248,7 @@ configuration.
 
 				// Set user secret
 				if userSecretDefined {
-					clustercfg.Secret = userSecret
+					cfgs.clusterCfg.Secret = userSecret
 				}
 
 				// Save
@@ -276,6 +293,16 @@ This command reads the current cluster state and saves it as json for
 human readability and editing.  Only state formats compatible with this
 version of ipfs-cluster-service can be exported.  By default this command
 prints the state to stdout.
+
+Full exports are versioned and do not depend on the consensus component:
+a state exported from a raft peer can be imported in a crdt or etcd peer
+and vice versa. With etcd, the state is read from the etcd cluster.
+
+When --since-index or --since-checksum are provided, only the pins added,
+modified or removed since the snapshot taken at that raft index (or whose
+state matches that checksum) are exported. The base snapshot must still be
+stored in the consensus data folder. Incremental exports can be imported
+on top of a state matching their base.
 `,
 					Flags: []cli.Flag{
 						cli.StringFlag{
@@ -283,6 +310,14 @@ prints the state to stdout.
 							Value: "",
 							Usage: "sets an output file for exported state",
 						},
+						cli.Uint64Flag{
+							Name:  "since-index",
+							Usage: "export only the changes since the snapshot at this raft index",
+						},
+						cli.StringFlag{
+							Name:  "since-checksum",
+							Usage: "export only the changes since the state with this checksum",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						err := locker.lock()
@@ -301,7 +336,7 @@ prints the state to stdout.
 						}
 						defer w.Close()
 
-						err = export(w)
+						err = export(w, c.Uint64("since-index"), c.String("since-checksum"))
 						checkErr("exporting state", err)
 						return nil
 					},
@@ -313,7 +348,13 @@ prints the state to stdout.
 This command reads in an exported state file storing the state as a persistent
 snapshot to be loaded as the cluster state when the cluster peer is restarted.
 If an argument is provided, cluster will treat it as the path of the file to
-import.  If no argument is provided cluster will read json from stdin
+import.  If no argument is provided cluster will read json from stdin.
+Exports from older versions are accepted too. The state is imported into
+the consensus component selected in the configuration (raft, crdt or etcd).
+With etcd, the state in the etcd cluster is replaced right away and
+running peers pick it up without restarting.
+Incremental exports are applied on top of the peer's current state, which
+must match the export's base checksum (raft only).
 `,
 					Action: func(c *cli.Context) error {
 						err := locker.lock()
@@ -364,15 +405,150 @@ the mth data folder (m currently defaults to 5)
 							}
 						}
 
-						cfg, _, _, _, consensusCfg, _, _, _, _ := makeConfigs()
+						cfg, cfgs := makeConfigs()
 						err = cfg.LoadJSONFromFile(configPath)
 						checkErr("initializing configs", err)
 
-						dataFolder := filepath.Join(consensusCfg.BaseDir, raft.DefaultDataSubFolder)
+						if cfgs.clusterCfg.Consensus == "etcd" {
+							logger.Warning("the etcd consensus keeps no data in this peer. Nothing to clean")
+							return nil
+						}
+
+						if cfgs.clusterCfg.Consensus == "crdt" {
+							stateFile := cfgs.crdtCfg.GetStateFile()
+							err = os.Remove(stateFile)
+							if os.IsNotExist(err) {
+								err = nil
+							}
+							checkErr("Cleaning up consensus data", err)
+							logger.Warningf("the %s file has been removed.  Next start will use an empty state", stateFile)
+							return nil
+						}
+
+						dataFolder := filepath.Join(cfgs.consensusCfg.BaseDir, raft.DefaultDataSubFolder)
 						err = raft.CleanupRaft(dataFolder)
 						checkErr("Cleaning up consensus data", err)
 						logger.Warningf("the %s folder has been rotated.  Next start will use an empty state", dataFolder)
 
+						// the pin log is numbered with the Raft log
+						// index, which starts again with a new state
+						pinLogFolder := cfgs.clusterCfg.GetPinLogFolder()
+						err = os.RemoveAll(pinLogFolder)
+						checkErr("Cleaning up the pin log", err)
+						logger.Warningf("the %s folder has been removed", pinLogFolder)
+
+						// the datastore state is rebuilt from the consensus
+						// data, so it is just removed
+						if cfgs.stateCfg.Backend != dsstate.BackendMemory {
+							stateFolder := cfgs.stateCfg.GetFolder()
+							err = os.RemoveAll(stateFolder)
+							checkErr("Cleaning up the state datastore", err)
+							logger.Warningf("the %s folder has been removed", stateFolder)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:  "verify",
+					Usage: "detect differences between the shared state of the peers",
+					Description: `
+This command asks the running peer to compare the shared state of every
+cluster peer with the one of the consensus leader, and reports the items
+which differ for each peer: missing (only in the leader's state), extra
+(only in the peer's state) or different (pinned with different options).
+
+States are compared using checksums: pins are split in buckets by the hash
+of their CID and only the contents of the buckets whose checksums differ
+are transferred. The command exits with an error when any peer diverges.
+`,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "basic-auth",
+							Usage: "<username>:<password> for the REST API, when needed",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						username, password := basicAuth(c)
+						err := verify(os.Stdout, username, password)
+						checkErr("verifying the state", err)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "debug",
+			Usage: "Debug and benchmark a running cluster peer",
+			Subcommands: []cli.Command{
+				{
+					Name:  "bench",
+					Usage: "measure the performance of the cluster with synthetic pins",
+					Description: `
+This command generates synthetic load on the current deployment, so
+operators can size their cluster before a production rollout. It uses the
+configuration of this peer, which must be running.
+
+Random DAGs of the given size are added to the IPFS daemon of this peer
+and pinned through its REST API. The command measures the rate at which
+pins are committed to the shared state, how long they take to be pinned by
+the allocated peers and the latency of status requests, and prints a
+report with estimates for larger amounts of pins. The benchmark items are
+unpinned at the end unless --keep is given.
+`,
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "pins, n",
+							Value: 100,
+							Usage: "number of items to pin",
+						},
+						cli.IntFlag{
+							Name:  "size, s",
+							Value: 1024 * 1024,
+							Usage: "size in bytes of each item",
+						},
+						cli.IntFlag{
+							Name:  "block-size",
+							Value: 256 * 1024,
+							Usage: "size in bytes of the blocks of each item",
+						},
+						cli.IntFlag{
+							Name:  "concurrency, c",
+							Value: 4,
+							Usage: "number of requests sent at the same time",
+						},
+						cli.IntFlag{
+							Name:  "replication, r",
+							Value: 0,
+							Usage: "replication factor of the items. 0 uses the cluster's default",
+						},
+						cli.DurationFlag{
+							Name:  "timeout, t",
+							Value: 10 * time.Minute,
+							Usage: "maximum time to wait for the items to be pinned",
+						},
+						cli.BoolFlag{
+							Name:  "keep",
+							Usage: "do not unpin the items when finished",
+						},
+						cli.StringFlag{
+							Name:  "basic-auth",
+							Usage: "<username>:<password> for the REST API, when needed",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						opts := benchOptions{
+							Pins:              c.Int("pins"),
+							Size:              c.Int("size"),
+							BlockSize:         c.Int("block-size"),
+							Concurrency:       c.Int("concurrency"),
+							ReplicationFactor: c.Int("replication"),
+							Timeout:           c.Duration("timeout"),
+							Keep:              c.Bool("keep"),
+						}
+						opts.Username, opts.Password = basicAuth(c)
+						err := bench(os.Stdout, opts)
+						checkErr("running benchmark", err)
 						return nil
 					},
 				},
@@ -423,7 +599,7 @@ func daemon(c *cli.Context) error {
 	logger.Info("Initializing. For verbose output run with \"-l debug\". Please wait...")
 
 	// Load all the configurations
-	cfg, clusterCfg, apiCfg, ipfshttpCfg, consensusCfg, trackerCfg, monCfg, diskInfCfg, numpinInfCfg := makeConfigs()
+	cfg, cfgs := makeConfigs()
 	// Execution lock
 	err := locker.lock()
 	checkErr("acquiring execution lock", err)
@@ -437,41 +613,74 @@ func daemon(c *cli.Context) error {
 	checkErr("loading configuration", err)
 
 	if a := c.String("bootstrap"); a != "" {
-		if len(clusterCfg.Peers) > 0 && !c.Bool("force") {
+		if len(cfgs.clusterCfg.Peers) > 0 && !c.Bool("force") {
 			return errors.New("the configuration provides cluster.Peers. Use -f to ignore and proceed bootstrapping")
 		}
 		joinAddr, err := ma.NewMultiaddr(a)
 		if err != nil {
 			return fmt.Errorf("error parsing multiaddress: %s", err)
 		}
-		clusterCfg.Bootstrap = []ma.Multiaddr{joinAddr}
-		clusterCfg.Peers = []ma.Multiaddr{}
+		cfgs.clusterCfg.Bootstrap = []ma.Multiaddr{joinAddr}
+		cfgs.clusterCfg.Peers = []ma.Multiaddr{}
 	}
 
 	if c.Bool("leave") {
-		clusterCfg.LeaveOnShutdown = true
+		cfgs.clusterCfg.LeaveOnShutdown = true
 	}
 
-	api, err := rest.NewAPI(apiCfg)
+	api, err := rest.NewAPI(cfgs.apiCfg)
 	checkErr("creating REST API component", err)
+	apis := []ipfscluster.API{api}
 
-	proxy, err := ipfshttp.NewConnector(ipfshttpCfg)
+	if cfgs.graphqlCfg.Enabled {
+		gqlAPI, err := graphql.NewAPI(cfgs.graphqlCfg)
+		checkErr("creating GraphQL API component", err)
+		apis = append(apis, gqlAPI)
+	}
+
+	if cfgs.grpcCfg.Enabled {
+		grpcAPI, err := grpcapi.NewAPI(cfgs.grpcCfg)
+		checkErr("creating gRPC API component", err)
+		apis = append(apis, grpcAPI)
+	}
+
+	proxy, err := ipfshttp.NewConnector(cfgs.ipfshttpCfg)
 	checkErr("creating IPFS Connector component", err)
 
-	state := mapstate.NewMapState()
+	// the state and the tracker operations are kept encrypted with the
+	// Raft log
+	state, err := dsstate.Open(cfgs.stateCfg, cfgs.consensusCfg.EncryptionKey)
+	checkErr("creating state", err)
+	if closer, ok := state.(io.Closer); ok {
+		defer closer.Close()
+	}
 
-	err = validateVersion(clusterCfg, consensusCfg)
-	checkErr("validating version", err)
+	var selectedConsensusCfg config.ComponentConfig = cfgs.consensusCfg
+	switch cfgs.clusterCfg.Consensus {
+	case "crdt":
+		selectedConsensusCfg = cfgs.crdtCfg
+	case "etcd":
+		selectedConsensusCfg = cfgs.etcdCfg
+	default:
+		err = validateVersion(cfgs.clusterCfg, cfgs.consensusCfg)
+		checkErr("validating version", err)
+	}
 
-	tracker := maptracker.NewMapPinTracker(trackerCfg, clusterCfg.ID)
-	mon, err := basic.NewMonitor(monCfg)
+	cfgs.clusterCfg.EncryptionKey = cfgs.consensusCfg.EncryptionKey
+	cfgs.trackerCfg.EncryptionKey = cfgs.consensusCfg.EncryptionKey
+	cfgs.statelessCfg.EncryptionKey = cfgs.consensusCfg.EncryptionKey
+	tracker := setupPinTracker(c.String("tracker"), cfgs.trackerCfg, cfgs.statelessCfg, cfgs.clusterCfg.ID)
+	mon, err := basic.NewMonitor(cfgs.monCfg)
 	checkErr("creating Monitor component", err)
-	informer, alloc := setupAllocation(c.String("alloc"), diskInfCfg, numpinInfCfg)
+	if a := c.String("alloc"); a != "" {
+		cfgs.clusterCfg.AllocationStrategy = a
+	}
+	informer, alloc := setupAllocation(cfgs.clusterCfg.AllocationStrategy, cfgs.diskInfCfg, cfgs.numpinInfCfg, cfgs.bwInfCfg, cfgs.balancedCfg, cfgs.extAllocCfg)
 
 	cluster, err := ipfscluster.NewCluster(
-		clusterCfg,
-		consensusCfg,
-		api,
+		cfgs.clusterCfg,
+		selectedConsensusCfg,
+		apis,
 		proxy,
 		state,
 		tracker,
@@ -479,6 +688,12 @@ func daemon(c *cli.Context) error {
 		alloc,
 		informer)
 	checkErr("starting cluster", err)
+	cluster.SetAllocationStrategyBuilder(func(name string) (ipfscluster.Informer, ipfscluster.PinAllocator, error) {
+		return allocationStrategy(name, cfgs.diskInfCfg, cfgs.numpinInfCfg, cfgs.bwInfCfg, cfgs.balancedCfg, cfgs.extAllocCfg)
+	})
+	for _, inf := range setupFilterInformers(cfgs.clusterCfg) {
+		cluster.AddInformer(inf)
+	}
 
 	signalChan := make(chan os.Signal, 20)
 	signal.Notify(signalChan,
@@ -498,6 +713,19 @@ func daemon(c *cli.Context) error {
 	}
 }
 
+// basicAuth parses the credentials given with --basic-auth.
+func basicAuth(c *cli.Context) (string, string) {
+	creds := c.String("basic-auth")
+	if creds == "" {
+		return "", ""
+	}
+	parts := strings.SplitN(creds, ":", 2)
+	if len(parts) != 2 {
+		checkErr("parsing credentials", errors.New("use <username>:<password>"))
+	}
+	return parts[0], parts[1]
+}
+
 func setupLogLevel(lvl string) {
 	for f := range ipfscluster.LoggingFacilities {
 		ipfscluster.SetFacilityLogLevel(f, lvl)
@@ -508,24 +736,81 @@ func setupDebug() {
 	ipfscluster.SetFacilityLogLevel("*", "DEBUG")
 }
 
-func setupAllocation(name string, diskInfCfg *disk.Config, numpinInfCfg *numpin.Config) (ipfscluster.Informer, ipfscluster.PinAllocator) {
+func setupPinTracker(name string, mapCfg *maptracker.Config, statelessCfg *stateless.Config, pid peer.ID) ipfscluster.PinTracker {
+	switch name {
+	case "map":
+		return maptracker.NewMapPinTracker(mapCfg, pid)
+	case "stateless":
+		return stateless.NewStatelessPinTracker(statelessCfg, pid)
+	default:
+		checkErr("creating pin tracker", errors.New("unknown pin tracker"))
+		return nil
+	}
+}
+
+func setupAllocation(name string, diskInfCfg *disk.Config, numpinInfCfg *numpin.Config, bwInfCfg *bandwidth.Config, balancedCfg *balanced.Config, extAllocCfg *external.Config) (ipfscluster.Informer, ipfscluster.PinAllocator) {
+	informer, alloc, err := allocationStrategy(name, diskInfCfg, numpinInfCfg, bwInfCfg, balancedCfg, extAllocCfg)
+	checkErr("creating informer", err)
+	return informer, alloc
+}
+
+// setupFilterInformers creates the informers providing the metrics used
+// by the allocation filters, which every peer sends regardless of the
+// filters it enables.
+func setupFilterInformers(cfg *ipfscluster.Config) []ipfscluster.Informer {
+	ttl := cfg.MonitorPingInterval * 2
+
+	pinQueueInf, err := pinqueue.NewInformer(ttl)
+	checkErr("creating pinqueue informer", err)
+	tagsInf, err := tags.NewInformer(cfg.Tags, ttl)
+	checkErr("creating tags informer", err)
+	return []ipfscluster.Informer{pinQueueInf, tagsInf}
+}
+
+// allocationStrategy creates the informer and the allocator for the
+// allocation strategy with the given name.
+func allocationStrategy(name string, diskInfCfg *disk.Config, numpinInfCfg *numpin.Config, bwInfCfg *bandwidth.Config, balancedCfg *balanced.Config, extAllocCfg *external.Config) (ipfscluster.Informer, ipfscluster.PinAllocator, error) {
 	switch name {
 	case "disk", "disk-freespace":
 		informer, err := disk.NewInformer(diskInfCfg)
-		checkErr("creating informer", err)
-		return informer, descendalloc.NewAllocator()
+		return informer, descendalloc.NewAllocator(), err
+	case "balanced":
+		informer, err := disk.NewInformer(diskInfCfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		alloc, err := balanced.NewAllocator(balancedCfg)
+		return informer, alloc, err
+	case "external":
+		informer, err := disk.NewInformer(diskInfCfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		alloc, err := external.NewAllocator(extAllocCfg)
+		return informer, alloc, err
 	case "disk-reposize":
 		informer, err := disk.NewInformer(diskInfCfg)
-		checkErr("creating informer", err)
-		return informer, ascendalloc.NewAllocator()
+		return informer, ascendalloc.NewAllocator(), err
 	case "numpin", "pincount":
 		informer, err := numpin.NewInformer(numpinInfCfg)
-		checkErr("creating informer", err)
-		return informer, ascendalloc.NewAllocator()
+		return informer, ascendalloc.NewAllocator(), err
+	case "numpin-tracked", "numpin-queued":
+		// do not modify the loaded configuration, as the
+		// strategy may be changed again at runtime.
+		cfg := &numpin.Config{
+			MetricTTL: numpinInfCfg.MetricTTL,
+			Type:      numpin.MetricTrackedPins,
+		}
+		if name == "numpin-queued" {
+			cfg.Type = numpin.MetricQueuedPins
+		}
+		informer, err := numpin.NewInformer(cfg)
+		return informer, ascendalloc.NewAllocator(), err
+	case "bandwidth":
+		informer, err := bandwidth.NewInformer(bwInfCfg)
+		return informer, descendalloc.NewAllocator(), err
 	default:
-		err := errors.New("unknown allocation strategy")
-		checkErr("", err)
-		return nil, nil
+		return nil, nil, errors.New("unknown allocation strategy")
 	}
 }
 
@@ -583,23 +868,65 @@ func yesNoPrompt(prompt string) bool {
 	return false
 }
 
-func makeConfigs() (*config.Manager, *ipfscluster.Config, *rest.Config, *ipfshttp.Config, *raft.Config, *maptracker.Config, *basic.Config, *disk.Config, *numpin.Config) {
+// cfgs holds the configuration of every component registered by
+// makeConfigs.
+type cfgs struct {
+	clusterCfg   *ipfscluster.Config
+	apiCfg       *rest.Config
+	graphqlCfg   *graphql.Config
+	grpcCfg      *grpcapi.Config
+	ipfshttpCfg  *ipfshttp.Config
+	consensusCfg *raft.Config
+	crdtCfg      *crdt.Config
+	etcdCfg      *etcd.Config
+	stateCfg     *dsstate.Config
+	trackerCfg   *maptracker.Config
+	statelessCfg *stateless.Config
+	monCfg       *basic.Config
+	diskInfCfg   *disk.Config
+	numpinInfCfg *numpin.Config
+	bwInfCfg     *bandwidth.Config
+	balancedCfg  *balanced.Config
+	extAllocCfg  *external.Config
+}
+
+func makeConfigs() (*config.Manager, *cfgs) {
 	cfg := config.NewManager()
-	clusterCfg := &ipfscluster.Config{}
-	apiCfg := &rest.Config{}
-	ipfshttpCfg := &ipfshttp.Config{}
-	consensusCfg := &raft.Config{}
-	trackerCfg := &maptracker.Config{}
-	monCfg := &basic.Config{}
-	diskInfCfg := &disk.Config{}
-	numpinInfCfg := &numpin.Config{}
-	cfg.RegisterComponent(config.Cluster, clusterCfg)
-	cfg.RegisterComponent(config.API, apiCfg)
-	cfg.RegisterComponent(config.IPFSConn, ipfshttpCfg)
-	cfg.RegisterComponent(config.Consensus, consensusCfg)
-	cfg.RegisterComponent(config.PinTracker, trackerCfg)
-	cfg.RegisterComponent(config.Monitor, monCfg)
-	cfg.RegisterComponent(config.Informer, diskInfCfg)
-	cfg.RegisterComponent(config.Informer, numpinInfCfg)
-	return cfg, clusterCfg, apiCfg, ipfshttpCfg, consensusCfg, trackerCfg, monCfg, diskInfCfg, numpinInfCfg
+	cfgs := &cfgs{
+		clusterCfg:   &ipfscluster.Config{},
+		apiCfg:       &rest.Config{},
+		graphqlCfg:   &graphql.Config{},
+		grpcCfg:      &grpcapi.Config{},
+		ipfshttpCfg:  &ipfshttp.Config{},
+		consensusCfg: &raft.Config{},
+		crdtCfg:      &crdt.Config{},
+		etcdCfg:      &etcd.Config{},
+		stateCfg:     &dsstate.Config{},
+		trackerCfg:   &maptracker.Config{},
+		statelessCfg: &stateless.Config{},
+		monCfg:       &basic.Config{},
+		diskInfCfg:   &disk.Config{},
+		numpinInfCfg: &numpin.Config{},
+		bwInfCfg:     &bandwidth.Config{},
+		balancedCfg:  &balanced.Config{},
+		extAllocCfg:  &external.Config{},
+	}
+	cfg.RegisterComponent(config.Cluster, cfgs.clusterCfg)
+	cfg.RegisterComponent(config.API, cfgs.apiCfg)
+	cfg.RegisterComponent(config.API, cfgs.graphqlCfg)
+	cfg.RegisterComponent(config.API, cfgs.grpcCfg)
+	cfg.RegisterComponent(config.IPFSConn, cfgs.ipfshttpCfg)
+	cfg.RegisterComponent(config.Consensus, cfgs.consensusCfg)
+	cfg.RegisterComponent(config.Consensus, cfgs.crdtCfg)
+	cfg.RegisterComponent(config.Consensus, cfgs.etcdCfg)
+	cfg.RegisterComponent(config.State, cfgs.stateCfg)
+	cfg.RegisterComponent(config.PinTracker, cfgs.trackerCfg)
+	cfg.RegisterComponent(config.PinTracker, cfgs.statelessCfg)
+	cfg.RegisterComponent(config.Monitor, cfgs.monCfg)
+	cfg.RegisterComponent(config.Informer, cfgs.diskInfCfg)
+	cfg.RegisterComponent(config.Informer, cfgs.numpinInfCfg)
+	cfg.RegisterComponent(config.Informer, cfgs.bwInfCfg)
+	cfg.RegisterComponent(config.Allocator, cfgs.balancedCfg)
+	cfg.RegisterComponent(config.Allocator, cfgs.extAllocCfg)
+	return cfg, cfgs
 }
@@ -1,53 +1,260 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"sort"
+
+	cid "github.com/ipfs/go-cid"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
+	"github.com/ipfs/ipfs-cluster/consensus/etcd"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
 	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 var errNoSnapshot = errors.New("no snapshot found")
 
+var errRaftOnly = errors.New("only supported with the raft consensus")
+
+// exportFormatVersion is the version of the stateExport format. Exports
+// from older versions of ipfs-cluster-service (a plain json array of
+// pins) are version 0.
+const exportFormatVersion = 1
+
+// stateExport is the format of full state exports. It does not depend on
+// the consensus component, so it can be imported with a different one.
+type stateExport struct {
+	Version      int             `json:"version"`
+	StateVersion int             `json:"state_version"`
+	Pins         []api.PinSerial `json:"pins"`
+	Maintenance  []string        `json:"maintenance,omitempty"`
+}
+
+// incrementalExport holds the differences between the state stored in
+// two snapshots. Added contains pins which are new or have been modified
+// since the base snapshot and Removed the CIDs which are no longer pinned.
+type incrementalExport struct {
+	BaseIndex    uint64          `json:"base_index"`
+	BaseChecksum string          `json:"base_checksum"`
+	Index        uint64          `json:"index"`
+	Checksum     string          `json:"checksum"`
+	Added        []api.PinSerial `json:"added"`
+	Removed      []string        `json:"removed"`
+}
+
 func upgrade() error {
+	cfg, cfgs := makeConfigs()
+
+	err := cfg.LoadJSONFromFile(configPath)
+	if err != nil {
+		return err
+	}
+	if cfgs.clusterCfg.Consensus != "raft" {
+		return errRaftOnly
+	}
+
 	newState, err := restoreStateFromDisk()
 	if err != nil {
 		return err
 	}
 
-	cfg, clusterCfg, _, _, consensusCfg, _, _, _, _ := makeConfigs()
+	return raft.SnapshotSave(cfgs.consensusCfg, newState, cfgs.clusterCfg.ID)
+}
+
+// export writes the state from the last snapshot to w. When sinceIndex or
+// sinceChecksum are set, only the changes made since the snapshot matching
+// them are exported.
+func export(w io.Writer, sinceIndex uint64, sinceChecksum string) error {
+	cfg, cfgs := makeConfigs()
 
-	err = cfg.LoadJSONFromFile(configPath)
+	err := cfg.LoadJSONFromFile(configPath)
 	if err != nil {
 		return err
 	}
 
-	return raft.SnapshotSave(consensusCfg, newState, clusterCfg.ID)
-}
+	if cfgs.clusterCfg.Consensus == "crdt" {
+		if sinceIndex != 0 || sinceChecksum != "" {
+			return fmt.Errorf("incremental exports are %s", errRaftOnly)
+		}
+		stateToExport, err := crdt.LastState(cfgs.crdtCfg)
+		if err != nil {
+			return err
+		}
+		return exportState(stateToExport, w)
+	}
+
+	if cfgs.clusterCfg.Consensus == "etcd" {
+		if sinceIndex != 0 || sinceChecksum != "" {
+			return fmt.Errorf("incremental exports are %s", errRaftOnly)
+		}
+		stateToExport, err := etcd.LastState(cfgs.etcdCfg)
+		if err != nil {
+			return err
+		}
+		return exportState(stateToExport, w)
+	}
+
+	indexes, err := raft.SnapshotIndexes(cfgs.consensusCfg)
+	if err != nil {
+		return err
+	}
+	if len(indexes) == 0 {
+		return errNoSnapshot
+	}
 
-func export(w io.Writer) error {
-	stateToExport, err := restoreStateFromDisk()
+	stateToExport, err := restoreStateAt(cfgs.consensusCfg, indexes[0])
+	if err != nil {
+		return err
+	}
+	checksum, err := stateChecksum(stateToExport)
+	if err != nil {
+		return err
+	}
+
+	if sinceIndex == 0 && sinceChecksum == "" {
+		logger.Infof("exporting state at index %d with checksum %s", indexes[0], checksum)
+		return exportState(stateToExport, w)
+	}
+
+	baseIndex, baseState, err := findBaseState(cfgs.consensusCfg, indexes, sinceIndex, sinceChecksum)
+	if err != nil {
+		return err
+	}
+	baseChecksum, err := stateChecksum(baseState)
 	if err != nil {
 		return err
 	}
 
-	return exportState(stateToExport, w)
+	incr := diffStates(baseState, stateToExport)
+	incr.BaseIndex = baseIndex
+	incr.BaseChecksum = baseChecksum
+	incr.Index = indexes[0]
+	incr.Checksum = checksum
+
+	logger.Infof(
+		"exporting changes between index %d and %d: %d added, %d removed",
+		baseIndex,
+		indexes[0],
+		len(incr.Added),
+		len(incr.Removed),
+	)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(incr)
+}
+
+// findBaseState looks among the stored snapshots for the one taken at
+// sinceIndex or, if not set, for the one whose state matches sinceChecksum.
+func findBaseState(cCfg *raft.Config, indexes []uint64, sinceIndex uint64, sinceChecksum string) (uint64, *mapstate.MapState, error) {
+	for _, idx := range indexes {
+		if sinceIndex != 0 && idx != sinceIndex {
+			continue
+		}
+		st, err := restoreStateAt(cCfg, idx)
+		if err != nil {
+			return 0, nil, err
+		}
+		if sinceIndex != 0 {
+			return idx, st, nil
+		}
+		sum, err := stateChecksum(st)
+		if err != nil {
+			return 0, nil, err
+		}
+		if sum == sinceChecksum {
+			return idx, st, nil
+		}
+	}
+	return 0, nil, errors.New("no stored snapshot matches the given base: a full export is needed")
+}
+
+// diffStates returns the changes needed to go from base to current.
+func diffStates(base, current *mapstate.MapState) *incrementalExport {
+	incr := &incrementalExport{
+		Added:   []api.PinSerial{},
+		Removed: []string{},
+	}
+
+	for _, pin := range current.List() {
+		pinS := pin.ToSerial()
+		if base.Has(pin.Cid) {
+			basePinS := base.Get(pin.Cid).ToSerial()
+			if pinSerialEqual(basePinS, pinS) {
+				continue
+			}
+		}
+		incr.Added = append(incr.Added, pinS)
+	}
+
+	for _, pin := range base.List() {
+		if !current.Has(pin.Cid) {
+			incr.Removed = append(incr.Removed, pin.Cid.String())
+		}
+	}
+
+	sort.Slice(incr.Added, func(i, j int) bool {
+		return incr.Added[i].Cid < incr.Added[j].Cid
+	})
+	sort.Strings(incr.Removed)
+	return incr
+}
+
+func pinSerialEqual(a, b api.PinSerial) bool {
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aj, bj)
+}
+
+// stateChecksum returns a hex-encoded sha256 sum of the pins in the state,
+// independent of the order in which they are stored.
+func stateChecksum(state *mapstate.MapState) (string, error) {
+	pins := state.List()
+	pinSerials := make([]api.PinSerial, len(pins), len(pins))
+	for i, pin := range pins {
+		pinSerials[i] = pin.ToSerial()
+	}
+	sort.Slice(pinSerials, func(i, j int) bool {
+		return pinSerials[i].Cid < pinSerials[j].Cid
+	})
+
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, pinS := range pinSerials {
+		err := enc.Encode(pinS)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func restoreStateFromDisk() (*mapstate.MapState, error) {
-	cfg, _, _, _, consensusCfg, _, _, _, _ := makeConfigs()
+	cfg, cfgs := makeConfigs()
 
 	err := cfg.LoadJSONFromFile(configPath)
 	if err != nil {
 		return nil, err
 	}
 
-	r, snapExists, err := raft.LastStateRaw(consensusCfg)
+	r, snapExists, err := raft.LastStateRaw(cfgs.consensusCfg)
 	if !snapExists {
 		err = errNoSnapshot
 	}
@@ -65,32 +272,174 @@ func restoreStateFromDisk() (*mapstate.MapState, error) {
 
 }
 
+func restoreStateAt(cCfg *raft.Config, index uint64) (*mapstate.MapState, error) {
+	r, snapExists, err := raft.StateRawAt(cCfg, index)
+	if !snapExists {
+		err = fmt.Errorf("no snapshot found at index %d", index)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stateFromSnap := mapstate.NewMapState()
+	err = stateFromSnap.Migrate(r)
+	if err != nil {
+		return nil, err
+	}
+	return stateFromSnap, nil
+}
+
 func stateImport(r io.Reader) error {
-	cfg, clusterCfg, _, _, consensusCfg, _, _, _, _ := makeConfigs()
+	cfg, cfgs := makeConfigs()
 
 	err := cfg.LoadJSONFromFile(configPath)
 	if err != nil {
 		return err
 	}
 
-	pinSerials := make([]api.PinSerial, 0)
-	dec := json.NewDecoder(r)
-	err = dec.Decode(&pinSerials)
+	raw, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
 	}
 
-	stateToImport := mapstate.NewMapState()
-	for _, pS := range pinSerials {
-		err = stateToImport.Add(pS.ToPin())
+	// Incremental exports carry a base checksum.
+	var probe incrementalExport
+	if json.Unmarshal(raw, &probe) == nil && probe.BaseChecksum != "" {
+		if cfgs.clusterCfg.Consensus != "raft" {
+			return fmt.Errorf("incremental imports are %s", errRaftOnly)
+		}
+		return incrementalImport(cfgs.consensusCfg, cfgs.clusterCfg, raw)
+	}
+
+	stateToImport, err := decodeStateExport(raw)
+	if err != nil {
+		return err
+	}
+
+	if cfgs.clusterCfg.Consensus == "crdt" {
+		return crdt.SaveState(cfgs.crdtCfg, stateToImport, cfgs.clusterCfg.ID)
+	}
+	if cfgs.clusterCfg.Consensus == "etcd" {
+		return etcd.SaveState(cfgs.etcdCfg, stateToImport)
+	}
+	return raft.SnapshotSave(cfgs.consensusCfg, stateToImport, cfgs.clusterCfg.ID)
+}
+
+// decodeStateExport reads a full export in any of the known formats.
+func decodeStateExport(raw []byte) (*mapstate.MapState, error) {
+	var exp stateExport
+
+	// Version 0 exports are json arrays.
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		err := json.Unmarshal(trimmed, &exp.Pins)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := json.Unmarshal(raw, &exp)
+		if err != nil {
+			return nil, err
+		}
+		if exp.Version > exportFormatVersion {
+			return nil, fmt.Errorf("unsupported export format version %d", exp.Version)
+		}
+		if exp.StateVersion > mapstate.Version {
+			return nil, fmt.Errorf("the export is from a newer state version (%d)", exp.StateVersion)
+		}
+	}
+
+	st := mapstate.NewMapState()
+	for _, pS := range exp.Pins {
+		pin := pS.ToPin()
+		if pin.Cid == nil {
+			return nil, fmt.Errorf("bad cid in export: %s", pS.Cid)
+		}
+		err := st.Add(pin)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, pidStr := range exp.Maintenance {
+		pid, err := peer.IDB58Decode(pidStr)
+		if err != nil {
+			return nil, err
+		}
+		st.SetMaintenance(pid, true)
+	}
+	return st, nil
+}
+
+// incrementalImport applies an incremental export on top of the state in
+// the last snapshot, which must match the export's base checksum.
+func incrementalImport(cCfg *raft.Config, clusterCfg *ipfscluster.Config, raw []byte) error {
+	var incr incrementalExport
+	err := json.Unmarshal(raw, &incr)
+	if err != nil {
+		return err
+	}
+
+	r, snapExists, err := raft.LastStateRaw(cCfg)
+	if !snapExists {
+		err = errNoSnapshot
+	}
+	if err != nil {
+		return err
+	}
+	st := mapstate.NewMapState()
+	err = st.Migrate(r)
+	if err != nil {
+		return err
+	}
+
+	err = applyIncrementalExport(st, &incr)
+	if err != nil {
+		return err
+	}
+	return raft.SnapshotSave(cCfg, st, clusterCfg.ID)
+}
+
+// applyIncrementalExport applies the changes in an incremental export to
+// the given state. The state must match the export's base checksum before,
+// and its checksum after.
+func applyIncrementalExport(st *mapstate.MapState, incr *incrementalExport) error {
+	checksum, err := stateChecksum(st)
+	if err != nil {
+		return err
+	}
+	if checksum != incr.BaseChecksum {
+		return fmt.Errorf("current state checksum %s does not match the incremental export base %s", checksum, incr.BaseChecksum)
+	}
+
+	for _, cidStr := range incr.Removed {
+		c, err := cid.Decode(cidStr)
+		if err != nil {
+			return err
+		}
+		err = st.Rm(c)
+		if err != nil {
+			return err
+		}
+	}
+	for _, pS := range incr.Added {
+		err = st.Add(pS.ToPin())
 		if err != nil {
 			return err
 		}
 	}
 
-	return raft.SnapshotSave(consensusCfg, stateToImport, clusterCfg.ID)
+	checksum, err = stateChecksum(st)
+	if err != nil {
+		return err
+	}
+	if checksum != incr.Checksum {
+		return fmt.Errorf("resulting state checksum %s does not match the expected %s", checksum, incr.Checksum)
+	}
+	return nil
 }
 
+// validateVersion checks the version of the state in the last raft
+// snapshot. Outdated states are migrated to the current format and saved
+// in a new snapshot.
 func validateVersion(cfg *ipfscluster.Config, cCfg *raft.Config) error {
 	state := mapstate.NewMapState()
 	r, snapExists, err := raft.LastStateRaw(cCfg)
@@ -108,15 +457,31 @@ func validateVersion(cfg *ipfscluster.Config, cCfg *raft.Config) error {
 			logger.Error("error unmarshalling snapshot. Snapshot potentially corrupt.")
 			return err2
 		}
-		if state.GetVersion() != mapstate.Version {
+		v := state.GetVersion()
+		if v == mapstate.Version {
+			return nil
+		}
+		if !mapstate.CanMigrate(v) {
 			logger.Error("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
-			logger.Error("Out of date ipfs-cluster state is saved.")
-			logger.Error("To migrate to the new version, run ipfs-cluster-service state upgrade.")
+			logger.Errorf("The saved ipfs-cluster state (version %d) cannot be migrated.", v)
 			logger.Error("To launch a node without this state, rename the consensus data directory.")
 			logger.Error("Hint, the default is .ipfs-cluster/ipfs-cluster-data.")
 			logger.Error("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
-			err = errors.New("outdated state version stored")
+			return errors.New("unsupported state version stored")
 		}
+
+		logger.Warningf("migrating the saved state from version %d to %d", v, mapstate.Version)
+		state = mapstate.NewMapState()
+		err2 = state.Migrate(bytes.NewReader(raw))
+		if err2 != nil {
+			logger.Error("error migrating the state. Run ipfs-cluster-service state upgrade for details.")
+			return err2
+		}
+		err2 = raft.SnapshotSave(cCfg, state, cfg.ID)
+		if err2 != nil {
+			return err2
+		}
+		logger.Info("state migrated successfully")
 	} // !snapExists && err == nil // no existing state, no check needed
 	return err
 }
@@ -129,9 +494,25 @@ func exportState(state *mapstate.MapState, w io.Writer) error {
 	for i, pin := range pins {
 		pinSerials[i] = pin.ToSerial()
 	}
+	sort.Slice(pinSerials, func(i, j int) bool {
+		return pinSerials[i].Cid < pinSerials[j].Cid
+	})
+
+	maintenance := []string{}
+	for _, p := range state.MaintenancePeers() {
+		maintenance = append(maintenance, peer.IDB58Encode(p))
+	}
+	sort.Strings(maintenance)
+
+	exp := stateExport{
+		Version:      exportFormatVersion,
+		StateVersion: state.GetVersion(),
+		Pins:         pinSerials,
+		Maintenance:  maintenance,
+	}
 
 	// Write json to output file
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", "    ")
-	return enc.Encode(pinSerials)
+	return enc.Encode(exp)
 }
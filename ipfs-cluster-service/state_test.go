@@ -0,0 +1,168 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func testPin(c, name string) api.Pin {
+	h, _ := cid.Decode(c)
+	return api.Pin{
+		Cid:               h,
+		Name:              name,
+		ReplicationFactor: -1,
+		Allocations:       []peer.ID{},
+	}
+}
+
+func testState(t *testing.T, pins ...api.Pin) *mapstate.MapState {
+	st := mapstate.NewMapState()
+	for _, p := range pins {
+		err := st.Add(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st
+}
+
+func testChecksum(t *testing.T, st *mapstate.MapState) string {
+	sum, err := stateChecksum(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	pin1        = testPin(test.TestCid1, "a")
+	pin2        = testPin(test.TestCid2, "b")
+	pin3        = testPin(test.TestCid3, "c")
+	pin1Renamed = testPin(test.TestCid1, "renamed")
+)
+
+var diffTestCases = []struct {
+	name    string
+	base    []api.Pin
+	current []api.Pin
+	added   []string
+	removed []string
+}{
+	{"empty", nil, nil, nil, nil},
+	{"unchanged", []api.Pin{pin1, pin2}, []api.Pin{pin2, pin1}, nil, nil},
+	{"added", []api.Pin{pin1}, []api.Pin{pin1, pin2, pin3}, []string{test.TestCid2, test.TestCid3}, nil},
+	{"removed", []api.Pin{pin1, pin2, pin3}, []api.Pin{pin2}, nil, []string{test.TestCid1, test.TestCid3}},
+	{"modified", []api.Pin{pin1, pin2}, []api.Pin{pin1Renamed, pin2}, []string{test.TestCid1}, nil},
+	{"mixed", []api.Pin{pin1, pin2}, []api.Pin{pin1Renamed, pin3}, []string{test.TestCid1, test.TestCid3}, []string{test.TestCid2}},
+}
+
+func TestDiffStates(t *testing.T) {
+	for _, tc := range diffTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			incr := diffStates(testState(t, tc.base...), testState(t, tc.current...))
+
+			added := make([]string, 0, len(incr.Added))
+			for _, pS := range incr.Added {
+				added = append(added, pS.Cid)
+			}
+			expAdded := append([]string{}, tc.added...)
+			sort.Strings(expAdded)
+			if !sameStrings(added, expAdded) {
+				t.Errorf("expected %v added and got %v", expAdded, added)
+			}
+
+			expRemoved := append([]string{}, tc.removed...)
+			sort.Strings(expRemoved)
+			if !sameStrings(incr.Removed, expRemoved) {
+				t.Errorf("expected %v removed and got %v", expRemoved, incr.Removed)
+			}
+		})
+	}
+}
+
+func TestStateChecksum(t *testing.T) {
+	testCases := []struct {
+		name  string
+		a     []api.Pin
+		b     []api.Pin
+		equal bool
+	}{
+		{"empty", nil, nil, true},
+		{"same pins", []api.Pin{pin1, pin2}, []api.Pin{pin1, pin2}, true},
+		{"different order", []api.Pin{pin1, pin2, pin3}, []api.Pin{pin3, pin1, pin2}, true},
+		{"different pins", []api.Pin{pin1, pin2}, []api.Pin{pin1, pin3}, false},
+		{"modified pin", []api.Pin{pin1}, []api.Pin{pin1Renamed}, false},
+		{"one pin more", []api.Pin{pin1}, []api.Pin{pin1, pin2}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := testChecksum(t, testState(t, tc.a...))
+			b := testChecksum(t, testState(t, tc.b...))
+			if (a == b) != tc.equal {
+				t.Errorf("checksums %s and %s: expected equal=%t", a, b, tc.equal)
+			}
+		})
+	}
+}
+
+func TestApplyIncrementalExport(t *testing.T) {
+	for _, tc := range diffTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := testState(t, tc.base...)
+			current := testState(t, tc.current...)
+			incr := diffStates(base, current)
+			incr.BaseChecksum = testChecksum(t, base)
+			incr.Checksum = testChecksum(t, current)
+
+			err := applyIncrementalExport(base, incr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testChecksum(t, base) != incr.Checksum {
+				t.Error("the imported state should match the exported one")
+			}
+		})
+	}
+}
+
+func TestApplyIncrementalExportMismatch(t *testing.T) {
+	base := testState(t, pin1)
+	current := testState(t, pin1, pin2)
+	incr := diffStates(base, current)
+	incr.BaseChecksum = testChecksum(t, base)
+	incr.Checksum = testChecksum(t, current)
+
+	// the state has changed since the export was made
+	other := testState(t, pin3)
+	err := applyIncrementalExport(other, incr)
+	if err == nil {
+		t.Error("expected an error with a different base state")
+	}
+
+	// the export does not produce the expected state
+	incr.Checksum = testChecksum(t, other)
+	err = applyIncrementalExport(testState(t, pin1), incr)
+	if err == nil {
+		t.Error("expected an error with a different resulting state")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipfs/ipfs-cluster/api/rest"
+	"github.com/ipfs/ipfs-cluster/api/rest/client"
+)
+
+// newAPIClient returns a client for the REST API of the running peer.
+func newAPIClient(apiCfg *rest.Config, username, password string) (*client.Client, error) {
+	return client.NewClient(&client.Config{
+		APIAddr:      apiCfg.ListenAddr,
+		SSL:          apiCfg.TLS != nil,
+		NoVerifyCert: true,
+		Username:     username,
+		Password:     password,
+	})
+}
+
+// verify asks the running peer to compare the shared state of every
+// cluster peer with the leader's and writes a report to w. It returns an
+// error when any of them diverges.
+func verify(w io.Writer, username, password string) error {
+	cfg, cfgs := makeConfigs()
+	err := cfg.LoadJSONFromFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	clusterClient, err := newAPIClient(cfgs.apiCfg, username, password)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := clusterClient.StateVerify()
+	if err != nil {
+		return fmt.Errorf("contacting the cluster peer: %s", err)
+	}
+
+	diverged := 0
+	for _, d := range diffs {
+		if !d.Diverged() {
+			fmt.Fprintf(w, "%s: OK (checksum %s)\n", d.Peer.Pretty(), d.Root)
+			continue
+		}
+		diverged++
+		if d.Error != "" {
+			fmt.Fprintf(w, "%s: ERROR: %s\n", d.Peer.Pretty(), d.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s: DIVERGED (checksum %s, leader %s)\n",
+			d.Peer.Pretty(), d.Root, d.LeaderRoot)
+		printCids(w, "missing", d.Missing)
+		printCids(w, "extra", d.Extra)
+		printCids(w, "different", d.Different)
+	}
+
+	if diverged > 0 {
+		return fmt.Errorf("%d of %d peers diverge from the leader", diverged, len(diffs))
+	}
+	return nil
+}
+
+func printCids(w io.Writer, label string, cids []*cid.Cid) {
+	for _, c := range cids {
+		fmt.Fprintf(w, "  > %s: %s\n", label, c)
+	}
+}
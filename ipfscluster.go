@@ -9,11 +9,14 @@
 package ipfscluster
 
 import (
+	"time"
+
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
 
 	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
+	host "github.com/libp2p/go-libp2p-host"
 	peer "github.com/libp2p/go-libp2p-peer"
 	protocol "github.com/libp2p/go-libp2p-protocol"
 )
@@ -42,9 +45,18 @@ type Consensus interface {
 	Ready() <-chan struct{}
 	// Logs a pin operation
 	LogPin(c api.Pin) error
+	// Logs several pin operations at once
+	LogPinBatch(pins []api.Pin) error
 	// Logs an unpin operation
 	LogUnpin(c api.Pin) error
+	// Logs a change of the maintenance mode of a peer
+	LogMaintenance(pm api.PeerMaintenance) error
 	AddPeer(p peer.ID) error
+	// Adds a peer which replicates the state but does not
+	// take part in votes
+	AddNonVoter(p peer.ID) error
+	// Returns false for peers which should be added with AddNonVoter
+	Voter() bool
 	RmPeer(p peer.ID) error
 	State() (state.State, error)
 	// Provide a node which is responsible to perform
@@ -57,6 +69,14 @@ type Consensus interface {
 	Clean() error
 	// Peers returns the peerset participating in the Consensus
 	Peers() ([]peer.ID, error)
+	// Snapshot persists the current state and compacts the
+	// consensus log, if any
+	Snapshot() error
+	// LastContact returns when the local state was last known
+	// to be up to date with the rest of the cluster
+	LastContact() time.Time
+	// Status returns the internals of the consensus in this peer
+	Status() api.ConsensusStatus
 }
 
 // API is a component which offers an API for Cluster. This is
@@ -65,6 +85,13 @@ type API interface {
 	Component
 }
 
+// Libp2pAPI is an API which can also be served over libp2p. Cluster
+// gives it its host before calling SetClient.
+type Libp2pAPI interface {
+	API
+	SetHost(host.Host)
+}
+
 // IPFSConnector is a component which allows cluster to interact with
 // an IPFS daemon. This is a base component.
 type IPFSConnector interface {
@@ -72,6 +99,8 @@ type IPFSConnector interface {
 	ID() (api.IPFSID, error)
 	Pin(*cid.Cid) error
 	Unpin(*cid.Cid) error
+	// Cancel aborts the ongoing pin or unpin request for a Cid.
+	Cancel(*cid.Cid) error
 	PinLsCid(*cid.Cid) (api.IPFSPinStatus, error)
 	PinLs(typeFilter string) (map[string]api.IPFSPinStatus, error)
 	// ConnectSwarms make sure this peer's IPFS daemon is connected to
@@ -86,6 +115,24 @@ type IPFSConnector interface {
 	// RepoSize returns the current repository size as expressed
 	// by "repo stat".
 	RepoSize() (uint64, error)
+	// BandwidthRate returns the bandwidth currently used, in
+	// bytes per second, as expressed by "stats bw".
+	BandwidthRate() (uint64, error)
+	// SwarmPeers returns the peers connected to the IPFS daemon.
+	SwarmPeers() ([]peer.ID, error)
+	// BlockGet returns the raw bytes of a block.
+	BlockGet(*cid.Cid) ([]byte, error)
+	// Resolve returns the Cid an IPFS or IPNS path points to.
+	Resolve(string) (*cid.Cid, error)
+	// BlockPut stores a raw block with the format of the given Cid.
+	BlockPut(*cid.Cid, []byte) error
+	// ObjectSize returns the cumulative size of the DAG under a Cid,
+	// as expressed by "object stat".
+	ObjectSize(*cid.Cid) (uint64, error)
+	// Add feeds a chunk of the body of an add request to IPFS, without
+	// pinning the content. The added items are returned with the last
+	// chunk.
+	Add(api.AddChunk) ([]api.AddedOutput, error)
 }
 
 // Peered represents a component which needs to be aware of the peers
@@ -107,6 +154,15 @@ type PinTracker interface {
 	// Untrack tells the tracker that a Cid is to be forgotten. The tracker
 	// may perform an IPFS unpin operation.
 	Untrack(*cid.Cid) error
+	// TrackInBackground and UntrackInBackground work like Track and
+	// Untrack, but are used by background maintenance operations. They
+	// should not delay the operations requested by users.
+	TrackInBackground(api.Pin) error
+	UntrackInBackground(*cid.Cid) error
+	// CancelPin stops the pin of a Cid which is queued or in progress,
+	// unpinning whatever was fetched. It fails when there is no such
+	// pin, e.g. because it has finished already.
+	CancelPin(*cid.Cid) error
 	// StatusAll returns the list of pins with their local status.
 	StatusAll() []api.PinInfo
 	// Status returns the local status of a given Cid.
@@ -117,10 +173,30 @@ type PinTracker interface {
 	// Sync makes sure that the Cid status reflect the real IPFS status.
 	// It returns the local status of the Cid.
 	Sync(*cid.Cid) (api.PinInfo, error)
+	// Keepalive signals that an ongoing pin operation for a Cid is
+	// making progress, thus it is slow but not hung. The progress is
+	// reported in the PinInfo of the Cid.
+	Keepalive(api.PinProgress)
 	// Recover retriggers a Pin/Unpin operation in a Cids with error status.
 	Recover(*cid.Cid) (api.PinInfo, error)
 	// RecoverAll calls Recover() for all pins tracked.
 	RecoverAll() ([]api.PinInfo, error)
+	// RecoverInBackground queues the recovery of a Cid in error status
+	// along with other background maintenance operations, without
+	// waiting for it.
+	RecoverInBackground(*cid.Cid) error
+	// SetConcurrentPins changes how many pin and unpin requests are
+	// processed at the same time, without restarting.
+	SetConcurrentPins(int) error
+	// ConfigKey returns the key of the configuration section of the
+	// tracker (i.e. "maptracker"), which prefixes its runtime options.
+	ConfigKey() string
+	// Events delivers a PinEvent every time the status of an item
+	// changes in this tracker.
+	Events() <-chan api.PinEvent
+	// Metrics reports the internals of the tracker, like the length
+	// of its queues and how long pins take.
+	Metrics() api.TrackerMetrics
 }
 
 // Informer provides Metric information from a peer. The metrics produced by
@@ -144,8 +220,24 @@ type PinAllocator interface {
 	// least). The "current" map contains valid metrics for peers
 	// which are currently pinning the content. The candidates map
 	// contains the metrics for all peers which are eligible for pinning
-	// the content.
-	Allocate(c *cid.Cid, current, candidates map[peer.ID]api.Metric) ([]peer.ID, error)
+	// the content. The size is the cumulative size of the content in
+	// bytes, or 0 when it is unknown.
+	Allocate(c *cid.Cid, size uint64, current, candidates map[peer.ID]api.Metric) ([]peer.ID, error)
+}
+
+// AllocationFilter discards candidate peers for an allocation before they
+// are sorted by the PinAllocator. Filters are chained: each one receives
+// the candidates left by the previous one. This allows to express
+// allocation policies (i.e. minimum free space) independently from the
+// allocator.
+type AllocationFilter interface {
+	// MetricName returns the name of the metric the filter needs to
+	// take its decision. The last metrics with that name are fetched
+	// from the leading PeerMonitor and passed to Filter.
+	MetricName() string
+	// Filter returns the subset of candidates which are acceptable
+	// to allocate the given Cid, whose size is 0 when unknown.
+	Filter(c *cid.Cid, size uint64, candidates []peer.ID, metrics map[peer.ID]api.Metric) []peer.ID
 }
 
 // PeerMonitor is a component in charge of monitoring the peers in the cluster
@@ -158,6 +250,9 @@ type PeerMonitor interface {
 	// LastMetrics returns a map with the latest metrics of matching name
 	// for the current cluster peers.
 	LastMetrics(name string) []api.Metric
+	// MetricHistory returns all the metrics of matching name which are
+	// kept for the current cluster peers, newest first for each peer.
+	MetricHistory(name string) []api.Metric
 	// Alerts delivers alerts generated when this peer monitor detects
 	// a problem (i.e. metrics not arriving as expected). Alerts are used to
 	// trigger rebalancing operations.
@@ -118,7 +118,7 @@ func createComponents(t *testing.T, i int, clusterSecret []byte) (*Config, *raft
 }
 
 func createCluster(t *testing.T, clusterCfg *Config, consensusCfg *raft.Config, api API, ipfs IPFSConnector, state state.State, tracker PinTracker, mon PeerMonitor, alloc PinAllocator, inf Informer) *Cluster {
-	cl, err := NewCluster(clusterCfg, consensusCfg, api, ipfs, state, tracker, mon, alloc, inf)
+	cl, err := NewCluster(clusterCfg, consensusCfg, []API{api}, ipfs, state, tracker, mon, alloc, inf)
 	checkErr(t, err)
 	<-cl.Ready()
 	return cl
@@ -310,6 +310,56 @@ func TestClustersPeers(t *testing.T) {
 	}
 }
 
+func TestClustersConnectGraph(t *testing.T) {
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	delay()
+
+	j := rand.Intn(nClusters)
+	cg, err := clusters[j].ConnectGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cg.ClusterID != clusters[j].id {
+		t.Error("unexpected cluster ID")
+	}
+	if len(cg.ClusterLinks) != nClusters {
+		t.Fatal("expected links for every cluster peer")
+	}
+	for p, links := range cg.ClusterLinks {
+		if len(links) != nClusters-1 {
+			t.Errorf("%s should be linked to every other peer: %s", p.Pretty(), links)
+		}
+	}
+	if len(cg.ClustertoIPFS) != nClusters {
+		t.Error("expected the ipfs daemon of every cluster peer")
+	}
+	// all peers use the same ipfs mock
+	if len(cg.IPFSLinks[test.TestPeerID1]) != 2 {
+		t.Error("unexpected ipfs links:", cg.IPFSLinks)
+	}
+}
+
+func TestClustersPeersLiveness(t *testing.T) {
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	delay()
+
+	j := rand.Intn(nClusters)
+	lives, err := clusters[j].PeersLiveness()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lives) != nClusters {
+		t.Fatal("expected the liveness of every peer")
+	}
+	for _, l := range lives {
+		if l.Error != "" || l.RTT <= 0 {
+			t.Errorf("%s should be reachable: %+v", l.Peer.Pretty(), l)
+		}
+	}
+}
+
 func TestClustersPin(t *testing.T) {
 	clusters, mock := createClusters(t)
 	defer shutdownClusters(t, clusters, mock)
@@ -381,7 +431,7 @@ func TestClustersStatusAll(t *testing.T) {
 	delay()
 	// Global status
 	f := func(t *testing.T, c *Cluster) {
-		statuses, err := c.StatusAll()
+		statuses, err := c.StatusAll(nil)
 		if err != nil {
 			t.Error(err)
 		}
@@ -400,6 +450,14 @@ func TestClustersStatusAll(t *testing.T) {
 			t.Error("the hash should have been pinned")
 		}
 
+		errored, err := c.StatusAll(api.StatusFilter{api.TrackerStatusPinError})
+		if err != nil {
+			t.Error(err)
+		}
+		if len(errored) != 0 {
+			t.Error("no items should match the filter")
+		}
+
 		status, err := c.Status(h)
 		if err != nil {
 			t.Error(err)
@@ -417,6 +475,66 @@ func TestClustersStatusAll(t *testing.T) {
 	runF(t, clusters, f)
 }
 
+func TestClustersStatusAllChunk(t *testing.T) {
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	for _, c := range []string{test.TestCid1, test.TestCid2, test.TestCid3} {
+		h, _ := cid.Decode(c)
+		clusters[0].Pin(api.PinCid(h))
+	}
+	delay()
+
+	f := func(t *testing.T, c *Cluster) {
+		_, err := c.StatusAllChunk("", 0, nil)
+		if err == nil {
+			t.Error("expected an error with a 0 limit")
+		}
+
+		var walked []string
+		after := ""
+		for {
+			chunk, err := c.StatusAllChunk(after, 2, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunk) == 0 {
+				break
+			}
+			if len(chunk) > 2 {
+				t.Fatal("chunk bigger than the limit")
+			}
+			for _, gpi := range chunk {
+				if len(gpi.PeerMap) != nClusters {
+					t.Error("expected status from every peer")
+				}
+				walked = append(walked, gpi.Cid.String())
+			}
+			after = walked[len(walked)-1]
+		}
+
+		// items come sorted by Cid
+		expected := []string{test.TestCid2, test.TestCid3, test.TestCid1}
+		if len(walked) != len(expected) {
+			t.Fatalf("expected %d items and got %d", len(expected), len(walked))
+		}
+		for i := range expected {
+			if walked[i] != expected[i] {
+				t.Errorf("unexpected order: %v", walked)
+				break
+			}
+		}
+
+		local, err := c.StatusAllLocalChunk(test.TestCid2, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(local) != 2 || local[0].Cid.String() != test.TestCid3 {
+			t.Errorf("unexpected local chunk: %v", local)
+		}
+	}
+	runF(t, clusters, f)
+}
+
 func TestClustersStatusAllWithErrors(t *testing.T) {
 	clusters, mock := createClusters(t)
 	defer shutdownClusters(t, clusters, mock)
@@ -433,7 +551,7 @@ func TestClustersStatusAllWithErrors(t *testing.T) {
 			return
 		}
 
-		statuses, err := c.StatusAll()
+		statuses, err := c.StatusAll(nil)
 		if err != nil {
 			t.Error(err)
 		}
@@ -717,6 +835,37 @@ func TestClustersRecover(t *testing.T) {
 	}
 }
 
+func TestClustersRecoverAll(t *testing.T) {
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	h, _ := cid.Decode(test.ErrorCid) // This cid always fails
+	h2, _ := cid.Decode(test.TestCid2)
+	clusters[0].Pin(api.PinCid(h))
+	clusters[0].Pin(api.PinCid(h2))
+
+	delay()
+
+	j := rand.Intn(nClusters)
+	ginfos, err := clusters[j].RecoverAll(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the item in error is recovered, in every peer
+	if len(ginfos) != 1 || ginfos[0].Cid.String() != test.ErrorCid {
+		t.Fatalf("expected only %s to be recovered: %+v", test.ErrorCid, ginfos)
+	}
+	for _, c := range clusters {
+		inf, ok := ginfos[0].PeerMap[c.host.ID()]
+		if !ok {
+			t.Fatal("GlobalPinInfo should have this cluster")
+		}
+		if inf.Status != api.TrackerStatusPinError {
+			t.Errorf("%s should still be in error: %s", h, inf.Status)
+		}
+	}
+}
+
 func TestClustersShutdown(t *testing.T) {
 	clusters, mock := createClusters(t)
 	defer shutdownClusters(t, clusters, mock)
@@ -926,6 +1075,47 @@ func TestClustersReplicationRealloc(t *testing.T) {
 	}
 }
 
+// In this test we lower the replication factor of a pin and check that
+// the remaining allocations are a subset of the previous ones.
+func TestClustersReplicationFactorLowered(t *testing.T) {
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	for _, c := range clusters {
+		c.config.ReplicationFactor = nClusters - 1
+	}
+
+	j := rand.Intn(nClusters)
+	h, _ := cid.Decode(test.TestCid1)
+	err := clusters[j].Pin(api.PinCid(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second / 2)
+
+	pin := clusters[j].Pins()[0]
+	if len(pin.Allocations) != nClusters-1 {
+		t.Fatal("pin should be allocated to nClusters - 1 peers")
+	}
+
+	pin2 := api.PinCid(h)
+	pin2.ReplicationFactor = 1
+	err = clusters[j].Pin(pin2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second / 2)
+
+	pin3 := clusters[j].Pins()[0]
+	if len(pin3.Allocations) != 1 {
+		t.Fatalf("expected 1 allocation but got %d", len(pin3.Allocations))
+	}
+	if !containsPeer(pin.Allocations, pin3.Allocations[0]) {
+		t.Error("the remaining allocation should be one of the previous ones")
+	}
+}
+
 // In this test we try to pin something when there are not
 // as many available peers a we need. It's like before, except
 // more peers are killed.
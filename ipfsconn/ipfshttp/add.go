@@ -0,0 +1,172 @@
+package ipfshttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// addSessionTimeout is how long an add session waits for its next chunk
+// before it is cancelled.
+var addSessionTimeout = 5 * time.Minute
+
+// errAddSessionTimeout is the error of add sessions which stopped
+// receiving chunks.
+var errAddSessionTimeout = errors.New("add session timed out waiting for the next chunk")
+
+// addSession is an ongoing add request to the IPFS daemon, whose body is
+// fed in chunks through a pipe. It is cancelled when no chunks arrive for
+// addSessionTimeout.
+type addSession struct {
+	pw    *io.PipeWriter
+	done  chan struct{}
+	timer *time.Timer
+	out   []api.AddedOutput
+	err   error
+}
+
+// Add feeds a chunk of the multipart body of an add request to the IPFS
+// daemon. The first chunk for a session starts the request and the last
+// one waits for it to finish and returns the added items. The content is
+// not pinned: cluster pins it afterwards.
+func (ipfs *Connector) Add(chunk api.AddChunk) ([]api.AddedOutput, error) {
+	if chunk.Session == "" {
+		return nil, errors.New("add session is not set")
+	}
+
+	ipfs.addsMux.Lock()
+	sess, ok := ipfs.adds[chunk.Session]
+	if !ok {
+		if chunk.Cancel {
+			ipfs.addsMux.Unlock()
+			return nil, nil
+		}
+		sess = ipfs.startAdd(chunk)
+		ipfs.adds[chunk.Session] = sess
+	}
+	ipfs.addsMux.Unlock()
+
+	// chunks are not expected while this one is being written
+	if !sess.timer.Stop() {
+		// the session timed out already
+		return ipfs.finishAdd(chunk.Session, sess)
+	}
+	finish := func() ([]api.AddedOutput, error) {
+		return ipfs.finishAdd(chunk.Session, sess)
+	}
+
+	if chunk.Cancel {
+		sess.pw.CloseWithError(errors.New("add request cancelled"))
+		finish()
+		return nil, nil
+	}
+
+	if len(chunk.Data) > 0 {
+		if _, err := sess.pw.Write(chunk.Data); err != nil {
+			// the request has failed: return its error.
+			sess.pw.CloseWithError(err)
+			return finish()
+		}
+	}
+
+	if !chunk.Last {
+		sess.timer.Reset(addSessionTimeout)
+		return nil, nil
+	}
+	sess.pw.Close()
+	return finish()
+}
+
+// finishAdd waits for the add request of a session to end and forgets
+// the session.
+func (ipfs *Connector) finishAdd(session string, sess *addSession) ([]api.AddedOutput, error) {
+	<-sess.done
+	ipfs.addsMux.Lock()
+	if ipfs.adds[session] == sess {
+		delete(ipfs.adds, session)
+	}
+	ipfs.addsMux.Unlock()
+	return sess.out, sess.err
+}
+
+// startAdd launches the add request for a new session. It runs until the
+// body is closed.
+func (ipfs *Connector) startAdd(chunk api.AddChunk) *addSession {
+	pr, pw := io.Pipe()
+	sess := &addSession{
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+	timeout := addSessionTimeout
+	sess.timer = time.AfterFunc(timeout, func() {
+		logger.Warningf("add session %s timed out", chunk.Session)
+		pw.CloseWithError(errAddSessionTimeout)
+		// the session is kept for a while, so that late chunks get
+		// its error instead of starting a new session.
+		time.AfterFunc(timeout, func() {
+			ipfs.finishAdd(chunk.Session, sess)
+		})
+	})
+
+	q := url.Values{}
+	q.Set("pin", "false")
+	q.Set("progress", "false")
+	q.Set("stream-channels", "true")
+	if c := chunk.Params.Chunker; c != "" {
+		q.Set("chunker", c)
+	}
+	q.Set("raw-leaves", strconv.FormatBool(chunk.Params.RawLeaves))
+	q.Set("wrap-with-directory", strconv.FormatBool(chunk.Params.WrapWithDirectory))
+
+	go func() {
+		defer close(sess.done)
+		body, err := ipfs.postCtx(ipfs.ctx, "add?"+q.Encode(), chunk.ContentType, pr)
+		// unblock any writers if the request ended early
+		pr.CloseWithError(err)
+		if err != nil {
+			sess.err = err
+			return
+		}
+		sess.out, sess.err = decodeAddOutput(body)
+	}()
+	return sess
+}
+
+// decodeAddOutput parses the objects returned by the IPFS add endpoint,
+// one for every added item.
+func decodeAddOutput(body []byte) ([]api.AddedOutput, error) {
+	var out []api.AddedOutput
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for dec.More() {
+		var addResp ipfsAddResp
+		if err := dec.Decode(&addResp); err != nil {
+			return nil, err
+		}
+		if addResp.Hash == "" { // progress
+			continue
+		}
+		c, err := cid.Decode(addResp.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("bad cid in add response: %s", err)
+		}
+		size, _ := strconv.ParseUint(addResp.Size, 10, 64)
+		out = append(out, api.AddedOutput{
+			Name: addResp.Name,
+			Cid:  c,
+			Size: size,
+		})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("nothing was added")
+	}
+	return out, nil
+}
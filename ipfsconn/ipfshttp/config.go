@@ -22,6 +22,7 @@ const (
 	DefaultProxyReadHeaderTimeout = 5 * time.Second
 	DefaultProxyWriteTimeout      = 10 * time.Minute
 	DefaultProxyIdleTimeout       = 60 * time.Second
+	DefaultPinKeepaliveInterval   = 30 * time.Second
 )
 
 // Config is used to initialize a Connector and allows to customize
@@ -52,6 +53,18 @@ type Config struct {
 	// Server-side amount of time a Keep-Alive connection will be
 	// kept idle before being reused
 	ProxyIdleTimeout time.Duration
+
+	// PinKeepaliveInterval is the minimum time between two keepalives
+	// sent to the pin tracker while IPFS reports progress on a pin
+	// request. Keepalives tell the tracker that the pin is slow but
+	// alive, and how far it has got.
+	PinKeepaliveInterval time.Duration
+
+	// ProxyReadOnly makes the IPFS Proxy reject the requests to every
+	// IPFS API endpoint which may change anything, like pin/add,
+	// pin/rm or add. Only those which read content or information
+	// from the IPFS daemon are served.
+	ProxyReadOnly bool
 }
 
 type jsonConfig struct {
@@ -62,6 +75,8 @@ type jsonConfig struct {
 	ProxyReadHeaderTimeout  string `json:"proxy_read_header_timeout"`
 	ProxyWriteTimeout       string `json:"proxy_write_timeout"`
 	ProxyIdleTimeout        string `json:"proxy_idle_timeout"`
+	PinKeepaliveInterval    string `json:"pin_keepalive_interval"`
+	ProxyReadOnly           bool   `json:"proxy_read_only,omitempty"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -80,6 +95,8 @@ func (cfg *Config) Default() error {
 	cfg.ProxyReadHeaderTimeout = DefaultProxyReadHeaderTimeout
 	cfg.ProxyWriteTimeout = DefaultProxyWriteTimeout
 	cfg.ProxyIdleTimeout = DefaultProxyIdleTimeout
+	cfg.PinKeepaliveInterval = DefaultPinKeepaliveInterval
+	cfg.ProxyReadOnly = false
 
 	return nil
 }
@@ -113,6 +130,10 @@ func (cfg *Config) Validate() error {
 	if cfg.ProxyIdleTimeout <= 0 {
 		return errors.New("ipfshttp.proxy_idle_timeout invalid")
 	}
+
+	if cfg.PinKeepaliveInterval <= 0 {
+		return errors.New("ipfshttp.pin_keepalive_interval invalid")
+	}
 	return nil
 }
 
@@ -153,6 +174,13 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	t, _ = time.ParseDuration(jcfg.ConnectSwarmsDelay)
 	cfg.ConnectSwarmsDelay = t
 
+	// older configurations do not have this key
+	cfg.PinKeepaliveInterval = DefaultPinKeepaliveInterval
+	t, _ = time.ParseDuration(jcfg.PinKeepaliveInterval)
+	config.SetIfNotDefault(t, &cfg.PinKeepaliveInterval)
+
+	cfg.ProxyReadOnly = jcfg.ProxyReadOnly
+
 	return cfg.Validate()
 }
 
@@ -175,6 +203,8 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 	jcfg.ProxyWriteTimeout = cfg.ProxyWriteTimeout.String()
 	jcfg.ProxyIdleTimeout = cfg.ProxyIdleTimeout.String()
 	jcfg.ConnectSwarmsDelay = cfg.ConnectSwarmsDelay.String()
+	jcfg.PinKeepaliveInterval = cfg.PinKeepaliveInterval.String()
+	jcfg.ProxyReadOnly = cfg.ProxyReadOnly
 
 	raw, err = config.DefaultJSONMarshal(jcfg)
 	return
@@ -3,6 +3,7 @@ package ipfshttp
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 var cfgJSON = []byte(`
@@ -50,6 +51,29 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error in proxy_read_timeout")
 	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.PinKeepaliveInterval = "1s"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || cfg.PinKeepaliveInterval != time.Second {
+		t.Error("expected pin_keepalive_interval to be 1s")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.ProxyReadOnly = true
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || !cfg.ProxyReadOnly {
+		t.Error("expected proxy_read_only to be loaded")
+	}
+
+	err = cfg.LoadJSON(cfgJSON)
+	if err != nil || cfg.PinKeepaliveInterval != DefaultPinKeepaliveInterval {
+		t.Error("expected default pin_keepalive_interval")
+	}
 }
 
 func TestToJSON(t *testing.T) {
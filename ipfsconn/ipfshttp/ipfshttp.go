@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
@@ -30,6 +31,16 @@ import (
 
 var logger = logging.Logger("ipfshttp")
 
+// blockGetTimeout bounds BlockGet requests.
+var blockGetTimeout = 10 * time.Second
+
+// objectStatTimeout bounds ObjectSize requests.
+var objectStatTimeout = 5 * time.Second
+
+// resolveTimeout bounds Resolve requests, which may need to look up IPNS
+// records in the network.
+var resolveTimeout = 30 * time.Second
+
 // Connector implements the IPFSConnector interface
 // and provides a component which does two tasks:
 //
@@ -51,6 +62,14 @@ type Connector struct {
 	rpcClient *rpc.Client
 	rpcReady  chan struct{}
 
+	// ongoing pin and unpin requests by Cid, so they can be cancelled
+	reqsMux sync.Mutex
+	reqs    map[string]*request
+
+	// ongoing add requests by session
+	addsMux sync.Mutex
+	adds    map[string]*addSession
+
 	listener net.Listener
 	server   *http.Server
 
@@ -59,6 +78,11 @@ type Connector struct {
 	wg           sync.WaitGroup
 }
 
+// request is an ongoing pin or unpin request against the IPFS daemon.
+type request struct {
+	cancel func()
+}
+
 type ipfsError struct {
 	Message string
 }
@@ -75,6 +99,13 @@ type ipfsPinOpResp struct {
 	Pins []string
 }
 
+// ipfsPinProgressResp is each of the objects streamed by
+// pin/add?progress=true. The last one carries the Pins.
+type ipfsPinProgressResp struct {
+	Pins     []string
+	Progress int
+}
+
 type ipfsIDResp struct {
 	ID        string
 	Addresses []string
@@ -86,10 +117,41 @@ type ipfsRepoStatResp struct {
 	NumObjects uint64
 }
 
+type ipfsBandwidthStatsResp struct {
+	TotalIn  uint64
+	TotalOut uint64
+	RateIn   float64
+	RateOut  float64
+}
+
+type ipfsBlockPutResp struct {
+	Key  string
+	Size int
+}
+
+type ipfsObjectStatResp struct {
+	Hash           string
+	CumulativeSize uint64
+}
+
+type ipfsResolveResp struct {
+	Path string
+}
+
+type ipfsSwarmPeersResp struct {
+	Peers []ipfsPeer
+}
+
+type ipfsPeer struct {
+	Addr string
+	Peer string
+}
+
 type ipfsAddResp struct {
 	Name  string
 	Hash  string
 	Bytes uint64
+	Size  string
 }
 
 // NewConnector creates the component and leaves it ready to be started
@@ -133,6 +195,8 @@ func NewConnector(cfg *Config) (*Connector, error) {
 		nodeAddr: nodeAddr,
 		handlers: make(map[string]func(http.ResponseWriter, *http.Request)),
 		rpcReady: make(chan struct{}, 1),
+		reqs:     make(map[string]*request),
+		adds:     make(map[string]*addSession),
 		listener: l,
 		server:   s,
 	}
@@ -184,9 +248,48 @@ func (ipfs *Connector) run() {
 	}()
 }
 
+// readOnlyProxyPaths are the IPFS API endpoints served by the proxy in
+// read-only mode. They only read content or information from the IPFS
+// daemon.
+var readOnlyProxyPaths = map[string]bool{
+	"/api/v0/block/get":    true,
+	"/api/v0/block/stat":   true,
+	"/api/v0/cat":          true,
+	"/api/v0/commands":     true,
+	"/api/v0/dag/get":      true,
+	"/api/v0/dag/resolve":  true,
+	"/api/v0/dns":          true,
+	"/api/v0/file/ls":      true,
+	"/api/v0/get":          true,
+	"/api/v0/id":           true,
+	"/api/v0/ls":           true,
+	"/api/v0/name/resolve": true,
+	"/api/v0/object/data":  true,
+	"/api/v0/object/get":   true,
+	"/api/v0/object/links": true,
+	"/api/v0/object/stat":  true,
+	"/api/v0/pin/ls":       true,
+	"/api/v0/refs":         true,
+	"/api/v0/repo/stat":    true,
+	"/api/v0/resolve":      true,
+	"/api/v0/stats/bw":     true,
+	"/api/v0/stats/repo":   true,
+	"/api/v0/swarm/peers":  true,
+	"/api/v0/version":      true,
+}
+
 // This will run a custom handler if we have one for a URL.Path, or
-// otherwise just proxy the requests.
+// otherwise just proxy the requests. In read-only mode, only the
+// readOnlyProxyPaths are served.
 func (ipfs *Connector) handle(w http.ResponseWriter, r *http.Request) {
+	if ipfs.config.ProxyReadOnly && !readOnlyProxyPaths[r.URL.Path] {
+		res := ipfsError{fmt.Sprintf("%s is not allowed: the proxy is in read-only mode", r.URL.Path)}
+		resBytes, _ := json.Marshal(res)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(resBytes)
+		return
+	}
 	if customHandler, ok := ipfs.handlers[r.URL.Path]; ok {
 		customHandler(w, r)
 	} else {
@@ -195,6 +298,35 @@ func (ipfs *Connector) handle(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// hopHeaders are the headers which only apply to a single connection.
+// They are not forwarded by the proxy.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// copyHeaders adds the headers in src to dst, except the hop-by-hop ones.
+func copyHeaders(dst, src http.Header) {
+	for k, v := range src {
+		for _, s := range v {
+			dst.Add(k, s)
+		}
+	}
+	for _, h := range hopHeaders {
+		dst.Del(h)
+	}
+}
+
+// proxyRequest forwards a request to the IPFS daemon. It is abandoned
+// when the client goes away, which ends the streams of endpoints like
+// log/tail or pubsub/sub.
 func (ipfs *Connector) proxyRequest(r *http.Request) (*http.Response, error) {
 	newURL := *r.URL
 	newURL.Host = ipfs.nodeAddr
@@ -205,12 +337,9 @@ func (ipfs *Connector) proxyRequest(r *http.Request) (*http.Response, error) {
 		logger.Error("error creating proxy request: ", err)
 		return nil, err
 	}
-
-	for k, v := range r.Header {
-		for _, s := range v {
-			proxyReq.Header.Add(k, s)
-		}
-	}
+	proxyReq = proxyReq.WithContext(r.Context())
+	proxyReq.ContentLength = r.ContentLength
+	copyHeaders(proxyReq.Header, r.Header)
 
 	res, err := http.DefaultTransport.RoundTrip(proxyReq)
 	if err != nil {
@@ -222,18 +351,48 @@ func (ipfs *Connector) proxyRequest(r *http.Request) (*http.Response, error) {
 
 // Writes a response to a ResponseWriter using the given body
 // (which maybe resp.Body or a copy if it was already used).
+// The body is flushed as it is read, so that streaming endpoints
+// (X-Chunked-Output) work, and the trailers of the response (like
+// X-Stream-Error) are sent after it.
 func (ipfs *Connector) proxyResponse(w http.ResponseWriter, res *http.Response, body io.Reader) {
 	// Set response headers
-	for k, v := range res.Header {
-		for _, s := range v {
-			w.Header().Add(k, s)
-		}
+	copyHeaders(w.Header(), res.Header)
+	for k := range res.Trailer {
+		w.Header().Add("Trailer", k)
 	}
 
 	w.WriteHeader(res.StatusCode)
 
 	// And copy body
-	io.Copy(w, body)
+	copyFlushing(w, body)
+
+	for k, v := range res.Trailer {
+		for _, s := range v {
+			w.Header().Add(k, s)
+		}
+	}
+}
+
+// copyFlushing copies src to w, flushing it after every read.
+func copyFlushing(w http.ResponseWriter, src io.Reader) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		io.Copy(w, src)
+		return
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
 }
 
 // defaultHandler just proxies the requests.
@@ -256,34 +415,64 @@ func ipfsErrorResponder(w http.ResponseWriter, errMsg string) {
 	return
 }
 
+// resolveArg parses the "arg" of a pin request, which may be a CID or an
+// IPFS or IPNS path, like the ipfs daemon does.
+func (ipfs *Connector) resolveArg(arg string) (*cid.Cid, error) {
+	if strings.HasPrefix(arg, "/") {
+		c, err := ipfs.Resolve(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Error resolving path '%s': %s", arg, err)
+		}
+		return c, nil
+	}
+	c, err := cid.Decode(arg)
+	if err != nil {
+		return nil, errors.New("Error parsing CID: " + err.Error())
+	}
+	return c, nil
+}
+
+// pinOpHandler pins or unpins in cluster every item given in the "arg"
+// parameters. Cluster pins are always recursive, so non-recursive
+// requests are rejected.
 func (ipfs *Connector) pinOpHandler(op string, w http.ResponseWriter, r *http.Request) {
-	argA := r.URL.Query()["arg"]
+	q := r.URL.Query()
+	argA := q["arg"]
 	if len(argA) == 0 {
 		ipfsErrorResponder(w, "Error: bad argument")
 		return
 	}
-	arg := argA[0]
-	_, err := cid.Decode(arg)
-	if err != nil {
-		ipfsErrorResponder(w, "Error parsing CID: "+err.Error())
+	if q.Get("recursive") == "false" {
+		ipfsErrorResponder(w, "Error: cluster only supports recursive pins")
 		return
 	}
 
-	err = ipfs.rpcClient.Call("",
-		"Cluster",
-		op,
-		api.PinSerial{
-			Cid: arg,
-		},
-		&struct{}{})
+	pins := make([]string, 0, len(argA))
+	for _, arg := range argA {
+		c, err := ipfs.resolveArg(arg)
+		if err != nil {
+			ipfsErrorResponder(w, err.Error())
+			return
+		}
+		pins = append(pins, c.String())
+	}
 
-	if err != nil {
-		ipfsErrorResponder(w, err.Error())
-		return
+	for _, pin := range pins {
+		err := ipfs.rpcClient.Call("",
+			"Cluster",
+			op,
+			api.PinSerial{
+				Cid: pin,
+			},
+			&struct{}{})
+		if err != nil {
+			ipfsErrorResponder(w, err.Error())
+			return
+		}
 	}
 
 	res := ipfsPinOpResp{
-		Pins: []string{arg},
+		Pins: pins,
 	}
 	resBytes, _ := json.Marshal(res)
 	w.Header().Add("Content-Type", "application/json")
@@ -300,34 +489,51 @@ func (ipfs *Connector) unpinHandler(w http.ResponseWriter, r *http.Request) {
 	ipfs.pinOpHandler("Unpin", w, r)
 }
 
+// pinLsHandler lists the cluster pins, which are recursive, or the given
+// ones. Cluster has no direct pins. Indirect pins are only known by the
+// ipfs daemon, so these requests are forwarded to it.
 func (ipfs *Connector) pinLsHandler(w http.ResponseWriter, r *http.Request) {
 	pinLs := ipfsPinLsResp{}
 	pinLs.Keys = make(map[string]ipfsPinType)
 
 	q := r.URL.Query()
-	arg := q.Get("arg")
-	if arg != "" {
-		c, err := cid.Decode(arg)
-		if err != nil {
-			ipfsErrorResponder(w, err.Error())
-			return
-		}
-		var pin api.PinSerial
-		err = ipfs.rpcClient.Call("",
-			"Cluster",
-			"PinGet",
-			api.PinCid(c).ToSerial(),
-			&pin)
-		if err != nil {
-			ipfsErrorResponder(w, fmt.Sprintf(
-				"Error: path '%s' is not pinned",
-				arg))
-			return
-		}
-		pinLs.Keys[pin.Cid] = ipfsPinType{
-			Type: "recursive",
+	typ := q.Get("type")
+	switch typ {
+	case "", "all", "recursive", "direct":
+	case "indirect":
+		ipfs.defaultHandler(w, r)
+		return
+	default:
+		ipfsErrorResponder(w, fmt.Sprintf(
+			"Invalid type '%s', must be one of {direct, indirect, recursive, all}",
+			typ))
+		return
+	}
+
+	if args := q["arg"]; len(args) > 0 {
+		for _, arg := range args {
+			c, err := ipfs.resolveArg(arg)
+			if err != nil {
+				ipfsErrorResponder(w, err.Error())
+				return
+			}
+			var pin api.PinSerial
+			err = ipfs.rpcClient.Call("",
+				"Cluster",
+				"PinGet",
+				api.PinCid(c).ToSerial(),
+				&pin)
+			if err != nil || typ == "direct" {
+				ipfsErrorResponder(w, fmt.Sprintf(
+					"Error: path '%s' is not pinned",
+					arg))
+				return
+			}
+			pinLs.Keys[pin.Cid] = ipfsPinType{
+				Type: "recursive",
+			}
 		}
-	} else {
+	} else if typ != "direct" {
 		var pins []api.PinSerial
 		err := ipfs.rpcClient.Call("",
 			"Cluster",
@@ -353,11 +559,22 @@ func (ipfs *Connector) pinLsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(resBytes)
 }
 
+// streamErrorHeader is the trailer with which the ipfs daemon reports
+// the errors which happen after a streamed response has started.
+const streamErrorHeader = "X-Stream-Error"
+
+// addHandler adds the content to the local ipfs daemon without pinning it
+// there, and pins the added items in cluster with the default
+// replication factor, named after the added files. The output of the
+// daemon, including progress, is streamed to the client as it arrives, so
+// errors pinning the items are reported in the X-Stream-Error trailer,
+// like the ipfs daemon does.
 func (ipfs *Connector) addHandler(w http.ResponseWriter, r *http.Request) {
 	// Handle some request options
 	q := r.URL.Query()
-	// Remember if the user does not want cluster/ipfs to pin
-	doNotPin := q.Get("pin") == "false"
+	// Remember if the user does not want cluster/ipfs to pin, or
+	// nothing is actually added.
+	doNotPin := q.Get("pin") == "false" || q.Get("only-hash") == "true"
 	// make sure the local peer does not pin.
 	// Cluster will decide where to pin based on metrics and current
 	// allocations.
@@ -379,40 +596,62 @@ func (ipfs *Connector) addHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if doNotPin {
-		logger.Debug("proxy /add requests has pin==false")
+		logger.Debug("proxy /add requests has pin==false or only-hash==true")
 		ipfs.proxyResponse(w, res, res.Body)
 		return
 	}
 
+	copyHeaders(w.Header(), res.Header)
+	// The body is re-encoded and the trailers need a chunked response,
+	// so the length given by the daemon does not apply.
+	w.Header().Del("Content-Length")
+	w.Header().Add("Trailer", streamErrorHeader)
+	w.WriteHeader(res.StatusCode)
+	flusher, _ := w.(http.Flusher)
+	streamError := func(msg string) {
+		logger.Error(msg)
+		w.Header().Set(streamErrorHeader, msg)
+	}
+
 	// The ipfs-add response is a streaming-like body where
 	// { "Name" : "filename", "Hash": "cid" } objects are provided
-	// for every added object.
-
-	// We will need to re-read the response in order to re-play it to
-	// the client at the end, therefore we make a copy in bodyCopy
-	// while decoding.
-	bodyCopy := new(bytes.Buffer)
-	bodyReader := io.TeeReader(res.Body, bodyCopy)
-
+	// for every added object, mixed with progress notifications.
+	// They are sent to the client untouched as they are decoded.
 	ipfsAddResps := []ipfsAddResp{}
-	dec := json.NewDecoder(bodyReader)
+	dec := json.NewDecoder(res.Body)
 	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			streamError("error decoding response: " + err.Error())
+			return
+		}
+		w.Write(raw)
+		w.Write([]byte("\n"))
+		if flusher != nil {
+			flusher.Flush()
+		}
+
 		var addResp ipfsAddResp
-		err := dec.Decode(&addResp)
-		if err != nil {
-			http.Error(w, "error decoding response: "+err.Error(), 502)
+		if err := json.Unmarshal(raw, &addResp); err != nil {
+			streamError("error decoding response: " + err.Error())
 			return
 		}
-		if addResp.Bytes != 0 {
+		if addResp.Bytes != 0 || addResp.Hash == "" {
 			// This is a progress notification, so we ignore it
 			continue
 		}
 		ipfsAddResps = append(ipfsAddResps, addResp)
 	}
 
+	// The body has been read, so the trailers are available. Nothing
+	// is pinned when the daemon failed to add everything.
+	if msg := res.Trailer.Get(streamErrorHeader); msg != "" {
+		w.Header().Set(streamErrorHeader, msg)
+		return
+	}
+
 	if len(ipfsAddResps) == 0 {
 		logger.Warning("proxy /add request response was OK but empty")
-		ipfs.proxyResponse(w, res, bodyCopy)
 		return
 	}
 
@@ -426,7 +665,11 @@ func (ipfs *Connector) addHandler(w http.ResponseWriter, r *http.Request) {
 	// decideRecursivePins() takes a conservative approach. It
 	// works on the regular use-cases. Otherwise, it might pin
 	// more things than it should.
-	pinHashes := decideRecursivePins(ipfsAddResps, r.URL.Query())
+	pinHashes := decideRecursivePins(ipfsAddResps, q)
+	names := make(map[string]string)
+	for _, add := range ipfsAddResps {
+		names[add.Hash] = add.Name
+	}
 
 	logger.Debugf("proxy /add request and will pin %s", pinHashes)
 	for _, pin := range pinHashes {
@@ -434,7 +677,8 @@ func (ipfs *Connector) addHandler(w http.ResponseWriter, r *http.Request) {
 			"Cluster",
 			"Pin",
 			api.PinSerial{
-				Cid: pin,
+				Cid:  pin,
+				Name: names[pin],
 			},
 			&struct{}{})
 		if err != nil {
@@ -443,13 +687,10 @@ func (ipfs *Connector) addHandler(w http.ResponseWriter, r *http.Request) {
 			msg := "add operation was successful but "
 			msg += "an error occurred performing the cluster "
 			msg += "pin operation: " + err.Error()
-			logger.Error(msg)
-			http.Error(w, msg, 500)
+			streamError(msg)
 			return
 		}
 	}
-	// Finally, send the original response back
-	ipfs.proxyResponse(w, res, bodyCopy)
 }
 
 // decideRecursivePins takes the answers from ipfsAddResp and
@@ -462,9 +703,8 @@ func (ipfs *Connector) addHandler(w http.ResponseWriter, r *http.Request) {
 // It should work well for regular usecases: pin 1 file,
 // pin 1 directory, pin several files.
 func decideRecursivePins(added []ipfsAddResp, q url.Values) []string {
-	// When wrap-in-directory, return last element only.
-	_, ok := q["wrap-in-directory"]
-	if ok && q.Get("wrap-in-directory") == "true" {
+	// When wrap-with-directory, return last element only.
+	if q.Get("wrap-with-directory") == "true" {
 		return []string{
 			added[len(added)-1].Hash,
 		}
@@ -591,8 +831,9 @@ func (ipfs *Connector) Pin(hash *cid.Cid) error {
 		return err
 	}
 	if !pinStatus.IsPinned() {
-		path := fmt.Sprintf("pin/add?arg=%s", hash)
-		_, err = ipfs.post(path)
+		ctx, done := ipfs.startRequest(hash)
+		defer done()
+		err = ipfs.pinWithProgress(ctx, hash)
 		if err == nil {
 			logger.Info("IPFS Pin request succeeded: ", hash)
 		}
@@ -602,6 +843,74 @@ func (ipfs *Connector) Pin(hash *cid.Cid) error {
 	return nil
 }
 
+// pinWithProgress performs a pin/add request asking IPFS to report
+// progress while it fetches the DAG. Progress is forwarded to the pin
+// tracker as keepalives, at most once every PinKeepaliveInterval, along
+// with the total size of the DAG when "object stat" can provide it.
+func (ipfs *Connector) pinWithProgress(ctx context.Context, hash *cid.Cid) error {
+	res, err := ipfs.postStream(ctx, fmt.Sprintf("pin/add?arg=%s&progress=true", hash))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// The size is only informative, so it is fetched on the side and
+	// sent with the keepalives once it is available.
+	sizeCh := make(chan uint64, 1)
+	go func() {
+		size, err := ipfs.ObjectSize(hash)
+		if err != nil {
+			logger.Debugf("cannot get the size of %s: %s", hash, err)
+		}
+		sizeCh <- size
+	}()
+
+	progress := api.PinProgress{Cid: hash}
+	var lastKeepalive time.Time
+	dec := json.NewDecoder(res.Body)
+	for {
+		var resp ipfsPinProgressResp
+		err := dec.Decode(&resp)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Errorf("error reading pin progress: %s", err)
+			return err
+		}
+		select {
+		case progress.Size = <-sizeCh:
+		default:
+		}
+		if resp.Progress > 0 && time.Since(lastKeepalive) >= ipfs.config.PinKeepaliveInterval {
+			lastKeepalive = time.Now()
+			progress.Blocks = resp.Progress
+			ipfs.pinKeepalive(progress)
+		}
+	}
+
+	// errors happening once the response has started
+	// are sent in a trailer
+	if streamErr := res.Trailer.Get("X-Stream-Error"); streamErr != "" {
+		return fmt.Errorf("IPFS unsuccessful: %s", streamErr)
+	}
+	return nil
+}
+
+// pinKeepalive tells the pin tracker that the pin operation for a Cid is
+// making progress.
+func (ipfs *Connector) pinKeepalive(pp api.PinProgress) {
+	logger.Debugf("pin progress for %s: %d blocks", pp.Cid, pp.Blocks)
+	err := ipfs.rpcClient.Call("",
+		"Cluster",
+		"TrackerKeepalive",
+		pp.ToSerial(),
+		&struct{}{})
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
 // Unpin performs an unpin request against the configured IPFS
 // daemon.
 func (ipfs *Connector) Unpin(hash *cid.Cid) error {
@@ -610,8 +919,10 @@ func (ipfs *Connector) Unpin(hash *cid.Cid) error {
 		return err
 	}
 	if pinStatus.IsPinned() {
+		ctx, done := ipfs.startRequest(hash)
+		defer done()
 		path := fmt.Sprintf("pin/rm?arg=%s", hash)
-		_, err := ipfs.post(path)
+		_, err := ipfs.postCtx(ctx, path, "", nil)
 		if err == nil {
 			logger.Info("IPFS Unpin request succeeded:", hash)
 		}
@@ -622,35 +933,133 @@ func (ipfs *Connector) Unpin(hash *cid.Cid) error {
 	return nil
 }
 
+// startRequest registers an ongoing pin or unpin request for the given
+// Cid. The returned context is cancelled by Cancel() or on shutdown. The
+// returned function must be called when the request finishes.
+func (ipfs *Connector) startRequest(hash *cid.Cid) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ipfs.ctx)
+	req := &request{cancel: cancel}
+
+	ipfs.reqsMux.Lock()
+	ipfs.reqs[hash.String()] = req
+	ipfs.reqsMux.Unlock()
+
+	return ctx, func() {
+		cancel()
+		ipfs.reqsMux.Lock()
+		if ipfs.reqs[hash.String()] == req {
+			delete(ipfs.reqs, hash.String())
+		}
+		ipfs.reqsMux.Unlock()
+	}
+}
+
+// Cancel aborts the ongoing pin or unpin request for the given Cid, if
+// any. The aborted request returns an error.
+func (ipfs *Connector) Cancel(hash *cid.Cid) error {
+	ipfs.reqsMux.Lock()
+	defer ipfs.reqsMux.Unlock()
+	req, ok := ipfs.reqs[hash.String()]
+	if !ok {
+		logger.Debugf("no ongoing request for %s", hash)
+		return nil
+	}
+	logger.Infof("cancelling IPFS request for %s", hash)
+	req.cancel()
+	delete(ipfs.reqs, hash.String())
+	return nil
+}
+
 // PinLs performs a "pin ls --type typeFilter" request against the configured
 // IPFS daemon and returns a map of cid strings and their status.
+//
+// The response is decoded as it is read, so that very large pinsets are
+// not held in memory twice.
 func (ipfs *Connector) PinLs(typeFilter string) (map[string]api.IPFSPinStatus, error) {
-	body, err := ipfs.post("pin/ls?type=" + typeFilter)
+	res, err := ipfs.postStream(ipfs.ctx, "pin/ls?type="+typeFilter)
 
 	// Some error talking to the daemon
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
-	var res ipfsPinLsResp
-	err = json.Unmarshal(body, &res)
+	statusMap := make(map[string]api.IPFSPinStatus)
+	err = decodePinLs(res.Body, func(k string, ips api.IPFSPinStatus) {
+		statusMap[k] = ips
+	})
 	if err != nil {
-		logger.Error("parsing pin/ls response")
-		logger.Error(string(body))
+		logger.Error("parsing pin/ls response:", err)
 		return nil, err
 	}
+	return statusMap, nil
+}
 
-	statusMap := make(map[string]api.IPFSPinStatus)
-	for k, v := range res.Keys {
-		statusMap[k] = api.IPFSPinStatusFromString(v.Type)
+// decodePinLs reads a pin/ls response ({"Keys": {"<cid>": {"Type": "<type>"}}})
+// calling fn for every pin in it, one at a time.
+func decodePinLs(r io.Reader, fn func(string, api.IPFSPinStatus)) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
 	}
-	return statusMap, nil
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key, _ := tok.(string); key != "Keys" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil { // "Keys": null
+			continue
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '{' {
+			return fmt.Errorf("unexpected %v in pin/ls keys", tok)
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			k, _ := tok.(string)
+			var pinType ipfsPinType
+			if err := dec.Decode(&pinType); err != nil {
+				return err
+			}
+			fn(k, api.IPFSPinStatusFromString(pinType.Type))
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
 }
 
-// PinLsCid performs a "pin ls --type=recursive <hash> "request and returns
-// an api.IPFSPinStatus for that hash.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected %s but found %v", delim, tok)
+	}
+	return nil
+}
+
+// PinLsCid performs a "pin ls --type=all <hash> "request and returns
+// an api.IPFSPinStatus for that hash. Hashes which are only pinned as
+// part of another recursive pin are reported as indirect.
 func (ipfs *Connector) PinLsCid(hash *cid.Cid) (api.IPFSPinStatus, error) {
-	lsPath := fmt.Sprintf("pin/ls?arg=%s&type=recursive", hash)
+	lsPath := fmt.Sprintf("pin/ls?arg=%s&type=all", hash)
 	body, err := ipfs.post(lsPath)
 
 	// Network error, daemon down
@@ -681,12 +1090,28 @@ func (ipfs *Connector) PinLsCid(hash *cid.Cid) (api.IPFSPinStatus, error) {
 // post performs the heavy lifting of a post request against
 // the IPFS daemon.
 func (ipfs *Connector) post(path string) ([]byte, error) {
+	return ipfs.postCtx(context.Background(), path, "", nil)
+}
+
+// postCtx performs a post request against the IPFS daemon with the given
+// body, which is cancelled along with the context.
+func (ipfs *Connector) postCtx(ctx context.Context, path, contentType string, postBody io.Reader) ([]byte, error) {
 	logger.Debugf("posting %s", path)
 	url := fmt.Sprintf("%s/%s",
 		ipfs.apiURL(),
 		path)
 
-	res, err := http.Post(url, "", nil)
+	req, err := http.NewRequest("POST", url, postBody)
+	if err != nil {
+		logger.Error("error creating request:", err)
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req = req.WithContext(ctx)
+
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		logger.Error("error posting:", err)
 		return nil, err
@@ -716,6 +1141,145 @@ func (ipfs *Connector) post(path string) ([]byte, error) {
 	return body, nil
 }
 
+// postStream performs a post request against the IPFS daemon and returns
+// the response, so that its body can be decoded while it is read. The
+// caller must close the body. Non-200 responses are returned as errors.
+func (ipfs *Connector) postStream(ctx context.Context, path string) (*http.Response, error) {
+	logger.Debugf("posting %s", path)
+	url := fmt.Sprintf("%s/%s",
+		ipfs.apiURL(),
+		path)
+
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		logger.Error("error creating request:", err)
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Error("error posting:", err)
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		var ipfsErr ipfsError
+		if json.Unmarshal(body, &ipfsErr) == nil {
+			return nil, fmt.Errorf("IPFS unsuccessful: %d: %s",
+				res.StatusCode, ipfsErr.Message)
+		}
+		return nil, fmt.Errorf("IPFS-get '%s' unsuccessful: %d: %s",
+			path, res.StatusCode, body)
+	}
+	return res, nil
+}
+
+// BlockGet returns the raw bytes of the block for the given Cid. Since IPFS
+// looks for blocks in the network when they are not available locally,
+// the request is abandoned after blockGetTimeout.
+func (ipfs *Connector) BlockGet(hash *cid.Cid) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ipfs.ctx, blockGetTimeout)
+	defer cancel()
+	return ipfs.postCtx(ctx, fmt.Sprintf("block/get?arg=%s", hash), "", nil)
+}
+
+// ObjectSize returns the cumulative size of the DAG under the given Cid,
+// as expressed by "object stat". Like BlockGet, the request is abandoned
+// after objectStatTimeout when the object is not available.
+func (ipfs *Connector) ObjectSize(hash *cid.Cid) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ipfs.ctx, objectStatTimeout)
+	defer cancel()
+	res, err := ipfs.postCtx(ctx, fmt.Sprintf("object/stat?arg=%s", hash), "", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var stat ipfsObjectStatResp
+	err = json.Unmarshal(res, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return stat.CumulativeSize, nil
+}
+
+// Resolve returns the Cid that an IPFS or IPNS path (i.e.
+// /ipns/example.com/data or /ipfs/<cid>/subdir) points to, as provided by
+// "resolve". Like BlockGet, the request is abandoned after resolveTimeout.
+func (ipfs *Connector) Resolve(path string) (*cid.Cid, error) {
+	ctx, cancel := context.WithTimeout(ipfs.ctx, resolveTimeout)
+	defer cancel()
+	res, err := ipfs.postCtx(ctx, fmt.Sprintf("resolve?arg=%s&recursive=true", url.QueryEscape(path)), "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved ipfsResolveResp
+	err = json.Unmarshal(res, &resolved)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(resolved.Path, "/ipfs/") {
+		return nil, fmt.Errorf("unexpected resolved path: %s", resolved.Path)
+	}
+	return cid.Decode(strings.TrimPrefix(resolved.Path, "/ipfs/"))
+}
+
+// BlockPut stores the given raw bytes as a block in the IPFS daemon. The
+// block format is taken from the given Cid, and the Cid of the stored
+// block must match it.
+func (ipfs *Connector) BlockPut(hash *cid.Cid, data []byte) error {
+	format, err := blockFormat(hash)
+	if err != nil {
+		return err
+	}
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("data", "data")
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	w.Close()
+
+	path := fmt.Sprintf("block/put?format=%s", format)
+	res, err := ipfs.postCtx(ipfs.ctx, path, w.FormDataContentType(), body)
+	if err != nil {
+		return err
+	}
+
+	var resp ipfsBlockPutResp
+	err = json.Unmarshal(res, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Key != hash.String() {
+		return fmt.Errorf("block put returned %s instead of %s", resp.Key, hash)
+	}
+	return nil
+}
+
+// blockFormat returns the value for the format option of block/put
+// which produces blocks with the given Cid.
+func blockFormat(hash *cid.Cid) (string, error) {
+	pref := hash.Prefix()
+	switch {
+	case pref.Version == 0:
+		return "v0", nil
+	case pref.Codec == cid.DagProtobuf:
+		return "protobuf", nil
+	case pref.Codec == cid.DagCBOR:
+		return "cbor", nil
+	case pref.Codec == cid.Raw:
+		return "raw", nil
+	default:
+		return "", fmt.Errorf("unsupported block format for %s", hash)
+	}
+}
+
 // apiURL is a short-hand for building the url of the IPFS
 // daemon API.
 func (ipfs *Connector) apiURL() string {
@@ -835,3 +1399,50 @@ func (ipfs *Connector) RepoSize() (uint64, error) {
 	}
 	return stats.RepoSize, nil
 }
+
+// BandwidthRate returns the bandwidth currently used by the ipfs daemon as
+// provided by "stats bw". It is the sum of the incoming and outgoing rates,
+// in bytes per second.
+func (ipfs *Connector) BandwidthRate() (uint64, error) {
+	res, err := ipfs.post("stats/bw")
+	if err != nil {
+		logger.Error(err)
+		return 0, err
+	}
+
+	var stats ipfsBandwidthStatsResp
+	err = json.Unmarshal(res, &stats)
+	if err != nil {
+		logger.Error(err)
+		return 0, err
+	}
+	return uint64(stats.RateIn + stats.RateOut), nil
+}
+
+// SwarmPeers returns the peers currently connected to the ipfs daemon, as
+// provided by "swarm peers".
+func (ipfs *Connector) SwarmPeers() ([]peer.ID, error) {
+	res, err := ipfs.post("swarm/peers")
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	var peersRaw ipfsSwarmPeersResp
+	err = json.Unmarshal(res, &peersRaw)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	swarm := make([]peer.ID, 0, len(peersRaw.Peers))
+	for _, p := range peersRaw.Peers {
+		pID, err := peer.IDB58Decode(p.Peer)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+		swarm = append(swarm, pID)
+	}
+	return swarm, nil
+}
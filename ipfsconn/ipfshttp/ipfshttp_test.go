@@ -3,17 +3,22 @@ package ipfshttp
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/test"
 
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
 	ma "github.com/multiformats/go-multiaddr"
@@ -25,6 +30,10 @@ func init() {
 }
 
 func testIPFSConnector(t *testing.T) (*Connector, *test.IpfsMock) {
+	return testIPFSConnectorWithClient(t, test.NewMockRPCClient(t))
+}
+
+func testIPFSConnectorWithClient(t *testing.T, c *rpc.Client) (*Connector, *test.IpfsMock) {
 	mock := test.NewIpfsMock()
 	nodeMAddr, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/%s/tcp/%d",
 		mock.Addr, mock.Port))
@@ -40,7 +49,7 @@ func testIPFSConnector(t *testing.T) (*Connector, *test.IpfsMock) {
 	if err != nil {
 		t.Fatal("creating an IPFSConnector should work: ", err)
 	}
-	ipfs.SetClient(test.NewMockRPCClient(t))
+	ipfs.SetClient(c)
 	return ipfs, mock
 }
 
@@ -116,6 +125,33 @@ func TestIPFSUnpin(t *testing.T) {
 	}
 }
 
+func TestIPFSCancel(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+	c, _ := cid.Decode(test.TestCid1)
+
+	err := ipfs.Cancel(c)
+	if err != nil {
+		t.Error("cancelling without ongoing requests should not fail")
+	}
+
+	ctx, done := ipfs.startRequest(c)
+	defer done()
+	err = ipfs.Cancel(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("expected the request context to be cancelled")
+	}
+	if len(ipfs.reqs) != 0 {
+		t.Error("expected the request to be removed")
+	}
+}
+
 func TestIPFSPinLsCid(t *testing.T) {
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
@@ -158,6 +194,37 @@ func TestIPFSPinLs(t *testing.T) {
 	}
 }
 
+func TestDecodePinLs(t *testing.T) {
+	resp := `{"Other": [1, 2], "Keys": {
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq": {"Type": "recursive"},
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma": {"Type": "direct"}
+	}}`
+	pins := make(map[string]api.IPFSPinStatus)
+	err := decodePinLs(bytes.NewBufferString(resp), func(k string, ips api.IPFSPinStatus) {
+		pins[k] = ips
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 ||
+		pins[test.TestCid1] != api.IPFSPinStatusRecursive ||
+		pins[test.TestCid2] != api.IPFSPinStatusDirect {
+		t.Errorf("unexpected pins: %v", pins)
+	}
+
+	err = decodePinLs(bytes.NewBufferString(`{"Keys": null}`), func(string, api.IPFSPinStatus) {
+		t.Error("there are no pins")
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = decodePinLs(bytes.NewBufferString(`{"Keys": {"Qm`), func(string, api.IPFSPinStatus) {})
+	if err == nil {
+		t.Error("expected an error with a truncated response")
+	}
+}
+
 func TestIPFSProxyVersion(t *testing.T) {
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
@@ -187,6 +254,36 @@ func TestIPFSProxyVersion(t *testing.T) {
 	}
 }
 
+func TestIPFSProxyReadOnly(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+	ipfs.config.ProxyReadOnly = true
+
+	res, err := http.Post(fmt.Sprintf("%s/version", proxyURL(ipfs)), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Error("read-only requests should be forwarded")
+	}
+
+	for _, path := range []string{"/pin/add?arg=" + test.TestCid1, "/pin/rm?arg=" + test.TestCid1, "/repo/gc"} {
+		res, err = http.Post(proxyURL(ipfs)+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resBytes, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		var respErr ipfsError
+		json.Unmarshal(resBytes, &respErr)
+		if res.StatusCode != http.StatusForbidden || respErr.Message == "" {
+			t.Errorf("%s should be rejected in read-only mode", path)
+		}
+	}
+}
+
 func TestIPFSProxyPin(t *testing.T) {
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
@@ -237,6 +334,40 @@ func TestIPFSProxyPin(t *testing.T) {
 	}
 }
 
+func TestIPFSProxyPinArgs(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	u := fmt.Sprintf("%s/pin/add?arg=%s&arg=%s", proxyURL(ipfs), test.TestCid2, url.QueryEscape(test.TestPath))
+	res, err := http.Post(u, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resBytes, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	var resp ipfsPinOpResp
+	json.Unmarshal(resBytes, &resp)
+	if res.StatusCode != http.StatusOK || len(resp.Pins) != 2 ||
+		resp.Pins[0] != test.TestCid2 || resp.Pins[1] != test.TestCid1 {
+		t.Error("every argument should be pinned, resolving paths: ", string(resBytes))
+	}
+
+	for _, q := range []string{
+		"arg=" + test.TestCid1 + "&recursive=false",
+		"arg=" + url.QueryEscape("/ipns/unknown"),
+	} {
+		res, err = http.Post(proxyURL(ipfs)+"/pin/add?"+q, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusInternalServerError {
+			t.Errorf("pin/add?%s should fail", q)
+		}
+	}
+}
+
 func TestIPFSProxyUnpin(t *testing.T) {
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
@@ -343,6 +474,61 @@ func TestIPFSProxyPinLs(t *testing.T) {
 	}
 }
 
+func TestIPFSProxyPinLsType(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	res, err := http.Post(proxyURL(ipfs)+"/pin/ls?type=direct", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resBytes, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	var resp ipfsPinLsResp
+	json.Unmarshal(resBytes, &resp)
+	if res.StatusCode != http.StatusOK || len(resp.Keys) != 0 {
+		t.Error("cluster has no direct pins: ", string(resBytes))
+	}
+
+	res, err = http.Post(proxyURL(ipfs)+"/pin/ls?type=bad", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Error("invalid types should be rejected")
+	}
+}
+
+func TestProxyResponse(t *testing.T) {
+	ipfs := &Connector{}
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Connection":       []string{"close"},
+			"X-Chunked-Output": []string{"1"},
+		},
+		Trailer: http.Header{"X-Stream-Error": []string{"boom"}},
+	}
+	rec := httptest.NewRecorder()
+	ipfs.proxyResponse(rec, res, strings.NewReader("output"))
+
+	result := rec.Result()
+	if result.Header.Get("Connection") != "" {
+		t.Error("hop-by-hop headers should not be forwarded")
+	}
+	if result.Header.Get("X-Chunked-Output") != "1" || !rec.Flushed {
+		t.Error("streamed responses should be flushed")
+	}
+	if result.Trailer.Get("X-Stream-Error") != "boom" {
+		t.Error("trailers should be forwarded")
+	}
+	if rec.Body.String() != "output" {
+		t.Error("the body should be forwarded")
+	}
+}
+
 func TestProxyAdd(t *testing.T) {
 	// TODO: find a way to ensure that the calls to
 	// rpc-api "Pin" happened.
@@ -354,7 +540,8 @@ func TestProxyAdd(t *testing.T) {
 		"",
 		"pin=false",
 		"progress=true",
-		"wrap-with-directory",
+		"wrap-with-directory=true",
+		"only-hash=true",
 	}
 
 	reqs := make([]*http.Request, len(urlQueries), len(urlQueries))
@@ -417,9 +604,107 @@ func TestProxyAdd(t *testing.T) {
 			t.Logf("%+v", hash)
 			t.Error("expected testfile for hash name")
 		}
+		if msg := res.Trailer.Get(streamErrorHeader); msg != "" {
+			t.Error("unexpected stream error: ", msg)
+		}
 	}
 }
 
+// pinRecorder is a Cluster RPC service which records the pins
+// requested by the proxy and fails them when err is set.
+type pinRecorder struct {
+	mu   sync.Mutex
+	pins []api.PinSerial
+	err  error
+}
+
+func (r *pinRecorder) Pin(in api.PinSerial, out *struct{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pins = append(r.pins, in)
+	return r.err
+}
+
+func testProxyAddRequest(t *testing.T, ipfs *Connector) *http.Response {
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("file", "testfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = part.Write([]byte("this is a multipart file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%s/add", proxyURL(ipfs))
+	req, _ := http.NewRequest("POST", url, body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("should have succeeded: ", err)
+	}
+	// Trailers are only available once the body has been read.
+	_, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("Bad response status")
+	}
+	return res
+}
+
+func TestProxyAddClusterPin(t *testing.T) {
+	recorder := &pinRecorder{}
+	s := rpc.NewServer(nil, "mock")
+	err := s.RegisterName("Cluster", recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipfs, mock := testIPFSConnectorWithClient(t, rpc.NewClientWithServer(nil, "mock", s))
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	t.Run("pin", func(t *testing.T) {
+		res := testProxyAddRequest(t, ipfs)
+		if msg := res.Trailer.Get(streamErrorHeader); msg != "" {
+			t.Error("unexpected stream error: ", msg)
+		}
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		if len(recorder.pins) != 1 {
+			t.Fatalf("expected 1 cluster pin and got %d", len(recorder.pins))
+		}
+		pin := recorder.pins[0]
+		if pin.Cid != test.TestCid3 {
+			t.Error("expected TestCid3 to be pinned as it is hardcoded in ipfs mock")
+		}
+		if pin.Name != "testfile" {
+			t.Error("expected the pin to be named after the added file")
+		}
+	})
+
+	t.Run("pin error", func(t *testing.T) {
+		recorder.mu.Lock()
+		recorder.pins = nil
+		recorder.err = errors.New("pin failed")
+		recorder.mu.Unlock()
+
+		res := testProxyAddRequest(t, ipfs)
+		msg := res.Trailer.Get(streamErrorHeader)
+		if !strings.Contains(msg, "pin failed") {
+			t.Errorf("expected the cluster pin error in the %s trailer and got %q", streamErrorHeader, msg)
+		}
+	})
+}
+
 func TestProxyAddError(t *testing.T) {
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
@@ -444,45 +729,45 @@ func TestDecideRecursivePins(t *testing.T) {
 
 	tcs := []testcases{
 		{
-			[]ipfsAddResp{{"a", "cida", 0}},
+			[]ipfsAddResp{{"a", "cida", 0, ""}},
 			url.Values{},
 			[]string{"cida"},
 		},
 		{
-			[]ipfsAddResp{{"a/b", "cidb", 0}, {"a", "cida", 0}},
+			[]ipfsAddResp{{"a/b", "cidb", 0, ""}, {"a", "cida", 0, ""}},
 			url.Values{},
 			[]string{"cida"},
 		},
 		{
-			[]ipfsAddResp{{"a/b", "cidb", 0}, {"c", "cidc", 0}, {"a", "cida", 0}},
+			[]ipfsAddResp{{"a/b", "cidb", 0, ""}, {"c", "cidc", 0, ""}, {"a", "cida", 0, ""}},
 			url.Values{},
 			[]string{"cidc", "cida"},
 		},
 		{
-			[]ipfsAddResp{{"/a", "cida", 0}},
+			[]ipfsAddResp{{"/a", "cida", 0, ""}},
 			url.Values{},
 			[]string{"cida"},
 		},
 		{
-			[]ipfsAddResp{{"a/b/c/d", "cidd", 0}},
+			[]ipfsAddResp{{"a/b/c/d", "cidd", 0, ""}},
 			url.Values{},
 			[]string{"cidd"},
 		},
 		{
-			[]ipfsAddResp{{"a", "cida", 0}, {"b", "cidb", 0}, {"c", "cidc", 0}, {"d", "cidd", 0}},
+			[]ipfsAddResp{{"a", "cida", 0, ""}, {"b", "cidb", 0, ""}, {"c", "cidc", 0, ""}, {"d", "cidd", 0, ""}},
 			url.Values{},
 			[]string{"cida", "cidb", "cidc", "cidd"},
 		},
 		{
-			[]ipfsAddResp{{"a", "cida", 0}, {"b", "cidb", 0}, {"", "cidwrap", 0}},
+			[]ipfsAddResp{{"a", "cida", 0, ""}, {"b", "cidb", 0, ""}, {"", "cidwrap", 0, ""}},
 			url.Values{
-				"wrap-in-directory": []string{"true"},
+				"wrap-with-directory": []string{"true"},
 			},
 			[]string{"cidwrap"},
 		},
 		{
 
-			[]ipfsAddResp{{"b", "", 0}, {"a", "cida", 0}},
+			[]ipfsAddResp{{"b", "", 0, ""}, {"a", "cida", 0, ""}},
 			url.Values{},
 			[]string{"cida"},
 		},
@@ -569,6 +854,200 @@ func TestRepoSize(t *testing.T) {
 	}
 }
 
+func TestBlockGet(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, _ := cid.Decode(test.TestInlineCid)
+	data, err := ipfs.BlockGet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(test.TestInlineData) {
+		t.Error("unexpected block data")
+	}
+
+	c, _ = cid.Decode(test.TestCid1)
+	_, err = ipfs.BlockGet(c)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestObjectSize(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, _ := cid.Decode(test.TestInlineCid)
+	size, err := ipfs.ObjectSize(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(len(test.TestInlineData)) {
+		t.Error("unexpected cumulative size")
+	}
+
+	c, _ = cid.Decode(test.TestCid1)
+	_, err = ipfs.ObjectSize(c)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestBlockPut(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, _ := cid.Decode(test.TestInlineCid)
+	err := ipfs.BlockPut(c, test.TestInlineData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ipfs.BlockPut(c, []byte("abc"))
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	body := new(bytes.Buffer)
+	mpw := multipart.NewWriter(body)
+	part, _ := mpw.CreateFormFile("file", "testfile")
+	part.Write([]byte("this is a multipart file"))
+	mpw.Close()
+	data := body.Bytes()
+
+	chunk := api.AddChunk{
+		Session:     "test",
+		ContentType: mpw.FormDataContentType(),
+		Data:        data[:10],
+	}
+	out, err := ipfs.Add(chunk)
+	if err != nil || len(out) != 0 {
+		t.Fatal("the first chunk should not return anything: ", err)
+	}
+
+	chunk.Data = data[10:]
+	chunk.Last = true
+	out, err = ipfs.Add(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0].Cid.String() != test.TestCid3 || out[0].Name != "testfile" {
+		t.Error("unexpected added items: ", out)
+	}
+	if len(ipfs.adds) != 0 {
+		t.Error("the session should have been removed")
+	}
+
+	// A body without files fails
+	_, err = ipfs.Add(api.AddChunk{
+		Session:     "test2",
+		ContentType: mpw.FormDataContentType(),
+		Data:        []byte("abc"),
+		Last:        true,
+	})
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	_, err = ipfs.Add(api.AddChunk{Session: "test3", Cancel: true})
+	if err != nil {
+		t.Error("cancelling an unknown session should not fail")
+	}
+}
+
+func TestAddSessionTimeout(t *testing.T) {
+	defer func(d time.Duration) { addSessionTimeout = d }(addSessionTimeout)
+	addSessionTimeout = 50 * time.Millisecond
+
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	chunk := api.AddChunk{
+		Session:     "test",
+		ContentType: "multipart/form-data; boundary=abc",
+		Data:        []byte("--abc"),
+	}
+	_, err := ipfs.Add(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	chunk.Last = true
+	_, err = ipfs.Add(chunk)
+	if err == nil {
+		t.Error("chunks for a timed out session should fail")
+	}
+	ipfs.addsMux.Lock()
+	n := len(ipfs.adds)
+	ipfs.addsMux.Unlock()
+	if n != 0 {
+		t.Error("the session should have been removed")
+	}
+}
+
+func TestSwarmPeers(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	swarmPeers, err := ipfs.SwarmPeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swarmPeers) != 2 {
+		t.Fatal("expected 2 swarm peers")
+	}
+	if swarmPeers[0] != test.TestPeerID4 || swarmPeers[1] != test.TestPeerID5 {
+		t.Error("unexpected swarm peers:", swarmPeers)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, err := ipfs.Resolve(test.TestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() != test.TestCid1 {
+		t.Error("unexpected resolved cid:", c)
+	}
+
+	_, err = ipfs.Resolve("/ipns/unknown.example.com")
+	if err == nil {
+		t.Error("expected an error resolving an unknown path")
+	}
+}
+
+func TestBandwidthRate(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	r, err := ipfs.BandwidthRate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// See the ipfs mock implementation
+	if r != 3001 {
+		t.Error("expected a rate of 3001 bytes/s, got", r)
+	}
+}
+
 func TestConfigKey(t *testing.T) {
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
@@ -7,17 +7,20 @@ var logger = logging.Logger("cluster")
 // LoggingFacilities provides a list of logging identifiers
 // used by cluster and their default logging level.
 var LoggingFacilities = map[string]string{
-	"cluster":     "INFO",
-	"restapi":     "INFO",
-	"ipfshttp":    "INFO",
-	"monitor":     "INFO",
-	"mapstate":    "INFO",
-	"consensus":   "INFO",
-	"pintracker":  "INFO",
-	"ascendalloc": "INFO",
-	"diskinfo":    "INFO",
-	"apitypes":    "INFO",
-	"config":      "INFO",
+	"cluster":        "INFO",
+	"allocdecisions": "INFO",
+	"restapi":        "INFO",
+	"ipfshttp":       "INFO",
+	"monitor":        "INFO",
+	"mapstate":       "INFO",
+	"consensus":      "INFO",
+	"pintracker":     "INFO",
+	"optracker":      "INFO",
+	"ascendalloc":    "INFO",
+	"balancedalloc":  "INFO",
+	"diskinfo":       "INFO",
+	"apitypes":       "INFO",
+	"config":         "INFO",
 }
 
 // LoggingFacilitiesExtra provides logging identifiers
@@ -30,8 +33,9 @@ var LoggingFacilitiesExtra = map[string]string{
 	"raft":        "ERROR",
 }
 
-// SetFacilityLogLevel sets the log level for a given module
-func SetFacilityLogLevel(f, l string) {
+// SetFacilityLogLevel sets the log level for a given module. "*" sets
+// the level for all modules.
+func SetFacilityLogLevel(f, l string) error {
 	/*
 		CRITICAL Level = iota
 		ERROR
@@ -40,5 +44,5 @@ func SetFacilityLogLevel(f, l string) {
 		INFO
 		DEBUG
 	*/
-	logging.SetLogLevel(f, l)
+	return logging.SetLogLevel(f, l)
 }
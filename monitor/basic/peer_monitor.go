@@ -72,7 +72,7 @@ func (pmets *peerMetrics) all() []api.Metric {
 	for i := pmets.last; i >= 0; i-- {
 		res = append(res, pmets.window[i])
 	}
-	for i := wlen; i > pmets.last; i-- {
+	for i := wlen - 1; i > pmets.last; i-- {
 		res = append(res, pmets.window[i])
 	}
 	return res
@@ -256,6 +256,44 @@ func (mon *Monitor) LastMetrics(name string) []api.Metric {
 	return metrics
 }
 
+// MetricHistory returns all the valid metrics of a given type kept for
+// current cluster peers, including expired ones. The metrics for each
+// peer are ordered from newest to oldest.
+func (mon *Monitor) MetricHistory(name string) []api.Metric {
+	var peers []peer.ID
+	err := mon.rpcClient.Call("",
+		"Cluster",
+		"ConsensusPeers",
+		struct{}{},
+		&peers)
+	if err != nil {
+		logger.Errorf("MetricHistory could not list peers: %s", err)
+		return []api.Metric{}
+	}
+
+	mon.metricsMux.RLock()
+	defer mon.metricsMux.RUnlock()
+
+	mbyp, ok := mon.metrics[name]
+	if !ok {
+		return []api.Metric{}
+	}
+
+	metrics := []api.Metric{}
+	for _, peer := range peers {
+		peerMetrics, ok := mbyp[peer]
+		if !ok {
+			continue
+		}
+		for _, m := range peerMetrics.all() {
+			if m.Valid {
+				metrics = append(metrics, m)
+			}
+		}
+	}
+	return metrics
+}
+
 // Alerts returns a channel on which alerts are sent when the
 // monitor detects a failure.
 func (mon *Monitor) Alerts() <-chan api.Alert {
@@ -106,6 +106,38 @@ func TestPeerMonitorLogMetric(t *testing.T) {
 	}
 }
 
+func TestPeerMonitorMetricHistory(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+	metricCounter = 0
+
+	// overflow the window
+	for i := 0; i < WindowCap+2; i++ {
+		pm.LogMetric(newMetric("test", test.TestPeerID1))
+	}
+	invalid := newMetric("test", test.TestPeerID2)
+	invalid.Valid = false
+	pm.LogMetric(invalid)
+
+	history := pm.MetricHistory("testbad")
+	if len(history) != 0 {
+		t.Error("history should be empty")
+	}
+
+	history = pm.MetricHistory("test")
+	if len(history) != WindowCap {
+		t.Fatalf("expected %d metrics but got %d", WindowCap, len(history))
+	}
+	for i, m := range history {
+		if m.Peer != test.TestPeerID1 {
+			t.Error("invalid metrics should not be included")
+		}
+		if m.Value != fmt.Sprintf("%d", WindowCap+1-i) {
+			t.Error("metrics should be sorted from newest to oldest")
+		}
+	}
+}
+
 func TestPeerMonitorAlerts(t *testing.T) {
 	pm := testPeerMonitor(t)
 	defer pm.Shutdown()
@@ -0,0 +1,41 @@
+package ipfscluster
+
+import (
+	cid "github.com/ipfs/go-cid"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+// resolveCodecs are the codecs tried, in order, when resolving a bare
+// multihash. The first one is the default when the content is not found.
+var resolveCodecs = []uint64{cid.DagProtobuf, cid.Raw}
+
+// ResolveMultihash returns a Cid for content known only by its multihash
+// (i.e. a digest coming from a legacy system). Each codec in resolveCodecs
+// is probed by asking the IPFS daemon for the block. When none is found,
+// it returns the dag-pb Cid and false. sha2-256 dag-pb content uses CIDv0.
+func (c *Cluster) ResolveMultihash(mh multihash.Multihash) (*cid.Cid, bool, error) {
+	decoded, err := multihash.Decode(mh)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var cids []*cid.Cid
+	for _, codec := range resolveCodecs {
+		if codec == cid.DagProtobuf && decoded.Code == multihash.SHA2_256 {
+			cids = append(cids, cid.NewCidV0(mh))
+			continue
+		}
+		cids = append(cids, cid.NewCidV1(codec, mh))
+	}
+
+	for _, ci := range cids {
+		_, err := c.ipfs.BlockGet(ci)
+		if err == nil {
+			logger.Infof("resolved multihash %s to %s", mh.B58String(), ci)
+			return ci, true, nil
+		}
+		logger.Debugf("multihash %s is not available as %s: %s", mh.B58String(), ci, err)
+	}
+	logger.Infof("multihash %s not found, defaulting to %s", mh.B58String(), cids[0])
+	return cids[0], false, nil
+}
@@ -0,0 +1,187 @@
+package ipfscluster
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// lockNamespaces takes the lock which serializes the checks of the
+// quotas of the namespaces of the given pins and the commit of those
+// pins, so that concurrent requests in this peer cannot exceed a quota
+// together. Only pins in namespaces with quotas take it. It returns the
+// function which releases it.
+func (c *Cluster) lockNamespaces(pins []api.Pin) func() {
+	for _, pin := range pins {
+		nsCfg, ok := c.config.Namespaces[pin.Namespace]
+		if ok && (nsCfg.MaxPins > 0 || nsCfg.MaxBytes > 0) {
+			c.namespacesMux.Lock()
+			return c.namespacesMux.Unlock
+		}
+	}
+	return func() {}
+}
+
+// checkNamespaces verifies that the given pins can be added to their
+// namespaces: the namespace must be configured, items cannot move
+// between namespaces and the quotas of the namespace must not be
+// exceeded by the new items, or a QuotaError is returned. The usage of
+// the namespaces is kept by the shared state as pins are committed.
+// Callers hold lockNamespaces until the pins are committed. It sets the
+// Size of new pins, as reported by IPFS, in namespaces with a MaxBytes
+// quota (elsewhere, the size given by the client is kept), and keeps
+// the known Size of pins which are added again.
+func (c *Cluster) checkNamespaces(pins []api.Pin) error {
+	// There is no state until something is committed.
+	cState, err := c.consensus.State()
+	if err != nil {
+		cState = nil
+	}
+
+	added := make(map[string]*api.Namespace)
+	for i, pin := range pins {
+		if cState != nil && cState.Has(pin.Cid) {
+			existing := cState.Get(pin.Cid)
+			if existing.Namespace != pin.Namespace {
+				return api.NewInvalidPinError("%s is pinned in namespace '%s'", pin.Cid, existing.Namespace)
+			}
+			if pin.Size == 0 {
+				pins[i].Size = existing.Size
+			}
+			continue
+		}
+		if pin.Namespace == "" {
+			continue
+		}
+		nsCfg, ok := c.config.Namespaces[pin.Namespace]
+		if !ok {
+			return api.NewInvalidPinError("unknown namespace '%s'", pin.Namespace)
+		}
+		if nsCfg.MaxBytes > 0 {
+			size, err := c.ipfs.ObjectSize(pin.Cid)
+			if err != nil || size == 0 {
+				return fmt.Errorf("cannot enforce the max_bytes quota of namespace '%s': the size of %s is unknown", pin.Namespace, pin.Cid)
+			}
+			pins[i].Size = size
+		}
+		a, ok := added[pin.Namespace]
+		if !ok {
+			a = &api.Namespace{}
+			added[pin.Namespace] = a
+		}
+		a.Pins++
+		a.Bytes += pins[i].Size
+	}
+
+	if len(added) == 0 {
+		return nil
+	}
+	usage := make(map[string]api.Namespace)
+	if cState != nil {
+		usage = cState.NamespaceUsage()
+	}
+	for ns, a := range added {
+		nsCfg := c.config.Namespaces[ns]
+		used := usage[ns]
+		if nsCfg.MaxPins > 0 && used.Pins+a.Pins > nsCfg.MaxPins {
+			return &api.QuotaError{
+				Namespace: ns,
+				Quota:     "max_pins",
+				Max:       uint64(nsCfg.MaxPins),
+				Used:      uint64(used.Pins),
+				Requested: uint64(a.Pins),
+			}
+		}
+		if nsCfg.MaxBytes > 0 && used.Bytes+a.Bytes > nsCfg.MaxBytes {
+			return &api.QuotaError{
+				Namespace: ns,
+				Quota:     "max_bytes",
+				Max:       nsCfg.MaxBytes,
+				Used:      used.Bytes,
+				Requested: a.Bytes,
+			}
+		}
+	}
+	return nil
+}
+
+// namespaceReplicationFactor returns the replication factor for pins
+// added to a namespace without one.
+func (c *Cluster) namespaceReplicationFactor(ns string) int {
+	if rpl := c.config.Namespaces[ns].ReplicationFactor; rpl != 0 {
+		return rpl
+	}
+	return c.config.ReplicationFactor
+}
+
+// Namespaces returns the namespaces in which pins can be added, sorted
+// by name, starting with the default namespace (with an empty name),
+// along with their usage. Only the pins whose size was known when they
+// were added count for the Bytes of a namespace.
+func (c *Cluster) Namespaces() []api.Namespace {
+	usage := make(map[string]api.Namespace)
+	if cState, err := c.consensus.State(); err == nil {
+		usage = cState.NamespaceUsage()
+	}
+	nss := []api.Namespace{
+		{
+			Name:              "",
+			ReplicationFactor: c.config.ReplicationFactor,
+			Pins:              usage[""].Pins,
+			Bytes:             usage[""].Bytes,
+		},
+	}
+	for name, ns := range c.config.Namespaces {
+		nss = append(nss, api.Namespace{
+			Name:              name,
+			ReplicationFactor: c.namespaceReplicationFactor(name),
+			MaxPins:           ns.MaxPins,
+			MaxBytes:          ns.MaxBytes,
+			Pins:              usage[name].Pins,
+			Bytes:             usage[name].Bytes,
+		})
+	}
+	sort.Slice(nss, func(i, j int) bool {
+		return nss[i].Name < nss[j].Name
+	})
+	return nss
+}
+
+// NamespacePins returns the pins in the shared state which belong to the
+// given namespace.
+func (c *Cluster) NamespacePins(ns string) ([]api.Pin, error) {
+	if _, ok := c.config.Namespaces[ns]; !ok && ns != "" {
+		return nil, fmt.Errorf("unknown namespace '%s'", ns)
+	}
+	pins := []api.Pin{}
+	for _, pin := range c.Pins() {
+		if pin.Namespace == ns {
+			pins = append(pins, pin)
+		}
+	}
+	return pins, nil
+}
+
+// UnpinNamespace works like Unpin, but fails when the item does not
+// belong to the given namespace.
+func (c *Cluster) UnpinNamespace(ns string, h *cid.Cid) error {
+	pin := api.PinCid(h)
+	pin.Namespace = ns
+	return c.unpinNamespace(pin)
+}
+
+// unpinNamespace unpins the Cid of the given pin when it is pinned in
+// the pin's Namespace.
+func (c *Cluster) unpinNamespace(pin api.Pin) error {
+	existing, err := c.PinGet(pin.Cid)
+	if err != nil {
+		return err
+	}
+	if existing.Namespace != pin.Namespace {
+		return fmt.Errorf("%s is not pinned in namespace '%s'", pin.Cid, pin.Namespace)
+	}
+	return c.unpin(pin)
+}
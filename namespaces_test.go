@@ -0,0 +1,166 @@
+package ipfscluster
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestClusterNamespaces(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	pin := api.PinCid(c1)
+	pin.Namespace = "team-a"
+	err := cl.Pin(pin)
+	if err == nil {
+		t.Fatal("expected an error pinning in an unknown namespace")
+	}
+
+	cl.config.Namespaces = map[string]NamespaceConfig{
+		"team-a": {ReplicationFactor: 1, MaxPins: 1},
+	}
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := cl.PinGet(c1)
+	if p.Namespace != "team-a" || p.ReplicationFactor != 1 {
+		t.Error("the pin should use the namespace and its replication factor:", p)
+	}
+
+	// re-pinning does not count for the quota
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Error(err)
+	}
+
+	pin2 := api.PinCid(c2)
+	pin2.Namespace = "team-a"
+	err = cl.Pin(pin2)
+	if err == nil {
+		t.Error("expected an error when the namespace is full")
+	}
+	_, err = cl.PinBatch([]api.Pin{pin2})
+	if err == nil {
+		t.Error("expected an error when the namespace is full")
+	}
+
+	err = cl.Pin(api.PinCid(c1))
+	if err == nil {
+		t.Error("expected an error pinning in a different namespace")
+	}
+
+	pins, err := cl.NamespacePins("team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || !pins[0].Cid.Equals(c1) {
+		t.Error("unexpected namespace pins:", pins)
+	}
+	_, err = cl.NamespacePins("team-b")
+	if err == nil {
+		t.Error("expected an error listing an unknown namespace")
+	}
+
+	nss := cl.Namespaces()
+	if len(nss) != 2 || nss[0].Name != "" || nss[1].Name != "team-a" ||
+		nss[1].Pins != 1 || nss[1].MaxPins != 1 {
+		t.Error("unexpected namespaces:", nss)
+	}
+
+	err = cl.UnpinNamespace("", c1)
+	if err == nil {
+		t.Error("expected an error unpinning from a different namespace")
+	}
+	err = cl.UnpinNamespace("team-a", c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.PinGet(c1)
+	if err == nil {
+		t.Error("the pin should have been removed")
+	}
+}
+
+func TestClusterNamespaceSizeQuota(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	size := uint64(len(test.TestInlineData))
+	cl.config.Namespaces = map[string]NamespaceConfig{
+		"team-a": {MaxBytes: size - 1},
+	}
+
+	c1, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c1)
+	pin.Namespace = "team-a"
+	err := cl.Pin(pin)
+	if err == nil {
+		t.Error("expected an error when the size is unknown")
+	}
+
+	ci, _ := cid.Decode(test.TestInlineCid)
+	pin = api.PinCid(ci)
+	pin.Namespace = "team-a"
+	err = cl.Pin(pin)
+	qe, ok := err.(*api.QuotaError)
+	if !ok {
+		t.Fatal("expected a quota error:", err)
+	}
+	if qe.Quota != "max_bytes" || qe.Requested != size || qe.Used != 0 {
+		t.Error("unexpected quota error:", qe)
+	}
+
+	cl.config.Namespaces["team-a"] = NamespaceConfig{MaxBytes: size}
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := cl.PinGet(ci)
+	if p.Size != size {
+		t.Error("the size should be stored with the pin")
+	}
+
+	nss := cl.Namespaces()
+	if len(nss) != 2 || nss[1].Bytes != size || nss[1].MaxBytes != size {
+		t.Error("unexpected namespaces:", nss)
+	}
+}
+
+func TestClusterNamespaceQuotaConcurrent(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	cl.config.Namespaces = map[string]NamespaceConfig{
+		"team-a": {MaxPins: 1},
+	}
+
+	var wg sync.WaitGroup
+	for _, h := range []string{test.TestCid1, test.TestCid2, test.TestCid3} {
+		wg.Add(1)
+		go func(h string) {
+			defer wg.Done()
+			c, _ := cid.Decode(h)
+			pin := api.PinCid(c)
+			pin.Namespace = "team-a"
+			cl.Pin(pin)
+		}(h)
+	}
+	wg.Wait()
+
+	pins, _ := cl.NamespacePins("team-a")
+	if len(pins) != 1 {
+		t.Error("concurrent pins should not exceed the quota:", pins)
+	}
+}
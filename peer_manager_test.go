@@ -174,6 +174,19 @@ func TestClustersPeerRemove(t *testing.T) {
 		t.Error(err)
 	}
 
+	pr, err := clusters[0].PeerRemoval(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Phase != api.PeerRemovalDone || pr.End.IsZero() {
+		t.Error("the removal should have finished: ", pr.Phase)
+	}
+
+	_, err = clusters[0].PeerRemoval(clusters[0].ID().ID)
+	if err == nil {
+		t.Error("expected an error for a peer which was not removed")
+	}
+
 	delay()
 
 	f := func(t *testing.T, c *Cluster) {
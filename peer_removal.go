@@ -0,0 +1,77 @@
+package ipfscluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// peerRemovals keeps track of the progress of the peer removals
+// started by this peer. Only the last removal of each peer is kept.
+type peerRemovals struct {
+	mux      sync.RWMutex
+	removals map[peer.ID]*api.PeerRemoval
+}
+
+func newPeerRemovals() *peerRemovals {
+	return &peerRemovals{
+		removals: make(map[peer.ID]*api.PeerRemoval),
+	}
+}
+
+// start records that the removal of a peer has begun.
+func (prs *peerRemovals) start(p peer.ID) {
+	prs.mux.Lock()
+	defer prs.mux.Unlock()
+	prs.removals[p] = &api.PeerRemoval{
+		Peer:  p,
+		Phase: api.PeerRemovalRemoving,
+		Start: time.Now(),
+	}
+}
+
+// update modifies the ongoing removal of a peer. It does nothing when
+// the peer is not being removed.
+func (prs *peerRemovals) update(p peer.ID, f func(pr *api.PeerRemoval)) {
+	prs.mux.Lock()
+	defer prs.mux.Unlock()
+	pr, ok := prs.removals[p]
+	if !ok || pr.Phase == api.PeerRemovalDone || pr.Phase == api.PeerRemovalError {
+		return
+	}
+	f(pr)
+}
+
+// setPhase moves the ongoing removal of a peer to the given phase.
+func (prs *peerRemovals) setPhase(p peer.ID, phase string) {
+	prs.update(p, func(pr *api.PeerRemoval) {
+		pr.Phase = phase
+	})
+}
+
+// finish marks the removal of a peer as done, or as failed when
+// err is not nil.
+func (prs *peerRemovals) finish(p peer.ID, err error) {
+	prs.update(p, func(pr *api.PeerRemoval) {
+		pr.Phase = api.PeerRemovalDone
+		if err != nil {
+			pr.Phase = api.PeerRemovalError
+			pr.Error = err.Error()
+		}
+		pr.End = time.Now()
+	})
+}
+
+// get returns the last removal of a peer.
+func (prs *peerRemovals) get(p peer.ID) (api.PeerRemoval, bool) {
+	prs.mux.RLock()
+	defer prs.mux.RUnlock()
+	pr, ok := prs.removals[p]
+	if !ok {
+		return api.PeerRemoval{}, false
+	}
+	return *pr, true
+}
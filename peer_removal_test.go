@@ -0,0 +1,61 @@
+package ipfscluster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestPeerRemovals(t *testing.T) {
+	prs := newPeerRemovals()
+
+	if _, ok := prs.get(test.TestPeerID1); ok {
+		t.Error("no removals should be tracked yet")
+	}
+
+	// updates are ignored for peers not being removed
+	prs.setPhase(test.TestPeerID1, api.PeerRemovalReallocating)
+	if _, ok := prs.get(test.TestPeerID1); ok {
+		t.Error("the update should have been ignored")
+	}
+
+	prs.start(test.TestPeerID1)
+	pr, ok := prs.get(test.TestPeerID1)
+	if !ok || pr.Phase != api.PeerRemovalRemoving || pr.Start.IsZero() {
+		t.Fatal("expected the removal to have started")
+	}
+
+	prs.setPhase(test.TestPeerID1, api.PeerRemovalReallocating)
+	prs.update(test.TestPeerID1, func(pr *api.PeerRemoval) {
+		pr.Total = 2
+		pr.Reallocated++
+	})
+	pr, _ = prs.get(test.TestPeerID1)
+	if pr.Phase != api.PeerRemovalReallocating || pr.Total != 2 || pr.Reallocated != 1 {
+		t.Error("unexpected progress:", pr)
+	}
+
+	prs.finish(test.TestPeerID1, nil)
+	pr, _ = prs.get(test.TestPeerID1)
+	if pr.Phase != api.PeerRemovalDone || pr.End.IsZero() {
+		t.Error("expected the removal to be done")
+	}
+
+	// finished removals are not modified anymore
+	prs.update(test.TestPeerID1, func(pr *api.PeerRemoval) {
+		pr.Failed++
+	})
+	pr, _ = prs.get(test.TestPeerID1)
+	if pr.Failed != 0 {
+		t.Error("finished removals should not be updated")
+	}
+
+	prs.start(test.TestPeerID2)
+	prs.finish(test.TestPeerID2, errors.New("boom"))
+	pr, _ = prs.get(test.TestPeerID2)
+	if pr.Phase != api.PeerRemovalError || pr.Error != "boom" {
+		t.Error("expected the removal to have failed")
+	}
+}
@@ -0,0 +1,258 @@
+package ipfscluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/encryption"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	leveldbds "github.com/ipfs/go-ds-leveldb"
+)
+
+// PinLogSize is the number of pin and unpin operations that each peer
+// remembers. Older operations are forgotten.
+var PinLogSize = 65536
+
+// DefaultPinLogSubFolder is the folder, in the configuration folder,
+// where peers keep their pin log.
+const DefaultPinLogSubFolder = "ipfs-cluster-pinlog"
+
+var (
+	pinLogEntriesPrefix = ds.NewKey("/entries")
+	pinLogStartKey      = ds.NewKey("/start")
+)
+
+// pinLog is an append-only log of the pin and unpin operations applied
+// to the shared state by this peer, kept in a datastore so that it
+// survives restarts. Operations are numbered by the consensus component
+// which applies them (with the Raft log index, or the etcd revision),
+// so several entries share a sequence number when they were applied
+// together (e.g. pin batches). The log keeps the entries of the last
+// size sequence numbers. Sequence numbers need not be contiguous.
+type pinLog struct {
+	mux    sync.RWMutex
+	store  ds.Datastore
+	cipher *encryption.Cipher
+	size   int
+
+	seqs    []uint64 // sequence numbers in the log, oldest first
+	start   uint64   // the log has every operation after this one
+	started bool
+}
+
+// newPinLog returns the pin log kept in the given datastore. When a key
+// is given, the entries are encrypted with it.
+func newPinLog(store ds.Datastore, key []byte, size int) (*pinLog, error) {
+	if size <= 0 {
+		size = 1
+	}
+	pl := &pinLog{
+		store: store,
+		size:  size,
+	}
+	if len(key) > 0 {
+		cipher, err := encryption.New(key)
+		if err != nil {
+			return nil, err
+		}
+		pl.cipher = cipher
+	}
+
+	v, err := store.Get(pinLogStartKey)
+	switch err {
+	case nil:
+		pl.start, err = strconv.ParseUint(string(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad pin log start: %s", err)
+		}
+		pl.started = true
+	case ds.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	res, err := store.Query(query.Query{
+		Prefix:   pinLogEntriesPrefix.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		seq, err := strconv.ParseUint(ds.RawKey(r.Key).BaseNamespace(), 16, 64)
+		if err != nil {
+			logger.Warningf("ignoring bad pin log key: %s", r.Key)
+			continue
+		}
+		pl.seqs = append(pl.seqs, seq)
+	}
+	sort.Slice(pl.seqs, func(i, j int) bool { return pl.seqs[i] < pl.seqs[j] })
+	return pl, nil
+}
+
+// openPinLog opens the pin log in the folder given by the configuration,
+// or an in-memory one when the configuration is not stored anywhere
+// (e.g. tests).
+func openPinLog(cfg *Config, size int) (*pinLog, error) {
+	if cfg.BaseDir == "" {
+		return newPinLog(ds.NewMapDatastore(), cfg.EncryptionKey, size)
+	}
+	folder := cfg.GetPinLogFolder()
+	err := os.MkdirAll(folder, 0700)
+	if err != nil {
+		return nil, err
+	}
+	var store ds.Datastore
+	store, err = leveldbds.NewDatastore(folder, nil)
+	if err != nil {
+		return nil, err
+	}
+	pl, err := newPinLog(store, cfg.EncryptionKey, size)
+	if err != nil {
+		store.(io.Closer).Close()
+		return nil, err
+	}
+	return pl, nil
+}
+
+func pinLogKey(seq uint64) ds.Key {
+	return pinLogEntriesPrefix.ChildString(fmt.Sprintf("%016x", seq))
+}
+
+func (pl *pinLog) last() uint64 {
+	if len(pl.seqs) == 0 {
+		return pl.start
+	}
+	return pl.seqs[len(pl.seqs)-1]
+}
+
+func (pl *pinLog) setStart(seq uint64) error {
+	pl.start = seq
+	pl.started = true
+	return pl.store.Put(pinLogStartKey, []byte(strconv.FormatUint(seq, 10)))
+}
+
+// add records operations applied together with the given sequence
+// number, and returns it. When seq is 0, the next number is used.
+// Operations with a sequence number which is not larger than the last
+// one have been recorded already (consensus components apply them again
+// when the peer restarts) and are ignored.
+func (pl *pinLog) add(seq uint64, entries []api.PinLogEntry) (uint64, error) {
+	pl.mux.Lock()
+	defer pl.mux.Unlock()
+
+	last := pl.last()
+	switch {
+	case seq == 0:
+		seq = last + 1
+	case seq <= last:
+		return last, nil
+	}
+
+	// Operations before the first one were never seen here.
+	if !pl.started {
+		err := pl.setStart(seq - 1)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	ts := time.Now()
+	serials := make([]api.PinLogEntrySerial, len(entries))
+	for i, e := range entries {
+		e.Seq = seq
+		e.TS = ts
+		serials[i] = e.ToSerial()
+	}
+	v, err := json.Marshal(serials)
+	if err != nil {
+		return 0, err
+	}
+	if pl.cipher != nil {
+		v, err = pl.cipher.Encrypt(v)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = pl.store.Put(pinLogKey(seq), v)
+	if err != nil {
+		return 0, err
+	}
+	pl.seqs = append(pl.seqs, seq)
+
+	for len(pl.seqs) > pl.size {
+		err := pl.store.Delete(pinLogKey(pl.seqs[0]))
+		if err != nil {
+			return seq, err
+		}
+		err = pl.setStart(pl.seqs[0])
+		if err != nil {
+			return seq, err
+		}
+		pl.seqs = pl.seqs[1:]
+	}
+	return seq, nil
+}
+
+// since returns the entries with a sequence number larger than seq, from
+// the oldest to the newest. It fails when some of them have already been
+// forgotten, or when seq is in the future, in which case the caller
+// should list the full pinset and start tailing the log again from the
+// last sequence number.
+func (pl *pinLog) since(seq uint64) ([]api.PinLogEntry, error) {
+	pl.mux.RLock()
+	defer pl.mux.RUnlock()
+
+	last := pl.last()
+	switch {
+	case seq > last:
+		return nil, fmt.Errorf("sequence %d is ahead of the pin log (last: %d)", seq, last)
+	case seq < pl.start:
+		return nil, fmt.Errorf("sequence %d is no longer in the pin log (first: %d)", seq, pl.start+1)
+	}
+
+	i := sort.Search(len(pl.seqs), func(i int) bool { return pl.seqs[i] > seq })
+	entries := make([]api.PinLogEntry, 0, len(pl.seqs)-i)
+	for _, s := range pl.seqs[i:] {
+		v, err := pl.store.Get(pinLogKey(s))
+		if err != nil {
+			return nil, err
+		}
+		if pl.cipher != nil {
+			v, err = pl.cipher.Decrypt(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var serials []api.PinLogEntrySerial
+		err = json.Unmarshal(v, &serials)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range serials {
+			entries = append(entries, e.ToPinLogEntry())
+		}
+	}
+	return entries, nil
+}
+
+// close closes the datastore of the log.
+func (pl *pinLog) close() error {
+	if c, ok := pl.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+)
+
+func pinLogEntries(op api.PinLogOp, cids ...*cid.Cid) []api.PinLogEntry {
+	entries := make([]api.PinLogEntry, len(cids))
+	for i, c := range cids {
+		entries[i] = api.PinLogEntry{Op: op, Pin: api.PinCid(c)}
+	}
+	return entries
+}
+
+func TestPinLog(t *testing.T) {
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	store := ds.NewMapDatastore()
+	pl, err := newPinLog(store, nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := pl.since(0)
+	if err != nil || len(entries) != 0 {
+		t.Fatal("log should be empty")
+	}
+
+	seq, _ := pl.add(0, pinLogEntries(api.PinLogPin, c1))
+	if seq != 1 {
+		t.Fatal("unexpected sequence number:", seq)
+	}
+	// a batch applied with the Raft log entry 5
+	seq, _ = pl.add(5, pinLogEntries(api.PinLogPin, c1, c2))
+	if seq != 5 {
+		t.Fatal("unexpected sequence number:", seq)
+	}
+	seq, _ = pl.add(5, pinLogEntries(api.PinLogUnpin, c1))
+	if seq != 5 {
+		t.Fatal("entries applied again should be ignored")
+	}
+
+	entries, err = pl.since(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Seq != 5 || entries[1].Seq != 5 || entries[1].Op != api.PinLogPin {
+		t.Fatal("unexpected entries:", entries)
+	}
+	entries, err = pl.since(3) // gaps are fine
+	if err != nil || len(entries) != 2 {
+		t.Fatal("unexpected entries:", entries, err)
+	}
+
+	// forget the oldest entry
+	pl.add(7, pinLogEntries(api.PinLogUnpin, c1))
+	pl.add(8, pinLogEntries(api.PinLogUnpin, c2))
+	_, err = pl.since(0)
+	if err == nil {
+		t.Error("expected an error when entries have been forgotten")
+	}
+	entries, err = pl.since(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 || entries[0].Seq != 5 || entries[3].Seq != 8 {
+		t.Error("unexpected entries after forgetting:", entries)
+	}
+
+	entries, err = pl.since(8)
+	if err != nil || len(entries) != 0 {
+		t.Error("expected no entries after the last one")
+	}
+	_, err = pl.since(9)
+	if err == nil {
+		t.Error("expected an error when the sequence is in the future")
+	}
+
+	// the log survives restarts
+	pl, err = newPinLog(store, nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = pl.since(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Seq != 7 || !entries[1].Pin.Cid.Equals(c2) {
+		t.Error("unexpected entries after reopening:", entries)
+	}
+	_, err = pl.since(0)
+	if err == nil {
+		t.Error("expected an error when entries have been forgotten")
+	}
+	seq, _ = pl.add(0, pinLogEntries(api.PinLogPin, c1))
+	if seq != 9 {
+		t.Error("unexpected sequence number after reopening:", seq)
+	}
+}
+
+func TestPinLogStart(t *testing.T) {
+	c1, _ := cid.Decode(test.TestCid1)
+
+	// a peer which joins with a snapshot starts at a later index
+	pl, err := newPinLog(ds.NewMapDatastore(), nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl.add(10, pinLogEntries(api.PinLogPin, c1))
+	_, err = pl.since(0)
+	if err == nil {
+		t.Error("expected an error for operations before the log started")
+	}
+	entries, err := pl.since(9)
+	if err != nil || len(entries) != 1 {
+		t.Error("unexpected entries:", entries, err)
+	}
+}
+
+func TestPinLogEncrypted(t *testing.T) {
+	c1, _ := cid.Decode(test.TestCid1)
+
+	store := ds.NewMapDatastore()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	pl, err := newPinLog(store, key, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl.add(0, pinLogEntries(api.PinLogPin, c1))
+
+	v, err := store.Get(pinLogKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(v, []byte(test.TestCid1)) {
+		t.Error("the pin log should be encrypted")
+	}
+
+	entries, err := pl.since(0)
+	if err != nil || len(entries) != 1 || !entries[0].Pin.Cid.Equals(c1) {
+		t.Error("unexpected entries:", entries, err)
+	}
+}
@@ -1,62 +1,24 @@
 package maptracker
 
-import (
-	"encoding/json"
-	"testing"
-)
+import "testing"
 
-var cfgJSON = []byte(`
-{
-      "pinning_timeout": "30s",
-      "unpinning_timeout": "15s",
-      "max_pin_queue_size": 4092
-}
-`)
-
-func TestLoadJSON(t *testing.T) {
+func TestConfigSection(t *testing.T) {
 	cfg := &Config{}
-	err := cfg.LoadJSON(cfgJSON)
-	if err != nil {
+	cfg.Default()
+	if err := cfg.Validate(); err != nil {
 		t.Fatal(err)
 	}
-
-	j := &jsonConfig{}
-
-	json.Unmarshal(cfgJSON, j)
-	j.PinningTimeout = "-10"
-	tst, _ := json.Marshal(j)
-	err = cfg.LoadJSON(tst)
-	if err != nil {
-		t.Error("did not expect an error")
-	}
-	if cfg.PinningTimeout != DefaultPinningTimeout {
-		t.Error("expected default pinning_timeout")
-	}
-}
-
-func TestToJSON(t *testing.T) {
-	cfg := &Config{}
-	cfg.LoadJSON(cfgJSON)
-	newjson, err := cfg.ToJSON()
+	raw, err := cfg.ToJSON()
 	if err != nil {
 		t.Fatal(err)
 	}
-	cfg = &Config{}
-	err = cfg.LoadJSON(newjson)
-	if err != nil {
+	if err := cfg.LoadJSON(raw); err != nil {
 		t.Fatal(err)
 	}
-}
-
-func TestDefault(t *testing.T) {
-	cfg := &Config{}
-	cfg.Default()
-	if cfg.Validate() != nil {
-		t.Fatal("error validating")
-	}
 
-	cfg.UnpinningTimeout = 0
-	if cfg.Validate() == nil {
-		t.Fatal("expected error validating")
+	cfg.ConcurrentPins = 0
+	err = cfg.Validate()
+	if err == nil || err.Error() != "maptracker.concurrent_pins too low" {
+		t.Error("expected an error naming the maptracker section:", err)
 	}
 }
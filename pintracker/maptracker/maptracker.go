@@ -5,10 +5,15 @@ package maptracker
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/opstore"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+	"github.com/ipfs/ipfs-cluster/pintracker/ratelimit"
+	"github.com/ipfs/ipfs-cluster/pintracker/util"
 
 	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
@@ -18,11 +23,12 @@ import (
 
 var logger = logging.Logger("pintracker")
 
+// EventChannelCap specifies how much buffer the events channel has.
+var EventChannelCap = 1024
+
 var (
-	errUnpinningTimeout = errors.New("unpinning operation is taking too long")
-	errPinningTimeout   = errors.New("pinning operation is taking too long")
-	errPinned           = errors.New("the item is unexpectedly pinned on IPFS")
-	errUnpinned         = errors.New("the item is unexpectedly not pinned on IPFS")
+	errPinned   = errors.New("the item is unexpectedly pinned on IPFS")
+	errUnpinned = errors.New("the item is unexpectedly not pinned on IPFS")
 )
 
 // MapPinTracker is a PinTracker implementation which uses a Go map
@@ -32,15 +38,54 @@ type MapPinTracker struct {
 	status map[string]api.PinInfo
 	config *Config
 
+	// optracker keeps the queued and ongoing operations, so that there
+	// is at most one per Cid.
+	optracker *optracker.OperationTracker
+
 	ctx    context.Context
 	cancel func()
 
 	rpcClient *rpc.Client
 	rpcReady  chan struct{}
 
+	events chan api.PinEvent
+
 	peerID  peer.ID
-	pinCh   chan api.Pin
-	unpinCh chan api.Pin
+	pinCh   chan *optracker.Operation
+	unpinCh chan *optracker.Operation
+
+	// background maintenance operations use their own queue
+	// and workers. Pin workers take from it too, following the
+	// configured priority ratio. Their operations carry the failed
+	// attempts of automatic retries.
+	bgCh chan *optracker.Operation
+
+	// workers is the number of pin and of unpin workers. Workers
+	// stop when they receive from the stop channels.
+	workersMux  sync.Mutex
+	workers     int
+	stopPinCh   chan struct{}
+	stopUnpinCh chan struct{}
+
+	// store saves pending and failed operations across restarts when
+	// PersistFile is set. Operations are only saved once the ones
+	// from the previous run have been restored.
+	store    *opstore.Store
+	restored bool
+
+	// remotes keeps the allocations of the items which are pinned
+	// by other peers, so that they can be verified.
+	remotes map[string][]peer.ID
+
+	// metas keeps the MetaType pins whose shards are tracked, so that
+	// their status can be aggregated and their shards untracked.
+	metas map[string]api.Pin
+
+	// limiter smooths out the pins sent to IPFS
+	limiter *ratelimit.Limiter
+
+	// counters reported by Metrics()
+	counters util.Counters
 
 	shutdownLock sync.Mutex
 	shutdown     bool
@@ -53,44 +98,153 @@ func NewMapPinTracker(cfg *Config, pid peer.ID) *MapPinTracker {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	mpt := &MapPinTracker{
-		ctx:      ctx,
-		cancel:   cancel,
-		status:   make(map[string]api.PinInfo),
-		config:   cfg,
-		rpcReady: make(chan struct{}, 1),
-		peerID:   pid,
-		pinCh:    make(chan api.Pin, cfg.MaxPinQueueSize),
-		unpinCh:  make(chan api.Pin, cfg.MaxPinQueueSize),
-	}
-	go mpt.pinWorker()
-	go mpt.unpinWorker()
+		ctx:       ctx,
+		cancel:    cancel,
+		status:    make(map[string]api.PinInfo),
+		remotes:   make(map[string][]peer.ID),
+		metas:     make(map[string]api.Pin),
+		limiter:   ratelimit.New(cfg.MaxPinQueueRate),
+		config:    cfg,
+		optracker: optracker.NewOperationTracker(ctx),
+		rpcReady:  make(chan struct{}),
+		events:    make(chan api.PinEvent, EventChannelCap),
+		peerID:    pid,
+		pinCh:     make(chan *optracker.Operation, cfg.MaxPinQueueSize),
+		unpinCh:   make(chan *optracker.Operation, cfg.MaxPinQueueSize),
+		bgCh:      make(chan *optracker.Operation, cfg.MaxPinQueueSize),
+
+		stopPinCh:   make(chan struct{}),
+		stopUnpinCh: make(chan struct{}),
+	}
+	mpt.startWorkers(cfg.ConcurrentPins)
+	for i := 0; i < cfg.ConcurrentBackgroundPins; i++ {
+		go mpt.bgWorker()
+	}
+	store, err := util.NewStore(&cfg.Config)
+	if err != nil {
+		logger.Errorf("not saving the pin tracker operations: %s", err)
+	}
+	if store != nil {
+		mpt.store = store
+		mpt.wg.Add(1)
+		go func() {
+			defer mpt.wg.Done()
+			// operations are only saved once the ones from the
+			// previous run are restored
+			util.Loop(mpt.ctx, mpt.rpcReady, cfg.PersistInterval, func() {
+				util.Restore(mpt.store, mpt.resume)
+				mpt.restored = true
+			}, mpt.persist)
+		}()
+	}
+	if cfg.VerifyRemoteInterval > 0 {
+		mpt.wg.Add(1)
+		go func() {
+			defer mpt.wg.Done()
+			util.Loop(mpt.ctx, mpt.rpcReady, cfg.VerifyRemoteInterval, nil, mpt.verifyRemote)
+		}()
+	}
 	return mpt
 }
 
-// reads the queue and makes pins to the IPFS daemon one by one
+func (mpt *MapPinTracker) startWorkers(n int) {
+	for i := 0; i < n; i++ {
+		go mpt.pinWorker()
+		go mpt.unpinWorker()
+	}
+	mpt.workers += n
+}
+
+// stopWorkers signals n pin and n unpin workers to stop once they finish
+// their current operation. It does not wait for them.
+func (mpt *MapPinTracker) stopWorkers(n int) {
+	mpt.workers -= n
+	stop := func(ch chan struct{}) {
+		for i := 0; i < n; i++ {
+			select {
+			case ch <- struct{}{}:
+			case <-mpt.ctx.Done():
+				return
+			}
+		}
+	}
+	go stop(mpt.stopPinCh)
+	go stop(mpt.stopUnpinCh)
+}
+
+// SetConcurrentPins changes the number of pin and unpin requests
+// which can be processed at the same time, without restarting. Ongoing
+// operations are not interrupted. The new value is saved to the
+// configuration.
+func (mpt *MapPinTracker) SetConcurrentPins(n int) error {
+	if n <= 0 {
+		return errors.New("maptracker.concurrent_pins too low")
+	}
+
+	mpt.workersMux.Lock()
+	defer mpt.workersMux.Unlock()
+	switch {
+	case n > mpt.workers:
+		mpt.startWorkers(n - mpt.workers)
+	case n < mpt.workers:
+		mpt.stopWorkers(mpt.workers - n)
+	}
+	logger.Infof("concurrent pins set to %d", n)
+
+	mpt.config.ConcurrentPins = n
+	mpt.config.NotifySave()
+	return nil
+}
+
+// ConfigKey returns the key of the configuration section of this
+// tracker.
+func (mpt *MapPinTracker) ConfigKey() string {
+	return mpt.config.ConfigKey()
+}
+
+// reads the pin queue and makes pins to the IPFS daemon one by one,
+// giving turns to background operations (see util.PriorityWorker).
 func (mpt *MapPinTracker) pinWorker() {
+	util.PriorityWorker(mpt.ctx, mpt.stopPinCh, mpt.config.PriorityRatio, mpt.pinCh, mpt.bgCh, mpt.run)
+}
+
+// reads the queue and makes unpin requests to the IPFS daemon
+func (mpt *MapPinTracker) unpinWorker() {
 	for {
 		select {
-		case p := <-mpt.pinCh:
-			mpt.pin(p)
+		case op := <-mpt.unpinCh:
+			mpt.unpin(op)
+		case <-mpt.stopUnpinCh:
+			return
 		case <-mpt.ctx.Done():
 			return
 		}
 	}
 }
 
-// reads the queue and makes unpin requests to the IPFS daemon
-func (mpt *MapPinTracker) unpinWorker() {
+// reads the background queue and makes pin or unpin requests to
+// the IPFS daemon
+func (mpt *MapPinTracker) bgWorker() {
 	for {
 		select {
-		case p := <-mpt.unpinCh:
-			mpt.unpin(p)
+		case op := <-mpt.bgCh:
+			mpt.run(op)
 		case <-mpt.ctx.Done():
 			return
 		}
 	}
 }
 
+// run performs a pin or unpin operation. Pins which failed before are
+// attempted again.
+func (mpt *MapPinTracker) run(op *optracker.Operation) {
+	if op.Type() == optracker.OperationUnpin {
+		mpt.unpin(op)
+	} else {
+		mpt.pinAttempt(op, op.Attempts())
+	}
+}
+
 // Shutdown finishes the services provided by the MapPinTracker and cancels
 // any active context.
 func (mpt *MapPinTracker) Shutdown() error {
@@ -104,8 +258,10 @@ func (mpt *MapPinTracker) Shutdown() error {
 
 	logger.Info("stopping MapPinTracker")
 	mpt.cancel()
-	close(mpt.rpcReady)
 	mpt.wg.Wait()
+	if mpt.store != nil && mpt.restored {
+		mpt.persist()
+	}
 	mpt.shutdown = true
 	return nil
 }
@@ -117,18 +273,38 @@ func (mpt *MapPinTracker) set(c *cid.Cid, s api.TrackerStatus) {
 }
 
 func (mpt *MapPinTracker) unsafeSet(c *cid.Cid, s api.TrackerStatus) {
-	if s == api.TrackerStatusUnpinned {
-		delete(mpt.status, c.String())
-		return
-	}
-
-	mpt.status[c.String()] = api.PinInfo{
+	prev := mpt.unsafeGet(c).Status
+	p := api.PinInfo{
 		Cid:    c,
 		Peer:   mpt.peerID,
 		Status: s,
 		TS:     time.Now(),
 		Error:  "",
 	}
+	if s == api.TrackerStatusUnpinned {
+		delete(mpt.status, c.String())
+	} else {
+		mpt.status[c.String()] = p
+	}
+	if s != api.TrackerStatusRemote && s != api.TrackerStatusRemoteError {
+		delete(mpt.remotes, c.String())
+	}
+	// pinning and unpinning items change from queued to started
+	// without changing their status.
+	if s != prev || s == api.TrackerStatusPinning || s == api.TrackerStatusUnpinning {
+		mpt.sendEvent(p)
+	}
+}
+
+// sendEvent notifies a change in the status of an item. Pinning and
+// unpinning items are queued until their operation starts.
+func (mpt *MapPinTracker) sendEvent(p api.PinInfo) {
+	ev := api.PinEvent{PinInfo: p}
+	if p.Status == api.TrackerStatusPinning || p.Status == api.TrackerStatusUnpinning {
+		op, ok := mpt.optracker.Get(p.Cid)
+		ev.Queued = ok && op.Phase() == optracker.PhaseQueued
+	}
+	util.SendEvent(mpt.events, ev)
 }
 
 func (mpt *MapPinTracker) get(c *cid.Cid) api.PinInfo {
@@ -161,13 +337,14 @@ func (mpt *MapPinTracker) setError(c *cid.Cid, err error) {
 func (mpt *MapPinTracker) unsafeSetError(c *cid.Cid, err error) {
 	p := mpt.unsafeGet(c)
 	switch p.Status {
-	case api.TrackerStatusPinned, api.TrackerStatusPinning, api.TrackerStatusPinError:
+	case api.TrackerStatusPinned, api.TrackerStatusPinnedIndirect, api.TrackerStatusPinning, api.TrackerStatusPinError:
 		mpt.status[c.String()] = api.PinInfo{
-			Cid:    c,
-			Peer:   mpt.peerID,
-			Status: api.TrackerStatusPinError,
-			TS:     time.Now(),
-			Error:  err.Error(),
+			Cid:      c,
+			Peer:     mpt.peerID,
+			Status:   api.TrackerStatusPinError,
+			TS:       time.Now(),
+			Error:    err.Error(),
+			Attempts: p.Attempts,
 		}
 	case api.TrackerStatusUnpinned, api.TrackerStatusUnpinning, api.TrackerStatusUnpinError:
 		mpt.status[c.String()] = api.PinInfo{
@@ -177,49 +354,146 @@ func (mpt *MapPinTracker) unsafeSetError(c *cid.Cid, err error) {
 			TS:     time.Now(),
 			Error:  err.Error(),
 		}
+	default:
+		return
 	}
+	mpt.sendEvent(mpt.status[c.String()])
 }
 
-func (mpt *MapPinTracker) isRemote(c api.Pin) bool {
-	if c.ReplicationFactor < 0 {
-		return false
+// newOperation records a new operation for a pin. It returns nil when an
+// operation of the same type is already queued or in progress. When an
+// obsolete operation in progress is replaced, its IPFS request is
+// cancelled.
+func (mpt *MapPinTracker) newOperation(c api.Pin, typ optracker.OperationType) *optracker.Operation {
+	old, ok := mpt.optracker.Get(c.Cid)
+	op := mpt.optracker.TrackNewOperation(c, typ)
+	if op != nil && ok && old.Phase() == optracker.PhaseInProgress {
+		util.CancelIPFS(mpt.rpcClient, c.Cid)
 	}
+	return op
+}
 
-	for _, p := range c.Allocations {
-		if p == mpt.peerID {
-			return false
-		}
-	}
-	return true
+func (mpt *MapPinTracker) pin(op *optracker.Operation) error {
+	return mpt.pinAttempt(op, 0)
 }
 
-func (mpt *MapPinTracker) pin(c api.Pin) error {
-	logger.Debugf("issuing pin call for %s", c.Cid)
-	mpt.set(c.Cid, api.TrackerStatusPinning)
-	err := mpt.rpcClient.Call("",
-		"Cluster",
-		"IPFSPin",
-		c.ToSerial(),
-		&struct{}{})
+// pinAttempt pins an item which has failed to pin the given number of
+// times before. On failure, a retry is scheduled. Cancelled operations
+// do not modify the status, which belongs to the operation replacing
+// them.
+func (mpt *MapPinTracker) pinAttempt(op *optracker.Operation, attempts int) error {
+	defer mpt.optracker.Finish(op)
+	if op.Cancelled() {
+		return nil
+	}
+	op.SetPhase(optracker.PhaseInProgress)
+
+	c := op.Pin()
+	if util.PinnedIndirectly(mpt.rpcClient, c.Cid) {
+		logger.Infof("%s is already pinned indirectly. Not pinning it", c.Cid)
+		mpt.set(c.Cid, api.TrackerStatusPinnedIndirect)
+		return nil
+	}
 
+	if err := mpt.limiter.Wait(op.Context()); err != nil {
+		// cancelled while waiting for its turn
+		return nil
+	}
+
+	logger.Debugf("issuing pin call for %s", c.Cid)
+	mpt.setPinning(c.Cid, attempts)
+	start := time.Now()
+	err := util.IPFSCall(op.Context(), mpt.rpcClient, &mpt.counters, "IPFSPin", c, mpt.config.PinTimeout, util.ErrPinTimeout)
+	if op.Cancelled() {
+		logger.Debugf("pin operation for %s was cancelled", c.Cid)
+		return nil
+	}
 	if err != nil {
-		mpt.setError(c.Cid, err)
+		mpt.pinFailed(c, attempts+1, err)
 		return err
 	}
 
+	mpt.counters.Pinned(time.Since(start))
 	mpt.set(c.Cid, api.TrackerStatusPinned)
 	return nil
 }
 
-func (mpt *MapPinTracker) unpin(c api.Pin) error {
+func (mpt *MapPinTracker) setPinning(c *cid.Cid, attempts int) {
+	mpt.mux.Lock()
+	defer mpt.mux.Unlock()
+	mpt.unsafeSetPinning(c, attempts)
+}
+
+func (mpt *MapPinTracker) unsafeSetPinning(c *cid.Cid, attempts int) {
+	mpt.unsafeSet(c, api.TrackerStatusPinning)
+	p := mpt.status[c.String()]
+	p.Attempts = attempts
+	mpt.status[c.String()] = p
+}
+
+// pinFailed sets an item in error state and, unless it has already been
+// attempted MaxRetries times, schedules a new attempt with exponential
+// backoff.
+func (mpt *MapPinTracker) pinFailed(c api.Pin, attempts int, err error) {
+	mpt.mux.Lock()
+	mpt.unsafeSetError(c.Cid, err)
+	p := mpt.status[c.Cid.String()]
+	p.Attempts = attempts
+	mpt.status[c.Cid.String()] = p
+	mpt.mux.Unlock()
+
+	mpt.scheduleRetry(c, attempts, err)
+}
+
+// scheduleRetry schedules a new attempt to pin an item which has failed
+// the given number of times, unless it has reached MaxRetries.
+func (mpt *MapPinTracker) scheduleRetry(c api.Pin, attempts int, err error) {
+	util.ScheduleRetry(&mpt.config.Config, &mpt.counters, c, attempts, err, func() { mpt.retry(c, attempts) })
+}
+
+// retry queues a new attempt to pin an item in the background queue,
+// unless it was recovered, re-tracked or untracked in the meantime.
+func (mpt *MapPinTracker) retry(c api.Pin, attempts int) {
+	if mpt.ctx.Err() != nil {
+		return
+	}
+
+	mpt.mux.Lock()
+	p := mpt.unsafeGet(c.Cid)
+	if p.Status != api.TrackerStatusPinError || p.Attempts != attempts {
+		mpt.mux.Unlock()
+		return
+	}
+	op := mpt.newOperation(c, optracker.OperationPin)
+	if op == nil {
+		mpt.mux.Unlock()
+		return
+	}
+	mpt.unsafeSetPinning(c.Cid, attempts)
+	mpt.mux.Unlock()
+
+	op.SetAttempts(attempts)
+	if !mpt.enqueueBackground(op) {
+		mpt.optracker.Finish(op)
+		mpt.pinFailed(c, attempts+1, errors.New("pin queue is full"))
+	}
+}
+
+func (mpt *MapPinTracker) unpin(op *optracker.Operation) error {
+	defer mpt.optracker.Finish(op)
+	if op.Cancelled() {
+		return nil
+	}
+	op.SetPhase(optracker.PhaseInProgress)
+
+	c := op.Pin()
 	logger.Debugf("issuing unpin call for %s", c.Cid)
 	mpt.set(c.Cid, api.TrackerStatusUnpinning)
-	err := mpt.rpcClient.Call("",
-		"Cluster",
-		"IPFSUnpin",
-		c.ToSerial(),
-		&struct{}{})
-
+	err := util.IPFSCall(op.Context(), mpt.rpcClient, &mpt.counters, "IPFSUnpin", c, mpt.config.UnpinTimeout, util.ErrUnpinTimeout)
+	if op.Cancelled() {
+		logger.Debugf("unpin operation for %s was cancelled", c.Cid)
+		return nil
+	}
 	if err != nil {
 		mpt.setError(c.Cid, err)
 		return err
@@ -231,19 +505,50 @@ func (mpt *MapPinTracker) unpin(c api.Pin) error {
 // Track tells the MapPinTracker to start managing a Cid,
 // possibly trigerring Pin operations on the IPFS daemon.
 func (mpt *MapPinTracker) Track(c api.Pin) error {
+	return mpt.track(c, false)
+}
+
+// TrackInBackground works like Track, but the resulting Pin operation
+// is queued along with other background maintenance operations.
+func (mpt *MapPinTracker) TrackInBackground(c api.Pin) error {
+	return mpt.track(c, true)
+}
+
+func (mpt *MapPinTracker) track(c api.Pin, bg bool) error {
 	logger.Debugf("tracking %s", c.Cid)
-	if mpt.isRemote(c) {
-		if mpt.get(c.Cid).Status == api.TrackerStatusPinned {
-			mpt.unpin(c)
+	if c.Type == api.MetaType {
+		return mpt.trackMeta(c, bg)
+	}
+	if util.IsRemotePin(c, mpt.peerID) {
+		if st := mpt.get(c.Cid).Status; st == api.TrackerStatusPinned || st == api.TrackerStatusTrashed {
+			if op := mpt.newOperation(c, optracker.OperationUnpin); op != nil {
+				mpt.unpin(op)
+			}
+		} else if op, ok := mpt.optracker.Get(c.Cid); ok && op.Type() == optracker.OperationPin {
+			// the queued pin is obsolete
+			op.Cancel()
 		}
-		mpt.set(c.Cid, api.TrackerStatusRemote)
+		mpt.mux.Lock()
+		mpt.unsafeSet(c.Cid, api.TrackerStatusRemote)
+		mpt.remotes[c.Cid.String()] = c.Allocations
+		mpt.mux.Unlock()
 		return nil
 	}
 
+	op := mpt.newOperation(c, optracker.OperationPin)
+	if op == nil {
+		logger.Debugf("%s is already being pinned", c.Cid)
+		return nil
+	}
 	mpt.set(c.Cid, api.TrackerStatusPinning)
-	select {
-	case mpt.pinCh <- c:
-	default:
+	var queued bool
+	if bg {
+		queued = mpt.enqueueBackground(op)
+	} else {
+		queued = mpt.enqueue(mpt.pinCh, op)
+	}
+	if !queued {
+		mpt.optracker.Finish(op)
 		err := errors.New("pin queue is full")
 		mpt.setError(c.Cid, err)
 		logger.Error(err.Error())
@@ -252,14 +557,130 @@ func (mpt *MapPinTracker) Track(c api.Pin) error {
 	return nil
 }
 
+// trackMeta tracks every shard of a MetaType pin as an independent
+// ShardType pin. The meta pin itself is not pinned in IPFS. Shards
+// which are no longer part of it are untracked.
+func (mpt *MapPinTracker) trackMeta(c api.Pin, bg bool) error {
+	mpt.mux.Lock()
+	old, ok := mpt.metas[c.Cid.String()]
+	mpt.metas[c.Cid.String()] = c
+	mpt.mux.Unlock()
+
+	var err error
+	for _, sh := range c.ShardPins() {
+		if e := mpt.track(sh, bg); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if ok {
+		for _, sh := range old.Shards {
+			if !util.HasShard(c, sh) {
+				mpt.untrack(sh, bg)
+			}
+		}
+	}
+	return err
+}
+
+// untrackMeta untracks the shards of a MetaType pin. It returns false
+// when the Cid is not a tracked MetaType pin.
+func (mpt *MapPinTracker) untrackMeta(c *cid.Cid, bg bool) (bool, error) {
+	mpt.mux.Lock()
+	meta, ok := mpt.metas[c.String()]
+	delete(mpt.metas, c.String())
+	mpt.mux.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	var err error
+	for _, sh := range meta.Shards {
+		if e := mpt.untrack(sh, bg); e != nil && err == nil {
+			err = e
+		}
+	}
+	return true, err
+}
+
+// getMeta returns the tracked MetaType pin for a Cid.
+func (mpt *MapPinTracker) getMeta(c *cid.Cid) (api.Pin, bool) {
+	mpt.mux.RLock()
+	defer mpt.mux.RUnlock()
+	meta, ok := mpt.metas[c.String()]
+	return meta, ok
+}
+
+// metaStatus aggregates the status of the shards of a MetaType pin.
+func (mpt *MapPinTracker) metaStatus(meta api.Pin) api.PinInfo {
+	shards := make([]api.PinInfo, 0, len(meta.Shards))
+	for _, sh := range meta.Shards {
+		shards = append(shards, mpt.get(sh))
+	}
+	return api.ShardedPinInfo(meta.Cid, mpt.peerID, shards)
+}
+
 // Untrack tells the MapPinTracker to stop managing a Cid.
 // If the Cid is pinned locally, it will be unpinned.
 func (mpt *MapPinTracker) Untrack(c *cid.Cid) error {
+	return mpt.untrack(c, false)
+}
+
+// UntrackInBackground works like Untrack, but the resulting Unpin
+// operation is queued along with other background maintenance
+// operations.
+func (mpt *MapPinTracker) UntrackInBackground(c *cid.Cid) error {
+	return mpt.untrack(c, true)
+}
+
+func (mpt *MapPinTracker) untrack(c *cid.Cid, bg bool) error {
 	logger.Debugf("untracking %s", c)
+	if ok, err := mpt.untrackMeta(c, bg); ok {
+		return err
+	}
+	if mpt.config.UnpinGracePeriod > 0 && mpt.trash(c) {
+		return nil
+	}
+	return mpt.unpinInQueue(c, bg)
+}
+
+// unpinInQueue queues an unpin operation for a Cid.
+func (mpt *MapPinTracker) unpinInQueue(c *cid.Cid, bg bool) error {
+	op := mpt.newOperation(api.PinCid(c), optracker.OperationUnpin)
+	if op == nil {
+		logger.Debugf("%s is already being unpinned", c)
+		return nil
+	}
+	return mpt.enqueueUnpin(op, bg)
+}
+
+// CancelPin replaces the pin of a Cid which is queued or in progress
+// with an unpin. It fails when the pin has finished already.
+func (mpt *MapPinTracker) CancelPin(c *cid.Cid) error {
+	old, ok := mpt.optracker.Get(c)
+	op := mpt.optracker.CancelPin(c)
+	if op == nil {
+		return fmt.Errorf("%s is not being pinned", c)
+	}
+	if ok && old.Phase() == optracker.PhaseInProgress {
+		util.CancelIPFS(mpt.rpcClient, c)
+	}
+	logger.Infof("cancelling the pin of %s", c)
+	return mpt.enqueueUnpin(op, false)
+}
+
+// enqueueUnpin queues a new unpin operation.
+func (mpt *MapPinTracker) enqueueUnpin(op *optracker.Operation, bg bool) error {
+	c := op.Cid()
 	mpt.set(c, api.TrackerStatusUnpinning)
-	select {
-	case mpt.unpinCh <- api.PinCid(c):
-	default:
+	var queued bool
+	if bg {
+		queued = mpt.enqueueBackground(op)
+	} else {
+		queued = mpt.enqueue(mpt.unpinCh, op)
+	}
+	if !queued {
+		mpt.optracker.Finish(op)
 		err := errors.New("unpin queue is full")
 		mpt.setError(c, err)
 		logger.Error(err.Error())
@@ -268,20 +689,93 @@ func (mpt *MapPinTracker) Untrack(c *cid.Cid) error {
 	return nil
 }
 
+// trash marks a pinned Cid as trashed instead of unpinning it. It is
+// unpinned once UnpinGracePeriod is over, unless it is tracked again
+// before. It returns false when the Cid is not pinned, and should be
+// unpinned right away.
+func (mpt *MapPinTracker) trash(c *cid.Cid) bool {
+	mpt.mux.Lock()
+	switch mpt.unsafeGet(c).Status {
+	case api.TrackerStatusTrashed:
+		mpt.mux.Unlock()
+		return true
+	case api.TrackerStatusPinned, api.TrackerStatusPinnedIndirect:
+	default:
+		mpt.mux.Unlock()
+		return false
+	}
+	mpt.unsafeSet(c, api.TrackerStatusTrashed)
+	ts := mpt.unsafeGet(c).TS
+	mpt.mux.Unlock()
+
+	mpt.scheduleEmptyTrash(c, ts, mpt.config.UnpinGracePeriod)
+	return true
+}
+
+func (mpt *MapPinTracker) scheduleEmptyTrash(c *cid.Cid, ts time.Time, wait time.Duration) {
+	util.ScheduleEmptyTrash(c, wait, func() { mpt.emptyTrash(c, ts) })
+}
+
+// emptyTrash unpins a trashed Cid, unless it has been tracked again
+// since it was trashed at ts.
+func (mpt *MapPinTracker) emptyTrash(c *cid.Cid, ts time.Time) {
+	if mpt.ctx.Err() != nil {
+		return
+	}
+
+	p := mpt.get(c)
+	if p.Status != api.TrackerStatusTrashed || !p.TS.Equal(ts) {
+		return
+	}
+	logger.Infof("grace period for %s is over. Unpinning", c)
+	mpt.unpinInQueue(c, true)
+}
+
+// enqueue sends an operation to a user queue. When the queue is full, it
+// waits up to EnqueueTimeout for the workers to make room.
+func (mpt *MapPinTracker) enqueue(queue chan *optracker.Operation, op *optracker.Operation) bool {
+	return util.Enqueue(mpt.ctx, queue, op, mpt.config.EnqueueTimeout)
+}
+
+// enqueueBackground sends an operation to the background queue, unless
+// it is full.
+func (mpt *MapPinTracker) enqueueBackground(op *optracker.Operation) bool {
+	return util.Enqueue(mpt.ctx, mpt.bgCh, op, 0)
+}
+
 // Status returns information for a Cid tracked by this
-// MapPinTracker.
+// MapPinTracker. The status of MetaType pins is aggregated from
+// that of their shards.
 func (mpt *MapPinTracker) Status(c *cid.Cid) api.PinInfo {
+	if meta, ok := mpt.getMeta(c); ok {
+		return mpt.metaStatus(meta)
+	}
 	return mpt.get(c)
 }
 
 // StatusAll returns information for all Cids tracked by this
-// MapPinTracker.
+// MapPinTracker. Shards of MetaType pins are not listed on their
+// own, but aggregated into the status of their parent.
 func (mpt *MapPinTracker) StatusAll() []api.PinInfo {
-	mpt.mux.Lock()
-	defer mpt.mux.Unlock()
-	pins := make([]api.PinInfo, 0, len(mpt.status))
-	for _, v := range mpt.status {
-		pins = append(pins, v)
+	mpt.mux.RLock()
+	metas := make([]api.Pin, 0, len(mpt.metas))
+	shards := make(map[string]struct{})
+	for _, meta := range mpt.metas {
+		metas = append(metas, meta)
+		for _, sh := range meta.Shards {
+			shards[sh.String()] = struct{}{}
+		}
+	}
+	pins := make([]api.PinInfo, 0, len(mpt.status)+len(metas))
+	for k, v := range mpt.status {
+		if _, ok := shards[k]; !ok {
+			pins = append(pins, v)
+		}
+	}
+	mpt.mux.RUnlock()
+
+	for _, meta := range metas {
+		pins = append(pins, mpt.metaStatus(meta))
 	}
 	return pins
 }
@@ -295,12 +789,17 @@ func (mpt *MapPinTracker) StatusAll() []api.PinInfo {
 // An error is returned if we are unable to contact
 // the IPFS daemon.
 func (mpt *MapPinTracker) Sync(c *cid.Cid) (api.PinInfo, error) {
-	var ips api.IPFSPinStatus
-	err := mpt.rpcClient.Call("",
-		"Cluster",
-		"IPFSPinLsCid",
-		api.PinCid(c).ToSerial(),
-		&ips)
+	if meta, ok := mpt.getMeta(c); ok {
+		var err error
+		for _, sh := range meta.Shards {
+			if _, e := mpt.Sync(sh); e != nil && err == nil {
+				err = e
+			}
+		}
+		return mpt.metaStatus(meta), err
+	}
+
+	ips, err := util.IPFSPinLsCid(mpt.rpcClient, c)
 	if err != nil {
 		mpt.setError(c, err)
 		return mpt.get(c), err
@@ -312,6 +811,11 @@ func (mpt *MapPinTracker) Sync(c *cid.Cid) (api.PinInfo, error) {
 // one reported by the IPFS daemon. If not, they will be transitioned
 // to PinError or UnpinError.
 //
+// The recursive pinset is fetched from IPFS once and compared with the
+// tracked items. Only the items which do not match it are synced, and
+// only those which may be pinned indirectly are asked about one by one,
+// so syncing large pinsets is mostly a map lookup per item.
+//
 // SyncAll returns the list of local status for all tracked Cids which
 // were updated or have errors. Cids in error states can be recovered
 // with Recover().
@@ -335,17 +839,32 @@ func (mpt *MapPinTracker) SyncAll() ([]api.PinInfo, error) {
 		return pInfos, err
 	}
 
-	status := mpt.StatusAll()
-	for _, pInfoOrig := range status {
-		var pInfoNew api.PinInfo
+	mpt.mux.RLock()
+	var mismatched []api.PinInfo
+	for k, p := range mpt.status {
+		if needsSync(p.Status, ipsMap[k]) {
+			mismatched = append(mismatched, p)
+		}
+	}
+	mpt.mux.RUnlock()
+
+	for _, pInfoOrig := range mismatched {
 		c := pInfoOrig.Cid
 		ips, ok := ipsMap[c.String()]
 		if !ok {
-			pInfoNew = mpt.syncStatus(c, api.IPFSPinStatusUnpinned)
-		} else {
-			pInfoNew = mpt.syncStatus(c, ips)
+			ips = api.IPFSPinStatusUnpinned
+		}
+		if !ok && mayBeIndirect(pInfoOrig.Status) {
+			// indirect pins are not listed. Ask for this one.
+			ips, err = util.IPFSPinLsCid(mpt.rpcClient, c)
+			if err != nil {
+				mpt.setError(c, err)
+				pInfos = append(pInfos, mpt.get(c))
+				continue
+			}
 		}
 
+		pInfoNew := mpt.syncStatus(c, ips)
 		if pInfoOrig.Status != pInfoNew.Status ||
 			pInfoNew.Status == api.TrackerStatusUnpinError ||
 			pInfoNew.Status == api.TrackerStatusPinError {
@@ -355,16 +874,54 @@ func (mpt *MapPinTracker) SyncAll() ([]api.PinInfo, error) {
 	return pInfos, nil
 }
 
+// needsSync returns false when the status of an item already matches
+// the status of its Cid in the recursive pinset of IPFS, so that syncing
+// it would not change anything.
+func needsSync(st api.TrackerStatus, ips api.IPFSPinStatus) bool {
+	switch st {
+	case api.TrackerStatusPinned:
+		return !ips.IsPinned()
+	case api.TrackerStatusRemote, api.TrackerStatusRemoteError, api.TrackerStatusTrashed:
+		return false
+	default:
+		// ongoing operations may time out, and errors are
+		// always reported.
+		return true
+	}
+}
+
+// mayBeIndirect returns true for the statuses which become
+// PinnedIndirect when IPFS pins the Cid indirectly.
+func mayBeIndirect(st api.TrackerStatus) bool {
+	switch st {
+	case api.TrackerStatusPinned, api.TrackerStatusPinnedIndirect, api.TrackerStatusPinError:
+		return true
+	default:
+		return false
+	}
+}
+
 func (mpt *MapPinTracker) syncStatus(c *cid.Cid, ips api.IPFSPinStatus) api.PinInfo {
 	p := mpt.get(c)
+	if ips == api.IPFSPinStatusIndirect {
+		switch p.Status {
+		case api.TrackerStatusPinned, api.TrackerStatusPinError:
+			mpt.set(c, api.TrackerStatusPinnedIndirect)
+		case api.TrackerStatusUnpinning, api.TrackerStatusUnpinError:
+			mpt.set(c, api.TrackerStatusUnpinned)
+		default: // nothing
+		}
+		return mpt.get(c)
+	}
+
 	if ips.IsPinned() {
 		switch p.Status {
 		case api.TrackerStatusPinned: // nothing
-		case api.TrackerStatusPinning, api.TrackerStatusPinError:
+		case api.TrackerStatusPinnedIndirect, api.TrackerStatusPinning, api.TrackerStatusPinError:
 			mpt.set(c, api.TrackerStatusPinned)
 		case api.TrackerStatusUnpinning:
 			if time.Since(p.TS) > mpt.config.UnpinningTimeout {
-				mpt.setError(c, errUnpinningTimeout)
+				mpt.setError(c, util.ErrUnpinningTimeout)
 			}
 		case api.TrackerStatusUnpinned:
 			mpt.setError(c, errPinned)
@@ -373,12 +930,12 @@ func (mpt *MapPinTracker) syncStatus(c *cid.Cid, ips api.IPFSPinStatus) api.PinI
 		}
 	} else {
 		switch p.Status {
-		case api.TrackerStatusPinned:
+		case api.TrackerStatusPinned, api.TrackerStatusPinnedIndirect:
 			mpt.setError(c, errUnpinned)
 		case api.TrackerStatusPinError: // nothing, keep error as it was
 		case api.TrackerStatusPinning:
 			if time.Since(p.TS) > mpt.config.PinningTimeout {
-				mpt.setError(c, errPinningTimeout)
+				mpt.setError(c, util.ErrPinningTimeout)
 			}
 		case api.TrackerStatusUnpinning, api.TrackerStatusUnpinError:
 			mpt.set(c, api.TrackerStatusUnpinned)
@@ -389,22 +946,49 @@ func (mpt *MapPinTracker) syncStatus(c *cid.Cid, ips api.IPFSPinStatus) api.PinI
 	return mpt.get(c)
 }
 
+// Keepalive refreshes the timestamp of a Cid in pinning status and
+// records its progress. The pinning timeout counts from the last
+// keepalive, so pins which take very long but keep making progress are
+// not considered hung.
+func (mpt *MapPinTracker) Keepalive(pp api.PinProgress) {
+	mpt.mux.Lock()
+	defer mpt.mux.Unlock()
+	p := mpt.unsafeGet(pp.Cid)
+	if p.Status != api.TrackerStatusPinning {
+		return
+	}
+	p.TS = time.Now()
+	p.Blocks = pp.Blocks
+	p.Size = pp.Size
+	mpt.status[pp.Cid.String()] = p
+}
+
 // Recover will re-track or re-untrack a Cid in error state,
 // possibly retriggering an IPFS pinning operation and returning
 // only when it is done. The pinning/unpinning operation happens
 // synchronously, jumping the queues.
 func (mpt *MapPinTracker) Recover(c *cid.Cid) (api.PinInfo, error) {
-	p := mpt.get(c)
-	logger.Infof("Attempting to recover %s", c)
+	if meta, ok := mpt.getMeta(c); ok {
+		var err error
+		for _, sh := range meta.Shards {
+			if _, e := mpt.Recover(sh); e != nil && err == nil {
+				err = e
+			}
+		}
+		return mpt.metaStatus(meta), err
+	}
+
+	op, ok := mpt.recoveryOp(c)
+	if !ok {
+		return mpt.get(c), nil
+	}
 	var err error
-	switch p.Status {
-	case api.TrackerStatusPinError:
-		err = mpt.pin(api.Pin{Cid: c})
-	case api.TrackerStatusUnpinError:
-		err = mpt.unpin(api.Pin{Cid: c})
+	switch {
+	case op == nil: // already queued or in progress
+	case op.Type() == optracker.OperationPin:
+		err = mpt.pin(op)
 	default:
-		logger.Warningf("%s does not need recovery. Try syncing first", c)
-		return p, nil
+		err = mpt.unpin(op)
 	}
 	if err != nil {
 		logger.Errorf("error recovering %s: %s", c, err)
@@ -412,6 +996,55 @@ func (mpt *MapPinTracker) Recover(c *cid.Cid) (api.PinInfo, error) {
 	return mpt.get(c), err
 }
 
+// RecoverInBackground works like Recover, but the resulting Pin or Unpin
+// operation is queued along with other background maintenance operations,
+// and it returns without waiting for it.
+func (mpt *MapPinTracker) RecoverInBackground(c *cid.Cid) error {
+	if meta, ok := mpt.getMeta(c); ok {
+		var err error
+		for _, sh := range meta.Shards {
+			if e := mpt.RecoverInBackground(sh); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+
+	op, _ := mpt.recoveryOp(c)
+	if op == nil {
+		return nil
+	}
+	if op.Type() == optracker.OperationPin {
+		mpt.set(c, api.TrackerStatusPinning)
+	} else {
+		mpt.set(c, api.TrackerStatusUnpinning)
+	}
+	if !mpt.enqueueBackground(op) {
+		mpt.optracker.Finish(op)
+		err := errors.New("background queue is full")
+		mpt.setError(c, err)
+		logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// recoveryOp returns a new operation to recover a Cid in error state.
+// It returns false when the Cid does not need recovery, and a nil
+// operation when one is already queued or in progress.
+func (mpt *MapPinTracker) recoveryOp(c *cid.Cid) (*optracker.Operation, bool) {
+	logger.Infof("Attempting to recover %s", c)
+	switch mpt.get(c).Status {
+	case api.TrackerStatusPinError:
+		return mpt.newOperation(api.Pin{Cid: c}, optracker.OperationPin), true
+	case api.TrackerStatusUnpinError:
+		return mpt.newOperation(api.Pin{Cid: c}, optracker.OperationUnpin), true
+	default:
+		logger.Warningf("%s does not need recovery. Try syncing first", c)
+		return nil, false
+	}
+}
+
 // RecoverAll attempts to recover all items tracked by this peer.
 func (mpt *MapPinTracker) RecoverAll() ([]api.PinInfo, error) {
 	statuses := mpt.StatusAll()
@@ -426,9 +1059,158 @@ func (mpt *MapPinTracker) RecoverAll() ([]api.PinInfo, error) {
 	return resp, nil
 }
 
+// verifyRemote asks the peers allocated to every remote item for its
+// status. Items which are not pinned (or being pinned) by all of them
+// become remote errors, and go back to remote once they are.
+func (mpt *MapPinTracker) verifyRemote() {
+	mpt.mux.RLock()
+	remotes := make(map[string][]peer.ID, len(mpt.remotes))
+	for k, allocs := range mpt.remotes {
+		remotes[k] = allocs
+	}
+	mpt.mux.RUnlock()
+
+	for k, allocs := range remotes {
+		if mpt.ctx.Err() != nil {
+			return
+		}
+		c, _ := cid.Decode(k)
+		err := util.CheckRemote(mpt.rpcClient, c, allocs)
+
+		mpt.mux.Lock()
+		p := mpt.unsafeGet(c)
+		switch {
+		case p.Status != api.TrackerStatusRemote && p.Status != api.TrackerStatusRemoteError:
+			// tracked locally or untracked in the meantime
+		case err != nil:
+			if p.Status != api.TrackerStatusRemoteError || p.Error != err.Error() {
+				logger.Warningf("remote pin verification failed for %s: %s", c, err)
+				p = api.PinInfo{
+					Cid:    c,
+					Peer:   mpt.peerID,
+					Status: api.TrackerStatusRemoteError,
+					TS:     time.Now(),
+					Error:  err.Error(),
+				}
+				mpt.status[k] = p
+				mpt.sendEvent(p)
+			}
+		case p.Status == api.TrackerStatusRemoteError:
+			logger.Infof("%s is pinned by its allocations again", c)
+			mpt.unsafeSet(c, api.TrackerStatusRemote)
+		}
+		mpt.mux.Unlock()
+	}
+}
+
+// persist saves the items with queued, ongoing or failed operations.
+func (mpt *MapPinTracker) persist() {
+	mpt.mux.RLock()
+	infos := make([]api.PinInfo, 0, len(mpt.status))
+	for _, p := range mpt.status {
+		infos = append(infos, p)
+	}
+	mpt.mux.RUnlock()
+
+	util.Persist(mpt.store, infos)
+}
+
+// resume queues again an operation which was pending, or restores a
+// failed one, scheduling the next retry of failed pins.
+func (mpt *MapPinTracker) resume(p api.PinInfo) bool {
+	c := api.PinCid(p.Cid)
+	p.Peer = mpt.peerID
+
+	mpt.mux.Lock()
+	if _, ok := mpt.status[p.Cid.String()]; ok {
+		mpt.mux.Unlock()
+		return false
+	}
+
+	switch p.Status {
+	case api.TrackerStatusPinning, api.TrackerStatusUnpinning:
+		typ := optracker.OperationPin
+		if p.Status == api.TrackerStatusUnpinning {
+			typ = optracker.OperationUnpin
+		}
+		op := mpt.newOperation(c, typ)
+		if op == nil {
+			mpt.mux.Unlock()
+			return false
+		}
+		if typ == optracker.OperationPin {
+			mpt.unsafeSetPinning(p.Cid, p.Attempts)
+		} else {
+			mpt.unsafeSet(p.Cid, api.TrackerStatusUnpinning)
+		}
+		mpt.mux.Unlock()
+
+		op.SetAttempts(p.Attempts)
+		if !mpt.enqueueBackground(op) {
+			mpt.optracker.Finish(op)
+			mpt.setError(p.Cid, errors.New("pin queue is full"))
+		}
+	case api.TrackerStatusPinError:
+		mpt.status[p.Cid.String()] = p
+		mpt.sendEvent(p)
+		mpt.mux.Unlock()
+		// only failed pin attempts are retried, not errors found
+		// when syncing.
+		if p.Attempts > 0 && p.Attempts <= mpt.config.MaxRetries {
+			mpt.scheduleRetry(c, p.Attempts, errors.New(p.Error))
+		}
+	case api.TrackerStatusUnpinError:
+		mpt.status[p.Cid.String()] = p
+		mpt.sendEvent(p)
+		mpt.mux.Unlock()
+	case api.TrackerStatusTrashed:
+		mpt.status[p.Cid.String()] = p
+		mpt.sendEvent(p)
+		mpt.mux.Unlock()
+		// the grace period counts from when it was trashed
+		mpt.scheduleEmptyTrash(p.Cid, p.TS, time.Until(p.TS.Add(mpt.config.UnpinGracePeriod)))
+	default:
+		mpt.mux.Unlock()
+		return false
+	}
+	return true
+}
+
+// Metrics returns the lengths of the queues, the number of IPFS requests
+// in progress and of items in error state, and the retry and pin
+// counters of this tracker.
+func (mpt *MapPinTracker) Metrics() api.TrackerMetrics {
+	m := api.TrackerMetrics{
+		Peer:            mpt.peerID,
+		PinQueue:        len(mpt.pinCh),
+		UnpinQueue:      len(mpt.unpinCh),
+		BackgroundQueue: len(mpt.bgCh),
+	}
+
+	mpt.mux.RLock()
+	for _, p := range mpt.status {
+		switch p.Status {
+		case api.TrackerStatusPinError:
+			m.PinErrors++
+		case api.TrackerStatusUnpinError:
+			m.UnpinErrors++
+		}
+	}
+	mpt.mux.RUnlock()
+
+	mpt.counters.Fill(&m)
+	return m
+}
+
+// Events returns a channel on which an event is sent every time the
+// status of an item changes.
+func (mpt *MapPinTracker) Events() <-chan api.PinEvent {
+	return mpt.events
+}
+
 // SetClient makes the MapPinTracker ready to perform RPC requests to
 // other components.
 func (mpt *MapPinTracker) SetClient(c *rpc.Client) {
 	mpt.rpcClient = c
-	mpt.rpcReady <- struct{}{}
+	close(mpt.rpcReady)
 }
@@ -1,13 +1,19 @@
 package maptracker
 
 import (
+	"io/ioutil"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+	"github.com/ipfs/ipfs-cluster/pintracker/util"
 	"github.com/ipfs/ipfs-cluster/test"
 )
 
@@ -36,6 +42,90 @@ func TestShutdown(t *testing.T) {
 	}
 }
 
+func TestSetConcurrentPins(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	err := mpt.SetConcurrentPins(0)
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	err = mpt.SetConcurrentPins(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mpt.workers != 3 || mpt.config.ConcurrentPins != 3 {
+		t.Error("expected 3 workers")
+	}
+
+	err = mpt.SetConcurrentPins(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mpt.workers != 1 || mpt.config.ConcurrentPins != 1 {
+		t.Error("expected 1 worker")
+	}
+
+	h, _ := cid.Decode(test.TestCid1)
+	c := api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+	}
+	err = mpt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if mpt.Status(h).Status != api.TrackerStatusPinned {
+		t.Error("expected pin to be processed by the remaining worker")
+	}
+}
+
+func TestTrackQueueFull(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MaxPinQueueSize = 1
+	cfg.EnqueueTimeout = 200 * time.Millisecond
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(test.NewMockRPCClient(t))
+	defer mpt.Shutdown()
+
+	// leave no workers to process the queue
+	mpt.stopWorkers(1)
+	time.Sleep(100 * time.Millisecond)
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	err := mpt.Track(api.Pin{Cid: h1, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = mpt.Track(api.Pin{Cid: h2, ReplicationFactor: -1})
+	if err == nil {
+		t.Fatal("expected an error with a full queue")
+	}
+	if time.Since(start) < cfg.EnqueueTimeout {
+		t.Error("expected Track to wait for room in the queue")
+	}
+	if mpt.Status(h2).Status != api.TrackerStatusPinError {
+		t.Error("expected pin error")
+	}
+
+	// a worker makes room while waiting
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mpt.startWorkers(1)
+	}()
+	err = mpt.Track(api.Pin{Cid: h2, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestTrack(t *testing.T) {
 	mpt := testMapPinTracker(t)
 	defer mpt.Shutdown()
@@ -80,6 +170,215 @@ func TestTrack(t *testing.T) {
 	}
 }
 
+// slowPinService blocks pins of TestCid1 until released and records
+// the order of pin requests.
+type slowPinService struct {
+	release chan struct{}
+
+	mu   sync.Mutex
+	pins []string
+}
+
+func (mock *slowPinService) IPFSPin(in api.PinSerial, out *struct{}) error {
+	if in.Cid == test.TestCid1 {
+		<-mock.release
+	}
+	mock.mu.Lock()
+	mock.pins = append(mock.pins, in.Cid)
+	mock.mu.Unlock()
+	return nil
+}
+
+func (mock *slowPinService) IPFSUnpin(in api.PinSerial, out *struct{}) error {
+	return nil
+}
+
+func TestTrackIndirect(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	h, _ := cid.Decode(test.IndirectCid)
+	c := api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+	}
+
+	err := mpt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	st := mpt.Status(h)
+	if st.Status != api.TrackerStatusPinnedIndirect {
+		t.Fatalf("cid should be pinned_indirect and is %s", st.Status)
+	}
+
+	// Sync should not report it as unpinned
+	st, err = mpt.Sync(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != api.TrackerStatusPinnedIndirect {
+		t.Errorf("cid should still be pinned_indirect and is %s", st.Status)
+	}
+
+	infos, err := mpt.SyncAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("nothing should have changed: %+v", infos)
+	}
+}
+
+func TestTrackInBackground(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	defer mpt.Shutdown()
+
+	slow := &slowPinService{release: make(chan struct{})}
+	s := rpc.NewServer(nil, "mock")
+	err := s.RegisterName("Cluster", slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt.SetClient(rpc.NewClientWithServer(nil, "mock", s))
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	h3, _ := cid.Decode(test.TestCid3)
+	localPin := func(h *cid.Cid) api.Pin {
+		return api.Pin{Cid: h, ReplicationFactor: -1}
+	}
+
+	// block the only background worker
+	err = mpt.TrackInBackground(localPin(h1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mpt.TrackInBackground(localPin(h3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user requests are not delayed
+	err = mpt.Track(localPin(h2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if st := mpt.Status(h2).Status; st != api.TrackerStatusPinned {
+		t.Errorf("user pin should be pinned and is %s", st)
+	}
+	// the idle pin worker takes the waiting background pin
+	if st := mpt.Status(h3).Status; st != api.TrackerStatusPinned {
+		t.Errorf("background pin should be pinned and is %s", st)
+	}
+
+	close(slow.release)
+	time.Sleep(100 * time.Millisecond)
+
+	if st := mpt.Status(h1).Status; st != api.TrackerStatusPinned {
+		t.Errorf("background pin should be pinned and is %s", st)
+	}
+
+	err = mpt.UntrackInBackground(h3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := mpt.Status(h3).Status; st != api.TrackerStatusUnpinned {
+		t.Errorf("background unpin should be done and is %s", st)
+	}
+}
+
+func TestPriorityRatio(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.PriorityRatio = 1
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	defer mpt.Shutdown()
+
+	slow := &slowPinService{release: make(chan struct{})}
+	defer close(slow.release)
+	s := rpc.NewServer(nil, "mock")
+	err := s.RegisterName("Cluster", slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt.SetClient(rpc.NewClientWithServer(nil, "mock", s))
+
+	localPin := func(c string) api.Pin {
+		h, _ := cid.Decode(c)
+		return api.Pin{Cid: h, ReplicationFactor: -1}
+	}
+
+	// no pin workers while the queues fill up
+	mpt.stopWorkers(1)
+	time.Sleep(100 * time.Millisecond)
+
+	// block the only background worker
+	mpt.TrackInBackground(localPin(test.TestCid1))
+	time.Sleep(50 * time.Millisecond)
+
+	mpt.Track(localPin(test.TestCid2))
+	mpt.Track(localPin(test.TestCid3))
+	mpt.TrackInBackground(localPin(test.ErrorCid))
+	mpt.TrackInBackground(localPin(test.AllocErrorCid))
+
+	mpt.startWorkers(1)
+	time.Sleep(100 * time.Millisecond)
+
+	expected := []string{test.TestCid2, test.ErrorCid, test.TestCid3, test.AllocErrorCid}
+	slow.mu.Lock()
+	defer slow.mu.Unlock()
+	if len(slow.pins) != len(expected) {
+		t.Fatalf("expected %d pins and got %d", len(expected), len(slow.pins))
+	}
+	for i, c := range expected {
+		if slow.pins[i] != c {
+			t.Errorf("unexpected pin order: %v", slow.pins)
+			break
+		}
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid1)
+	mpt.set(h, api.TrackerStatusPinning)
+	ts := mpt.Status(h).TS
+	time.Sleep(10 * time.Millisecond)
+	mpt.Keepalive(api.PinProgress{Cid: h, Blocks: 40, Size: 1000})
+	p := mpt.Status(h)
+	if !p.TS.After(ts) {
+		t.Error("keepalive should refresh the timestamp of a pinning item")
+	}
+	if p.Blocks != 40 || p.Size != 1000 {
+		t.Error("keepalive should record the pin progress")
+	}
+
+	mpt.set(h, api.TrackerStatusPinned)
+	p = mpt.Status(h)
+	if p.Blocks != 0 || p.Size != 0 {
+		t.Error("progress should only be reported while pinning")
+	}
+	ts = p.TS
+	time.Sleep(10 * time.Millisecond)
+	mpt.Keepalive(api.PinProgress{Cid: h, Blocks: 50})
+	if !mpt.Status(h).TS.Equal(ts) {
+		t.Error("keepalive should only affect pinning items")
+	}
+}
+
 func TestUntrack(t *testing.T) {
 	mpt := testMapPinTracker(t)
 	defer mpt.Shutdown()
@@ -138,6 +437,109 @@ func TestUntrack(t *testing.T) {
 	}
 }
 
+func TestTrackMeta(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	h3, _ := cid.Decode(test.TestCid3)
+
+	c := api.Pin{
+		Cid:               h1,
+		Type:              api.MetaType,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+		Shards:            []*cid.Cid{h2, h3},
+	}
+	err := mpt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond) // let shards be pinned
+
+	if st := mpt.Status(h1); st.Status != api.TrackerStatusPinned {
+		t.Errorf("meta pin should be pinned and is %s", st.Status)
+	}
+	if st := mpt.Status(h2); st.Status != api.TrackerStatusPinned {
+		t.Errorf("shard should be pinned and is %s", st.Status)
+	}
+
+	all := mpt.StatusAll()
+	if len(all) != 1 || !all[0].Cid.Equals(h1) {
+		t.Fatal("StatusAll should only list the meta pin")
+	}
+
+	// Drop a shard
+	c.Shards = []*cid.Cid{h2}
+	err = mpt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := mpt.Status(h3); st.Status != api.TrackerStatusUnpinned {
+		t.Errorf("dropped shard should be unpinned and is %s", st.Status)
+	}
+
+	err = mpt.Untrack(h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := mpt.Status(h2); st.Status != api.TrackerStatusUnpinned {
+		t.Errorf("shard should be unpinned and is %s", st.Status)
+	}
+	if st := mpt.Status(h1); st.Status != api.TrackerStatusUnpinned {
+		t.Errorf("meta pin should be unpinned and is %s", st.Status)
+	}
+}
+
+func TestUnpinGracePeriod(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+	mpt.config.UnpinGracePeriod = 300 * time.Millisecond
+
+	h, _ := cid.Decode(test.TestCid1)
+	c := api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+	}
+	err := mpt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	err = mpt.Untrack(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := mpt.Status(h); st.Status != api.TrackerStatusTrashed {
+		t.Fatalf("cid should be trashed and is %s", st.Status)
+	}
+
+	// pinning it again takes it out of the trash
+	err = mpt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if st := mpt.Status(h); st.Status != api.TrackerStatusPinned {
+		t.Fatalf("cid should be pinned and is %s", st.Status)
+	}
+
+	err = mpt.Untrack(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if st := mpt.Status(h); st.Status != api.TrackerStatusUnpinned {
+		t.Fatalf("cid should be unpinned and is %s", st.Status)
+	}
+}
+
 func TestStatusAll(t *testing.T) {
 	mpt := testMapPinTracker(t)
 	defer mpt.Shutdown()
@@ -169,6 +571,170 @@ func TestStatusAll(t *testing.T) {
 	}
 }
 
+func TestPinTimeout(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.PinTimeout = 100 * time.Millisecond
+	cfg.MaxRetries = 0
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(test.NewMockRPCClient(t))
+	defer mpt.Shutdown()
+
+	slow, _ := cid.Decode(test.SlowCid1)
+	err := mpt.Track(api.Pin{Cid: slow, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	st := mpt.Status(slow)
+	if st.Status != api.TrackerStatusPinError || st.Error != util.ErrPinTimeout.Error() {
+		t.Errorf("expected a pin timeout error: %s: %s", st.Status, st.Error)
+	}
+
+	// the only worker is free again
+	h, _ := cid.Decode(test.TestCid1)
+	err = mpt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if mpt.Status(h).Status != api.TrackerStatusPinned {
+		t.Error("expected the worker to process the next pin")
+	}
+}
+
+func TestTrackDuplicate(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	slow, _ := cid.Decode(test.SlowCid1)
+	err := mpt.Track(api.Pin{Cid: slow, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	op, ok := mpt.optracker.Get(slow)
+	if !ok || op.Phase() != optracker.PhaseInProgress {
+		t.Fatal("expected a pin operation in progress")
+	}
+
+	err = mpt.Track(api.Pin{Cid: slow, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op2, _ := mpt.optracker.Get(slow)
+	if op2 != op || op.Cancelled() {
+		t.Error("the duplicate pin should have been discarded")
+	}
+}
+
+func TestUntrackCancelsPin(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	slow, _ := cid.Decode(test.SlowCid1)
+	err := mpt.Track(api.Pin{Cid: slow, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	op, _ := mpt.optracker.Get(slow)
+
+	err = mpt.Untrack(slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !op.Cancelled() {
+		t.Error("the ongoing pin should have been cancelled")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if st := mpt.Status(slow).Status; st != api.TrackerStatusUnpinned {
+		t.Errorf("expected unpinned and got %s", st)
+	}
+	if _, ok := mpt.optracker.Get(slow); ok {
+		t.Error("no operations should be left")
+	}
+}
+
+func TestCancelPin(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	slow, _ := cid.Decode(test.SlowCid1)
+	err := mpt.Track(api.Pin{Cid: slow, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	op, _ := mpt.optracker.Get(slow)
+
+	err = mpt.CancelPin(slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !op.Cancelled() {
+		t.Error("the ongoing pin should have been cancelled")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := mpt.Status(slow).Status; st != api.TrackerStatusUnpinned {
+		t.Errorf("expected unpinned and got %s", st)
+	}
+
+	h, _ := cid.Decode(test.TestCid1)
+	err = mpt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	err = mpt.CancelPin(h)
+	if err == nil {
+		t.Error("expected an error cancelling a finished pin")
+	}
+	if st := mpt.Status(h).Status; st != api.TrackerStatusPinned {
+		t.Errorf("a finished pin should be left alone: %s", st)
+	}
+}
+
+func TestPinRetry(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = 50 * time.Millisecond
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(test.NewMockRPCClient(t))
+	defer mpt.Shutdown()
+
+	h, _ := cid.Decode(test.ErrorCid)
+	err := mpt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	st := mpt.Status(h)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 1 {
+		t.Errorf("expected pin_error after 1 attempt: %s, %d", st.Status, st.Attempts)
+	}
+
+	// retried after 50ms and 100ms
+	time.Sleep(400 * time.Millisecond)
+	st = mpt.Status(h)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 3 {
+		t.Errorf("expected pin_error after 3 attempts: %s, %d", st.Status, st.Attempts)
+	}
+
+	// tracking again resets the attempts
+	mpt.Untrack(h)
+	time.Sleep(50 * time.Millisecond)
+	mpt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+	time.Sleep(20 * time.Millisecond)
+	if mpt.Status(h).Attempts != 1 {
+		t.Error("expected attempts to be reset")
+	}
+}
+
 func TestSyncAndRecover(t *testing.T) {
 	mpt := testMapPinTracker(t)
 	defer mpt.Shutdown()
@@ -247,6 +813,37 @@ func TestRecoverAll(t *testing.T) {
 	}
 }
 
+func TestRecoverInBackground(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+
+	c := api.Pin{Cid: h1, Allocations: []peer.ID{}, ReplicationFactor: -1}
+	mpt.Track(c)
+	time.Sleep(100 * time.Millisecond)
+	mpt.set(h1, api.TrackerStatusPinError)
+
+	err := mpt.RecoverInBackground(h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// items which are not in error are left alone
+	err = mpt.RecoverInBackground(h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if st := mpt.Status(h1).Status; st != api.TrackerStatusPinned {
+		t.Errorf("the pin should have been recovered and is %s", st)
+	}
+	if st := mpt.Status(h2).Status; st != api.TrackerStatusUnpinned {
+		t.Errorf("the item should not be tracked and is %s", st)
+	}
+}
+
 func TestSyncAll(t *testing.T) {
 	mpt := testMapPinTracker(t)
 	defer mpt.Shutdown()
@@ -279,4 +876,144 @@ func TestSyncAll(t *testing.T) {
 		t.Logf("%+v", synced)
 		t.Fatal("should have synced h2")
 	}
+
+	// pinned items which IPFS only pins indirectly are found too
+	h3, _ := cid.Decode(test.IndirectCid)
+	mpt.set(h3, api.TrackerStatusPinned)
+	synced, err = mpt.SyncAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, pinfo := range synced {
+		if pinfo.Cid.Equals(h3) && pinfo.Status == api.TrackerStatusPinnedIndirect {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("h3 should be pinned_indirect: %+v", synced)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maptracker-persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.BaseDir = dir
+	cfg.PersistFile = "pintracker.json"
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = time.Minute
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(test.NewMockRPCClient(t))
+
+	h1, _ := cid.Decode(test.ErrorCid)
+	h2, _ := cid.Decode(test.SlowCid1)
+	h3, _ := cid.Decode(test.TestCid1)
+	mpt.Track(api.Pin{Cid: h1, ReplicationFactor: -1})
+	time.Sleep(50 * time.Millisecond)
+	// the slow pin keeps the only pin worker busy so the last one
+	// stays queued
+	mpt.Track(api.Pin{Cid: h2, ReplicationFactor: -1})
+	mpt.Track(api.Pin{Cid: h3, ReplicationFactor: -1})
+	time.Sleep(50 * time.Millisecond)
+	if st := mpt.Status(h3).Status; st != api.TrackerStatusPinning {
+		t.Fatal("expected a queued pin:", st)
+	}
+	mpt.Shutdown()
+
+	cfg.RetryBackoff = 50 * time.Millisecond
+	mpt = NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(test.NewMockRPCClient(t))
+	defer mpt.Shutdown()
+
+	time.Sleep(20 * time.Millisecond)
+	st := mpt.Status(h1)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 1 {
+		t.Errorf("expected pin_error after 1 attempt: %s, %d", st.Status, st.Attempts)
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+	for _, h := range []*cid.Cid{h2, h3} {
+		if st := mpt.Status(h).Status; st != api.TrackerStatusPinned {
+			t.Errorf("expected %s to be pinned after resuming: %s", h, st)
+		}
+	}
+	// retried after 50ms and 100ms, keeping the previous attempt
+	st = mpt.Status(h1)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 3 {
+		t.Errorf("expected pin_error after 3 attempts: %s, %d", st.Status, st.Attempts)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid1)
+	mpt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+
+	expected := []api.PinEvent{
+		{PinInfo: api.PinInfo{Status: api.TrackerStatusPinning}, Queued: true},
+		{PinInfo: api.PinInfo{Status: api.TrackerStatusPinning}},
+		{PinInfo: api.PinInfo{Status: api.TrackerStatusPinned}},
+	}
+	for _, exp := range expected {
+		select {
+		case ev := <-mpt.Events():
+			if !ev.Cid.Equals(h) || ev.Status != exp.Status || ev.Queued != exp.Queued {
+				t.Errorf("expected %s (queued: %t), got %s (queued: %t)", exp.Status, exp.Queued, ev.Status, ev.Queued)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected an event")
+		}
+	}
+}
+
+func TestVerifyRemote(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.ErrorCid)
+	for _, h := range []*cid.Cid{h1, h2} {
+		err := mpt.Track(api.Pin{
+			Cid:               h,
+			Allocations:       []peer.ID{test.TestPeerID2},
+			ReplicationFactor: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mpt.verifyRemote()
+
+	if st := mpt.Status(h1); st.Status != api.TrackerStatusRemote {
+		t.Errorf("expected remote status: %s", st.Status)
+	}
+	st := mpt.Status(h2)
+	if st.Status != api.TrackerStatusRemoteError || st.Error == "" {
+		t.Errorf("expected remote_error status with an error: %+v", st)
+	}
+
+	// tracking it locally stops verifying it
+	err := mpt.Track(api.Pin{
+		Cid:               h2,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt.mux.RLock()
+	_, ok := mpt.remotes[h2.String()]
+	mpt.mux.RUnlock()
+	if ok {
+		t.Error("local items should not be verified")
+	}
 }
@@ -0,0 +1,124 @@
+// Package opstore saves the pin and unpin operations which are queued,
+// in progress or have failed in a PinTracker to a file, so that a
+// restarting peer can resume them instead of waiting for a full state
+// sync to find them again.
+package opstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/encryption"
+)
+
+// Store saves and loads the status of the pending and failed operations
+// of a PinTracker, as PinInfos, to and from a JSON file, which is
+// encrypted when the Store has an encryption key.
+type Store struct {
+	path   string
+	cipher *encryption.Cipher
+}
+
+// New returns a Store using the file in the given path. Relative paths
+// are taken relative to baseDir.
+func New(baseDir, path string) *Store {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	return &Store{path: path}
+}
+
+// EncryptWith makes the Store encrypt the saved operations with the
+// given key (see encryption.New). Files saved without encryption cannot
+// be loaded afterwards.
+func (s *Store) EncryptWith(key []byte) error {
+	c, err := encryption.New(key)
+	if err != nil {
+		return err
+	}
+	s.cipher = c
+	return nil
+}
+
+// Path returns the location of the file used by the Store.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Persistable returns whether items in the given status have an
+// operation which should be saved: queued or ongoing pins and unpins,
+// those which have failed and those waiting in the trash to be unpinned.
+func Persistable(st api.TrackerStatus) bool {
+	switch st {
+	case api.TrackerStatusPinning, api.TrackerStatusUnpinning,
+		api.TrackerStatusPinError, api.TrackerStatusUnpinError,
+		api.TrackerStatusTrashed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Save replaces the saved operations with the given ones. The file is
+// written to a temporary location first and then renamed, so it is never
+// left half-written.
+func (s *Store) Save(infos []api.PinInfo) error {
+	serials := make([]api.PinInfoSerial, len(infos), len(infos))
+	for i, pi := range infos {
+		serials[i] = pi.ToSerial()
+	}
+	data, err := json.Marshal(serials)
+	if err != nil {
+		return err
+	}
+	if s.cipher != nil {
+		data, err = s.cipher.Encrypt(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Load returns the saved operations. It returns none, and no error, when
+// nothing has been saved yet.
+func (s *Store) Load() ([]api.PinInfo, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.cipher != nil {
+		data, err = s.cipher.Decrypt(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt %s: %s", s.path, err)
+		}
+	}
+
+	var serials []api.PinInfoSerial
+	err = json.Unmarshal(data, &serials)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]api.PinInfo, len(serials), len(serials))
+	for i, pis := range serials {
+		infos[i] = pis.ToPinInfo()
+	}
+	return infos, nil
+}
@@ -0,0 +1,141 @@
+package opstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func testStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "opstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(dir, "ops.json"), func() { os.RemoveAll(dir) }
+}
+
+func TestNew(t *testing.T) {
+	s := New("/base", "ops.json")
+	if s.Path() != filepath.Join("/base", "ops.json") {
+		t.Error("relative paths should be relative to the base dir")
+	}
+	s = New("/base", "/other/ops.json")
+	if s.Path() != "/other/ops.json" {
+		t.Error("absolute paths should be kept")
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	s, clean := testStore(t)
+	defer clean()
+
+	infos, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Error("expected nothing saved")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	s, clean := testStore(t)
+	defer clean()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	infos := []api.PinInfo{
+		{
+			Cid:    h1,
+			Peer:   test.TestPeerID1,
+			Status: api.TrackerStatusPinning,
+			TS:     time.Now(),
+		},
+		{
+			Cid:      h2,
+			Peer:     test.TestPeerID1,
+			Status:   api.TrackerStatusPinError,
+			TS:       time.Now(),
+			Error:    "error",
+			Attempts: 3,
+		},
+	}
+	err := s.Save(infos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 {
+		t.Fatal("expected 2 saved operations")
+	}
+	if !loaded[0].Cid.Equals(h1) || loaded[0].Status != api.TrackerStatusPinning {
+		t.Error("unexpected first operation:", loaded[0])
+	}
+	if !loaded[1].Cid.Equals(h2) || loaded[1].Error != "error" || loaded[1].Attempts != 3 {
+		t.Error("unexpected second operation:", loaded[1])
+	}
+
+	err = s.Save(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, _ = s.Load()
+	if len(loaded) != 0 {
+		t.Error("saving should replace the saved operations")
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	s, clean := testStore(t)
+	defer clean()
+	err := s.EncryptWith([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h1, _ := cid.Decode(test.TestCid1)
+	err = s.Save([]api.PinInfo{{Cid: h1, Status: api.TrackerStatusPinning}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(s.Path())
+	if bytes.Contains(data, []byte(test.TestCid1)) {
+		t.Error("the operations should be encrypted")
+	}
+
+	loaded, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || !loaded[0].Cid.Equals(h1) {
+		t.Error("unexpected operations:", loaded)
+	}
+
+	s.EncryptWith([]byte("fedcba9876543210fedcba9876543210"))
+	_, err = s.Load()
+	if err == nil {
+		t.Error("expected an error with a different key")
+	}
+}
+
+func TestPersistable(t *testing.T) {
+	if !Persistable(api.TrackerStatusPinning) || !Persistable(api.TrackerStatusUnpinError) ||
+		!Persistable(api.TrackerStatusTrashed) {
+		t.Error("pending and failed operations should be saved")
+	}
+	if Persistable(api.TrackerStatusPinned) || Persistable(api.TrackerStatusRemote) {
+		t.Error("finished items should not be saved")
+	}
+}
@@ -0,0 +1,349 @@
+// Package optracker implements functionality to track the pin and unpin
+// operations which are queued, in progress or have failed in a
+// PinTracker. It makes sure that there is at most one operation per Cid:
+// duplicate operations are discarded and obsolete ones are cancelled.
+package optracker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("optracker")
+
+// OperationType represents the kinds of operations that the
+// OperationTracker keeps track of.
+type OperationType int
+
+// OperationType values
+const (
+	OperationUnknown OperationType = iota
+	OperationPin
+	OperationUnpin
+	// OperationRemote unpins an item allocated to other peers which
+	// was being pinned here.
+	OperationRemote
+	// OperationTrash keeps an item pinned until the unpin grace period
+	// is over. It is replaced by the unpin operation then.
+	OperationTrash
+)
+
+// String returns a human-readable name for the OperationType.
+func (t OperationType) String() string {
+	switch t {
+	case OperationPin:
+		return "pin"
+	case OperationUnpin:
+		return "unpin"
+	case OperationRemote:
+		return "remote"
+	case OperationTrash:
+		return "trash"
+	default:
+		return "unknown"
+	}
+}
+
+// Phase represents the stages an Operation goes through.
+type Phase int
+
+// Phase values
+const (
+	PhaseQueued Phase = iota
+	PhaseInProgress
+	// PhaseError is the phase of failed operations. They are kept until
+	// they are retried, replaced or found to be done.
+	PhaseError
+)
+
+// Operation is a pin or unpin of a Cid. Its context is cancelled
+// when the operation becomes obsolete.
+type Operation struct {
+	ctx    context.Context
+	cancel func()
+
+	pin api.Pin
+	typ OperationType
+
+	mu       sync.RWMutex
+	phase    Phase
+	ts       time.Time
+	err      string
+	attempts int
+	blocks   int
+	size     uint64
+}
+
+func newOperation(ctx context.Context, pin api.Pin, typ OperationType) *Operation {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Operation{
+		ctx:    ctx,
+		cancel: cancel,
+		pin:    pin,
+		typ:    typ,
+		ts:     time.Now(),
+		phase:  PhaseQueued,
+	}
+}
+
+// Cid returns the Cid associated to this operation.
+func (op *Operation) Cid() *cid.Cid {
+	return op.pin.Cid
+}
+
+// Pin returns the Pin object associated to this operation.
+func (op *Operation) Pin() api.Pin {
+	return op.pin
+}
+
+// Type returns the operation Type.
+func (op *Operation) Type() OperationType {
+	return op.typ
+}
+
+// Timestamp returns the time when the operation was created, failed or
+// last reported progress.
+func (op *Operation) Timestamp() time.Time {
+	op.mu.RLock()
+	defer op.mu.RUnlock()
+	return op.ts
+}
+
+// SetTimestamp changes the time of the operation, i.e. to that of an
+// operation restored from a previous run.
+func (op *Operation) SetTimestamp(ts time.Time) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.ts = ts
+}
+
+// Phase returns the current operation Phase.
+func (op *Operation) Phase() Phase {
+	op.mu.RLock()
+	defer op.mu.RUnlock()
+	return op.phase
+}
+
+// SetPhase changes the operation Phase.
+func (op *Operation) SetPhase(ph Phase) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.phase = ph
+}
+
+// Error returns the error of a failed operation.
+func (op *Operation) Error() string {
+	op.mu.RLock()
+	defer op.mu.RUnlock()
+	return op.err
+}
+
+// Attempts returns the number of previous failed attempts of the
+// operation.
+func (op *Operation) Attempts() int {
+	op.mu.RLock()
+	defer op.mu.RUnlock()
+	return op.attempts
+}
+
+// SetAttempts changes the number of previous failed attempts of the
+// operation.
+func (op *Operation) SetAttempts(n int) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.attempts = n
+}
+
+// SetProgress records the blocks and bytes fetched so far by an
+// operation in progress, refreshing its timestamp.
+func (op *Operation) SetProgress(blocks int, size uint64) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.blocks = blocks
+	op.size = size
+	op.ts = time.Now()
+}
+
+// TrackerStatus returns the status of the Cid of the operation.
+func (op *Operation) TrackerStatus() api.TrackerStatus {
+	failed := op.Phase() == PhaseError
+	switch {
+	case op.typ == OperationPin && failed:
+		return api.TrackerStatusPinError
+	case op.typ == OperationPin:
+		return api.TrackerStatusPinning
+	case op.typ == OperationUnpin && failed:
+		return api.TrackerStatusUnpinError
+	case op.typ == OperationUnpin:
+		return api.TrackerStatusUnpinning
+	case op.typ == OperationRemote:
+		return api.TrackerStatusRemote
+	case op.typ == OperationTrash:
+		return api.TrackerStatusTrashed
+	default:
+		return api.TrackerStatusBug
+	}
+}
+
+// PinInfo returns the status of the Cid of the operation in the given
+// peer.
+func (op *Operation) PinInfo(pid peer.ID) api.PinInfo {
+	status := op.TrackerStatus()
+	op.mu.RLock()
+	defer op.mu.RUnlock()
+	return api.PinInfo{
+		Cid:      op.pin.Cid,
+		Peer:     pid,
+		Status:   status,
+		TS:       op.ts,
+		Error:    op.err,
+		Attempts: op.attempts,
+		Blocks:   op.blocks,
+		Size:     op.size,
+	}
+}
+
+// Context returns the context of the operation, which is cancelled along
+// with it.
+func (op *Operation) Context() context.Context {
+	return op.ctx
+}
+
+// Cancel cancels the operation.
+func (op *Operation) Cancel() {
+	op.cancel()
+}
+
+// Cancelled returns whether the operation has been cancelled.
+func (op *Operation) Cancelled() bool {
+	return op.ctx.Err() != nil
+}
+
+// OperationTracker keeps track of the operations queued, in progress or
+// failed for every Cid. This component is thread-safe.
+type OperationTracker struct {
+	ctx context.Context
+
+	mu         sync.RWMutex
+	operations map[string]*Operation
+}
+
+// NewOperationTracker creates a new OperationTracker. The contexts of all
+// operations are cancelled when the given one is.
+func NewOperationTracker(ctx context.Context) *OperationTracker {
+	return &OperationTracker{
+		ctx:        ctx,
+		operations: make(map[string]*Operation),
+	}
+}
+
+// TrackNewOperation creates and records a new operation for the given pin.
+// If an operation of the same type is already queued or in progress for
+// the Cid, it is a duplicate and nil is returned. An operation of a
+// different type, or a failed one, is obsolete: it is cancelled and
+// replaced.
+func (opt *OperationTracker) TrackNewOperation(pin api.Pin, typ OperationType) *Operation {
+	return opt.TrackNewOperationIf(pin, typ, func(op *Operation) bool {
+		if op != nil && op.typ == typ && !op.Cancelled() && op.Phase() != PhaseError {
+			logger.Debugf("%s operation for %s already ongoing", typ, pin.Cid)
+			return false
+		}
+		return true
+	})
+}
+
+// TrackNewOperationIf works like TrackNewOperation, but the new operation
+// is only recorded when replace returns true for the current operation
+// of the Cid, which is nil when there is none. Otherwise, it returns nil.
+func (opt *OperationTracker) TrackNewOperationIf(pin api.Pin, typ OperationType, replace func(*Operation) bool) *Operation {
+	key := pin.Cid.String()
+
+	opt.mu.Lock()
+	defer opt.mu.Unlock()
+
+	op, ok := opt.operations[key]
+	if !ok {
+		op = nil
+	}
+	if !replace(op) {
+		return nil
+	}
+	if ok {
+		logger.Debugf("cancelling %s operation for %s", op.typ, pin.Cid)
+		op.Cancel()
+	}
+
+	op = newOperation(opt.ctx, pin, typ)
+	opt.operations[key] = op
+	return op
+}
+
+// CancelPin replaces the pin operation queued or in progress for a Cid
+// with an unpin operation, which removes whatever was fetched, and
+// returns it. The check and the replacement are atomic: when the pin has
+// finished or failed already, nothing is replaced and nil is returned,
+// so completed pins are never undone.
+func (opt *OperationTracker) CancelPin(c *cid.Cid) *Operation {
+	return opt.TrackNewOperationIf(api.PinCid(c), OperationUnpin, func(op *Operation) bool {
+		return op != nil && op.typ == OperationPin && !op.Cancelled() && op.Phase() != PhaseError
+	})
+}
+
+// Get returns the operation queued or in progress for a Cid, if any.
+func (opt *OperationTracker) Get(c *cid.Cid) (*Operation, bool) {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	op, ok := opt.operations[c.String()]
+	return op, ok
+}
+
+// All returns the operations of every Cid.
+func (opt *OperationTracker) All() []*Operation {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	ops := make([]*Operation, 0, len(opt.operations))
+	for _, op := range opt.operations {
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// SetError moves an operation to PhaseError, keeping it until it is
+// retried or replaced. It returns false when the operation has been
+// replaced already.
+func (opt *OperationTracker) SetError(op *Operation, err error) bool {
+	opt.mu.Lock()
+	defer opt.mu.Unlock()
+	if opt.operations[op.Cid().String()] != op {
+		return false
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.phase = PhaseError
+	op.err = err.Error()
+	op.ts = time.Now()
+	op.blocks = 0
+	op.size = 0
+	return true
+}
+
+// Finish removes an operation when it is done. Operations which have
+// been replaced are not removed, and false is returned for them.
+func (opt *OperationTracker) Finish(op *Operation) bool {
+	opt.mu.Lock()
+	defer opt.mu.Unlock()
+	op.Cancel()
+	if opt.operations[op.Cid().String()] != op {
+		return false
+	}
+	delete(opt.operations, op.Cid().String())
+	return true
+}
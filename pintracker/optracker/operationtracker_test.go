@@ -0,0 +1,245 @@
+package optracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func testOperationTracker(t *testing.T) *OperationTracker {
+	return NewOperationTracker(context.Background())
+}
+
+func TestTrackNewOperation(t *testing.T) {
+	opt := testOperationTracker(t)
+	h, _ := cid.Decode(test.TestCid1)
+
+	op := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	if op == nil {
+		t.Fatal("expected an operation")
+	}
+	if op.Type() != OperationPin || op.Phase() != PhaseQueued {
+		t.Error("unexpected operation type or phase")
+	}
+	if !op.Cid().Equals(h) {
+		t.Error("unexpected cid")
+	}
+
+	got, ok := opt.Get(h)
+	if !ok || got != op {
+		t.Error("expected to find the operation")
+	}
+}
+
+func TestTrackNewOperationDuplicate(t *testing.T) {
+	opt := testOperationTracker(t)
+	h, _ := cid.Decode(test.TestCid1)
+
+	op := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	op.SetPhase(PhaseInProgress)
+	dup := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	if dup != nil {
+		t.Error("duplicate operations should be discarded")
+	}
+	if op.Cancelled() {
+		t.Error("the ongoing operation should not be cancelled")
+	}
+}
+
+func TestTrackNewOperationObsolete(t *testing.T) {
+	opt := testOperationTracker(t)
+	h, _ := cid.Decode(test.TestCid1)
+
+	pinOp := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	unpinOp := opt.TrackNewOperation(api.PinCid(h), OperationUnpin)
+	if unpinOp == nil {
+		t.Fatal("expected an operation")
+	}
+	if !pinOp.Cancelled() {
+		t.Error("the obsolete pin should be cancelled")
+	}
+	if unpinOp.Cancelled() {
+		t.Error("the new operation should not be cancelled")
+	}
+
+	got, _ := opt.Get(h)
+	if got != unpinOp {
+		t.Error("expected the unpin operation to replace the pin")
+	}
+}
+
+func TestTrackNewOperationIf(t *testing.T) {
+	opt := testOperationTracker(t)
+	h, _ := cid.Decode(test.TestCid1)
+
+	var seen *Operation
+	op := opt.TrackNewOperationIf(api.PinCid(h), OperationTrash, func(current *Operation) bool {
+		seen = current
+		return current == nil
+	})
+	if op == nil || seen != nil {
+		t.Fatal("expected a new operation when there was none")
+	}
+
+	other := opt.TrackNewOperationIf(api.PinCid(h), OperationUnpin, func(current *Operation) bool {
+		seen = current
+		return current == nil
+	})
+	if other != nil || seen != op {
+		t.Error("the current operation should be kept")
+	}
+	if op.Cancelled() {
+		t.Error("the kept operation should not be cancelled")
+	}
+}
+
+func TestSetError(t *testing.T) {
+	opt := testOperationTracker(t)
+	h, _ := cid.Decode(test.TestCid1)
+
+	op := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	op.SetProgress(10, 1024)
+	if !opt.SetError(op, errors.New("an error")) {
+		t.Fatal("expected the error to be set")
+	}
+	info := op.PinInfo(test.TestPeerID1)
+	if info.Status != api.TrackerStatusPinError || info.Error != "an error" {
+		t.Errorf("unexpected status: %s, %s", info.Status, info.Error)
+	}
+	if info.Blocks != 0 || info.Size != 0 {
+		t.Error("the progress of failed operations should be reset")
+	}
+
+	// failed operations are replaced by new ones of the same type
+	newOp := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	if newOp == nil {
+		t.Fatal("a failed operation should not be a duplicate")
+	}
+	if opt.SetError(op, errors.New("an error")) {
+		t.Error("replaced operations should not be set in error")
+	}
+	if newOp.TrackerStatus() != api.TrackerStatusPinning {
+		t.Errorf("unexpected status: %s", newOp.TrackerStatus())
+	}
+}
+
+func TestTrackerStatus(t *testing.T) {
+	opt := testOperationTracker(t)
+	h, _ := cid.Decode(test.TestCid1)
+
+	testcases := []struct {
+		typ    OperationType
+		failed bool
+		status api.TrackerStatus
+	}{
+		{OperationPin, false, api.TrackerStatusPinning},
+		{OperationPin, true, api.TrackerStatusPinError},
+		{OperationUnpin, false, api.TrackerStatusUnpinning},
+		{OperationUnpin, true, api.TrackerStatusUnpinError},
+		{OperationRemote, false, api.TrackerStatusRemote},
+		{OperationTrash, false, api.TrackerStatusTrashed},
+	}
+	for _, tc := range testcases {
+		op := opt.TrackNewOperationIf(api.PinCid(h), tc.typ, func(*Operation) bool { return true })
+		if tc.failed {
+			opt.SetError(op, errors.New("an error"))
+		}
+		if st := op.TrackerStatus(); st != tc.status {
+			t.Errorf("%s (failed: %t): expected %s, got %s", tc.typ, tc.failed, tc.status, st)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	opt := testOperationTracker(t)
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+
+	opt.TrackNewOperation(api.PinCid(h1), OperationPin)
+	opt.TrackNewOperation(api.PinCid(h2), OperationUnpin)
+	opt.TrackNewOperation(api.PinCid(h2), OperationPin)
+	if len(opt.All()) != 2 {
+		t.Errorf("expected one operation per cid, got %d", len(opt.All()))
+	}
+}
+
+func TestCancelPin(t *testing.T) {
+	opt := testOperationTracker(t)
+	h, _ := cid.Decode(test.TestCid1)
+
+	if opt.CancelPin(h) != nil {
+		t.Error("there is no pin to cancel")
+	}
+
+	pinOp := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	pinOp.SetPhase(PhaseInProgress)
+	unpinOp := opt.CancelPin(h)
+	if unpinOp == nil || unpinOp.Type() != OperationUnpin {
+		t.Fatal("expected an unpin operation")
+	}
+	if !pinOp.Cancelled() {
+		t.Error("the pin should be cancelled")
+	}
+	if opt.CancelPin(h) != nil {
+		t.Error("an unpin should not be cancelled")
+	}
+
+	// a pin which has finished is left alone
+	opt.Finish(unpinOp)
+	pinOp = opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	opt.Finish(pinOp)
+	if opt.CancelPin(h) != nil {
+		t.Error("a finished pin should not be cancelled")
+	}
+
+	pinOp = opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	opt.SetError(pinOp, errors.New("failed"))
+	if opt.CancelPin(h) != nil {
+		t.Error("a failed pin should not be cancelled")
+	}
+}
+
+func TestFinish(t *testing.T) {
+	opt := testOperationTracker(t)
+	h, _ := cid.Decode(test.TestCid1)
+
+	pinOp := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	unpinOp := opt.TrackNewOperation(api.PinCid(h), OperationUnpin)
+
+	// a replaced operation does not remove the new one
+	if opt.Finish(pinOp) {
+		t.Error("finishing a replaced operation should return false")
+	}
+	if _, ok := opt.Get(h); !ok {
+		t.Error("the unpin operation should still be tracked")
+	}
+
+	if !opt.Finish(unpinOp) {
+		t.Error("finishing the current operation should return true")
+	}
+	if _, ok := opt.Get(h); ok {
+		t.Error("the operation should have been removed")
+	}
+
+	// a new operation can be tracked after finishing
+	if opt.TrackNewOperation(api.PinCid(h), OperationUnpin) == nil {
+		t.Error("expected a new operation")
+	}
+}
+
+func TestOperationContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	opt := NewOperationTracker(ctx)
+	h, _ := cid.Decode(test.TestCid1)
+
+	op := opt.TrackNewOperation(api.PinCid(h), OperationPin)
+	cancel()
+	if !op.Cancelled() {
+		t.Error("operations should be cancelled with the tracker context")
+	}
+}
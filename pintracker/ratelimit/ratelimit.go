@@ -0,0 +1,70 @@
+// Package ratelimit implements the token bucket used by the PinTrackers to
+// limit how many pins they send to the IPFS daemon per second, so that
+// bursts of pins are smoothed out.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket. Tokens are added at a fixed rate, up to the
+// size of the bucket, and every operation takes one. A Limiter with a
+// rate of 0 never waits. Limiters are thread-safe.
+type Limiter struct {
+	mux    sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter which allows rate operations per second. Up to one
+// second worth of operations (at least one) can happen at once after a
+// period of inactivity. A rate of 0 or lower disables the limit.
+func New(rate float64) *Limiter {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available and takes it. It returns the
+// context error if the context is cancelled first.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	for {
+		l.mux.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mux.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mux.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
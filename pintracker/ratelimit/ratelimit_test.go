@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUnlimited(t *testing.T) {
+	l := New(0)
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("an unlimited Limiter should not wait")
+	}
+}
+
+func TestWait(t *testing.T) {
+	l := New(20)
+	start := time.Now()
+	// 20 tokens in the bucket, plus 10 at 20/s
+	for i := 0; i < 30; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+	if elapsed < 400*time.Millisecond || elapsed > 1000*time.Millisecond {
+		t.Error("unexpected wait:", elapsed)
+	}
+}
+
+func TestWaitCancel(t *testing.T) {
+	l := New(0.1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("expected an error when the context is cancelled")
+	}
+}
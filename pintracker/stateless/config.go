@@ -0,0 +1,29 @@
+package stateless
+
+import "github.com/ipfs/ipfs-cluster/pintracker/util"
+
+const configKey = "stateless"
+
+// Config allows to initialize a StatelessPinTracker and customize some
+// parameters. The options are shared by all the PinTracker
+// implementations.
+type Config struct {
+	util.Config
+}
+
+// ConfigKey provides a human-friendly identifier for this type of Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Validate checks that the fields of this Config have working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	return cfg.ValidateSection(configKey)
+}
+
+// LoadJSON sets the fields of this Config to the values defined by the JSON
+// representation of it, as generated by ToJSON.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	return cfg.LoadJSONSection(configKey, raw)
+}
@@ -0,0 +1,24 @@
+package stateless
+
+import "testing"
+
+func TestConfigSection(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.LoadJSON(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.ConcurrentPins = 0
+	err = cfg.Validate()
+	if err == nil || err.Error() != "stateless.concurrent_pins too low" {
+		t.Error("expected an error naming the stateless section:", err)
+	}
+}
@@ -0,0 +1,1171 @@
+// Package stateless implements a PinTracker component for IPFS Cluster which
+// does not keep the status of every tracked pin in memory. The status is
+// derived on demand from the shared state and from the pins in the IPFS
+// daemon. Only ongoing and failed operations are stored, so memory usage
+// does not grow with the number of pins in the cluster.
+package stateless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/opstore"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+	"github.com/ipfs/ipfs-cluster/pintracker/ratelimit"
+	"github.com/ipfs/ipfs-cluster/pintracker/util"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("pintracker")
+
+// EventChannelCap specifies how much buffer the events channel has.
+var EventChannelCap = 1024
+
+// StatelessPinTracker is a PinTracker implementation which derives the
+// status of the pins from the shared state and the IPFS daemon every time
+// it is requested. It only keeps the operations which are queued, ongoing
+// or have failed. This component is thread-safe.
+type StatelessPinTracker struct {
+	config *Config
+
+	// optracker keeps the queued, ongoing and failed operations, at
+	// most one per Cid.
+	optracker *optracker.OperationTracker
+
+	ctx    context.Context
+	cancel func()
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+
+	events chan api.PinEvent
+
+	peerID  peer.ID
+	pinCh   chan *optracker.Operation
+	unpinCh chan *optracker.Operation
+
+	// background maintenance operations use their own queue
+	// and workers. Pin workers take from it too, following the
+	// configured priority ratio.
+	bgCh chan *optracker.Operation
+
+	// workers is the number of pin and of unpin workers. Workers
+	// stop when they receive from the stop channels.
+	workersMux  sync.Mutex
+	workers     int
+	stopPinCh   chan struct{}
+	stopUnpinCh chan struct{}
+
+	// store saves pending and failed operations across restarts when
+	// PersistFile is set. Operations are only saved once the ones
+	// from the previous run have been restored.
+	store    *opstore.Store
+	restored bool
+
+	// mux protects remoteErrs and metas
+	mux sync.RWMutex
+
+	// remoteErrs keeps the items allocated to other peers which
+	// failed the last remote verification.
+	remoteErrs map[string]api.PinInfo
+
+	// metas keeps the tracked MetaType pins, since their shards are
+	// not in the shared state and must be untracked when the pin is
+	// removed from it.
+	metas map[string]api.Pin
+
+	// limiter smooths out the pins sent to IPFS
+	limiter *ratelimit.Limiter
+
+	// counters reported by Metrics()
+	counters util.Counters
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+// NewStatelessPinTracker returns a new object which has been correctly
+// initialized with the given configuration.
+func NewStatelessPinTracker(cfg *Config, pid peer.ID) *StatelessPinTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	spt := &StatelessPinTracker{
+		ctx:       ctx,
+		cancel:    cancel,
+		optracker: optracker.NewOperationTracker(ctx),
+		metas:     make(map[string]api.Pin),
+		limiter:   ratelimit.New(cfg.MaxPinQueueRate),
+		config:    cfg,
+		rpcReady:  make(chan struct{}),
+		events:    make(chan api.PinEvent, EventChannelCap),
+		peerID:    pid,
+		pinCh:     make(chan *optracker.Operation, cfg.MaxPinQueueSize),
+		unpinCh:   make(chan *optracker.Operation, cfg.MaxPinQueueSize),
+		bgCh:      make(chan *optracker.Operation, cfg.MaxPinQueueSize),
+
+		stopPinCh:   make(chan struct{}),
+		stopUnpinCh: make(chan struct{}),
+	}
+	spt.startWorkers(cfg.ConcurrentPins)
+	for i := 0; i < cfg.ConcurrentBackgroundPins; i++ {
+		go spt.worker(spt.bgCh, nil)
+	}
+	store, err := util.NewStore(&cfg.Config)
+	if err != nil {
+		logger.Errorf("not saving the pin tracker operations: %s", err)
+	}
+	if store != nil {
+		spt.store = store
+		spt.wg.Add(1)
+		go func() {
+			defer spt.wg.Done()
+			// operations are only saved once the ones from the
+			// previous run are restored
+			util.Loop(spt.ctx, spt.rpcReady, cfg.PersistInterval, func() {
+				util.Restore(spt.store, spt.resume)
+				spt.restored = true
+			}, spt.persist)
+		}()
+	}
+	if cfg.VerifyRemoteInterval > 0 {
+		spt.wg.Add(1)
+		go func() {
+			defer spt.wg.Done()
+			util.Loop(spt.ctx, spt.rpcReady, cfg.VerifyRemoteInterval, nil, spt.verifyRemote)
+		}()
+	}
+	return spt
+}
+
+func (spt *StatelessPinTracker) startWorkers(n int) {
+	for i := 0; i < n; i++ {
+		go spt.pinWorker()
+		go spt.worker(spt.unpinCh, spt.stopUnpinCh)
+	}
+	spt.workers += n
+}
+
+// stopWorkers signals n pin and n unpin workers to stop once they finish
+// their current operation. It does not wait for them.
+func (spt *StatelessPinTracker) stopWorkers(n int) {
+	spt.workers -= n
+	stop := func(ch chan struct{}) {
+		for i := 0; i < n; i++ {
+			select {
+			case ch <- struct{}{}:
+			case <-spt.ctx.Done():
+				return
+			}
+		}
+	}
+	go stop(spt.stopPinCh)
+	go stop(spt.stopUnpinCh)
+}
+
+// SetConcurrentPins changes the number of pin and unpin requests
+// which can be processed at the same time, without restarting. Ongoing
+// operations are not interrupted. The new value is saved to the
+// configuration.
+func (spt *StatelessPinTracker) SetConcurrentPins(n int) error {
+	if n <= 0 {
+		return errors.New("stateless.concurrent_pins too low")
+	}
+
+	spt.workersMux.Lock()
+	defer spt.workersMux.Unlock()
+	switch {
+	case n > spt.workers:
+		spt.startWorkers(n - spt.workers)
+	case n < spt.workers:
+		spt.stopWorkers(spt.workers - n)
+	}
+	logger.Infof("concurrent pins set to %d", n)
+
+	spt.config.ConcurrentPins = n
+	spt.config.NotifySave()
+	return nil
+}
+
+// ConfigKey returns the key of the configuration section of this
+// tracker.
+func (spt *StatelessPinTracker) ConfigKey() string {
+	return spt.config.ConfigKey()
+}
+
+// reads a queue and runs its operations until stopped
+func (spt *StatelessPinTracker) worker(queue chan *optracker.Operation, stop chan struct{}) {
+	for {
+		select {
+		case op := <-queue:
+			spt.run(op)
+		case <-stop:
+			return
+		case <-spt.ctx.Done():
+			return
+		}
+	}
+}
+
+// reads the pin queue and runs its operations until stopped, giving
+// turns to background operations (see util.PriorityWorker).
+func (spt *StatelessPinTracker) pinWorker() {
+	util.PriorityWorker(spt.ctx, spt.stopPinCh, spt.config.PriorityRatio, spt.pinCh, spt.bgCh, func(op *optracker.Operation) {
+		spt.run(op)
+	})
+}
+
+// Shutdown finishes the services provided by the StatelessPinTracker and
+// cancels any active context.
+func (spt *StatelessPinTracker) Shutdown() error {
+	spt.shutdownLock.Lock()
+	defer spt.shutdownLock.Unlock()
+
+	if spt.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping StatelessPinTracker")
+	spt.cancel()
+	spt.wg.Wait()
+	if spt.store != nil && spt.restored {
+		spt.persist()
+	}
+	spt.shutdown = true
+	return nil
+}
+
+// newOperation records a new operation for a pin. Without a replace
+// function, duplicates are discarded as in TrackNewOperation. The IPFS
+// request of an obsolete operation in progress is cancelled to free its
+// worker.
+func (spt *StatelessPinTracker) newOperation(c api.Pin, typ optracker.OperationType, replace func(*optracker.Operation) bool) *optracker.Operation {
+	old, ok := spt.optracker.Get(c.Cid)
+	var op *optracker.Operation
+	if replace == nil {
+		op = spt.optracker.TrackNewOperation(c, typ)
+	} else {
+		op = spt.optracker.TrackNewOperationIf(c, typ, replace)
+	}
+	if op != nil && ok && old.Phase() == optracker.PhaseInProgress {
+		util.CancelIPFS(spt.rpcClient, c.Cid)
+	}
+	return op
+}
+
+// run performs an operation on the IPFS daemon, unless it has been
+// replaced by a newer operation for the same Cid.
+func (spt *StatelessPinTracker) run(op *optracker.Operation) error {
+	if op.Cancelled() {
+		return nil
+	}
+	op.SetPhase(optracker.PhaseInProgress)
+
+	c := op.Pin()
+	if op.Type() == optracker.OperationPin {
+		if util.PinnedIndirectly(spt.rpcClient, c.Cid) {
+			logger.Infof("%s is already pinned indirectly. Not pinning it", c.Cid)
+			spt.done(op, api.TrackerStatusPinnedIndirect)
+			return nil
+		}
+		if err := spt.limiter.Wait(op.Context()); err != nil {
+			// replaced, or interrupted by a shutdown, while waiting
+			// for its turn
+			return err
+		}
+	}
+
+	method, timeout, timeoutErr := "IPFSPin", spt.config.PinTimeout, util.ErrPinTimeout
+	if op.Type() != optracker.OperationPin {
+		method, timeout, timeoutErr = "IPFSUnpin", spt.config.UnpinTimeout, util.ErrUnpinTimeout
+	}
+	logger.Debugf("issuing %s call for %s", method, c.Cid)
+	if op.Type() != optracker.OperationRemote {
+		spt.sendEvent(op.PinInfo(spt.peerID), false)
+	}
+	start := time.Now()
+	err := util.IPFSCall(op.Context(), spt.rpcClient, &spt.counters, method, c, timeout, timeoutErr)
+	if spt.ctx.Err() != nil {
+		// interrupted by a shutdown. The operation is left as it
+		// was, so that it is saved and resumed.
+		return err
+	}
+	if op.Cancelled() {
+		logger.Debugf("%s operation for %s was replaced", op.Type(), c.Cid)
+		return nil
+	}
+	if err == nil && op.Type() == optracker.OperationPin {
+		spt.counters.Pinned(time.Since(start))
+	}
+	spt.finish(op, err)
+	return err
+}
+
+// finish removes a successful operation, since the status of its Cid can
+// be obtained from IPFS now, or keeps it in error state. Failed pins are
+// retried with exponential backoff up to MaxRetries times.
+func (spt *StatelessPinTracker) finish(op *optracker.Operation, err error) {
+	if err == nil {
+		var status api.TrackerStatus = api.TrackerStatusUnpinned
+		switch op.Type() {
+		case optracker.OperationPin:
+			status = api.TrackerStatusPinned
+		case optracker.OperationRemote:
+			status = api.TrackerStatusRemote
+		}
+		spt.done(op, status)
+		return
+	}
+
+	if op.Type() != optracker.OperationPin {
+		spt.setError(op, err)
+		return
+	}
+	op.SetAttempts(op.Attempts() + 1)
+	if spt.setError(op, err) {
+		spt.scheduleRetry(op, err)
+	}
+}
+
+// done removes a successful operation, leaving the Cid with the given
+// status. The Cids of remote operations stay remote, so no event is
+// sent for them.
+func (spt *StatelessPinTracker) done(op *optracker.Operation, status api.TrackerStatus) {
+	if spt.optracker.Finish(op) && op.Type() != optracker.OperationRemote {
+		spt.sendEvent(spt.pinInfo(op.Cid(), status, nil), false)
+	}
+}
+
+// scheduleRetry schedules a new attempt of a failed pin, unless it has
+// reached MaxRetries.
+func (spt *StatelessPinTracker) scheduleRetry(op *optracker.Operation, err error) {
+	util.ScheduleRetry(&spt.config.Config, &spt.counters, op.Pin(), op.Attempts(), err, func() { spt.retry(op) })
+}
+
+// retry queues a new attempt of a failed operation in the background
+// queue, unless it was recovered or replaced in the meantime.
+func (spt *StatelessPinTracker) retry(op *optracker.Operation) {
+	if spt.ctx.Err() != nil {
+		return
+	}
+
+	newOp := spt.optracker.TrackNewOperationIf(op.Pin(), optracker.OperationPin, func(current *optracker.Operation) bool {
+		return current == op && op.Phase() == optracker.PhaseError
+	})
+	if newOp == nil {
+		return
+	}
+	newOp.SetAttempts(op.Attempts())
+	spt.enqueue(newOp, spt.bgCh)
+}
+
+// setError leaves an operation in error state and returns true, unless
+// it has been replaced. Remote operations are only a cleanup: they are
+// dropped instead, so they are neither kept in memory nor reported.
+func (spt *StatelessPinTracker) setError(op *optracker.Operation, err error) bool {
+	if op.Type() == optracker.OperationRemote {
+		logger.Warningf("could not unpin %s, which is allocated to other peers: %s", op.Cid(), err)
+		spt.optracker.Finish(op)
+		return false
+	}
+
+	if !spt.optracker.SetError(op, err) {
+		return false
+	}
+	spt.sendEvent(op.PinInfo(spt.peerID), false)
+	return true
+}
+
+// sendEvent notifies a change in the status of an item. queued is set
+// for operations waiting for their turn.
+func (spt *StatelessPinTracker) sendEvent(info api.PinInfo, queued bool) {
+	util.SendEvent(spt.events, api.PinEvent{PinInfo: info, Queued: queued})
+}
+
+// enqueue sends a new operation to the given queue. When a user queue is
+// full, it waits up to EnqueueTimeout for the workers to make room. It
+// returns an error when the queue is still full.
+func (spt *StatelessPinTracker) enqueue(op *optracker.Operation, queue chan *optracker.Operation) error {
+	if op.Type() != optracker.OperationRemote {
+		spt.sendEvent(op.PinInfo(spt.peerID), true)
+	}
+
+	timeout := spt.config.EnqueueTimeout
+	if queue == spt.bgCh {
+		timeout = 0
+	}
+	if util.Enqueue(spt.ctx, queue, op, timeout) {
+		return nil
+	}
+
+	err := errors.New("pin queue is full")
+	if op.Type() != optracker.OperationPin {
+		err = errors.New("unpin queue is full")
+	}
+	spt.finish(op, err)
+	logger.Error(err.Error())
+	return err
+}
+
+// Track tells the StatelessPinTracker to start managing a Cid,
+// possibly trigerring Pin operations on the IPFS daemon.
+func (spt *StatelessPinTracker) Track(c api.Pin) error {
+	return spt.track(c, spt.pinCh)
+}
+
+// TrackInBackground works like Track, but the resulting Pin operation
+// is queued along with other background maintenance operations.
+func (spt *StatelessPinTracker) TrackInBackground(c api.Pin) error {
+	return spt.track(c, spt.bgCh)
+}
+
+func (spt *StatelessPinTracker) track(c api.Pin, queue chan *optracker.Operation) error {
+	logger.Debugf("tracking %s", c.Cid)
+	if c.Type == api.MetaType {
+		return spt.trackMeta(c, queue)
+	}
+	if util.IsRemotePin(c, spt.peerID) {
+		spt.trackRemote(c)
+		return nil
+	}
+
+	op := spt.newOperation(c, optracker.OperationPin, nil)
+	if op == nil {
+		// already queued or in progress
+		return nil
+	}
+	return spt.enqueue(op, queue)
+}
+
+// trackRemote handles an item allocated to other peers, which is
+// unpinned from IPFS if this peer pinned it before the allocation
+// changed. This tracker does not remember which items it pinned, so
+// items pinned in IPFS are taken as pinned by it, as for the status of
+// the items allocated to it. A pin operation, if any, is replaced by a
+// remote operation which unpins whatever was pinned: a queued or failed
+// one is dropped, and an ongoing one is cancelled.
+func (spt *StatelessPinTracker) trackRemote(c api.Pin) {
+	op := spt.newOperation(c, optracker.OperationRemote, func(current *optracker.Operation) bool {
+		return current != nil &&
+			current.Type() == optracker.OperationPin &&
+			current.Phase() == optracker.PhaseInProgress
+	})
+	if op != nil {
+		spt.enqueue(op, spt.bgCh)
+		return
+	}
+
+	current, ok := spt.optracker.Get(c.Cid)
+	switch {
+	case ok && current.Type() == optracker.OperationPin:
+		spt.optracker.Finish(current)
+	case ok:
+		// already being unpinned, or trashed
+		return
+	}
+
+	ips, err := util.IPFSPinLsCid(spt.rpcClient, c.Cid)
+	if err != nil || !ips.IsPinned() {
+		return
+	}
+	op = spt.newOperation(c, optracker.OperationRemote, func(current *optracker.Operation) bool {
+		// it may have been tracked again meanwhile
+		return current == nil
+	})
+	if op != nil {
+		logger.Infof("%s has been allocated to other peers. Unpinning it", c.Cid)
+		spt.enqueue(op, spt.bgCh)
+	}
+}
+
+// trackMeta tracks every shard of a MetaType pin as an independent
+// ShardType pin. The meta pin itself is not pinned in IPFS. Shards
+// which are no longer part of it are untracked.
+func (spt *StatelessPinTracker) trackMeta(c api.Pin, queue chan *optracker.Operation) error {
+	spt.mux.Lock()
+	old, ok := spt.metas[c.Cid.String()]
+	spt.metas[c.Cid.String()] = c
+	spt.mux.Unlock()
+
+	var err error
+	for _, sh := range c.ShardPins() {
+		if e := spt.track(sh, queue); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if ok {
+		for _, sh := range old.Shards {
+			if !util.HasShard(c, sh) {
+				spt.untrack(sh, queue)
+			}
+		}
+	}
+	return err
+}
+
+// shardPin returns the ShardType pin for a Cid when it is a shard of a
+// tracked MetaType pin.
+func (spt *StatelessPinTracker) shardPin(c *cid.Cid) (api.Pin, bool) {
+	spt.mux.RLock()
+	defer spt.mux.RUnlock()
+	for _, meta := range spt.metas {
+		for _, sh := range meta.ShardPins() {
+			if sh.Cid.Equals(c) {
+				return sh, true
+			}
+		}
+	}
+	return api.Pin{}, false
+}
+
+// Untrack tells the StatelessPinTracker to stop managing a Cid.
+// If the Cid is pinned locally, it will be unpinned.
+func (spt *StatelessPinTracker) Untrack(c *cid.Cid) error {
+	return spt.untrack(c, spt.unpinCh)
+}
+
+// UntrackInBackground works like Untrack, but the resulting Unpin
+// operation is queued along with other background maintenance
+// operations.
+func (spt *StatelessPinTracker) UntrackInBackground(c *cid.Cid) error {
+	return spt.untrack(c, spt.bgCh)
+}
+
+func (spt *StatelessPinTracker) untrack(c *cid.Cid, queue chan *optracker.Operation) error {
+	logger.Debugf("untracking %s", c)
+	spt.mux.Lock()
+	meta, isMeta := spt.metas[c.String()]
+	delete(spt.metas, c.String())
+	spt.mux.Unlock()
+	if isMeta {
+		var err error
+		for _, sh := range meta.Shards {
+			if e := spt.untrack(sh, queue); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+	if spt.config.UnpinGracePeriod > 0 && spt.trash(c) {
+		return nil
+	}
+
+	op := spt.newOperation(api.PinCid(c), optracker.OperationUnpin, nil)
+	if op == nil {
+		// already queued or in progress
+		return nil
+	}
+	return spt.enqueue(op, queue)
+}
+
+// CancelPin replaces the pin of a Cid which is queued or in progress
+// with an unpin. It fails when the pin has finished already.
+func (spt *StatelessPinTracker) CancelPin(c *cid.Cid) error {
+	old, ok := spt.optracker.Get(c)
+	op := spt.optracker.CancelPin(c)
+	if op == nil {
+		return fmt.Errorf("%s is not being pinned", c)
+	}
+	if ok && old.Phase() == optracker.PhaseInProgress {
+		util.CancelIPFS(spt.rpcClient, c)
+	}
+	logger.Infof("cancelling the pin of %s", c)
+	return spt.enqueue(op, spt.unpinCh)
+}
+
+// trash marks a pinned Cid as trashed instead of unpinning it. It is
+// unpinned once UnpinGracePeriod is over, unless it is tracked again
+// before. It returns false when the Cid is not pinned, and should be
+// unpinned right away.
+func (spt *StatelessPinTracker) trash(c *cid.Cid) bool {
+	if op, ok := spt.optracker.Get(c); ok {
+		// items with other operations are not done pinning
+		return op.Type() == optracker.OperationTrash
+	}
+
+	ips, err := util.IPFSPinLsCid(spt.rpcClient, c)
+	if err != nil || !(ips.IsPinned() || ips == api.IPFSPinStatusIndirect) {
+		return false
+	}
+
+	op := spt.optracker.TrackNewOperationIf(api.PinCid(c), optracker.OperationTrash, func(current *optracker.Operation) bool {
+		// it may have been tracked again meanwhile
+		return current == nil
+	})
+	if op == nil {
+		return false
+	}
+	spt.sendEvent(op.PinInfo(spt.peerID), false)
+
+	spt.scheduleEmptyTrash(op, spt.config.UnpinGracePeriod)
+	return true
+}
+
+func (spt *StatelessPinTracker) scheduleEmptyTrash(op *optracker.Operation, wait time.Duration) {
+	util.ScheduleEmptyTrash(op.Cid(), wait, func() { spt.emptyTrash(op) })
+}
+
+// emptyTrash unpins a trashed Cid, unless it has been tracked again
+// since.
+func (spt *StatelessPinTracker) emptyTrash(op *optracker.Operation) {
+	if spt.ctx.Err() != nil {
+		return
+	}
+
+	unpinOp := spt.optracker.TrackNewOperationIf(op.Pin(), optracker.OperationUnpin, func(current *optracker.Operation) bool {
+		return current == op
+	})
+	if unpinOp == nil {
+		return
+	}
+
+	logger.Infof("grace period for %s is over. Unpinning", op.Cid())
+	spt.enqueue(unpinOp, spt.bgCh)
+}
+
+func (spt *StatelessPinTracker) pinInfo(c *cid.Cid, st api.TrackerStatus, err error) api.PinInfo {
+	info := api.PinInfo{
+		Cid:    c,
+		Peer:   spt.peerID,
+		Status: st,
+		TS:     time.Now(),
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
+
+func (spt *StatelessPinTracker) getOp(c *cid.Cid) (api.PinInfo, bool) {
+	op, ok := spt.optracker.Get(c)
+	if !ok {
+		return api.PinInfo{}, false
+	}
+	return op.PinInfo(spt.peerID), true
+}
+
+// Status returns information for a Cid. Cids without ongoing or failed
+// operations are looked up in the shared state and in the IPFS daemon.
+// Cids allocated to this peer which are not pinned in IPFS are reported
+// as unpinned, and will be tracked again by the next state sync. The
+// status of MetaType pins is aggregated from that of their shards.
+func (spt *StatelessPinTracker) Status(c *cid.Cid) api.PinInfo {
+	if info, ok := spt.getOp(c); ok {
+		return info
+	}
+
+	var pinS api.PinSerial
+	err := spt.rpcClient.Call("",
+		"Cluster",
+		"TrackerPinGet",
+		api.PinCid(c).ToSerial(),
+		&pinS)
+	if err != nil { // not in the shared state
+		if sh, ok := spt.shardPin(c); ok {
+			return spt.pinStatus(sh)
+		}
+		return spt.pinInfo(c, api.TrackerStatusUnpinned, nil)
+	}
+
+	pin := pinS.ToPin()
+	if pin.Type == api.MetaType {
+		var shards []api.PinInfo
+		for _, sh := range pin.ShardPins() {
+			info, ok := spt.getOp(sh.Cid)
+			if !ok {
+				info = spt.pinStatus(sh)
+			}
+			shards = append(shards, info)
+		}
+		return api.ShardedPinInfo(c, spt.peerID, shards)
+	}
+	return spt.pinStatus(pin)
+}
+
+// pinStatus returns the status of an item without operations which
+// should be tracked by this peer.
+func (spt *StatelessPinTracker) pinStatus(pin api.Pin) api.PinInfo {
+	c := pin.Cid
+	if util.IsRemotePin(pin, spt.peerID) {
+		return spt.remotePinInfo(c)
+	}
+
+	ips, err := util.IPFSPinLsCid(spt.rpcClient, c)
+	switch {
+	case err != nil:
+		return spt.pinInfo(c, api.TrackerStatusPinError, err)
+	case ips.IsPinned():
+		return spt.pinInfo(c, api.TrackerStatusPinned, nil)
+	case ips == api.IPFSPinStatusIndirect:
+		return spt.pinInfo(c, api.TrackerStatusPinnedIndirect, nil)
+	default:
+		return spt.pinInfo(c, api.TrackerStatusUnpinned, nil)
+	}
+}
+
+// StatusAll returns information for all Cids in the shared state and for
+// those with ongoing or failed operations. It makes a single "pin ls"
+// request to the IPFS daemon, plus one for every allocated Cid which is
+// not pinned, since indirect pins are not listed. Shards of MetaType
+// pins are not listed on their own, but aggregated into the status of
+// their parent.
+func (spt *StatelessPinTracker) StatusAll() []api.PinInfo {
+	ops := make(map[string]api.PinInfo)
+	for _, op := range spt.optracker.All() {
+		ops[op.Cid().String()] = op.PinInfo(spt.peerID)
+	}
+
+	var pins []api.PinSerial
+	err := spt.rpcClient.Call("",
+		"Cluster",
+		"TrackerPins",
+		struct{}{},
+		&pins)
+	if err != nil {
+		logger.Error(err)
+		pins = nil
+	}
+
+	var ipsMap map[string]api.IPFSPinStatus
+	ipfsErr := spt.rpcClient.Call("",
+		"Cluster",
+		"IPFSPinLs",
+		"recursive",
+		&ipsMap)
+
+	status := func(pin api.Pin) api.PinInfo {
+		key := pin.Cid.String()
+		if info, ok := ops[key]; ok {
+			delete(ops, key)
+			return info
+		}
+
+		switch {
+		case util.IsRemotePin(pin, spt.peerID):
+			return spt.remotePinInfo(pin.Cid)
+		case ipfsErr != nil:
+			return spt.pinInfo(pin.Cid, api.TrackerStatusPinError, ipfsErr)
+		case ipsMap[key].IsPinned():
+			return spt.pinInfo(pin.Cid, api.TrackerStatusPinned, nil)
+		case util.PinnedIndirectly(spt.rpcClient, pin.Cid):
+			return spt.pinInfo(pin.Cid, api.TrackerStatusPinnedIndirect, nil)
+		default:
+			return spt.pinInfo(pin.Cid, api.TrackerStatusUnpinned, nil)
+		}
+	}
+
+	infos := make([]api.PinInfo, 0, len(pins)+len(ops))
+	for _, pinS := range pins {
+		pin := pinS.ToPin()
+		if pin.Type != api.MetaType {
+			infos = append(infos, status(pin))
+			continue
+		}
+
+		var shards []api.PinInfo
+		for _, sh := range pin.ShardPins() {
+			shards = append(shards, status(sh))
+		}
+		infos = append(infos, api.ShardedPinInfo(pin.Cid, spt.peerID, shards))
+	}
+
+	// operations on Cids which are no longer in the shared state
+	for _, info := range ops {
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Sync verifies that the operation for a Cid, if any, matches the status
+// reported by the IPFS daemon. Operations which are found to be done are
+// removed, and those which are taking too long are transitioned to
+// PinError or UnpinError.
+//
+// Sync returns the updated local status for the given Cid.
+// Pins in error states can be recovered with Recover().
+// An error is returned if we are unable to contact
+// the IPFS daemon.
+func (spt *StatelessPinTracker) Sync(c *cid.Cid) (api.PinInfo, error) {
+	spt.mux.RLock()
+	meta, isMeta := spt.metas[c.String()]
+	spt.mux.RUnlock()
+	if isMeta {
+		var err error
+		for _, sh := range meta.Shards {
+			if _, e := spt.Sync(sh); e != nil && err == nil {
+				err = e
+			}
+		}
+		return spt.Status(c), err
+	}
+
+	ips, err := util.IPFSPinLsCid(spt.rpcClient, c)
+
+	op, ok := spt.optracker.Get(c)
+	switch {
+	case !ok || op.Type() == optracker.OperationTrash:
+		// nothing to sync
+	case err != nil:
+		spt.setError(op, err)
+	default:
+		spt.syncOp(op, ips)
+	}
+
+	return spt.Status(c), err
+}
+
+// SyncAll runs Sync on all Cids with ongoing or failed operations. The
+// status of other Cids comes from IPFS, so it is always in sync.
+//
+// SyncAll returns the list of local status for the Cids which
+// were updated or have errors. Cids in error states can be recovered
+// with Recover().
+// An error is returned if we are unable to contact the IPFS daemon.
+func (spt *StatelessPinTracker) SyncAll() ([]api.PinInfo, error) {
+	var ipsMap map[string]api.IPFSPinStatus
+	err := spt.rpcClient.Call("",
+		"Cluster",
+		"IPFSPinLs",
+		"recursive",
+		&ipsMap)
+
+	var pInfos []api.PinInfo
+	for _, op := range spt.optracker.All() {
+		if op.Type() == optracker.OperationTrash {
+			// waiting to be unpinned. Nothing to sync.
+			continue
+		}
+		if err != nil {
+			if spt.setError(op, err) {
+				pInfos = append(pInfos, op.PinInfo(spt.peerID))
+			}
+			continue
+		}
+
+		ips, ok := ipsMap[op.Cid().String()]
+		if !ok && op.Type() == optracker.OperationPin {
+			// indirect pins are not listed
+			ips, _ = util.IPFSPinLsCid(spt.rpcClient, op.Cid())
+		}
+		info, changed := spt.syncOp(op, ips)
+		if changed ||
+			info.Status == api.TrackerStatusPinError ||
+			info.Status == api.TrackerStatusUnpinError {
+			pInfos = append(pInfos, info)
+		}
+	}
+	return pInfos, err
+}
+
+// syncOp updates an operation with the status of its Cid in IPFS.
+// Operations which are done are removed. It returns the resulting status
+// of the Cid and whether it changed. Operations replaced in the meantime
+// are left alone.
+func (spt *StatelessPinTracker) syncOp(op *optracker.Operation, ips api.IPFSPinStatus) (api.PinInfo, bool) {
+	pinned := ips.IsPinned()
+	indirect := ips == api.IPFSPinStatusIndirect
+	done := false
+	switch op.TrackerStatus() {
+	case api.TrackerStatusPinning:
+		if pinned || indirect {
+			done = true
+		} else if time.Since(op.Timestamp()) > spt.config.PinningTimeout {
+			changed := spt.setError(op, util.ErrPinningTimeout)
+			return op.PinInfo(spt.peerID), changed
+		}
+	case api.TrackerStatusPinError:
+		done = pinned || indirect
+	case api.TrackerStatusUnpinning, api.TrackerStatusRemote:
+		if !pinned {
+			done = true
+		} else if time.Since(op.Timestamp()) > spt.config.UnpinningTimeout {
+			changed := spt.setError(op, util.ErrUnpinningTimeout)
+			return op.PinInfo(spt.peerID), changed
+		}
+	case api.TrackerStatusUnpinError:
+		done = !pinned
+	}
+	if !done {
+		return op.PinInfo(spt.peerID), false
+	}
+
+	var status api.TrackerStatus = api.TrackerStatusUnpinned
+	switch {
+	case op.Type() == optracker.OperationRemote:
+		status = api.TrackerStatusRemote
+	case pinned:
+		status = api.TrackerStatusPinned
+	case indirect && op.Type() == optracker.OperationPin:
+		status = api.TrackerStatusPinnedIndirect
+	}
+	info := spt.pinInfo(op.Cid(), status, nil)
+	if !spt.optracker.Finish(op) || op.Type() == optracker.OperationRemote {
+		// replaced, or still remote: nothing changed
+		return info, false
+	}
+	spt.sendEvent(info, false)
+	return info, true
+}
+
+// Keepalive refreshes the timestamp of a Cid in pinning status and
+// records its progress. The pinning timeout counts from the last
+// keepalive, so pins which take very long but keep making progress are
+// not considered hung.
+func (spt *StatelessPinTracker) Keepalive(pp api.PinProgress) {
+	op, ok := spt.optracker.Get(pp.Cid)
+	if !ok || op.TrackerStatus() != api.TrackerStatusPinning {
+		return
+	}
+	op.SetProgress(pp.Blocks, pp.Size)
+}
+
+// Recover will re-track or re-untrack a Cid in error state,
+// possibly retriggering an IPFS pinning operation and returning
+// only when it is done. The pinning/unpinning operation happens
+// synchronously, jumping the queues.
+func (spt *StatelessPinTracker) Recover(c *cid.Cid) (api.PinInfo, error) {
+	spt.mux.RLock()
+	meta, isMeta := spt.metas[c.String()]
+	spt.mux.RUnlock()
+	if isMeta {
+		var err error
+		for _, sh := range meta.Shards {
+			if _, e := spt.Recover(sh); e != nil && err == nil {
+				err = e
+			}
+		}
+		return spt.Status(c), err
+	}
+
+	op := spt.recoveryOp(c)
+	if op == nil {
+		return spt.Status(c), nil
+	}
+
+	err := spt.run(op)
+	if err != nil {
+		logger.Errorf("error recovering %s: %s", c, err)
+	}
+	return spt.Status(c), err
+}
+
+// RecoverInBackground works like Recover, but the resulting operation is
+// queued along with other background maintenance operations, and it
+// returns without waiting for it.
+func (spt *StatelessPinTracker) RecoverInBackground(c *cid.Cid) error {
+	spt.mux.RLock()
+	meta, isMeta := spt.metas[c.String()]
+	spt.mux.RUnlock()
+	if isMeta {
+		var err error
+		for _, sh := range meta.Shards {
+			if e := spt.RecoverInBackground(sh); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+
+	op := spt.recoveryOp(c)
+	if op == nil {
+		return nil
+	}
+	return spt.enqueue(op, spt.bgCh)
+}
+
+// recoveryOp replaces the failed operation of a Cid with a new one. It
+// returns nil when the Cid does not need recovery.
+func (spt *StatelessPinTracker) recoveryOp(c *cid.Cid) *optracker.Operation {
+	logger.Infof("Attempting to recover %s", c)
+	failed, ok := spt.optracker.Get(c)
+	var op *optracker.Operation
+	if ok && failed.Phase() == optracker.PhaseError {
+		op = spt.optracker.TrackNewOperationIf(failed.Pin(), failed.Type(), func(current *optracker.Operation) bool {
+			return current == failed
+		})
+	}
+	if op == nil {
+		logger.Warningf("%s does not need recovery. Try syncing first", c)
+	}
+	return op
+}
+
+// RecoverAll attempts to recover all items with failed operations.
+func (spt *StatelessPinTracker) RecoverAll() ([]api.PinInfo, error) {
+	var failed []*cid.Cid
+	for _, op := range spt.optracker.All() {
+		if op.Phase() == optracker.PhaseError {
+			failed = append(failed, op.Cid())
+		}
+	}
+
+	resp := make([]api.PinInfo, 0)
+	for _, c := range failed {
+		r, err := spt.Recover(c)
+		if err != nil {
+			return resp, err
+		}
+		resp = append(resp, r)
+	}
+	return resp, nil
+}
+
+// verifyRemote asks the peers allocated to every remote item in the
+// shared state for its status. Items which are not pinned (or being
+// pinned) by all of them are reported as remote errors until they are.
+func (spt *StatelessPinTracker) verifyRemote() {
+	var pins []api.PinSerial
+	err := spt.rpcClient.Call("",
+		"Cluster",
+		"TrackerPins",
+		struct{}{},
+		&pins)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	remoteErrs := make(map[string]api.PinInfo)
+	for _, pinS := range pins {
+		if spt.ctx.Err() != nil {
+			return
+		}
+		pin := pinS.ToPin()
+		if !util.IsRemotePin(pin, spt.peerID) {
+			continue
+		}
+		if err := util.CheckRemote(spt.rpcClient, pin.Cid, pin.Allocations); err != nil {
+			remoteErrs[pin.Cid.String()] = spt.pinInfo(pin.Cid, api.TrackerStatusRemoteError, err)
+		}
+	}
+
+	spt.mux.Lock()
+	defer spt.mux.Unlock()
+	for k, info := range remoteErrs {
+		if prev, ok := spt.remoteErrs[k]; !ok || prev.Error != info.Error {
+			logger.Warningf("remote pin verification failed for %s: %s", k, info.Error)
+			spt.sendEvent(info, false)
+		}
+	}
+	for k, prev := range spt.remoteErrs {
+		if _, ok := remoteErrs[k]; !ok {
+			logger.Infof("%s is pinned by its allocations again", k)
+			spt.sendEvent(spt.pinInfo(prev.Cid, api.TrackerStatusRemote, nil), false)
+		}
+	}
+	spt.remoteErrs = remoteErrs
+}
+
+// remotePinInfo returns the status of an item allocated to other peers,
+// which is a remote error when it failed the last verification.
+func (spt *StatelessPinTracker) remotePinInfo(c *cid.Cid) api.PinInfo {
+	spt.mux.RLock()
+	defer spt.mux.RUnlock()
+	if info, ok := spt.remoteErrs[c.String()]; ok {
+		return info
+	}
+	return spt.pinInfo(c, api.TrackerStatusRemote, nil)
+}
+
+// persist saves the queued, ongoing and failed operations. Remote
+// operations are only a cleanup and are not saved.
+func (spt *StatelessPinTracker) persist() {
+	infos := make([]api.PinInfo, 0)
+	for _, op := range spt.optracker.All() {
+		if op.Type() != optracker.OperationRemote {
+			infos = append(infos, op.PinInfo(spt.peerID))
+		}
+	}
+	util.Persist(spt.store, infos)
+}
+
+// resume queues again an operation which was pending, or restores a
+// failed one, scheduling the next retry of failed pins.
+func (spt *StatelessPinTracker) resume(p api.PinInfo) bool {
+	var typ optracker.OperationType
+	switch p.Status {
+	case api.TrackerStatusPinning, api.TrackerStatusPinError:
+		typ = optracker.OperationPin
+	case api.TrackerStatusUnpinning, api.TrackerStatusUnpinError:
+		typ = optracker.OperationUnpin
+	case api.TrackerStatusTrashed:
+		typ = optracker.OperationTrash
+	default:
+		return false
+	}
+
+	op := spt.optracker.TrackNewOperationIf(api.PinCid(p.Cid), typ, func(current *optracker.Operation) bool {
+		return current == nil
+	})
+	if op == nil {
+		return false
+	}
+	op.SetAttempts(p.Attempts)
+
+	switch p.Status {
+	case api.TrackerStatusPinning, api.TrackerStatusUnpinning:
+		spt.enqueue(op, spt.bgCh)
+	case api.TrackerStatusPinError, api.TrackerStatusUnpinError:
+		spt.optracker.SetError(op, errors.New(p.Error))
+		op.SetTimestamp(p.TS)
+		spt.sendEvent(op.PinInfo(spt.peerID), false)
+		// only failed pin attempts are retried, not errors found
+		// when syncing.
+		if typ == optracker.OperationPin && p.Attempts > 0 && p.Attempts <= spt.config.MaxRetries {
+			spt.scheduleRetry(op, errors.New(p.Error))
+		}
+	case api.TrackerStatusTrashed:
+		op.SetTimestamp(p.TS)
+		spt.sendEvent(op.PinInfo(spt.peerID), false)
+		// the grace period counts from when it was trashed
+		spt.scheduleEmptyTrash(op, time.Until(p.TS.Add(spt.config.UnpinGracePeriod)))
+	}
+	return true
+}
+
+// Metrics returns the lengths of the queues, the number of IPFS requests
+// in progress and of operations in error state, and the retry and pin
+// counters of this tracker.
+func (spt *StatelessPinTracker) Metrics() api.TrackerMetrics {
+	m := api.TrackerMetrics{
+		Peer:            spt.peerID,
+		PinQueue:        len(spt.pinCh),
+		UnpinQueue:      len(spt.unpinCh),
+		BackgroundQueue: len(spt.bgCh),
+	}
+
+	for _, op := range spt.optracker.All() {
+		switch op.TrackerStatus() {
+		case api.TrackerStatusPinError:
+			m.PinErrors++
+		case api.TrackerStatusUnpinError:
+			m.UnpinErrors++
+		}
+	}
+
+	spt.counters.Fill(&m)
+	return m
+}
+
+// Events returns a channel on which an event is sent every time the
+// status of an item changes.
+func (spt *StatelessPinTracker) Events() <-chan api.PinEvent {
+	return spt.events
+}
+
+// SetClient makes the StatelessPinTracker ready to perform RPC requests to
+// other components.
+func (spt *StatelessPinTracker) SetClient(c *rpc.Client) {
+	spt.rpcClient = c
+	close(spt.rpcReady)
+}
@@ -0,0 +1,736 @@
+package stateless
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+	"github.com/ipfs/ipfs-cluster/pintracker/util"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func testStatelessPinTracker(t *testing.T) *StatelessPinTracker {
+	cfg := &Config{}
+	cfg.Default()
+	spt := NewStatelessPinTracker(cfg, test.TestPeerID1)
+	spt.SetClient(test.NewMockRPCClient(t))
+	return spt
+}
+
+// addOp records a pin operation for a Cid, failed with the given error,
+// if any.
+func addOp(spt *StatelessPinTracker, c *cid.Cid, err error) *optracker.Operation {
+	op := spt.optracker.TrackNewOperation(api.PinCid(c), optracker.OperationPin)
+	if err != nil {
+		spt.optracker.SetError(op, err)
+	}
+	return op
+}
+
+func TestNew(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+}
+
+func TestShutdown(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	err := spt.Shutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spt.Shutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetConcurrentPins(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	err := spt.SetConcurrentPins(0)
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	err = spt.SetConcurrentPins(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spt.workers != 3 || spt.config.ConcurrentPins != 3 {
+		t.Error("expected 3 workers")
+	}
+
+	err = spt.SetConcurrentPins(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spt.workers != 1 || spt.config.ConcurrentPins != 1 {
+		t.Error("expected 1 worker")
+	}
+}
+
+func TestTrack(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid1)
+	c := api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+	}
+
+	err := spt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if len(spt.optracker.All()) != 0 {
+		t.Error("successful operations should not be kept")
+	}
+	st := spt.Status(h)
+	if st.Status != api.TrackerStatusPinned {
+		t.Fatalf("cid should be pinned and is %s", st.Status)
+	}
+
+	// Reallocated pins are unpinned and reported as remote
+	c = api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{test.TestPeerID2},
+		ReplicationFactor: 1,
+	}
+	err = spt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if len(spt.optracker.All()) != 0 {
+		t.Error("the unpin of a reallocated pin should not be kept")
+	}
+	st = spt.Status(h)
+	if st.Status != api.TrackerStatusRemote &&
+		st.Status != api.TrackerStatusPinned { // cleanup done, read from state
+		t.Errorf("unexpected status %s", st.Status)
+	}
+}
+
+func TestTrackRemoteFailedPin(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	// TestCid2 is not pinned in the mock IPFS
+	h, _ := cid.Decode(test.TestCid2)
+	addOp(spt, h, errors.New("an error"))
+
+	err := spt.Track(api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{test.TestPeerID2},
+		ReplicationFactor: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spt.optracker.All()) != 0 {
+		t.Error("the failed pin should be dropped")
+	}
+	select {
+	case ev := <-spt.Events():
+		t.Errorf("no events expected for remote pins: %s", ev.Status)
+	default:
+	}
+}
+
+func TestTrackRemoteReallocated(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	// no workers, so the operations stay queued
+	cfg.ConcurrentPins = 0
+	cfg.ConcurrentBackgroundPins = 0
+	spt := NewStatelessPinTracker(cfg, test.TestPeerID1)
+	spt.SetClient(test.NewMockRPCClient(t))
+	defer spt.Shutdown()
+
+	// TestCid3 is pinned in the mock IPFS, TestCid2 is not
+	h3, _ := cid.Decode(test.TestCid3)
+	h2, _ := cid.Decode(test.TestCid2)
+	for _, h := range []*cid.Cid{h3, h2} {
+		err := spt.Track(api.Pin{
+			Cid:               h,
+			Allocations:       []peer.ID{test.TestPeerID2},
+			ReplicationFactor: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	op, ok := spt.optracker.Get(h3)
+	if !ok || op.Type() != optracker.OperationRemote {
+		t.Error("an item pinned before it was reallocated should be unpinned")
+	}
+	if _, ok := spt.optracker.Get(h2); ok {
+		t.Error("items which are not pinned need no operation")
+	}
+	if st := spt.Status(h3); st.Status != api.TrackerStatusRemote {
+		t.Errorf("the item should be remote, not %s", st.Status)
+	}
+}
+
+func TestUntrack(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid2)
+	c := api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+	}
+	err := spt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	err = spt.Untrack(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if len(spt.optracker.All()) != 0 {
+		t.Error("successful operations should not be kept")
+	}
+	// TestCid2 is not pinned in the mock IPFS
+	st := spt.Status(h)
+	if st.Status != api.TrackerStatusUnpinned {
+		t.Fatalf("cid should be unpinned and is %s", st.Status)
+	}
+}
+
+func TestTrackMeta(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	h3, _ := cid.Decode(test.TestCid3)
+	c := api.Pin{
+		Cid:               h2,
+		Type:              api.MetaType,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+		Shards:            []*cid.Cid{h1, h3},
+	}
+	err := spt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if len(spt.metas) != 1 {
+		t.Fatal("the meta pin should be kept")
+	}
+	if len(spt.optracker.All()) != 0 {
+		t.Error("successful shard pins should not be kept")
+	}
+	if _, ok := spt.shardPin(h3); !ok {
+		t.Error("TestCid3 should be a tracked shard")
+	}
+
+	err = spt.Untrack(h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if len(spt.metas) != 0 {
+		t.Error("the meta pin should have been removed")
+	}
+	if _, ok := spt.shardPin(h3); ok {
+		t.Error("TestCid3 should not be a tracked shard anymore")
+	}
+}
+
+func TestUnpinGracePeriod(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+	spt.config.UnpinGracePeriod = 300 * time.Millisecond
+
+	// TestCid1 is pinned in the mock IPFS
+	h, _ := cid.Decode(test.TestCid1)
+	c := api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+	}
+	err := spt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	err = spt.Untrack(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := spt.Status(h); st.Status != api.TrackerStatusTrashed {
+		t.Fatalf("cid should be trashed and is %s", st.Status)
+	}
+
+	// pinning it again takes it out of the trash
+	err = spt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if st := spt.Status(h); st.Status != api.TrackerStatusPinned {
+		t.Fatalf("cid should be pinned and is %s", st.Status)
+	}
+
+	err = spt.Untrack(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if len(spt.optracker.All()) != 0 {
+		t.Error("the trash should have been emptied")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.ErrorCid)
+	st := spt.Status(h)
+	if st.Status != api.TrackerStatusUnpinned {
+		t.Errorf("cids not in the state should be unpinned: %s", st.Status)
+	}
+
+	h, _ = cid.Decode(test.TestCid3)
+	st = spt.Status(h)
+	if st.Status != api.TrackerStatusPinned {
+		t.Errorf("expected pinned status: %s", st.Status)
+	}
+	if st.Peer != test.TestPeerID1 {
+		t.Error("expected this peer in the status")
+	}
+
+	h, _ = cid.Decode(test.IndirectCid)
+	st = spt.Status(h)
+	if st.Status != api.TrackerStatusPinnedIndirect {
+		t.Errorf("expected pinned_indirect status: %s", st.Status)
+	}
+}
+
+func TestTrackIndirect(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.IndirectCid)
+	c := api.Pin{
+		Cid:               h,
+		Allocations:       []peer.ID{},
+		ReplicationFactor: -1,
+	}
+
+	err := spt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if len(spt.optracker.All()) != 0 {
+		t.Error("the operation should be done without pinning")
+	}
+	st := spt.Status(h)
+	if st.Status != api.TrackerStatusPinnedIndirect {
+		t.Errorf("expected pinned_indirect status: %s", st.Status)
+	}
+}
+
+func TestStatusAll(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.ErrorCid)
+	addOp(spt, h, errors.New("an error"))
+
+	stAll := spt.StatusAll()
+	if len(stAll) != 4 {
+		t.Fatalf("expected 4 items, got %d", len(stAll))
+	}
+
+	statuses := make(map[string]api.TrackerStatus)
+	for _, st := range stAll {
+		statuses[st.Cid.String()] = st.Status
+	}
+	if statuses[test.TestCid1] != api.TrackerStatusPinned ||
+		statuses[test.TestCid3] != api.TrackerStatusPinned {
+		t.Error("expected pinned items")
+	}
+	if statuses[test.TestCid2] != api.TrackerStatusUnpinned {
+		t.Error("expected unpinned item")
+	}
+	if statuses[test.ErrorCid] != api.TrackerStatusPinError {
+		t.Error("expected item in error")
+	}
+}
+
+func TestPinTimeout(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.PinTimeout = 100 * time.Millisecond
+	cfg.MaxRetries = 0
+	spt := NewStatelessPinTracker(cfg, test.TestPeerID1)
+	spt.SetClient(test.NewMockRPCClient(t))
+	defer spt.Shutdown()
+
+	slow, _ := cid.Decode(test.SlowCid1)
+	err := spt.Track(api.Pin{Cid: slow, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	st := spt.Status(slow)
+	if st.Status != api.TrackerStatusPinError || st.Error != util.ErrPinTimeout.Error() {
+		t.Errorf("expected a pin timeout error: %s: %s", st.Status, st.Error)
+	}
+
+	// the only worker is free again
+	h, _ := cid.Decode(test.TestCid1)
+	err = spt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if spt.Status(h).Status != api.TrackerStatusPinned {
+		t.Error("expected the worker to process the next pin")
+	}
+}
+
+func TestCancelPin(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	slow, _ := cid.Decode(test.SlowCid1)
+	err := spt.Track(api.Pin{Cid: slow, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	op, _ := spt.optracker.Get(slow)
+
+	err = spt.CancelPin(slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !op.Cancelled() {
+		t.Error("the ongoing pin should have been cancelled")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := spt.optracker.Get(slow); ok {
+		t.Error("no operations should be left")
+	}
+
+	h, _ := cid.Decode(test.TestCid1)
+	err = spt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	err = spt.CancelPin(h)
+	if err == nil {
+		t.Error("expected an error cancelling a finished pin")
+	}
+	if _, ok := spt.optracker.Get(h); ok {
+		t.Error("a finished pin should be left alone")
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	slow, _ := cid.Decode(test.SlowCid1)
+	err := spt.Track(api.Pin{Cid: slow, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	ts := spt.Status(slow).TS
+	spt.Keepalive(api.PinProgress{Cid: slow, Blocks: 40, Size: 1000})
+	st := spt.Status(slow)
+	if st.Status != api.TrackerStatusPinning {
+		t.Fatal("expected the slow pin to be pinning")
+	}
+	if st.TS.Before(ts) || st.Blocks != 40 || st.Size != 1000 {
+		t.Error("keepalive should record the pin progress")
+	}
+
+	time.Sleep(time.Second)
+	st = spt.Status(slow)
+	if st.Status == api.TrackerStatusPinning || st.Blocks != 0 {
+		t.Error("progress should only be reported while pinning")
+	}
+}
+
+func TestPinRetry(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = 50 * time.Millisecond
+	spt := NewStatelessPinTracker(cfg, test.TestPeerID1)
+	spt.SetClient(test.NewMockRPCClient(t))
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.ErrorCid)
+	err := spt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	st := spt.Status(h)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 1 {
+		t.Errorf("expected pin_error after 1 attempt: %s, %d", st.Status, st.Attempts)
+	}
+
+	// retried after 50ms and 100ms
+	time.Sleep(400 * time.Millisecond)
+	st = spt.Status(h)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 3 {
+		t.Errorf("expected pin_error after 3 attempts: %s, %d", st.Status, st.Attempts)
+	}
+}
+
+func TestSyncAndRecover(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+
+	addOp(spt, h1, nil)
+	op := addOp(spt, h2, nil)
+	op.SetTimestamp(time.Now().Add(-2 * spt.config.PinningTimeout))
+
+	// TestCid1 is pinned in IPFS, so the operation is done
+	info, err := spt.Sync(h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != api.TrackerStatusPinned {
+		t.Errorf("expected pinned: %s", info.Status)
+	}
+
+	// TestCid2 is not pinned and the operation timed out
+	info, err = spt.Sync(h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != api.TrackerStatusPinError {
+		t.Errorf("expected pin_error: %s", info.Status)
+	}
+
+	info, err = spt.Recover(h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The mock pins successfully but does not report TestCid2 as pinned
+	if info.Status != api.TrackerStatusUnpinned {
+		t.Errorf("unexpected status after recover: %s", info.Status)
+	}
+	if len(spt.optracker.All()) != 0 {
+		t.Error("recovered operations should not be kept")
+	}
+}
+
+func TestRecoverAll(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	addOp(spt, h1, errors.New("an error"))
+
+	infos, err := spt.RecoverAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatal("expected one recovered item")
+	}
+	if infos[0].Status != api.TrackerStatusPinned {
+		t.Errorf("expected pinned: %s", infos[0].Status)
+	}
+}
+
+func TestRecoverInBackground(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	addOp(spt, h1, errors.New("an error"))
+
+	err := spt.RecoverInBackground(h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if st := spt.Status(h1).Status; st != api.TrackerStatusPinned {
+		t.Errorf("expected pinned: %s", st)
+	}
+}
+
+func TestSyncAll(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	synced, err := spt.SyncAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != 0 {
+		t.Fatal("should not have synced anything when there are no operations")
+	}
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	addOp(spt, h1, nil)
+	addOp(spt, h2, nil)
+
+	synced, err = spt.SyncAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != 1 || synced[0].Status != api.TrackerStatusPinned {
+		t.Errorf("expected only the pinned item to be synced: %+v", synced)
+	}
+	if len(spt.optracker.All()) != 1 {
+		t.Error("the pending operation should be kept")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stateless-persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.BaseDir = dir
+	cfg.PersistFile = "pintracker.json"
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = time.Minute
+	spt := NewStatelessPinTracker(cfg, test.TestPeerID1)
+	spt.SetClient(test.NewMockRPCClient(t))
+
+	h1, _ := cid.Decode(test.ErrorCid)
+	h2, _ := cid.Decode(test.SlowCid1)
+	h3, _ := cid.Decode(test.TestCid1)
+	spt.Track(api.Pin{Cid: h1, ReplicationFactor: -1})
+	time.Sleep(50 * time.Millisecond)
+	// the slow pin keeps the only pin worker busy so the last one
+	// stays queued
+	spt.Track(api.Pin{Cid: h2, ReplicationFactor: -1})
+	spt.Track(api.Pin{Cid: h3, ReplicationFactor: -1})
+	time.Sleep(50 * time.Millisecond)
+	if info, _ := spt.getOp(h3); info.Status != api.TrackerStatusPinning {
+		t.Fatal("expected a queued pin:", info.Status)
+	}
+	spt.Shutdown()
+
+	cfg.RetryBackoff = 50 * time.Millisecond
+	spt = NewStatelessPinTracker(cfg, test.TestPeerID1)
+	spt.SetClient(test.NewMockRPCClient(t))
+	defer spt.Shutdown()
+
+	time.Sleep(20 * time.Millisecond)
+	st, _ := spt.getOp(h1)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 1 {
+		t.Errorf("expected pin_error after 1 attempt: %s, %d", st.Status, st.Attempts)
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+	for _, h := range []*cid.Cid{h2, h3} {
+		if _, ok := spt.getOp(h); ok {
+			t.Errorf("expected the pin of %s to be resumed and done", h)
+		}
+	}
+	// retried after 50ms and 100ms, keeping the previous attempt
+	st, _ = spt.getOp(h1)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 3 {
+		t.Errorf("expected pin_error after 3 attempts: %s, %d", st.Status, st.Attempts)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid1)
+	spt.Track(api.Pin{Cid: h, ReplicationFactor: -1})
+
+	expected := []api.PinEvent{
+		{PinInfo: api.PinInfo{Status: api.TrackerStatusPinning}, Queued: true},
+		{PinInfo: api.PinInfo{Status: api.TrackerStatusPinning}},
+		{PinInfo: api.PinInfo{Status: api.TrackerStatusPinned}},
+	}
+	for _, exp := range expected {
+		select {
+		case ev := <-spt.Events():
+			if !ev.Cid.Equals(h) || ev.Status != exp.Status || ev.Queued != exp.Queued {
+				t.Errorf("expected %s (queued: %t), got %s (queued: %t)", exp.Status, exp.Queued, ev.Status, ev.Queued)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected an event")
+		}
+	}
+}
+
+func TestVerifyRemote(t *testing.T) {
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.ErrorCid)
+	allocs := []peer.ID{test.TestPeerID2}
+
+	if err := util.CheckRemote(spt.rpcClient, h1, allocs); err != nil {
+		t.Error("the allocation reports the item as pinned:", err)
+	}
+	if err := util.CheckRemote(spt.rpcClient, h2, allocs); err == nil {
+		t.Error("expected an error when the allocation fails")
+	}
+
+	spt.remoteErrs = map[string]api.PinInfo{
+		h2.String(): spt.pinInfo(h2, api.TrackerStatusRemoteError, errors.New("bad")),
+	}
+	if st := spt.remotePinInfo(h1); st.Status != api.TrackerStatusRemote {
+		t.Errorf("expected remote status: %s", st.Status)
+	}
+	if st := spt.remotePinInfo(h2); st.Status != api.TrackerStatusRemoteError {
+		t.Errorf("expected remote_error status: %s", st.Status)
+	}
+
+	// the shared state in the mock has no remote items
+	spt.verifyRemote()
+	if st := spt.remotePinInfo(h2); st.Status != api.TrackerStatusRemote {
+		t.Errorf("expected the remote error to be cleared: %s", st.Status)
+	}
+}
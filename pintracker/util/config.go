@@ -0,0 +1,278 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+// Default values for Config.
+const (
+	DefaultPinningTimeout   = 60 * time.Minute
+	DefaultUnpinningTimeout = 5 * time.Minute
+	DefaultMaxPinQueueSize  = 4096
+	DefaultConcurrentPins   = 1
+	DefaultEnqueueTimeout   = 30 * time.Second
+	DefaultMaxRetries       = 5
+	DefaultPinTimeout       = 24 * time.Hour
+	DefaultUnpinTimeout     = time.Hour
+	DefaultRetryBackoff     = time.Minute
+	DefaultPriorityRatio    = 4
+	DefaultPersistInterval  = 10 * time.Second
+	// background maintenance operations get their own workers
+	DefaultConcurrentBackgroundPins = 1
+)
+
+// Config holds the options shared by the PinTracker implementations.
+// Each of them embeds it in its own Config, which names the section of
+// the configuration file it is read from.
+type Config struct {
+	config.Saver
+
+	// PinningTimeout specifies how long to wait before a pinning state becomes a pin error.
+	// It counts from the last progress reported by IPFS for the pin.
+	PinningTimeout time.Duration
+	// UnpinningTimeout specifies how long to wait before an unpinning state becomes a pin error
+	UnpinningTimeout time.Duration
+	// PinTimeout specifies how long a single pin request to IPFS can
+	// take. Longer requests are cancelled, freeing the worker, and the
+	// item becomes a pin error.
+	PinTimeout time.Duration
+	// UnpinTimeout specifies how long a single unpin request to IPFS can
+	// take before it is cancelled and the item becomes an unpin error.
+	UnpinTimeout time.Duration
+	// MaxPinQueueSize specifies how many pin or unpin requests we can hold in the queue
+	// If higher, they will automatically marked with an error.
+	MaxPinQueueSize int
+	// MaxPinQueueRate specifies how many pins per second this peer
+	// sends to its IPFS daemon, so that bursts of pins allocated to it
+	// are smoothed out. Up to one second worth of pins can start at
+	// once. 0 disables the limit.
+	MaxPinQueueRate float64
+	// ConcurrentPins specifies how many pin and how many unpin requests
+	// from users can be processed at the same time.
+	ConcurrentPins int
+	// EnqueueTimeout specifies how long a pin or unpin request from users
+	// waits for room when the queue is full, before it is marked with an
+	// error. This slows down callers while workers catch up.
+	EnqueueTimeout time.Duration
+	// ConcurrentBackgroundPins specifies how many pin or unpin requests
+	// coming from background maintenance operations (i.e. state syncs)
+	// can be processed at the same time. They are queued separately from
+	// user requests.
+	ConcurrentBackgroundPins int
+	// PriorityRatio specifies how many user pins a pin worker processes
+	// for every background operation when both queues have items
+	// waiting. Pin workers also take background operations when there
+	// are no user pins, so bulk recoveries make progress without
+	// starving new pins.
+	PriorityRatio int
+	// MaxRetries specifies how many times a failed pin is retried
+	// automatically before it is left in error state. 0 disables
+	// retries.
+	MaxRetries int
+	// RetryBackoff specifies how long to wait before the first retry
+	// of a failed pin. The wait doubles on every attempt, up to an hour.
+	RetryBackoff time.Duration
+	// PersistFile specifies a file where queued, ongoing and failed
+	// operations are saved, so that they are resumed, keeping their
+	// retry counts, when the peer restarts. Relative paths are taken
+	// from the configuration folder. Empty disables it.
+	PersistFile string
+	// PersistInterval specifies how often operations are saved to
+	// PersistFile. They are saved on shutdown too.
+	PersistInterval time.Duration
+	// EncryptionKey, when set, is used to encrypt the PersistFile. It
+	// is not part of the configuration file: peers set it to the
+	// raft.encryption_key.
+	EncryptionKey []byte
+	// VerifyRemoteInterval specifies how often the items allocated to
+	// other peers are checked against the status reported by those
+	// peers. Items which are not pinned there become remote errors.
+	// 0 disables it.
+	VerifyRemoteInterval time.Duration
+	// UnpinGracePeriod specifies how long pinned items which are
+	// unpinned from the cluster are kept pinned in IPFS, as trashed, so
+	// that accidental unpins can be reverted by pinning them again.
+	// 0 disables it.
+	UnpinGracePeriod time.Duration
+}
+
+type jsonConfig struct {
+	PinningTimeout           string  `json:"pinning_timeout"`
+	UnpinningTimeout         string  `json:"unpinning_timeout"`
+	PinTimeout               string  `json:"pin_timeout"`
+	UnpinTimeout             string  `json:"unpin_timeout"`
+	MaxPinQueueSize          int     `json:"max_pin_queue_size"`
+	MaxPinQueueRate          float64 `json:"max_pin_queue_rate,omitempty"`
+	ConcurrentPins           int     `json:"concurrent_pins"`
+	EnqueueTimeout           string  `json:"enqueue_timeout"`
+	ConcurrentBackgroundPins int     `json:"concurrent_background_pins"`
+	MaxRetries               *int    `json:"max_retries,omitempty"`
+	RetryBackoff             string  `json:"retry_backoff"`
+	PriorityRatio            int     `json:"priority_ratio"`
+	PersistFile              string  `json:"persist_file,omitempty"`
+	PersistInterval          string  `json:"persist_interval"`
+	VerifyRemoteInterval     string  `json:"verify_remote_interval,omitempty"`
+	UnpinGracePeriod         string  `json:"unpin_grace_period,omitempty"`
+}
+
+// Default sets the fields of this Config to sensible values.
+func (cfg *Config) Default() error {
+	cfg.PinningTimeout = DefaultPinningTimeout
+	cfg.UnpinningTimeout = DefaultUnpinningTimeout
+	cfg.PinTimeout = DefaultPinTimeout
+	cfg.UnpinTimeout = DefaultUnpinTimeout
+	cfg.MaxPinQueueSize = DefaultMaxPinQueueSize
+	cfg.MaxPinQueueRate = 0
+	cfg.ConcurrentPins = DefaultConcurrentPins
+	cfg.EnqueueTimeout = DefaultEnqueueTimeout
+	cfg.ConcurrentBackgroundPins = DefaultConcurrentBackgroundPins
+	cfg.MaxRetries = DefaultMaxRetries
+	cfg.RetryBackoff = DefaultRetryBackoff
+	cfg.PriorityRatio = DefaultPriorityRatio
+	cfg.PersistFile = ""
+	cfg.PersistInterval = DefaultPersistInterval
+	cfg.VerifyRemoteInterval = 0
+	cfg.UnpinGracePeriod = 0
+	return nil
+}
+
+// ValidateSection checks that the fields of this Config have working
+// values, at least in appearance. Errors name the options as part of
+// the given configuration section.
+func (cfg *Config) ValidateSection(section string) error {
+	invalid := func(opt, reason string) error {
+		return fmt.Errorf("%s.%s %s", section, opt, reason)
+	}
+
+	if cfg.PinningTimeout <= 0 {
+		return invalid("pinning_timeout", "too low")
+	}
+	if cfg.UnpinningTimeout <= 0 {
+		return invalid("unpinning_timeout", "too low")
+	}
+	if cfg.PinTimeout <= 0 {
+		return invalid("pin_timeout", "too low")
+	}
+	if cfg.UnpinTimeout <= 0 {
+		return invalid("unpin_timeout", "too low")
+	}
+	if cfg.MaxPinQueueSize <= 0 {
+		return invalid("max_pin_queue_size", "too low")
+	}
+	if cfg.MaxPinQueueRate < 0 {
+		return invalid("max_pin_queue_rate", "is invalid")
+	}
+	if cfg.ConcurrentPins <= 0 {
+		return invalid("concurrent_pins", "too low")
+	}
+	if cfg.EnqueueTimeout <= 0 {
+		return invalid("enqueue_timeout", "too low")
+	}
+	if cfg.ConcurrentBackgroundPins <= 0 {
+		return invalid("concurrent_background_pins", "too low")
+	}
+	if cfg.MaxRetries < 0 {
+		return invalid("max_retries", "is invalid")
+	}
+	if cfg.RetryBackoff <= 0 {
+		return invalid("retry_backoff", "too low")
+	}
+	if cfg.PriorityRatio <= 0 {
+		return invalid("priority_ratio", "too low")
+	}
+	if cfg.PersistInterval <= 0 {
+		return invalid("persist_interval", "too low")
+	}
+	if cfg.VerifyRemoteInterval < 0 {
+		return invalid("verify_remote_interval", "is invalid")
+	}
+	if cfg.UnpinGracePeriod < 0 {
+		return invalid("unpin_grace_period", "is invalid")
+	}
+	return nil
+}
+
+// LoadJSONSection sets the fields of this Config to the values defined
+// by the JSON representation of it, as generated by ToJSON, and
+// validates them as part of the given configuration section.
+func (cfg *Config) LoadJSONSection(section string, raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Errorf("Error unmarshaling %s config", section)
+		return err
+	}
+
+	cfg.Default()
+
+	parseDuration := func(txt string) time.Duration {
+		d, _ := time.ParseDuration(txt)
+		if txt != "" && d == 0 {
+			logger.Warningf("%s is not a valid duration. Default will be used", txt)
+		}
+		return d
+	}
+
+	pinningTimeo := parseDuration(jcfg.PinningTimeout)
+	unpinningTimeo := parseDuration(jcfg.UnpinningTimeout)
+	pinTimeo := parseDuration(jcfg.PinTimeout)
+	unpinTimeo := parseDuration(jcfg.UnpinTimeout)
+	enqueueTimeo := parseDuration(jcfg.EnqueueTimeout)
+	retryBackoff := parseDuration(jcfg.RetryBackoff)
+	persistInterval := parseDuration(jcfg.PersistInterval)
+	verifyRemoteInterval := parseDuration(jcfg.VerifyRemoteInterval)
+	unpinGracePeriod := parseDuration(jcfg.UnpinGracePeriod)
+	config.SetIfNotDefault(pinningTimeo, &cfg.PinningTimeout)
+	config.SetIfNotDefault(unpinningTimeo, &cfg.UnpinningTimeout)
+	config.SetIfNotDefault(pinTimeo, &cfg.PinTimeout)
+	config.SetIfNotDefault(unpinTimeo, &cfg.UnpinTimeout)
+	config.SetIfNotDefault(jcfg.MaxPinQueueSize, &cfg.MaxPinQueueSize)
+	config.SetIfNotDefault(jcfg.MaxPinQueueRate, &cfg.MaxPinQueueRate)
+	config.SetIfNotDefault(jcfg.ConcurrentPins, &cfg.ConcurrentPins)
+	config.SetIfNotDefault(enqueueTimeo, &cfg.EnqueueTimeout)
+	config.SetIfNotDefault(jcfg.ConcurrentBackgroundPins, &cfg.ConcurrentBackgroundPins)
+	config.SetIfNotDefault(retryBackoff, &cfg.RetryBackoff)
+	config.SetIfNotDefault(jcfg.PriorityRatio, &cfg.PriorityRatio)
+	config.SetIfNotDefault(jcfg.PersistFile, &cfg.PersistFile)
+	config.SetIfNotDefault(persistInterval, &cfg.PersistInterval)
+	config.SetIfNotDefault(verifyRemoteInterval, &cfg.VerifyRemoteInterval)
+	config.SetIfNotDefault(unpinGracePeriod, &cfg.UnpinGracePeriod)
+	// 0 disables retries, so only a missing value means default
+	if jcfg.MaxRetries != nil {
+		cfg.MaxRetries = *jcfg.MaxRetries
+	}
+
+	return cfg.ValidateSection(section)
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.PinningTimeout = cfg.PinningTimeout.String()
+	jcfg.UnpinningTimeout = cfg.UnpinningTimeout.String()
+	jcfg.PinTimeout = cfg.PinTimeout.String()
+	jcfg.UnpinTimeout = cfg.UnpinTimeout.String()
+	jcfg.MaxPinQueueSize = cfg.MaxPinQueueSize
+	jcfg.MaxPinQueueRate = cfg.MaxPinQueueRate
+	jcfg.ConcurrentPins = cfg.ConcurrentPins
+	jcfg.EnqueueTimeout = cfg.EnqueueTimeout.String()
+	jcfg.ConcurrentBackgroundPins = cfg.ConcurrentBackgroundPins
+	jcfg.MaxRetries = &cfg.MaxRetries
+	jcfg.RetryBackoff = cfg.RetryBackoff.String()
+	jcfg.PriorityRatio = cfg.PriorityRatio
+	jcfg.PersistFile = cfg.PersistFile
+	jcfg.PersistInterval = cfg.PersistInterval.String()
+	if cfg.VerifyRemoteInterval > 0 {
+		jcfg.VerifyRemoteInterval = cfg.VerifyRemoteInterval.String()
+	}
+	if cfg.UnpinGracePeriod > 0 {
+		jcfg.UnpinGracePeriod = cfg.UnpinGracePeriod.String()
+	}
+
+	return config.DefaultJSONMarshal(jcfg)
+}
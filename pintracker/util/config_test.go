@@ -0,0 +1,170 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+      "pinning_timeout": "30s",
+      "unpinning_timeout": "15s",
+      "pin_timeout": "2h",
+      "unpin_timeout": "10m",
+      "max_pin_queue_size": 4092,
+      "max_pin_queue_rate": 0.5,
+      "concurrent_pins": 2,
+      "enqueue_timeout": "10s",
+      "concurrent_background_pins": 1,
+      "max_retries": 0,
+      "retry_backoff": "10s",
+      "priority_ratio": 2,
+      "persist_file": "pintracker.json",
+      "persist_interval": "5s",
+      "verify_remote_interval": "1m",
+      "unpin_grace_period": "24h"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSONSection("tracker", cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxRetries != 0 {
+		t.Error("expected retries to be disabled")
+	}
+	if cfg.PersistFile != "pintracker.json" || cfg.PersistInterval != 5*time.Second {
+		t.Error("expected persistence options to be loaded")
+	}
+	if cfg.VerifyRemoteInterval != time.Minute {
+		t.Error("expected verify_remote_interval to be loaded")
+	}
+	if cfg.MaxPinQueueRate != 0.5 {
+		t.Error("expected max_pin_queue_rate to be loaded")
+	}
+	if cfg.UnpinGracePeriod != 24*time.Hour {
+		t.Error("expected unpin_grace_period to be loaded")
+	}
+
+	j := &jsonConfig{}
+
+	json.Unmarshal(cfgJSON, j)
+	j.PinningTimeout = "-10"
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSONSection("tracker", tst)
+	if err != nil {
+		t.Error("did not expect an error")
+	}
+	if cfg.PinningTimeout != DefaultPinningTimeout {
+		t.Error("expected default pinning_timeout")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.ConcurrentPins = 0
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSONSection("tracker", tst)
+	if err != nil {
+		t.Error("did not expect an error")
+	}
+	if cfg.ConcurrentPins != DefaultConcurrentPins {
+		t.Error("expected default concurrent_pins")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.EnqueueTimeout = ""
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSONSection("tracker", tst)
+	if err != nil {
+		t.Error("did not expect an error")
+	}
+	if cfg.EnqueueTimeout != DefaultEnqueueTimeout {
+		t.Error("expected default enqueue_timeout")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MaxRetries = nil
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSONSection("tracker", tst)
+	if err != nil {
+		t.Error("did not expect an error")
+	}
+	if cfg.MaxRetries != DefaultMaxRetries {
+		t.Error("expected default max_retries")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSONSection("tracker", cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSONSection("tracker", newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.ValidateSection("tracker") != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.UnpinningTimeout = 0
+	if cfg.ValidateSection("tracker") == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.ConcurrentBackgroundPins = 0
+	if cfg.ValidateSection("tracker") == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinTimeout = 0
+	if cfg.ValidateSection("tracker") == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.EnqueueTimeout = 0
+	if cfg.ValidateSection("tracker") == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MaxRetries = -1
+	if cfg.ValidateSection("tracker") == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PriorityRatio = 0
+	if cfg.ValidateSection("tracker") == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MaxPinQueueRate = -1
+	if cfg.ValidateSection("tracker") == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PersistInterval = 0
+	err := cfg.ValidateSection("tracker")
+	if err == nil || err.Error() != "tracker.persist_interval too low" {
+		t.Fatal("expected error validating the tracker section:", err)
+	}
+}
@@ -0,0 +1,385 @@
+// Package util provides the configuration and the helpers shared by the
+// PinTracker implementations: checking allocations, making and
+// cancelling IPFS requests with timeouts, the queues and workers of the
+// operations, retries with backoff, the trash, events, saving the
+// operations, remote pin verification and the counters reported as
+// tracker metrics.
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/opstore"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("pintracker")
+
+// MaxRetryBackoff caps the wait between automatic retries of failed pins.
+const MaxRetryBackoff = time.Hour
+
+// Errors set on items whose operations take too long.
+var (
+	ErrUnpinningTimeout = errors.New("unpinning operation is taking too long")
+	ErrPinningTimeout   = errors.New("pinning operation is taking too long")
+	ErrPinTimeout       = errors.New("IPFS pin request timed out and was cancelled")
+	ErrUnpinTimeout     = errors.New("IPFS unpin request timed out and was cancelled")
+)
+
+// IsRemotePin returns true when the given peer is not allocated to the
+// pin, so it should not pin it.
+func IsRemotePin(c api.Pin, pid peer.ID) bool {
+	if c.ReplicationFactor < 0 {
+		return false
+	}
+
+	for _, p := range c.Allocations {
+		if p == pid {
+			return false
+		}
+	}
+	return true
+}
+
+// HasShard returns true when the Cid is one of the shards of a MetaType
+// pin.
+func HasShard(meta api.Pin, c *cid.Cid) bool {
+	for _, sh := range meta.Shards {
+		if sh.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryBackoff returns the wait before the next attempt, doubling the
+// base wait for every previous attempt.
+func RetryBackoff(base time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts && wait < MaxRetryBackoff; i++ {
+		wait *= 2
+	}
+	if wait > MaxRetryBackoff {
+		wait = MaxRetryBackoff
+	}
+	return wait
+}
+
+// IPFSPinLsCid returns the status of a Cid in the IPFS daemon.
+func IPFSPinLsCid(rpcClient *rpc.Client, c *cid.Cid) (api.IPFSPinStatus, error) {
+	var ips api.IPFSPinStatus
+	err := rpcClient.Call("",
+		"Cluster",
+		"IPFSPinLsCid",
+		api.PinCid(c).ToSerial(),
+		&ips)
+	return ips, err
+}
+
+// PinnedIndirectly returns true when IPFS reports the Cid as covered by
+// another recursive pin, so pinning it would be redundant. Errors are
+// ignored and left to the pin request itself.
+func PinnedIndirectly(rpcClient *rpc.Client, c *cid.Cid) bool {
+	ips, err := IPFSPinLsCid(rpcClient, c)
+	return err == nil && ips == api.IPFSPinStatusIndirect
+}
+
+// IPFSCall performs an IPFSPin or IPFSUnpin request. When it takes longer
+// than the given timeout, the ongoing IPFS request is cancelled and
+// timeoutErr is returned without waiting for it, so the worker is freed.
+// When the context is cancelled, it returns right away.
+func IPFSCall(ctx context.Context, rpcClient *rpc.Client, counters *Counters, method string, c api.Pin, timeout time.Duration, timeoutErr error) error {
+	counters.addInFlight(1)
+	defer counters.addInFlight(-1)
+
+	done := make(chan *rpc.Call, 1)
+	err := rpcClient.Go("",
+		"Cluster",
+		method,
+		c.ToSerial(),
+		&struct{}{},
+		done)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case call := <-done:
+		return call.Error
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	logger.Warningf("%s request for %s took longer than %s. Cancelling", method, c.LogName(), timeout)
+	CancelIPFS(rpcClient, c.Cid)
+	return timeoutErr
+}
+
+// CancelIPFS aborts the ongoing IPFS request for a Cid.
+func CancelIPFS(rpcClient *rpc.Client, c *cid.Cid) {
+	err := rpcClient.Call("",
+		"Cluster",
+		"IPFSCancel",
+		api.PinCid(c).ToSerial(),
+		&struct{}{})
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// CheckRemote returns an error when any of the given peers does not
+// report the Cid as pinned or pinning.
+func CheckRemote(rpcClient *rpc.Client, c *cid.Cid, allocs []peer.ID) error {
+	for _, p := range allocs {
+		var pinfo api.PinInfoSerial
+		err := rpcClient.Call(p,
+			"Cluster",
+			"TrackerStatus",
+			api.PinCid(c).ToSerial(),
+			&pinfo)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p.Pretty(), err)
+		}
+		switch st := api.TrackerStatusFromString(pinfo.Status); st {
+		case api.TrackerStatusPinned, api.TrackerStatusPinnedIndirect, api.TrackerStatusPinning:
+		default:
+			return fmt.Errorf("%s reports %s", p.Pretty(), st)
+		}
+	}
+	return nil
+}
+
+// PriorityWorker runs the operations from the user and the background
+// queues until stop is closed or the context is cancelled. Every ratio
+// user operations, a waiting background operation gets a turn.
+// Background operations are also taken when no user operations are
+// waiting.
+func PriorityWorker(ctx context.Context, stop <-chan struct{}, ratio int, user, bg <-chan *optracker.Operation, run func(*optracker.Operation)) {
+	served := 0 // user operations since the last background one
+	for {
+		if served < ratio {
+			select {
+			case op := <-user:
+				run(op)
+				served++
+				continue
+			default:
+			}
+		} else {
+			select {
+			case op := <-bg:
+				run(op)
+				served = 0
+				continue
+			default:
+			}
+		}
+
+		select {
+		case op := <-user:
+			run(op)
+			served++
+		case op := <-bg:
+			run(op)
+			served = 0
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Enqueue sends an operation to a queue. When the queue is full, it
+// waits up to timeout for the workers to make room. It returns false
+// when the operation could not be queued.
+func Enqueue(ctx context.Context, queue chan<- *optracker.Operation, op *optracker.Operation, timeout time.Duration) bool {
+	select {
+	case queue <- op:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		return false
+	}
+
+	logger.Debugf("queue is full. Waiting to enqueue %s", op.Cid())
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case queue <- op:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ScheduleRetry schedules a call to retry after the backoff for a pin
+// which has failed the given number of times, unless it has failed more
+// than MaxRetries times. It returns false when it gives up.
+func ScheduleRetry(cfg *Config, counters *Counters, c api.Pin, attempts int, err error, retry func()) bool {
+	if attempts > cfg.MaxRetries {
+		if cfg.MaxRetries > 0 {
+			logger.Errorf("giving up pinning %s after %d attempts: %s", c.LogName(), attempts, err)
+		}
+		return false
+	}
+
+	wait := RetryBackoff(cfg.RetryBackoff, attempts)
+	logger.Warningf("pinning %s failed (attempt %d). Retrying in %s: %s", c.LogName(), attempts, wait, err)
+	counters.Retried()
+	time.AfterFunc(wait, retry)
+	return true
+}
+
+// ScheduleEmptyTrash calls empty once the grace period of a trashed Cid
+// is over, wait from now.
+func ScheduleEmptyTrash(c *cid.Cid, wait time.Duration, empty func()) {
+	logger.Infof("%s trashed. It will be unpinned in %s", c, wait)
+	time.AfterFunc(wait, empty)
+}
+
+// SendEvent sends an event to the events channel of a tracker without
+// blocking. Events are dropped when nobody reads them.
+func SendEvent(events chan<- api.PinEvent, ev api.PinEvent) {
+	select {
+	case events <- ev:
+	default:
+		logger.Debug("event channel is full")
+	}
+}
+
+// Persist saves the given items to the store, leaving out those whose
+// operations do not need to be resumed.
+func Persist(store *opstore.Store, infos []api.PinInfo) {
+	persistable := make([]api.PinInfo, 0, len(infos))
+	for _, p := range infos {
+		if opstore.Persistable(p.Status) {
+			persistable = append(persistable, p)
+		}
+	}
+	err := store.Save(persistable)
+	if err != nil {
+		logger.Errorf("error saving pin tracker operations: %s", err)
+	}
+}
+
+// Loop waits for ready to be closed, runs start, if given, and then runs
+// f every interval until the context is cancelled.
+func Loop(ctx context.Context, ready <-chan struct{}, interval time.Duration, start, f func()) {
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return
+	}
+	if start != nil {
+		start()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// NewStore returns the Store where the operations are saved according to
+// the given configuration, encrypted with its EncryptionKey when set. It
+// returns nil when they are not saved.
+func NewStore(cfg *Config) (*opstore.Store, error) {
+	if cfg.PersistFile == "" {
+		return nil, nil
+	}
+	store := opstore.New(cfg.BaseDir, cfg.PersistFile)
+	if len(cfg.EncryptionKey) > 0 {
+		err := store.EncryptWith(cfg.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// Restore resumes the operations saved by a previous run, passing each
+// of them to resume, which returns false for those it leaves alone.
+func Restore(store *opstore.Store, resume func(api.PinInfo) bool) {
+	infos, err := store.Load()
+	if err != nil {
+		logger.Errorf("error loading pin tracker operations: %s", err)
+		return
+	}
+
+	resumed := 0
+	for _, p := range infos {
+		if resume(p) {
+			resumed++
+		}
+	}
+	if resumed > 0 {
+		logger.Infof("resumed %d pending or failed operations", resumed)
+	}
+}
+
+// Counters keeps the IPFS requests in progress, the retries and the
+// completed pins of a tracker, as reported by its Metrics. It is
+// thread-safe.
+type Counters struct {
+	mu       sync.Mutex
+	inFlight int
+	retries  int
+	pins     int
+	pinTime  time.Duration
+}
+
+func (cs *Counters) addInFlight(n int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.inFlight += n
+}
+
+// Retried counts an automatic retry.
+func (cs *Counters) Retried() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.retries++
+}
+
+// Pinned counts a pin request which succeeded after the given time.
+func (cs *Counters) Pinned(d time.Duration) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.pins++
+	cs.pinTime += d
+}
+
+// Fill sets the counters of the given metrics.
+func (cs *Counters) Fill(m *api.TrackerMetrics) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	m.InFlight = cs.inFlight
+	m.Retries = cs.retries
+	m.Pins = cs.pins
+	if cs.pins > 0 {
+		m.AvgPinLatency = cs.pinTime / time.Duration(cs.pins)
+	}
+}
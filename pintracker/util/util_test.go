@@ -0,0 +1,118 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	if RetryBackoff(time.Second, 1) != time.Second {
+		t.Error("first retry should wait the base time")
+	}
+	if RetryBackoff(time.Second, 3) != 4*time.Second {
+		t.Error("wait should double on every attempt")
+	}
+	if RetryBackoff(time.Second, 100) != MaxRetryBackoff {
+		t.Error("wait should be capped")
+	}
+}
+
+func TestPriorityWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opt := optracker.NewOperationTracker(ctx)
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	h3, _ := cid.Decode(test.TestCid3)
+
+	user := make(chan *optracker.Operation, 2)
+	bg := make(chan *optracker.Operation, 1)
+	user <- opt.TrackNewOperation(api.PinCid(h1), optracker.OperationPin)
+	user <- opt.TrackNewOperation(api.PinCid(h2), optracker.OperationPin)
+	bg <- opt.TrackNewOperation(api.PinCid(h3), optracker.OperationPin)
+
+	var ran []*cid.Cid
+	stop := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(stop)
+	}()
+	PriorityWorker(ctx, stop, 1, user, bg, func(op *optracker.Operation) {
+		ran = append(ran, op.Cid())
+	})
+	if len(ran) != 3 || !ran[0].Equals(h1) || !ran[1].Equals(h3) || !ran[2].Equals(h2) {
+		t.Error("background operations should get a turn every user operation:", ran)
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, _ := cid.Decode(test.TestCid1)
+	op := optracker.NewOperationTracker(ctx).TrackNewOperation(api.PinCid(h), optracker.OperationPin)
+
+	queue := make(chan *optracker.Operation, 1)
+	if !Enqueue(ctx, queue, op, 0) {
+		t.Fatal("the queue has room")
+	}
+	if Enqueue(ctx, queue, op, 0) {
+		t.Error("a full queue should fail right away without timeout")
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-queue
+	}()
+	if !Enqueue(ctx, queue, op, time.Second) {
+		t.Error("should wait for the queue to have room")
+	}
+}
+
+func TestIsRemotePin(t *testing.T) {
+	h, _ := cid.Decode(test.TestCid1)
+
+	if IsRemotePin(api.Pin{Cid: h, ReplicationFactor: -1}, test.TestPeerID1) {
+		t.Error("pins everywhere are never remote")
+	}
+	pin := api.Pin{
+		Cid:               h,
+		ReplicationFactor: 1,
+		Allocations:       []peer.ID{test.TestPeerID2},
+	}
+	if !IsRemotePin(pin, test.TestPeerID1) {
+		t.Error("expected a remote pin")
+	}
+	if IsRemotePin(pin, test.TestPeerID2) {
+		t.Error("the allocated peer should pin it")
+	}
+}
+
+func TestHasShard(t *testing.T) {
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	meta := api.Pin{Type: api.MetaType, Shards: []*cid.Cid{h1}}
+
+	if !HasShard(meta, h1) || HasShard(meta, h2) {
+		t.Error("unexpected HasShard result")
+	}
+}
+
+func TestCounters(t *testing.T) {
+	var cs Counters
+	cs.Retried()
+	cs.Pinned(time.Second)
+	cs.Pinned(3 * time.Second)
+
+	var m api.TrackerMetrics
+	cs.Fill(&m)
+	if m.Retries != 1 || m.Pins != 2 || m.AvgPinLatency != 2*time.Second {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+}
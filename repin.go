@@ -0,0 +1,127 @@
+package ipfscluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// RepinRateWindow is the period during which a peer can be assigned at
+// most RepinScheduler.PeerRate re-pinned items.
+var RepinRateWindow = time.Minute
+
+// RepinFunc re-allocates a pin, never allocating it to the given peers,
+// and returns the new allocations.
+type RepinFunc func(pin api.Pin, blacklist []peer.ID) ([]peer.ID, error)
+
+// RepinScheduler throttles the re-pinning of items out of failed or
+// removed peers. At most MaxConcurrent repins run at the same time and,
+// when PeerRate is larger than 0, no peer is assigned more than PeerRate
+// re-pinned items per RepinRateWindow. This prevents mass re-allocations
+// from overwhelming the cluster when many peers fail at once.
+type RepinScheduler struct {
+	// PeerRate is the maximum number of repins assigned to a single peer
+	// per RepinRateWindow. 0 means unlimited.
+	PeerRate int
+
+	ctx   context.Context
+	repin RepinFunc
+	slots chan struct{}
+
+	mux         sync.Mutex
+	windowStart time.Time
+	assigned    map[peer.ID]int
+}
+
+// NewRepinScheduler returns a RepinScheduler which uses the given function
+// to re-pin items. Repins waiting for a slot or for a peer's rate window to
+// reset are abandoned when the context is cancelled.
+func NewRepinScheduler(ctx context.Context, repin RepinFunc, maxConcurrent, peerRate int) *RepinScheduler {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	return &RepinScheduler{
+		PeerRate: peerRate,
+		ctx:      ctx,
+		repin:    repin,
+		slots:    make(chan struct{}, maxConcurrent),
+		assigned: make(map[peer.ID]int),
+	}
+}
+
+// Repin re-allocates the given pin out of the blacklisted peers. It blocks
+// until a slot is available and the repin has finished. Peers which have
+// reached their rate are excluded too. If the repin fails while some peers
+// are throttled, it is retried once their rate window resets.
+func (s *RepinScheduler) Repin(pin api.Pin, blacklist []peer.ID) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+	defer func() { <-s.slots }()
+
+	for {
+		throttled, reset := s.throttled()
+		allocs, err := s.repin(pin, append(throttled, blacklist...))
+		if err == nil {
+			s.assign(pin.Allocations, allocs)
+			return nil
+		}
+		if len(throttled) == 0 {
+			return err
+		}
+		logger.Infof("repinning %s failed with %d throttled peers. Retrying in %s: %s",
+			pin.Cid, len(throttled), reset, err)
+		select {
+		case <-time.After(reset):
+		case <-s.ctx.Done():
+			return err
+		}
+	}
+}
+
+// throttled returns the peers which have reached their rate in the
+// current window and the time left until the window resets.
+func (s *RepinScheduler) throttled() ([]peer.ID, time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.resetWindow()
+
+	peers := []peer.ID{}
+	if s.PeerRate <= 0 {
+		return peers, 0
+	}
+	for p, n := range s.assigned {
+		if n >= s.PeerRate {
+			peers = append(peers, p)
+		}
+	}
+	return peers, time.Until(s.windowStart.Add(RepinRateWindow))
+}
+
+// assign counts the peers in allocs which were not already allocated.
+func (s *RepinScheduler) assign(old, allocs []peer.ID) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.resetWindow()
+	for _, p := range allocs {
+		if !containsPeer(old, p) {
+			s.assigned[p]++
+		}
+	}
+}
+
+// resetWindow starts a new rate window when the current one has expired.
+// It must be called with the lock held.
+func (s *RepinScheduler) resetWindow() {
+	now := time.Now()
+	if now.Sub(s.windowStart) >= RepinRateWindow {
+		s.windowStart = now
+		s.assigned = make(map[peer.ID]int)
+	}
+}
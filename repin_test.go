@@ -0,0 +1,137 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestRepinSchedulerMaxConcurrent(t *testing.T) {
+	var mux sync.Mutex
+	running := 0
+	maxRunning := 0
+	repin := func(pin api.Pin, blacklist []peer.ID) ([]peer.ID, error) {
+		mux.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mux.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mux.Lock()
+		running--
+		mux.Unlock()
+		return []peer.ID{test.TestPeerID1}, nil
+	}
+
+	s := NewRepinScheduler(context.Background(), repin, 2, 0)
+	c, _ := cid.Decode(test.TestCid1)
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Repin(api.PinCid(c), []peer.ID{test.TestPeerID2})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxRunning != 2 {
+		t.Errorf("expected 2 concurrent repins, got %d", maxRunning)
+	}
+}
+
+func TestRepinSchedulerPeerRate(t *testing.T) {
+	var mux sync.Mutex
+	blacklists := [][]peer.ID{}
+	repin := func(pin api.Pin, blacklist []peer.ID) ([]peer.ID, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		blacklists = append(blacklists, blacklist)
+		if containsPeer(blacklist, test.TestPeerID1) {
+			return []peer.ID{test.TestPeerID3}, nil
+		}
+		return []peer.ID{test.TestPeerID1}, nil
+	}
+
+	s := NewRepinScheduler(context.Background(), repin, 1, 2)
+	c, _ := cid.Decode(test.TestCid1)
+	for i := 0; i < 3; i++ {
+		err := s.Repin(api.PinCid(c), []peer.ID{test.TestPeerID2})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if containsPeer(blacklists[1], test.TestPeerID1) {
+		t.Error("peer should not be throttled before reaching its rate")
+	}
+	if !containsPeer(blacklists[2], test.TestPeerID1) {
+		t.Error("peer should be throttled after reaching its rate")
+	}
+	if !containsPeer(blacklists[2], test.TestPeerID2) {
+		t.Error("the given blacklist should be kept")
+	}
+}
+
+func TestRepinSchedulerRetryAfterWindow(t *testing.T) {
+	window := RepinRateWindow
+	RepinRateWindow = 200 * time.Millisecond
+	defer func() { RepinRateWindow = window }()
+
+	repin := func(pin api.Pin, blacklist []peer.ID) ([]peer.ID, error) {
+		if containsPeer(blacklist, test.TestPeerID1) {
+			return nil, errors.New("not enough candidates")
+		}
+		return []peer.ID{test.TestPeerID1}, nil
+	}
+
+	s := NewRepinScheduler(context.Background(), repin, 1, 1)
+	c, _ := cid.Decode(test.TestCid1)
+	err := s.Repin(api.PinCid(c), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = s.Repin(api.PinCid(c), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("expected repin to wait for the rate window to reset")
+	}
+}
+
+func TestRepinSchedulerCancelled(t *testing.T) {
+	repin := func(pin api.Pin, blacklist []peer.ID) ([]peer.ID, error) {
+		if containsPeer(blacklist, test.TestPeerID1) {
+			return nil, errors.New("not enough candidates")
+		}
+		return []peer.ID{test.TestPeerID1}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewRepinScheduler(ctx, repin, 1, 1)
+	c, _ := cid.Decode(test.TestCid1)
+	s.Repin(api.PinCid(c), nil)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	err := s.Repin(api.PinCid(c), nil)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
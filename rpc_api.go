@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	peer "github.com/libp2p/go-libp2p-peer"
+	multihash "github.com/multiformats/go-multihash"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
@@ -30,6 +31,107 @@ func (rpcapi *RPCAPI) ID(in struct{}, out *api.IDSerial) error {
 	return nil
 }
 
+// Health runs Cluster.Health().
+func (rpcapi *RPCAPI) Health(in struct{}, out *api.HealthSerial) error {
+	*out = rpcapi.c.Health().ToSerial()
+	return nil
+}
+
+// ConnectGraph runs Cluster.ConnectGraph().
+func (rpcapi *RPCAPI) ConnectGraph(in struct{}, out *api.ConnectGraphSerial) error {
+	graph, err := rpcapi.c.ConnectGraph()
+	*out = graph.ToSerial()
+	return err
+}
+
+// PeersLiveness runs Cluster.PeersLiveness().
+func (rpcapi *RPCAPI) PeersLiveness(in struct{}, out *[]api.PeerLivenessSerial) error {
+	lives, err := rpcapi.c.PeersLiveness()
+	serials := make([]api.PeerLivenessSerial, len(lives), len(lives))
+	for i, l := range lives {
+		serials[i] = l.ToSerial()
+	}
+	*out = serials
+	return err
+}
+
+// ConsensusStatus runs Cluster.ConsensusStatus().
+func (rpcapi *RPCAPI) ConsensusStatus(in struct{}, out *api.ConsensusStatusSerial) error {
+	*out = rpcapi.c.ConsensusStatus().ToSerial()
+	return nil
+}
+
+// ConsensusStatusAll runs Cluster.ConsensusStatusAll().
+func (rpcapi *RPCAPI) ConsensusStatusAll(in struct{}, out *[]api.ConsensusStatusSerial) error {
+	statuses, err := rpcapi.c.ConsensusStatusAll()
+	serials := make([]api.ConsensusStatusSerial, 0, len(statuses))
+	for _, s := range statuses {
+		serials = append(serials, s.ToSerial())
+	}
+	*out = serials
+	return err
+}
+
+// StateChecksum runs Cluster.StateChecksum().
+func (rpcapi *RPCAPI) StateChecksum(in struct{}, out *api.StateChecksumSerial) error {
+	sum, err := rpcapi.c.StateChecksum()
+	*out = sum.ToSerial()
+	return err
+}
+
+// StateBucket runs Cluster.StateBucket().
+func (rpcapi *RPCAPI) StateBucket(in int, out *[]api.PinSerial) error {
+	pins, err := rpcapi.c.StateBucket(in)
+	serials := make([]api.PinSerial, 0, len(pins))
+	for _, p := range pins {
+		serials = append(serials, p.ToSerial())
+	}
+	*out = serials
+	return err
+}
+
+// StateVerify runs Cluster.StateVerify().
+func (rpcapi *RPCAPI) StateVerify(in struct{}, out *[]api.StateDiffSerial) error {
+	diffs, err := rpcapi.c.StateVerify()
+	serials := make([]api.StateDiffSerial, 0, len(diffs))
+	for _, d := range diffs {
+		serials = append(serials, d.ToSerial())
+	}
+	*out = serials
+	return err
+}
+
+// SyncStatus runs Cluster.SyncStatus().
+func (rpcapi *RPCAPI) SyncStatus(in struct{}, out *api.SyncStatusSerial) error {
+	*out = rpcapi.c.SyncStatus().ToSerial()
+	return nil
+}
+
+// PublicStatus runs Cluster.PublicStatus().
+func (rpcapi *RPCAPI) PublicStatus(in struct{}, out *api.PublicStatus) error {
+	status, err := rpcapi.c.PublicStatus()
+	*out = status
+	return err
+}
+
+// ResolveMultihash runs Cluster.ResolveMultihash().
+func (rpcapi *RPCAPI) ResolveMultihash(in string, out *api.ResolvedMultihash) error {
+	mh, err := multihash.FromB58String(in)
+	if err != nil {
+		return err
+	}
+	c, available, err := rpcapi.c.ResolveMultihash(mh)
+	if err != nil {
+		return err
+	}
+	*out = api.ResolvedMultihash{
+		Multihash: in,
+		Cid:       c.String(),
+		Available: available,
+	}
+	return nil
+}
+
 // Pin runs Cluster.Pin().
 func (rpcapi *RPCAPI) Pin(in api.PinSerial, out *struct{}) error {
 	return rpcapi.c.Pin(in.ToPin())
@@ -37,12 +139,43 @@ func (rpcapi *RPCAPI) Pin(in api.PinSerial, out *struct{}) error {
 
 // Unpin runs Cluster.Unpin().
 func (rpcapi *RPCAPI) Unpin(in api.PinSerial, out *struct{}) error {
+	return rpcapi.c.unpin(in.ToPin())
+}
+
+// UnpinNamespace runs Cluster.UnpinNamespace().
+func (rpcapi *RPCAPI) UnpinNamespace(in api.PinSerial, out *struct{}) error {
+	return rpcapi.c.unpinNamespace(in.ToPin())
+}
+
+// Namespaces runs Cluster.Namespaces().
+func (rpcapi *RPCAPI) Namespaces(in struct{}, out *[]api.Namespace) error {
+	*out = rpcapi.c.Namespaces()
+	return nil
+}
+
+// NamespacePins runs Cluster.NamespacePins().
+func (rpcapi *RPCAPI) NamespacePins(in string, out *[]api.PinSerial) error {
+	pins, err := rpcapi.c.NamespacePins(in)
+	serials := make([]api.PinSerial, 0, len(pins))
+	for _, p := range pins {
+		serials = append(serials, p.ToSerial())
+	}
+	*out = serials
+	return err
+}
+
+// CancelPin runs Cluster.CancelPin().
+func (rpcapi *RPCAPI) CancelPin(in api.PinSerial, out *struct{}) error {
 	c := in.ToPin().Cid
-	return rpcapi.c.Unpin(c)
+	return rpcapi.c.CancelPin(c)
 }
 
 // Pins runs Cluster.Pins().
 func (rpcapi *RPCAPI) Pins(in struct{}, out *[]api.PinSerial) error {
+	err := rpcapi.c.checkStaleness()
+	if err != nil {
+		return err
+	}
 	cidList := rpcapi.c.Pins()
 	cidSerialList := make([]api.PinSerial, 0, len(cidList))
 	for _, c := range cidList {
@@ -52,6 +185,80 @@ func (rpcapi *RPCAPI) Pins(in struct{}, out *[]api.PinSerial) error {
 	return nil
 }
 
+// PinsPage runs Cluster.PinsPage().
+func (rpcapi *RPCAPI) PinsPage(in api.PinsPage, out *[]api.PinSerial) error {
+	err := rpcapi.c.checkStaleness()
+	if err != nil {
+		return err
+	}
+	pins := rpcapi.c.PinsPage(in)
+	serials := make([]api.PinSerial, 0, len(pins))
+	for _, p := range pins {
+		serials = append(serials, p.ToSerial())
+	}
+	*out = serials
+	return nil
+}
+
+// PinBatch runs Cluster.PinBatch(). The number of pins committed is
+// set even when it fails.
+func (rpcapi *RPCAPI) PinBatch(in []api.PinSerial, out *int) error {
+	pins := make([]api.Pin, 0, len(in))
+	for _, p := range in {
+		pins = append(pins, p.ToPin())
+	}
+	n, err := rpcapi.c.PinBatch(pins)
+	*out = n
+	return err
+}
+
+// Batch runs Cluster.Batch().
+func (rpcapi *RPCAPI) Batch(in []api.BatchItemSerial, out *[]api.BatchResult) error {
+	items := make([]api.BatchItem, 0, len(in))
+	for _, i := range in {
+		items = append(items, i.ToBatchItem())
+	}
+	*out = rpcapi.c.Batch(items)
+	return nil
+}
+
+// PinLog runs Cluster.PinLog().
+func (rpcapi *RPCAPI) PinLog(in uint64, out *[]api.PinLogEntrySerial) error {
+	entries, err := rpcapi.c.PinLog(in)
+	serials := make([]api.PinLogEntrySerial, 0, len(entries))
+	for _, e := range entries {
+		serials = append(serials, e.ToSerial())
+	}
+	*out = serials
+	return err
+}
+
+// PinLogAdd records operations applied to the shared state in the pin
+// log of the peer. It is used by the Consensus component. All the
+// entries share the sequence number of the first one.
+func (rpcapi *RPCAPI) PinLogAdd(in []api.PinLogEntrySerial, out *struct{}) error {
+	if len(in) == 0 {
+		return nil
+	}
+	entries := make([]api.PinLogEntry, 0, len(in))
+	for _, e := range in {
+		entries = append(entries, e.ToPinLogEntry())
+	}
+	_, err := rpcapi.c.pinLog.add(in[0].Seq, entries)
+	return err
+}
+
+// Events runs Cluster.Events().
+func (rpcapi *RPCAPI) Events(in uint64, out *[]api.EventSerial) error {
+	evs := rpcapi.c.Events(in)
+	serials := make([]api.EventSerial, 0, len(evs))
+	for _, ev := range evs {
+		serials = append(serials, ev.ToSerial())
+	}
+	*out = serials
+	return nil
+}
+
 // PinGet runs Cluster.PinGet().
 func (rpcapi *RPCAPI) PinGet(in api.PinSerial, out *api.PinSerial) error {
 	cidarg := in.ToPin()
@@ -62,10 +269,140 @@ func (rpcapi *RPCAPI) PinGet(in api.PinSerial, out *api.PinSerial) error {
 	return err
 }
 
+// DuplicatePins runs Cluster.DuplicatePins().
+func (rpcapi *RPCAPI) DuplicatePins(in struct{}, out *[]api.DuplicatePinsSerial) error {
+	dups, err := rpcapi.c.DuplicatePins()
+	*out = duplicatePinsToSerial(dups)
+	return err
+}
+
+// MergeDuplicatePins runs Cluster.MergeDuplicatePins().
+func (rpcapi *RPCAPI) MergeDuplicatePins(in struct{}, out *[]api.DuplicatePinsSerial) error {
+	dups, err := rpcapi.c.MergeDuplicatePins()
+	*out = duplicatePinsToSerial(dups)
+	return err
+}
+
+// StateStats runs Cluster.StateStats().
+func (rpcapi *RPCAPI) StateStats(in string, out *api.StateStatsSerial) error {
+	stats, err := rpcapi.c.StateStats(in)
+	*out = stats.ToSerial()
+	return err
+}
+
+// AllocationPreview runs Cluster.AllocationPreview().
+func (rpcapi *RPCAPI) AllocationPreview(in api.AllocationPreviewSerial, out *api.PinSerial) error {
+	c := in.ToPin().Cid
+	pin, err := rpcapi.c.AllocationPreview(c,
+		in.ReplicationFactorMin,
+		in.ReplicationFactorMax)
+	*out = pin.ToSerial()
+	return err
+}
+
+// SimulateAllocations runs Cluster.SimulateAllocations().
+func (rpcapi *RPCAPI) SimulateAllocations(in []api.PinSerial, out *api.AllocationSimulationSerial) error {
+	pins := make([]api.Pin, len(in), len(in))
+	for i, p := range in {
+		pins[i] = p.ToPin()
+	}
+	sim, err := rpcapi.c.SimulateAllocations(pins)
+	*out = sim.ToSerial()
+	return err
+}
+
+// SetLogLevel runs Cluster.SetLogLevel().
+func (rpcapi *RPCAPI) SetLogLevel(in api.LogLevel, out *struct{}) error {
+	return rpcapi.c.SetLogLevel(in.Component, in.Level)
+}
+
+// SetLogLevelAllPeers runs Cluster.SetLogLevelAllPeers().
+func (rpcapi *RPCAPI) SetLogLevelAllPeers(in api.LogLevel, out *struct{}) error {
+	return rpcapi.c.SetLogLevelAllPeers(in.Component, in.Level)
+}
+
+// Snapshot runs Cluster.Snapshot().
+func (rpcapi *RPCAPI) Snapshot(in struct{}, out *struct{}) error {
+	return rpcapi.c.Snapshot()
+}
+
+// SetAllocationStrategy runs Cluster.SetAllocationStrategy().
+func (rpcapi *RPCAPI) SetAllocationStrategy(in api.AllocationStrategy, out *struct{}) error {
+	return rpcapi.c.SetAllocationStrategy(in.Name)
+}
+
+// SetAllocationStrategyAllPeers runs Cluster.SetAllocationStrategyAllPeers().
+func (rpcapi *RPCAPI) SetAllocationStrategyAllPeers(in api.AllocationStrategy, out *struct{}) error {
+	return rpcapi.c.SetAllocationStrategyAllPeers(in.Name)
+}
+
+// SetRuntimeConfig runs Cluster.SetRuntimeConfig().
+func (rpcapi *RPCAPI) SetRuntimeConfig(in api.RuntimeConfig, out *struct{}) error {
+	return rpcapi.c.SetRuntimeConfig(in)
+}
+
+// SetRuntimeConfigAllPeers runs Cluster.SetRuntimeConfigAllPeers().
+func (rpcapi *RPCAPI) SetRuntimeConfigAllPeers(in api.RuntimeConfig, out *struct{}) error {
+	return rpcapi.c.SetRuntimeConfigAllPeers(in)
+}
+
+// RPCCall runs Cluster.RPCCall().
+func (rpcapi *RPCAPI) RPCCall(in api.RPCCallSerial, out *[]byte) error {
+	var p peer.ID
+	if in.Peer != "" {
+		pid, err := peer.IDB58Decode(in.Peer)
+		if err != nil {
+			return err
+		}
+		p = pid
+	}
+	res, err := rpcapi.c.RPCCall(p, in.Service, in.Method, in.Args)
+	*out = res
+	return err
+}
+
+// ScalingAdvice runs Cluster.ScalingAdvice().
+func (rpcapi *RPCAPI) ScalingAdvice(in struct{}, out *api.ScalingAdviceSerial) error {
+	adv, err := rpcapi.c.ScalingAdvice()
+	*out = adv.ToSerial()
+	return err
+}
+
+// AllocationHistory runs Cluster.AllocationHistory().
+func (rpcapi *RPCAPI) AllocationHistory(in api.PinSerial, out *[]api.AllocationRecordSerial) error {
+	c := in.ToPin().Cid
+	records, err := rpcapi.c.AllocationHistory(c)
+	*out = allocationRecordSliceToSerial(records)
+	return err
+}
+
+// AllocationHistoryLocal runs Cluster.AllocationHistoryLocal().
+func (rpcapi *RPCAPI) AllocationHistoryLocal(in api.PinSerial, out *[]api.AllocationRecordSerial) error {
+	c := in.ToPin().Cid
+	records := rpcapi.c.AllocationHistoryLocal(c)
+	*out = allocationRecordSliceToSerial(records)
+	return nil
+}
+
+// AllocationDecisions runs Cluster.AllocationDecisions().
+func (rpcapi *RPCAPI) AllocationDecisions(in struct{}, out *[]api.AllocationRecordSerial) error {
+	records, err := rpcapi.c.AllocationDecisions()
+	*out = allocationRecordSliceToSerial(records)
+	return err
+}
+
+// AllocationDecisionsLocal runs Cluster.AllocationDecisionsLocal().
+func (rpcapi *RPCAPI) AllocationDecisionsLocal(in struct{}, out *[]api.AllocationRecordSerial) error {
+	records := rpcapi.c.AllocationDecisionsLocal()
+	*out = allocationRecordSliceToSerial(records)
+	return nil
+}
+
 // Version runs Cluster.Version().
 func (rpcapi *RPCAPI) Version(in struct{}, out *api.Version) error {
 	*out = api.Version{
 		Version: rpcapi.c.Version(),
+		Schema:  api.SchemaVersion,
 	}
 	return nil
 }
@@ -94,6 +431,28 @@ func (rpcapi *RPCAPI) PeerRemove(in peer.ID, out *struct{}) error {
 	return rpcapi.c.PeerRemove(in)
 }
 
+// PeerRemoval runs Cluster.PeerRemoval().
+func (rpcapi *RPCAPI) PeerRemoval(in peer.ID, out *api.PeerRemovalSerial) error {
+	pr, err := rpcapi.c.PeerRemoval(in)
+	if err == nil {
+		*out = pr.ToSerial()
+	}
+	return err
+}
+
+// PeerMaintenance runs Cluster.PeerMaintenance().
+func (rpcapi *RPCAPI) PeerMaintenance(in api.PeerMaintenanceSerial, out *struct{}) error {
+	pm := in.ToPeerMaintenance()
+	return rpcapi.c.PeerMaintenance(pm.Peer, pm.Enabled)
+}
+
+// MaintenancePeers runs Cluster.MaintenancePeers().
+func (rpcapi *RPCAPI) MaintenancePeers(in struct{}, out *[]string) error {
+	peers, err := rpcapi.c.MaintenancePeers()
+	*out = api.PeersToStrings(peers)
+	return err
+}
+
 // Join runs Cluster.Join().
 func (rpcapi *RPCAPI) Join(in api.MultiaddrSerial, out *struct{}) error {
 	addr := in.ToMultiaddr()
@@ -102,19 +461,35 @@ func (rpcapi *RPCAPI) Join(in api.MultiaddrSerial, out *struct{}) error {
 }
 
 // StatusAll runs Cluster.StatusAll().
-func (rpcapi *RPCAPI) StatusAll(in struct{}, out *[]api.GlobalPinInfoSerial) error {
-	pinfos, err := rpcapi.c.StatusAll()
+func (rpcapi *RPCAPI) StatusAll(in api.StatusFilter, out *[]api.GlobalPinInfoSerial) error {
+	pinfos, err := rpcapi.c.StatusAll(in)
 	*out = globalPinInfoSliceToSerial(pinfos)
 	return err
 }
 
 // StatusAllLocal runs Cluster.StatusAllLocal().
-func (rpcapi *RPCAPI) StatusAllLocal(in struct{}, out *[]api.PinInfoSerial) error {
-	pinfos := rpcapi.c.StatusAllLocal()
+func (rpcapi *RPCAPI) StatusAllLocal(in api.StatusFilter, out *[]api.PinInfoSerial) error {
+	pinfos := rpcapi.c.StatusAllLocal(in)
 	*out = pinInfoSliceToSerial(pinfos)
 	return nil
 }
 
+// StatusAllChunk runs Cluster.StatusAllChunk(), or returns the status of
+// the given Cids when they are set.
+func (rpcapi *RPCAPI) StatusAllChunk(in api.StatusChunk, out *[]api.GlobalPinInfoSerial) error {
+	pinfos, err := rpcapi.c.statusChunk(in)
+	*out = globalPinInfoSliceToSerial(pinfos)
+	return err
+}
+
+// StatusAllLocalChunk runs Cluster.StatusAllLocalChunk(), or returns the
+// local status of the given Cids when they are set.
+func (rpcapi *RPCAPI) StatusAllLocalChunk(in api.StatusChunk, out *[]api.PinInfoSerial) error {
+	pinfos, err := rpcapi.c.localStatusChunk(in)
+	*out = pinInfoSliceToSerial(pinfos)
+	return err
+}
+
 // Status runs Cluster.Status().
 func (rpcapi *RPCAPI) Status(in api.PinSerial, out *api.GlobalPinInfoSerial) error {
 	c := in.ToPin().Cid
@@ -161,9 +536,16 @@ func (rpcapi *RPCAPI) SyncLocal(in api.PinSerial, out *api.PinInfoSerial) error
 	return err
 }
 
+// RecoverAll runs Cluster.RecoverAll().
+func (rpcapi *RPCAPI) RecoverAll(in api.StatusFilter, out *[]api.GlobalPinInfoSerial) error {
+	pinfos, err := rpcapi.c.RecoverAll(in)
+	*out = globalPinInfoSliceToSerial(pinfos)
+	return err
+}
+
 // RecoverAllLocal runs Cluster.RecoverAllLocal().
-func (rpcapi *RPCAPI) RecoverAllLocal(in struct{}, out *[]api.PinInfoSerial) error {
-	pinfos, err := rpcapi.c.RecoverAllLocal()
+func (rpcapi *RPCAPI) RecoverAllLocal(in api.StatusFilter, out *[]api.PinInfoSerial) error {
+	pinfos, err := rpcapi.c.RecoverAllLocal(in)
 	*out = pinInfoSliceToSerial(pinfos)
 	return err
 }
@@ -195,23 +577,50 @@ func (rpcapi *RPCAPI) StateSync(in struct{}, out *[]api.PinInfoSerial) error {
    Tracker component methods
 */
 
-// Track runs PinTracker.Track().
+// Track runs PinTracker.Track(). Items pinned by API requests are
+// logged along with the request ID.
 func (rpcapi *RPCAPI) Track(in api.PinSerial, out *struct{}) error {
-	return rpcapi.c.tracker.Track(in.ToPin())
+	pin := in.ToPin()
+	if pin.RequestID != "" {
+		logger.Infof("tracking %s", pin.LogName())
+	}
+	rpcapi.c.statusCache.invalidate(pin.Cid)
+	return rpcapi.c.tracker.Track(rpcapi.c.trackedPin(pin))
 }
 
-// Untrack runs PinTracker.Untrack().
+// Untrack runs PinTracker.Untrack(). Items unpinned by API requests
+// are logged along with the request ID.
 func (rpcapi *RPCAPI) Untrack(in api.PinSerial, out *struct{}) error {
+	pin := in.ToPin()
+	if pin.RequestID != "" {
+		logger.Infof("untracking %s", pin.LogName())
+	}
+	rpcapi.c.statusCache.invalidate(pin.Cid)
+	return rpcapi.c.tracker.Untrack(pin.Cid)
+}
+
+// TrackerCancelPin runs PinTracker.CancelPin().
+func (rpcapi *RPCAPI) TrackerCancelPin(in api.PinSerial, out *struct{}) error {
 	c := in.ToPin().Cid
-	return rpcapi.c.tracker.Untrack(c)
+	rpcapi.c.statusCache.invalidate(c)
+	return rpcapi.c.tracker.CancelPin(c)
 }
 
-// TrackerStatusAll runs PinTracker.StatusAll().
-func (rpcapi *RPCAPI) TrackerStatusAll(in struct{}, out *[]api.PinInfoSerial) error {
-	*out = pinInfoSliceToSerial(rpcapi.c.tracker.StatusAll())
+// TrackerStatusAll runs PinTracker.StatusAll() and returns the items
+// matching the given filter.
+func (rpcapi *RPCAPI) TrackerStatusAll(in api.StatusFilter, out *[]api.PinInfoSerial) error {
+	*out = pinInfoSliceToSerial(filterPinInfos(rpcapi.c.tracker.StatusAll(), in))
 	return nil
 }
 
+// TrackerStatusAllChunk runs PinTracker.StatusAll() and returns the
+// requested chunk.
+func (rpcapi *RPCAPI) TrackerStatusAllChunk(in api.StatusChunk, out *[]api.PinInfoSerial) error {
+	pinfos, err := rpcapi.c.localStatusChunk(in)
+	*out = pinInfoSliceToSerial(pinfos)
+	return err
+}
+
 // TrackerStatus runs PinTracker.Status().
 func (rpcapi *RPCAPI) TrackerStatus(in api.PinSerial, out *api.PinInfoSerial) error {
 	c := in.ToPin().Cid
@@ -220,6 +629,12 @@ func (rpcapi *RPCAPI) TrackerStatus(in api.PinSerial, out *api.PinInfoSerial) er
 	return nil
 }
 
+// TrackerMetrics runs PinTracker.Metrics().
+func (rpcapi *RPCAPI) TrackerMetrics(in struct{}, out *api.TrackerMetricsSerial) error {
+	*out = rpcapi.c.tracker.Metrics().ToSerial()
+	return nil
+}
+
 // TrackerRecoverAll runs PinTracker.RecoverAll().
 func (rpcapi *RPCAPI) TrackerRecoverAll(in struct{}, out *[]api.PinInfoSerial) error {
 	pinfos, err := rpcapi.c.tracker.RecoverAll()
@@ -235,14 +650,85 @@ func (rpcapi *RPCAPI) TrackerRecover(in api.PinSerial, out *api.PinInfoSerial) e
 	return err
 }
 
+// TrackerKeepalive runs PinTracker.Keepalive().
+func (rpcapi *RPCAPI) TrackerKeepalive(in api.PinProgressSerial, out *struct{}) error {
+	rpcapi.c.tracker.Keepalive(in.ToPinProgress())
+	return nil
+}
+
+// TrackerPins returns the pins in the shared state as they are handed to
+// the tracker. It is used by trackers which do not store them.
+func (rpcapi *RPCAPI) TrackerPins(in struct{}, out *[]api.PinSerial) error {
+	pins := rpcapi.c.Pins()
+	pinsSerial := make([]api.PinSerial, 0, len(pins))
+	for _, p := range pins {
+		pinsSerial = append(pinsSerial, rpcapi.c.trackedPin(p).ToSerial())
+	}
+	*out = pinsSerial
+	return nil
+}
+
+// TrackerPinGet returns a pin in the shared state as it is handed to the
+// tracker. It is used by trackers which do not store them.
+func (rpcapi *RPCAPI) TrackerPinGet(in api.PinSerial, out *api.PinSerial) error {
+	pin, err := rpcapi.c.PinGet(in.ToPin().Cid)
+	if err == nil {
+		*out = rpcapi.c.trackedPin(pin).ToSerial()
+	}
+	return err
+}
+
 /*
    IPFS Connector component methods
 */
 
 // IPFSPin runs IPFSConnector.Pin().
 func (rpcapi *RPCAPI) IPFSPin(in api.PinSerial, out *struct{}) error {
+	pin := in.ToPin()
+	// Provide inline content to IPFS first, so it can be pinned
+	// even if no other IPFS daemon has it.
+	if len(pin.Inline) > 0 {
+		err := rpcapi.c.ipfs.BlockPut(pin.Cid, pin.Inline)
+		if err != nil {
+			logger.Warningf("error providing inline content for %s: %s", pin.Cid, err)
+		}
+	}
+	return rpcapi.c.ipfs.Pin(pin.Cid)
+}
+
+// IPFSCancel runs IPFSConnector.Cancel().
+func (rpcapi *RPCAPI) IPFSCancel(in api.PinSerial, out *struct{}) error {
 	c := in.ToPin().Cid
-	return rpcapi.c.ipfs.Pin(c)
+	return rpcapi.c.ipfs.Cancel(c)
+}
+
+// IPFSBlockGet runs IPFSConnector.BlockGet().
+func (rpcapi *RPCAPI) IPFSBlockGet(in api.PinSerial, out *[]byte) error {
+	c := in.ToPin().Cid
+	data, err := rpcapi.c.ipfs.BlockGet(c)
+	*out = data
+	return err
+}
+
+// IPFSResolve runs IPFSConnector.Resolve().
+func (rpcapi *RPCAPI) IPFSResolve(in string, out *string) error {
+	c, err := rpcapi.c.ipfs.Resolve(in)
+	if err != nil {
+		return err
+	}
+	*out = c.String()
+	return nil
+}
+
+// IPFSAdd runs IPFSConnector.Add().
+func (rpcapi *RPCAPI) IPFSAdd(in api.AddChunk, out *[]api.AddedOutputSerial) error {
+	added, err := rpcapi.c.ipfs.Add(in)
+	serials := make([]api.AddedOutputSerial, len(added), len(added))
+	for i, ao := range added {
+		serials[i] = ao.ToSerial()
+	}
+	*out = serials
+	return err
 }
 
 // IPFSUnpin runs IPFSConnector.Unpin().
@@ -259,6 +745,17 @@ func (rpcapi *RPCAPI) IPFSPinLsCid(in api.PinSerial, out *api.IPFSPinStatus) err
 	return err
 }
 
+// IPFSLocalPins runs Cluster.IPFSLocalPins().
+func (rpcapi *RPCAPI) IPFSLocalPins(in struct{}, out *[]api.LocalPinSerial) error {
+	localPins, err := rpcapi.c.IPFSLocalPins()
+	serials := make([]api.LocalPinSerial, len(localPins), len(localPins))
+	for i, lp := range localPins {
+		serials[i] = lp.ToSerial()
+	}
+	*out = serials
+	return err
+}
+
 // IPFSPinLs runs IPFSConnector.PinLs().
 func (rpcapi *RPCAPI) IPFSPinLs(in string, out *map[string]api.IPFSPinStatus) error {
 	m, err := rpcapi.c.ipfs.PinLs(in)
@@ -293,6 +790,20 @@ func (rpcapi *RPCAPI) IPFSRepoSize(in struct{}, out *uint64) error {
 	return err
 }
 
+// IPFSSwarmPeers runs IPFSConnector.SwarmPeers().
+func (rpcapi *RPCAPI) IPFSSwarmPeers(in struct{}, out *[]peer.ID) error {
+	res, err := rpcapi.c.ipfs.SwarmPeers()
+	*out = res
+	return err
+}
+
+// IPFSBandwidthRate runs IPFSConnector.BandwidthRate().
+func (rpcapi *RPCAPI) IPFSBandwidthRate(in struct{}, out *uint64) error {
+	res, err := rpcapi.c.ipfs.BandwidthRate()
+	*out = res
+	return err
+}
+
 /*
    Consensus component methods
 */
@@ -303,17 +814,42 @@ func (rpcapi *RPCAPI) ConsensusLogPin(in api.PinSerial, out *struct{}) error {
 	return rpcapi.c.consensus.LogPin(c)
 }
 
+// ConsensusLogPinBatch runs Consensus.LogPinBatch().
+func (rpcapi *RPCAPI) ConsensusLogPinBatch(in []api.PinSerial, out *struct{}) error {
+	pins := make([]api.Pin, 0, len(in))
+	for _, p := range in {
+		pins = append(pins, p.ToPin())
+	}
+	return rpcapi.c.consensus.LogPinBatch(pins)
+}
+
 // ConsensusLogUnpin runs Consensus.LogUnpin().
 func (rpcapi *RPCAPI) ConsensusLogUnpin(in api.PinSerial, out *struct{}) error {
 	c := in.ToPin()
 	return rpcapi.c.consensus.LogUnpin(c)
 }
 
+// ConsensusLogMaintenance runs Consensus.LogMaintenance().
+func (rpcapi *RPCAPI) ConsensusLogMaintenance(in api.PeerMaintenanceSerial, out *struct{}) error {
+	return rpcapi.c.consensus.LogMaintenance(in.ToPeerMaintenance())
+}
+
 // ConsensusAddPeer runs Consensus.AddPeer().
 func (rpcapi *RPCAPI) ConsensusAddPeer(in peer.ID, out *struct{}) error {
 	return rpcapi.c.consensus.AddPeer(in)
 }
 
+// ConsensusAddNonVoter runs Consensus.AddNonVoter().
+func (rpcapi *RPCAPI) ConsensusAddNonVoter(in peer.ID, out *struct{}) error {
+	return rpcapi.c.consensus.AddNonVoter(in)
+}
+
+// ConsensusVoter runs Consensus.Voter().
+func (rpcapi *RPCAPI) ConsensusVoter(in struct{}, out *bool) error {
+	*out = rpcapi.c.consensus.Voter()
+	return nil
+}
+
 // ConsensusRmPeer runs Consensus.RmPeer().
 func (rpcapi *RPCAPI) ConsensusRmPeer(in peer.ID, out *struct{}) error {
 	return rpcapi.c.consensus.RmPeer(in)
@@ -360,6 +896,12 @@ func (rpcapi *RPCAPI) PeerMonitorLastMetrics(in string, out *[]api.Metric) error
 	return nil
 }
 
+// PeerMonitorMetricHistory runs PeerMonitor.MetricHistory().
+func (rpcapi *RPCAPI) PeerMonitorMetricHistory(in string, out *[]api.Metric) error {
+	*out = rpcapi.c.monitor.MetricHistory(in)
+	return nil
+}
+
 /*
    Other
 */
@@ -0,0 +1,76 @@
+package ipfscluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var (
+	rpcAPIType = reflect.TypeOf(&RPCAPI{})
+	peerIDType = reflect.TypeOf(peer.ID(""))
+)
+
+// RPCCall performs a call to the given RPC method on the given peer. The
+// arguments are provided as JSON and decoded into the type expected by the
+// method. The response is returned JSON-encoded. Peer IDs, when they are
+// the argument, are expected as b58-encoded strings. An empty peer ID
+// means that the call is run on this peer.
+//
+// This is meant as a debugging tool and should not be used to build
+// any functionality.
+func (c *Cluster) RPCCall(p peer.ID, service, method string, args []byte) ([]byte, error) {
+	if service != "Cluster" {
+		return nil, fmt.Errorf("unknown RPC service: %s", service)
+	}
+
+	if method == "RPCCall" {
+		return nil, errors.New("RPCCall cannot be called with RPCCall")
+	}
+
+	m, ok := rpcAPIType.MethodByName(method)
+	if !ok {
+		return nil, fmt.Errorf("unknown RPC method: %s.%s", service, method)
+	}
+
+	// Methods have the form func(rpcapi *RPCAPI, in T1, out *T2) error
+	inType := m.Type.In(1)
+	outType := m.Type.In(2).Elem()
+
+	in := reflect.New(inType)
+	if len(args) > 0 && string(args) != "null" {
+		var err error
+		if inType == peerIDType {
+			err = decodePeerIDArg(args, in)
+		} else {
+			err = json.Unmarshal(args, in.Interface())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding arguments for %s.%s: %s", service, method, err)
+		}
+	}
+
+	out := reflect.New(outType)
+	err := c.rpcClient.Call(p, service, method, in.Elem().Interface(), out.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(out.Elem().Interface())
+}
+
+func decodePeerIDArg(args []byte, v reflect.Value) error {
+	var idStr string
+	err := json.Unmarshal(args, &idStr)
+	if err != nil {
+		return err
+	}
+	pid, err := peer.IDB58Decode(idStr)
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(reflect.ValueOf(pid))
+	return nil
+}
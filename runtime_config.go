@@ -0,0 +1,223 @@
+package ipfscluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// runtimeOption parses the JSON value of an option which can be changed
+// without restarting and returns a function which applies it.
+type runtimeOption func(c *Cluster, raw json.RawMessage) (func(), error)
+
+// runtimeOptions is the whitelist of options accepted by SetRuntimeConfig.
+var runtimeOptions = map[string]runtimeOption{
+	"cluster.pinning_enabled": func(c *Cluster, raw json.RawMessage) (func(), error) {
+		var v bool
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		return func() { c.setPinningEnabled(v) }, nil
+	},
+	"cluster.reallocation_threshold": func(c *Cluster, raw json.RawMessage) (func(), error) {
+		var v float64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("%g is negative", v)
+		}
+		return func() {
+			c.config.lock.Lock()
+			c.config.ReallocationThreshold = v
+			c.config.lock.Unlock()
+		}, nil
+	},
+	"cluster.allocation_filters.min_free_space": func(c *Cluster, raw json.RawMessage) (func(), error) {
+		var v uint64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		return func() {
+			c.config.lock.Lock()
+			c.config.AllocationFilters.MinFreeSpace = v
+			c.config.lock.Unlock()
+		}, nil
+	},
+	"cluster.disabled_informers": func(c *Cluster, raw json.RawMessage) (func(), error) {
+		var v []string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		for _, name := range v {
+			if name == "" {
+				return nil, errors.New("informer names cannot be empty")
+			}
+		}
+		return func() { c.setDisabledInformers(v) }, nil
+	},
+	"maptracker.concurrent_pins": concurrentPinsOption("maptracker"),
+	"stateless.concurrent_pins":  concurrentPinsOption("stateless"),
+}
+
+// concurrentPinsOption returns the runtime option setting the concurrent
+// pins of the tracker with the given configuration key. It is rejected
+// when this peer runs a different tracker.
+func concurrentPinsOption(trackerKey string) runtimeOption {
+	return func(c *Cluster, raw json.RawMessage) (func(), error) {
+		if k := c.tracker.ConfigKey(); k != trackerKey {
+			return nil, fmt.Errorf("this peer uses the %s tracker", k)
+		}
+		var v int
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		if v <= 0 {
+			return nil, fmt.Errorf("%d is too low", v)
+		}
+		return func() {
+			if err := c.tracker.SetConcurrentPins(v); err != nil {
+				logger.Error(err)
+			}
+		}, nil
+	}
+}
+
+// RuntimeOptions returns the keys of the configuration options which can
+// be changed with SetRuntimeConfig.
+func RuntimeOptions() []string {
+	keys := make([]string, 0, len(runtimeOptions))
+	for k := range runtimeOptions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetRuntimeConfig changes the given configuration options in this peer
+// without restarting it. Only the options listed by RuntimeOptions are
+// accepted. Nothing is changed unless all values are valid. Changes apply
+// immediately and are saved to the configuration.
+func (c *Cluster) SetRuntimeConfig(rc api.RuntimeConfig) error {
+	if len(rc) == 0 {
+		return errors.New("no configuration options given")
+	}
+
+	keys := make([]string, 0, len(rc))
+	for k := range rc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	appliers := make([]func(), 0, len(keys))
+	for _, k := range keys {
+		opt, ok := runtimeOptions[k]
+		if !ok {
+			return fmt.Errorf("%s cannot be changed at runtime", k)
+		}
+		apply, err := opt(c, rc[k])
+		if err != nil {
+			return fmt.Errorf("%s is invalid: %s", k, err)
+		}
+		appliers = append(appliers, apply)
+	}
+
+	for i, apply := range appliers {
+		apply()
+		logger.Infof("%s set to %s", keys[i], rc[keys[i]])
+	}
+	c.config.NotifySave()
+	return nil
+}
+
+// SetRuntimeConfigAllPeers runs SetRuntimeConfig in every cluster peer.
+// It returns an error listing the peers which failed to apply the
+// changes, if any.
+func (c *Cluster) SetRuntimeConfigAllPeers(rc api.RuntimeConfig) error {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	replies := make([]struct{}, len(members), len(members))
+	errs := c.broadcaster.Broadcast(members,
+		"Cluster",
+		"SetRuntimeConfig",
+		rc,
+		copyEmptyStructToIfaces(replies))
+
+	for i, e := range errs {
+		if e != nil {
+			logger.Errorf("%s: error setting runtime configuration in %s: %s", c.id, members[i], e)
+		}
+	}
+	if err := NewBroadcastError(members, errs); err != nil {
+		return fmt.Errorf("could not set the runtime configuration in some peers: %s", err)
+	}
+	return nil
+}
+
+// setPinningEnabled enables or disables this peer as an allocation
+// target. Informer metrics are sent right away when it is enabled, and
+// stop being sent when it is disabled.
+func (c *Cluster) setPinningEnabled(enabled bool) {
+	c.config.lock.Lock()
+	c.config.PinningEnabled = enabled
+	c.config.lock.Unlock()
+
+	if enabled {
+		select {
+		case c.informerSwapped <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// setDisabledInformers sets the names of the informers whose metrics
+// this peer stops sending. The main informer, when enabled again, sends
+// its metric right away.
+func (c *Cluster) setDisabledInformers(names []string) {
+	c.config.lock.Lock()
+	c.config.DisabledInformers = names
+	c.config.lock.Unlock()
+
+	select {
+	case c.informerSwapped <- struct{}{}:
+	default:
+	}
+}
+
+// informerEnabled returns false when the metrics of the informer with
+// the given name should not be sent.
+func (c *Cluster) informerEnabled(name string) bool {
+	c.config.lock.Lock()
+	defer c.config.lock.Unlock()
+	for _, n := range c.config.DisabledInformers {
+		if n == name {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cluster) pinningEnabled() bool {
+	c.config.lock.Lock()
+	defer c.config.lock.Unlock()
+	return c.config.PinningEnabled
+}
+
+func (c *Cluster) reallocationThreshold() float64 {
+	c.config.lock.Lock()
+	defer c.config.lock.Unlock()
+	return c.config.ReallocationThreshold
+}
+
+func (c *Cluster) allocationFiltersConfig() AllocationFiltersConfig {
+	c.config.lock.Lock()
+	defer c.config.lock.Unlock()
+	return c.config.AllocationFilters
+}
@@ -0,0 +1,167 @@
+package ipfscluster
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// ScalingHorizon is how far ahead ScalingAdvice extrapolates the free space
+// trend of a peer. Peers which would run out of space within this time are
+// under pressure.
+var ScalingHorizon = 24 * time.Hour
+
+// ScalingBacklogThreshold is the number of queued pins above which a peer
+// is under pressure.
+var ScalingBacklogThreshold = 100
+
+// scalingMetric is the informer metric used to follow the free space
+// trend of the peers. It is only available when peers use the disk
+// informer with the freespace metric.
+const scalingMetric = "freespace"
+
+// ScalingAdvice analyzes the capacity pressure on the cluster peers (the
+// trend of their free space and the number of pins queued in them) and
+// recommends adding peers when some are under pressure, or removing peers
+// when all are idle and there are more than needed for the replication
+// factor.
+func (c *Cluster) ScalingAdvice() (api.ScalingAdvice, error) {
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		return api.ScalingAdvice{}, err
+	}
+
+	l, err := c.consensus.Leader()
+	if err != nil {
+		return api.ScalingAdvice{}, errors.New("cannot determine leading Monitor")
+	}
+
+	var history []api.Metric
+	err = c.rpcClient.Call(l,
+		"Cluster", "PeerMonitorMetricHistory",
+		scalingMetric,
+		&history)
+	if err != nil {
+		return api.ScalingAdvice{}, err
+	}
+
+	gpis, err := c.StatusAll(api.StatusFilter{api.TrackerStatusPinning})
+	if err != nil {
+		return api.ScalingAdvice{}, err
+	}
+	queued := make(map[peer.ID]int)
+	for _, gpi := range gpis {
+		for p, pinfo := range gpi.PeerMap {
+			if pinfo.Status == api.TrackerStatusPinning {
+				queued[p]++
+			}
+		}
+	}
+
+	return scalingAdvice(peers, history, queued, c.config.ReplicationFactor), nil
+}
+
+// scalingAdvice produces a ScalingAdvice from the freespace metric history
+// (newest first for each peer) and the number of queued pins in each peer.
+func scalingAdvice(peers []peer.ID, history []api.Metric, queued map[peer.ID]int, rpl int) api.ScalingAdvice {
+	adv := api.ScalingAdvice{
+		Action:  api.ScalingNone,
+		Reasons: []string{},
+		TS:      time.Now(),
+	}
+
+	metricsByPeer := make(map[peer.ID][]api.Metric)
+	for _, m := range history {
+		metricsByPeer[m.Peer] = append(metricsByPeer[m.Peer], m)
+	}
+	if len(history) == 0 {
+		adv.Reasons = append(adv.Reasons,
+			"no freespace metrics available: only the pin queues were considered")
+	}
+
+	pressured := 0
+	idle := 0
+	for _, p := range peers {
+		pp := api.PeerPressure{
+			Peer:   p,
+			Queued: queued[p],
+		}
+
+		if pp.Queued > ScalingBacklogThreshold {
+			pp.UnderPressure = true
+			adv.Reasons = append(adv.Reasons,
+				fmt.Sprintf("%s has %d queued pins", p.Pretty(), pp.Queued))
+		}
+
+		if metrics := metricsByPeer[p]; len(metrics) > 0 {
+			pp.FreeSpace, _ = strconv.ParseUint(metrics[0].Value, 10, 64)
+			pp.FreeSpaceRate = freeSpaceRate(metrics)
+			if pp.FreeSpaceRate < 0 {
+				secs := float64(pp.FreeSpace) / -pp.FreeSpaceRate
+				pp.TimeToFull = time.Duration(secs * float64(time.Second))
+				if pp.TimeToFull < ScalingHorizon {
+					pp.UnderPressure = true
+					adv.Reasons = append(adv.Reasons,
+						fmt.Sprintf("%s will run out of space in %s", p.Pretty(), pp.TimeToFull))
+				}
+			}
+		}
+
+		if pp.UnderPressure {
+			pressured++
+		} else if pp.Queued == 0 && pp.FreeSpaceRate >= 0 {
+			idle++
+		}
+		adv.Pressure = append(adv.Pressure, pp)
+	}
+
+	// with a replication factor of -1 everything is pinned
+	// everywhere and a single peer is enough.
+	needed := rpl
+	if needed <= 0 {
+		needed = 1
+	}
+
+	switch {
+	case pressured > 0:
+		adv.Action = api.ScalingAddPeers
+		adv.Peers = pressured
+	case idle == len(peers) && len(peers) > needed:
+		adv.Action = api.ScalingRemovePeers
+		adv.Peers = len(peers) - needed
+		adv.Reasons = append(adv.Reasons,
+			fmt.Sprintf("all peers are idle and %d are enough for a replication factor of %d", needed, rpl))
+	}
+	return adv
+}
+
+// freeSpaceRate returns how fast the free space changes, in bytes per
+// second, using the newest and the oldest of the given metrics. Metrics
+// have the same TTL, so the time between them is the time between their
+// expiration dates.
+func freeSpaceRate(metrics []api.Metric) float64 {
+	if len(metrics) < 2 {
+		return 0
+	}
+	newest := metrics[0]
+	oldest := metrics[len(metrics)-1]
+
+	newestExp, err1 := time.Parse(time.RFC3339Nano, newest.Expire)
+	oldestExp, err2 := time.Parse(time.RFC3339Nano, oldest.Expire)
+	newestVal, err3 := strconv.ParseUint(newest.Value, 10, 64)
+	oldestVal, err4 := strconv.ParseUint(oldest.Value, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return 0
+	}
+
+	elapsed := newestExp.Sub(oldestExp).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return (float64(newestVal) - float64(oldestVal)) / elapsed
+}
@@ -0,0 +1,80 @@
+package ipfscluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// freeSpaceMetrics returns a freespace metric history (newest first) for
+// a peer whose free space changes by delta bytes every second.
+func freeSpaceMetrics(p peer.ID, newest uint64, delta int64, n int) []api.Metric {
+	var metrics []api.Metric
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		m := api.Metric{
+			Name:   scalingMetric,
+			Peer:   p,
+			Value:  fmt.Sprintf("%d", int64(newest)-delta*int64(i)),
+			Expire: now.Add(-time.Duration(i) * time.Second).UTC().Format(time.RFC3339Nano),
+			Valid:  true,
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+var scalingTestPeers = []peer.ID{test.TestPeerID1, test.TestPeerID2, test.TestPeerID3}
+
+func TestScalingAdviceIdle(t *testing.T) {
+	var history []api.Metric
+	for _, p := range scalingTestPeers {
+		history = append(history, freeSpaceMetrics(p, 1000, 0, 5)...)
+	}
+	adv := scalingAdvice(scalingTestPeers, history, map[peer.ID]int{}, 2)
+	if adv.Action != api.ScalingRemovePeers || adv.Peers != 1 {
+		t.Errorf("expected to remove 1 peer: %+v", adv)
+	}
+
+	adv = scalingAdvice(scalingTestPeers, history, map[peer.ID]int{}, 3)
+	if adv.Action != api.ScalingNone {
+		t.Errorf("all peers are needed: %+v", adv)
+	}
+
+	queued := map[peer.ID]int{
+		test.TestPeerID1: 1,
+	}
+	adv = scalingAdvice(scalingTestPeers, history, queued, 1)
+	if adv.Action != api.ScalingNone {
+		t.Errorf("peers are not idle: %+v", adv)
+	}
+}
+
+func TestScalingAdviceFreeSpace(t *testing.T) {
+	history := freeSpaceMetrics(test.TestPeerID1, 1000, -10, 5)
+	history = append(history, freeSpaceMetrics(test.TestPeerID2, 1000, 0, 5)...)
+	adv := scalingAdvice(scalingTestPeers, history, map[peer.ID]int{}, 2)
+	if adv.Action != api.ScalingAddPeers || adv.Peers != 1 {
+		t.Fatalf("expected to add 1 peer: %+v", adv)
+	}
+	pp := adv.Pressure[0]
+	if !pp.UnderPressure || pp.FreeSpace != 1000 || pp.TimeToFull != 100*time.Second {
+		t.Errorf("unexpected pressure: %+v", pp)
+	}
+}
+
+func TestScalingAdviceBacklog(t *testing.T) {
+	queued := map[peer.ID]int{
+		test.TestPeerID2: ScalingBacklogThreshold + 1,
+		test.TestPeerID3: ScalingBacklogThreshold + 1,
+	}
+	adv := scalingAdvice(scalingTestPeers, nil, queued, 2)
+	if adv.Action != api.ScalingAddPeers || adv.Peers != 2 {
+		t.Errorf("expected to add 2 peers: %+v", adv)
+	}
+}
@@ -26,6 +26,10 @@ test_expect_success IPFS,CLUSTER,JQ "state export saves the correct state to exp
     jq ".[].cid" export.json | grep -q "$cid"
 '
 
+test_expect_success IPFS,CLUSTER "incremental state export fails with an unknown base" '
+    test_expect_code 1 ipfs-cluster-service --debug --config "test-config" state export --since-index 999999
+'
+
 test_clean_ipfs
 test_clean_cluster
 
@@ -0,0 +1,59 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// ChecksumBuckets is the number of buckets in which pins are split to
+// compute the checksum of a State.
+const ChecksumBuckets = 256
+
+// Bucket returns the checksum bucket of a Cid.
+func Bucket(c *cid.Cid) int {
+	h := sha256.Sum256(c.Bytes())
+	return int(h[0])
+}
+
+// Checksum returns the hex-encoded checksum of every bucket of the State
+// and the root checksum, which is the sha256 sum of all of them. The
+// checksum of a bucket is the xor of the sha256 sums of its pins, so it
+// does not depend on the order in which they are listed.
+func Checksum(st State) (string, []string, error) {
+	sums := make([][sha256.Size]byte, ChecksumBuckets)
+	for _, pin := range st.List() {
+		v, err := json.Marshal(pin.ToSerial())
+		if err != nil {
+			return "", nil, err
+		}
+		pinSum := sha256.Sum256(v)
+		b := Bucket(pin.Cid)
+		for i := range pinSum {
+			sums[b][i] ^= pinSum[i]
+		}
+	}
+
+	root := sha256.New()
+	buckets := make([]string, ChecksumBuckets)
+	for i, sum := range sums {
+		root.Write(sum[:])
+		buckets[i] = hex.EncodeToString(sum[:])
+	}
+	return hex.EncodeToString(root.Sum(nil)), buckets, nil
+}
+
+// BucketPins returns the pins of the State in the given bucket.
+func BucketPins(st State, bucket int) []api.Pin {
+	pins := []api.Pin{}
+	for _, pin := range st.List() {
+		if Bucket(pin.Cid) == bucket {
+			pins = append(pins, pin)
+		}
+	}
+	return pins
+}
@@ -0,0 +1,14 @@
+package state
+
+import (
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// ContentKey identifies the content a Cid points to regardless of the
+// Cid version, so the CIDv0 and the CIDv1 of an item share the same key.
+// States index their pins by it (see State.ByContent).
+func ContentKey(c *cid.Cid) string {
+	return fmt.Sprintf("%d/%s", c.Type(), c.Hash().B58String())
+}
@@ -0,0 +1,106 @@
+package dsstate
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "datastore"
+
+// Supported backends
+const (
+	BackendMemory  = "memory"
+	BackendBadger  = "badger"
+	BackendLevelDB = "leveldb"
+)
+
+// Configuration defaults
+var (
+	DefaultBackend   = BackendMemory
+	DefaultSubFolder = "ipfs-cluster-state"
+)
+
+// Config allows to select and configure the datastore holding
+// the shared state. It implements the ComponentConfig interface.
+type Config struct {
+	config.Saver
+
+	// Backend is one of "memory" (the state is kept in a Go map),
+	// "badger" or "leveldb".
+	Backend string
+
+	// Folder is where badger and leveldb store their data. Relative
+	// paths are relative to the configuration folder.
+	Folder string
+}
+
+type jsonConfig struct {
+	Backend string `json:"backend"`
+	Folder  string `json:"folder,omitempty"`
+}
+
+// ConfigKey returns a human-friendly indentifier for this Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this configuration with working defaults.
+func (cfg *Config) Default() error {
+	cfg.Backend = DefaultBackend
+	cfg.Folder = "" // empty so it gets omitted
+	return nil
+}
+
+// Validate checks that this configuration has working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	switch cfg.Backend {
+	case BackendMemory, BackendBadger, BackendLevelDB:
+		return nil
+	default:
+		return errors.New("datastore.backend must be memory, badger or leveldb")
+	}
+}
+
+// LoadJSON parses a json-encoded configuration (see jsonConfig).
+// The Config will have default values for all fields not explicited
+// in the given json object.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling datastore config")
+		return err
+	}
+
+	cfg.Default()
+
+	config.SetIfNotDefault(jcfg.Backend, &cfg.Backend)
+	config.SetIfNotDefault(jcfg.Folder, &cfg.Folder)
+
+	return cfg.Validate()
+}
+
+// ToJSON returns the pretty JSON representation of a Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+	jcfg.Backend = cfg.Backend
+	jcfg.Folder = cfg.Folder
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+// GetFolder returns the folder where the datastore is kept. When Folder
+// is not set, it is DefaultSubFolder in the configuration folder.
+func (cfg *Config) GetFolder() string {
+	if cfg.Folder == "" {
+		return filepath.Join(cfg.BaseDir, DefaultSubFolder)
+	}
+	if filepath.IsAbs(cfg.Folder) {
+		return cfg.Folder
+	}
+	return filepath.Join(cfg.BaseDir, cfg.Folder)
+}
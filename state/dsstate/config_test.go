@@ -0,0 +1,76 @@
+package dsstate
+
+import (
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+    "backend": "badger",
+    "folder": "state"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Backend != BackendBadger || cfg.Folder != "state" {
+		t.Error("config values not loaded")
+	}
+
+	err = cfg.LoadJSON([]byte(`{"backend": "bolt"}`))
+	if err == nil {
+		t.Error("expected error with unknown backend")
+	}
+
+	err = cfg.LoadJSON([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Backend != DefaultBackend {
+		t.Error("expected default backend")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Backend = ""
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestGetFolder(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.SetBaseDir("/base")
+	if cfg.GetFolder() != "/base/"+DefaultSubFolder {
+		t.Error("expected default folder in base dir")
+	}
+	cfg.Folder = "/abs"
+	if cfg.GetFolder() != "/abs" {
+		t.Error("expected absolute folder")
+	}
+}
@@ -0,0 +1,651 @@
+// Package dsstate implements the State interface for IPFS Cluster on top
+// of a go-datastore, so that the shared state is kept on disk (Badger or
+// LevelDB) rather than in memory.
+package dsstate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+	"github.com/ipfs/ipfs-cluster/state/encryption"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	badgerds "github.com/ipfs/go-ds-badger"
+	leveldbds "github.com/ipfs/go-ds-leveldb"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("dsstate")
+
+var (
+	pinsPrefix        = ds.NewKey("/pins")
+	maintenancePrefix = ds.NewKey("/maintenance")
+	// contentPrefix holds an entry per pin under its content key (see
+	// state.ContentKey), so that ByContent does not list every pin.
+	contentPrefix = ds.NewKey("/content")
+	// indexedKey is set once the pins stored by versions which did not
+	// keep the content index have been indexed.
+	indexedKey = ds.NewKey("/indexed")
+	// encryptionKey holds a known value encrypted with the key of an
+	// encrypted datastore, so that the key can be checked on start.
+	encryptionKey   = ds.NewKey("/encryption")
+	encryptionCheck = []byte("ipfs-cluster state")
+)
+
+// DatastoreState stores the state of the system in a go-datastore. It is
+// thread safe and implements the State interface. Its serialized form is
+// the same as the one of the MapState, so snapshots can be used with
+// either.
+//
+// When it is encrypted, the pins are encrypted before they are stored,
+// and the datastore keys holding them are keyed hashes of their Cids,
+// so that the pinset cannot be read without the encryption key. Only
+// the peers in maintenance are kept in the clear.
+type DatastoreState struct {
+	mux     sync.RWMutex
+	ds      ds.Datastore
+	cipher  *encryption.Cipher
+	version int
+
+	indexMux sync.Mutex
+	indexed  bool
+
+	// usage counts the pins in every namespace. It is kept in memory,
+	// counted on first use, and it is reset when the datastore is
+	// cleared.
+	usageMux sync.Mutex
+	usage    state.Usage
+}
+
+// NewDatastoreState returns a new DatastoreState using the given datastore.
+func NewDatastoreState(d ds.Datastore) *DatastoreState {
+	return &DatastoreState{
+		ds:      d,
+		version: mapstate.Version,
+	}
+}
+
+// NewEncryptedDatastoreState returns a new DatastoreState which encrypts
+// the pins in the given datastore with the given key (see
+// encryption.New). It fails when the datastore holds pins which were
+// stored without encryption or with a different key.
+func NewEncryptedDatastoreState(d ds.Datastore, key []byte) (*DatastoreState, error) {
+	c, err := encryption.New(key)
+	if err != nil {
+		return nil, err
+	}
+	st := NewDatastoreState(d)
+	st.cipher = c
+	err = st.checkEncryption()
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// checkEncryption verifies that the datastore was written with the
+// encryption key of the state, or without encryption when it has none.
+// New encrypted datastores are marked with the key.
+func (st *DatastoreState) checkEncryption() error {
+	v, err := st.ds.Get(encryptionKey)
+	switch {
+	case err == ds.ErrNotFound && st.cipher == nil:
+		return nil
+	case err == ds.ErrNotFound:
+		n, err := st.count(pinsPrefix)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return errors.New("the state datastore holds unencrypted pins. Export the state, clean it up and import it again to encrypt it")
+		}
+		v, err = st.cipher.Encrypt(encryptionCheck)
+		if err != nil {
+			return err
+		}
+		return st.ds.Put(encryptionKey, v)
+	case err != nil:
+		return err
+	case st.cipher == nil:
+		return errors.New("the state datastore is encrypted and no encryption key was given")
+	}
+	plain, err := st.cipher.Decrypt(v)
+	if err != nil || !bytes.Equal(plain, encryptionCheck) {
+		return errors.New("the state datastore was encrypted with a different key")
+	}
+	return nil
+}
+
+// Open returns the State selected by the given configuration: a MapState
+// for the memory backend, or a DatastoreState for the rest. When an
+// encryption key is given (raft.encryption_key), the pins are encrypted
+// in the datastore. The memory backend keeps nothing on disk. Use Close
+// on DatastoreStates when done.
+func Open(cfg *Config, key []byte) (state.State, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Backend == BackendMemory {
+		return mapstate.NewMapState(), nil
+	}
+
+	folder := cfg.GetFolder()
+	err = os.MkdirAll(folder, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	var d ds.Datastore
+	switch cfg.Backend {
+	case BackendBadger:
+		d, err = badgerds.NewDatastore(folder, nil)
+	case BackendLevelDB:
+		d, err = leveldbds.NewDatastore(folder, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) > 0 {
+		st, err := NewEncryptedDatastoreState(d, key)
+		if err != nil {
+			d.(io.Closer).Close()
+			return nil, err
+		}
+		return st, nil
+	}
+	st := NewDatastoreState(d)
+	err = st.checkEncryption()
+	if err != nil {
+		d.(io.Closer).Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// Close closes the underlying datastore, if it can be closed.
+func (st *DatastoreState) Close() error {
+	if c, ok := st.ds.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// name returns the name under which s is stored in the datastore: s
+// itself, or its keyed hash when the state is encrypted.
+func (st *DatastoreState) name(s string) string {
+	if st.cipher == nil {
+		return s
+	}
+	return st.cipher.Name(s)
+}
+
+func (st *DatastoreState) pinKey(c *cid.Cid) ds.Key {
+	return pinsPrefix.ChildString(st.name(c.String()))
+}
+
+func (st *DatastoreState) contentKey(c *cid.Cid) ds.Key {
+	if st.cipher == nil {
+		return contentPrefix.Child(ds.NewKey(state.ContentKey(c))).ChildString(c.String())
+	}
+	return contentPrefix.ChildString(st.name(state.ContentKey(c))).ChildString(st.name(c.String()))
+}
+
+// encode serializes a pin to be stored in the datastore, encrypting it
+// when the state is encrypted.
+func (st *DatastoreState) encode(pin api.PinSerial) ([]byte, error) {
+	v, err := json.Marshal(pin)
+	if err != nil || st.cipher == nil {
+		return v, err
+	}
+	return st.cipher.Encrypt(v)
+}
+
+// decode reads a pin stored in the datastore with encode.
+func (st *DatastoreState) decode(v []byte) (api.PinSerial, error) {
+	var pin api.PinSerial
+	if st.cipher != nil {
+		plain, err := st.cipher.Decrypt(v)
+		if err != nil {
+			return pin, err
+		}
+		v = plain
+	}
+	err := json.Unmarshal(v, &pin)
+	return pin, err
+}
+
+func maintenanceKey(p peer.ID) ds.Key {
+	return maintenancePrefix.ChildString(peer.IDB58Encode(p))
+}
+
+// Add stores a Pin in the datastore. Its RequestID is not stored.
+func (st *DatastoreState) Add(c api.Pin) error {
+	c.RequestID = ""
+	v, err := st.encode(c.ToSerial())
+	if err != nil {
+		return err
+	}
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	st.usageMux.Lock()
+	defer st.usageMux.Unlock()
+	if st.usage == nil {
+		return st.put(c.Cid, v)
+	}
+
+	old, oldErr := st.get(c.Cid)
+	err = st.put(c.Cid, v)
+	if err != nil {
+		return err
+	}
+	if oldErr == nil {
+		st.usage.Remove(old.Namespace, old.Size)
+	}
+	st.usage.Add(c.Namespace, c.Size)
+	return nil
+}
+
+// put stores an encoded pin and its content index entry.
+func (st *DatastoreState) put(c *cid.Cid, v []byte) error {
+	err := st.ds.Put(st.pinKey(c), v)
+	if err != nil {
+		return err
+	}
+	return st.ds.Put(st.contentKey(c), []byte{})
+}
+
+// Rm removes a Cid from the datastore.
+func (st *DatastoreState) Rm(c *cid.Cid) error {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	st.usageMux.Lock()
+	defer st.usageMux.Unlock()
+	var old api.PinSerial
+	oldErr := ds.ErrNotFound
+	if st.usage != nil {
+		old, oldErr = st.get(c)
+	}
+	err := st.ds.Delete(st.pinKey(c))
+	if err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	if oldErr == nil {
+		st.usage.Remove(old.Namespace, old.Size)
+	}
+	err = st.ds.Delete(st.contentKey(c))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Get returns Pin information for a CID.
+func (st *DatastoreState) Get(c *cid.Cid) api.Pin {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	pin, err := st.get(c)
+	if err == ds.ErrNotFound { // make sure no panics
+		return api.Pin{}
+	}
+	if err != nil {
+		logger.Error(err)
+		return api.Pin{}
+	}
+	return pin.ToPin()
+}
+
+// get reads and decodes the pin for a Cid.
+func (st *DatastoreState) get(c *cid.Cid) (api.PinSerial, error) {
+	v, err := st.ds.Get(st.pinKey(c))
+	if err != nil {
+		return api.PinSerial{}, err
+	}
+	return st.decode(v)
+}
+
+// NamespaceUsage returns the number of pins and their cumulative size in
+// every namespace which has pins. They are counted on first use.
+func (st *DatastoreState) NamespaceUsage() map[string]api.Namespace {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	st.usageMux.Lock()
+	defer st.usageMux.Unlock()
+	if st.usage == nil {
+		usage := make(state.Usage)
+		err := st.iterate(pinsPrefix, false, func(e query.Entry) error {
+			pin, err := st.decode(e.Value)
+			if err != nil || pin.Cid == "" {
+				logger.Warningf("ignoring bad entry %s", e.Key)
+				return nil
+			}
+			usage.Add(pin.Namespace, pin.Size)
+			return nil
+		})
+		if err != nil {
+			logger.Error(err)
+			return usage.Copy()
+		}
+		st.usage = usage
+	}
+	return st.usage.Copy()
+}
+
+// Has returns true if the Cid belongs to the State.
+func (st *DatastoreState) Has(c *cid.Cid) bool {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	ok, err := st.ds.Has(st.pinKey(c))
+	if err != nil {
+		logger.Error(err)
+	}
+	return ok
+}
+
+// ByContent returns the pins whose Cid references the same content as
+// the given one, including its own pin. They are found in the content
+// index, which is built on first use for datastores written by versions
+// which did not keep it.
+func (st *DatastoreState) ByContent(c *cid.Cid) []api.Pin {
+	err := st.ensureIndex()
+	if err != nil {
+		logger.Error(err)
+	}
+
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	// entries are named like the pins they index
+	var names []string
+	prefix := st.contentKey(c).Parent()
+	err = st.iterate(prefix, true, func(e query.Entry) error {
+		names = append(names, ds.RawKey(e.Key).BaseNamespace())
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+	}
+
+	pins := make([]api.Pin, 0, len(names))
+	for _, name := range names {
+		v, err := st.ds.Get(pinsPrefix.ChildString(name))
+		if err != nil { // entries of removed pins are ignored
+			continue
+		}
+		pin, err := st.decode(v)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		pins = append(pins, pin.ToPin())
+	}
+	return pins
+}
+
+// ensureIndex adds the content index entries of every pin, unless the
+// datastore has been indexed already.
+func (st *DatastoreState) ensureIndex() error {
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+	if st.indexed {
+		return nil
+	}
+
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	ok, err := st.ds.Has(indexedKey)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		logger.Info("indexing the pins in the state by content")
+		var cids []*cid.Cid
+		err = st.iterate(pinsPrefix, false, func(e query.Entry) error {
+			pin, err := st.decode(e.Value)
+			if err != nil {
+				logger.Warningf("ignoring bad entry %s", e.Key)
+				return nil
+			}
+			c, err := cid.Decode(pin.Cid)
+			if err != nil {
+				logger.Warningf("ignoring bad entry %s", e.Key)
+				return nil
+			}
+			cids = append(cids, c)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range cids {
+			err = st.ds.Put(st.contentKey(c), []byte{})
+			if err != nil {
+				return err
+			}
+		}
+		err = st.ds.Put(indexedKey, []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	st.indexed = true
+	return nil
+}
+
+// List provides the list of tracked Pins.
+func (st *DatastoreState) List() []api.Pin {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	pins := []api.Pin{}
+	err := st.iterate(pinsPrefix, false, func(e query.Entry) error {
+		pin, err := st.decode(e.Value)
+		if err != nil || pin.Cid == "" {
+			logger.Warningf("ignoring bad entry %s", e.Key)
+			return nil
+		}
+		pins = append(pins, pin.ToPin())
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+	}
+	return pins
+}
+
+// SetMaintenance flags or unflags a peer as being in maintenance mode.
+func (st *DatastoreState) SetMaintenance(p peer.ID, enabled bool) error {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	if enabled {
+		return st.ds.Put(maintenanceKey(p), []byte{})
+	}
+	err := st.ds.Delete(maintenanceKey(p))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// MaintenancePeers returns the list of peers in maintenance mode.
+func (st *DatastoreState) MaintenancePeers() []peer.ID {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	peers := []peer.ID{}
+	err := st.iterate(maintenancePrefix, true, func(e query.Entry) error {
+		k := ds.RawKey(e.Key).BaseNamespace()
+		p, err := peer.IDB58Decode(k)
+		if err != nil {
+			logger.Error(k, err)
+			return nil
+		}
+		peers = append(peers, p)
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+	}
+	return peers
+}
+
+// iterate calls f for every entry under the given prefix, until it
+// returns an error.
+func (st *DatastoreState) iterate(prefix ds.Key, keysOnly bool, f func(query.Entry) error) error {
+	results, err := st.ds.Query(query.Query{
+		Prefix:   prefix.String(),
+		KeysOnly: keysOnly,
+	})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for r := range results.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		// Some datastores match prefixes which are not namespaces.
+		if !strings.HasPrefix(r.Key, prefix.String()+"/") {
+			continue
+		}
+		err := f(r.Entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count returns the number of entries under the given prefix.
+func (st *DatastoreState) count(prefix ds.Key) (int, error) {
+	n := 0
+	err := st.iterate(prefix, true, func(query.Entry) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// clear removes all the pins and maintenance flags from the datastore.
+func (st *DatastoreState) clear() error {
+	st.usageMux.Lock()
+	st.usage = nil
+	st.usageMux.Unlock()
+
+	var keys []ds.Key
+	collect := func(e query.Entry) error {
+		keys = append(keys, ds.RawKey(e.Key))
+		return nil
+	}
+	err := st.iterate(pinsPrefix, true, collect)
+	if err != nil {
+		return err
+	}
+	err = st.iterate(maintenancePrefix, true, collect)
+	if err != nil {
+		return err
+	}
+	err = st.iterate(contentPrefix, true, collect)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		err = st.ds.Delete(k)
+		if err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrate restores a snapshot from the state's internal bytes and if
+// necessary migrates the format to the current version. Snapshots in the
+// current format are read into the datastore as they are decoded. Older
+// formats are migrated by a MapState first.
+func (st *DatastoreState) Migrate(r io.Reader) error {
+	br := bufio.NewReader(r)
+	v, err := br.Peek(1)
+	if err != nil {
+		return err
+	}
+	if int(v[0]) == mapstate.Version {
+		return st.UnmarshalFrom(br)
+	}
+
+	ms := mapstate.NewMapState()
+	err = ms.Migrate(br)
+	if err != nil {
+		return err
+	}
+	return st.replace(ms)
+}
+
+// GetVersion returns the current version of this state object.
+// It is not necessarily up to date
+func (st *DatastoreState) GetVersion() int {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	return st.version
+}
+
+// Marshal encodes the state in the same format as a MapState. Raft
+// takes snapshots as a byte slice, so the encoded state is held in
+// memory, but the pins are read one by one (see MarshalTo).
+func (st *DatastoreState) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	err := st.MarshalTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a MapState-encoded state and replaces the contents
+// of the datastore with it. As with the MapState, an out of date
+// version is not an error: it is recorded and the contents are left
+// untouched until Migrate is called.
+func (st *DatastoreState) Unmarshal(bs []byte) error {
+	return st.UnmarshalFrom(bytes.NewReader(bs))
+}
+
+// replace removes all the contents of the datastore and stores those
+// of the given MapState instead.
+func (st *DatastoreState) replace(ms *mapstate.MapState) error {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	err := st.clear()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range ms.List() {
+		v, err := st.encode(p.ToSerial())
+		if err != nil {
+			return err
+		}
+		err = st.put(p.Cid, v)
+		if err != nil {
+			return err
+		}
+	}
+	for _, p := range ms.MaintenancePeers() {
+		err = st.ds.Put(maintenanceKey(p), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	st.version = mapstate.Version
+	return nil
+}
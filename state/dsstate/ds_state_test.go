@@ -0,0 +1,338 @@
+package dsstate
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p-peer"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+var testCid1, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+var testPeerID1, _ = peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+
+var c = api.Pin{
+	Cid:               testCid1,
+	Allocations:       []peer.ID{testPeerID1},
+	ReplicationFactor: -1,
+}
+
+func newState() *DatastoreState {
+	return NewDatastoreState(dssync.MutexWrap(ds.NewMapDatastore()))
+}
+
+func TestAdd(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	if !st.Has(c.Cid) {
+		t.Error("should have added it")
+	}
+}
+
+func TestRm(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	st.Rm(c.Cid)
+	if st.Has(c.Cid) {
+		t.Error("should have removed it")
+	}
+	err := st.Rm(c.Cid)
+	if err != nil {
+		t.Error("removing a missing item should not fail")
+	}
+}
+
+func TestGet(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	get := st.Get(c.Cid)
+	if get.Cid.String() != c.Cid.String() ||
+		get.Allocations[0] != c.Allocations[0] ||
+		get.ReplicationFactor != c.ReplicationFactor {
+		t.Error("returned something different")
+	}
+}
+
+func TestList(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	st.SetMaintenance(testPeerID1, true)
+	list := st.List()
+	if len(list) != 1 ||
+		list[0].Cid.String() != c.Cid.String() ||
+		list[0].Allocations[0] != c.Allocations[0] {
+		t.Error("returned something different")
+	}
+}
+
+func TestByContent(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	v1 := cid.NewCidV1(cid.DagProtobuf, testCid1.Hash())
+	pins := st.ByContent(v1)
+	if len(pins) != 1 || !pins[0].Cid.Equals(testCid1) {
+		t.Fatal("expected the CIDv0 pin for the CIDv1:", pins)
+	}
+
+	st.Add(api.PinCid(v1))
+	if len(st.ByContent(testCid1)) != 2 {
+		t.Error("expected the pins for both Cids")
+	}
+	st.Rm(testCid1)
+	pins = st.ByContent(testCid1)
+	if len(pins) != 1 || !pins[0].Cid.Equals(v1) {
+		t.Error("expected only the CIDv1 pin:", pins)
+	}
+}
+
+func TestNamespaceUsage(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	p := api.PinCid(cid.NewCidV1(cid.DagProtobuf, testCid1.Hash()))
+	p.Namespace = "team-a"
+	p.Size = 10
+	st.Add(p)
+
+	usage := st.NamespaceUsage()
+	if usage[""].Pins != 1 || usage["team-a"].Pins != 1 || usage["team-a"].Bytes != 10 {
+		t.Fatal("unexpected usage:", usage)
+	}
+
+	// counters are updated by the changes after they were counted
+	p.Size = 15
+	st.Add(p)
+	usage = st.NamespaceUsage()
+	if usage["team-a"].Pins != 1 || usage["team-a"].Bytes != 15 {
+		t.Error("re-adding a pin should replace its usage:", usage)
+	}
+	st.Rm(p.Cid)
+	st.Rm(p.Cid)
+	usage = st.NamespaceUsage()
+	if _, ok := usage["team-a"]; ok || usage[""].Pins != 1 {
+		t.Error("removed pins should not be counted:", usage)
+	}
+}
+
+func TestByContentUnindexed(t *testing.T) {
+	// pins stored without content index entries, like older versions did
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	st := NewDatastoreState(d)
+	st.Add(c)
+	d.Delete(st.contentKey(c.Cid))
+	d.Delete(indexedKey)
+
+	st = NewDatastoreState(d)
+	pins := st.ByContent(c.Cid)
+	if len(pins) != 1 || !pins[0].Cid.Equals(testCid1) {
+		t.Fatal("expected the pin to be indexed:", pins)
+	}
+	if ok, _ := d.Has(indexedKey); !ok {
+		t.Error("the datastore should be marked as indexed")
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	st, err := NewEncryptedDatastoreState(d, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Add(c)
+
+	res, err := d.Query(query.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := res.Rest()
+	for _, e := range entries {
+		if strings.Contains(e.Key, testCid1.String()) ||
+			bytes.Contains(e.Value, []byte(testCid1.String())) {
+			t.Errorf("%s: the pin is stored in the clear", e.Key)
+		}
+	}
+
+	st, err = NewEncryptedDatastoreState(d, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Get(c.Cid).Cid.Equals(testCid1) {
+		t.Error("the pin should be readable with the key")
+	}
+	pins := st.ByContent(c.Cid)
+	if len(pins) != 1 || !pins[0].Cid.Equals(testCid1) {
+		t.Error("expected the pin by content:", pins)
+	}
+	if len(st.List()) != 1 {
+		t.Error("expected one pin")
+	}
+
+	_, err = NewEncryptedDatastoreState(d, []byte("fedcba9876543210fedcba9876543210"))
+	if err == nil {
+		t.Error("expected an error with a different key")
+	}
+	if err = NewDatastoreState(d).checkEncryption(); err == nil {
+		t.Error("expected an error without the key")
+	}
+
+	plain := newState()
+	plain.Add(c)
+	_, err = NewEncryptedDatastoreState(plain.ds, key)
+	if err == nil {
+		t.Error("expected an error encrypting a plaintext state")
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	st := newState()
+	st.SetMaintenance(testPeerID1, true)
+	peers := st.MaintenancePeers()
+	if len(peers) != 1 || peers[0] != testPeerID1 {
+		t.Fatal("peer should be in maintenance mode")
+	}
+
+	st.SetMaintenance(testPeerID1, false)
+	if len(st.MaintenancePeers()) != 0 {
+		t.Error("peer should not be in maintenance mode")
+	}
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	st.SetMaintenance(testPeerID1, true)
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compatible with the MapState
+	ms := mapstate.NewMapState()
+	err = ms.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ms.Has(c.Cid) || len(ms.MaintenancePeers()) != 1 {
+		t.Error("expected the same contents in the MapState")
+	}
+
+	st2 := newState()
+	testCid2, _ := cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma")
+	st2.Add(api.PinCid(testCid2))
+	err = st2.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st2.GetVersion() != mapstate.Version {
+		t.Error("bad version")
+	}
+	if st2.Has(testCid2) {
+		t.Error("previous contents should have been replaced")
+	}
+	get := st2.Get(c.Cid)
+	if get.Allocations[0] != testPeerID1 {
+		t.Error("expected different peer id")
+	}
+	if len(st2.MaintenancePeers()) != 1 {
+		t.Error("expected peer in maintenance mode")
+	}
+}
+
+func TestMarshalUnmarshalMany(t *testing.T) {
+	// Enough pins for the larger map headers
+	ms := mapstate.NewMapState()
+	for i := 0; i < 300; i++ {
+		h, _ := multihash.Sum([]byte(fmt.Sprintf("pin-%d", i)), multihash.SHA2_256, -1)
+		ms.Add(api.Pin{
+			Cid:               cid.NewCidV1(cid.DagProtobuf, h),
+			Name:              fmt.Sprintf("pin-%d", i),
+			ReplicationFactor: -1,
+		})
+	}
+	ms.SetMaintenance(testPeerID1, true)
+	b, err := ms.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := newState()
+	err = st.Migrate(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.List()) != 300 || len(st.MaintenancePeers()) != 1 {
+		t.Fatal("expected the contents of the MapState")
+	}
+	if pins := st.ByContent(ms.List()[0].Cid); len(pins) != 1 {
+		t.Error("restored pins should be indexed by content")
+	}
+
+	var buf bytes.Buffer
+	err = st.MarshalTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms2 := mapstate.NewMapState()
+	err = ms2.Unmarshal(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms2.List()) != 300 || len(ms2.MaintenancePeers()) != 1 {
+		t.Fatal("expected the same contents in the MapState")
+	}
+	for _, p := range ms.List() {
+		if ms2.Get(p.Cid).Name != p.Name {
+			t.Error("expected the same pins in the MapState")
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	st, err := Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.(*mapstate.MapState); !ok {
+		t.Error("expected a MapState with the memory backend")
+	}
+
+	for _, b := range []string{BackendBadger, BackendLevelDB} {
+		dir, err := ioutil.TempDir("", "dsstate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		cfg.Backend = b
+		cfg.Folder = dir
+		st, err := Open(cfg, nil)
+		if err != nil {
+			t.Fatal(b, err)
+		}
+		st.Add(c)
+		st.(*DatastoreState).Close()
+
+		// survives a restart
+		st, err = Open(cfg, nil)
+		if err != nil {
+			t.Fatal(b, err)
+		}
+		if !st.Has(c.Cid) {
+			t.Errorf("%s: pin should have been persisted", b)
+		}
+		st.(*DatastoreState).Close()
+	}
+}
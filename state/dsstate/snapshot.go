@@ -0,0 +1,265 @@
+package dsstate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	msgpack "github.com/multiformats/go-multicodec/msgpack"
+)
+
+// The snapshots of a DatastoreState use the MapState format: the version
+// byte, the msgpack multicodec header and a msgpack map with the fields
+// of the MapState. They are written and read one entry at a time, so the
+// pins never need to be held in memory all together.
+
+// MarshalTo writes the state to w in the same format as a MapState.
+func (st *DatastoreState) MarshalTo(w io.Writer) error {
+	// Writes are blocked so that the number of entries announced
+	// in the map headers does not change while they are written.
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	nPins, err := st.count(pinsPrefix)
+	if err != nil {
+		return err
+	}
+	nMaintenance, err := st.count(maintenancePrefix)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := msgpack.Codec(msgpack.DefaultMsgpackHandle()).Encoder(bw)
+
+	bw.WriteByte(byte(mapstate.Version))
+	bw.Write(msgpack.Header)
+	writeMapHeader(bw, 3)
+
+	err = enc.Encode("PinMap")
+	if err != nil {
+		return err
+	}
+	writeMapHeader(bw, nPins)
+	written := 0
+	err = st.iterate(pinsPrefix, false, func(e query.Entry) error {
+		pin, err := st.decode(e.Value)
+		if err != nil {
+			return fmt.Errorf("bad entry %s: %s", e.Key, err)
+		}
+		written++
+		err = enc.Encode(pin.Cid)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(pin)
+	})
+	if err != nil {
+		return err
+	}
+	if written != nPins {
+		return errors.New("the datastore changed while writing the snapshot")
+	}
+
+	err = enc.Encode("MaintenanceMap")
+	if err != nil {
+		return err
+	}
+	writeMapHeader(bw, nMaintenance)
+	err = st.iterate(maintenancePrefix, true, func(e query.Entry) error {
+		err := enc.Encode(ds.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			return err
+		}
+		return enc.Encode(true)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = enc.Encode("Version")
+	if err != nil {
+		return err
+	}
+	err = enc.Encode(mapstate.Version)
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// UnmarshalFrom reads a MapState-encoded state from r and replaces the
+// contents of the datastore with it, as it is read. As with Unmarshal,
+// an out of date version is only recorded. If reading fails half-way,
+// the datastore is left with the entries read until then.
+func (st *DatastoreState) UnmarshalFrom(r io.Reader) error {
+	br := bufio.NewReader(r)
+	v, err := br.ReadByte()
+	if err == io.EOF {
+		return errors.New("empty state")
+	}
+	if err != nil {
+		return err
+	}
+
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	if int(v) != mapstate.Version {
+		st.version = int(v)
+		return nil
+	}
+
+	header := make([]byte, len(msgpack.Header))
+	_, err = io.ReadFull(br, header)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(header, msgpack.Header) {
+		return errors.New("bad state encoding")
+	}
+
+	err = st.clear()
+	if err != nil {
+		return err
+	}
+
+	dec := msgpack.Codec(msgpack.DefaultMsgpackHandle()).Decoder(br)
+	nFields, err := readMapHeader(br)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < nFields; i++ {
+		var field string
+		err = dec.Decode(&field)
+		if err != nil {
+			return err
+		}
+		switch field {
+		case "PinMap":
+			err = st.readPins(br, dec)
+		case "MaintenanceMap":
+			err = st.readMaintenance(br, dec)
+		default: // Version and anything unknown
+			var skip interface{}
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	st.version = mapstate.Version
+	return nil
+}
+
+func (st *DatastoreState) readPins(br *bufio.Reader, dec decoder) error {
+	n, err := readMapHeader(br)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		var k string
+		var pin api.PinSerial
+		err = dec.Decode(&k)
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&pin)
+		if err != nil {
+			return err
+		}
+		v, err := st.encode(pin)
+		if err != nil {
+			return err
+		}
+		c, err := cid.Decode(k)
+		if err != nil {
+			return err
+		}
+		err = st.put(c, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *DatastoreState) readMaintenance(br *bufio.Reader, dec decoder) error {
+	n, err := readMapHeader(br)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		var k string
+		var enabled bool
+		err = dec.Decode(&k)
+		if err != nil {
+			return err
+		}
+		err = dec.Decode(&enabled)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			continue
+		}
+		err = st.ds.Put(maintenancePrefix.ChildString(k), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type decoder interface {
+	Decode(interface{}) error
+}
+
+// writeMapHeader writes the msgpack header of a map with n entries.
+// Errors are returned by the Flush of the bufio.Writer.
+func writeMapHeader(w *bufio.Writer, n int) {
+	switch {
+	case n < 16:
+		w.WriteByte(0x80 | byte(n))
+	case n <= 0xffff:
+		w.WriteByte(0xde)
+		binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		w.WriteByte(0xdf)
+		binary.Write(w, binary.BigEndian, uint32(n))
+	}
+}
+
+// readMapHeader reads the msgpack header of a map and returns the
+// number of entries in it. A nil is an empty map.
+func readMapHeader(r *bufio.Reader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f), nil
+	case b == 0xc0:
+		return 0, nil
+	case b == 0xde:
+		var n uint16
+		err = binary.Read(r, binary.BigEndian, &n)
+		return int(n), err
+	case b == 0xdf:
+		var n uint32
+		err = binary.Read(r, binary.BigEndian, &n)
+		return int(n), err
+	default:
+		return 0, fmt.Errorf("expected a msgpack map, found 0x%x", b)
+	}
+}
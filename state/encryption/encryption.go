@@ -0,0 +1,78 @@
+// Package encryption provides the cipher used to encrypt the data which
+// cluster peers keep at rest (the Raft log and snapshots, the datastore
+// state and the pin tracker operations) when raft.encryption_key is set.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// ErrCiphertextTooShort is returned when decrypting something which
+// cannot have been produced by a Cipher.
+var ErrCiphertextTooShort = errors.New("encrypted data is too short")
+
+// nameKeyInfo is mixed with the encryption key to derive the key used
+// by Name, so that names do not reveal anything about the encryption key.
+const nameKeyInfo = "ipfs-cluster names"
+
+// Cipher encrypts and decrypts data using AES-GCM. Encrypted data is
+// prefixed by a random nonce.
+type Cipher struct {
+	// AEAD is the underlying cipher, for callers which need to seal
+	// data on their own (i.e. in segments).
+	AEAD    cipher.AEAD
+	nameKey []byte
+}
+
+// New returns a Cipher for the given key, which must be 16, 24 or 32
+// bytes long (AES-128, AES-192 or AES-256).
+func New(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(nameKeyInfo))
+	return &Cipher{
+		AEAD:    aead,
+		nameKey: mac.Sum(nil),
+	}, nil
+}
+
+// Encrypt seals plain with a random nonce.
+func (c *Cipher) Encrypt(plain []byte) ([]byte, error) {
+	nonce := make([]byte, c.AEAD.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.AEAD.Seal(nonce, nonce, plain, nil), nil
+}
+
+// Decrypt opens data produced by Encrypt.
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	nSize := c.AEAD.NonceSize()
+	if len(data) < nSize {
+		return nil, ErrCiphertextTooShort
+	}
+	return c.AEAD.Open(nil, data[:nSize], data[nSize:], nil)
+}
+
+// Name returns a keyed hash of s, hex-encoded. It allows to store items
+// under names (i.e. datastore keys) which can be looked up again, but
+// which do not reveal the original values without the key.
+func (c *Cipher) Name(s string) string {
+	mac := hmac.New(sha256.New, c.nameKey)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,58 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestCipher(t *testing.T) {
+	c, err := New(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := []byte("some pinset")
+	enc, err := c.Encrypt(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(enc, plain) {
+		t.Error("encrypted data should not contain the plaintext")
+	}
+
+	dec, err := c.Decrypt(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, plain) {
+		t.Error("decrypted data does not match")
+	}
+
+	_, err = c.Decrypt([]byte("a"))
+	if err == nil {
+		t.Error("expected an error decrypting bad data")
+	}
+
+	_, err = New([]byte("short"))
+	if err == nil {
+		t.Error("expected an error with a bad key")
+	}
+}
+
+func TestName(t *testing.T) {
+	c, _ := New(testKey)
+	other, _ := New([]byte("fedcba9876543210fedcba9876543210"))
+
+	n := c.Name("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+	if n != c.Name("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq") {
+		t.Error("names should be deterministic")
+	}
+	if n == c.Name("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmc") {
+		t.Error("different values should have different names")
+	}
+	if n == other.Name("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq") {
+		t.Error("names should depend on the key")
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	cid "github.com/ipfs/go-cid"
 	"github.com/ipfs/ipfs-cluster/api"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 // State is used by the Consensus component to keep track of
@@ -23,6 +24,18 @@ type State interface {
 	Has(*cid.Cid) bool
 	// Get returns the information attacthed to this pin
 	Get(*cid.Cid) api.Pin
+	// ByContent returns the pins whose Cid references the same content
+	// as the given one (see ContentKey), including its own pin. Aliases
+	// of those pins reference the same content too.
+	ByContent(*cid.Cid) []api.Pin
+	// NamespaceUsage returns the number of pins and their cumulative
+	// size in every namespace which has pins. It is updated as pins
+	// are added and removed, so it does not list the pins.
+	NamespaceUsage() map[string]api.Namespace
+	// SetMaintenance sets or unsets the maintenance mode for a peer
+	SetMaintenance(peer.ID, bool) error
+	// MaintenancePeers returns the peers in maintenance mode
+	MaintenancePeers() []peer.ID
 	// Migrate restores the serialized format of an outdated state to the current version
 	Migrate(r io.Reader) error
 	// Return the version of this state
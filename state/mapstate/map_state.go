@@ -13,6 +13,8 @@ import (
 	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 // Version is the map state Version. States with old versions should
@@ -24,24 +26,44 @@ var logger = logging.Logger("mapstate")
 // MapState is a very simple database to store the state of the system
 // using a Go map. It is thread safe. It implements the State interface.
 type MapState struct {
-	pinMux  sync.RWMutex
-	PinMap  map[string]api.PinSerial
-	Version int
+	pinMux         sync.RWMutex
+	PinMap         map[string]api.PinSerial
+	MaintenanceMap map[string]bool
+	Version        int
+
+	// contentIndex maps content keys to the Cids of the pins which
+	// reference that content. It is not serialized and it is rebuilt
+	// when nil.
+	contentIndex map[string]map[string]struct{}
+	// usage counts the pins in every namespace. It is not serialized
+	// and it is rebuilt when nil.
+	usage state.Usage
 }
 
 // NewMapState initializes the internal map and returns a new MapState object.
 func NewMapState() *MapState {
 	return &MapState{
-		PinMap:  make(map[string]api.PinSerial),
-		Version: Version,
+		PinMap:         make(map[string]api.PinSerial),
+		MaintenanceMap: make(map[string]bool),
+		Version:        Version,
 	}
 }
 
-// Add adds a Pin to the internal map.
+// Add adds a Pin to the internal map. Its RequestID is not stored.
 func (st *MapState) Add(c api.Pin) error {
 	st.pinMux.Lock()
 	defer st.pinMux.Unlock()
+	c.RequestID = ""
+	if st.usage != nil {
+		if old, ok := st.PinMap[c.Cid.String()]; ok {
+			st.usage.Remove(old.Namespace, old.Size)
+		}
+		st.usage.Add(c.Namespace, c.Size)
+	}
 	st.PinMap[c.Cid.String()] = c.ToSerial()
+	if st.contentIndex != nil {
+		st.indexPin(c.Cid.String(), state.ContentKey(c.Cid))
+	}
 	return nil
 }
 
@@ -49,7 +71,17 @@ func (st *MapState) Add(c api.Pin) error {
 func (st *MapState) Rm(c *cid.Cid) error {
 	st.pinMux.Lock()
 	defer st.pinMux.Unlock()
+	if old, ok := st.PinMap[c.String()]; ok && st.usage != nil {
+		st.usage.Remove(old.Namespace, old.Size)
+	}
 	delete(st.PinMap, c.String())
+	if st.contentIndex != nil {
+		key := state.ContentKey(c)
+		delete(st.contentIndex[key], c.String())
+		if len(st.contentIndex[key]) == 0 {
+			delete(st.contentIndex, key)
+		}
+	}
 	return nil
 }
 
@@ -72,6 +104,56 @@ func (st *MapState) Has(c *cid.Cid) bool {
 	return ok
 }
 
+// ByContent returns the pins whose Cid references the same content as
+// the given one, including its own pin.
+func (st *MapState) ByContent(c *cid.Cid) []api.Pin {
+	st.pinMux.Lock()
+	defer st.pinMux.Unlock()
+	if st.contentIndex == nil {
+		st.contentIndex = make(map[string]map[string]struct{})
+		for k, v := range st.PinMap {
+			pc, err := cid.Decode(v.Cid)
+			if err != nil {
+				continue
+			}
+			st.indexPin(k, state.ContentKey(pc))
+		}
+	}
+
+	cids := st.contentIndex[state.ContentKey(c)]
+	pins := make([]api.Pin, 0, len(cids))
+	for k := range cids {
+		pins = append(pins, st.PinMap[k].ToPin())
+	}
+	return pins
+}
+
+// NamespaceUsage returns the number of pins and their cumulative size in
+// every namespace which has pins.
+func (st *MapState) NamespaceUsage() map[string]api.Namespace {
+	st.pinMux.Lock()
+	defer st.pinMux.Unlock()
+	if st.usage == nil {
+		st.usage = make(state.Usage)
+		for _, v := range st.PinMap {
+			if v.Cid == "" {
+				continue
+			}
+			st.usage.Add(v.Namespace, v.Size)
+		}
+	}
+	return st.usage.Copy()
+}
+
+func (st *MapState) indexPin(k, key string) {
+	cids, ok := st.contentIndex[key]
+	if !ok {
+		cids = make(map[string]struct{})
+		st.contentIndex[key] = cids
+	}
+	cids[k] = struct{}{}
+}
+
 // List provides the list of tracked Pins.
 func (st *MapState) List() []api.Pin {
 	st.pinMux.RLock()
@@ -86,6 +168,38 @@ func (st *MapState) List() []api.Pin {
 	return cids
 }
 
+// SetMaintenance flags or unflags a peer as being in maintenance mode.
+func (st *MapState) SetMaintenance(p peer.ID, enabled bool) error {
+	st.pinMux.Lock()
+	defer st.pinMux.Unlock()
+	// states restored from older snapshots may not have this map
+	if st.MaintenanceMap == nil {
+		st.MaintenanceMap = make(map[string]bool)
+	}
+	if enabled {
+		st.MaintenanceMap[peer.IDB58Encode(p)] = true
+	} else {
+		delete(st.MaintenanceMap, peer.IDB58Encode(p))
+	}
+	return nil
+}
+
+// MaintenancePeers returns the list of peers in maintenance mode.
+func (st *MapState) MaintenancePeers() []peer.ID {
+	st.pinMux.RLock()
+	defer st.pinMux.RUnlock()
+	peers := make([]peer.ID, 0, len(st.MaintenanceMap))
+	for k := range st.MaintenanceMap {
+		p, err := peer.IDB58Decode(k)
+		if err != nil {
+			logger.Error(k, err)
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
+
 // Migrate restores a snapshot from the state's internal bytes and if
 // necessary migrates the format to the current version.
 func (st *MapState) Migrate(r io.Reader) error {
@@ -94,6 +208,9 @@ func (st *MapState) Migrate(r io.Reader) error {
 		return err
 	}
 	err = st.Unmarshal(bs)
+	if err != nil {
+		return err
+	}
 	if st.Version == Version { // Unmarshal restored for us
 		return nil
 	}
@@ -103,6 +220,8 @@ func (st *MapState) Migrate(r io.Reader) error {
 		return err
 	}
 	st.Version = Version
+	st.contentIndex = nil
+	st.usage = nil
 	return nil
 }
 
@@ -147,5 +266,7 @@ func (st *MapState) Unmarshal(bs []byte) error {
 	// snapshot is up to date
 	buf := bytes.NewBuffer(bs[1:])
 	dec := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Decoder(buf)
+	st.contentIndex = nil
+	st.usage = nil
 	return dec.Decode(st)
 }
@@ -10,6 +10,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
 )
 
 var testCid1, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
@@ -70,6 +71,62 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestByContent(t *testing.T) {
+	ms := NewMapState()
+	ms.Add(c)
+	v1 := cid.NewCidV1(cid.DagProtobuf, testCid1.Hash())
+
+	// the index is rebuilt after restoring a state
+	v, err := ms.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms2 := NewMapState()
+	ms2.Unmarshal(v)
+	pins := ms2.ByContent(v1)
+	if len(pins) != 1 || !pins[0].Cid.Equals(testCid1) {
+		t.Fatal("expected the CIDv0 pin for the CIDv1:", pins)
+	}
+
+	ms2.Add(api.PinCid(v1))
+	if len(ms2.ByContent(testCid1)) != 2 {
+		t.Error("expected the pins for both Cids")
+	}
+	ms2.Rm(testCid1)
+	pins = ms2.ByContent(testCid1)
+	if len(pins) != 1 || !pins[0].Cid.Equals(v1) {
+		t.Error("expected only the CIDv1 pin:", pins)
+	}
+}
+
+func TestNamespaceUsage(t *testing.T) {
+	st := NewMapState()
+	st.Add(c)
+	p := api.PinCid(cid.NewCidV1(cid.DagProtobuf, testCid1.Hash()))
+	p.Namespace = "team-a"
+	p.Size = 10
+	st.Add(p)
+
+	usage := st.NamespaceUsage()
+	if usage[""].Pins != 1 || usage["team-a"].Pins != 1 || usage["team-a"].Bytes != 10 {
+		t.Fatal("unexpected usage:", usage)
+	}
+
+	// counters are updated by the changes after they were counted
+	p.Size = 15
+	st.Add(p)
+	usage = st.NamespaceUsage()
+	if usage["team-a"].Pins != 1 || usage["team-a"].Bytes != 15 {
+		t.Error("re-adding a pin should replace its usage:", usage)
+	}
+	st.Rm(p.Cid)
+	st.Rm(p.Cid)
+	usage = st.NamespaceUsage()
+	if _, ok := usage["team-a"]; ok || usage[""].Pins != 1 {
+		t.Error("removed pins should not be counted:", usage)
+	}
+}
+
 func TestMarshalUnmarshal(t *testing.T) {
 	ms := NewMapState()
 	ms.Add(c)
@@ -128,3 +185,92 @@ func TestMigrateFromV1(t *testing.T) {
 		t.Logf("%+v", get)
 	}
 }
+
+func TestMaintenance(t *testing.T) {
+	ms := NewMapState()
+	ms.SetMaintenance(testPeerID1, true)
+	peers := ms.MaintenancePeers()
+	if len(peers) != 1 || peers[0] != testPeerID1 {
+		t.Fatal("peer should be in maintenance mode")
+	}
+
+	ms.SetMaintenance(testPeerID1, false)
+	if len(ms.MaintenancePeers()) != 0 {
+		t.Error("peer should not be in maintenance mode")
+	}
+
+	// states restored from old snapshots have a nil map
+	ms.MaintenanceMap = nil
+	ms.SetMaintenance(testPeerID1, true)
+	if len(ms.MaintenancePeers()) != 1 {
+		t.Error("peer should be in maintenance mode")
+	}
+}
+
+func TestCanMigrate(t *testing.T) {
+	if !CanMigrate(Version) || !CanMigrate(1) {
+		t.Error("should be able to migrate from known versions")
+	}
+	if CanMigrate(Version + 1) {
+		t.Error("should not be able to migrate from newer versions")
+	}
+}
+
+func TestMigrateUnsupported(t *testing.T) {
+	ms := NewMapState()
+	bs := []byte{byte(Version + 1), 0x80}
+	err := ms.Migrate(bytes.NewBuffer(bs))
+	if err == nil {
+		t.Error("expected an error migrating from a newer version")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	ms := NewMapState()
+	emptyRoot, buckets, err := state.Checksum(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != state.ChecksumBuckets {
+		t.Fatal("expected a checksum for every bucket")
+	}
+
+	ms.Add(c)
+	root, buckets2, _ := state.Checksum(ms)
+	if root == emptyRoot {
+		t.Error("the root should change when adding a pin")
+	}
+	b := state.Bucket(c.Cid)
+	for i := range buckets {
+		if (buckets[i] != buckets2[i]) != (i == b) {
+			t.Error("only the bucket of the pin should change")
+		}
+	}
+	pins := state.BucketPins(ms, b)
+	if len(pins) != 1 || !pins[0].Cid.Equals(c.Cid) {
+		t.Error("expected the pin in its bucket")
+	}
+
+	// same pins, same checksum
+	ms2 := NewMapState()
+	ms2.Add(c)
+	root2, _, _ := state.Checksum(ms2)
+	if root2 != root {
+		t.Error("the checksum should only depend on the pins")
+	}
+
+	// different options, different checksum
+	c2 := c
+	c2.ReplicationFactor = 2
+	ms2.Add(c2)
+	root2, _, _ = state.Checksum(ms2)
+	if root2 == root {
+		t.Error("the checksum should depend on the pin options")
+	}
+
+	ms.Rm(c.Cid)
+	root, _, _ = state.Checksum(ms)
+	if root != emptyRoot {
+		t.Error("the checksum should go back when removing the pin")
+	}
+}
@@ -3,11 +3,12 @@ package mapstate
 // To add a new state format
 // - implement the previous format's "next" function to the new format
 // - implement the new format's unmarshal function
-// - add a case to the switch statement for the previous format version
+// - register the previous format version in the formats map
 // - update the code copying the from mapStateVx to mapState
 import (
 	"bytes"
 	"errors"
+	"fmt"
 
 	msgpack "github.com/multiformats/go-multicodec/msgpack"
 
@@ -21,6 +22,22 @@ type migrateable interface {
 	unmarshal([]byte) error
 }
 
+// formats holds a constructor for every old state format version
+// which can be migrated to the current one.
+var formats = map[int]func() migrateable{
+	1: func() migrateable { return &mapStateV1{} },
+}
+
+// CanMigrate returns true when states with the given version can be
+// migrated to the current one.
+func CanMigrate(version int) bool {
+	if version == Version {
+		return true
+	}
+	_, ok := formats[version]
+	return ok
+}
+
 type mapStateV1 struct {
 	Version int
 	PinMap  map[string]struct{}
@@ -71,15 +88,14 @@ func finalCopy(st *MapState, internal *mapStateV2) {
 
 func (st *MapState) migrateFrom(version int, snap []byte) error {
 	var m, next migrateable
-	switch version {
-	case 1:
-		var mst1 mapStateV1
-		m = &mst1
-		break
-
-	default:
-		return errors.New("version migration not supported")
+	newFormat, ok := formats[version]
+	if !ok {
+		if version > Version {
+			return fmt.Errorf("state version %d is newer than the supported %d", version, Version)
+		}
+		return fmt.Errorf("migration from state version %d not supported", version)
 	}
+	m = newFormat()
 
 	err := m.unmarshal(snap)
 	if err != nil {
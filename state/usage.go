@@ -0,0 +1,46 @@
+package state
+
+import "github.com/ipfs/ipfs-cluster/api"
+
+// Usage holds the number of pins and their cumulative size in every
+// namespace which has pins (see State.NamespaceUsage). States keep it up
+// to date as pins are added and removed, so quotas can be checked
+// without listing the pins. It is not thread safe.
+type Usage map[string]api.Namespace
+
+// Add counts a pin in the given namespace.
+func (u Usage) Add(ns string, size uint64) {
+	n := u[ns]
+	n.Name = ns
+	n.Pins++
+	n.Bytes += size
+	u[ns] = n
+}
+
+// Remove discounts a pin from the given namespace.
+func (u Usage) Remove(ns string, size uint64) {
+	n, ok := u[ns]
+	if !ok {
+		return
+	}
+	n.Pins--
+	if n.Bytes > size {
+		n.Bytes -= size
+	} else {
+		n.Bytes = 0
+	}
+	if n.Pins <= 0 {
+		delete(u, ns)
+		return
+	}
+	u[ns] = n
+}
+
+// Copy returns a copy of the usage which can be handed to callers.
+func (u Usage) Copy() map[string]api.Namespace {
+	c := make(map[string]api.Namespace, len(u))
+	for ns, n := range u {
+		c[ns] = n
+	}
+	return c
+}
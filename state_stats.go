@@ -0,0 +1,60 @@
+package ipfscluster
+
+import (
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// DefaultStatsDelimiter separates the prefix used to group pins by name
+// in StateStats from the rest of the name.
+const DefaultStatsDelimiter = "/"
+
+// stateStats aggregates the given pins. The name prefix of a pin is the
+// part of its name before the first delimiter, or the whole name when it
+// has none.
+func stateStats(pins []api.Pin, delimiter string) api.StateStats {
+	stats := api.StateStats{
+		ByReplicationFactor: make(map[int]int),
+		ByNamePrefix:        make(map[string]int),
+		ByPeer:              make(map[peer.ID]int),
+	}
+	for _, pin := range pins {
+		stats.Pins++
+		stats.ByReplicationFactor[pin.ReplicationFactor]++
+
+		prefix := pin.Name
+		if i := strings.Index(prefix, delimiter); delimiter != "" && i >= 0 {
+			prefix = prefix[:i]
+		}
+		stats.ByNamePrefix[prefix]++
+
+		if pin.ReplicationFactor < 0 {
+			stats.Everywhere++
+			continue
+		}
+		for _, p := range pin.Allocations {
+			stats.ByPeer[p]++
+			stats.Replicas++
+		}
+	}
+	return stats
+}
+
+// StateStats walks the shared state and returns aggregated figures about
+// the pins in it, grouping their names by the part before the given
+// delimiter (DefaultStatsDelimiter when empty). It is meant for capacity
+// reviews which do not need the full list of pins.
+func (c *Cluster) StateStats(delimiter string) (api.StateStats, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return api.StateStats{}, err
+	}
+	if delimiter == "" {
+		delimiter = DefaultStatsDelimiter
+	}
+	return stateStats(cState.List(), delimiter), nil
+}
@@ -0,0 +1,72 @@
+package ipfscluster
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestStateStats(t *testing.T) {
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	c3, _ := cid.Decode(test.TestCid3)
+	pins := []api.Pin{
+		{
+			Cid:               c1,
+			Name:              "backups/2018",
+			ReplicationFactor: 2,
+			Allocations:       []peer.ID{test.TestPeerID1, test.TestPeerID2},
+		},
+		{
+			Cid:               c2,
+			Name:              "backups/2017",
+			ReplicationFactor: 1,
+			Allocations:       []peer.ID{test.TestPeerID1},
+		},
+		{
+			Cid:               c3,
+			Name:              "website",
+			ReplicationFactor: -1,
+		},
+	}
+
+	stats := stateStats(pins, "/")
+	if stats.Pins != 3 || stats.Everywhere != 1 || stats.Replicas != 3 {
+		t.Error("unexpected totals:", stats)
+	}
+	if stats.ByReplicationFactor[2] != 1 || stats.ByReplicationFactor[-1] != 1 {
+		t.Error("unexpected replication factors:", stats.ByReplicationFactor)
+	}
+	if stats.ByNamePrefix["backups"] != 2 || stats.ByNamePrefix["website"] != 1 {
+		t.Error("unexpected name prefixes:", stats.ByNamePrefix)
+	}
+	if stats.ByPeer[test.TestPeerID1] != 2 || stats.ByPeer[test.TestPeerID2] != 1 {
+		t.Error("unexpected peers:", stats.ByPeer)
+	}
+}
+
+func TestClusterStateStats(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c1)
+	pin.Name = "a-b"
+	err := cl.Pin(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := cl.StateStats("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pins != 1 || stats.ByNamePrefix["a"] != 1 {
+		t.Error("unexpected stats:", stats)
+	}
+}
@@ -0,0 +1,159 @@
+package ipfscluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// statusCache keeps the status reported by other peers for a short time,
+// so that repeated status requests (i.e. from dashboards polling the API)
+// do not reach every peer every time. Items are invalidated when they are
+// pinned or unpinned. A zero TTL disables it.
+type statusCache struct {
+	ttl time.Duration
+
+	mux       sync.Mutex
+	cids      map[string]map[peer.ID]cachedPinInfo
+	all       map[string]map[peer.ID]cachedPinInfoSlice
+	lastSweep time.Time
+}
+
+type cachedPinInfo struct {
+	info    api.PinInfo
+	expires time.Time
+}
+
+type cachedPinInfoSlice struct {
+	infos   []api.PinInfoSerial
+	expires time.Time
+}
+
+func newStatusCache(ttl time.Duration) *statusCache {
+	return &statusCache{
+		ttl:       ttl,
+		cids:      make(map[string]map[peer.ID]cachedPinInfo),
+		all:       make(map[string]map[peer.ID]cachedPinInfoSlice),
+		lastSweep: time.Now(),
+	}
+}
+
+// get returns the cached status of a Cid in a peer.
+func (sc *statusCache) get(h *cid.Cid, p peer.ID) (api.PinInfo, bool) {
+	if sc.ttl <= 0 {
+		return api.PinInfo{}, false
+	}
+
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	cached, ok := sc.cids[h.String()][p]
+	if !ok || time.Now().After(cached.expires) {
+		return api.PinInfo{}, false
+	}
+	return cached.info, true
+}
+
+// put caches the status of a Cid in a peer.
+func (sc *statusCache) put(h *cid.Cid, p peer.ID, info api.PinInfo) {
+	if sc.ttl <= 0 {
+		return
+	}
+
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	sc.sweep()
+	peers, ok := sc.cids[h.String()]
+	if !ok {
+		peers = make(map[peer.ID]cachedPinInfo)
+		sc.cids[h.String()] = peers
+	}
+	peers[p] = cachedPinInfo{
+		info:    info,
+		expires: time.Now().Add(sc.ttl),
+	}
+}
+
+// getAll returns the cached status of all the items reported by a peer
+// for the given filter.
+func (sc *statusCache) getAll(filter api.StatusFilter, p peer.ID) ([]api.PinInfoSerial, bool) {
+	if sc.ttl <= 0 {
+		return nil, false
+	}
+
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	cached, ok := sc.all[filter.String()][p]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+	return cached.infos, true
+}
+
+// putAll caches the status of all the items reported by a peer for the
+// given filter.
+func (sc *statusCache) putAll(filter api.StatusFilter, p peer.ID, infos []api.PinInfoSerial) {
+	if sc.ttl <= 0 {
+		return
+	}
+
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	sc.sweep()
+	peers, ok := sc.all[filter.String()]
+	if !ok {
+		peers = make(map[peer.ID]cachedPinInfoSlice)
+		sc.all[filter.String()] = peers
+	}
+	peers[p] = cachedPinInfoSlice{
+		infos:   infos,
+		expires: time.Now().Add(sc.ttl),
+	}
+}
+
+// invalidate removes the cached status of a Cid. Since the status of
+// all items includes it, those are removed too.
+func (sc *statusCache) invalidate(h *cid.Cid) {
+	if sc.ttl <= 0 {
+		return
+	}
+
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	delete(sc.cids, h.String())
+	sc.all = make(map[string]map[peer.ID]cachedPinInfoSlice)
+}
+
+// sweep removes expired entries, at most once per TTL, so that the cache
+// does not grow with every Cid ever requested.
+func (sc *statusCache) sweep() {
+	now := time.Now()
+	if now.Sub(sc.lastSweep) < sc.ttl {
+		return
+	}
+	sc.lastSweep = now
+
+	for k, peers := range sc.cids {
+		for p, cached := range peers {
+			if now.After(cached.expires) {
+				delete(peers, p)
+			}
+		}
+		if len(peers) == 0 {
+			delete(sc.cids, k)
+		}
+	}
+	for k, peers := range sc.all {
+		for p, cached := range peers {
+			if now.After(cached.expires) {
+				delete(peers, p)
+			}
+		}
+		if len(peers) == 0 {
+			delete(sc.all, k)
+		}
+	}
+}
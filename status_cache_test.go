@@ -0,0 +1,82 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestStatusCache(t *testing.T) {
+	sc := newStatusCache(100 * time.Millisecond)
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	pinfo := api.PinInfo{
+		Cid:    h1,
+		Peer:   test.TestPeerID2,
+		Status: api.TrackerStatusPinned,
+	}
+
+	if _, ok := sc.get(h1, test.TestPeerID2); ok {
+		t.Error("nothing should be cached yet")
+	}
+
+	sc.put(h1, test.TestPeerID2, pinfo)
+	cached, ok := sc.get(h1, test.TestPeerID2)
+	if !ok || cached.Status != api.TrackerStatusPinned {
+		t.Error("expected the status to be cached")
+	}
+	if _, ok := sc.get(h1, test.TestPeerID3); ok {
+		t.Error("status is cached per peer")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, ok := sc.get(h1, test.TestPeerID2); ok {
+		t.Error("the cached status should have expired")
+	}
+
+	sc.put(h1, test.TestPeerID2, pinfo)
+	sc.put(h2, test.TestPeerID2, pinfo)
+	sc.invalidate(h1)
+	if _, ok := sc.get(h1, test.TestPeerID2); ok {
+		t.Error("the cached status should have been invalidated")
+	}
+	if _, ok := sc.get(h2, test.TestPeerID2); !ok {
+		t.Error("other items should stay cached")
+	}
+}
+
+func TestStatusCacheAll(t *testing.T) {
+	sc := newStatusCache(time.Minute)
+	h, _ := cid.Decode(test.TestCid1)
+	filter := api.StatusFilter{api.TrackerStatusPinError}
+	infos := []api.PinInfoSerial{
+		{Cid: test.TestCid1, Status: "pin_error"},
+	}
+
+	sc.putAll(filter, test.TestPeerID2, infos)
+	cached, ok := sc.getAll(filter, test.TestPeerID2)
+	if !ok || len(cached) != 1 {
+		t.Error("expected the status of all items to be cached")
+	}
+	if _, ok := sc.getAll(nil, test.TestPeerID2); ok {
+		t.Error("the status of all items is cached per filter")
+	}
+
+	sc.invalidate(h)
+	if _, ok := sc.getAll(filter, test.TestPeerID2); ok {
+		t.Error("pinning or unpinning any item should invalidate all lists")
+	}
+}
+
+func TestStatusCacheDisabled(t *testing.T) {
+	sc := newStatusCache(0)
+	h, _ := cid.Decode(test.TestCid1)
+	sc.put(h, test.TestPeerID2, api.PinInfo{Cid: h})
+	if _, ok := sc.get(h, test.TestPeerID2); ok {
+		t.Error("a disabled cache should not cache anything")
+	}
+}
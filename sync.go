@@ -0,0 +1,100 @@
+package ipfscluster
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// SyncFunc performs a sync operation and returns the items which were
+// found out of sync or in error.
+type SyncFunc func() ([]api.PinInfo, error)
+
+// syncLoop triggers a SyncFunc periodically and records the outcome of
+// its last run. Runs are separated by the interval plus a random delay of
+// up to jitter. A zero interval disables the loop.
+type syncLoop struct {
+	name     string
+	interval time.Duration
+	jitter   time.Duration
+	syncFn   SyncFunc
+	rand     *rand.Rand
+
+	mux       sync.Mutex
+	last      time.Time
+	outOfSync int
+	err       error
+}
+
+func newSyncLoop(name string, interval, jitter time.Duration, f SyncFunc) *syncLoop {
+	return &syncLoop{
+		name:     name,
+		interval: interval,
+		jitter:   jitter,
+		syncFn:   f,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// run triggers the sync until the context is cancelled. It returns
+// right away when the loop is disabled.
+func (l *syncLoop) run(ctx context.Context) {
+	if l.interval <= 0 {
+		logger.Infof("automatic %s is disabled", l.name)
+		return
+	}
+
+	timer := time.NewTimer(l.nextWait())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			logger.Debugf("auto-triggering %s", l.name)
+			l.trigger()
+			timer.Reset(l.nextWait())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// nextWait returns the time to wait before the next run. It is only
+// called from the run goroutine, which owns l.rand.
+func (l *syncLoop) nextWait() time.Duration {
+	if l.jitter <= 0 {
+		return l.interval
+	}
+	return l.interval + time.Duration(l.rand.Int63n(int64(l.jitter)))
+}
+
+// trigger runs the sync and records its outcome.
+func (l *syncLoop) trigger() {
+	infos, err := l.syncFn()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.last = time.Now()
+	l.outOfSync = len(infos)
+	l.err = err
+}
+
+// info returns the configuration of the loop along with the outcome
+// of its last run.
+func (l *syncLoop) info() api.SyncInfo {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	si := api.SyncInfo{
+		Enabled:   l.interval > 0,
+		Interval:  l.interval,
+		Jitter:    l.jitter,
+		Last:      l.last,
+		OutOfSync: l.outOfSync,
+	}
+	if l.err != nil {
+		si.Error = l.err.Error()
+	}
+	return si
+}
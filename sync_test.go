@@ -0,0 +1,113 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+type countingSync struct {
+	mu    sync.Mutex
+	runs  int
+	infos []api.PinInfo
+	err   error
+}
+
+func (cs *countingSync) sync() ([]api.PinInfo, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.runs++
+	return cs.infos, cs.err
+}
+
+func (cs *countingSync) count() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.runs
+}
+
+func TestSyncLoopRuns(t *testing.T) {
+	cs := &countingSync{
+		infos: make([]api.PinInfo, 1),
+		err:   errors.New("ipfs is down"),
+	}
+	l := newSyncLoop("test", 50*time.Millisecond, 0, cs.sync)
+
+	si := l.info()
+	if !si.Enabled || !si.Last.IsZero() {
+		t.Error("expected an enabled loop which never ran")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.run(ctx)
+	time.Sleep(180 * time.Millisecond)
+
+	if n := cs.count(); n < 2 || n > 4 {
+		t.Errorf("expected around 3 runs, got %d", n)
+	}
+	si = l.info()
+	if si.Last.IsZero() || si.OutOfSync != 1 || si.Error != "ipfs is down" {
+		t.Error("unexpected sync info:", si)
+	}
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	n := cs.count()
+	time.Sleep(100 * time.Millisecond)
+	if cs.count() != n {
+		t.Error("the loop should stop when the context is cancelled")
+	}
+}
+
+func TestSyncLoopDisabled(t *testing.T) {
+	cs := &countingSync{}
+	l := newSyncLoop("test", 0, time.Second, cs.sync)
+
+	done := make(chan struct{})
+	go func() {
+		l.run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a disabled loop should return right away")
+	}
+	if cs.count() != 0 {
+		t.Error("a disabled loop should not sync")
+	}
+	if l.info().Enabled {
+		t.Error("the loop should be reported as disabled")
+	}
+}
+
+func TestSyncLoopJitter(t *testing.T) {
+	interval := time.Second
+	jitter := 100 * time.Millisecond
+	l := newSyncLoop("test", interval, jitter, (&countingSync{}).sync)
+
+	varied := false
+	for i := 0; i < 100; i++ {
+		w := l.nextWait()
+		if w < interval || w >= interval+jitter {
+			t.Fatal("wait out of bounds:", w)
+		}
+		if w != interval {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Error("expected some jitter")
+	}
+
+	l = newSyncLoop("test", interval, 0, (&countingSync{}).sync)
+	if l.nextWait() != interval {
+		t.Error("expected no jitter")
+	}
+}
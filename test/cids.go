@@ -7,10 +7,33 @@ var (
 	TestCid1 = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq"
 	TestCid2 = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma"
 	TestCid3 = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmb"
+	// TestCid1V1 is the CIDv1 for the same content as TestCid1.
+	TestCid1V1 = "zdj7WWBHbBE6iFpR639GvnbEbWTX7D7e2MH2GR8Xg14pGQfwm"
+	// TestInlineCid is the Cid of a raw block holding TestInlineData.
+	TestInlineCid  = "zb2rhkY1kvgXmmk4UQdkZLk6bDtPhBB1XLRGT6jEeaPwZzgPt"
+	TestInlineData = []byte(`{"manifest":true}`)
 	// ErrorCid is meant to be used as a Cid which causes errors. i.e. the
 	// ipfs mock fails when pinning this CID.
-	ErrorCid       = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmc"
+	ErrorCid = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmc"
+	// AllocErrorCid is meant to be used as a Cid for which allocations
+	// fail. i.e. the rpc mock fails pinning it for lack of candidates.
+	AllocErrorCid = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmd"
+	// QuotaErrorCid is meant to be used as a Cid which exceeds a quota.
+	// i.e. the rpc mock fails pinning it with a QuotaError.
+	QuotaErrorCid = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmg"
+	// IndirectCid is meant to be used as a Cid which is already pinned
+	// as part of another recursive pin. i.e. the rpc mock reports it as
+	// indirect.
+	IndirectCid = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmf"
+	// SlowCid1 is meant to be used as a Cid which takes long to pin.
+	// i.e. the rpc mock takes a second to pin it.
+	SlowCid1 = "QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmme"
+	// TestPath is an IPNS path which the ipfs mock resolves to TestCid1.
+	// Other paths cannot be resolved.
+	TestPath       = "/ipns/test.example.com/data"
 	TestPeerID1, _ = peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
 	TestPeerID2, _ = peer.IDB58Decode("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
 	TestPeerID3, _ = peer.IDB58Decode("QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa")
+	TestPeerID4, _ = peer.IDB58Decode("QmZ8naDy5mEz4GLuQwjWt9MPYqHTBbsm8tQBrNSjiq6zBc")
+	TestPeerID5, _ = peer.IDB58Decode("QmZVAo3wd8s5eTTy2kPYs34J9PvfxpKPuYsePPYGjgRRjg")
 )
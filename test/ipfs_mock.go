@@ -1,8 +1,10 @@
 package test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -13,6 +15,7 @@ import (
 	"github.com/ipfs/ipfs-cluster/state/mapstate"
 
 	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 // IpfsMock is an ipfs daemon mock which should sustain the functionality used by ipfscluster.
@@ -27,6 +30,10 @@ type mockPinResp struct {
 	Pins []string
 }
 
+type mockPinProgressResp struct {
+	Progress int
+}
+
 type mockPinType struct {
 	Type string
 }
@@ -45,6 +52,26 @@ type mockIDResp struct {
 	Addresses []string
 }
 
+type mockResolveResp struct {
+	Path string
+}
+
+type mockSwarmPeersResp struct {
+	Peers []mockIpfsPeer
+}
+
+type mockIpfsPeer struct {
+	Addr string
+	Peer string
+}
+
+type mockBandwidthStatsResp struct {
+	TotalIn  uint64
+	TotalOut uint64
+	RateIn   float64
+	RateOut  float64
+}
+
 type mockRepoStatResp struct {
 	RepoSize   uint64
 	NumObjects uint64
@@ -57,6 +84,16 @@ type mockConfigResp struct {
 	}
 }
 
+type mockBlockPutResp struct {
+	Key  string
+	Size int
+}
+
+type mockObjectStatResp struct {
+	Hash           string
+	CumulativeSize uint64
+}
+
 type mockAddResp struct {
 	Name  string
 	Hash  string
@@ -138,6 +175,12 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			goto ERROR
 		}
+		if query.Get("progress") == "true" {
+			for i := 1; i <= 3; i++ {
+				j, _ := json.Marshal(mockPinProgressResp{Progress: i})
+				w.Write(j)
+			}
+		}
 		m.pinMap.Add(api.PinCid(c))
 		resp := mockPinResp{
 			Pins: []string{cidStr},
@@ -195,6 +238,40 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 			j, _ := json.Marshal(resp)
 			w.Write(j)
 		}
+	case "block/get":
+		query := r.URL.Query()
+		arg, ok := query["arg"]
+		if !ok || len(arg) != 1 || arg[0] != TestInlineCid {
+			goto ERROR
+		}
+		w.Write(TestInlineData)
+	case "block/put":
+		f, _, err := r.FormFile("data")
+		if err != nil {
+			goto ERROR
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil || !bytes.Equal(data, TestInlineData) {
+			goto ERROR
+		}
+		resp := mockBlockPutResp{
+			Key:  TestInlineCid,
+			Size: len(data),
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
+	case "object/stat":
+		query := r.URL.Query()
+		arg, ok := query["arg"]
+		if !ok || len(arg) != 1 || arg[0] != TestInlineCid {
+			goto ERROR
+		}
+		resp := mockObjectStatResp{
+			Hash:           TestInlineCid,
+			CumulativeSize: uint64(len(TestInlineData)),
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
 	case "swarm/connect":
 		query := r.URL.Query()
 		arg, ok := query["arg"]
@@ -220,6 +297,35 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		}
 		j, _ := json.Marshal(resp)
 		w.Write(j)
+	case "resolve":
+		query := r.URL.Query()
+		arg, ok := query["arg"]
+		if !ok || len(arg) != 1 || arg[0] != TestPath {
+			goto ERROR
+		}
+		resp := mockResolveResp{
+			Path: "/ipfs/" + TestCid1,
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
+	case "swarm/peers":
+		resp := mockSwarmPeersResp{
+			Peers: []mockIpfsPeer{
+				{Peer: peer.IDB58Encode(TestPeerID4)},
+				{Peer: peer.IDB58Encode(TestPeerID5)},
+			},
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
+	case "stats/bw":
+		resp := mockBandwidthStatsResp{
+			TotalIn:  100000,
+			TotalOut: 200000,
+			RateIn:   1000.5,
+			RateOut:  2000.5,
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
 	case "config/show":
 		resp := mockConfigResp{
 			Datastore: struct {
@@ -1,7 +1,9 @@
 package test
 
 import (
+	"encoding/json"
 	"errors"
+	"sort"
 	"testing"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 	host "github.com/libp2p/go-libp2p-host"
 	peer "github.com/libp2p/go-libp2p-peer"
+	multihash "github.com/multiformats/go-multihash"
 )
 
 // ErrBadCid is returned when using ErrorCid. Operations with that CID always
@@ -38,8 +41,76 @@ func NewMockRPCClientWithHost(t *testing.T, h host.Host) *rpc.Client {
 }
 
 func (mock *mockService) Pin(in api.PinSerial, out *struct{}) error {
-	if in.Cid == ErrorCid {
+	if in.Namespace != "" && in.Namespace != "team-a" {
+		return api.NewInvalidPinError("unknown namespace '%s'", in.Namespace)
+	}
+	switch in.Cid {
+	case ErrorCid:
 		return ErrBadCid
+	case AllocErrorCid:
+		c, _ := cid.Decode(in.Cid)
+		return &api.AllocationError{
+			Cid:    c,
+			Reason: "not enough candidates",
+			Vetoes: map[peer.ID]string{
+				TestPeerID2: "blacklisted",
+				TestPeerID3: "invalid or expired metric",
+			},
+		}
+	case QuotaErrorCid:
+		return &api.QuotaError{
+			Namespace: in.Namespace,
+			Quota:     "max_bytes",
+			Max:       100,
+			Used:      90,
+			Requested: 20,
+		}
+	}
+	return nil
+}
+
+func (mock *mockService) PinBatch(in []api.PinSerial, out *int) error {
+	for _, p := range in {
+		err := mock.Pin(p, &struct{}{})
+		if err != nil {
+			return err
+		}
+		*out++
+	}
+	return nil
+}
+
+func (mock *mockService) Batch(in []api.BatchItemSerial, out *[]api.BatchResult) error {
+	results := make([]api.BatchResult, 0, len(in))
+	for _, item := range in {
+		var err error
+		if item.Unpin {
+			err = mock.Unpin(item.PinSerial, &struct{}{})
+		} else {
+			err = mock.Pin(item.PinSerial, &struct{}{})
+		}
+		r := api.BatchResult{
+			Cid:   item.Cid,
+			Unpin: item.Unpin,
+		}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	*out = results
+	return nil
+}
+
+func (mock *mockService) ResolveMultihash(in string, out *api.ResolvedMultihash) error {
+	mh, err := multihash.FromB58String(in)
+	if err != nil {
+		return err
+	}
+	*out = api.ResolvedMultihash{
+		Multihash: in,
+		Cid:       cid.NewCidV0(mh).String(),
+		Available: true,
 	}
 	return nil
 }
@@ -51,6 +122,61 @@ func (mock *mockService) Unpin(in api.PinSerial, out *struct{}) error {
 	return nil
 }
 
+func (mock *mockService) UnpinNamespace(in api.PinSerial, out *struct{}) error {
+	if in.Cid == ErrorCid || in.Namespace != "team-a" {
+		return ErrBadCid
+	}
+	return nil
+}
+
+func (mock *mockService) Namespaces(in struct{}, out *[]api.Namespace) error {
+	*out = []api.Namespace{
+		{
+			Name:              "",
+			ReplicationFactor: -1,
+			Pins:              2,
+		},
+		{
+			Name:              "team-a",
+			ReplicationFactor: 2,
+			MaxPins:           10,
+			Pins:              1,
+		},
+	}
+	return nil
+}
+
+func (mock *mockService) NamespacePins(in string, out *[]api.PinSerial) error {
+	switch in {
+	case "":
+		*out = []api.PinSerial{
+			{
+				Cid: TestCid2,
+			},
+			{
+				Cid: TestCid3,
+			},
+		}
+	case "team-a":
+		*out = []api.PinSerial{
+			{
+				Cid:       TestCid1,
+				Namespace: "team-a",
+			},
+		}
+	default:
+		return errors.New("unknown namespace")
+	}
+	return nil
+}
+
+func (mock *mockService) CancelPin(in api.PinSerial, out *struct{}) error {
+	if in.Cid != SlowCid1 {
+		return errors.New(in.Cid + " is not being pinned by any peer")
+	}
+	return nil
+}
+
 func (mock *mockService) Pins(in struct{}, out *[]api.PinSerial) error {
 	*out = []api.PinSerial{
 		{
@@ -66,6 +192,105 @@ func (mock *mockService) Pins(in struct{}, out *[]api.PinSerial) error {
 	return nil
 }
 
+func (mock *mockService) PinsPage(in api.PinsPage, out *[]api.PinSerial) error {
+	var pins []api.PinSerial
+	mock.Pins(struct{}{}, &pins)
+	sort.Slice(pins, func(i, j int) bool {
+		if in.ByName && pins[i].Name != pins[j].Name {
+			return pins[i].Name < pins[j].Name
+		}
+		return pins[i].Cid < pins[j].Cid
+	})
+	*out = make([]api.PinSerial, 0, len(pins))
+	skip := in.Offset
+	for _, p := range pins {
+		if !in.ByName && p.Cid <= in.After {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if in.Limit > 0 && len(*out) == in.Limit {
+			break
+		}
+		*out = append(*out, p)
+	}
+	return nil
+}
+
+func (mock *mockService) PinLog(in uint64, out *[]api.PinLogEntrySerial) error {
+	entries := []api.PinLogEntrySerial{
+		{
+			Seq: 1,
+			Op:  api.PinLogPin,
+			Pin: api.PinSerial{Cid: TestCid1},
+		},
+		{
+			Seq: 2,
+			Op:  api.PinLogUnpin,
+			Pin: api.PinSerial{Cid: TestCid1},
+		},
+	}
+	if in > uint64(len(entries)) {
+		return errors.New("sequence is ahead of the pin log")
+	}
+	*out = entries[in:]
+	return nil
+}
+
+func (mock *mockService) PinLogAdd(in []api.PinLogEntrySerial, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockService) Events(in uint64, out *[]api.EventSerial) error {
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	evs := []api.EventSerial{
+		{
+			Seq:  1,
+			Type: api.EventPinStatus,
+			TS:   ts,
+			PinEvent: &api.PinEventSerial{
+				PinInfoSerial: api.PinInfoSerial{
+					Cid:    TestCid1,
+					Peer:   peer.IDB58Encode(TestPeerID1),
+					Status: "pinned",
+					TS:     ts,
+				},
+			},
+		},
+		{
+			Seq:  2,
+			Type: api.EventPeerJoined,
+			TS:   ts,
+			Peer: peer.IDB58Encode(TestPeerID2),
+		},
+	}
+	if in >= uint64(len(evs)) {
+		// no new events: wait like cluster does, shortly
+		time.Sleep(100 * time.Millisecond)
+		*out = []api.EventSerial{}
+		return nil
+	}
+	*out = evs[in:]
+	return nil
+}
+
+func (mock *mockService) IPFSAdd(in api.AddChunk, out *[]api.AddedOutputSerial) error {
+	if !in.Last {
+		*out = []api.AddedOutputSerial{}
+		return nil
+	}
+	*out = []api.AddedOutputSerial{
+		{
+			Name: "testfile",
+			Cid:  TestCid1,
+			Size: 10,
+		},
+	}
+	return nil
+}
+
 func (mock *mockService) PinGet(in api.PinSerial, out *api.PinSerial) error {
 	if in.Cid == ErrorCid {
 		return errors.New("expected error when using ErrorCid")
@@ -74,6 +299,185 @@ func (mock *mockService) PinGet(in api.PinSerial, out *api.PinSerial) error {
 	return nil
 }
 
+func (mock *mockService) DuplicatePins(in struct{}, out *[]api.DuplicatePinsSerial) error {
+	*out = []api.DuplicatePinsSerial{
+		{
+			Multihash: TestCid1,
+			Pins: []api.PinSerial{
+				{
+					Cid:               TestCid1,
+					ReplicationFactor: -1,
+				},
+				{
+					Cid:               TestCid1V1,
+					ReplicationFactor: -1,
+				},
+			},
+		},
+	}
+	return nil
+}
+
+func (mock *mockService) MergeDuplicatePins(in struct{}, out *[]api.DuplicatePinsSerial) error {
+	return mock.DuplicatePins(in, out)
+}
+
+func (mock *mockService) StateStats(in string, out *api.StateStatsSerial) error {
+	*out = api.StateStatsSerial{
+		Pins:                3,
+		Everywhere:          3,
+		ByReplicationFactor: map[int]int{-1: 3},
+		ByNamePrefix:        map[string]int{in: 3},
+		ByPeer:              map[string]int{},
+	}
+	return nil
+}
+
+func (mock *mockService) AllocationPreview(in api.AllocationPreviewSerial, out *api.PinSerial) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	*out = api.PinSerial{
+		Cid:               in.Cid,
+		Allocations:       []string{TestPeerID1.Pretty(), TestPeerID2.Pretty()},
+		ReplicationFactor: 2,
+	}
+	return nil
+}
+
+func (mock *mockService) SimulateAllocations(in []api.PinSerial, out *api.AllocationSimulationSerial) error {
+	records := make([]api.AllocationRecordSerial, 0, len(in))
+	for _, p := range in {
+		if p.Cid == ErrorCid {
+			return ErrBadCid
+		}
+		records = append(records, api.AllocationRecordSerial{
+			Cid:         p.Cid,
+			Peer:        TestPeerID1.Pretty(),
+			Allocations: []string{TestPeerID1.Pretty()},
+			Metrics:     map[string]string{},
+		})
+	}
+	*out = api.AllocationSimulationSerial{
+		Records: records,
+		Load: []api.PeerLoadSerial{
+			{
+				Peer:    TestPeerID1.Pretty(),
+				Current: 1,
+				Added:   len(in),
+			},
+		},
+	}
+	return nil
+}
+
+func (mock *mockService) RPCCall(in api.RPCCallSerial, out *[]byte) error {
+	if in.Service != "Cluster" || in.Method != "Version" {
+		return errors.New("unknown RPC method")
+	}
+	res, err := json.Marshal(api.Version{Version: "0.0.mock"})
+	*out = res
+	return err
+}
+
+func (mock *mockService) PeerMaintenance(in api.PeerMaintenanceSerial, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockService) MaintenancePeers(in struct{}, out *[]string) error {
+	*out = []string{TestPeerID1.Pretty()}
+	return nil
+}
+
+func (mock *mockService) SetLogLevel(in api.LogLevel, out *struct{}) error {
+	if in.Component == "" {
+		return errors.New("no logging component given")
+	}
+	return nil
+}
+
+func (mock *mockService) SetLogLevelAllPeers(in api.LogLevel, out *struct{}) error {
+	return mock.SetLogLevel(in, out)
+}
+
+func (mock *mockService) Snapshot(in struct{}, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockService) SetAllocationStrategy(in api.AllocationStrategy, out *struct{}) error {
+	if in.Name != "numpin" && in.Name != "disk-freespace" {
+		return errors.New("unknown allocation strategy")
+	}
+	return nil
+}
+
+func (mock *mockService) SetAllocationStrategyAllPeers(in api.AllocationStrategy, out *struct{}) error {
+	return mock.SetAllocationStrategy(in, out)
+}
+
+func (mock *mockService) SetRuntimeConfig(in api.RuntimeConfig, out *struct{}) error {
+	for k := range in {
+		if k != "maptracker.concurrent_pins" {
+			return errors.New(k + " cannot be changed at runtime")
+		}
+	}
+	return nil
+}
+
+func (mock *mockService) SetRuntimeConfigAllPeers(in api.RuntimeConfig, out *struct{}) error {
+	return mock.SetRuntimeConfig(in, out)
+}
+
+func (mock *mockService) AllocationHistory(in api.PinSerial, out *[]api.AllocationRecordSerial) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	*out = []api.AllocationRecordSerial{
+		{
+			Cid:         in.Cid,
+			Peer:        TestPeerID1.Pretty(),
+			Allocations: []string{TestPeerID1.Pretty(), TestPeerID2.Pretty()},
+			MetricName:  "freespace",
+			Metrics: map[string]string{
+				TestPeerID1.Pretty(): "100",
+				TestPeerID2.Pretty(): "50",
+			},
+			Reason: "under-replicated: added the best candidates",
+			TS:     time.Now().UTC().Format(time.RFC3339Nano),
+		},
+	}
+	return nil
+}
+
+func (mock *mockService) AllocationHistoryLocal(in api.PinSerial, out *[]api.AllocationRecordSerial) error {
+	return mock.AllocationHistory(in, out)
+}
+
+func (mock *mockService) AllocationDecisions(in struct{}, out *[]api.AllocationRecordSerial) error {
+	*out = []api.AllocationRecordSerial{
+		{
+			Cid:         TestCid1,
+			Peer:        TestPeerID1.Pretty(),
+			Allocations: []string{TestPeerID1.Pretty()},
+			MetricName:  "freespace",
+			Metrics: map[string]string{
+				TestPeerID1.Pretty(): "100",
+			},
+			Considered: []string{TestPeerID1.Pretty(), TestPeerID2.Pretty()},
+			Vetoes: map[string]string{
+				TestPeerID2.Pretty(): "in maintenance",
+			},
+			Reason: "under-replicated: added the best candidates",
+			TS:     time.Now().UTC().Format(time.RFC3339Nano),
+		},
+	}
+	return nil
+}
+
+func (mock *mockService) AllocationDecisionsLocal(in struct{}, out *[]api.AllocationRecordSerial) error {
+	return mock.AllocationDecisions(in, out)
+}
+
 func (mock *mockService) ID(in struct{}, out *api.IDSerial) error {
 	//_, pubkey, _ := crypto.GenerateKeyPair(
 	//	DefaultConfigCrypto,
@@ -82,6 +486,7 @@ func (mock *mockService) ID(in struct{}, out *api.IDSerial) error {
 		ID: TestPeerID1.Pretty(),
 		//PublicKey: pubkey,
 		Version: "0.0.mock",
+		Health:  string(api.PeerHealthOK),
 		IPFS: api.IPFSIDSerial{
 			ID: TestPeerID1.Pretty(),
 			Addresses: api.MultiaddrsSerial{
@@ -92,9 +497,111 @@ func (mock *mockService) ID(in struct{}, out *api.IDSerial) error {
 	return nil
 }
 
+func (mock *mockService) Health(in struct{}, out *api.HealthSerial) error {
+	*out = api.HealthSerial{
+		Peer:   TestPeerID1.Pretty(),
+		Status: string(api.PeerHealthOK),
+	}
+	return nil
+}
+
+func (mock *mockService) ConnectGraph(in struct{}, out *api.ConnectGraphSerial) error {
+	*out = api.ConnectGraph{
+		ClusterID: TestPeerID1,
+		ClusterLinks: map[peer.ID][]peer.ID{
+			TestPeerID1: {TestPeerID2},
+			TestPeerID2: {TestPeerID1},
+		},
+		IPFSLinks: map[peer.ID][]peer.ID{
+			TestPeerID4: {TestPeerID5},
+			TestPeerID5: {TestPeerID4},
+		},
+		ClustertoIPFS: map[peer.ID]peer.ID{
+			TestPeerID1: TestPeerID4,
+			TestPeerID2: TestPeerID5,
+		},
+	}.ToSerial()
+	return nil
+}
+
+func (mock *mockService) PeersLiveness(in struct{}, out *[]api.PeerLivenessSerial) error {
+	*out = []api.PeerLivenessSerial{
+		api.PeerLiveness{
+			Peer:       TestPeerID1,
+			Alive:      true,
+			LastMetric: time.Now().Add(30 * time.Second),
+			RTT:        time.Millisecond,
+		}.ToSerial(),
+		api.PeerLiveness{
+			Peer:  TestPeerID2,
+			Error: "peer unreachable",
+		}.ToSerial(),
+	}
+	return nil
+}
+
+func (mock *mockService) SyncStatus(in struct{}, out *api.SyncStatusSerial) error {
+	*out = api.SyncStatus{
+		Peer: TestPeerID1,
+		State: api.SyncInfo{
+			Enabled:   true,
+			Interval:  time.Minute,
+			Last:      time.Now(),
+			OutOfSync: 1,
+		},
+		IPFS: api.SyncInfo{
+			Enabled:  true,
+			Interval: 2 * time.Minute,
+		},
+	}.ToSerial()
+	return nil
+}
+
+func (mock *mockService) TrackerMetrics(in struct{}, out *api.TrackerMetricsSerial) error {
+	*out = api.TrackerMetrics{
+		Peer:          TestPeerID1,
+		PinQueue:      2,
+		InFlight:      1,
+		PinErrors:     1,
+		Retries:       3,
+		Pins:          10,
+		AvgPinLatency: time.Second,
+	}.ToSerial()
+	return nil
+}
+
+func (mock *mockService) PublicStatus(in struct{}, out *api.PublicStatus) error {
+	*out = api.PublicStatus{
+		Peers:        3,
+		HealthyPeers: 3,
+		Pins:         3,
+		TotalSize:    6000,
+		Health:       api.PeerHealthOK,
+	}
+	return nil
+}
+
+func (mock *mockService) ScalingAdvice(in struct{}, out *api.ScalingAdviceSerial) error {
+	*out = api.ScalingAdviceSerial{
+		Action:  string(api.ScalingAddPeers),
+		Peers:   1,
+		Reasons: []string{TestPeerID1.Pretty() + " has 101 queued pins"},
+		Pressure: []api.PeerPressureSerial{
+			{
+				Peer:          TestPeerID1.Pretty(),
+				Queued:        101,
+				UnderPressure: true,
+			},
+		},
+		TS: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	return nil
+}
+
 func (mock *mockService) Version(in struct{}, out *api.Version) error {
 	*out = api.Version{
 		Version: "0.0.mock",
+		Schema:  api.SchemaVersion,
 	}
 	return nil
 }
@@ -118,7 +625,22 @@ func (mock *mockService) PeerRemove(in peer.ID, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) StatusAll(in struct{}, out *[]api.GlobalPinInfoSerial) error {
+func (mock *mockService) PeerRemoval(in peer.ID, out *api.PeerRemovalSerial) error {
+	if in != TestPeerID1 {
+		return errors.New("peer has not been removed")
+	}
+	*out = api.PeerRemoval{
+		Peer:        TestPeerID1,
+		Phase:       api.PeerRemovalDone,
+		Total:       2,
+		Reallocated: 2,
+		Start:       time.Now().Add(-time.Minute),
+		End:         time.Now(),
+	}.ToSerial()
+	return nil
+}
+
+func (mock *mockService) StatusAll(in api.StatusFilter, out *[]api.GlobalPinInfoSerial) error {
 	c1, _ := cid.Decode(TestCid1)
 	c2, _ := cid.Decode(TestCid2)
 	c3, _ := cid.Decode(TestCid3)
@@ -157,13 +679,49 @@ func (mock *mockService) StatusAll(in struct{}, out *[]api.GlobalPinInfoSerial)
 			},
 		},
 	})
+	filtered := make([]api.GlobalPinInfoSerial, 0, len(*out))
+	for _, gpi := range *out {
+		for p, pi := range gpi.PeerMap {
+			if !in.Match(api.TrackerStatusFromString(pi.Status)) {
+				delete(gpi.PeerMap, p)
+			}
+		}
+		if len(gpi.PeerMap) > 0 {
+			filtered = append(filtered, gpi)
+		}
+	}
+	*out = filtered
 	return nil
 }
 
-func (mock *mockService) StatusAllLocal(in struct{}, out *[]api.PinInfoSerial) error {
+func (mock *mockService) StatusAllLocal(in api.StatusFilter, out *[]api.PinInfoSerial) error {
 	return mock.TrackerStatusAll(in, out)
 }
 
+func (mock *mockService) StatusAllChunk(in api.StatusChunk, out *[]api.GlobalPinInfoSerial) error {
+	var all []api.GlobalPinInfoSerial
+	mock.StatusAll(in.Filter, &all)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Cid < all[j].Cid
+	})
+	*out = make([]api.GlobalPinInfoSerial, 0, in.Limit)
+	for _, gpi := range all {
+		switch {
+		case len(in.Cids) > 0:
+			if containsString(in.Cids, gpi.Cid) {
+				*out = append(*out, gpi)
+			}
+		case gpi.Cid > in.After && len(*out) < in.Limit:
+			*out = append(*out, gpi)
+		}
+	}
+	return nil
+}
+
+func (mock *mockService) StatusAllLocalChunk(in api.StatusChunk, out *[]api.PinInfoSerial) error {
+	return mock.TrackerStatusAllChunk(in, out)
+}
+
 func (mock *mockService) Status(in api.PinSerial, out *api.GlobalPinInfoSerial) error {
 	if in.Cid == ErrorCid {
 		return ErrBadCid
@@ -188,11 +746,11 @@ func (mock *mockService) StatusLocal(in api.PinSerial, out *api.PinInfoSerial) e
 }
 
 func (mock *mockService) SyncAll(in struct{}, out *[]api.GlobalPinInfoSerial) error {
-	return mock.StatusAll(in, out)
+	return mock.StatusAll(nil, out)
 }
 
 func (mock *mockService) SyncAllLocal(in struct{}, out *[]api.PinInfoSerial) error {
-	return mock.StatusAllLocal(in, out)
+	return mock.StatusAllLocal(nil, out)
 }
 
 func (mock *mockService) Sync(in api.PinSerial, out *api.GlobalPinInfoSerial) error {
@@ -208,8 +766,12 @@ func (mock *mockService) StateSync(in struct{}, out *[]api.PinInfoSerial) error
 	return nil
 }
 
-func (mock *mockService) RecoverAllLocal(in struct{}, out *[]api.PinInfoSerial) error {
-	return mock.TrackerRecoverAll(in, out)
+func (mock *mockService) RecoverAll(in api.StatusFilter, out *[]api.GlobalPinInfoSerial) error {
+	return mock.StatusAll(in, out)
+}
+
+func (mock *mockService) RecoverAllLocal(in api.StatusFilter, out *[]api.PinInfoSerial) error {
+	return mock.TrackerRecoverAll(struct{}{}, out)
 }
 
 func (mock *mockService) Recover(in api.PinSerial, out *api.GlobalPinInfoSerial) error {
@@ -230,11 +792,11 @@ func (mock *mockService) Untrack(in api.PinSerial, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) TrackerStatusAll(in struct{}, out *[]api.PinInfoSerial) error {
+func (mock *mockService) TrackerStatusAll(in api.StatusFilter, out *[]api.PinInfoSerial) error {
 	c1, _ := cid.Decode(TestCid1)
 	c3, _ := cid.Decode(TestCid3)
 
-	*out = pinInfoSliceToSerial([]api.PinInfo{
+	pinfos := []api.PinInfo{
 		{
 			Cid:    c1,
 			Peer:   TestPeerID1,
@@ -247,7 +809,34 @@ func (mock *mockService) TrackerStatusAll(in struct{}, out *[]api.PinInfoSerial)
 			Status: api.TrackerStatusPinError,
 			TS:     time.Now(),
 		},
+	}
+	filtered := make([]api.PinInfo, 0, len(pinfos))
+	for _, pi := range pinfos {
+		if in.Match(pi.Status) {
+			filtered = append(filtered, pi)
+		}
+	}
+	*out = pinInfoSliceToSerial(filtered)
+	return nil
+}
+
+func (mock *mockService) TrackerStatusAllChunk(in api.StatusChunk, out *[]api.PinInfoSerial) error {
+	var all []api.PinInfoSerial
+	mock.TrackerStatusAll(in.Filter, &all)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Cid < all[j].Cid
 	})
+	*out = make([]api.PinInfoSerial, 0, in.Limit)
+	for _, pi := range all {
+		switch {
+		case len(in.Cids) > 0:
+			if containsString(in.Cids, pi.Cid) {
+				*out = append(*out, pi)
+			}
+		case pi.Cid > in.After && len(*out) < in.Limit:
+			*out = append(*out, pi)
+		}
+	}
 	return nil
 }
 
@@ -271,6 +860,13 @@ func (mock *mockService) TrackerRecoverAll(in struct{}, out *[]api.PinInfoSerial
 	return nil
 }
 
+func (mock *mockService) TrackerCancelPin(in api.PinSerial, out *struct{}) error {
+	if in.Cid != SlowCid1 {
+		return errors.New(in.Cid + " is not being pinned")
+	}
+	return nil
+}
+
 func (mock *mockService) TrackerRecover(in api.PinSerial, out *api.PinInfoSerial) error {
 	in2 := in.ToPin()
 	*out = api.PinInfo{
@@ -282,6 +878,37 @@ func (mock *mockService) TrackerRecover(in api.PinSerial, out *api.PinInfoSerial
 	return nil
 }
 
+func (mock *mockService) TrackerKeepalive(in api.PinProgressSerial, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockService) TrackerPins(in struct{}, out *[]api.PinSerial) error {
+	*out = []api.PinSerial{
+		{
+			Cid:               TestCid1,
+			ReplicationFactor: -1,
+		},
+		{
+			Cid:               TestCid2,
+			ReplicationFactor: -1,
+		},
+		{
+			Cid:               TestCid3,
+			ReplicationFactor: -1,
+		},
+	}
+	return nil
+}
+
+func (mock *mockService) TrackerPinGet(in api.PinSerial, out *api.PinSerial) error {
+	if in.Cid == ErrorCid {
+		return errors.New("expected error when using ErrorCid")
+	}
+	*out = in
+	out.ReplicationFactor = -1
+	return nil
+}
+
 /* PeerManager methods */
 
 func (mock *mockService) PeerManagerAddPeer(in api.MultiaddrSerial, out *struct{}) error {
@@ -291,6 +918,32 @@ func (mock *mockService) PeerManagerAddPeer(in api.MultiaddrSerial, out *struct{
 /* IPFSConnector methods */
 
 func (mock *mockService) IPFSPin(in api.PinSerial, out *struct{}) error {
+	if in.Cid == ErrorCid {
+		return errors.New("expected error when using ErrorCid")
+	}
+	if in.Cid == SlowCid1 {
+		time.Sleep(time.Second)
+	}
+	return nil
+}
+
+func (mock *mockService) IPFSCancel(in api.PinSerial, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockService) IPFSBlockGet(in api.PinSerial, out *[]byte) error {
+	if in.Cid != TestInlineCid {
+		return errors.New("block not found")
+	}
+	*out = TestInlineData
+	return nil
+}
+
+func (mock *mockService) IPFSResolve(in string, out *string) error {
+	if in != TestPath {
+		return errors.New("cannot resolve " + in)
+	}
+	*out = TestCid1
 	return nil
 }
 
@@ -299,9 +952,12 @@ func (mock *mockService) IPFSUnpin(in api.PinSerial, out *struct{}) error {
 }
 
 func (mock *mockService) IPFSPinLsCid(in api.PinSerial, out *api.IPFSPinStatus) error {
-	if in.Cid == TestCid1 || in.Cid == TestCid3 {
+	switch in.Cid {
+	case TestCid1, TestCid3:
 		*out = api.IPFSPinStatusRecursive
-	} else {
+	case IndirectCid:
+		*out = api.IPFSPinStatusIndirect
+	default:
 		*out = api.IPFSPinStatusUnpinned
 	}
 	return nil
@@ -316,6 +972,22 @@ func (mock *mockService) IPFSPinLs(in string, out *map[string]api.IPFSPinStatus)
 	return nil
 }
 
+func (mock *mockService) IPFSLocalPins(in struct{}, out *[]api.LocalPinSerial) error {
+	*out = []api.LocalPinSerial{
+		{
+			Cid:       TestCid1,
+			Type:      "recursive",
+			Tracked:   true,
+			Allocated: true,
+		},
+		{
+			Cid:  TestCid3,
+			Type: "recursive",
+		},
+	}
+	return nil
+}
+
 func (mock *mockService) IPFSConnectSwarms(in struct{}, out *struct{}) error {
 	return nil
 }
@@ -336,16 +1008,96 @@ func (mock *mockService) IPFSRepoSize(in struct{}, out *uint64) error {
 	return nil
 }
 
+func (mock *mockService) IPFSSwarmPeers(in struct{}, out *[]peer.ID) error {
+	*out = []peer.ID{TestPeerID4, TestPeerID5}
+	return nil
+}
+
 func (mock *mockService) IPFSFreeSpace(in struct{}, out *uint64) error {
 	// RepoSize is 2KB, StorageMax is 100KB
 	*out = 98000
 	return nil
 }
 
+func (mock *mockService) IPFSBandwidthRate(in struct{}, out *uint64) error {
+	// RateIn is 1KB/s, RateOut is 2KB/s
+	*out = 3000
+	return nil
+}
+
 func (mock *mockService) ConsensusAddPeer(in peer.ID, out *struct{}) error {
 	return errors.New("mock rpc cannot redirect")
 }
 
+func (mock *mockService) ConsensusAddNonVoter(in peer.ID, out *struct{}) error {
+	return errors.New("mock rpc cannot redirect")
+}
+
+func (mock *mockService) ConsensusStatus(in struct{}, out *api.ConsensusStatusSerial) error {
+	*out = api.ConsensusStatus{
+		Peer:         TestPeerID1,
+		Leader:       TestPeerID1,
+		Voter:        true,
+		Term:         2,
+		CommitIndex:  10,
+		AppliedIndex: 10,
+	}.ToSerial()
+	return nil
+}
+
+func (mock *mockService) ConsensusStatusAll(in struct{}, out *[]api.ConsensusStatusSerial) error {
+	var s1 api.ConsensusStatusSerial
+	mock.ConsensusStatus(in, &s1)
+	s2 := api.ConsensusStatus{
+		Peer:         TestPeerID2,
+		Leader:       TestPeerID1,
+		Voter:        true,
+		Term:         2,
+		CommitIndex:  10,
+		AppliedIndex: 7,
+		Lag:          3,
+	}.ToSerial()
+	*out = []api.ConsensusStatusSerial{s1, s2}
+	return nil
+}
+
+func (mock *mockService) StateChecksum(in struct{}, out *api.StateChecksumSerial) error {
+	*out = api.StateChecksum{
+		Peer: TestPeerID1,
+		Pins: 3,
+		Root: "abc",
+	}.ToSerial()
+	return nil
+}
+
+func (mock *mockService) StateBucket(in int, out *[]api.PinSerial) error {
+	*out = []api.PinSerial{}
+	return nil
+}
+
+func (mock *mockService) StateVerify(in struct{}, out *[]api.StateDiffSerial) error {
+	c3, _ := cid.Decode(TestCid3)
+	*out = []api.StateDiffSerial{
+		api.StateDiff{
+			Peer:       TestPeerID1,
+			Root:       "abc",
+			LeaderRoot: "abc",
+		}.ToSerial(),
+		api.StateDiff{
+			Peer:       TestPeerID2,
+			Root:       "def",
+			LeaderRoot: "abc",
+			Missing:    []*cid.Cid{c3},
+		}.ToSerial(),
+	}
+	return nil
+}
+
+func (mock *mockService) ConsensusVoter(in struct{}, out *bool) error {
+	*out = true
+	return nil
+}
+
 func (mock *mockService) ConsensusRmPeer(in peer.ID, out *struct{}) error {
 	return errors.New("mock rpc cannot redirect")
 }
@@ -355,6 +1107,29 @@ func (mock *mockService) ConsensusPeers(in struct{}, out *[]peer.ID) error {
 	return nil
 }
 
+func (mock *mockService) PeerMonitorLastMetrics(in string, out *[]api.Metric) error {
+	*out = []api.Metric{}
+	if in != "tags" {
+		return nil
+	}
+	tags := map[peer.ID]string{
+		TestPeerID1: "region=eu,host=a",
+		TestPeerID2: "region=eu,host=b",
+		TestPeerID3: "region=us,host=c",
+	}
+	for p, v := range tags {
+		m := api.Metric{
+			Name:  in,
+			Peer:  p,
+			Value: v,
+			Valid: true,
+		}
+		m.SetTTL(30)
+		*out = append(*out, m)
+	}
+	return nil
+}
+
 // FIXME: dup from util.go
 func globalPinInfoSliceToSerial(gpi []api.GlobalPinInfo) []api.GlobalPinInfoSerial {
 	gpis := make([]api.GlobalPinInfoSerial, len(gpi), len(gpi))
@@ -372,3 +1147,12 @@ func pinInfoSliceToSerial(pi []api.PinInfo) []api.PinInfoSerial {
 	}
 	return pis
 }
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
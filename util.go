@@ -3,6 +3,7 @@ package ipfscluster
 import (
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/ipfs/ipfs-cluster/api"
 
@@ -11,7 +12,7 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 )
 
-// The copy functions below are used in calls to Cluste.multiRPC()
+// The copy functions below are used in calls to Broadcaster.Broadcast()
 // func copyPIDsToIfaces(in []peer.ID) []interface{} {
 // 	ifaces := make([]interface{}, len(in), len(in))
 // 	for i := range in {
@@ -44,6 +45,46 @@ func copyPinInfoSerialSliceToIfaces(in [][]api.PinInfoSerial) []interface{} {
 	return ifaces
 }
 
+func copyAllocationRecordSerialSliceToIfaces(in [][]api.AllocationRecordSerial) []interface{} {
+	ifaces := make([]interface{}, len(in), len(in))
+	for i := range in {
+		ifaces[i] = &in[i]
+	}
+	return ifaces
+}
+
+func copyHealthSerialsToIfaces(in []api.HealthSerial) []interface{} {
+	ifaces := make([]interface{}, len(in), len(in))
+	for i := range in {
+		ifaces[i] = &in[i]
+	}
+	return ifaces
+}
+
+func copyConsensusStatusSerialsToIfaces(in []api.ConsensusStatusSerial) []interface{} {
+	ifaces := make([]interface{}, len(in), len(in))
+	for i := range in {
+		ifaces[i] = &in[i]
+	}
+	return ifaces
+}
+
+func copyStateChecksumSerialsToIfaces(in []api.StateChecksumSerial) []interface{} {
+	ifaces := make([]interface{}, len(in), len(in))
+	for i := range in {
+		ifaces[i] = &in[i]
+	}
+	return ifaces
+}
+
+func copyUint64ToIfaces(in []uint64) []interface{} {
+	ifaces := make([]interface{}, len(in), len(in))
+	for i := range in {
+		ifaces[i] = &in[i]
+	}
+	return ifaces
+}
+
 func copyEmptyStructToIfaces(in []struct{}) []interface{} {
 	ifaces := make([]interface{}, len(in), len(in))
 	for i := range in {
@@ -52,6 +93,22 @@ func copyEmptyStructToIfaces(in []struct{}) []interface{} {
 	return ifaces
 }
 
+func copyIDSerialSliceToIfaces(in [][]api.IDSerial) []interface{} {
+	ifaces := make([]interface{}, len(in), len(in))
+	for i := range in {
+		ifaces[i] = &in[i]
+	}
+	return ifaces
+}
+
+func copyPIDSliceToIfaces(in [][]peer.ID) []interface{} {
+	ifaces := make([]interface{}, len(in), len(in))
+	for i := range in {
+		ifaces[i] = &in[i]
+	}
+	return ifaces
+}
+
 // MultiaddrSplit takes a /proto/value/ipfs/id multiaddress and returns
 // the id on one side and the /proto/value multiaddress on the other.
 func MultiaddrSplit(addr ma.Multiaddr) (peer.ID, ma.Multiaddr, error) {
@@ -153,6 +210,22 @@ func globalPinInfoSliceToSerial(gpi []api.GlobalPinInfo) []api.GlobalPinInfoSeri
 	return gpis
 }
 
+func allocationRecordSliceToSerial(ar []api.AllocationRecord) []api.AllocationRecordSerial {
+	ars := make([]api.AllocationRecordSerial, len(ar), len(ar))
+	for i, v := range ar {
+		ars[i] = v.ToSerial()
+	}
+	return ars
+}
+
+func duplicatePinsToSerial(dp []api.DuplicatePins) []api.DuplicatePinsSerial {
+	dps := make([]api.DuplicatePinsSerial, len(dp), len(dp))
+	for i, v := range dp {
+		dps[i] = v.ToSerial()
+	}
+	return dps
+}
+
 func logError(fmtstr string, args ...interface{}) error {
 	msg := fmt.Sprintf(fmtstr, args...)
 	logger.Error(msg)
@@ -167,3 +240,72 @@ func containsPeer(list []peer.ID, peer peer.ID) bool {
 	}
 	return false
 }
+
+// indexOfPeer returns the position of a peer in the list, or the list
+// length when it is not in it.
+func indexOfPeer(list []peer.ID, peer peer.ID) int {
+	for i, p := range list {
+		if p == peer {
+			return i
+		}
+	}
+	return len(list)
+}
+
+// pinInfoChunk sorts the given items by Cid and returns up to limit
+// of them which come after the given Cid.
+func pinInfoChunk(infos []api.PinInfo, after string, limit int) []api.PinInfo {
+	chunk := make([]api.PinInfo, 0, len(infos))
+	for _, pi := range infos {
+		if pi.Cid.String() > after {
+			chunk = append(chunk, pi)
+		}
+	}
+	sort.Slice(chunk, func(i, j int) bool {
+		return chunk[i].Cid.String() < chunk[j].Cid.String()
+	})
+	if len(chunk) > limit {
+		chunk = chunk[:limit]
+	}
+	return chunk
+}
+
+// pinsPage sorts the given pins and returns the selected page.
+func pinsPage(pins []api.Pin, page api.PinsPage) []api.Pin {
+	sort.Slice(pins, func(i, j int) bool {
+		if page.ByName && pins[i].Name != pins[j].Name {
+			return pins[i].Name < pins[j].Name
+		}
+		return pins[i].Cid.String() < pins[j].Cid.String()
+	})
+
+	if page.After != "" && !page.ByName {
+		i := sort.Search(len(pins), func(i int) bool {
+			return pins[i].Cid.String() > page.After
+		})
+		pins = pins[i:]
+	}
+
+	if page.Offset >= len(pins) {
+		return []api.Pin{}
+	}
+	pins = pins[page.Offset:]
+	if page.Limit > 0 && page.Limit < len(pins) {
+		pins = pins[:page.Limit]
+	}
+	return pins
+}
+
+// filterPinInfos returns the items whose status matches the filter.
+func filterPinInfos(infos []api.PinInfo, filter api.StatusFilter) []api.PinInfo {
+	if len(filter) == 0 {
+		return infos
+	}
+	filtered := make([]api.PinInfo, 0, len(infos))
+	for _, pi := range infos {
+		if filter.Match(pi.Status) {
+			filtered = append(filtered, pi)
+		}
+	}
+	return filtered
+}